@@ -0,0 +1,257 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/nestybox/sysbox-fs/config"
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// configLoader loads sysbox-fs' config file and applies its settings. Config
+// file settings are projected over their command-line flag counterparts, so
+// that the rest of sysbox-fs' logic can continue relying on cli.Context to
+// obtain them. Flags explicitly set by the user in the command-line take
+// precedence over config-file values.
+//
+type configLoader struct {
+	sync.Mutex
+	ctx       *cli.Context
+	path      string
+	userFlags map[string]bool   // flags explicitly set through the command-line
+	cfgFlags  map[string]string // flag values last projected from the config file
+	defFlags  map[string]string // flag values prior to any config file projection
+	hds       domain.HandlerServiceIface
+	disabled  map[string]bool // handlers currently disabled by config
+}
+
+func newConfigLoader(ctx *cli.Context) *configLoader {
+
+	cl := &configLoader{
+		ctx:       ctx,
+		path:      ctx.GlobalString("config"),
+		userFlags: make(map[string]bool),
+		cfgFlags:  make(map[string]string),
+		defFlags:  make(map[string]string),
+		disabled:  make(map[string]bool),
+	}
+
+	for _, name := range ctx.GlobalFlagNames() {
+		if ctx.GlobalIsSet(name) {
+			cl.userFlags[name] = true
+			continue
+		}
+		if val, ok := ctx.GlobalGeneric(name).(fmt.Stringer); ok {
+			cl.defFlags[name] = val.String()
+		}
+	}
+
+	return cl
+}
+
+func (cl *configLoader) setHandlerService(hds domain.HandlerServiceIface) {
+	cl.Lock()
+	defer cl.Unlock()
+
+	cl.hds = hds
+}
+
+// Loads the config file and projects its settings over the command-line
+// flags not explicitly set by the user. Settings removed from the config file
+// (or zeroed) since the last load revert their flags to the default values.
+func (cl *configLoader) loadFlags() (*config.Config, error) {
+
+	cfg, err := config.Load(cl.path)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := cfg.FlagValues()
+
+	for name, val := range flags {
+		if cl.userFlags[name] {
+			continue
+		}
+		if prev, ok := cl.cfgFlags[name]; ok && prev == val {
+			continue
+		}
+		if err := cl.setFlag(name, val); err != nil {
+			return nil, err
+		}
+		cl.cfgFlags[name] = val
+	}
+
+	for name := range cl.cfgFlags {
+		if _, ok := flags[name]; ok {
+			continue
+		}
+		if err := cl.setFlag(name, cl.defFlags[name]); err != nil {
+			return nil, err
+		}
+		delete(cl.cfgFlags, name)
+	}
+
+	return cfg, nil
+}
+
+// Sets the value of the given command-line flag. Slice flags (e.g. "dmi-template")
+// are replaced rather than appended to, as cli.StringSlice.Set() does.
+func (cl *configLoader) setFlag(name, val string) error {
+
+	if slice, ok := cl.ctx.GlobalGeneric(name).(*cli.StringSlice); ok {
+		*slice = cli.StringSlice{}
+		if val == "" {
+			return nil
+		}
+	}
+
+	return cl.ctx.GlobalSet(name, val)
+}
+
+// Loads the config file and applies its runtime settings. If the config file
+// is invalid, the current settings are left untouched.
+func (cl *configLoader) load() error {
+	cl.Lock()
+	defer cl.Unlock()
+
+	cfg, err := cl.loadFlags()
+	if err != nil {
+		return err
+	}
+
+	// Log level.
+	if err := setLogLevel(cl.ctx.GlobalString("log-level")); err != nil {
+		return err
+	}
+
+	// Slow-op threshold.
+	domain.SetSlowOpThreshold(
+		time.Duration(cl.ctx.GlobalInt("slow-op-ms")) * time.Millisecond)
+
+	// Fuse cache timeouts.
+	fuse.SetCacheTimeouts(
+		cfg.Fuse.DentryCacheTimeout,
+		cfg.Fuse.DynamicDentryCacheTimeout,
+		cfg.Fuse.AttrCacheTimeout)
+
+	// Fuse read-cache.
+	fuse.SetReadCache(cfg.Fuse.ReadCacheTTL, cfg.Fuse.ReadCachePaths)
+
+	// Fuse mmap-able nodes.
+	fuse.SetMmapPaths(cfg.Fuse.MmapPaths)
+
+	// Fuse mount options (picked up by the fuse-servers created from now on).
+	if err := fuse.SetMountOptions(
+		cl.ctx.GlobalInt("fuse-max-background"),
+		cl.ctx.GlobalInt("fuse-congestion-threshold")); err != nil {
+		return err
+	}
+
+	if cl.hds == nil {
+		return nil
+	}
+
+	// Handler policies. Handlers disabled by a previous config that are no
+	// longer disabled are re-enabled.
+	disabled := make(map[string]bool)
+	for path, policy := range cfg.Handlers {
+		if policy.Enabled == nil || *policy.Enabled {
+			continue
+		}
+		if err := cl.hds.DisableHandler(path); err != nil {
+			logrus.Warnf("Unable to disable handler %s: %v", path, err)
+			continue
+		}
+		disabled[path] = true
+	}
+	for path := range cl.disabled {
+		if disabled[path] {
+			continue
+		}
+		if err := cl.hds.EnableHandler(path); err != nil {
+			logrus.Warnf("Unable to enable handler %s: %v", path, err)
+		}
+	}
+	cl.disabled = disabled
+
+	// Resource policies, either daemon-wide or per container label.
+	var labeled []domain.LabeledResourcePolicies
+	for _, lr := range cfg.LabeledResources {
+		labeled = append(labeled, domain.LabeledResourcePolicies{
+			Labels:   lr.Labels,
+			Policies: resourcePolicies(lr.Resources),
+		})
+	}
+	cl.hds.SetResourcePolicies(resourcePolicies(cfg.Resources), labeled)
+
+	return nil
+}
+
+// Returns the resource policies defined by the given config file resources.
+func resourcePolicies(
+	resources map[string]config.ResourceConfig) map[string]domain.ResourcePolicy {
+
+	policies := make(map[string]domain.ResourcePolicy)
+
+	for path, res := range resources {
+		switch res.Policy {
+		case config.ResourcePolicyHidden:
+			policies[path] = domain.ResourcePolicyHide
+		case config.ResourcePolicyReadOnly:
+			policies[path] = domain.ResourcePolicyReadOnly
+		case config.ResourcePolicyPassthrough:
+			policies[path] = domain.ResourcePolicyPassthrough
+		default:
+			policies[path] = domain.ResourcePolicyExpose
+		}
+	}
+
+	return policies
+}
+
+//
+// Config reload goroutine. Reacts to SIGHUP signals by re-applying the settings
+// in the config file. Notice that fuse-servers are kept untouched throughout
+// this process.
+//
+func reloadHandler(cl *configLoader) {
+
+	var reloadChan = make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
+	for range reloadChan {
+		logrus.Infof("Reloading config file %s ...", cl.path)
+
+		if err := cl.load(); err != nil {
+			logrus.Errorf("Failed to reload config file: %v", err)
+			continue
+		}
+
+		logrus.Info("Config file reloaded")
+	}
+}
@@ -0,0 +1,118 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestConfigLoaderReload(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "sysbox-fs-config")
+	if err != nil {
+		t.Fatalf("unable to create test dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+
+	writeConfig := func(data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("unable to write config file: %v", err)
+		}
+	}
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "config"},
+		cli.StringFlag{Name: "log-level", Value: "info"},
+		cli.StringFlag{Name: "log-format", Value: "text"},
+		cli.IntFlag{Name: "slow-op-ms", Value: 0},
+		cli.StringSliceFlag{Name: "dmi-template"},
+	}
+
+	app.Action = func(ctx *cli.Context) error {
+
+		cl := newConfigLoader(ctx)
+
+		writeConfig(`
+log-level: debug
+log-format: json
+slow-op-ms: 50
+dmi-templates:
+  sys_vendor: Sysbox
+`)
+		if _, err := cl.loadFlags(); err != nil {
+			t.Fatalf("loadFlags() unexpected error: %v", err)
+		}
+
+		if val := ctx.GlobalString("log-level"); val != "debug" {
+			t.Errorf("log-level = %q; want %q", val, "debug")
+		}
+		if val := ctx.GlobalInt("slow-op-ms"); val != 50 {
+			t.Errorf("slow-op-ms = %d; want %d", val, 50)
+		}
+
+		// Flags set in the command-line take precedence.
+		if val := ctx.GlobalString("log-format"); val != "text" {
+			t.Errorf("log-format = %q; want %q", val, "text")
+		}
+
+		// Upon reload, removed (or zeroed) settings revert to their defaults,
+		// and slice flags are replaced.
+		writeConfig(`
+slow-op-ms: 0
+dmi-templates:
+  product_serial: SYSBOX-{id}
+`)
+		if _, err := cl.loadFlags(); err != nil {
+			t.Fatalf("loadFlags() unexpected error: %v", err)
+		}
+
+		if val := ctx.GlobalString("log-level"); val != "info" {
+			t.Errorf("log-level = %q; want %q", val, "info")
+		}
+		if val := ctx.GlobalInt("slow-op-ms"); val != 0 {
+			t.Errorf("slow-op-ms = %d; want %d", val, 0)
+		}
+		want := []string{"product_serial=SYSBOX-{id}"}
+		if val := ctx.GlobalStringSlice("dmi-template"); !reflect.DeepEqual(val, want) {
+			t.Errorf("dmi-template = %v; want %v", val, want)
+		}
+
+		writeConfig("")
+		if _, err := cl.loadFlags(); err != nil {
+			t.Fatalf("loadFlags() unexpected error: %v", err)
+		}
+
+		if val := ctx.GlobalStringSlice("dmi-template"); len(val) != 0 {
+			t.Errorf("dmi-template = %v; want none", val)
+		}
+
+		return nil
+	}
+
+	if err := app.Run([]string{"sysbox-fs", "--config", path, "--log-format", "text"}); err != nil {
+		t.Fatalf("app.Run() unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	libutils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// seccomp(2) operation reporting the sizes of the seccomp user-notification
+// structures; only available on kernels supporting these notifications.
+const seccompGetNotifSizes = 3
+
+// Probe of a kernel feature: returns whether the feature is supported, along
+// with the error that prevented it from being determined (if any).
+type kernelFeatureProbe struct {
+	feature  domain.KernelFeature
+	required bool
+	probe    func() (bool, error)
+}
+
+var kernelFeatureProbes = []kernelFeatureProbe{
+	{domain.KernelFeatureFuse, true, probeFuse},
+	{domain.KernelFeatureSeccompNotify, false, probeSeccompNotify},
+	{domain.KernelFeatureSeccompNotifyUnused, false, probeSeccompNotifyUnused},
+	{domain.KernelFeatureOpenat2, false, probeOpenat2},
+	{domain.KernelFeaturePidfd, false, probePidfd},
+	{domain.KernelFeatureProcessVmReadv, false, probeProcessVmReadv},
+	{domain.KernelFeatureIdmappedMounts, false, probeIdmappedMounts},
+}
+
+// Probes the kernel features sysbox-fs relies upon, and records the outcome for
+// the rest of sysbox-fs' subsystems to consult. Fails if any of the required
+// features is missing.
+func setupKernelFeatures() error {
+
+	var (
+		statuses []domain.KernelFeatureStatus
+		missing  []string
+	)
+
+	for _, p := range kernelFeatureProbes {
+		supported, err := p.probe()
+
+		s := domain.KernelFeatureStatus{
+			Feature:   p.feature,
+			Supported: supported,
+			Required:  p.required,
+		}
+		if err != nil {
+			s.Error = err.Error()
+		}
+
+		switch {
+		case supported:
+			logrus.Debugf("Kernel feature %s supported", p.feature)
+
+		case p.required:
+			missing = append(missing, string(p.feature))
+
+		default:
+			s.Fallback = domain.KernelFeatureFallbacks[p.feature]
+			if err != nil {
+				logrus.Warnf("Unable to probe kernel feature %s (%v): %s",
+					p.feature, err, s.Fallback)
+			} else {
+				logrus.Infof("Kernel feature %s not supported: %s",
+					p.feature, s.Fallback)
+			}
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	domain.SetKernelFeatures(statuses)
+
+	if len(missing) > 0 {
+		return fmt.Errorf("required kernel features not supported: %s",
+			strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// FUSE requires both the file-system to be registered (i.e., fuse module
+// loaded) and its device to be present.
+func probeFuse() (bool, error) {
+
+	f, err := os.Open("/proc/filesystems")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	registered := false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[len(fields)-1] == "fuse" {
+			registered = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	if !registered {
+		return false, nil
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat("/dev/fuse", &st); err != nil {
+		if err == unix.ENOENT {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return st.Mode&unix.S_IFMT == unix.S_IFCHR, nil
+}
+
+func probeSeccompNotify() (bool, error) {
+
+	var sizes struct {
+		notif, resp, data uint16
+	}
+
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompGetNotifSizes, 0,
+		uintptr(unsafe.Pointer(&sizes)))
+
+	switch errno {
+	case 0:
+		return true, nil
+	case unix.EINVAL, unix.ENOSYS:
+		return false, nil
+	}
+
+	return false, errno
+}
+
+// There's no way to probe for unused-filter notifications short of installing
+// a seccomp filter, so these are inferred out of the kernel version.
+func probeSeccompNotifyUnused() (bool, error) {
+
+	cmp, err := libutils.KernelCurrentVersionCmp(5, 8)
+	if err != nil {
+		return false, err
+	}
+
+	return cmp >= 0, nil
+}
+
+func probeOpenat2() (bool, error) {
+
+	fd, err := unix.Openat2(unix.AT_FDCWD, "/", &unix.OpenHow{
+		Flags: unix.O_PATH | unix.O_CLOEXEC,
+	})
+	if err == unix.ENOSYS {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	unix.Close(fd)
+
+	return true, nil
+}
+
+func probePidfd() (bool, error) {
+
+	fd, err := unix.PidfdOpen(os.Getpid(), 0)
+	if err == unix.ENOSYS {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	unix.Close(fd)
+
+	return true, nil
+}
+
+func probeProcessVmReadv() (bool, error) {
+
+	_, err := unix.ProcessVMReadv(os.Getpid(), nil, nil, 0)
+	if err == unix.ENOSYS {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// mount_setattr() with an invalid fd fails with EBADF (or EINVAL) where
+// supported.
+func probeIdmappedMounts() (bool, error) {
+
+	err := unix.MountSetattr(-1, "", unix.AT_EMPTY_PATH, &unix.MountAttr{})
+	if err == unix.ENOSYS {
+		return false, nil
+	}
+
+	return true, nil
+}
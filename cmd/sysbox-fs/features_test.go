@@ -0,0 +1,66 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+func TestSetupKernelFeatures(t *testing.T) {
+
+	saved := kernelFeatureProbes
+	defer func() {
+		kernelFeatureProbes = saved
+		domain.SetKernelFeatures(nil)
+	}()
+
+	probe := func(supported bool, err error) func() (bool, error) {
+		return func() (bool, error) { return supported, err }
+	}
+
+	kernelFeatureProbes = []kernelFeatureProbe{
+		{domain.KernelFeatureFuse, true, probe(true, nil)},
+		{domain.KernelFeaturePidfd, false, probe(false, nil)},
+		{domain.KernelFeatureOpenat2, false, probe(false, errors.New("EPERM"))},
+	}
+
+	if err := setupKernelFeatures(); err != nil {
+		t.Fatalf("setupKernelFeatures() failed: %v", err)
+	}
+
+	for _, s := range domain.KernelFeatures() {
+		if s.Supported != (s.Feature == domain.KernelFeatureFuse) {
+			t.Errorf("unexpected status %+v", s)
+		}
+		if !s.Supported && s.Fallback == "" {
+			t.Errorf("no fallback reported for %s", s.Feature)
+		}
+	}
+	if domain.KernelFeatureSupported(domain.KernelFeaturePidfd) {
+		t.Errorf("%s reported as supported", domain.KernelFeaturePidfd)
+	}
+
+	// Missing required features are fatal.
+	kernelFeatureProbes[0].probe = probe(false, nil)
+
+	if err := setupKernelFeatures(); err == nil {
+		t.Errorf("setupKernelFeatures() unexpectedly succeeded")
+	}
+}
@@ -0,0 +1,217 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	grpc "github.com/nestybox/sysbox-ipc/sysboxFsGrpc"
+	"github.com/urfave/cli"
+)
+
+//
+// OCI hook mode. Allows sys containers created by runtimes other than
+// sysbox-runc to be registered with sysbox-fs, by configuring 'sysbox-fs
+// register-hook' as the container's createRuntime and poststop hooks:
+//
+// * createRuntime: the container is (pre)registered once its namespaces have
+//   been created, based on the container's state and bundle.
+//
+// * poststop: the container is unregistered.
+//
+// The container is expected to be user-namespaced. Notice that, unlike
+// sysbox-runc, the hook doesn't expose the emulated resources (i.e., the
+// contents of the FUSE mountpoint under '<mountpoint>/<container-id>') within
+// the container; that's left to the runtime / container spec.
+//
+
+var registerHookCommand = cli.Command{
+	Name:  "register-hook",
+	Usage: "OCI createRuntime/poststop hook that registers/unregisters the container with sysbox-fs (container state is read from stdin)",
+	Action: func(c *cli.Context) error {
+		state, err := readHookState(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		switch state.Status {
+		case "creating", "created":
+			return hookRegister(state)
+		case "stopped":
+			return hookUnregister(state)
+		}
+
+		return fmt.Errorf("unexpected container status '%s' (register-hook must be set as a createRuntime or poststop hook)",
+			state.Status)
+	},
+}
+
+// OCI container state passed to the hooks through stdin (see the runtime-spec).
+type hookState struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Pid    int    `json:"pid,omitempty"`
+	Bundle string `json:"bundle"`
+}
+
+// Subset of the container's OCI spec (config.json) of interest to the hook.
+type hookSpec struct {
+	Linux *struct {
+		MaskedPaths   []string `json:"maskedPaths,omitempty"`
+		ReadonlyPaths []string `json:"readonlyPaths,omitempty"`
+	} `json:"linux,omitempty"`
+}
+
+func readHookState(r io.Reader) (*hookState, error) {
+
+	var state hookState
+
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode container state: %v", err)
+	}
+	if state.ID == "" {
+		return nil, fmt.Errorf("container state lacks the container id")
+	}
+
+	return &state, nil
+}
+
+func hookRegister(state *hookState) error {
+
+	if state.Pid <= 0 {
+		return fmt.Errorf("container %s state lacks the init pid", state.ID)
+	}
+
+	data, err := hookContainerData(state)
+	if err != nil {
+		return err
+	}
+
+	if err := grpc.SendContainerPreRegistration(data); err != nil {
+		return fmt.Errorf("failed to pre-register container %s: %v", state.ID, err)
+	}
+
+	if err := grpc.SendContainerRegistration(data); err != nil {
+		// Undo the pre-registration.
+		grpc.SendContainerUnregistration(data)
+		return fmt.Errorf("failed to register container %s: %v", state.ID, err)
+	}
+
+	return nil
+}
+
+func hookUnregister(state *hookState) error {
+
+	data := &grpc.ContainerData{Id: state.ID}
+
+	if err := grpc.SendContainerUnregistration(data); err != nil {
+		return fmt.Errorf("failed to unregister container %s: %v", state.ID, err)
+	}
+
+	return nil
+}
+
+// Builds the registration data of the container out of its state, bundle and
+// (host) procfs entries.
+func hookContainerData(state *hookState) (*grpc.ContainerData, error) {
+
+	var spec hookSpec
+
+	b, err := ioutil.ReadFile(filepath.Join(state.Bundle, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, fmt.Errorf("failed to decode container %s spec: %v", state.ID, err)
+	}
+
+	uidFirst, uidSize, err := readHookIdMap(fmt.Sprintf("/proc/%d/uid_map", state.Pid))
+	if err != nil {
+		return nil, err
+	}
+	gidFirst, gidSize, err := readHookIdMap(fmt.Sprintf("/proc/%d/gid_map", state.Pid))
+	if err != nil {
+		return nil, err
+	}
+
+	data := &grpc.ContainerData{
+		Id:       state.ID,
+		Netns:    fmt.Sprintf("/proc/%d/ns/net", state.Pid),
+		InitPid:  int32(state.Pid),
+		Ctime:    time.Now(),
+		UidFirst: int32(uidFirst),
+		UidSize:  int32(uidSize),
+		GidFirst: int32(gidFirst),
+		GidSize:  int32(gidSize),
+	}
+
+	if spec.Linux != nil {
+		data.ProcRoPaths = spec.Linux.ReadonlyPaths
+		data.ProcMaskPaths = spec.Linux.MaskedPaths
+	}
+
+	return data, nil
+}
+
+// Returns the host id (and size) of the range that maps the container's root
+// user / group, as per the given uid_map / gid_map file.
+func readHookIdMap(path string) (uint32, uint32, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "0" {
+			continue
+		}
+
+		first, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid id mapping in %s: %v", path, err)
+		}
+		size, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid id mapping in %s: %v", path, err)
+		}
+
+		// The identity mapping of the initial user-ns.
+		if first == 0 && size == 4294967295 {
+			return 0, 0, fmt.Errorf("container is not user-namespaced (%s)", path)
+		}
+
+		return uint32(first), uint32(size), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, fmt.Errorf("no mapping for the root id in %s", path)
+}
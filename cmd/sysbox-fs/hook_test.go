@@ -0,0 +1,81 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadHookState(t *testing.T) {
+
+	state, err := readHookState(strings.NewReader(
+		`{"ociVersion":"1.0.2","id":"c1","status":"creating","pid":42,"bundle":"/b"}`))
+	if err != nil {
+		t.Fatalf("readHookState() failed: %v", err)
+	}
+	if state.ID != "c1" || state.Status != "creating" || state.Pid != 42 {
+		t.Errorf("readHookState() = %+v", *state)
+	}
+
+	if _, err := readHookState(strings.NewReader(`{"status":"stopped"}`)); err == nil {
+		t.Errorf("readHookState() expected to fail on missing id")
+	}
+}
+
+func TestReadHookIdMap(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		name    string
+		idMap   string
+		first   uint32
+		size    uint32
+		wantErr bool
+	}{
+		{"userns", "         0     165536      65536\n", 165536, 65536, false},
+		{"multiple", "1000 1000 1\n0 231072 1000\n", 231072, 1000, false},
+		{"no-userns", "         0          0 4294967295\n", 0, 0, true},
+		{"no-root", "1 100000 65535\n", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := ioutil.WriteFile(path, []byte(tt.idMap), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			first, size, err := readHookIdMap(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readHookIdMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if first != tt.first || size != tt.size {
+				t.Errorf("readHookIdMap() = (%d, %d), want (%d, %d)",
+					first, size, tt.first, tt.size)
+			}
+		})
+	}
+}
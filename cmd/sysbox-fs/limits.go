@@ -0,0 +1,178 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+const (
+	// Interval at which sysbox-fs' resource usage is checked against its limits.
+	limitsCheckInterval = time.Second
+
+	// Fraction of the max-fds limit beyond which sysbox-fs is considered to be
+	// under resource pressure (i.e., before fd allocations start to fail).
+	fdsPressureRatio = 0.9
+)
+
+//
+// resourceLimits tracks sysbox-fs' own resource usage (goroutines, open fds
+// and memory) against its self-imposed limits. While any of these is beyond
+// its limit, sysbox-fs is flagged as being under resource pressure (see
+// domain.ResourcePressure()), which holds back the intake of new FUSE requests
+// from the busiest containers. Zero values stand for unlimited resources.
+//
+type resourceLimits struct {
+	maxGoroutines int
+	maxFds        uint64
+	maxMemory     uint64 // in bytes
+}
+
+// Applies sysbox-fs' self-imposed resource limits, and launches the monitor
+// enforcing them (if needed).
+func setupResourceLimits(maxGoroutines, maxFds, maxNSenterProcs, maxMemoryMB int) error {
+
+	if maxGoroutines < 0 || maxFds < 0 || maxNSenterProcs < 0 || maxMemoryMB < 0 {
+		return fmt.Errorf("invalid resource limits: goroutines %d, fds %d, nsenter %d, memory %d MB",
+			maxGoroutines, maxFds, maxNSenterProcs, maxMemoryMB)
+	}
+
+	domain.SetMaxNSenterProcs(maxNSenterProcs)
+
+	// The fd limit is also enforced by the kernel, so that a leak can't exhaust
+	// the host's file table. Only the soft limit is lowered, so that the limit
+	// can be raised again if needed.
+	if maxFds > 0 {
+		var rlim unix.Rlimit
+		if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlim); err != nil {
+			return err
+		}
+		if uint64(maxFds) > rlim.Max {
+			return fmt.Errorf("max-fds %d exceeds the hard limit (%d)", maxFds, rlim.Max)
+		}
+		rlim.Cur = uint64(maxFds)
+		if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &rlim); err != nil {
+			return err
+		}
+	}
+
+	lm := &resourceLimits{
+		maxGoroutines: maxGoroutines,
+		maxFds:        uint64(maxFds),
+		maxMemory:     uint64(maxMemoryMB) << 20,
+	}
+
+	if lm.maxGoroutines == 0 && lm.maxFds == 0 && lm.maxMemory == 0 {
+		return nil
+	}
+
+	go lm.monitor()
+
+	return nil
+}
+
+// Periodically checks sysbox-fs' resource usage, and updates the resource
+// pressure state accordingly.
+func (lm *resourceLimits) monitor() {
+
+	var pressure bool
+
+	ticker := time.NewTicker(limitsCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reason, memory := lm.check()
+
+		if (reason != "") == pressure {
+			continue
+		}
+		pressure = !pressure
+
+		if pressure {
+			logrus.Warnf("Resource pressure (%s): throttling FUSE requests", reason)
+
+			// Return freed memory to the OS right away.
+			if memory {
+				debug.FreeOSMemory()
+			}
+		} else {
+			logrus.Info("Resource pressure relieved")
+		}
+
+		domain.SetResourcePressure(pressure)
+	}
+}
+
+// Checks sysbox-fs' resource usage against its limits. Returns the reason of
+// the resource pressure (empty if none), and whether memory is the cause.
+func (lm *resourceLimits) check() (string, bool) {
+
+	if lm.maxGoroutines > 0 {
+		if n := runtime.NumGoroutine(); n > lm.maxGoroutines {
+			return fmt.Sprintf("%d goroutines, limit %d", n, lm.maxGoroutines), false
+		}
+	}
+
+	if lm.maxFds > 0 {
+		n, err := openFds()
+		if err != nil {
+			logrus.Debugf("Unable to count open fds: %v", err)
+		} else if float64(n) > float64(lm.maxFds)*fdsPressureRatio {
+			return fmt.Sprintf("%d open fds, limit %d", n, lm.maxFds), false
+		}
+	}
+
+	if lm.maxMemory > 0 {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+
+		// Memory obtained from the OS and not yet returned to it.
+		if inUse := ms.Sys - ms.HeapReleased; inUse > lm.maxMemory {
+			return fmt.Sprintf("%d MB of memory, limit %d MB",
+				inUse>>20, lm.maxMemory>>20), true
+		}
+	}
+
+	return "", false
+}
+
+// Returns the number of fds opened by sysbox-fs.
+func openFds() (uint64, error) {
+
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+
+	// Discount the fd of the directory being read.
+	return uint64(len(names) - 1), nil
+}
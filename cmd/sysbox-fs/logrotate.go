@@ -0,0 +1,225 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Suffix format appended to rotated log files (e.g. sysbox-fs.log.20200512-103015).
+	logBackupTimeFormat = "20060102-150405"
+)
+
+//
+// logRotator is an io.Writer that backs sysbox-fs' log file. Given that
+// sysbox-fs is a long-running daemon, the log file is rotated once it reaches
+// the configured size, and rotated copies are pruned based on their age and
+// count. Notice that the log file is also reopened on demand (i.e. SIGUSR1)
+// to play nicely with external tools such as logrotate, which would otherwise
+// end up fighting with our O_APPEND file handle.
+//
+type logRotator struct {
+	sync.Mutex
+	path       string        // log file path
+	maxSize    int64         // max size (in bytes) before rotating; 0 == unlimited
+	maxAge     time.Duration // max age of rotated files; 0 == unlimited
+	maxBackups int           // max number of rotated files; 0 == unlimited
+	file       *os.File      // currently open log file
+	size       int64         // current size of the log file
+}
+
+func newLogRotator(
+	path string,
+	maxSize int64,
+	maxAge time.Duration,
+	maxBackups int) (*logRotator, error) {
+
+	if maxSize < 0 || maxAge < 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("invalid log rotation settings: size %d, age %v, backups %d",
+			maxSize, maxAge, maxBackups)
+	}
+
+	lr := &logRotator{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+
+	if err := lr.open(); err != nil {
+		return nil, err
+	}
+
+	return lr, nil
+}
+
+func (lr *logRotator) Write(p []byte) (int, error) {
+	lr.Lock()
+	defer lr.Unlock()
+
+	if lr.file == nil {
+		if err := lr.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if lr.maxSize > 0 && lr.size > 0 && lr.size+int64(len(p)) > lr.maxSize {
+		if err := lr.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := lr.file.Write(p)
+	lr.size += int64(n)
+
+	return n, err
+}
+
+// Reopen closes the current log file and opens it again. Utilized to react to
+// external log rotation events (the file may have been renamed underneath us).
+func (lr *logRotator) Reopen() error {
+	lr.Lock()
+	defer lr.Unlock()
+
+	if lr.file != nil {
+		lr.file.Close()
+		lr.file = nil
+	}
+
+	return lr.open()
+}
+
+func (lr *logRotator) Close() error {
+	lr.Lock()
+	defer lr.Unlock()
+
+	if lr.file == nil {
+		return nil
+	}
+
+	err := lr.file.Close()
+	lr.file = nil
+
+	return err
+}
+
+// Opens (or creates) the log file. Caller must hold the lock.
+func (lr *logRotator) open() error {
+
+	f, err := os.OpenFile(
+		lr.path,
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_SYNC,
+		0666,
+	)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	lr.file = f
+	lr.size = info.Size()
+
+	return nil
+}
+
+// Renames the current log file and opens a new one in its place. Caller must
+// hold the lock.
+func (lr *logRotator) rotate() error {
+
+	if lr.file != nil {
+		lr.file.Close()
+		lr.file = nil
+	}
+
+	backup := lr.backupName(time.Now())
+	if err := os.Rename(lr.path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := lr.open(); err != nil {
+		return err
+	}
+
+	lr.prune()
+
+	return nil
+}
+
+// Returns a backup name not currently in use for the given time.
+func (lr *logRotator) backupName(t time.Time) string {
+
+	name := lr.path + "." + t.Format(logBackupTimeFormat)
+
+	candidate := name
+	for i := 1; ; i++ {
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s.%d", name, i)
+	}
+}
+
+// Eliminates rotated files exceeding the configured age / count limits.
+func (lr *logRotator) prune() {
+
+	if lr.maxAge == 0 && lr.maxBackups == 0 {
+		return
+	}
+
+	dir := filepath.Dir(lr.path)
+	prefix := filepath.Base(lr.path) + "."
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var backups []os.FileInfo
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		backups = append(backups, e)
+	}
+
+	// Newest backups first.
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ModTime().After(backups[j].ModTime())
+	})
+
+	cutoff := time.Now().Add(-lr.maxAge)
+
+	for i, b := range backups {
+		if (lr.maxBackups > 0 && i >= lr.maxBackups) ||
+			(lr.maxAge > 0 && b.ModTime().Before(cutoff)) {
+			os.Remove(filepath.Join(dir, b.Name()))
+		}
+	}
+}
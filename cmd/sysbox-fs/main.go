@@ -24,12 +24,15 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/nestybox/sysbox-fs/config"
 	"github.com/nestybox/sysbox-fs/domain"
 	"github.com/nestybox/sysbox-fs/fuse"
 	"github.com/nestybox/sysbox-fs/handler"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
 	"github.com/nestybox/sysbox-fs/ipc"
 	"github.com/nestybox/sysbox-fs/mount"
 	"github.com/nestybox/sysbox-fs/nsenter"
@@ -49,6 +52,7 @@ import (
 const (
 	sysboxRunDir    string = "/run/sysbox"
 	sysboxFsPidFile string = sysboxRunDir + "/sysfs.pid"
+	sysboxFsInodes  string = sysboxRunDir + "/sysfs-inodes"
 	usage           string = `sysbox-fs file-system
 
 sysbox-fs is a daemon that emulates portions of the system container's
@@ -73,6 +77,8 @@ var (
 func exitHandler(
 	signalChan chan os.Signal,
 	fss domain.FuseServerServiceIface,
+	nss domain.NSenterServiceIface,
+	shutdownTimeout time.Duration,
 	profile interface{ Stop() }) {
 
 	var printStack = false
@@ -107,7 +113,20 @@ func exitHandler(
 		logrus.Warnf("\n\n%s\n", string(stacktrace[:length]))
 	}
 
-	// Destroy fuse-service and inner fuse-servers.
+	// Stop accepting new FUSE requests and wait for the in-flight ones to
+	// complete (or for the shutdown deadline to expire).
+	if err := fss.DrainFuseService(shutdownTimeout); err != nil {
+		logrus.Warnf("Shutdown deadline expired: %v", err)
+	}
+
+	// Cancel the nsenter requests still in progress (if any), which unblocks
+	// the FUSE operations that could not be drained above.
+	if n := nss.TerminateAllRequests(); n > 0 {
+		logrus.Warnf("Terminated %d in-flight nsenter processes", n)
+	}
+
+	// Destroy fuse-service and inner fuse-servers. Notice that fuse-servers
+	// are unmounted only after their main-loops have exited.
 	fss.DestroyFuseService()
 
 	// Stop cpu/mem profiling tasks.
@@ -115,9 +134,6 @@ func exitHandler(
 		profile.Stop()
 	}
 
-	// Deferring exit() to allow FUSE to dump unnmount() logs
-	time.Sleep(2)
-
 	// Delete pid file.
 	if err := libutils.DestroyPidFile(sysboxFsPidFile); err != nil {
 		logrus.Warnf("failed to destroy sysbox-fs pid file: %v", err)
@@ -127,6 +143,95 @@ func exitHandler(
 	os.Exit(0)
 }
 
+//
+// Log-file reopen goroutine. Reacts to SIGUSR1 signals by reopening the log
+// file, which is typically required by external log-rotation tools.
+//
+func logReopenHandler(lr *logRotator) {
+
+	var reopenChan = make(chan os.Signal, 1)
+	signal.Notify(reopenChan, syscall.SIGUSR1)
+
+	for range reopenChan {
+		if err := lr.Reopen(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to reopen sysbox-fs log file: %v\n", err)
+			continue
+		}
+		logrus.Info("Log file reopened")
+	}
+}
+
+// Sets sysbox-fs log-level. Defaults to 'info' if no level is provided.
+func setLogLevel(logLevel string) error {
+
+	switch logLevel {
+	case "debug":
+		// Following instruction is to have Bazil's fuze-lib logs being
+		// included into sysbox-fs' log stream.
+		flag.Set("fuse.debug", "true")
+		logrus.SetLevel(logrus.DebugLevel)
+	case "info", "":
+		flag.Set("fuse.debug", "false")
+		logrus.SetLevel(logrus.InfoLevel)
+	case "warning":
+		flag.Set("fuse.debug", "false")
+		logrus.SetLevel(logrus.WarnLevel)
+	case "error":
+		flag.Set("fuse.debug", "false")
+		logrus.SetLevel(logrus.ErrorLevel)
+	case "fatal":
+		flag.Set("fuse.debug", "false")
+		logrus.SetLevel(logrus.FatalLevel)
+	default:
+		return fmt.Errorf("log-level option '%v' not recognized", logLevel)
+	}
+
+	return nil
+}
+
+// Parses the DMI field templates specified through the "dmi-template" flag.
+// Each entry holds one or more comma-separated "<field>=<template>" pairs.
+func parseDmiTemplates(specs []string) (map[string]string, error) {
+
+	templates := make(map[string]string)
+
+	for _, spec := range specs {
+		for _, entry := range strings.Split(spec, ",") {
+			if entry == "" {
+				continue
+			}
+
+			kv := strings.SplitN(entry, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid dmi template '%s': expected <field>=<template>",
+					entry)
+			}
+
+			templates[kv[0]] = kv[1]
+		}
+	}
+
+	return templates, nil
+}
+
+// Determines whether sysbox-fs operates in rootless mode, as per the value of
+// the "rootless" flag. Rootless mode is opt-in: it's only enabled if explicitly
+// requested, or if auto-detection is requested and sysbox-fs lacks host root
+// privileges.
+func rootlessMode(val string) (bool, error) {
+
+	switch val {
+	case "true":
+		return true, nil
+	case "false", "":
+		return false, nil
+	case "auto":
+		return os.Geteuid() != 0 || domain.RunningInUserNs(), nil
+	}
+
+	return false, fmt.Errorf("invalid rootless value '%s': expected true, false or auto", val)
+}
+
 // Run cpu / memory profiling collection.
 func runProfiler(ctx *cli.Context) (interface{ Stop() }, error) {
 
@@ -186,6 +291,11 @@ func main() {
 	app.Version = version
 
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "config",
+			Value: config.DefaultConfigPath,
+			Usage: "config file path; command-line flags take precedence over config file settings",
+		},
 		cli.StringFlag{
 			Name:  "mountpoint",
 			Value: "/var/lib/sysboxfs",
@@ -204,11 +314,36 @@ func main() {
 			Value: "proc-exit",
 			Usage: "Policy to close syscall interception handles; allowed values are \"proc-exit\" and \"cont-exit\" (default = \"proc-exit\")",
 		},
+		cli.StringFlag{
+			Name:  "submount-unmounts",
+			Value: "ignore",
+			Usage: "Policy for unmounts of sysbox-fs managed submounts (e.g., /proc/sys) within sys containers; allowed values are \"ignore\" (reported as successful while the submounts are kept in place) and \"deny\" (failed with EBUSY) (default = \"ignore\")",
+		},
+		cli.StringFlag{
+			Name:  "emulated-files-owner",
+			Value: "root",
+			Usage: "owner of the emulated procfs / sysfs files within sys containers; allowed values are \"root\" (container's root user) and \"nobody\" (default = \"root\")",
+		},
 		cli.StringFlag{
 			Name:  "log",
 			Value: "",
 			Usage: "log file path or empty string for stderr output (default: \"\")",
 		},
+		cli.IntFlag{
+			Name:  "log-max-size",
+			Value: 0,
+			Usage: "max size (in MB) of the log file before it gets rotated; 0 to disable rotation (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "log-max-age",
+			Value: 0,
+			Usage: "max number of days to retain rotated log files; 0 to retain them indefinitely (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "log-max-backups",
+			Value: 0,
+			Usage: "max number of rotated log files to retain; 0 to retain all of them (default: 0)",
+		},
 		cli.StringFlag{
 			Name:  "log-level",
 			Value: "info",
@@ -219,6 +354,98 @@ func main() {
 			Value: "text",
 			Usage: "log format; must be json or text",
 		},
+		cli.IntFlag{
+			Name:  "slow-op-ms",
+			Value: 0,
+			Usage: "log a warning for FUSE, seccomp and nsenter operations exceeding this duration (in milliseconds); 0 to disable (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "shutdown-timeout",
+			Value: 10,
+			Usage: "time (in seconds) to wait for in-flight operations to complete upon sysbox-fs shutdown",
+		},
+		cli.IntFlag{
+			Name:  "max-goroutines",
+			Value: 0,
+			Usage: "number of sysbox-fs goroutines beyond which FUSE requests are throttled; 0 for unlimited (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "max-fds",
+			Value: 0,
+			Usage: "max number of fds opened by sysbox-fs; FUSE requests are throttled when approaching it; 0 for unlimited (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "max-nsenter-procs",
+			Value: 0,
+			Usage: "max number of concurrent nsenter requests (child processes); 0 for unlimited (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "max-memory",
+			Value: 0,
+			Usage: "memory usage (in MB) beyond which FUSE requests are throttled; 0 for unlimited (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "max-cntr-handles",
+			Value: 0,
+			Usage: "max number of files each sys container may keep open on sysbox-fs' nodes; opens beyond it fail with EMFILE; 0 for unlimited (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "userns-limits-share",
+			Value: 100,
+			Usage: "share (percentage) of the host's user-namespace limits (/proc/sys/user) granted to each sys container (default: 100)",
+		},
+		cli.StringFlag{
+			Name:  "write-rate-limit",
+			Value: "",
+			Usage: "rate limit (\"<rate>[:<burst>]\", in operations per second) of the writes to emulated resources and trapped mount / chown syscalls of each sys container; overridable through the io.sysbox.fs.write-rate-limit annotation; empty or 0 for unlimited (default: unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "kmsg-source",
+			Value: "empty",
+			Usage: "source of the kernel messages (/proc/kmsg, /dev/kmsg) exposed within sys containers; allowed values are \"empty\", \"synthetic\" (container lifecycle messages) and \"host\" (host messages logged since the container's creation) (default = \"empty\")",
+		},
+		cli.IntFlag{
+			Name:  "fuse-max-background",
+			Value: 0,
+			Usage: "max number of pending FUSE background requests (e.g., readahead) per sys container; 0 for the kernel's default (default: 0)",
+		},
+		cli.IntFlag{
+			Name:  "fuse-congestion-threshold",
+			Value: 0,
+			Usage: "number of pending FUSE background requests beyond which the kernel deems a sys container's FUSE connection congested; 0 for the kernel's default (default: 0)",
+		},
+		cli.StringSliceFlag{
+			Name:  "dmi-template",
+			Usage: "template of a DMI field (/sys/class/dmi/id) exposed within sys containers, as '<field>=<template>', where \"{id}\" stands for the container ID and \"{host}\" for the host's value; can be repeated",
+		},
+		cli.StringFlag{
+			Name:  "rootless",
+			Value: "false",
+			Usage: "run as a non-root user within a user namespace (e.g., along with a rootless container runtime); allowed values are \"true\", \"false\" and \"auto\" (enabled when lacking host root privileges) (default = \"false\")",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "diagnostic mode: disable emulation by passing all procfs / sysfs operations and trapped syscalls through to the kernel, and log the handlers / syscalls that would have been emulated",
+		},
+		cli.StringFlag{
+			Name:  "health-addr",
+			Value: "",
+			Usage: "tcp address ('<host>:<port>') on which the health endpoints (/healthz, /readyz) are served, e.g. for kubelet probes; empty to serve them only over the debug socket (default: \"\")",
+		},
+		cli.StringFlag{
+			Name:  "containerd-socket",
+			Value: "",
+			Usage: "containerd socket whose events are cross-checked against sys container registrations (e.g., to flag containers gone without being unregistered, and to display their names and images in the logs); empty to disable (default: \"\")",
+		},
+		cli.BoolFlag{
+			Name:  "containerd-cleanup",
+			Usage: "unregister the sys containers found gone (see containerd-socket) instead of just flagging them (default: \"false\")",
+		},
+		cli.StringFlag{
+			Name:  "security-audit-log",
+			Value: "",
+			Usage: "file to which security events (e.g., denied sysctl writes, unmounts of managed mounts, repeated permission failures) are appended as JSON lines, for host IDS tooling to consume; these are also streamed over the debug socket (/security/events) (default: \"\")",
+		},
 		cli.BoolFlag{
 			Name:   "ignore-handler-errors",
 			Usage:  "ignore errors during procfs / sysfs node interactions (testing purposes)",
@@ -247,7 +474,8 @@ func main() {
 			edition, c.App.Version, commitId, builtAt, builtBy)
 	}
 
-	// Nsenter command to allow 'rexec' functionality.
+	// Nsenter command to allow 'rexec' functionality, and registration command
+	// for OCI hook mode.
 	app.Commands = []cli.Command{
 		{
 			Name:  "nsenter",
@@ -258,20 +486,36 @@ func main() {
 				return nil
 			},
 		},
+		registerHookCommand,
 	}
 
+	var cfgLoader *configLoader
+
 	// Define 'debug' and 'log' settings.
 	app.Before = func(ctx *cli.Context) error {
 
 		// Random generator seed
 		rand.Seed(time.Now().UnixNano())
 
-		// Create/set the log-file destination.
-		if path := ctx.GlobalString("log"); path != "" {
-			f, err := os.OpenFile(
+		// Load the config file settings. Notice that nsenter child processes
+		// skip this step as they are not expected to honor these ones.
+		if len(os.Args) < 2 || os.Args[1] != "nsenter" {
+			cfgLoader = newConfigLoader(ctx)
+			if _, err := cfgLoader.loadFlags(); err != nil {
+				logrus.Fatalf("Error loading config file: %v. Exiting ...", err)
+				return err
+			}
+		}
+
+		// Create/set the log-file destination. Hooks log to stderr, which is
+		// collected by the runtime invoking them.
+		hook := len(os.Args) >= 2 && os.Args[1] == registerHookCommand.Name
+		if path := ctx.GlobalString("log"); path != "" && !hook {
+			f, err := newLogRotator(
 				path,
-				os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_SYNC,
-				0666,
+				int64(ctx.GlobalInt("log-max-size"))*1024*1024,
+				time.Duration(ctx.GlobalInt("log-max-age"))*24*time.Hour,
+				ctx.GlobalInt("log-max-backups"),
 			)
 			if err != nil {
 				logrus.Fatalf(
@@ -283,6 +527,10 @@ func main() {
 
 			logrus.SetOutput(f)
 			log.SetOutput(f)
+
+			// Reopen the log file upon SIGUSR1 arrival (e.g. external
+			// logrotate).
+			go logReopenHandler(f)
 		} else {
 			logrus.SetOutput(os.Stderr)
 			log.SetOutput(os.Stderr)
@@ -300,30 +548,8 @@ func main() {
 		}
 
 		// Set desired log-level.
-		if logLevel := ctx.GlobalString("log-level"); logLevel != "" {
-			switch logLevel {
-			case "debug":
-				// Following instruction is to have Bazil's fuze-lib logs being
-				// included into sysbox-fs' log stream.
-				flag.Set("fuse.debug", "true")
-				logrus.SetLevel(logrus.DebugLevel)
-			case "info":
-				logrus.SetLevel(logrus.InfoLevel)
-			case "warning":
-				logrus.SetLevel(logrus.WarnLevel)
-			case "error":
-				logrus.SetLevel(logrus.ErrorLevel)
-			case "fatal":
-				logrus.SetLevel(logrus.FatalLevel)
-			default:
-				logrus.Fatalf(
-					"log-level option '%v' not recognized. Exiting ...",
-					logLevel,
-				)
-			}
-		} else {
-			// Set 'info' as our default log-level.
-			logrus.SetLevel(logrus.InfoLevel)
+		if err := setLogLevel(ctx.GlobalString("log-level")); err != nil {
+			logrus.Fatalf("%v. Exiting ...", err)
 		}
 
 		return nil
@@ -353,7 +579,86 @@ func main() {
 		if ctx.GlobalString("seccomp-fd-release") == "cont-exit" {
 			logrus.Info("Seccomp-notify fd release policy set to container exit")
 		}
+		if ctx.GlobalString("submount-unmounts") == "deny" {
+			logrus.Info("Unmounts of sysbox-fs managed submounts set to be denied")
+		}
+		if err := fuse.SetFilesOwner(ctx.GlobalString("emulated-files-owner")); err != nil {
+			return err
+		}
+		if ctx.GlobalString("emulated-files-owner") == fuse.FilesOwnerNobody {
+			logrus.Info("Emulated files owner set to nobody")
+		}
 		logrus.Infof("FUSE dir = %s", ctx.GlobalString("mountpoint"))
+		if ctx.GlobalBool("dry-run") {
+			logrus.Warn("Initializing in dry-run mode: procfs / sysfs and syscall emulation is disabled")
+		}
+
+		rootless, err := rootlessMode(ctx.GlobalString("rootless"))
+		if err != nil {
+			return err
+		}
+		if rootless {
+			if err := fuse.CheckRootlessMount(); err != nil {
+				return fmt.Errorf("unable to operate in rootless mode: %v", err)
+			}
+			domain.SetRootless(true)
+			logrus.Info("Initializing in rootless mode")
+		}
+		// Probe the kernel features sysbox-fs relies upon.
+		if err := setupKernelFeatures(); err != nil {
+			return err
+		}
+
+		if slowOpMs := ctx.GlobalInt("slow-op-ms"); slowOpMs > 0 {
+			logrus.Infof("Slow-operation logging threshold set to %v ms", slowOpMs)
+		}
+
+		// Apply sysbox-fs' self-imposed resource limits.
+		if err := setupResourceLimits(
+			ctx.GlobalInt("max-goroutines"),
+			ctx.GlobalInt("max-fds"),
+			ctx.GlobalInt("max-nsenter-procs"),
+			ctx.GlobalInt("max-memory")); err != nil {
+			return fmt.Errorf("failed to setup resource limits: %v", err)
+		}
+
+		maxCntrHandles := ctx.GlobalInt("max-cntr-handles")
+		if maxCntrHandles < 0 {
+			return fmt.Errorf("invalid max-cntr-handles value %d", maxCntrHandles)
+		}
+		domain.SetMaxCntrHandles(maxCntrHandles)
+
+		share := ctx.GlobalInt("userns-limits-share")
+		if share < 1 || share > 100 {
+			return fmt.Errorf("invalid userns-limits-share value %d", share)
+		}
+		domain.SetUserNsLimitsShare(share)
+
+		if val := ctx.GlobalString("write-rate-limit"); val != "" {
+			limit, err := domain.ParseRateLimit(val)
+			if err != nil {
+				return err
+			}
+			domain.SetWriteRateLimit(limit)
+			if !limit.Unlimited() {
+				logrus.Infof("Containers' write rate limit set to %v", limit)
+			}
+		}
+
+		if err := implementations.SetKmsgSource(ctx.GlobalString("kmsg-source")); err != nil {
+			return err
+		}
+		if src := ctx.GlobalString("kmsg-source"); src != implementations.KmsgSourceEmpty {
+			logrus.Infof("Kernel messages source set to %s", src)
+		}
+
+		dmiTemplates, err := parseDmiTemplates(ctx.GlobalStringSlice("dmi-template"))
+		if err != nil {
+			return err
+		}
+		if err := implementations.SetDmiTemplates(dmiTemplates); err != nil {
+			return err
+		}
 
 		// Construct sysbox-fs services.
 		var nsenterService = nsenter.NewNSenterService()
@@ -372,14 +677,20 @@ func main() {
 			return fmt.Errorf("failed to setup the sysbox run dir: %v", err)
 		}
 
+		// Inode numbers of the emulated nodes are preserved across restarts.
+		if err := fuse.SetInodeStoreDir(sysboxFsInodes); err != nil {
+			return fmt.Errorf("failed to setup the inodes dir: %v", err)
+		}
+
 		// Setup sysbox-fs services.
 		processService.Setup(ioService)
 
 		nsenterService.Setup(processService, nil)
 
 		handlerService.Setup(
-			handler.DefaultHandlers,
+			handler.Handlers(),
 			ctx.Bool("ignore-handler-errors"),
+			ctx.GlobalBool("dry-run"),
 			containerStateService,
 			nsenterService,
 			processService,
@@ -400,6 +711,7 @@ func main() {
 			processService,
 			ioService,
 			mountService,
+			handlerService,
 		)
 
 		mountService.Setup(
@@ -417,12 +729,15 @@ func main() {
 			ctx.BoolT("allow-immutable-remounts"),
 			ctx.Bool("allow-immutable-unmounts"),
 			ctx.GlobalString("seccomp-fd-release"),
+			ctx.GlobalString("submount-unmounts"),
+			ctx.GlobalBool("dry-run"),
 		)
 
 		ipcService.Setup(
 			containerStateService,
 			processService,
 			ioService,
+			handlerService,
 			ctx.GlobalString("mountpoint"),
 		)
 
@@ -432,20 +747,49 @@ func main() {
 			logrus.Fatal(err)
 		}
 
+		// Apply the runtime settings defined in the config file (if any), and
+		// launch the config-reload handler to re-apply them upon SIGHUP arrival.
+		cfgLoader.setHandlerService(handlerService)
+		if err := cfgLoader.load(); err != nil {
+			return err
+		}
+		go reloadHandler(cfgLoader)
+
+		// Health endpoints are served over tcp if requested.
+		ipc.SetHealthAddr(ctx.GlobalString("health-addr"))
+
+		// Security events are appended to the audit log if requested.
+		if path := ctx.GlobalString("security-audit-log"); path != "" {
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to open security audit log %s: %v", path, err)
+			}
+			domain.SetSecurityAuditLog(f)
+			logrus.Infof("Security events logged to %s", path)
+		}
+
+		// Cross-check container registrations against containerd's events.
+		if socket := ctx.GlobalString("containerd-socket"); socket != "" {
+			containerStateService.WatchRuntimeEvents(
+				socket, ctx.GlobalBool("containerd-cleanup"))
+		}
+
 		// Launch exit handler (performs proper cleanup of sysbox-fs upon
 		// receiving termination signals).
 		var exitChan = make(chan os.Signal, 1)
 		signal.Notify(
 			exitChan,
-			syscall.SIGHUP,
 			syscall.SIGINT,
 			syscall.SIGTERM,
 			syscall.SIGSEGV,
 			syscall.SIGQUIT)
-		go exitHandler(exitChan, fuseServerService, profile)
-
-		// TODO: Consider adding sync.Workgroups to ensure that all goroutines
-		// are done with their in-fly tasks before exit()ing.
+		go exitHandler(
+			exitChan,
+			fuseServerService,
+			nsenterService,
+			time.Duration(ctx.GlobalInt("shutdown-timeout"))*time.Second,
+			profile,
+		)
 
 		systemd.SdNotify(false, systemd.SdNotifyReady)
 
@@ -18,6 +18,9 @@ package main
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/sirupsen/logrus"
@@ -30,3 +33,111 @@ func TestMain(m *testing.M) {
 
 	m.Run()
 }
+
+func TestLogRotator(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "sysbox-fs-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sysbox-fs.log")
+
+	lr, err := newLogRotator(path, 16, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lr.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := lr.Write([]byte("0123456789\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var backups int
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "sysbox-fs.log.") {
+			backups++
+		}
+	}
+
+	// Every write exceeds the 16 bytes limit, so the log file is rotated prior
+	// to each write (but the first), and only two backups are retained.
+	if backups != 2 {
+		t.Errorf("expected 2 rotated files, found %d", backups)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 11 {
+		t.Errorf("expected log file size 11, found %d", info.Size())
+	}
+
+	if _, err := newLogRotator(path, -1, 0, 0); err == nil {
+		t.Errorf("expected error for negative max-size")
+	}
+}
+
+func TestRootlessMode(t *testing.T) {
+
+	// Rootless mode is opt-in, regardless of sysbox-fs' privileges.
+	tests := []struct {
+		val  string
+		want bool
+	}{
+		{"", false},
+		{"false", false},
+		{"true", true},
+	}
+
+	for _, tt := range tests {
+		got, err := rootlessMode(tt.val)
+		if err != nil || got != tt.want {
+			t.Errorf("rootlessMode(%q) = %v, %v; want %v", tt.val, got, err, tt.want)
+		}
+	}
+
+	if _, err := rootlessMode("yes"); err == nil {
+		t.Errorf("rootlessMode(%q) expected error", "yes")
+	}
+}
+
+func TestResourceLimitsCheck(t *testing.T) {
+
+	// Unlimited resources.
+	lm := &resourceLimits{}
+	if reason, _ := lm.check(); reason != "" {
+		t.Errorf("check() unexpected pressure: %s", reason)
+	}
+
+	// Limits well above the current usage.
+	lm = &resourceLimits{maxGoroutines: 1 << 20, maxFds: 1 << 20, maxMemory: 1 << 40}
+	if reason, _ := lm.check(); reason != "" {
+		t.Errorf("check() unexpected pressure: %s", reason)
+	}
+
+	// Limits below the current usage.
+	lm = &resourceLimits{maxGoroutines: 1}
+	if reason, memory := lm.check(); reason == "" || memory {
+		t.Errorf("check() expected goroutines pressure, got %q", reason)
+	}
+
+	lm = &resourceLimits{maxFds: 1}
+	if reason, memory := lm.check(); reason == "" || memory {
+		t.Errorf("check() expected fds pressure, got %q", reason)
+	}
+
+	lm = &resourceLimits{maxMemory: 1}
+	if reason, memory := lm.check(); reason == "" || !memory {
+		t.Errorf("check() expected memory pressure, got %q", reason)
+	}
+}
@@ -0,0 +1,510 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default location of sysbox-fs' configuration file.
+const DefaultConfigPath = "/etc/sysbox/sysbox-fs.yaml"
+
+//
+// Config holds the sysbox-fs settings that can be defined through the
+// configuration file. Every command-line flag has a config-file counterpart
+// (same name), with flags explicitly set in the command-line taking precedence
+// over config-file values.
+//
+// Runtime settings (i.e., log-level, slow-op-ms, fuse timeouts / read-cache
+// and handler policies) are reloaded (re-read and re-applied) upon SIGHUP arrival, without
+// requiring fuse-servers to be torn down. The rest of the settings take effect
+// on sysbox-fs restart.
+//
+// Example:
+//
+// mountpoint: /var/lib/sysboxfs
+// allow-immutable-remounts: false
+// allow-immutable-unmounts: true
+// seccomp-fd-release: proc-exit
+// submount-unmounts: ignore
+// emulated-files-owner: root
+// log: /var/log/sysbox-fs.log
+// log-level: info
+// log-format: json
+// log-max-size: 100
+// log-max-age: 7
+// log-max-backups: 4
+// slow-op-ms: 250
+// shutdown-timeout: 10
+// max-goroutines: 10000
+// max-fds: 65536
+// max-nsenter-procs: 256
+// max-memory: 2048
+// max-cntr-handles: 4096
+// userns-limits-share: 50
+// write-rate-limit: 50:100
+// kmsg-source: synthetic
+// dmi-templates:
+//   product_serial: SYSBOX-{id}
+// dry-run: false
+// health-addr: 127.0.0.1:9099
+// containerd-socket: /run/containerd/containerd.sock
+// containerd-cleanup: false
+// security-audit-log: /var/log/sysbox-fs-audit.log
+// fuse:
+//   dentry-cache-timeout: 10m
+//   dynamic-dentry-cache-timeout: 1s
+//   attr-cache-timeout: 10m
+//   read-cache-ttl: 1s
+//   read-cache-paths:
+//     - /proc/sys/kernel
+//     - /sys/devices/system/cpu
+//   max-background: 64
+//   congestion-threshold: 48
+// handlers:
+//   /proc/swaps:
+//     enabled: false
+// resources:
+//   /proc/sys/net/ipv4/tcp_keepalive_time:
+//     policy: read-only
+//   /sys/kernel/debug:
+//     policy: hidden
+// labeled-resources:
+//   - labels:
+//       io.kubernetes.pod.namespace: untrusted
+//     resources:
+//       /proc/sys/net/ipv4:
+//         policy: read-only
+//
+type Config struct {
+	// FUSE mountpoint location.
+	Mountpoint string `yaml:"mountpoint"`
+
+	// Allow immutable mounts to be remounted / unmounted within containers.
+	AllowImmutableRemounts *bool `yaml:"allow-immutable-remounts"`
+	AllowImmutableUnmounts *bool `yaml:"allow-immutable-unmounts"`
+
+	// Policy to close syscall interception handles (proc-exit, cont-exit).
+	SeccompFdRelease string `yaml:"seccomp-fd-release"`
+
+	// Policy for unmounts of sysbox-fs managed submounts (ignore, deny).
+	SubmountUnmounts string `yaml:"submount-unmounts"`
+
+	// Owner of the emulated files within containers (root, nobody).
+	EmulatedFilesOwner string `yaml:"emulated-files-owner"`
+
+	// Log file path.
+	Log string `yaml:"log"`
+
+	// Log categories to include (debug, info, warning, error, fatal).
+	LogLevel string `yaml:"log-level"`
+
+	// Log format (text, json).
+	LogFormat string `yaml:"log-format"`
+
+	// Log rotation settings.
+	LogMaxSize    int `yaml:"log-max-size"`
+	LogMaxAge     int `yaml:"log-max-age"`
+	LogMaxBackups int `yaml:"log-max-backups"`
+
+	// Threshold (in milliseconds) beyond which operations are logged as slow.
+	SlowOpMs int `yaml:"slow-op-ms"`
+
+	// Time (in seconds) to wait for in-flight operations upon shutdown.
+	ShutdownTimeout int `yaml:"shutdown-timeout"`
+
+	// Self-imposed resource limits (memory in MB); 0 for unlimited.
+	MaxGoroutines   int `yaml:"max-goroutines"`
+	MaxFds          int `yaml:"max-fds"`
+	MaxNSenterProcs int `yaml:"max-nsenter-procs"`
+	MaxMemory       int `yaml:"max-memory"`
+	MaxCntrHandles  int `yaml:"max-cntr-handles"`
+
+	// Share (percentage) of the host's user-namespace limits granted to each
+	// sys container.
+	UserNsLimitsShare int `yaml:"userns-limits-share"`
+
+	// Rate limit ("<rate>[:<burst>]", in operations per second) of the writes
+	// to emulated resources and trapped mount / chown syscalls of each sys
+	// container.
+	WriteRateLimit string `yaml:"write-rate-limit"`
+
+	// Source of the sys containers' kernel messages (empty, synthetic, host).
+	KmsgSource string `yaml:"kmsg-source"`
+
+	// Templates of the DMI fields exposed within sys containers, indexed by
+	// field name (e.g. "product_serial").
+	DmiTemplates map[string]string `yaml:"dmi-templates"`
+
+	// Diagnostic mode: emulation is disabled and all operations are passed
+	// through to the kernel.
+	DryRun *bool `yaml:"dry-run"`
+
+	// Tcp address ("<host>:<port>") on which the health endpoints (/healthz,
+	// /readyz) are served, in addition to the debug socket.
+	HealthAddr string `yaml:"health-addr"`
+
+	// Containerd socket whose events are cross-checked against the container
+	// registrations, and whether to unregister the containers found gone.
+	ContainerdSocket  string `yaml:"containerd-socket"`
+	ContainerdCleanup *bool  `yaml:"containerd-cleanup"`
+
+	// File to which security events are appended (as JSON lines).
+	SecurityAuditLog string `yaml:"security-audit-log"`
+
+	// FUSE settings.
+	Fuse FuseConfig `yaml:"fuse"`
+
+	// Per-handler policies indexed by handler path (e.g. "/proc/swaps").
+	Handlers map[string]HandlerConfig `yaml:"handlers"`
+
+	// Per-resource policies indexed by resource path. Policies apply to the
+	// resource and all its descendants.
+	Resources map[string]ResourceConfig `yaml:"resources"`
+
+	// Per-resource policies applying to the containers carrying the given
+	// labels (as per their container manager, e.g. containerd), which take
+	// precedence over the ones above.
+	LabeledResources []LabeledResourceConfig `yaml:"labeled-resources"`
+}
+
+// FUSE settings. Nil values stand for sysbox-fs' defaults.
+type FuseConfig struct {
+	DentryCacheTimeout        *time.Duration `yaml:"dentry-cache-timeout"`
+	DynamicDentryCacheTimeout *time.Duration `yaml:"dynamic-dentry-cache-timeout"`
+	AttrCacheTimeout          *time.Duration `yaml:"attr-cache-timeout"`
+
+	// Time during which the contents of the nodes under ReadCachePaths are
+	// cached (nil or 0 to disable the read-cache).
+	ReadCacheTTL   *time.Duration `yaml:"read-cache-ttl"`
+	ReadCachePaths []string       `yaml:"read-cache-paths"`
+
+	// Nodes (along with their descendants) that can be mmap()ed read-only.
+	// Reads of these nodes go through the kernel's page-cache.
+	MmapPaths []string `yaml:"mmap-paths"`
+
+	// Tunables of the fuse mounts (0 for the kernel's defaults), applied to
+	// the fuse-servers created from then on. These are projected over their
+	// command-line flag counterparts ("fuse-max-background", etc).
+	MaxBackground       int `yaml:"max-background"`
+	CongestionThreshold int `yaml:"congestion-threshold"`
+}
+
+// Handler policy. Accesses to the resources of a disabled handler are served
+// by its closest (enabled) ancestor handler.
+type HandlerConfig struct {
+	Enabled *bool `yaml:"enabled"`
+}
+
+// Resource policy: "exposed" (default), "hidden", "read-only" or "passthrough"
+// (resource is not emulated, but served from the container's procfs/sysfs).
+type ResourceConfig struct {
+	Policy string `yaml:"policy"`
+}
+
+// Resource policies scoped to the containers carrying all the given labels.
+type LabeledResourceConfig struct {
+	Labels    map[string]string         `yaml:"labels"`
+	Resources map[string]ResourceConfig `yaml:"resources"`
+}
+
+const (
+	ResourcePolicyExposed     = "exposed"
+	ResourcePolicyHidden      = "hidden"
+	ResourcePolicyReadOnly    = "read-only"
+	ResourcePolicyPassthrough = "passthrough"
+)
+
+var validLogLevels = map[string]bool{
+	"":        true,
+	"debug":   true,
+	"info":    true,
+	"warning": true,
+	"error":   true,
+	"fatal":   true,
+}
+
+// Load parses the configuration file located at the given path. A missing
+// file is not considered an error, in which case an empty config is returned.
+func Load(path string) (*Config, error) {
+
+	cfg := &Config{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate verifies the consistency of the config settings.
+func (c *Config) Validate() error {
+
+	if !validLogLevels[c.LogLevel] {
+		return fmt.Errorf("log-level option '%v' not recognized", c.LogLevel)
+	}
+
+	switch c.LogFormat {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("log-format option '%v' not recognized", c.LogFormat)
+	}
+
+	switch c.SeccompFdRelease {
+	case "", "proc-exit", "cont-exit":
+	default:
+		return fmt.Errorf("seccomp-fd-release option '%v' not recognized", c.SeccompFdRelease)
+	}
+
+	switch c.SubmountUnmounts {
+	case "", "ignore", "deny":
+	default:
+		return fmt.Errorf("submount-unmounts option '%v' not recognized", c.SubmountUnmounts)
+	}
+
+	switch c.EmulatedFilesOwner {
+	case "", "root", "nobody":
+	default:
+		return fmt.Errorf("emulated-files-owner option '%v' not recognized", c.EmulatedFilesOwner)
+	}
+
+	if c.LogMaxSize < 0 || c.LogMaxAge < 0 || c.LogMaxBackups < 0 {
+		return fmt.Errorf("invalid log rotation settings")
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid shutdown-timeout value %d", c.ShutdownTimeout)
+	}
+
+	if c.MaxGoroutines < 0 || c.MaxFds < 0 || c.MaxNSenterProcs < 0 || c.MaxMemory < 0 ||
+		c.MaxCntrHandles < 0 {
+		return fmt.Errorf("invalid resource limits")
+	}
+
+	if c.UserNsLimitsShare < 0 || c.UserNsLimitsShare > 100 {
+		return fmt.Errorf("invalid userns-limits-share value %d", c.UserNsLimitsShare)
+	}
+
+	if c.WriteRateLimit != "" && !validRateLimit(c.WriteRateLimit) {
+		return fmt.Errorf("invalid write-rate-limit value %q", c.WriteRateLimit)
+	}
+
+	switch c.KmsgSource {
+	case "", "empty", "synthetic", "host":
+	default:
+		return fmt.Errorf("kmsg-source option '%v' not recognized", c.KmsgSource)
+	}
+
+	for field, tmpl := range c.DmiTemplates {
+		if field == "" || strings.ContainsAny(field, "=,") || strings.Contains(tmpl, ",") {
+			return fmt.Errorf("invalid dmi template '%v' for field '%v'", tmpl, field)
+		}
+	}
+
+	if c.ContainerdSocket != "" && !filepath.IsAbs(c.ContainerdSocket) {
+		return fmt.Errorf("containerd-socket %s must be absolute", c.ContainerdSocket)
+	}
+
+	if c.SecurityAuditLog != "" && !filepath.IsAbs(c.SecurityAuditLog) {
+		return fmt.Errorf("security-audit-log %s must be absolute", c.SecurityAuditLog)
+	}
+
+	if c.HealthAddr != "" {
+		if _, _, err := net.SplitHostPort(c.HealthAddr); err != nil {
+			return fmt.Errorf("invalid health-addr value %s: %v", c.HealthAddr, err)
+		}
+	}
+
+	if c.SlowOpMs < 0 {
+		return fmt.Errorf("invalid slow-op-ms value %d", c.SlowOpMs)
+	}
+
+	if t := c.Fuse.DentryCacheTimeout; t != nil && *t < 0 {
+		return fmt.Errorf("invalid dentry-cache-timeout value %v", *t)
+	}
+
+	if t := c.Fuse.DynamicDentryCacheTimeout; t != nil && *t < 0 {
+		return fmt.Errorf("invalid dynamic-dentry-cache-timeout value %v", *t)
+	}
+
+	if t := c.Fuse.AttrCacheTimeout; t != nil && *t < 0 {
+		return fmt.Errorf("invalid attr-cache-timeout value %v", *t)
+	}
+
+	if t := c.Fuse.ReadCacheTTL; t != nil && *t < 0 {
+		return fmt.Errorf("invalid read-cache-ttl value %v", *t)
+	}
+
+	for _, path := range c.Fuse.ReadCachePaths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("read-cache path %s must be absolute", path)
+		}
+	}
+
+	for _, path := range c.Fuse.MmapPaths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("mmap path %s must be absolute", path)
+		}
+	}
+
+	if c.Fuse.MaxBackground < 0 || c.Fuse.CongestionThreshold < 0 {
+		return fmt.Errorf("invalid fuse mount options")
+	}
+
+	if c.Fuse.MaxBackground > 0xffff || c.Fuse.CongestionThreshold > 0xffff {
+		return fmt.Errorf("fuse max-background and congestion-threshold must not exceed %d", 0xffff)
+	}
+
+	if err := validateResources(c.Resources); err != nil {
+		return err
+	}
+
+	for _, lr := range c.LabeledResources {
+		if len(lr.Labels) == 0 {
+			return fmt.Errorf("labeled resources must define at least one label")
+		}
+		if err := validateResources(lr.Resources); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Verifies the paths and policies of the given resources.
+func validateResources(resources map[string]ResourceConfig) error {
+
+	for path, res := range resources {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("resource path %s must be absolute", path)
+		}
+		switch res.Policy {
+		case ResourcePolicyExposed, ResourcePolicyHidden,
+			ResourcePolicyReadOnly, ResourcePolicyPassthrough:
+		default:
+			return fmt.Errorf("invalid policy '%v' for resource %s", res.Policy, path)
+		}
+	}
+
+	return nil
+}
+
+// Reports whether the given rate limit is expressed as "<rate>[:<burst>]" (see
+// domain.ParseRateLimit()).
+func validRateLimit(val string) bool {
+
+	fields := strings.SplitN(val, ":", 2)
+
+	if rate, err := strconv.ParseFloat(fields[0], 64); err != nil || rate < 0 {
+		return false
+	}
+	if len(fields) == 2 {
+		if burst, err := strconv.Atoi(fields[1]); err != nil || burst < 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FlagValues returns the settings defined in the config file as a map indexed
+// by their command-line flag counterparts. Settings absent from the config
+// file are not included.
+func (c *Config) FlagValues() map[string]string {
+
+	flags := make(map[string]string)
+
+	addString := func(name, val string) {
+		if val != "" {
+			flags[name] = val
+		}
+	}
+	addInt := func(name string, val int) {
+		if val != 0 {
+			flags[name] = strconv.Itoa(val)
+		}
+	}
+	addBool := func(name string, val *bool) {
+		if val != nil {
+			flags[name] = strconv.FormatBool(*val)
+		}
+	}
+
+	addString("mountpoint", c.Mountpoint)
+	addBool("allow-immutable-remounts", c.AllowImmutableRemounts)
+	addBool("allow-immutable-unmounts", c.AllowImmutableUnmounts)
+	addString("seccomp-fd-release", c.SeccompFdRelease)
+	addString("submount-unmounts", c.SubmountUnmounts)
+	addString("emulated-files-owner", c.EmulatedFilesOwner)
+	addString("log", c.Log)
+	addString("log-level", c.LogLevel)
+	addString("log-format", c.LogFormat)
+	addInt("log-max-size", c.LogMaxSize)
+	addInt("log-max-age", c.LogMaxAge)
+	addInt("log-max-backups", c.LogMaxBackups)
+	addInt("slow-op-ms", c.SlowOpMs)
+	addInt("shutdown-timeout", c.ShutdownTimeout)
+	addInt("max-goroutines", c.MaxGoroutines)
+	addInt("max-fds", c.MaxFds)
+	addInt("max-nsenter-procs", c.MaxNSenterProcs)
+	addInt("max-memory", c.MaxMemory)
+	addInt("max-cntr-handles", c.MaxCntrHandles)
+	addInt("userns-limits-share", c.UserNsLimitsShare)
+	addString("write-rate-limit", c.WriteRateLimit)
+	addString("kmsg-source", c.KmsgSource)
+	addInt("fuse-max-background", c.Fuse.MaxBackground)
+	addInt("fuse-congestion-threshold", c.Fuse.CongestionThreshold)
+
+	if len(c.DmiTemplates) > 0 {
+		var templates []string
+		for field, tmpl := range c.DmiTemplates {
+			templates = append(templates, field+"="+tmpl)
+		}
+		sort.Strings(templates)
+		flags["dmi-template"] = strings.Join(templates, ",")
+	}
+
+	addBool("dry-run", c.DryRun)
+	addString("health-addr", c.HealthAddr)
+	addString("containerd-socket", c.ContainerdSocket)
+	addString("security-audit-log", c.SecurityAuditLog)
+	addBool("containerd-cleanup", c.ContainerdCleanup)
+
+	return flags
+}
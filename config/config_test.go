@@ -0,0 +1,171 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+
+	dir, err := ioutil.TempDir("", "sysbox-fs-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "sysbox-fs.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+
+	path := writeConfig(t, `
+log-level: debug
+slow-op-ms: 250
+fuse:
+  dentry-cache-timeout: 10m
+handlers:
+  /proc/swaps:
+    enabled: false
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+
+	if cfg.LogLevel != "debug" {
+		t.Errorf("LogLevel = %v, want debug", cfg.LogLevel)
+	}
+	if cfg.SlowOpMs != 250 {
+		t.Errorf("SlowOpMs = %v, want 250", cfg.SlowOpMs)
+	}
+	if cfg.Fuse.DentryCacheTimeout == nil || *cfg.Fuse.DentryCacheTimeout != 10*time.Minute {
+		t.Errorf("DentryCacheTimeout = %v, want 10m", cfg.Fuse.DentryCacheTimeout)
+	}
+	if cfg.Fuse.AttrCacheTimeout != nil {
+		t.Errorf("AttrCacheTimeout = %v, want nil", *cfg.Fuse.AttrCacheTimeout)
+	}
+	policy, ok := cfg.Handlers["/proc/swaps"]
+	if !ok || policy.Enabled == nil || *policy.Enabled {
+		t.Errorf("Handlers = %v, want /proc/swaps disabled", cfg.Handlers)
+	}
+}
+
+func TestFlagValues(t *testing.T) {
+
+	path := writeConfig(t, `
+mountpoint: /var/lib/sysboxfs-test
+allow-immutable-unmounts: false
+emulated-files-owner: nobody
+log-format: json
+log-max-size: 100
+max-nsenter-procs: 64
+write-rate-limit: 50:100
+fuse:
+  max-background: 64
+dmi-templates:
+  sys_vendor: Sysbox
+  product_serial: SYSBOX-{id}
+dry-run: true
+health-addr: 127.0.0.1:9099
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"mountpoint":               "/var/lib/sysboxfs-test",
+		"allow-immutable-unmounts": "false",
+		"emulated-files-owner":     "nobody",
+		"log-format":               "json",
+		"log-max-size":             "100",
+		"max-nsenter-procs":        "64",
+		"write-rate-limit":         "50:100",
+		"fuse-max-background":      "64",
+		"dmi-template":             "product_serial=SYSBOX-{id},sys_vendor=Sysbox",
+		"dry-run":                  "true",
+		"health-addr":              "127.0.0.1:9099",
+	}
+
+	if got := cfg.FlagValues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FlagValues() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+
+	cfg, err := Load("/non-existent/sysbox-fs.yaml")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg == nil {
+		t.Fatalf("Load() returned nil config")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"bad-yaml", "log-level: [debug"},
+		{"bad-log-level", "log-level: verbose"},
+		{"bad-slow-op", "slow-op-ms: -1"},
+		{"bad-max-fds", "max-fds: -1"},
+		{"bad-write-rate-limit", "write-rate-limit: '10:0'"},
+		{"bad-read-cache-path", "fuse: {read-cache-ttl: 1s, read-cache-paths: [proc/sys]}"},
+		{"bad-mmap-path", "fuse: {mmap-paths: [proc/cpuinfo]}"},
+		{"bad-congestion-threshold", "fuse: {congestion-threshold: -1}"},
+		{"bad-max-background", "fuse: {max-background: 100000}"},
+		{"bad-log-format", "log-format: xml"},
+		{"bad-fd-release", "seccomp-fd-release: never"},
+		{"bad-submount-unmounts", "submount-unmounts: remount"},
+		{"bad-files-owner", "emulated-files-owner: admin"},
+		{"bad-health-addr", "health-addr: localhost"},
+		{"bad-containerd-socket", "containerd-socket: run/containerd/containerd.sock"},
+		{"bad-security-audit-log", "security-audit-log: sysbox-fs-audit.log"},
+		{"bad-dmi-template", "dmi-templates: {product_serial: 'a,b'}"},
+		{"bad-labeled-resources", "labeled-resources: [{resources: {/proc/kallsyms: {policy: hidden}}}]"},
+		{"bad-labeled-resource-policy", "labeled-resources: [{labels: {tier: untrusted}, resources: {/proc/kallsyms: {policy: masked}}}]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.content)
+			defer os.RemoveAll(filepath.Dir(path))
+
+			if _, err := Load(path); err == nil {
+				t.Errorf("Load() expected error for %q", tt.content)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+//
+// OCI annotations forwarded by sysbox-runc during container registration,
+// through which users can alter sysbox-fs' emulation on a per-container basis:
+//
+// * io.sysbox.fs.<resource>=<policy>: sets the policy of a procfs resource,
+//   with dots standing for path separators (e.g. "io.sysbox.fs.meminfo",
+//   "io.sysbox.fs.sys.kernel.panic"). Sysfs resources are identified through
+//   the "sysfs." prefix (e.g. "io.sysbox.fs.sysfs.kernel.debug"). Supported
+//   policies are: "enabled", "disabled" (resource is not emulated but served
+//   from the container's procfs/sysfs), "hidden" and "read-only".
+//
+// * io.sysbox.fs.sysctl.<key>=<value>: initial value of an emulated sysctl
+//   (e.g. "io.sysbox.fs.sysctl.net.core.somaxconn=65535").
+//
+// * io.sysbox.fs.dmi.<field>=<template>: template of an emulated DMI field
+//   (e.g. "io.sysbox.fs.dmi.product_serial=SYSBOX-{id}"). These ones are
+//   directly consumed by the DMI handler.
+//
+// * io.sysbox.fs.bind-mounts=<node>:<path>[,<node>:<path>...]: emulated nodes
+//   to be bind-mounted over other paths within the container (e.g.
+//   "io.sysbox.fs.bind-mounts=/proc/uptime:/usr/share/proc/uptime"). Nodes
+//   must be served by sysbox-fs, and target paths must exist within the
+//   container. These are set up by the mount service upon container
+//   registration (see MountServiceIface.BindMounts).
+//
+// * io.sysbox.fs.profile=<profile>[,<profile>...]: emulation profiles (see
+//   Profiles) applied to the container (e.g. "io.sysbox.fs.profile=k8s"). The
+//   settings defined through the other annotations take precedence over the
+//   profile ones.
+//
+// * io.sysbox.fs.write-rate-limit=<rate>[:<burst>]: rate limit of the writes
+//   to emulated resources and trapped mount / chown syscalls (see RateLimit),
+//   overriding the daemon-wide one (e.g. "io.sysbox.fs.write-rate-limit=50:100";
+//   "0" for no limit).
+//
+// * io.sysbox.fs.mount-label=<label>: SELinux context of the container's
+//   objects (i.e., the OCI "linux.mountLabel"), applied to the file-systems
+//   mounted and the files created by sysbox-fs on behalf of the container
+//   (see MountLabel).
+//
+// Per-container policies take precedence over the daemon-wide ones.
+//
+const (
+	AnnotationPrefix       = "io.sysbox.fs."
+	SysctlAnnotationPrefix = AnnotationPrefix + "sysctl."
+	DmiAnnotationPrefix    = AnnotationPrefix + "dmi."
+	BindMountsAnnotation   = AnnotationPrefix + "bind-mounts"
+	ProfileAnnotation      = AnnotationPrefix + "profile"
+	WriteRateAnnotation    = AnnotationPrefix + "write-rate-limit"
+	MountLabelAnnotation   = AnnotationPrefix + "mount-label"
+	sysfsAnnotationPrefix  = "sysfs."
+)
+
+var annotationPolicies = map[string]ResourcePolicy{
+	"enabled":   ResourcePolicyExpose,
+	"disabled":  ResourcePolicyPassthrough,
+	"hidden":    ResourcePolicyHide,
+	"read-only": ResourcePolicyReadOnly,
+}
+
+// ParseAnnotations extracts the sysbox-fs settings out of the given container
+// annotations. Resource policies and sysctl values are indexed by resource
+// path. Unrecognized sysbox-fs annotations are returned in the invalid slice.
+func ParseAnnotations(
+	annotations map[string]string) (
+	policies ResourcePolicies,
+	sysctls map[string]string,
+	invalid []string) {
+
+	var profiles []*Profile
+
+	for key, val := range annotations {
+		if !strings.HasPrefix(key, AnnotationPrefix) {
+			continue
+		}
+
+		if key == ProfileAnnotation {
+			var err error
+			if profiles, err = ParseProfiles(val); err != nil {
+				invalid = append(invalid, key)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(key, DmiAnnotationPrefix) {
+			continue
+		}
+
+		if key == WriteRateAnnotation {
+			if _, err := ParseRateLimit(val); err != nil {
+				invalid = append(invalid, key)
+			}
+			continue
+		}
+
+		if key == MountLabelAnnotation {
+			if err := ValidateMountLabel(val); err != nil {
+				invalid = append(invalid, key)
+			}
+			continue
+		}
+
+		if key == BindMountsAnnotation {
+			if _, err := ParseBindMounts(val); err != nil {
+				invalid = append(invalid, key)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(key, SysctlAnnotationPrefix) {
+			name := strings.TrimPrefix(key, SysctlAnnotationPrefix)
+			if name == "" || val == "" {
+				invalid = append(invalid, key)
+				continue
+			}
+			if sysctls == nil {
+				sysctls = make(map[string]string)
+			}
+			path := filepath.Join("/proc/sys", strings.Replace(name, ".", "/", -1))
+			sysctls[path] = val
+			continue
+		}
+
+		name := strings.TrimPrefix(key, AnnotationPrefix)
+		policy, ok := annotationPolicies[val]
+		if name == "" || !ok {
+			invalid = append(invalid, key)
+			continue
+		}
+
+		root := "/proc"
+		if strings.HasPrefix(name, sysfsAnnotationPrefix) {
+			root = "/sys"
+			name = strings.TrimPrefix(name, sysfsAnnotationPrefix)
+		}
+
+		if policies == nil {
+			policies = make(ResourcePolicies)
+		}
+		policies[filepath.Join(root, strings.Replace(name, ".", "/", -1))] = policy
+	}
+
+	for _, p := range profiles {
+		policies, sysctls = p.merge(policies, sysctls)
+	}
+
+	return policies, sysctls, invalid
+}
+
+// ParseBindMounts extracts the bind-mounts (i.e., source node and target path)
+// out of the value of the bind-mounts annotation.
+func ParseBindMounts(val string) ([]Mount, error) {
+
+	var mounts []Mount
+
+	for _, entry := range strings.Split(val, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		paths := strings.Split(entry, ":")
+		if len(paths) != 2 ||
+			!filepath.IsAbs(paths[0]) ||
+			!filepath.IsAbs(paths[1]) ||
+			filepath.Clean(paths[1]) == "/" {
+			return nil, fmt.Errorf("invalid bind-mount %q", entry)
+		}
+
+		mounts = append(mounts, Mount{
+			Source: filepath.Clean(paths[0]),
+			Target: filepath.Clean(paths[1]),
+		})
+	}
+
+	if len(mounts) == 0 {
+		return nil, fmt.Errorf("no bind-mounts found in %q", val)
+	}
+
+	return mounts, nil
+}
+
+// ResourcePolicies holds a set of resource policies indexed by resource path.
+type ResourcePolicies map[string]ResourcePolicy
+
+// Lookup returns the policy applying to the given path (i.e., the policy of the
+// path itself or of its closest ancestor within the set).
+func (p ResourcePolicies) Lookup(path string) (ResourcePolicy, bool) {
+
+	if len(p) == 0 {
+		return ResourcePolicyExpose, false
+	}
+
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if policy, ok := p[dir]; ok {
+			return policy, true
+		}
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+
+	return ResourcePolicyExpose, false
+}
+
+// LabeledResourcePolicies holds a set of resource policies applying to the
+// containers labeled as per the given labels (see ContainerMetadata).
+type LabeledResourcePolicies struct {
+	Labels   map[string]string
+	Policies map[string]ResourcePolicy
+}
+
+// Matches reports whether the given container labels carry all the labels of
+// the policy set.
+func (p *LabeledResourcePolicies) Matches(labels map[string]string) bool {
+
+	if len(p.Labels) == 0 {
+		return false
+	}
+
+	for key, val := range p.Labels {
+		if v, ok := labels[key]; !ok || v != val {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,215 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAnnotations(t *testing.T) {
+
+	policies, sysctls, invalid := ParseAnnotations(map[string]string{
+		"io.sysbox.fs.meminfo":                   "disabled",
+		"io.sysbox.fs.sys.kernel.panic":          "read-only",
+		"io.sysbox.fs.sysfs.kernel.debug":        "hidden",
+		"io.sysbox.fs.sysctl.net.core.somaxconn": "65535",
+		"io.sysbox.fs.dmi.product_serial":        "SYSBOX-{id}",
+		"io.sysbox.fs.bind-mounts":               "/proc/uptime:/etc/uptime",
+		"io.sysbox.fs.write-rate-limit":          "50:100",
+		"io.sysbox.fs.mount-label":               "system_u:object_r:container_file_t:s0:c1,c2",
+		"io.sysbox.fs.swaps":                     "maybe",
+		"io.kubernetes.cri.sandbox-id":           "abc",
+	})
+
+	wantPolicies := ResourcePolicies{
+		"/proc/meminfo":          ResourcePolicyPassthrough,
+		"/proc/sys/kernel/panic": ResourcePolicyReadOnly,
+		"/sys/kernel/debug":      ResourcePolicyHide,
+	}
+	if !reflect.DeepEqual(policies, wantPolicies) {
+		t.Errorf("policies = %v, want %v", policies, wantPolicies)
+	}
+
+	wantSysctls := map[string]string{
+		"/proc/sys/net/core/somaxconn": "65535",
+	}
+	if !reflect.DeepEqual(sysctls, wantSysctls) {
+		t.Errorf("sysctls = %v, want %v", sysctls, wantSysctls)
+	}
+
+	if !reflect.DeepEqual(invalid, []string{"io.sysbox.fs.swaps"}) {
+		t.Errorf("invalid = %v, want [io.sysbox.fs.swaps]", invalid)
+	}
+
+	lookupTests := []struct {
+		path  string
+		want  ResourcePolicy
+		found bool
+	}{
+		{"/sys/kernel/debug/tracing", ResourcePolicyHide, true},
+		{"/sys/kernel", ResourcePolicyExpose, false},
+		{"/proc/meminfo", ResourcePolicyPassthrough, true},
+		{"/proc/sys/kernel/panic_on_oops", ResourcePolicyExpose, false},
+	}
+
+	for _, tt := range lookupTests {
+		got, found := policies.Lookup(tt.path)
+		if got != tt.want || found != tt.found {
+			t.Errorf("Lookup(%s) = %v, %v, want %v, %v",
+				tt.path, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestParseAnnotationsProfile(t *testing.T) {
+
+	policies, sysctls, invalid := ParseAnnotations(map[string]string{
+		"io.sysbox.fs.profile":             "k8s",
+		"io.sysbox.fs.swaps":               "hidden",
+		"io.sysbox.fs.sysctl.kernel.panic": "0",
+		"io.sysbox.fs.sysctl.kernel.sysrq": "0",
+	})
+
+	if len(invalid) != 0 {
+		t.Errorf("invalid = %v, want none", invalid)
+	}
+
+	// Explicit settings prevail over the profile ones.
+	if p, _ := policies.Lookup("/proc/swaps"); p != ResourcePolicyHide {
+		t.Errorf("/proc/swaps policy = %v, want %v", p, ResourcePolicyHide)
+	}
+	if sysctls["/proc/sys/kernel/panic"] != "0" {
+		t.Errorf("/proc/sys/kernel/panic = %q, want 0", sysctls["/proc/sys/kernel/panic"])
+	}
+
+	// Profile settings are merged with the explicit ones.
+	if p, found := policies.Lookup("/proc/sys/net/bridge/bridge-nf-call-iptables"); !found ||
+		p != ResourcePolicyExpose {
+		t.Errorf("bridge-nf-call-iptables policy = %v, %v", p, found)
+	}
+	if sysctls["/proc/sys/vm/overcommit_memory"] != "1" ||
+		sysctls["/proc/sys/kernel/sysrq"] != "0" {
+		t.Errorf("sysctls = %v", sysctls)
+	}
+	if len(sysctls) != len(K8sProfile.Sysctls)+1 {
+		t.Errorf("sysctls = %v, want %d entries", sysctls, len(K8sProfile.Sysctls)+1)
+	}
+
+	// The profile itself is left untouched.
+	if K8sProfile.Sysctls["/proc/sys/kernel/panic"] != "10" {
+		t.Errorf("k8s profile altered: %v", K8sProfile.Sysctls)
+	}
+
+	_, _, invalid = ParseAnnotations(map[string]string{
+		"io.sysbox.fs.profile": "k8s,openshift",
+	})
+	if !reflect.DeepEqual(invalid, []string{"io.sysbox.fs.profile"}) {
+		t.Errorf("invalid = %v, want [io.sysbox.fs.profile]", invalid)
+	}
+}
+
+func TestParseProfiles(t *testing.T) {
+
+	tests := []struct {
+		val     string
+		want    []*Profile
+		wantErr bool
+	}{
+		{"k8s", []*Profile{K8sProfile}, false},
+		{" k8s , ", []*Profile{K8sProfile}, false},
+		{"k8s,k8s", []*Profile{K8sProfile, K8sProfile}, false},
+		{"", nil, true},
+		{" , ", nil, true},
+		{"K8s", nil, true},
+		{"k8s,openshift", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseProfiles(tt.val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseProfiles(%q) error = %v, wantErr %v", tt.val, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseProfiles(%q) = %v, want %v", tt.val, got, tt.want)
+		}
+	}
+
+	if names := ProfileNames(); !reflect.DeepEqual(names, []string{"k8s"}) {
+		t.Errorf("ProfileNames() = %v, want [k8s]", names)
+	}
+}
+
+func TestProfileMerge(t *testing.T) {
+
+	// Profiles alone (i.e., no other annotations) yield their own settings.
+	policies, sysctls := K8sProfile.merge(nil, nil)
+
+	if !reflect.DeepEqual(policies, K8sProfile.Policies) ||
+		!reflect.DeepEqual(sysctls, K8sProfile.Sysctls) {
+		t.Errorf("merge(nil, nil) = %v, %v", policies, sysctls)
+	}
+
+	// ... which are copies of the profile ones.
+	policies["/proc/swaps"] = ResourcePolicyHide
+	sysctls["/proc/sys/kernel/panic"] = "0"
+
+	if K8sProfile.Policies["/proc/swaps"] != ResourcePolicyExpose ||
+		K8sProfile.Sysctls["/proc/sys/kernel/panic"] != "10" {
+		t.Errorf("k8s profile altered: %v, %v", K8sProfile.Policies, K8sProfile.Sysctls)
+	}
+}
+
+func TestParseBindMounts(t *testing.T) {
+
+	tests := []struct {
+		val     string
+		want    []Mount
+		wantErr bool
+	}{
+		{
+			val: "/proc/uptime:/etc/uptime",
+			want: []Mount{
+				{Source: "/proc/uptime", Target: "/etc/uptime"},
+			},
+		},
+		{
+			val: "/proc/uptime:/etc/uptime, /proc/swaps:/var/lib/swaps/",
+			want: []Mount{
+				{Source: "/proc/uptime", Target: "/etc/uptime"},
+				{Source: "/proc/swaps", Target: "/var/lib/swaps"},
+			},
+		},
+		{val: "", wantErr: true},
+		{val: "/proc/uptime", wantErr: true},
+		{val: "/proc/uptime:etc/uptime", wantErr: true},
+		{val: "/proc/uptime:/", wantErr: true},
+		{val: "/proc/uptime:/etc/uptime:/tmp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBindMounts(tt.val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseBindMounts(%q) error = %v, wantErr %v", tt.val, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseBindMounts(%q) = %v, want %v", tt.val, got, tt.want)
+		}
+	}
+}
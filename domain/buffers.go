@@ -0,0 +1,95 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"sync"
+)
+
+//
+// Pool of byte buffers backing the payloads of FUSE read / write operations.
+// Every read of an emulated resource needs a buffer as large as the one
+// requested by the kernel (typically a few pages), which would otherwise be
+// allocated afresh for every request. On hosts with hundreds of containers
+// polling /proc, this results in a significant GC load.
+//
+// Buffers are grouped in power-of-two size classes. Requests larger than the
+// biggest class are served by regular allocations.
+//
+
+const (
+	minBufferShift = 12 // 4 KiB
+	maxBufferShift = 20 // 1 MiB
+)
+
+var bufferPools [maxBufferShift - minBufferShift + 1]sync.Pool
+
+func init() {
+	for i := range bufferPools {
+		size := 1 << uint(minBufferShift+i)
+		bufferPools[i].New = func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		}
+	}
+}
+
+// Returns the index of the smallest size class fitting the given size, or -1
+// if there's none.
+func bufferClass(size int) int {
+	for i := range bufferPools {
+		if size <= 1<<uint(minBufferShift+i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetBuffer returns a buffer of the given length out of the buffer pool. The
+// buffer must be returned with PutBuffer() once done with it, and its contents
+// must not be referenced past that point.
+func GetBuffer(size int) *[]byte {
+
+	class := bufferClass(size)
+	if class < 0 {
+		buf := make([]byte, size)
+		return &buf
+	}
+
+	buf := bufferPools[class].Get().(*[]byte)
+	*buf = (*buf)[:size]
+
+	return buf
+}
+
+// PutBuffer returns a buffer obtained through GetBuffer() to the buffer pool.
+func PutBuffer(buf *[]byte) {
+
+	if buf == nil {
+		return
+	}
+
+	// Only buffers matching a size class exactly are pooled.
+	c := cap(*buf)
+	class := bufferClass(c)
+	if class < 0 || c != 1<<uint(minBufferShift+class) {
+		return
+	}
+
+	*buf = (*buf)[:c]
+	bufferPools[class].Put(buf)
+}
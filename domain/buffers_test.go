@@ -0,0 +1,59 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+
+	tests := []struct {
+		size    int
+		wantCap int
+	}{
+		{0, 4096},
+		{100, 4096},
+		{4096, 4096},
+		{4097, 8192},
+		{131072, 131072},
+		{1 << 20, 1 << 20},
+		{1<<20 + 1, 1<<20 + 1},
+	}
+
+	for _, tt := range tests {
+		buf := GetBuffer(tt.size)
+		if len(*buf) != tt.size {
+			t.Errorf("GetBuffer(%d): got len %d", tt.size, len(*buf))
+		}
+		if cap(*buf) != tt.wantCap {
+			t.Errorf("GetBuffer(%d): got cap %d, want %d", tt.size, cap(*buf), tt.wantCap)
+		}
+		PutBuffer(buf)
+	}
+
+	// Buffers not obtained from the pool must not make it into the pool.
+	odd := make([]byte, 5000)
+	PutBuffer(&odd)
+	for i := 0; i < 10; i++ {
+		if buf := GetBuffer(5000); cap(*buf) != 8192 {
+			t.Fatalf("GetBuffer(5000): got cap %d, want 8192", cap(*buf))
+		}
+	}
+
+	PutBuffer(nil)
+}
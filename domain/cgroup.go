@@ -0,0 +1,121 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Host mountpoints of the cgroup file-systems. On cgroup v2-only hosts the
+// unified hierarchy is mounted at CgroupMountpoint, whereas on hybrid ones
+// (i.e., cgroup v1 controllers in use too) systemd mounts it at
+// CgroupUnifiedMountpoint, along with the v1 hierarchies at
+// CgroupMountpoint/<controllers>.
+const (
+	CgroupMountpoint        = "/sys/fs/cgroup"
+	CgroupUnifiedMountpoint = "/sys/fs/cgroup/unified"
+)
+
+// ParseCgroupMemberships parses the contents of /proc/<pid>/cgroup. Named
+// cgroup v1 hierarchies (e.g., name=systemd) are skipped.
+func ParseCgroupMemberships(data []byte) []CgroupMembership {
+
+	var res []CgroupMembership
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || strings.HasPrefix(fields[1], "name=") {
+			continue
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		res = append(res, CgroupMembership{
+			Hierarchy:   id,
+			Controllers: fields[1],
+			Path:        fields[2],
+		})
+	}
+
+	return res
+}
+
+// Unified reports whether the membership is to the cgroup v2 hierarchy.
+func (m CgroupMembership) Unified() bool {
+	return m.Hierarchy == 0 && m.Controllers == ""
+}
+
+// HasController reports whether the given controller is attached to the
+// membership's hierarchy.
+func (m CgroupMembership) HasController(name string) bool {
+	for _, c := range strings.Split(m.Controllers, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CgroupV2Only reports whether the given memberships are the ones of a process
+// of a cgroup v2-only host.
+func CgroupV2Only(cgroups []CgroupMembership) bool {
+
+	for _, m := range cgroups {
+		if !m.Unified() {
+			return false
+		}
+	}
+
+	return len(cgroups) > 0
+}
+
+// LookupCgroup returns the membership to the hierarchy the given controller is
+// attached to, along with the host mountpoint of that hierarchy. cgroup v1
+// hierarchies take precedence; the unified hierarchy is picked otherwise (or
+// for an empty controller), which makes the lookup backend-agnostic.
+func LookupCgroup(
+	cgroups []CgroupMembership,
+	controller string) (CgroupMembership, string, bool) {
+
+	var (
+		unified CgroupMembership
+		found   bool
+	)
+
+	for _, m := range cgroups {
+		if m.Unified() {
+			unified, found = m, true
+			continue
+		}
+		if controller != "" && m.HasController(controller) {
+			return m, filepath.Join(CgroupMountpoint, m.Controllers), true
+		}
+	}
+
+	if !found {
+		return CgroupMembership{}, "", false
+	}
+
+	if CgroupV2Only(cgroups) {
+		return unified, CgroupMountpoint, true
+	}
+
+	return unified, CgroupUnifiedMountpoint, true
+}
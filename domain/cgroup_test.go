@@ -0,0 +1,62 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import "testing"
+
+func TestLookupCgroup(t *testing.T) {
+
+	hybrid := ParseCgroupMemberships([]byte(
+		"12:cpu,cpuacct:/sysbox/c1\n" +
+			"5:memory:/sysbox/c1\n" +
+			"1:name=systemd:/sysbox/c1\n" +
+			"0::/sysbox/c1/init\n"))
+
+	unified := ParseCgroupMemberships([]byte("0::/sysbox/c2/init.scope\n"))
+
+	legacy := ParseCgroupMemberships([]byte("5:memory:/sysbox/c3\n"))
+
+	if CgroupV2Only(hybrid) || !CgroupV2Only(unified) || CgroupV2Only(legacy) {
+		t.Errorf("CgroupV2Only() misdetected the host's cgroup setup")
+	}
+
+	var tests = []struct {
+		cgroups    []CgroupMembership
+		controller string
+		path       string
+		root       string
+		found      bool
+	}{
+		{hybrid, "cpuacct", "/sysbox/c1", "/sys/fs/cgroup/cpu,cpuacct", true},
+		{hybrid, "memory", "/sysbox/c1", "/sys/fs/cgroup/memory", true},
+		{hybrid, "pids", "/sysbox/c1/init", "/sys/fs/cgroup/unified", true},
+		{hybrid, "", "/sysbox/c1/init", "/sys/fs/cgroup/unified", true},
+		{unified, "memory", "/sysbox/c2/init.scope", "/sys/fs/cgroup", true},
+		{unified, "", "/sysbox/c2/init.scope", "/sys/fs/cgroup", true},
+		{legacy, "memory", "/sysbox/c3", "/sys/fs/cgroup/memory", true},
+		{legacy, "pids", "", "", false},
+		{nil, "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		m, root, found := LookupCgroup(tt.cgroups, tt.controller)
+		if found != tt.found || m.Path != tt.path || root != tt.root {
+			t.Errorf("LookupCgroup(%v, %q) = %v, %q, %v; want %q, %q, %v",
+				tt.cgroups, tt.controller, m, root, found, tt.path, tt.root, tt.found)
+		}
+	}
+}
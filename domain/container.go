@@ -17,6 +17,7 @@
 package domain
 
 import (
+	"os"
 	"time"
 
 	libpidfd "github.com/nestybox/sysbox-libs/pidfd"
@@ -35,9 +36,18 @@ type ContainerIface interface {
 	Ctime() time.Time
 	Data(name string, offset int64, data *[]byte) (int, error)
 	UID() uint32
+	UidSize() uint32
 	GID() uint32
+	GidSize() uint32
 	ProcRoPaths() []string
 	ProcMaskPaths() []string
+	Annotations() map[string]string
+	ResourcePolicy(path string) (ResourcePolicy, bool)
+	IsReadOnlyPath(path string) bool
+	NodeAttr(path string) (NodeAttr, bool)
+	Metadata() ContainerMetadata
+	WriteLimiter() *RateLimiter
+	ValidateUserNs(pid uint32) error
 	InitProc() ProcessIface
 	ExtractInode(path string) (Inode, error)
 	IsMountInfoInitialized() bool
@@ -56,6 +66,9 @@ type ContainerIface interface {
 	//
 	SetData(name string, offset int64, data []byte) error
 	SetInitProc(pid, uid, gid uint32) error
+	SetReadOnlyPath(path string, ro bool)
+	SetNodeAttr(path string, attr NodeAttr)
+	SetMetadata(md ContainerMetadata)
 	//
 	// Locks for read-modify-write operations on container data via the Data()
 	// and SetData() methods.
@@ -64,6 +77,24 @@ type ContainerIface interface {
 	Unlock()
 }
 
+// Mode & ownership of an emulated node as altered within a sys container (i.e.,
+// chmod() / chown()). Ids are host ids.
+type NodeAttr struct {
+	Mode os.FileMode `json:"mode"` // permission bits
+	Uid  uint32      `json:"uid"`
+	Gid  uint32      `json:"gid"`
+}
+
+// Attributes of a sys container as known by its container manager (e.g.,
+// containerd), for informational purposes (i.e., logs) and for the matching of
+// the label-scoped resource policies.
+type ContainerMetadata struct {
+	Namespace string            `json:"namespace"` // container manager's namespace (e.g., "k8s.io")
+	Name      string            `json:"name"`
+	Image     string            `json:"image"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
 //
 // ContainerStateService interface defines the APIs that sysbox-fs components
 // must utilize to interact with the sysbox-fs state-storage backend.
@@ -73,7 +104,8 @@ type ContainerStateServiceIface interface {
 		fss FuseServerServiceIface,
 		prs ProcessServiceIface,
 		ios IOServiceIface,
-		mts MountServiceIface)
+		mts MountServiceIface,
+		hds HandlerServiceIface)
 
 	ContainerCreate(
 		id string,
@@ -85,6 +117,7 @@ type ContainerStateServiceIface interface {
 		gidSize uint32,
 		procRoPaths []string,
 		procMaskPaths []string,
+		annotations map[string]string,
 		service ContainerStateServiceIface) ContainerIface
 
 	ContainerPreRegister(id, netns string) error
@@ -96,4 +129,5 @@ type ContainerStateServiceIface interface {
 	ProcessService() ProcessServiceIface
 	MountService() MountServiceIface
 	ContainerDBSize() int
+	WatchRuntimeEvents(socket string, cleanup bool)
 }
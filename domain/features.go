@@ -0,0 +1,111 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"sync"
+)
+
+//
+// Kernel features sysbox-fs relies upon. These are probed once at start-up (see
+// SetKernelFeatures()), and the outcome is consulted by the subsystems making
+// use of them, which fall back to a degraded mode of operation when a feature
+// is missing, rather than failing at runtime. The outcome is also reported in
+// the logs and through the debug server (/kernel/features endpoint).
+//
+
+type KernelFeature string
+
+const (
+	// Seccomp user notifications (kernel 5.0+).
+	KernelFeatureSeccompNotify KernelFeature = "seccomp-notify"
+
+	// Seccomp notifications of unused filters (kernel 5.8+).
+	KernelFeatureSeccompNotifyUnused KernelFeature = "seccomp-notify-unused"
+
+	// FUSE file-system and /dev/fuse device.
+	KernelFeatureFuse KernelFeature = "fuse"
+
+	// openat2() syscall (kernel 5.6+).
+	KernelFeatureOpenat2 KernelFeature = "openat2"
+
+	// pidfd_open() syscall (kernel 5.3+).
+	KernelFeaturePidfd KernelFeature = "pidfd"
+
+	// process_vm_readv() syscall.
+	KernelFeatureProcessVmReadv KernelFeature = "process-vm-readv"
+
+	// ID-mapped mounts, i.e., mount_setattr() syscall (kernel 5.12+).
+	KernelFeatureIdmappedMounts KernelFeature = "idmapped-mounts"
+)
+
+// Outcome of the probing of a kernel feature.
+type KernelFeatureStatus struct {
+	Feature   KernelFeature `json:"feature"`
+	Supported bool          `json:"supported"`
+	Required  bool          `json:"required"`           // sysbox-fs can't operate without it
+	Fallback  string        `json:"fallback,omitempty"` // degraded behavior when missing
+	Error     string        `json:"error,omitempty"`    // probing error, if any
+}
+
+// Degraded behavior of sysbox-fs when each of the (optional) kernel features
+// is missing.
+var KernelFeatureFallbacks = map[KernelFeature]string{
+	KernelFeatureSeccompNotify:       "syscall emulation (e.g., mount, umount, chown) disabled",
+	KernelFeatureSeccompNotifyUnused: "seccomp sessions tracked through the tracees' pidfds",
+	KernelFeatureOpenat2:             "procfs symlinks resolved by path",
+	KernelFeaturePidfd:               "process liveness tracked through start-times only",
+	KernelFeatureProcessVmReadv:      "tracees' memory read through procfs",
+	KernelFeatureIdmappedMounts:      "id-mapped mounts not supported",
+}
+
+var (
+	kernelFeaturesMu sync.RWMutex
+	kernelFeatures   []KernelFeatureStatus
+)
+
+// SetKernelFeatures records the outcome of the kernel features' probing.
+func SetKernelFeatures(statuses []KernelFeatureStatus) {
+	kernelFeaturesMu.Lock()
+	defer kernelFeaturesMu.Unlock()
+
+	kernelFeatures = append([]KernelFeatureStatus(nil), statuses...)
+}
+
+// KernelFeatures returns the outcome of the kernel features' probing.
+func KernelFeatures() []KernelFeatureStatus {
+	kernelFeaturesMu.RLock()
+	defer kernelFeaturesMu.RUnlock()
+
+	return append([]KernelFeatureStatus(nil), kernelFeatures...)
+}
+
+// KernelFeatureSupported reports whether the given kernel feature is supported.
+// Features that haven't been probed are deemed supported, so that their users
+// attempt to make use of them (and deal with their absence at runtime).
+func KernelFeatureSupported(f KernelFeature) bool {
+	kernelFeaturesMu.RLock()
+	defer kernelFeaturesMu.RUnlock()
+
+	for _, s := range kernelFeatures {
+		if s.Feature == f {
+			return s.Supported
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,47 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import "testing"
+
+func TestKernelFeatureSupported(t *testing.T) {
+
+	defer SetKernelFeatures(nil)
+
+	// Unprobed features are deemed supported.
+	if !KernelFeatureSupported(KernelFeaturePidfd) {
+		t.Errorf("unprobed feature reported as unsupported")
+	}
+
+	SetKernelFeatures([]KernelFeatureStatus{
+		{Feature: KernelFeaturePidfd, Supported: false},
+		{Feature: KernelFeatureOpenat2, Supported: true},
+	})
+
+	if KernelFeatureSupported(KernelFeaturePidfd) {
+		t.Errorf("%s reported as supported", KernelFeaturePidfd)
+	}
+	if !KernelFeatureSupported(KernelFeatureOpenat2) {
+		t.Errorf("%s reported as unsupported", KernelFeatureOpenat2)
+	}
+	if !KernelFeatureSupported(KernelFeatureIdmappedMounts) {
+		t.Errorf("%s reported as unsupported", KernelFeatureIdmappedMounts)
+	}
+	if n := len(KernelFeatures()); n != 2 {
+		t.Errorf("KernelFeatures() returned %d entries, want 2", n)
+	}
+}
@@ -16,6 +16,8 @@
 
 package domain
 
+import "time"
+
 type FuseServerServiceIface interface {
 	Setup(
 		mp string,
@@ -26,16 +28,28 @@ type FuseServerServiceIface interface {
 	CreateFuseServer(serveCntr, stateCntr ContainerIface) error
 	DestroyFuseServer(mp string) error
 	DestroyFuseService()
+	DrainFuseService(timeout time.Duration) error
 	FuseServerCntrRegComplete(cntr ContainerIface) error
+	FuseServerStats(cntrId string) (*FuseServerStats, error)
+	FuseServersStats() map[string]*FuseServerStats
 }
 
 type FuseServerIface interface {
 	Create() error
 	Run() error
 	Destroy() error
+	Drain(timeout time.Duration) error
 	MountPoint() string
 	Unmount()
 	InitWait()
 	SetCntrRegComplete()
 	IsCntrRegCompleted() bool
+	Stats() *FuseServerStats
+}
+
+// FuseServerStats holds the number of operations (and errors) served by a
+// fuse-server, indexed by FUSE operation name.
+type FuseServerStats struct {
+	Ops    map[string]uint64 `json:"ops"`
+	Errors map[string]uint64 `json:"errors"`
 }
@@ -19,6 +19,7 @@ package domain
 import (
 	"os"
 	"sync"
+	"time"
 )
 
 // HandlerBase is a type common to all the handlers.
@@ -36,6 +37,11 @@ import (
 //
 // The handler resources being emulated are stored within a map indexed by the
 // resource name.
+//
+// HandlerBase also implements HandlerIface, serving the emulated resources out
+// of their EmuResource and delegating the remaining nodes to the pass-through
+// handler. Handlers embedding it only need to implement the operations that
+// require custom logic.
 type HandlerBase struct {
 	// Camel-case representation of every handler path.
 	Name string
@@ -49,10 +55,26 @@ type HandlerBase struct {
 
 	Enabled bool
 
+	// Write mode of the emulated resources (write-back by default). Nodes that
+	// are passed through are always written through.
+	WriteMode WriteMode
+
 	// Pointer to the parent handler service.
 	Service HandlerServiceIface
 }
 
+// WriteMode defines when the writes of a node are handed over to its handler.
+type WriteMode int
+
+const (
+	// Writes at offset zero are committed right away; subsequent partial writes
+	// are merged, and the resulting values are committed upon flush.
+	WriteModeBack WriteMode = iota
+
+	// Every write is handed over right away, at its offset.
+	WriteModeThrough
+)
+
 type EmuResourceType int
 
 const (
@@ -68,13 +90,50 @@ const (
 // the same sys container or across different sys containers are accessing the
 // same sysbox-fs emulated resource). By relying on a per-resource "mutex", and
 // not a per-handler one, we are maximizing the level of concurrency that can be
-// attained.
+// attained. Furthermore, the "mutex" is a reader/writer one: reads of a
+// resource don't serialize among themselves, and only writes of that same
+// resource can hold them back.
+//
+// Resources can also declare the following capabilities, which are enforced by
+// the handler service on behalf of their handlers:
+//
+// * ReadOnly: writes are rejected (EPERM), and so are opens for writing.
+//
+// * Range: numeric writes must fall within the given range. Values outside of
+// it are either rejected (EINVAL) or clamped to it.
+//
+// * Schema: writes must conform to the given value schema (see ValueSchema).
+// Non-conforming values are rejected (EINVAL), as the kernel does.
+//
+// * Namespaced: the resource is namespaced by the kernel, so it's served as seen
+// within the namespaces of the requester (i.e., by the pass-through handler).
+//
+// * Static: the resource's contents don't change during the lifetime of the
+// container, so they're obtained from the handler once, and served out of the
+// container's data thereafter.
 type EmuResource struct {
-	Kind    EmuResourceType
-	Mode    os.FileMode
-	Size    int64
-	Enabled bool
-	Mutex   sync.Mutex
+	Kind       EmuResourceType
+	Mode       os.FileMode
+	Size       int64
+	Enabled    bool
+	Mutex      sync.RWMutex
+	ReadOnly   bool
+	Range      *EmuResourceRange
+	Schema     ValueSchema
+	Namespaced bool
+	Static     bool
+
+	// Hooks serving the resource through HandlerBase's default operations.
+	// Resources lacking them are passed through.
+	Read  EmuResourceHook
+	Write EmuResourceHook
+}
+
+// EmuResourceRange defines the values accepted by a numeric resource.
+type EmuResourceRange struct {
+	Min   int64
+	Max   int64
+	Clamp bool // clamp values out of range instead of rejecting them
 }
 
 // HandlerRequest represents a request to be processed by a handler
@@ -92,7 +151,30 @@ type HandlerRequest struct {
 	Container   ContainerIface
 }
 
-// HandlerIface is the interface that each handler must implement
+// HandlerIface is the interface that each handler must implement.
+//
+// A handler serves the FS operations over the path returned by GetPath() as
+// well as over all of its descendants, except for the ones served by more
+// specific handlers. Handlers are expected to honor the following contract:
+//
+//   - Operations are invoked concurrently, for the same or different nodes and
+//     containers. Accesses to host resources must be serialized through the
+//     per-resource lock returned by GetResourceMutex().
+//   - Nodes that are not emulated by the handler must be delegated to the
+//     pass-through handler (GetService().GetPassThroughHandler()), which serves
+//     them as seen within the namespaces of the requester.
+//   - Read() copies the node's contents, starting at req.Offset, into req.Data,
+//     and returns the number of bytes copied. req.Data may be replaced by a
+//     different buffer, but the original one must not be retained past the call.
+//   - Write() stores req.Data into the node, starting at req.Offset. Unless
+//     the node is written through (see HandlerWriteModeIface), partial writes
+//     are merged by the FUSE layer, so that handlers are handed whole values
+//     (i.e., at offset zero) to validate and commit.
+//   - Failures are reported through fuse.IOerror values carrying the errno to
+//     return to the requester.
+//
+// Handlers may also implement the HandlerInitIface and HandlerFiniIface
+// interfaces to be notified of their (un)registration.
 type HandlerIface interface {
 	// FS operations.
 	Open(node IOnodeIface, req *HandlerRequest) error
@@ -109,13 +191,49 @@ type HandlerIface interface {
 	GetService() HandlerServiceIface
 	SetService(hs HandlerServiceIface)
 	GetResourcesList() []string
-	GetResourceMutex(node IOnodeIface) *sync.Mutex
+	GetResourceMutex(node IOnodeIface) *sync.RWMutex
+}
+
+// HandlerInitIface is optionally implemented by handlers requiring some
+// initialization once registered (i.e., once their handler service is set).
+// Handlers failing to initialize are not registered.
+type HandlerInitIface interface {
+	Init() error
+}
+
+// HandlerResourceIface is optionally implemented by handlers whose resources
+// declare capabilities to be enforced by the handler service (see EmuResource).
+// It's provided by HandlerBase to all the handlers embedding it.
+type HandlerResourceIface interface {
+	GetResource(n IOnodeIface) (*EmuResource, bool)
+}
+
+// HandlerWriteModeIface is optionally implemented by handlers to define the
+// write mode of their nodes (nodes of the handlers not implementing it are
+// written back). It's provided by HandlerBase to all the handlers embedding it.
+type HandlerWriteModeIface interface {
+	GetWriteMode(n IOnodeIface) WriteMode
+}
+
+// HandlerPolicyIface is optionally implemented by handlers enforcing resource
+// policies, to report the one applying to a node within the given container.
+// Unlike GetResource() and GetWriteMode(), which only honor the daemon-wide
+// policies, it accounts for the label-scoped and per-container ones as well.
+type HandlerPolicyIface interface {
+	GetPolicy(n IOnodeIface, c ContainerIface) ResourcePolicy
+}
+
+// HandlerFiniIface is optionally implemented by handlers requiring some
+// cleanup once unregistered.
+type HandlerFiniIface interface {
+	Fini()
 }
 
 type HandlerServiceIface interface {
 	Setup(
 		hdlrs []HandlerIface,
 		ignoreErrors bool,
+		dryRun bool,
 		css ContainerStateServiceIface,
 		nss NSenterServiceIface,
 		prs ProcessServiceIface,
@@ -137,6 +255,20 @@ type HandlerServiceIface interface {
 	NSenterService() NSenterServiceIface
 	IOService() IOServiceIface
 	IgnoreErrors() bool
+	DryRun() bool
+
+	// Resource policies.
+	SetResourcePolicies(
+		policies map[string]ResourcePolicy,
+		labeled []LabeledResourcePolicies)
+	GetResourcePolicy(path string) ResourcePolicy
+
+	// Validation of the values stored into emulated resources.
+	CheckResourceValue(path string, data []byte) ([]byte, error)
+
+	// Handler statistics.
+	RecordHandlerStats(name string, op HandlerOp, latency time.Duration, err error)
+	HandlersStats() map[string]map[HandlerOp]*HandlerOpStats
 
 	// Auxiliar methods.
 	HostUserNsInode() Inode
@@ -144,3 +276,49 @@ type HandlerServiceIface interface {
 	HostUuid() string
 	FindHostUuid() (string, error)
 }
+
+// ResourcePolicy defines how an emulated resource (and its descendants) is
+// exposed within sys containers.
+type ResourcePolicy int
+
+const (
+	ResourcePolicyExpose      ResourcePolicy = iota // served by its handler (default)
+	ResourcePolicyHide                              // not visible (ENOENT)
+	ResourcePolicyReadOnly                          // visible but not writable
+	ResourcePolicyPassthrough                       // served by the passthrough handler
+)
+
+// HandlerOp identifies the file-system operations being served by handlers.
+type HandlerOp string
+
+const (
+	HandlerOpLookup     HandlerOp = "Lookup"
+	HandlerOpOpen       HandlerOp = "Open"
+	HandlerOpRead       HandlerOp = "Read"
+	HandlerOpWrite      HandlerOp = "Write"
+	HandlerOpReadDirAll HandlerOp = "ReadDirAll"
+)
+
+// Upper bounds of the latency-histogram buckets kept for each handler
+// operation. An additional (implicit) bucket accounts for all the operations
+// exceeding the last bound.
+var HandlerLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+// HandlerOpStats holds the statistics accumulated for a given handler operation.
+type HandlerOpStats struct {
+	Count        uint64        `json:"count"`
+	Errors       uint64        `json:"errors"`
+	TotalLatency time.Duration `json:"totalLatency"`
+	MaxLatency   time.Duration `json:"maxLatency"`
+	Histogram    []uint64      `json:"histogram"`
+}
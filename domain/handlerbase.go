@@ -0,0 +1,207 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//
+// Default implementation of the HandlerIface methods.
+//
+// Nodes that are not emulated by the handler are delegated to the pass-through
+// handler, whereas the emulated ones (see EmuResourceMap) are served out of the
+// metadata and hooks of their EmuResource. Handlers embedding HandlerBase thus
+// only need to implement the operations requiring custom logic, and can
+// delegate the remaining nodes to these default ones (e.g., h.HandlerBase.Read()).
+//
+
+// EmuResourceHook serves a read or write operation over an emulated resource.
+type EmuResourceHook func(h HandlerIface, n IOnodeIface, req *HandlerRequest) (int, error)
+
+// GetResource returns the emulated resource matching the given node, which is
+// looked up by its path relative to the handler's one (e.g., "." for the
+// handler's node itself), or by its name otherwise.
+func (h *HandlerBase) GetResource(n IOnodeIface) (*EmuResource, bool) {
+
+	if relpath, err := filepath.Rel(h.Path, n.Path()); err == nil {
+		if resource, ok := h.EmuResourceMap[relpath]; ok {
+			return resource, true
+		}
+	}
+
+	resource, ok := h.EmuResourceMap[n.Name()]
+
+	return resource, ok
+}
+
+// GetWriteMode returns the handler's write mode for emulated nodes, and the
+// write-through mode for the nodes being passed through.
+func (h *HandlerBase) GetWriteMode(n IOnodeIface) WriteMode {
+
+	if _, ok := h.GetResource(n); ok {
+		return h.WriteMode
+	}
+
+	return WriteModeThrough
+}
+
+func (h *HandlerBase) passThrough() HandlerIface {
+	return h.Service.GetPassThroughHandler()
+}
+
+func (h *HandlerBase) Lookup(n IOnodeIface, req *HandlerRequest) (os.FileInfo, error) {
+
+	resource, ok := h.GetResource(n)
+	if !ok {
+		return h.passThrough().Lookup(n, req)
+	}
+
+	// Return an artificial fileInfo for the emulated nodes.
+	info := &FileInfo{
+		Fname:    n.Name(),
+		Fsize:    resource.Size,
+		Fmode:    resource.Mode,
+		FmodTime: time.Now(),
+		FisDir:   resource.Kind == DirEmuResource,
+	}
+
+	return info, nil
+}
+
+func (h *HandlerBase) Open(n IOnodeIface, req *HandlerRequest) error {
+
+	if _, ok := h.GetResource(n); ok {
+		return nil
+	}
+
+	return h.passThrough().Open(n, req)
+}
+
+func (h *HandlerBase) Read(n IOnodeIface, req *HandlerRequest) (int, error) {
+
+	if resource, ok := h.GetResource(n); ok && resource.Read != nil {
+		return resource.Read(h, n, req)
+	}
+
+	return h.passThrough().Read(n, req)
+}
+
+func (h *HandlerBase) Write(n IOnodeIface, req *HandlerRequest) (int, error) {
+
+	if resource, ok := h.GetResource(n); ok && resource.Write != nil {
+		return resource.Write(h, n, req)
+	}
+
+	return h.passThrough().Write(n, req)
+}
+
+// ReadDirAll returns the entries seen within the container's namespaces along
+// with the emulated ones (which prevail over the former).
+func (h *HandlerBase) ReadDirAll(n IOnodeIface, req *HandlerRequest) ([]os.FileInfo, error) {
+
+	usualEntries, err := h.passThrough().ReadDirAll(n, req)
+
+	relpath, relErr := filepath.Rel(h.Path, n.Path())
+	if relErr != nil {
+		return usualEntries, err
+	}
+
+	var fileEntries []os.FileInfo
+
+	for k, v := range h.EmuResourceMap {
+		if k == "." || filepath.Dir(k) != relpath {
+			continue
+		}
+
+		v.Mutex.RLock()
+		enabled := v.Enabled
+		v.Mutex.RUnlock()
+		if !enabled {
+			continue
+		}
+
+		fileEntries = append(fileEntries, &FileInfo{
+			Fname:    filepath.Base(k),
+			Fsize:    v.Size,
+			Fmode:    v.Mode,
+			FmodTime: time.Now(),
+			FisDir:   v.Kind == DirEmuResource,
+		})
+	}
+
+	if len(fileEntries) == 0 {
+		return usualEntries, err
+	}
+
+	return FileInfoSliceUniquify(append(fileEntries, usualEntries...)), nil
+}
+
+func (h *HandlerBase) GetName() string {
+	return h.Name
+}
+
+func (h *HandlerBase) GetPath() string {
+	return h.Path
+}
+
+func (h *HandlerBase) GetService() HandlerServiceIface {
+	return h.Service
+}
+
+func (h *HandlerBase) GetEnabled() bool {
+	return h.Enabled
+}
+
+func (h *HandlerBase) SetEnabled(b bool) {
+	h.Enabled = b
+}
+
+func (h *HandlerBase) SetService(hs HandlerServiceIface) {
+	h.Service = hs
+}
+
+func (h *HandlerBase) GetResourcesList() []string {
+
+	var resources []string
+
+	for resourceKey, resource := range h.EmuResourceMap {
+		resource.Mutex.RLock()
+		if !resource.Enabled {
+			resource.Mutex.RUnlock()
+			continue
+		}
+		resource.Mutex.RUnlock()
+
+		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
+	}
+
+	return resources
+}
+
+func (h *HandlerBase) GetResourceMutex(n IOnodeIface) *sync.RWMutex {
+
+	resource, ok := h.GetResource(n)
+	if !ok {
+		return nil
+	}
+
+	return &resource.Mutex
+}
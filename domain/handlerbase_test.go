@@ -0,0 +1,60 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// IOnode stub exposing just the node's name & path.
+type pathNode struct {
+	IOnodeIface
+	path string
+}
+
+func (n *pathNode) Name() string { return filepath.Base(n.path) }
+func (n *pathNode) Path() string { return n.path }
+
+func TestHandlerBaseWriteMode(t *testing.T) {
+
+	h := &HandlerBase{
+		Path: "/proc/sys/net",
+		EmuResourceMap: map[string]*EmuResource{
+			"core/somaxconn": {Kind: FileEmuResource},
+		},
+	}
+
+	tests := []struct {
+		path string
+		mode WriteMode
+		want WriteMode
+	}{
+		{"/proc/sys/net/core/somaxconn", WriteModeBack, WriteModeBack},
+		{"/proc/sys/net/core/somaxconn", WriteModeThrough, WriteModeThrough},
+		{"/proc/sys/net/core/rmem_max", WriteModeBack, WriteModeThrough},
+		{"/proc/sys/net/core/rmem_max", WriteModeThrough, WriteModeThrough},
+	}
+
+	for _, tt := range tests {
+		h.WriteMode = tt.mode
+		if got := h.GetWriteMode(&pathNode{path: tt.path}); got != tt.want {
+			t.Errorf("GetWriteMode(%s) with mode %v = %v, want %v",
+				tt.path, tt.mode, got, tt.want)
+		}
+	}
+}
@@ -56,6 +56,7 @@ type IOnodeIface interface {
 	ReadDirAll() ([]os.FileInfo, error)
 	ReadFile() ([]byte, error)
 	ReadLine() (string, error)
+	ReadLink() (string, error)
 	WriteAt(p []byte, off int64) (n int, err error)
 	WriteFile(p []byte) error
 	Mkdir() error
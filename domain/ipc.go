@@ -21,6 +21,7 @@ type IpcServiceIface interface {
 		css ContainerStateServiceIface,
 		prs ProcessServiceIface,
 		ios IOServiceIface,
+		hds HandlerServiceIface,
 		fuseMp string)
 
 	Init() error
@@ -0,0 +1,96 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"sync/atomic"
+)
+
+//
+// Self-imposed resource limits: as opposed to the kernel-enforced ones, these
+// are enforced by sysbox-fs itself, which throttles its own activity (i.e.,
+// FUSE request intake, nsenter requests) when approaching them. This way, a
+// runaway workload degrades the emulation of the container generating it,
+// rather than exhausting sysbox-fs' resources.
+//
+// As these values are shared by all sysbox-fs services, they are accessed
+// atomically.
+//
+
+// Max number of concurrent nsenter requests; 0 == unlimited.
+var maxNSenterProcs int32
+
+// Max number of file handles opened by each sys container on sysbox-fs' nodes;
+// 0 == unlimited.
+var maxCntrHandles int32
+
+// Set while any of sysbox-fs' resources (goroutines, fds, memory) is beyond
+// its limit.
+var resourcePressure int32
+
+// SetMaxNSenterProcs sets the max number of concurrent nsenter requests.
+func SetMaxNSenterProcs(n int) {
+	atomic.StoreInt32(&maxNSenterProcs, int32(n))
+}
+
+// MaxNSenterProcs returns the max number of concurrent nsenter requests.
+func MaxNSenterProcs() int {
+	return int(atomic.LoadInt32(&maxNSenterProcs))
+}
+
+// SetMaxCntrHandles sets the max number of file handles opened by each sys
+// container.
+func SetMaxCntrHandles(n int) {
+	atomic.StoreInt32(&maxCntrHandles, int32(n))
+}
+
+// MaxCntrHandles returns the max number of file handles opened by each sys
+// container.
+func MaxCntrHandles() int {
+	return int(atomic.LoadInt32(&maxCntrHandles))
+}
+
+// SetResourcePressure flags whether sysbox-fs is under resource pressure.
+func SetResourcePressure(pressure bool) {
+	var val int32
+	if pressure {
+		val = 1
+	}
+	atomic.StoreInt32(&resourcePressure, val)
+}
+
+// ResourcePressure reports whether sysbox-fs is under resource pressure, in
+// which case new requests should be held back.
+func ResourcePressure() bool {
+	return atomic.LoadInt32(&resourcePressure) == 1
+}
+
+// Share (percentage) of the host's user-namespace limits (/proc/sys/user/*)
+// granted by default to each sys container.
+var userNsLimitsShare int32 = 100
+
+// SetUserNsLimitsShare sets the share (percentage) of the host's user-namespace
+// limits granted to each sys container.
+func SetUserNsLimitsShare(share int) {
+	atomic.StoreInt32(&userNsLimitsShare, int32(share))
+}
+
+// UserNsLimitsShare returns the share (percentage) of the host's user-namespace
+// limits granted to each sys container.
+func UserNsLimitsShare() int {
+	return int(atomic.LoadInt32(&userNsLimitsShare))
+}
@@ -0,0 +1,86 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//
+// LSM labeling of the objects created by sysbox-fs on behalf of a container.
+//
+// Under SELinux, objects created by sysbox-fs (i.e., by the nsenter process
+// executing a container's request) would otherwise inherit sysbox-fs' own
+// context, and confined workloads within the container would be later denied
+// access to them. Hence, the file-systems mounted on behalf of the container
+// are labeled through the "context=" mount option, and the files created along
+// the way (e.g., overlayfs work dirs) through the process' fscreate attribute,
+// both set to the container's mount label (see MountLabelAnnotation).
+//
+// AppArmor mediates accesses by path rather than through object labels, so no
+// labeling is required in that case.
+//
+
+// MountLabel returns the SELinux mount label of the given container (if any).
+func MountLabel(c ContainerIface) string {
+	return c.Annotations()[MountLabelAnnotation]
+}
+
+// ValidateMountLabel checks that the given label is a well-formed SELinux
+// context (i.e., "user:role:type[:level]").
+func ValidateMountLabel(label string) error {
+
+	if len(strings.SplitN(label, ":", 4)) < 3 {
+		return fmt.Errorf("invalid selinux context %q", label)
+	}
+
+	for _, r := range label {
+		if r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return fmt.Errorf("invalid selinux context %q", label)
+		}
+	}
+
+	return nil
+}
+
+// FormatMountLabel returns the mount data with the given label applied as the
+// context of the file-system to mount. Data already specifying a context is
+// left untouched.
+func FormatMountLabel(data, label string) string {
+
+	if label == "" {
+		return data
+	}
+
+	for _, opt := range strings.Split(data, ",") {
+		if strings.HasPrefix(opt, "context=") ||
+			strings.HasPrefix(opt, "fscontext=") ||
+			strings.HasPrefix(opt, "defcontext=") ||
+			strings.HasPrefix(opt, "rootcontext=") {
+			return data
+		}
+	}
+
+	ctx := fmt.Sprintf("context=%q", label)
+	if data == "" {
+		return ctx
+	}
+
+	return data + "," + ctx
+}
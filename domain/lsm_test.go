@@ -0,0 +1,66 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import "testing"
+
+func TestValidateMountLabel(t *testing.T) {
+
+	tests := []struct {
+		label string
+		valid bool
+	}{
+		{"system_u:object_r:container_file_t:s0:c1,c2", true},
+		{"system_u:object_r:container_file_t", true},
+		{"container_file_t", false},
+		{"system_u:object_r", false},
+		{`system_u:object_r:container_file_t:s0",nosuid`, false},
+		{"system_u:object_r:container_file_t s0", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateMountLabel(tt.label); (err == nil) != tt.valid {
+			t.Errorf("ValidateMountLabel(%q) = %v, want valid = %v",
+				tt.label, err, tt.valid)
+		}
+	}
+}
+
+func TestFormatMountLabel(t *testing.T) {
+
+	label := "system_u:object_r:container_file_t:s0:c1,c2"
+
+	tests := []struct {
+		data  string
+		label string
+		want  string
+	}{
+		{"", label, `context="system_u:object_r:container_file_t:s0:c1,c2"`},
+		{"lowerdir=/a,upperdir=/b,workdir=/c", label,
+			`lowerdir=/a,upperdir=/b,workdir=/c,context="system_u:object_r:container_file_t:s0:c1,c2"`},
+		{`rw,context="system_u:object_r:tmp_t:s0"`, label,
+			`rw,context="system_u:object_r:tmp_t:s0"`},
+		{"lowerdir=/a", "", "lowerdir=/a"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatMountLabel(tt.data, tt.label); got != tt.want {
+			t.Errorf("FormatMountLabel(%q, %q) = %q, want %q",
+				tt.data, tt.label, got, tt.want)
+		}
+	}
+}
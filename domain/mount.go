@@ -33,18 +33,26 @@ type MountServiceIface interface {
 
 	NewMountHelper() MountHelperIface
 	MountHelper() MountHelperIface
+
+	TrackMounts(c ContainerIface) error
+	UntrackMounts(c ContainerIface)
+	BindMounts(c ContainerIface) error
+	UnbindMounts(c ContainerIface)
+	RemountSysboxfs(c ContainerIface, mountpoint string) error
 }
 
 // Interface to define the mountInfoParser api.
 type MountInfoParserIface interface {
 	GetProcessID() uint32
 	GetInfo(mountpoint string) *MountInfo
+	GetMountOf(path string) *MountInfo
 	GetParentMount(info *MountInfo) *MountInfo
 	LookupByMountID(id int) *MountInfo
 	LookupByMountpoint(mp string) *MountInfo
 	IsSysboxfsBaseMount(mountpoint string) bool
 	IsSysboxfsBaseRoMount(mountpoint string) bool
 	IsSysboxfsSubmount(mountpoint string) bool
+	IsSysboxfsFuseMount(mountpoint string) bool
 	IsSysboxfsRoSubmount(mountpoint string) bool
 	IsSysboxfsMaskedSubmount(mountpoint string) bool
 	GetSysboxfsSubMounts(basemount string) []string
@@ -55,6 +63,8 @@ type MountInfoParserIface interface {
 	IsRoMount(info *MountInfo) bool
 	IsBindMount(info *MountInfo) bool
 	IsRoBindMount(info *MountInfo) bool
+	IsIDMappedMount(info *MountInfo) bool
+	IsShiftfsMount(info *MountInfo) bool
 	IsCloneMount(info *MountInfo, readonly bool) bool
 	ExtractMountInfo() ([]byte, error)
 	ExtractInode(mp string) (Inode, error)
@@ -16,6 +16,8 @@
 
 package domain
 
+import "os"
+
 // Aliases to leverage strong-typing.
 type NStype = string
 type NSenterMsgType = string
@@ -66,6 +68,8 @@ var AllNSsButUser = []NStype{
 const (
 	LookupRequest              NSenterMsgType = "lookupRequest"
 	LookupResponse             NSenterMsgType = "lookupResponse"
+	LookupBatchRequest         NSenterMsgType = "lookupBatchRequest"
+	LookupBatchResponse        NSenterMsgType = "lookupBatchResponse"
 	OpenFileRequest            NSenterMsgType = "openFileRequest"
 	OpenFileResponse           NSenterMsgType = "openFileResponse"
 	ReadFileRequest            NSenterMsgType = "readFileRequest"
@@ -94,6 +98,8 @@ const (
 	RemovexattrSyscallResponse NSenterMsgType = "RemovexattrSyscallResponse"
 	ListxattrSyscallRequest    NSenterMsgType = "ListxattrSyscallRequest"
 	ListxattrSyscallResponse   NSenterMsgType = "ListxattrSyscallResponse"
+	RemountFuseRequest         NSenterMsgType = "remountFuseRequest"
+	RemountFuseResponse        NSenterMsgType = "remountFuseResponse"
 	ErrorResponse              NSenterMsgType = "errorResponse"
 )
 
@@ -115,6 +121,7 @@ type NSenterServiceIface interface {
 	ReceiveResponseEvent(e NSenterEventIface) *NSenterMessage
 	TerminateRequestEvent(e NSenterEventIface) error
 	GetEventProcessID(e NSenterEventIface) uint32
+	TerminateAllRequests() int
 }
 
 //
@@ -156,13 +163,22 @@ type NSenterMsgHeader struct {
 	Gid          uint32    `json:"gid"`
 	Root         string    `json:"root"`
 	Cwd          string    `json:"cwd"`
+	SGid         []uint32  `json:"sgid"`
 	Capabilities [2]uint32 `json:"capabilities"`
+	AmbientCaps  [2]uint32 `json:"ambientcaps"`
+	MountLabel   string    `json:"mountlabel,omitempty"`
 }
 
 type LookupPayload struct {
 	Entry string `json:"entry"`
 }
 
+// Multi-entry lookup request. The response payload holds the FileInfo of each
+// of the entries found (map[string]FileInfo), keyed by their path.
+type LookupBatchPayload struct {
+	Entries []string `json:"entries"`
+}
+
 type OpenFilePayload struct {
 	File  string `json:"file"`
 	Flags string `json:"flags"`
@@ -251,6 +267,16 @@ type MountInodeRespPayload struct {
 	MpInodes []Inode `json:"mpinodes"`
 }
 
+// Replaces the (stale) mount of a sysbox-fs node at the given target with the
+// one passed along the request: a detached mount obtained through open_tree(),
+// which shows up as file-descriptor 'Fd' within the nsenter process.
+type RemountFusePayload struct {
+	Target string   `json:"target"`
+	Fd     int      `json:"fd"`
+	Rdonly bool     `json:"rdonly"`
+	File   *os.File `json:"-"`
+}
+
 type SleepReqPayload struct {
 	Ival string `json:"attr"`
 }
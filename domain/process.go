@@ -17,6 +17,7 @@
 package domain
 
 import (
+	"os"
 	"reflect"
 
 	cap "github.com/nestybox/sysbox-libs/capability"
@@ -45,6 +46,10 @@ type ProcessIface interface {
 	SGid() []uint32
 	UidMap() ([]user.IDMap, error)
 	GidMap() ([]user.IDMap, error)
+	UidToHost(uid uint32) (uint32, bool)
+	UidFromHost(uid uint32) (uint32, bool)
+	GidToHost(gid uint32) (uint32, bool)
+	GidFromHost(gid uint32) (uint32, bool)
 	IsCapabilitySet(cap.CapType, cap.Cap) bool
 	IsSysAdminCapabilitySet() bool
 	NsInodes() (map[string]Inode, error)
@@ -52,24 +57,52 @@ type ProcessIface interface {
 	NetNsInode() (Inode, error)
 	UserNsInode() (Inode, error)
 	UserNsInodeParent() (Inode, error)
+	UserNsAncestors() ([]Inode, error)
 	UsernsRootUidGid() (uint32, uint32, error)
 	CreateNsInodes(Inode) error
 	PathAccess(path string, accessFlags AccessMode, followSymlink bool) error
+	CheckAccess(uid, gid uint32, mode os.FileMode, accessFlags AccessMode) error
+	Umask() (os.FileMode, error)
 	ResolveProcSelf(string) (string, error)
 	GetEffCaps() [2]uint32
 	SetEffCaps(caps [2]uint32)
+	GetAmbientCaps() [2]uint32
 	GetFd(int32) (string, error)
+	Comm() (string, error)
+	Exe() (string, error)
+	Environ(keys ...string) (map[string]string, error)
+	Cgroups() ([]CgroupMembership, error)
+	CgroupPath(controller string) (string, error)
+	ReadCgroupFile(controller, name string) ([]byte, error)
 	AdjustPersonality(
 		uid uint32,
 		gid uint32,
+		sgid []uint32,
 		root string,
 		cwd string,
-		caps [2]uint32) error
+		caps [2]uint32,
+		ambientCaps [2]uint32) error
+}
+
+// Membership of a process to a cgroup hierarchy, as per /proc/<pid>/cgroup.
+type CgroupMembership struct {
+	Hierarchy   int    // hierarchy id (0 for the cgroup v2 hierarchy)
+	Controllers string // comma-separated controllers ("" for cgroup v2)
+	Path        string // cgroup path relative to the hierarchy's root
 }
 
 type ProcessServiceIface interface {
 	Setup(ios IOServiceIface)
 	ProcessCreate(pid uint32, uid uint32, gid uint32) ProcessIface
+	ProcessHandle(pid uint32) (ProcessHandleIface, error)
+}
+
+// Handle to a process, which allows to verify that the process is still alive
+// and that its pid hasn't been recycled since the handle was obtained.
+type ProcessHandleIface interface {
+	Pid() uint32
+	Alive() bool
+	Close() error
 }
 
 // ProcessNsMatch returns true if the given processes are in the same namespaces.
@@ -0,0 +1,146 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//
+// Emulation profiles. A profile bundles the resource policies and sysctl
+// values required by a given workload, so that these can be selected at once
+// on a per-container basis through the "io.sysbox.fs.profile" annotation
+// (e.g. "io.sysbox.fs.profile=k8s"). Settings explicitly defined through
+// other annotations take precedence over the profile ones.
+//
+type Profile struct {
+	Policies ResourcePolicies  // resource policies, indexed by resource path
+	Sysctls  map[string]string // initial sysctl values, indexed by path
+}
+
+//
+// "k8s" profile: Kubernetes nodes running within sys containers (e.g., KinD,
+// kubeadm). Exposes the emulated resources that kubeadm's preflight checks,
+// kubelet and kube-proxy rely on:
+//
+// * bridge-nf-call-iptables / ip6tables, expected to be set by kubeadm.
+//
+// * The kernel tunables enforced by kubelet (--protect-kernel-defaults), which
+//   are seeded with the values expected by kubelet.
+//
+// * The conntrack sysctls and parameters adjusted by kube-proxy.
+//
+// * Swaps (kubelet refuses to start with swap enabled), and the DMI product
+//   uuid (which must be unique per node).
+//
+var K8sProfile = &Profile{
+	Policies: ResourcePolicies{
+		"/proc/swaps":                                  ResourcePolicyExpose,
+		"/proc/sys/kernel/keys":                        ResourcePolicyExpose,
+		"/proc/sys/kernel/panic":                       ResourcePolicyExpose,
+		"/proc/sys/kernel/panic_on_oops":               ResourcePolicyExpose,
+		"/proc/sys/kernel/pid_max":                     ResourcePolicyExpose,
+		"/proc/sys/net/bridge":                         ResourcePolicyExpose,
+		"/proc/sys/net/netfilter":                      ResourcePolicyExpose,
+		"/proc/sys/vm/overcommit_memory":               ResourcePolicyExpose,
+		"/sys/devices/virtual/dmi/id/product_uuid":     ResourcePolicyExpose,
+		"/sys/module/nf_conntrack/parameters/hashsize": ResourcePolicyExpose,
+	},
+	Sysctls: map[string]string{
+		"/proc/sys/kernel/keys/root_maxbytes":           "25000000",
+		"/proc/sys/kernel/keys/root_maxkeys":            "1000000",
+		"/proc/sys/kernel/panic":                        "10",
+		"/proc/sys/kernel/panic_on_oops":                "1",
+		"/proc/sys/net/bridge/bridge-nf-call-ip6tables": "1",
+		"/proc/sys/net/bridge/bridge-nf-call-iptables":  "1",
+		"/proc/sys/vm/overcommit_memory":                "1",
+	},
+}
+
+// Profiles available through the profile annotation, indexed by name.
+var Profiles = map[string]*Profile{
+	"k8s": K8sProfile,
+}
+
+// ParseProfiles returns the profiles listed (comma-separated) in the value of
+// the profile annotation.
+func ParseProfiles(val string) ([]*Profile, error) {
+
+	var profiles []*Profile
+
+	for _, name := range strings.Split(val, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		p, ok := Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (supported: %s)",
+				name, strings.Join(ProfileNames(), ", "))
+		}
+		profiles = append(profiles, p)
+	}
+
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles found in %q", val)
+	}
+
+	return profiles, nil
+}
+
+// ProfileNames returns the names of the available profiles.
+func ProfileNames() []string {
+
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Merges the profile settings into the given ones, without overriding these.
+func (p *Profile) merge(
+	policies ResourcePolicies,
+	sysctls map[string]string) (ResourcePolicies, map[string]string) {
+
+	for path, policy := range p.Policies {
+		if _, ok := policies[path]; ok {
+			continue
+		}
+		if policies == nil {
+			policies = make(ResourcePolicies)
+		}
+		policies[path] = policy
+	}
+
+	for path, val := range p.Sysctls {
+		if _, ok := sysctls[path]; ok {
+			continue
+		}
+		if sysctls == nil {
+			sysctls = make(map[string]string)
+		}
+		sysctls[path] = val
+	}
+
+	return policies, sysctls
+}
@@ -0,0 +1,172 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Write rate limiting: each sys container is granted a token-bucket through
+// which the operations that translate into nsenter work on its behalf (i.e.,
+// writes to emulated resources, and trapped mount / chown syscalls) are
+// throttled. Operations beyond the container's rate (once its burst is
+// exhausted) are rejected with EAGAIN, so that a malicious or buggy workload
+// can't flood sysbox-fs.
+//
+// The limit is set daemon-wide (see SetWriteRateLimit()), and can be overridden
+// on a per-container basis through the write-rate-limit annotation.
+//
+
+// Rate limit of a token-bucket: 'Rate' operations per second, with bursts of
+// up to 'Burst' operations. A zero rate stands for no limit.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Unlimited reports whether the rate limit imposes no limit at all.
+func (l RateLimit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+func (l RateLimit) String() string {
+	if l.Unlimited() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%v:%d", l.Rate, l.Burst)
+}
+
+// ParseRateLimit parses a rate limit expressed as "<rate>[:<burst>]" (e.g.,
+// "50:100" for 50 operations per second with bursts of up to 100). The burst
+// defaults to the rate (rounded up), and a zero rate stands for no limit.
+func ParseRateLimit(val string) (RateLimit, error) {
+
+	fields := strings.SplitN(strings.TrimSpace(val), ":", 2)
+
+	rate, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || rate < 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q", val)
+	}
+	if rate == 0 {
+		return RateLimit{}, nil
+	}
+
+	burst := int(rate)
+	if float64(burst) < rate {
+		burst++
+	}
+
+	if len(fields) == 2 {
+		burst, err = strconv.Atoi(fields[1])
+		if err != nil || burst < 1 {
+			return RateLimit{}, fmt.Errorf("invalid rate limit %q", val)
+		}
+	}
+
+	return RateLimit{Rate: rate, Burst: burst}, nil
+}
+
+// RateLimiter is a token-bucket enforcing a rate limit. A nil limiter imposes
+// no limit.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	now    func() time.Time // clock (overridden by unit-tests)
+}
+
+// NewRateLimiter returns a (full) token-bucket enforcing the given rate limit,
+// or nil if the limit imposes no limit.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+
+	if limit.Unlimited() {
+		return nil
+	}
+
+	l := &RateLimiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		now:    time.Now,
+	}
+	l.last = l.now()
+
+	return l
+}
+
+// Limit returns the rate limit enforced by the limiter.
+func (l *RateLimiter) Limit() RateLimit {
+	if l == nil {
+		return RateLimit{}
+	}
+	return l.limit
+}
+
+// Allow consumes a token out of the bucket, and reports whether one was
+// available (i.e., whether the operation is allowed).
+func (l *RateLimiter) Allow() bool {
+
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+	if l.tokens > float64(l.limit.Burst) {
+		l.tokens = float64(l.limit.Burst)
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+
+	return true
+}
+
+var (
+	writeRateLimit   RateLimit
+	writeRateLimitMu sync.RWMutex
+)
+
+// SetWriteRateLimit sets the default (daemon-wide) write rate limit of the sys
+// containers.
+func SetWriteRateLimit(limit RateLimit) {
+	writeRateLimitMu.Lock()
+	defer writeRateLimitMu.Unlock()
+
+	writeRateLimit = limit
+}
+
+// WriteRateLimit returns the default (daemon-wide) write rate limit of the sys
+// containers.
+func WriteRateLimit() RateLimit {
+	writeRateLimitMu.RLock()
+	defer writeRateLimitMu.RUnlock()
+
+	return writeRateLimit
+}
@@ -0,0 +1,90 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+
+	tests := []struct {
+		val     string
+		want    RateLimit
+		wantErr bool
+	}{
+		{"50:100", RateLimit{Rate: 50, Burst: 100}, false},
+		{"10", RateLimit{Rate: 10, Burst: 10}, false},
+		{"0.5", RateLimit{Rate: 0.5, Burst: 1}, false},
+		{"0", RateLimit{}, false},
+		{"-1", RateLimit{}, true},
+		{"10:0", RateLimit{}, true},
+		{"fast", RateLimit{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRateLimit(tt.val)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRateLimit(%q) = %v, %v; want %v (error: %v)",
+				tt.val, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+
+	if l := NewRateLimiter(RateLimit{}); l != nil || !l.Allow() {
+		t.Errorf("unlimited rate limiter must allow all operations")
+	}
+
+	now := time.Unix(1000, 0)
+
+	l := NewRateLimiter(RateLimit{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	// The burst is available upfront.
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatalf("operation %d within burst rejected", i)
+		}
+	}
+	if l.Allow() {
+		t.Fatalf("operation beyond burst allowed")
+	}
+
+	// Tokens are replenished at the given rate.
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow() {
+		t.Errorf("operation rejected after replenishing")
+	}
+	if l.Allow() {
+		t.Errorf("operation allowed beyond rate")
+	}
+
+	// Up to the burst size.
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Errorf("operation %d within replenished burst rejected", i)
+		}
+	}
+	if l.Allow() {
+		t.Errorf("operation beyond replenished burst allowed")
+	}
+}
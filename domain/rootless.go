@@ -0,0 +1,83 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+//
+// Rootless mode: sysbox-fs runs as a non-root user within a user namespace
+// (e.g., along with a rootless container runtime), and thereby lacks the host
+// privileges it otherwise relies on. In this mode:
+//
+// * FUSE mounts are carried out through the unprivileged fusermount helper,
+//   and the fuse connection attributes (fusectl) are left untouched.
+//
+// * Namespaces shared with sysbox-fs itself (i.e., its own user-ns) are not
+//   entered by nsenter processes, as setns() into the caller's own user-ns is
+//   rejected by the kernel, and the rest are entered relative to it.
+//
+// * Resources that genuinely require host root (e.g., the host's debugfs) are
+//   reported as such (EPERM) instead of failing in obscure ways.
+//
+
+var rootless int32
+
+// SetRootless enables / disables the rootless mode.
+func SetRootless(enabled bool) {
+	var val int32
+	if enabled {
+		val = 1
+	}
+	atomic.StoreInt32(&rootless, val)
+}
+
+// Rootless reports whether sysbox-fs operates in rootless mode.
+func Rootless() bool {
+	return atomic.LoadInt32(&rootless) == 1
+}
+
+// RunningInUserNs reports whether the calling process lives within a user
+// namespace other than the initial one, which is the case when its uid map
+// differs from the identity mapping of the full uid range.
+func RunningInUserNs() bool {
+
+	f, err := os.Open("/proc/self/uid_map")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return false
+	}
+
+	return !isIdentityIdMap(scanner.Text())
+}
+
+func isIdentityIdMap(line string) bool {
+
+	fields := strings.Fields(line)
+
+	return len(fields) == 3 &&
+		fields[0] == "0" && fields[1] == "0" && fields[2] == "4294967295"
+}
@@ -0,0 +1,38 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import "testing"
+
+func TestIsIdentityIdMap(t *testing.T) {
+
+	var tests = []struct {
+		line string
+		want bool
+	}{
+		{"         0          0 4294967295", true},
+		{"         0       1000          1", false},
+		{"         0     100000      65536", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIdentityIdMap(tt.line); got != tt.want {
+			t.Errorf("isIdentityIdMap(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+//
+// Value schemas of the emulated resources (see EmuResource.Schema).
+//
+// Schemas describe the values accepted by a resource, so that writes can be
+// validated by the handler service before being handed over to the resource's
+// handler, rejecting the non-conforming ones (EINVAL) the same way the kernel
+// does for the actual sysctls.
+//
+
+// ValueSchema validates the values written into a resource. Values are
+// handed over with leading and trailing whitespace trimmed (i.e., as parsed by
+// the kernel).
+type ValueSchema interface {
+	Validate(val string) error
+}
+
+// IntSchema accepts an integer within the given range (inclusive).
+type IntSchema struct {
+	Min, Max int64
+}
+
+func (s IntSchema) Validate(val string) error {
+
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", val)
+	}
+
+	if i < s.Min || i > s.Max {
+		return fmt.Errorf("value %d out of range [%d, %d]", i, s.Min, s.Max)
+	}
+
+	return nil
+}
+
+// IntRangeSchema accepts a pair of whitespace-separated integers (e.g.,
+// "32768 60999"), each within the given range (inclusive). If Ordered is set,
+// the first one can't exceed the second one.
+type IntRangeSchema struct {
+	Min, Max int64
+	Ordered  bool
+}
+
+func (s IntRangeSchema) Validate(val string) error {
+
+	fields := strings.Fields(val)
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid range %q", val)
+	}
+
+	var bounds [2]int64
+
+	for i, f := range fields {
+		if err := (IntSchema{Min: s.Min, Max: s.Max}).Validate(f); err != nil {
+			return err
+		}
+		bounds[i], _ = strconv.ParseInt(f, 10, 64)
+	}
+
+	if s.Ordered && bounds[0] > bounds[1] {
+		return fmt.Errorf("invalid range %q", val)
+	}
+
+	return nil
+}
+
+// BoolSchema accepts "0" and "1".
+type BoolSchema struct{}
+
+func (s BoolSchema) Validate(val string) error {
+	return IntSchema{Min: 0, Max: 1}.Validate(val)
+}
+
+// EnumSchema accepts any of the given values.
+type EnumSchema struct {
+	Values []string
+}
+
+func (s EnumSchema) Validate(val string) error {
+
+	for _, v := range s.Values {
+		if val == v {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid value %q", val)
+}
+
+// CIDRListSchema accepts a comma or whitespace separated list of IPv4 / IPv6
+// networks in CIDR notation (e.g., "10.0.0.0/8, fd00::/8"). The empty list is
+// accepted too.
+type CIDRListSchema struct{}
+
+func (s CIDRListSchema) Validate(val string) error {
+
+	fields := strings.FieldsFunc(val, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+
+	for _, f := range fields {
+		if _, _, err := net.ParseCIDR(f); err != nil {
+			return fmt.Errorf("invalid network %q", f)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import "testing"
+
+func TestValueSchemas(t *testing.T) {
+
+	tests := []struct {
+		schema ValueSchema
+		val    string
+		valid  bool
+	}{
+		{IntSchema{Min: 0, Max: 3}, "0", true},
+		{IntSchema{Min: 0, Max: 3}, "3", true},
+		{IntSchema{Min: 0, Max: 3}, "4", false},
+		{IntSchema{Min: 0, Max: 3}, "-1", false},
+		{IntSchema{Min: 0, Max: 3}, "1a", false},
+		{IntSchema{Min: 0, Max: 3}, "", false},
+
+		{IntRangeSchema{Min: 0, Max: 65535}, "1 2", true},
+		{IntRangeSchema{Min: 0, Max: 65535}, "2\t1", true},
+		{IntRangeSchema{Min: 0, Max: 65535, Ordered: true}, "2 1", false},
+		{IntRangeSchema{Min: 0, Max: 65535}, "1 65536", false},
+		{IntRangeSchema{Min: 0, Max: 65535}, "1", false},
+		{IntRangeSchema{Min: 0, Max: 65535}, "1 2 3", false},
+
+		{BoolSchema{}, "0", true},
+		{BoolSchema{}, "1", true},
+		{BoolSchema{}, "2", false},
+		{BoolSchema{}, "true", false},
+
+		{EnumSchema{Values: []string{"cubic", "reno"}}, "reno", true},
+		{EnumSchema{Values: []string{"cubic", "reno"}}, "bbr", false},
+
+		{CIDRListSchema{}, "", true},
+		{CIDRListSchema{}, "10.0.0.0/8", true},
+		{CIDRListSchema{}, "10.0.0.0/8, fd00::/8", true},
+		{CIDRListSchema{}, "10.0.0.0/8,10.0.0.1", false},
+		{CIDRListSchema{}, "10.0.0.0/33", false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.schema.Validate(tt.val); (err == nil) != tt.valid {
+			t.Errorf("%T.Validate(%q) = %v, want valid = %v",
+				tt.schema, tt.val, err, tt.valid)
+		}
+	}
+}
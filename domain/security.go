@@ -0,0 +1,190 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+//
+// Security events: operations of sys containers blocked by sysbox-fs, or
+// otherwise suspicious, are reported as structured events for the host's IDS
+// tooling to consume. Events are delivered through:
+//
+// * The audit stream (see SetSecurityAuditLog()), as JSON lines.
+//
+// * The IPC event channel (see SubscribeSecurityEvents()), which the debug
+//   server streams to its clients (i.e., /security/events endpoint).
+//
+// Reported events:
+//
+// * Writes to sysctls denied to the container (e.g., read-only policies,
+//   non-namespaced sysctls).
+//
+// * Attempts to unmount mounts managed by sysbox-fs or sysbox-runc (e.g., the
+//   container's procfs / sysfs, immutable mounts).
+//
+// * Repeated permission failures (EACCES / EPERM) within a container, as per
+//   securityFailuresThreshold and securityFailuresWindow.
+//
+
+type SecurityEventType string
+
+const (
+	SecurityEventDeniedSysctlWrite  SecurityEventType = "denied-sysctl-write"
+	SecurityEventManagedUnmount     SecurityEventType = "managed-unmount"
+	SecurityEventPermissionFailures SecurityEventType = "permission-failures"
+)
+
+type SecurityEvent struct {
+	Time      time.Time         `json:"time"`
+	Type      SecurityEventType `json:"type"`
+	Container string            `json:"container"`
+	Pid       uint32            `json:"pid,omitempty"`
+	Path      string            `json:"path,omitempty"`    // resource / mountpoint
+	Syscall   string            `json:"syscall,omitempty"` // syscall / fuse operation
+	Errno     string            `json:"errno,omitempty"`   // error returned to the container
+	Count     int               `json:"count,omitempty"`   // number of occurrences
+}
+
+// Number of permission failures within a container, in securityFailuresWindow,
+// reported as a permission-failures event.
+const securityFailuresThreshold = 20
+
+const securityFailuresWindow = time.Minute
+
+// Number of events buffered per subscriber; events beyond this are dropped for
+// slow subscribers.
+const securityEventsBuffer = 256
+
+// Permission failures of a container within the current window.
+type securityFailures struct {
+	start time.Time
+	count int
+}
+
+var securityEvents = struct {
+	sync.Mutex
+	audit    io.Writer
+	subs     map[chan SecurityEvent]struct{}
+	failures map[string]*securityFailures // indexed by container id
+}{
+	subs:     make(map[chan SecurityEvent]struct{}),
+	failures: make(map[string]*securityFailures),
+}
+
+// Clock of the security events (overridden by unit-tests).
+var securityNow = time.Now
+
+// SetSecurityAuditLog sets the audit stream security events are written to
+// (nil to disable it).
+func SetSecurityAuditLog(w io.Writer) {
+	securityEvents.Lock()
+	defer securityEvents.Unlock()
+
+	securityEvents.audit = w
+}
+
+// SubscribeSecurityEvents returns a channel through which the security events
+// emitted from now on are delivered, along with the function to cancel the
+// subscription.
+func SubscribeSecurityEvents() (<-chan SecurityEvent, func()) {
+
+	ch := make(chan SecurityEvent, securityEventsBuffer)
+
+	securityEvents.Lock()
+	securityEvents.subs[ch] = struct{}{}
+	securityEvents.Unlock()
+
+	cancel := func() {
+		securityEvents.Lock()
+		defer securityEvents.Unlock()
+
+		if _, ok := securityEvents.subs[ch]; ok {
+			delete(securityEvents.subs, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+// EmitSecurityEvent delivers the given event to the audit stream and to the
+// subscribers of the event channel.
+func EmitSecurityEvent(ev SecurityEvent) {
+
+	if ev.Time.IsZero() {
+		ev.Time = securityNow()
+	}
+
+	securityEvents.Lock()
+	defer securityEvents.Unlock()
+
+	if securityEvents.audit != nil {
+		if data, err := json.Marshal(ev); err == nil {
+			securityEvents.audit.Write(append(data, '\n'))
+		}
+	}
+
+	for ch := range securityEvents.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// RecordPermissionFailure accounts for a permission failure (EACCES / EPERM)
+// within the given container, emitting a permission-failures event when these
+// pile up (see securityFailuresThreshold). The event carries the details of the
+// last failure.
+func RecordPermissionFailure(ev SecurityEvent) {
+
+	now := securityNow()
+
+	securityEvents.Lock()
+
+	f, ok := securityEvents.failures[ev.Container]
+	if !ok || now.Sub(f.start) > securityFailuresWindow {
+		// Windows of other containers are pruned as new ones start.
+		for id, other := range securityEvents.failures {
+			if now.Sub(other.start) > securityFailuresWindow {
+				delete(securityEvents.failures, id)
+			}
+		}
+		f = &securityFailures{start: now}
+		securityEvents.failures[ev.Container] = f
+	}
+
+	f.count++
+	if f.count < securityFailuresThreshold {
+		securityEvents.Unlock()
+		return
+	}
+	delete(securityEvents.failures, ev.Container)
+
+	securityEvents.Unlock()
+
+	ev.Type = SecurityEventPermissionFailures
+	ev.Count = securityFailuresThreshold
+	ev.Time = now
+
+	EmitSecurityEvent(ev)
+}
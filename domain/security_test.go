@@ -0,0 +1,104 @@
+//
+// Copyright 2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEmitSecurityEvent(t *testing.T) {
+
+	var audit bytes.Buffer
+	SetSecurityAuditLog(&audit)
+	defer SetSecurityAuditLog(nil)
+
+	events, cancel := SubscribeSecurityEvents()
+	defer cancel()
+
+	EmitSecurityEvent(SecurityEvent{
+		Type:      SecurityEventDeniedSysctlWrite,
+		Container: "c1",
+		Pid:       1001,
+		Path:      "/proc/sys/kernel/panic",
+		Errno:     "EACCES",
+	})
+
+	select {
+	case ev := <-events:
+		if ev.Type != SecurityEventDeniedSysctlWrite || ev.Container != "c1" || ev.Time.IsZero() {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	default:
+		t.Fatalf("no event delivered to subscriber")
+	}
+
+	var ev SecurityEvent
+	if err := json.Unmarshal(audit.Bytes(), &ev); err != nil {
+		t.Fatalf("invalid audit record %q: %v", audit.String(), err)
+	}
+	if ev.Path != "/proc/sys/kernel/panic" || ev.Pid != 1001 {
+		t.Errorf("unexpected audit record %q", audit.String())
+	}
+
+	// Cancelled subscriptions are no longer delivered events.
+	cancel()
+	EmitSecurityEvent(SecurityEvent{Type: SecurityEventManagedUnmount, Container: "c1"})
+	if _, ok := <-events; ok {
+		t.Errorf("event delivered to cancelled subscription")
+	}
+}
+
+func TestRecordPermissionFailure(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+	securityNow = func() time.Time { return now }
+	defer func() { securityNow = time.Now }()
+
+	events, cancel := SubscribeSecurityEvents()
+	defer cancel()
+
+	ev := SecurityEvent{Container: "c1", Pid: 1001, Path: "/proc/sys/kernel/panic"}
+
+	// Failures spread beyond the window are not reported.
+	for i := 0; i < securityFailuresThreshold-1; i++ {
+		RecordPermissionFailure(ev)
+	}
+	now = now.Add(2 * securityFailuresWindow)
+	RecordPermissionFailure(ev)
+
+	if len(events) != 0 {
+		t.Fatalf("unexpected event %+v", <-events)
+	}
+
+	for i := 0; i < securityFailuresThreshold-1; i++ {
+		RecordPermissionFailure(ev)
+	}
+
+	select {
+	case got := <-events:
+		if got.Type != SecurityEventPermissionFailures ||
+			got.Count != securityFailuresThreshold ||
+			got.Path != ev.Path {
+			t.Errorf("unexpected event %+v", got)
+		}
+	default:
+		t.Fatalf("no permission-failures event emitted")
+	}
+}
@@ -18,9 +18,34 @@ package domain
 
 import (
 	"os"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
+// Threshold beyond which sysbox-fs operations (i.e., FUSE requests, seccomp
+// handled syscalls and nsenter events) are considered slow, and are logged as
+// such to help diagnose stalls. A zero value disables slow-op logging. As this
+// value can be updated at runtime (config reload), it's accessed atomically.
+var slowOpThreshold int64
+
+// SetSlowOpThreshold sets the slow-operation threshold.
+func SetSlowOpThreshold(d time.Duration) {
+	atomic.StoreInt64(&slowOpThreshold, int64(d))
+}
+
+// SlowOpThreshold returns the slow-operation threshold.
+func SlowOpThreshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&slowOpThreshold))
+}
+
+// IsSlowOp reports whether an operation of the given duration exceeds the
+// slow-op threshold.
+func IsSlowOp(d time.Duration) bool {
+	threshold := SlowOpThreshold()
+	return threshold > 0 && d >= threshold
+}
+
 // FileExists reports whether the named file or directory exists.
 func FileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -0,0 +1,46 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsSlowOp(t *testing.T) {
+
+	defer SetSlowOpThreshold(SlowOpThreshold())
+
+	tests := []struct {
+		threshold time.Duration
+		d         time.Duration
+		want      bool
+	}{
+		{0, time.Hour, false},
+		{100 * time.Millisecond, 99 * time.Millisecond, false},
+		{100 * time.Millisecond, 100 * time.Millisecond, true},
+		{100 * time.Millisecond, time.Second, true},
+	}
+
+	for _, tt := range tests {
+		SetSlowOpThreshold(tt.threshold)
+		if got := IsSlowOp(tt.d); got != tt.want {
+			t.Errorf("IsSlowOp(%v) with threshold %v = %v, want %v",
+				tt.d, tt.threshold, got, tt.want)
+		}
+	}
+}
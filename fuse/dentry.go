@@ -0,0 +1,211 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bazil.org/fuse/fs"
+	"github.com/sirupsen/logrus"
+)
+
+//
+// Dentry cache-timeout policy. Nodes are classified as:
+//
+// * Static: the bulk of procfs / sysfs nodes, whose existence never changes
+//   during the container's life-cycle. Their dentries are cached for the
+//   longest period possible (DentryCacheTimeout).
+//
+// * Dynamic: nodes that may come and go at any time (e.g., per network-
+//   interface sysctls). Their dentries are only cached for a short period
+//   (DynamicDentryCacheTimeout).
+//
+// On top of that, the timeout of the nodes being frequently written is
+// progressively shrunk (down to zero), as frequent writes are a sign of a
+// node's volatile state. The timeout is restored once the writes calm down.
+//
+
+// Nodes (and their descendants) considered dynamic.
+var dynamicDentryPaths = []string{
+	"/proc/sys/net/ipv4/conf",
+	"/proc/sys/net/ipv4/neigh",
+	"/proc/sys/net/ipv6/conf",
+	"/proc/sys/net/ipv6/neigh",
+}
+
+const (
+	// Period over which the writes into a node are accounted.
+	dentryWriteWindow = 10 * time.Second
+
+	// Number of writes within a window beyond which a node is considered to
+	// be frequently written. Every window in which this threshold is reached
+	// halves the node's timeout.
+	dentryFrequentWrites = 10
+
+	// Max number of times a node's timeout is halved before dropping it to
+	// zero.
+	dentryMaxShrink = 8
+)
+
+// Returns true if the given node is a dynamic one.
+func isDynamicNode(path string) bool {
+	for _, p := range dynamicDentryPaths {
+		if strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+type nodeWrites struct {
+	count  int       // writes within the current window
+	window time.Time // beginning of the current window
+	shrink uint      // number of times the node's timeout has been halved
+}
+
+// Tracks the writes into the nodes of a fuse-server.
+type dentryWriteTracker struct {
+	sync.Mutex
+	nodes map[string]*nodeWrites
+}
+
+// Rolls the node's write accounting over to the current window, restoring its
+// timeout for every elapsed window without frequent writes.
+func (w *nodeWrites) roll(now time.Time) {
+
+	elapsed := now.Sub(w.window)
+	if elapsed < dentryWriteWindow {
+		return
+	}
+
+	calm := uint(elapsed / dentryWriteWindow)
+	if w.count >= dentryFrequentWrites {
+		calm--
+	}
+	if calm > w.shrink {
+		calm = w.shrink
+	}
+	w.shrink -= calm
+
+	w.count = 0
+	w.window = now
+}
+
+// Accounts for a write into the given node. Returns true if the node's timeout
+// has just been shrunk.
+func (t *dentryWriteTracker) written(path string) bool {
+
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+
+	if t.nodes == nil {
+		t.nodes = make(map[string]*nodeWrites)
+	}
+
+	w, ok := t.nodes[path]
+	if !ok {
+		w = &nodeWrites{window: now}
+		t.nodes[path] = w
+	}
+	w.roll(now)
+
+	w.count++
+	if w.count == dentryFrequentWrites && w.shrink <= dentryMaxShrink {
+		w.shrink++
+		return true
+	}
+
+	return false
+}
+
+// Returns the given timeout shrunk as per the writes received by the node.
+func (t *dentryWriteTracker) timeout(path string, timeout time.Duration) time.Duration {
+
+	t.Lock()
+	defer t.Unlock()
+
+	w, ok := t.nodes[path]
+	if !ok {
+		return timeout
+	}
+	w.roll(time.Now())
+
+	switch {
+	case w.shrink == 0 && w.count == 0:
+		delete(t.nodes, path)
+		return timeout
+	case w.shrink > dentryMaxShrink:
+		return 0
+	default:
+		return timeout >> w.shrink
+	}
+}
+
+// Returns the dentry cache-timeout of the given node, and whether the node is
+// a dynamic one.
+func (s *fuseServer) dentryTimeout(path string) (time.Duration, bool) {
+
+	timeout := time.Duration(atomic.LoadInt64(&DentryCacheTimeout))
+
+	dynamic := isDynamicNode(path)
+	if dynamic {
+		timeout = time.Duration(atomic.LoadInt64(&DynamicDentryCacheTimeout))
+	}
+
+	return s.dentryWrites.timeout(path, timeout), dynamic
+}
+
+// Accounts for a write into the given node. Once a node is found to be
+// frequently written, its dentry is invalidated, so that the kernel picks up
+// its shrunk timeout in the next lookup.
+func (s *fuseServer) nodeWritten(path string) {
+
+	if !s.dentryWrites.written(path) {
+		return
+	}
+
+	var parent fs.Node
+
+	dir := filepath.Dir(path)
+
+	s.RLock()
+	if node, ok := s.nodeDB[dir]; ok {
+		parent = *node
+	} else if s.root != nil && s.root.path == dir {
+		parent = s.root
+	}
+	s.RUnlock()
+
+	if parent == nil || s.server == nil {
+		return
+	}
+
+	// Invalidation is deferred, as it can't be requested while serving a FUSE
+	// operation over the node.
+	go func() {
+		if err := s.server.InvalidateEntry(parent, filepath.Base(path)); err != nil {
+			logrus.Debugf("Unable to invalidate dentry %s: %v", path, err)
+		}
+	}()
+}
@@ -0,0 +1,67 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDentryWriteTracker(t *testing.T) {
+
+	const path = "/proc/sys/net/ipv4/ip_forward"
+
+	var tr dentryWriteTracker
+
+	if got := tr.timeout(path, time.Hour); got != time.Hour {
+		t.Errorf("timeout() = %v for unwritten node, want %v", got, time.Hour)
+	}
+
+	// Infrequent writes leave the timeout untouched.
+	for i := 0; i < dentryFrequentWrites-1; i++ {
+		if tr.written(path) {
+			t.Fatalf("written() shrunk timeout after %d writes", i+1)
+		}
+	}
+	if got := tr.timeout(path, time.Hour); got != time.Hour {
+		t.Errorf("timeout() = %v, want %v", got, time.Hour)
+	}
+
+	// Frequent writes halve it.
+	if !tr.written(path) {
+		t.Fatalf("written() did not shrink timeout")
+	}
+	if got := tr.timeout(path, time.Hour); got != time.Hour/2 {
+		t.Errorf("timeout() = %v, want %v", got, time.Hour/2)
+	}
+
+	// And it's restored once writes calm down.
+	tr.nodes[path].window = time.Now().Add(-3 * dentryWriteWindow)
+	if got := tr.timeout(path, time.Hour); got != time.Hour {
+		t.Errorf("timeout() = %v after calm period, want %v", got, time.Hour)
+	}
+}
+
+func TestIsDynamicNode(t *testing.T) {
+
+	if !isDynamicNode("/proc/sys/net/ipv4/conf/eth0/forwarding") {
+		t.Errorf("per-interface sysctl not deemed dynamic")
+	}
+	if isDynamicNode("/proc/sys/net/ipv4/conf") || isDynamicNode("/proc/sys/kernel/pid_max") {
+		t.Errorf("static node deemed dynamic")
+	}
+}
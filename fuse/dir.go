@@ -22,6 +22,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/nestybox/sysbox-fs/domain"
@@ -34,14 +36,80 @@ import (
 // Default dentry-cache-timeout interval: This is the maximum
 // amount of time that VFS will hold on to dentry elements before starting
 // to forward lookup() operations to FUSE server. We want to set this to
-// infinite ideally; we set it to the max allowed value.
+// infinite ideally; we set it to the max allowed value. This timeout applies
+// to static nodes; see dentryTimeout() for the other node classes.
 var DentryCacheTimeout int64 = 0x7fffffffffffffff
 
+// Dentry cache-timeout of dynamic nodes (i.e., nodes that may come and go
+// during the container's life-cycle, such as per network-interface sysctls).
+var DynamicDentryCacheTimeout int64 = defaultDynamicDentryCacheTimeout
+
 // Attribute's cache-timeout: This is the maximum amount of time that
 // kernel will hold attributes associated to any given file/dir. Refer
 // to man fuse(4) for details.
 var AttribCacheTimeout int64 = 0x7fffffffffffffff
 
+// Default values of the above timeouts.
+const (
+	defaultCacheTimeout              int64 = 0x7fffffffffffffff
+	defaultDynamicDentryCacheTimeout int64 = int64(time.Second)
+)
+
+// SetCacheTimeouts updates the dentry (static and dynamic nodes) and attribute
+// cache-timeouts. A nil value restores the default timeout. As these values
+// can be modified at runtime (i.e., config reload), they are always accessed
+// atomically.
+func SetCacheTimeouts(dentry, dynamicDentry, attr *time.Duration) {
+
+	dentryTimeout, attrTimeout := defaultCacheTimeout, defaultCacheTimeout
+	dynamicDentryTimeout := defaultDynamicDentryCacheTimeout
+
+	if dentry != nil {
+		dentryTimeout = int64(*dentry)
+	}
+	if dynamicDentry != nil {
+		dynamicDentryTimeout = int64(*dynamicDentry)
+	}
+	if attr != nil {
+		attrTimeout = int64(*attr)
+	}
+
+	atomic.StoreInt64(&DentryCacheTimeout, dentryTimeout)
+	atomic.StoreInt64(&DynamicDentryCacheTimeout, dynamicDentryTimeout)
+	atomic.StoreInt64(&AttribCacheTimeout, attrTimeout)
+}
+
+// Owners of the emulated files (i.e., those owned by the host's root user):
+// the container's root user (default), or the overflow user (i.e., "nobody"),
+// in which case files are presented with the host's root uid & gid, which are
+// never mapped within the sys container's user-ns.
+const (
+	FilesOwnerRoot   = "root"
+	FilesOwnerNobody = "nobody"
+)
+
+var filesOwnerNobody int32
+
+// SetFilesOwner sets the owner of the emulated files. Only nodes looked up
+// after this call are affected, so this setting is expected to be defined
+// during sysbox-fs initialization.
+func SetFilesOwner(owner string) error {
+
+	var nobody int32
+
+	switch owner {
+	case "", FilesOwnerRoot:
+	case FilesOwnerNobody:
+		nobody = 1
+	default:
+		return fmt.Errorf("emulated files owner '%v' not recognized", owner)
+	}
+
+	atomic.StoreInt32(&filesOwnerNobody, nobody)
+
+	return nil
+}
+
 // Dir struct serves as a FUSE-friendly abstraction to represent directories
 // present in the host FS.
 type Dir struct {
@@ -78,6 +146,11 @@ func (d *Dir) Lookup(
 	logrus.Debugf("Requested Lookup() operation for entry %v (req ID=%#x)",
 		req.Name, uint64(req.ID))
 
+	if !d.server.opBegin(fuseOpLookup) {
+		return nil, errDraining
+	}
+	defer d.server.opEnd()
+
 	path := filepath.Join(d.path, req.Name)
 
 	// nodeDB caches the attributes associated with each file. This way, we perform the
@@ -87,10 +160,17 @@ func (d *Dir) Lookup(
 	//   * all attributes of procfs/sysfs dirs/files are static (e.g., permissions never
 	//     change, and uid/gid values match those of the root user in the sys-container's
 	//     user-ns as long as user-ns-nesting continue to be unsupported).
+	//
+	// Dynamic nodes are the exception, as these may cease to exist at any time:
+	// their lookups are always dispatched to their handlers, and the nodeDB is
+	// only utilized to preserve their node objects.
+	entryValid, dynamic := d.server.dentryTimeout(path)
+
 	d.server.RLock()
-	node, ok := d.server.nodeDB[path]
-	if ok {
+	node, cached := d.server.nodeDB[path]
+	if cached && !dynamic {
 		d.server.RUnlock()
+		resp.EntryValid = entryValid
 		return *node, nil
 	}
 	d.server.RUnlock()
@@ -125,29 +205,44 @@ func (d *Dir) Lookup(
 	}
 
 	// Handler execution.
+	start := time.Now()
 	info, err := handler.Lookup(ionode, handlerReq)
+	d.server.handlerOpDone(handler, domain.HandlerOpLookup, handlerReq, path, start, err)
 	if err != nil {
+		d.server.stats.incError(fuseOpLookup)
+		if cached {
+			d.server.Lock()
+			delete(d.server.nodeDB, path)
+			d.server.Unlock()
+		}
 		return nil, fuse.ENOENT
 	}
 
+	// Dynamic node still present: preserve its node object.
+	if cached {
+		resp.EntryValid = entryValid
+		return *node, nil
+	}
+
 	// Convert os.FileInfo attributes to fuseAttr format.
 	fuseAttrs := convertFileInfoToFuse(info)
+	d.server.assignInode(path, &fuseAttrs)
 
-	// Identify the root uid & gid in the requester's user-ns.
-	prs := d.server.service.hds.ProcessService()
-	process := prs.ProcessCreate(req.Pid, req.Uid, req.Gid)
-
-	rootUid, rootGid, err := process.UsernsRootUidGid()
-	if err != nil {
-		return nil, err
-	}
-
-	// Override the uid & gid attributes with the root uid & gid in the requester's
-	// user-ns if, and only if, these ones have not been explicitly banned from
+	// Override the uid & gid attributes with the ones of the emulated files'
+	// owner if, and only if, these ones have not been explicitly banned from
 	// being remapped.
 	if !handlerReq.SkipIdRemap {
-		fuseAttrs.Uid = rootUid
-		fuseAttrs.Gid = rootGid
+		uid, gid, err := d.server.filesOwner(req.Pid, req.Uid, req.Gid)
+		if err != nil {
+			return nil, err
+		}
+		fuseAttrs.Uid = uid
+		fuseAttrs.Gid = gid
+	}
+
+	// Mode & ownership altered within the container (see Setattr()).
+	if attr, ok := d.server.container.NodeAttr(path); ok {
+		applyNodeAttr(&fuseAttrs, attr)
 	}
 
 	var newNode fs.Node
@@ -164,9 +259,10 @@ func (d *Dir) Lookup(
 	d.server.nodeDB[path] = &newNode
 	d.server.Unlock()
 
-	// Adjust response to carry the largest dentry-cache-timeout value
-	// possible to reduce lookups() to the minimum.
-	resp.EntryValid = time.Duration(DentryCacheTimeout)
+	// Adjust response to carry the dentry-cache-timeout of the node's class,
+	// which for static nodes is the largest value possible to reduce lookups()
+	// to the minimum.
+	resp.EntryValid = entryValid
 
 	return newNode, nil
 }
@@ -201,6 +297,11 @@ func (d *Dir) Create(
 
 	logrus.Debugf("Requested Create() operation for entry %v (req ID=%#x)", req.Name, uint64(req.ID))
 
+	if !d.server.opBegin(fuseOpCreate) {
+		return nil, nil, errDraining
+	}
+	defer d.server.opEnd()
+
 	// Ensure operation is generated from within a registered sys container.
 	if d.server.container == nil {
 		logrus.Errorf("Could not find the container originating this request (pid %v)",
@@ -209,6 +310,11 @@ func (d *Dir) Create(
 			req.Pid)
 	}
 
+	if !d.server.reserveHandle() {
+		d.server.stats.incError(fuseOpCreate)
+		return nil, nil, IOerror{Code: syscall.EMFILE}
+	}
+
 	path := filepath.Join(d.path, req.Name)
 
 	// New ionode reflecting the path of the element to be created.
@@ -219,6 +325,7 @@ func (d *Dir) Create(
 	// Lookup the associated handler within handler-DB.
 	handler, ok := d.server.service.hds.LookupHandler(ionode)
 	if !ok {
+		d.server.releaseHandle()
 		logrus.Errorf("No supported handler for %v resource", path)
 		return nil, nil, fmt.Errorf("No supported handler for %v resource", path)
 	}
@@ -235,35 +342,46 @@ func (d *Dir) Create(
 
 	// Handler execution. 'Open' handler will create new element if requesting
 	// process has the proper credentials / capabilities.
+	start := time.Now()
 	err := handler.Open(ionode, handlerReq)
+	d.server.handlerOpDone(handler, domain.HandlerOpOpen, handlerReq, path, start, err)
 	if err != nil && err != io.EOF {
+		d.server.releaseHandle()
 		logrus.Debugf("Open() error: %v", err)
+		d.server.stats.incError(fuseOpCreate)
 		return nil, nil, err
 	}
 	resp.Flags |= fuse.OpenDirectIO
 
 	// To satisfy Bazil FUSE lib we are expected to return a lookup-response
 	// and an open-response, let's start with the lookup() one.
+	start = time.Now()
 	info, err := handler.Lookup(ionode, handlerReq)
+	d.server.handlerOpDone(handler, domain.HandlerOpLookup, handlerReq, path, start, err)
 	if err != nil {
+		d.server.releaseHandle()
+		d.server.stats.incError(fuseOpCreate)
 		return nil, nil, fuse.ENOENT
 	}
 
 	// Extract received file attributes.
 	fuseAttrs := convertFileInfoToFuse(info)
+	d.server.assignInode(path, &fuseAttrs)
 
 	// Adjust response to carry the proper dentry-cache-timeout value.
-	resp.EntryValid = time.Duration(DentryCacheTimeout)
+	resp.EntryValid, _ = d.server.dentryTimeout(path)
+
+	newFile := NewFile(handlerReq, &fuseAttrs, d.File.server)
 
 	var newNode fs.Node
-	newNode = NewFile(handlerReq, &fuseAttrs, d.File.server)
+	newNode = newFile
 
 	// Insert new fs node into nodeDB.
 	d.server.Lock()
 	d.server.nodeDB[path] = &newNode
 	d.server.Unlock()
 
-	return newNode, newNode, nil
+	return newNode, newFileHandle(newFile, req.Flags), nil
 }
 
 // ReadDirAll FS operation.
@@ -273,6 +391,11 @@ func (d *Dir) ReadDirAll(ctx context.Context, req *fuse.ReadRequest) ([]fuse.Dir
 
 	logrus.Debugf("Requested ReadDirAll() on directory %v (req ID=%#v)", d.path, uint64(req.ID))
 
+	if !d.server.opBegin(fuseOpReadDirAll) {
+		return nil, errDraining
+	}
+	defer d.server.opEnd()
+
 	// Ensure operation is generated from within a registered sys container.
 	if d.server.container == nil {
 		logrus.Errorf("Could not find the container originating this request (pid %v)",
@@ -301,9 +424,12 @@ func (d *Dir) ReadDirAll(ctx context.Context, req *fuse.ReadRequest) ([]fuse.Dir
 	}
 
 	// Handler execution.
+	start := time.Now()
 	files, err := handler.ReadDirAll(ionode, handlerReq)
+	d.server.handlerOpDone(handler, domain.HandlerOpReadDirAll, handlerReq, d.path, start, err)
 	if err != nil {
 		logrus.Debugf("ReadDirAll() error: %v", err)
+		d.server.stats.incError(fuseOpReadDirAll)
 		return nil, fuse.ENOENT
 	}
 
@@ -321,6 +447,13 @@ func (d *Dir) ReadDirAll(ctx context.Context, req *fuse.ReadRequest) ([]fuse.Dir
 
 		elem := fuse.Dirent{Name: node.Name()}
 
+		// Entries carry the same inode numbers reported by their attributes.
+		if st, ok := node.Sys().(*syscall.Stat_t); ok && st != nil {
+			elem.Inode = st.Ino
+		} else if d.server.inodes != nil {
+			elem.Inode = d.server.inodes.inode(filepath.Join(d.path, node.Name()))
+		}
+
 		if node.IsDir() {
 			elem.Type = fuse.DT_Dir
 		} else if node.Mode().IsRegular() {
@@ -338,6 +471,11 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 
 	logrus.Debugf("Requested Mkdir() on directory %v (Req ID=%#v)", req.Name, uint64(req.ID))
 
+	if !d.server.opBegin(fuseOpMkdir) {
+		return nil, errDraining
+	}
+	defer d.server.opEnd()
+
 	// Ensure operation is generated from within a registered sys container.
 	if d.server.container == nil {
 		logrus.Errorf("Could not find the container originating this request (pid %v)",
@@ -0,0 +1,95 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//
+// Tracks the FUSE operations in-flight within a fuse-server, so that these
+// can be drained (i.e., completed) before the fuse-server is torn down. Once
+// draining starts, no new operations are accepted.
+//
+type fuseServerDrain struct {
+	sync.Mutex
+	inflight int           // number of operations being served
+	draining bool          // set once draining has started
+	drained  chan struct{} // closed when the last in-flight operation completes
+}
+
+// Registers the beginning of an operation. Returns false if the fuse-server is
+// being drained, in which case the operation must be rejected.
+func (d *fuseServerDrain) begin() bool {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.draining {
+		return false
+	}
+	d.inflight++
+
+	return true
+}
+
+// Registers the completion of an operation.
+func (d *fuseServerDrain) end() {
+	d.Lock()
+	defer d.Unlock()
+
+	d.inflight--
+
+	if d.draining && d.inflight == 0 && d.drained != nil {
+		close(d.drained)
+		d.drained = nil
+	}
+}
+
+// Reports whether there are operations in-flight.
+func (d *fuseServerDrain) busy() bool {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.inflight > 0
+}
+
+// Stops accepting new operations and waits for the in-flight ones to complete,
+// or for the given timeout to expire.
+func (d *fuseServerDrain) drain(timeout time.Duration) error {
+
+	d.Lock()
+	d.draining = true
+	if d.inflight == 0 {
+		d.Unlock()
+		return nil
+	}
+	drained := make(chan struct{})
+	d.drained = drained
+	d.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+
+	case <-time.After(timeout):
+		d.Lock()
+		defer d.Unlock()
+		return fmt.Errorf("%d operations still in-flight after %v", d.inflight, timeout)
+	}
+}
@@ -0,0 +1,57 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFuseServerDrain(t *testing.T) {
+
+	// Idle fuse-server: draining completes right away.
+	d := &fuseServerDrain{}
+	if err := d.drain(time.Millisecond); err != nil {
+		t.Fatalf("drain() unexpected error: %v", err)
+	}
+	if d.begin() {
+		t.Errorf("begin() accepted an operation while draining")
+	}
+
+	// Busy fuse-server: draining waits for in-flight operations.
+	d = &fuseServerDrain{}
+	if !d.begin() {
+		t.Fatalf("begin() rejected an operation while not draining")
+	}
+
+	go func(d *fuseServerDrain) {
+		time.Sleep(10 * time.Millisecond)
+		d.end()
+	}(d)
+
+	if err := d.drain(time.Second); err != nil {
+		t.Errorf("drain() unexpected error: %v", err)
+	}
+
+	// Stuck operation: draining times out.
+	d = &fuseServerDrain{}
+	d.begin()
+
+	if err := d.drain(10 * time.Millisecond); err == nil {
+		t.Errorf("drain() expected timeout error")
+	}
+}
@@ -0,0 +1,199 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-libs/formatter"
+)
+
+//
+// Container-engine fast path (e.g., Docker-in-Docker).
+//
+// Upon start-up, container engines (dockerd, containerd) running within a sys
+// container access a well-known set of emulated resources (i.e., forwarding and
+// br_netfilter sysctls, cgroup controllers), which are served through nsenter
+// cycles the first time they're accessed. To cut the engine's start-up latency,
+// the first access to any of these resources by an engine process triggers the
+// concurrent pre-warming of the rest: these are read on behalf of the sys
+// container's init process, which populates the handlers' (and read-cache)
+// state before the engine gets to them. The container's mountinfo (i.e.,
+// overlayfs mounts) is parsed in the process as well, which primes the
+// mountinfo cache utilized by the mount syscall handlers.
+//
+// Pre-warming is carried out at most once every engineWarmupInterval per sys
+// container (i.e., engine restarts within that period don't trigger it again).
+//
+
+// Resources accessed by container engines during their start-up.
+var engineWarmupPaths = []string{
+	"/proc/sys/net/ipv4/ip_forward",
+	"/proc/sys/net/ipv4/ip_local_port_range",
+	"/proc/sys/net/ipv6/conf/all/forwarding",
+	"/proc/sys/net/ipv6/conf/default/forwarding",
+	"/proc/sys/net/bridge/bridge-nf-call-iptables",
+	"/proc/sys/net/bridge/bridge-nf-call-ip6tables",
+	"/proc/cgroups",
+	"/sys/fs/cgroup/cgroup.controllers",
+	"/sys/fs/cgroup/cgroup.subtree_control",
+}
+
+// Processes (comm) identified as container engines.
+var engineComms = map[string]bool{
+	"dockerd":    true,
+	"containerd": true,
+}
+
+// Minimum time between pre-warming rounds of a sys container.
+const engineWarmupInterval = time.Minute
+
+// Max concurrent reads issued by a pre-warming round.
+const engineWarmupWorkers = 4
+
+// Size of the buffer utilized to read each resource.
+const engineWarmupBufSize = 4096
+
+var engineWarmupSet = func() map[string]bool {
+	m := make(map[string]bool, len(engineWarmupPaths))
+	for _, p := range engineWarmupPaths {
+		m[p] = true
+	}
+	return m
+}()
+
+// Tracks the access to the given node by the given process, launching the
+// pre-warming of the engine resources if it's the first one by a container
+// engine.
+func (s *fuseServer) engineAccess(path string, pid uint32) {
+
+	// The requester is only looked into for the resources of interest, so that
+	// other accesses don't pay for it.
+	if !engineWarmupSet[path] || !s.cntrReg {
+		return
+	}
+
+	last := atomic.LoadInt64(&s.engineWarmed)
+	if last != 0 && time.Since(time.Unix(0, last)) < engineWarmupInterval {
+		return
+	}
+
+	prs := s.service.hds.ProcessService()
+	process := prs.ProcessCreate(pid, 0, 0)
+
+	comm, err := process.Comm()
+	if err != nil || !engineComms[comm] {
+		return
+	}
+
+	// Cached state is only utilized at the sys container level (i.e., not by
+	// engines within inner containers or unshared namespaces).
+	if !domain.ProcessNsMatch(process, s.container.InitProc()) {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt64(&s.engineWarmed, last, time.Now().UnixNano()) {
+		return
+	}
+
+	logrus.Debugf("Container engine %s (pid %d) detected in container %s; pre-warming its resources",
+		comm, pid, formatter.ContainerID{s.container.ID()})
+
+	go s.engineWarmup(path)
+}
+
+// Reads the engine resources (but the one already being accessed) on behalf of
+// the sys container's init process.
+func (s *fuseServer) engineWarmup(skip string) {
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	paths := make(chan string)
+
+	for i := 0; i < engineWarmupWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				s.warmupRead(path)
+			}
+		}()
+	}
+
+	for _, path := range engineWarmupPaths {
+		if path != skip {
+			paths <- path
+		}
+	}
+	close(paths)
+
+	// Prime the mountinfo cache (i.e., parse the container's mount table).
+	mts := s.service.css.MountService()
+	if mts != nil {
+		if _, err := mts.NewMountInfoParser(
+			s.container, s.container.InitProc(), true, true, false); err != nil {
+			logrus.Debugf("Mountinfo pre-warming of container %s failed: %v",
+				formatter.ContainerID{s.container.ID()}, err)
+		}
+	}
+
+	wg.Wait()
+
+	logrus.Debugf("Container %s resources pre-warmed in %v",
+		formatter.ContainerID{s.container.ID()}, time.Since(start))
+}
+
+func (s *fuseServer) warmupRead(path string) {
+
+	ionode := s.service.ios.NewIOnode(filepath.Base(path), path, 0)
+
+	handler, ok := s.service.hds.LookupHandler(ionode)
+	if !ok {
+		return
+	}
+
+	buf := domain.GetBuffer(engineWarmupBufSize)
+	defer domain.PutBuffer(buf)
+
+	pid := s.container.InitPid()
+
+	req := &domain.HandlerRequest{
+		Pid:       pid,
+		Uid:       s.ContainerUID(),
+		Gid:       s.ContainerGID(),
+		Data:      *buf,
+		Container: s.container,
+	}
+
+	n, err := handler.Read(ionode, req)
+	if err != nil {
+		logrus.Debugf("Pre-warming of %s failed: %v", path, err)
+		return
+	}
+
+	if s.readCacheable(path, pid, s.ContainerUID(), s.ContainerGID()) &&
+		!req.NoCache && n < len(*buf) {
+		s.readCache.store(path, req.Data[:n])
+	}
+}
@@ -0,0 +1,232 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+// Process with the given comm and namespaces.
+type engineTestProcess struct {
+	domain.ProcessIface
+	comm string
+	ns   map[string]domain.Inode
+}
+
+func (p *engineTestProcess) Comm() (string, error) {
+	return p.comm, nil
+}
+
+func (p *engineTestProcess) NsInodes() (map[string]domain.Inode, error) {
+	return p.ns, nil
+}
+
+type engineTestProcessService struct {
+	domain.ProcessServiceIface
+	procs map[uint32]*engineTestProcess
+}
+
+func (ps *engineTestProcessService) ProcessCreate(pid, uid, gid uint32) domain.ProcessIface {
+	return ps.procs[pid]
+}
+
+type engineTestNode struct {
+	domain.IOnodeIface
+	path string
+}
+
+func (n *engineTestNode) Path() string {
+	return n.path
+}
+
+// Handler recording the nodes read (and the requesters).
+type warmupRecorder struct {
+	domain.HandlerIface
+	sync.Mutex
+	paths []string
+	pids  []uint32
+}
+
+func (h *warmupRecorder) Read(n domain.IOnodeIface, req *domain.HandlerRequest) (int, error) {
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.paths = append(h.paths, n.Path())
+	h.pids = append(h.pids, req.Pid)
+
+	return copy(req.Data, "0\n"), nil
+}
+
+func (h *warmupRecorder) reads() ([]string, []uint32) {
+
+	h.Lock()
+	defer h.Unlock()
+
+	return append([]string(nil), h.paths...), append([]uint32(nil), h.pids...)
+}
+
+func TestEngineAccessFiltering(t *testing.T) {
+
+	// The server lacks a service, so any attempt to inspect the requester (or
+	// to pre-warm) would panic.
+	s := &fuseServer{cntrReg: true}
+
+	// Resources other than the engine ones are not looked into.
+	s.engineAccess("/proc/uptime", 1)
+	s.engineAccess("/proc/sys/net/ipv4/ip_forward_use_pmtu", 1)
+
+	// Neither are the engine ones of unregistered containers ...
+	s.cntrReg = false
+	s.engineAccess("/proc/sys/net/ipv4/ip_forward", 1)
+
+	// ... nor the ones of containers pre-warmed recently.
+	s.cntrReg = true
+	s.engineWarmed = time.Now().UnixNano()
+	for _, path := range engineWarmupPaths {
+		s.engineAccess(path, 1)
+	}
+}
+
+func TestEngineWarmup(t *testing.T) {
+
+	ttl := time.Minute
+	SetReadCache(&ttl, []string{"/proc/sys/net"})
+	defer SetReadCache(nil, nil)
+
+	cntrNs := map[string]domain.Inode{"net": 1, "pid": 2}
+	innerNs := map[string]domain.Inode{"net": 3, "pid": 4}
+
+	initProc := &engineTestProcess{comm: "init", ns: cntrNs}
+	prs := &engineTestProcessService{procs: map[uint32]*engineTestProcess{
+		1001: initProc,
+		1002: {comm: "sh", ns: cntrNs},
+		1003: {comm: "dockerd", ns: innerNs},
+		1004: {comm: "dockerd", ns: cntrNs},
+	}}
+
+	cntr := &mocks.ContainerIface{}
+	cntr.On("ID").Return("c1")
+	cntr.On("InitPid").Return(uint32(1001))
+	cntr.On("InitProc").Return(initProc)
+	cntr.On("UID").Return(uint32(231072))
+	cntr.On("GID").Return(uint32(231072))
+
+	ios := &mocks.IOServiceIface{}
+	ios.On("NewIOnode", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(n, p string, attr os.FileMode) domain.IOnodeIface {
+			return &engineTestNode{path: p}
+		})
+
+	hdl := &warmupRecorder{}
+
+	hds := &mocks.HandlerServiceIface{}
+	hds.On("ProcessService").Return(prs)
+	hds.On("LookupHandler", mock.Anything).Return(hdl, true)
+
+	css := &mocks.ContainerStateServiceIface{}
+	css.On("MountService").Return(nil)
+
+	s := &fuseServer{
+		container: cntr,
+		cntrReg:   true,
+		service:   &FuseServerService{ios: ios, hds: hds, css: css},
+	}
+
+	accessed := "/proc/sys/net/ipv4/ip_forward"
+
+	// Neither non-engine processes, nor engines within inner containers,
+	// trigger the pre-warming.
+	s.engineAccess(accessed, 1002)
+	s.engineAccess(accessed, 1003)
+
+	if atomic.LoadInt64(&s.engineWarmed) != 0 {
+		t.Fatalf("resources pre-warmed upon a non-engine access")
+	}
+
+	// Engines at the sys container level do.
+	s.engineAccess(accessed, 1004)
+
+	if atomic.LoadInt64(&s.engineWarmed) == 0 {
+		t.Fatalf("resources not pre-warmed upon an engine access")
+	}
+
+	// All the engine resources but the accessed one are read on behalf of
+	// the sys container's init process.
+	want := []string{}
+	for _, path := range engineWarmupPaths {
+		if path != accessed {
+			want = append(want, path)
+		}
+	}
+	sort.Strings(want)
+
+	buf := make([]byte, 16)
+	cached := func(path string) (string, bool) {
+		n, ok := s.readCache.read(path, 0, buf)
+		return string(buf[:n]), ok
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	paths, pids := hdl.reads()
+	for time.Now().Before(deadline) {
+		if _, ok := cached("/proc/sys/net/ipv4/ip_local_port_range"); ok &&
+			len(paths) == len(want) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+		paths, pids = hdl.reads()
+	}
+
+	sort.Strings(paths)
+	if len(paths) != len(want) {
+		t.Fatalf("pre-warmed resources = %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("pre-warmed resource %s, want %s", paths[i], want[i])
+		}
+		if pids[i] != 1001 {
+			t.Errorf("resource pre-warmed on behalf of pid %d, want 1001", pids[i])
+		}
+	}
+
+	// The cacheable ones are stored in the read-cache.
+	if data, ok := cached("/proc/sys/net/ipv4/ip_local_port_range"); !ok || data != "0\n" {
+		t.Errorf("pre-warmed resource not cached: %q, %v", data, ok)
+	}
+	if _, ok := cached("/proc/cgroups"); ok {
+		t.Errorf("non-cacheable pre-warmed resource cached")
+	}
+
+	// Engine restarts within the pre-warming interval don't trigger it again.
+	warmed := atomic.LoadInt64(&s.engineWarmed)
+	s.engineAccess(accessed, 1004)
+
+	if atomic.LoadInt64(&s.engineWarmed) != warmed {
+		t.Errorf("resources pre-warmed twice within %v", engineWarmupInterval)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -29,6 +30,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
+	cap "github.com/nestybox/sysbox-libs/capability"
 )
 
 type File struct {
@@ -46,6 +48,13 @@ type File struct {
 
 	// Pointer to parent fuseService hosting this file/dir.
 	server *fuseServer
+
+	// Handles currently opened on this file.
+	handles *fileHandleSet
+
+	// Size of the file's contents as of its last mmap-able open (accessed
+	// atomically).
+	mmapSize int64
 }
 
 // NewFile method serves as File constructor.
@@ -57,6 +66,7 @@ func NewFile(req *domain.HandlerRequest, attr *fuse.Attr, srv *fuseServer) *File
 		attr:        attr,
 		skipIdRemap: req.SkipIdRemap,
 		server:      srv,
+		handles:     newFileHandleSet(),
 	}
 
 	return newFile
@@ -67,25 +77,26 @@ func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
 
 	logrus.Debugf("Requested Attr() operation for entry %v", f.path)
 
+	if !f.server.opBegin(fuseOpAttr) {
+		return errDraining
+	}
+	defer f.server.opEnd()
+
 	// Simply return the attributes that were previously collected during the
 	// lookup() execution.
 	*a = *f.attr
 
-	// Override the uid & gid attributes with the user-ns' root uid & gid of the
-	// sys container under which the request is received. In the future we should
-	// return the requester's user-ns root uid & gid instead, which could differ
-	// from the sys container's one if request is originated from an L2 container.
-	// Also, this will help us to support "unshare -U -m --mount-proc" inside a
-	// sys container.
+	// Override the uid & gid attributes with the ones of the emulated files'
+	// owner (by default, the user-ns' root uid & gid of the sys container under
+	// which the request is received). In the future we should return the
+	// requester's user-ns root uid & gid instead, which could differ from the
+	// sys container's one if request is originated from an L2 container. Also,
+	// this will help us to support "unshare -U -m --mount-proc" inside a sys
+	// container.
 	//
 	// Notice, that in certain cases we may want to skip this uid/gid remapping
 	// process for certain nodes if its associated handler requests so.
-	if a.Uid == 0 && !f.skipIdRemap {
-		a.Uid = f.server.ContainerUID()
-	}
-	if a.Gid == 0 && !f.skipIdRemap {
-		a.Gid = f.server.ContainerGID()
-	}
+	f.remapOwner(a, 0, 0, 0)
 
 	// As per man fuse(4), here we set the attribute's cache-duration to the
 	// largest possible value to ensure getattr()s are only received once per
@@ -100,7 +111,81 @@ func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
 	if !f.server.IsCntrRegCompleted() {
 		a.Valid = time.Duration(0)
 	} else {
-		a.Valid = time.Duration(AttribCacheTimeout)
+		a.Valid = time.Duration(atomic.LoadInt64(&AttribCacheTimeout))
+	}
+
+	// Nodes that can be mmap()ed report the size of their contents as of their
+	// last open. As contents vary across opens, these attributes are never
+	// cached.
+	if !a.Mode.IsDir() && mmapEnabled(f.path) {
+		a.Size = uint64(atomic.LoadInt64(&f.mmapSize))
+		a.Valid = time.Duration(0)
+	}
+
+	return nil
+}
+
+// Access FS operation.
+func (f *File) Access(ctx context.Context, req *fuse.AccessRequest) error {
+
+	logrus.Debugf("Requested Access() operation for entry %v (Req ID=%#v)",
+		f.path, uint64(req.ID))
+
+	if !f.server.opBegin(fuseOpAccess) {
+		return errDraining
+	}
+	defer f.server.opEnd()
+
+	// Permissions are evaluated against the attributes exposed by Attr(), that
+	// is, with the emulated files owned by the sys container's root user (or,
+	// while the container's registration is in progress, by the root user of
+	// the requester's user-ns).
+	//
+	// Notice that both the requester's credentials and the node's owner are
+	// host ids. The requester's capabilities are only honored if the node's
+	// owner is mapped within the requester's user-ns (as the kernel does), so
+	// non-root processes, as well as processes of nested containers accessing
+	// nodes owned by their ancestors, get the proper permission errors.
+	a := *f.attr
+	if err := f.remapOwner(&a, req.Pid, req.Uid, req.Gid); err != nil {
+		logrus.Debugf("Access() error: %v", err)
+		f.server.stats.incError(fuseOpAccess)
+		return IOerror{Code: syscall.EACCES}
+	}
+
+	prs := f.server.service.hds.ProcessService()
+	process := prs.ProcessCreate(req.Pid, req.Uid, req.Gid)
+
+	err := process.CheckAccess(a.Uid, a.Gid, a.Mode, domain.AccessMode(req.Mask&0x7))
+	if err != nil {
+		f.server.stats.incError(fuseOpAccess)
+	}
+	if err == syscall.EACCES {
+		return IOerror{Code: syscall.EACCES}
+	}
+
+	return err
+}
+
+// Replaces the root uid & gid of the given attributes with the ones of the
+// emulated files' owner, unless the node's handler asked to skip this. The
+// requester's credentials (if any) are utilized to find out the owner during
+// the container's registration.
+func (f *File) remapOwner(a *fuse.Attr, pid, uid, gid uint32) error {
+
+	if (a.Uid != 0 && a.Gid != 0) || f.skipIdRemap {
+		return nil
+	}
+
+	ownerUid, ownerGid, err := f.server.filesOwner(pid, uid, gid)
+	if err != nil {
+		return err
+	}
+	if a.Uid == 0 {
+		a.Uid = ownerUid
+	}
+	if a.Gid == 0 {
+		a.Gid = ownerGid
 	}
 
 	return nil
@@ -112,9 +197,31 @@ func (f *File) Open(
 	req *fuse.OpenRequest,
 	resp *fuse.OpenResponse) (fs.Handle, error) {
 
+	h, err := f.open(ctx, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Flags.IsReadOnly() && mmapEnabled(f.path) {
+		f.enableMmap(ctx, req, resp, h)
+	}
+
+	return h, nil
+}
+
+func (f *File) open(
+	ctx context.Context,
+	req *fuse.OpenRequest,
+	resp *fuse.OpenResponse) (*fileHandle, error) {
+
 	logrus.Debugf("Requested Open() operation for entry %v (Req ID=%#v)",
 		f.path, uint64(req.ID))
 
+	if !f.server.opBegin(fuseOpOpen) {
+		return nil, errDraining
+	}
+	defer f.server.opEnd()
+
 	// Ensure operation is generated from within a registered sys container.
 	if f.server.container == nil {
 		logrus.Errorf("Could not find the container originating this request (pid %v)",
@@ -123,12 +230,21 @@ func (f *File) Open(
 			req.Pid)
 	}
 
+	if !f.server.reserveHandle() {
+		f.server.stats.incError(fuseOpOpen)
+		return nil, IOerror{Code: syscall.EMFILE}
+	}
+
+	// Container engines starting up get their resources pre-warmed.
+	f.server.engineAccess(f.path, req.Pid)
+
 	ionode := f.server.service.ios.NewIOnode(f.name, f.path, f.attr.Mode)
 	ionode.SetOpenFlags(int(req.Flags))
 
 	// Lookup the associated handler within handler-DB.
 	handler, ok := f.server.service.hds.LookupHandler(ionode)
 	if !ok {
+		f.server.releaseHandle()
 		logrus.Errorf("No supported handler for %v resource", f.path)
 		return nil, fmt.Errorf("No supported handler for %v resource", f.path)
 	}
@@ -142,9 +258,15 @@ func (f *File) Open(
 	}
 
 	// Handler execution.
+	start := time.Now()
 	err := handler.Open(ionode, handlerReq)
+	f.server.handlerOpDone(handler, domain.HandlerOpOpen, handlerReq, f.path, start, err)
+	f.server.securityCheck(domain.HandlerOpOpen, handlerReq, f.path,
+		!req.Flags.IsReadOnly(), err)
 	if err != nil && err != io.EOF {
+		f.server.releaseHandle()
 		logrus.Debugf("Open() error: %v", err)
+		f.server.stats.incError(fuseOpOpen)
 		return nil, err
 	}
 
@@ -164,10 +286,96 @@ func (f *File) Open(
 	//
 	resp.Flags |= fuse.OpenDirectIO
 
-	return f, nil
+	return newFileHandle(f, req.Flags), nil
+}
+
+//
+// Read-only opens of the nodes that can be mmap()ed are served through the
+// kernel's page-cache (i.e., no O_DIRECT), as mmap() of O_DIRECT files is not
+// supported (ENODEV) by the kernel. For the page-cache to work, the kernel must
+// be aware of the node's size, so the node's contents are captured right away
+// (i.e., the handle's snapshot), and their size is reported by Attr().
+//
+// Nodes whose contents exceed the handle's snapshot (or that fail to be read)
+// fall back to O_DIRECT (i.e., read emulation), in which case mmap() is not
+// available.
+//
+// Notice that the page-cache is shared by all the handles opened on a node, so
+// concurrent readers of a node may not get their own contents as with O_DIRECT
+// opens, which is why this is restricted to the configured nodes.
+//
+func (f *File) enableMmap(
+	ctx context.Context,
+	req *fuse.OpenRequest,
+	resp *fuse.OpenResponse,
+	h *fileHandle) {
+
+	size, complete, err := h.prefetch(ctx, req.Header)
+	if err != nil || !complete {
+		logrus.Debugf("Open() of entry %v not mmap-able: %v (complete = %v)",
+			f.path, err, complete)
+		return
+	}
+
+	atomic.StoreInt64(&f.mmapSize, int64(size))
+	resp.Flags &^= fuse.OpenDirectIO
+}
+
+// Fsync FS operation. Commits the writes pending on the handles opened on this
+// file, so that failures are reported to the process syncing it.
+func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+
+	logrus.Debugf("Requested Fsync() operation for entry %v (Req ID=%#v)",
+		f.path, uint64(req.ID))
+
+	// Notice that no operation is begun here (i.e., opBegin()), as commits are
+	// carried out through Write(), which begins its own.
+	f.server.stats.incOp(fuseOpFsync)
+
+	var firstErr error
+
+	for _, h := range f.handles.list() {
+		h.Lock()
+		err := h.flush(ctx)
+		h.Unlock()
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr != nil {
+		f.server.stats.incError(fuseOpFsync)
+	}
+
+	return firstErr
+}
+
+// Returns the write mode of this file, as dictated by its handler.
+func (f *File) writeMode() domain.WriteMode {
+
+	ionode := f.server.service.ios.NewIOnode(f.name, f.path, f.attr.Mode)
+
+	handler, ok := f.server.service.hds.LookupHandler(ionode)
+	if !ok {
+		return domain.WriteModeBack
+	}
+
+	// Nodes passed through within this container are written through,
+	// regardless of the (container agnostic) write mode of their handler.
+	if f.passedThrough(handler, ionode) {
+		return domain.WriteModeThrough
+	}
+
+	if wm, ok := handler.(domain.HandlerWriteModeIface); ok {
+		return wm.GetWriteMode(ionode)
+	}
+
+	return domain.WriteModeBack
 }
 
-// Release FS operation.
+// Release FS operation. Reached through fileHandle.Release(), once the handle has
+// committed its pending writes and dropped its cached contents.
 func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
 
 	logrus.Debugf("Requested Release() operation for entry %v (Req ID=%#v)",
@@ -190,10 +398,10 @@ func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
 	// die upon completion, which will necessarily end up with the process'
 	// fd-table getting wiped out by kernel upon process' exit().
 	//
-	// That is all to say, that there is no need to do anything with these
-	// release() requests, as the associated inode is already closed by the
-	// time these requests arrive. And that covers both non-emulated ('nsexec')
-	// and emulated nodes.
+	// That is all to say, that there is nothing left to do here for these
+	// release() requests (other than the handle's own cleanup), as the
+	// associated inode is already closed by the time these requests arrive.
+	// And that covers both non-emulated ('nsexec') and emulated nodes.
 
 	return nil
 }
@@ -207,6 +415,11 @@ func (f *File) Read(
 	logrus.Debugf("Requested Read() operation for entry %v (Req ID=%#v)",
 		f.path, uint64(req.ID))
 
+	if !f.server.opBegin(fuseOpRead) {
+		return errDraining
+	}
+	defer f.server.opEnd()
+
 	// Ensure operation is generated from within a registered sys container.
 	if f.server.container == nil {
 		logrus.Errorf("Could not find the container originating this request (pid %v)",
@@ -224,24 +437,51 @@ func (f *File) Read(
 		return fmt.Errorf("No supported handler for %v resource", f.path)
 	}
 
+	// The handler's buffer is obtained from the buffer pool, so the response
+	// is copied out of it before returning. Notice that handlers may replace
+	// the request's buffer (e.g., by one holding cached data), so the pooled
+	// one is tracked separately.
+	buf := domain.GetBuffer(req.Size)
+	defer domain.PutBuffer(buf)
+
 	handlerReq := &domain.HandlerRequest{
 		ID:        uint64(req.ID),
 		Pid:       req.Pid,
 		Uid:       req.Uid,
 		Gid:       req.Gid,
 		Offset:    req.Offset,
-		Data:      make([]byte, req.Size),
+		Data:      *buf,
 		Container: f.server.container,
 	}
 
+	// Serve the request from the read-cache if possible. As the contents of
+	// most nodes depend on the namespaces of the requester, the read-cache is
+	// only utilized by processes at the sys container level (i.e., not within
+	// inner containers or unshared namespaces).
+	cacheable := f.server.readCacheable(f.path, req.Pid, req.Uid, req.Gid)
+	if cacheable {
+		if n, ok := f.server.readCache.read(f.path, req.Offset, handlerReq.Data); ok {
+			resp.Data = append(resp.Data[:0], handlerReq.Data[:n]...)
+			return nil
+		}
+	}
+
 	// Handler execution.
+	start := time.Now()
 	n, err := handler.Read(ionode, handlerReq)
+	f.server.handlerOpDone(handler, domain.HandlerOpRead, handlerReq, f.path, start, err)
 	if err != nil && err != io.EOF {
 		logrus.Debugf("Read() error: %v", err)
+		f.server.stats.incError(fuseOpRead)
 		return err
 	}
 
-	resp.Data = handlerReq.Data[:n]
+	// Cache the node's contents, as long as these have been fully read.
+	if cacheable && !handlerReq.NoCache && req.Offset == 0 && n < req.Size {
+		f.server.readCache.store(f.path, handlerReq.Data[:n])
+	}
+
+	resp.Data = append(resp.Data[:0], handlerReq.Data[:n]...)
 	return nil
 }
 
@@ -254,6 +494,11 @@ func (f *File) Write(
 	logrus.Debugf("Requested Write() operation for entry %v (Req ID=%#v)",
 		f.path, uint64(req.ID))
 
+	if !f.server.opBegin(fuseOpWrite) {
+		return errDraining
+	}
+	defer f.server.opEnd()
+
 	// Ensure operation is generated from within a registered sys container.
 	if f.server.container == nil {
 		logrus.Errorf("Could not find the container originating this request (pid %v)",
@@ -262,6 +507,21 @@ func (f *File) Write(
 			req.Pid)
 	}
 
+	// Writes are only honored on behalf of the container's processes.
+	if err := f.server.container.ValidateUserNs(req.Pid); err != nil {
+		logrus.Warnf("Write() to %v rejected: %v", f.path, err)
+		f.server.stats.incError(fuseOpWrite)
+		return IOerror{Code: syscall.EPERM}
+	}
+
+	// Writes are throttled as per the container's write rate limit.
+	if !f.server.container.WriteLimiter().Allow() {
+		logrus.Debugf("Write() to %v rejected: container %s exceeds its write rate limit",
+			f.path, f.server.container.ID())
+		f.server.stats.incError(fuseOpWrite)
+		return IOerror{Code: syscall.EAGAIN}
+	}
+
 	ionode := f.server.service.ios.NewIOnode(f.name, f.path, f.attr.Mode)
 
 	// Lookup the associated handler within handler-DB.
@@ -276,14 +536,25 @@ func (f *File) Write(
 		Pid:       req.Pid,
 		Uid:       req.Uid,
 		Gid:       req.Gid,
+		Offset:    req.Offset,
 		Data:      req.Data,
 		Container: f.server.container,
 	}
 
 	// Handler execution.
+	start := time.Now()
 	n, err := handler.Write(ionode, request)
+	f.server.handlerOpDone(handler, domain.HandlerOpWrite, request, f.path, start, err)
+
+	// Writes may alter the contents of any node (not just this one), so the
+	// whole read-cache is invalidated.
+	f.server.readCache.invalidate()
+
+	// Writes are accounted for the dentry cache-timeout policy.
+	f.server.nodeWritten(f.path)
 	if err != nil && err != io.EOF {
 		logrus.Debugf("Write() error: %v", err)
+		f.server.stats.incError(fuseOpWrite)
 		return err
 	}
 
@@ -300,6 +571,11 @@ func (f *File) Setattr(
 	logrus.Debugf("Requested Setattr() operation for entry %v (Req ID=%#v)",
 		f.path, uint64(req.ID))
 
+	if !f.server.opBegin(fuseOpSetattr) {
+		return errDraining
+	}
+	defer f.server.opEnd()
+
 	// Ensure operation is generated from within a registered sys container.
 	if f.server.container == nil {
 		logrus.Errorf("Could not find the container originating this request (pid %v)",
@@ -308,16 +584,164 @@ func (f *File) Setattr(
 			req.Pid)
 	}
 
-	// No file attr changes are allowed in a procfs, with the exception of
-	// 'size' modifications which are needed to allow write()/truncate() ops.
-	// All other 'fuse.SetattrValid' operations will be rejected.
+	// Mode & ownership changes are honored for the emulated nodes (e.g., to let
+	// group members write into a sysctl), and are recorded in the container's
+	// state so that these survive the node's re-lookups.
+	if req.Valid.Mode() || req.Valid.Uid() || req.Valid.Gid() {
+		if err := f.setModeOwner(req); err != nil {
+			logrus.Debugf("Setattr() error: %v", err)
+			f.server.stats.incError(fuseOpSetattr)
+			return err
+		}
+		return nil
+	}
+
+	// No other file attr changes are allowed in a procfs, with the exception
+	// of 'size' modifications which are needed to allow write()/truncate()
+	// ops. All other 'fuse.SetattrValid' operations will be rejected.
 	if req.Valid.Size() {
 		return nil
 	}
 
+	f.server.stats.incError(fuseOpSetattr)
+
 	return fuse.EPERM
 }
 
+// Changes the mode and / or ownership of the file, as long as it's emulated
+// and the requester is allowed to do so.
+func (f *File) setModeOwner(req *fuse.SetattrRequest) error {
+
+	if !f.emulated() {
+		return fuse.EPERM
+	}
+
+	if err := f.server.container.ValidateUserNs(req.Header.Pid); err != nil {
+		logrus.Warnf("Setattr() on %v rejected: %v", f.path, err)
+		return fuse.EPERM
+	}
+
+	// Notice that the requester's credentials are the ones in the request's
+	// header, as the request's Uid & Gid fields hold the new owner.
+	cur := *f.attr
+	if err := f.remapOwner(&cur, req.Header.Pid, req.Header.Uid, req.Header.Gid); err != nil {
+		return fuse.EPERM
+	}
+
+	attr := domain.NodeAttr{Mode: cur.Mode.Perm(), Uid: cur.Uid, Gid: cur.Gid}
+	if req.Valid.Mode() {
+		attr.Mode = req.Mode.Perm()
+	}
+	if req.Valid.Uid() {
+		attr.Uid = req.Uid
+	}
+	if req.Valid.Gid() {
+		attr.Gid = req.Gid
+	}
+
+	prs := f.server.service.hds.ProcessService()
+	process := prs.ProcessCreate(req.Header.Pid, req.Header.Uid, req.Header.Gid)
+
+	if !setattrPermitted(process, &cur, attr) {
+		return fuse.EPERM
+	}
+
+	f.server.container.SetNodeAttr(f.path, attr)
+	applyNodeAttr(f.attr, attr)
+
+	return nil
+}
+
+// Reports whether the file is emulated by its handler (as opposed to being
+// passed through).
+func (f *File) emulated() bool {
+
+	ionode := f.server.service.ios.NewIOnode(f.name, f.path, f.attr.Mode)
+
+	handler, ok := f.server.service.hds.LookupHandler(ionode)
+	if !ok {
+		return false
+	}
+
+	if f.passedThrough(handler, ionode) {
+		return false
+	}
+
+	hr, ok := handler.(domain.HandlerResourceIface)
+	if !ok {
+		return false
+	}
+
+	_, ok = hr.GetResource(ionode)
+
+	return ok
+}
+
+// Reports whether the file is passed through by its handler as per the resource
+// policies applying to the container being served.
+func (f *File) passedThrough(
+	handler domain.HandlerIface,
+	ionode domain.IOnodeIface) bool {
+
+	hp, ok := handler.(domain.HandlerPolicyIface)
+	if !ok {
+		return false
+	}
+
+	return hp.GetPolicy(ionode, f.server.container) == domain.ResourcePolicyPassthrough
+}
+
+// Reports whether the given process is allowed to change the mode / ownership
+// of a node from the current attributes to the given ones. Mimics the checks
+// done by the Linux kernel (see setattr_prepare()): the mode can be changed by
+// the node's owner, and the group by the owner as long as it's a member of the
+// new group. Otherwise, CAP_FOWNER / CAP_CHOWN are required, which only apply
+// if the node's (and the new) ids are mapped within the process' user-ns.
+func setattrPermitted(process domain.ProcessIface, cur *fuse.Attr, attr domain.NodeAttr) bool {
+
+	isOwner := process.Uid() == cur.Uid
+
+	_, uidMapped := process.UidFromHost(cur.Uid)
+	_, gidMapped := process.GidFromHost(cur.Gid)
+	capsApply := uidMapped && gidMapped
+
+	if attr.Uid != cur.Uid {
+		if _, ok := process.UidFromHost(attr.Uid); !ok || !capsApply ||
+			!process.IsCapabilitySet(cap.EFFECTIVE, cap.CAP_CHOWN) {
+			return false
+		}
+	}
+
+	if attr.Gid != cur.Gid {
+		inGroup := attr.Gid == process.Gid()
+		for _, g := range process.SGid() {
+			inGroup = inGroup || g == attr.Gid
+		}
+
+		if !isOwner || !inGroup {
+			if _, ok := process.GidFromHost(attr.Gid); !ok || !capsApply ||
+				!process.IsCapabilitySet(cap.EFFECTIVE, cap.CAP_CHOWN) {
+				return false
+			}
+		}
+	}
+
+	if attr.Mode != cur.Mode.Perm() && !isOwner {
+		if !capsApply || !process.IsCapabilitySet(cap.EFFECTIVE, cap.CAP_FOWNER) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Applies the given mode & ownership to the given attributes.
+func applyNodeAttr(a *fuse.Attr, attr domain.NodeAttr) {
+	a.Mode = a.Mode&^os.ModePerm | attr.Mode
+	a.Uid = attr.Uid
+	a.Gid = attr.Gid
+}
+
 // Forget FS operation.
 func (f *File) Forget() {
 
@@ -0,0 +1,352 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// Size of the content snapshots taken by file handles. Nodes whose contents
+// exceed it are served straight from their handlers past this point.
+const fileSnapshotSize = 256 * 1024
+
+// Maximum size of the values written through file handles (i.e., one page, as
+// for the kernel's sysctls). Writes extending values beyond it are rejected.
+const fileWriteMaxSize = 4096
+
+//
+// Per-open file handle. A handle is created for every open() of a file node,
+// so that processes concurrently reading the same node keep their own offsets
+// and contents.
+//
+// The contents of a node are captured upon the first read of a handle (as well
+// as upon every read at offset zero), and subsequent reads are served out of
+// this snapshot. This way, sequences of reads (i.e., a read at offset zero
+// followed by reads at increasing offsets) are served consistently out of the
+// same contents, and handlers are not required to serve reads at offsets other
+// than zero (which most emulated resources, being generated on every read,
+// can't do properly).
+//
+// Likewise, writes are handed to the handlers as whole values. A write at
+// offset zero (other than an O_APPEND one) starts a new value, which is
+// committed right away, so that invalid values (e.g., echo x > /proc/sys/...)
+// are reported by the write() itself, as the kernel does. Subsequent writes
+// (e.g., pwrite()s, O_APPEND writes, or the remaining pieces of a value written
+// through several write()s) are merged into the value written so far, which is
+// then committed upon flush (i.e., close()) or fsync(), on behalf of the
+// process that last wrote the value. Values are capped to fileWriteMaxSize.
+//
+// Nodes whose handlers request write-through semantics (e.g., passed-through
+// nodes) skip the merging above: every write is handed to the handler as is,
+// so that failures are reported by the write() itself.
+//
+type fileHandle struct {
+	sync.Mutex
+	file   *File
+	flags  fuse.OpenFlags
+	mode   domain.WriteMode
+	snap   contentSnapshot
+	wbuf   []byte      // value written through the handle
+	wdirty bool        // wbuf holds writes yet to be committed
+	whdr   fuse.Header // requester of the last write
+}
+
+// The new handle takes over the slot reserved by the caller (see
+// reserveHandle()), which is returned upon the handle's release.
+func newFileHandle(f *File, flags fuse.OpenFlags) *fileHandle {
+
+	h := &fileHandle{file: f, flags: flags, mode: f.writeMode()}
+	f.handles.add(h)
+
+	return h
+}
+
+// Read FS operation.
+func (h *fileHandle) Read(
+	ctx context.Context,
+	req *fuse.ReadRequest,
+	resp *fuse.ReadResponse) error {
+
+	h.Lock()
+	defer h.Unlock()
+
+	if (req.Offset == 0 && !h.snap.prefetched) || !h.snap.valid {
+		if err := h.snapshot(ctx, req); err != nil {
+			return err
+		}
+	}
+	h.snap.prefetched = false
+
+	if data, ok := h.snap.read(req.Offset, req.Size); ok {
+		resp.Data = append(resp.Data[:0], data...)
+		return nil
+	}
+
+	logrus.Debugf("Read() beyond the content snapshot of entry %v (offset %d)",
+		h.file.path, req.Offset)
+
+	return h.file.Read(ctx, req, resp)
+}
+
+// Takes a snapshot of the node's contents.
+func (h *fileHandle) snapshot(ctx context.Context, req *fuse.ReadRequest) error {
+
+	size := fileSnapshotSize
+	if req.Size > size {
+		size = req.Size
+	}
+
+	snapReq := *req
+	snapReq.Offset = 0
+	snapReq.Size = size
+
+	var snapResp fuse.ReadResponse
+	if err := h.file.Read(ctx, &snapReq, &snapResp); err != nil {
+		h.snap.reset()
+		return err
+	}
+
+	h.snap.set(snapResp.Data, len(snapResp.Data) < size)
+
+	return nil
+}
+
+// Takes a snapshot of the node's contents ahead of the first read, which is
+// then served out of it. Returns the size of the snapshot, and whether it holds
+// the node's whole contents.
+func (h *fileHandle) prefetch(ctx context.Context, hdr fuse.Header) (int, bool, error) {
+
+	h.Lock()
+	defer h.Unlock()
+
+	req := &fuse.ReadRequest{Header: hdr}
+
+	if err := h.snapshot(ctx, req); err != nil {
+		return 0, false, err
+	}
+	h.snap.prefetched = true
+
+	return len(h.snap.data), h.snap.complete, nil
+}
+
+// Write FS operation. The contents snapshot is discarded, so that subsequent
+// reads through this handle reflect the write.
+func (h *fileHandle) Write(
+	ctx context.Context,
+	req *fuse.WriteRequest,
+	resp *fuse.WriteResponse) error {
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.snap.reset()
+
+	if h.mode == domain.WriteModeThrough {
+		return h.file.Write(ctx, req, resp)
+	}
+
+	offset := req.Offset
+	if h.flags&fuse.OpenAppend != 0 {
+		offset = int64(len(h.wbuf))
+	}
+
+	// Offsets are controlled by the requester, so the buffered value is not
+	// allowed to grow past the values that emulated resources can hold.
+	if offset < 0 || offset+int64(len(req.Data)) > fileWriteMaxSize {
+		return IOerror{Code: syscall.EFBIG}
+	}
+
+	h.whdr = req.Header
+
+	if offset == 0 && h.flags&fuse.OpenAppend == 0 {
+		h.wbuf = append(h.wbuf[:0], req.Data...)
+		h.wdirty = false
+
+		if err := h.commit(ctx, h.whdr, h.wbuf); err != nil {
+			h.wbuf = nil
+			return err
+		}
+		resp.Size = len(req.Data)
+
+		return nil
+	}
+
+	h.wbuf = spliceData(h.wbuf, offset, req.Data)
+	h.wdirty = true
+	resp.Size = len(req.Data)
+
+	return nil
+}
+
+// Flush FS operation. Commits the writes pending on the handle; failures (e.g.,
+// invalid values) are reported to the process closing the file.
+func (h *fileHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+
+	h.Lock()
+	defer h.Unlock()
+
+	return h.flush(ctx)
+}
+
+// Release FS operation. Writes are committed upon flush, so none are expected
+// to be pending at this point (other than the ones racing with the last
+// close()); these are committed on a best-effort basis.
+func (h *fileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+
+	h.Lock()
+	if err := h.flush(ctx); err != nil {
+		logrus.Warnf("Unable to commit pending writes of entry %v (pid %d): %v",
+			h.file.path, h.whdr.Pid, err)
+	}
+	h.snap.reset()
+	h.wbuf = nil
+	h.Unlock()
+
+	h.file.handles.remove(h)
+	h.file.server.releaseHandle()
+
+	return h.file.Release(ctx, req)
+}
+
+// Commits the writes pending on the handle on behalf of the process that wrote
+// them, rather than the one flushing them: the latter may be gone or lie outside
+// the container (e.g., release requests may carry a reaped pid, or none).
+func (h *fileHandle) flush(ctx context.Context) error {
+
+	if !h.wdirty {
+		return nil
+	}
+	h.wdirty = false
+
+	return h.commit(ctx, h.whdr, h.wbuf)
+}
+
+// Hands the given value over to the node's handler (at offset zero).
+func (h *fileHandle) commit(ctx context.Context, hdr fuse.Header, data []byte) error {
+
+	req := &fuse.WriteRequest{
+		Header: hdr,
+		Offset: 0,
+		Data:   data,
+	}
+
+	var resp fuse.WriteResponse
+
+	return h.file.Write(ctx, req, &resp)
+}
+
+// Set of the handles opened on a node.
+type fileHandleSet struct {
+	sync.Mutex
+	handles map[*fileHandle]struct{}
+}
+
+func newFileHandleSet() *fileHandleSet {
+	return &fileHandleSet{handles: make(map[*fileHandle]struct{})}
+}
+
+func (s *fileHandleSet) add(h *fileHandle) {
+	s.Lock()
+	s.handles[h] = struct{}{}
+	s.Unlock()
+}
+
+func (s *fileHandleSet) remove(h *fileHandle) {
+	s.Lock()
+	delete(s.handles, h)
+	s.Unlock()
+}
+
+func (s *fileHandleSet) list() []*fileHandle {
+
+	s.Lock()
+	defer s.Unlock()
+
+	res := make([]*fileHandle, 0, len(s.handles))
+	for h := range s.handles {
+		res = append(res, h)
+	}
+
+	return res
+}
+
+// Writes the given data into the given buffer at the given offset, growing the
+// buffer (zero-filled) as needed.
+func spliceData(buf []byte, offset int64, data []byte) []byte {
+
+	end := offset + int64(len(data))
+
+	if end > int64(len(buf)) {
+		grown := make([]byte, end)
+		copy(grown, buf)
+		buf = grown
+	}
+
+	copy(buf[offset:], data)
+
+	return buf
+}
+
+// Snapshot of a node's contents.
+type contentSnapshot struct {
+	data       []byte
+	valid      bool
+	complete   bool // false if the node's contents exceed the snapshot
+	prefetched bool // taken ahead of the first read
+}
+
+func (s *contentSnapshot) set(data []byte, complete bool) {
+	s.data = data
+	s.valid = true
+	s.complete = complete
+}
+
+func (s *contentSnapshot) reset() {
+	*s = contentSnapshot{}
+}
+
+// Returns the snapshot's contents within the given range. Returns false if the
+// range can't be served out of the snapshot (i.e., it extends beyond the end of
+// an incomplete snapshot).
+func (s *contentSnapshot) read(offset int64, size int) ([]byte, bool) {
+
+	if !s.valid {
+		return nil, false
+	}
+
+	end := offset + int64(size)
+
+	if end > int64(len(s.data)) {
+		if !s.complete {
+			return nil, false
+		}
+		end = int64(len(s.data))
+	}
+
+	if offset >= end {
+		return nil, true
+	}
+
+	return s.data[offset:end], true
+}
@@ -0,0 +1,363 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+// Pid of the container process issuing the writes in the tests below; requests
+// from any other pid fail the container's user-ns validation.
+const testWriterPid = 1000
+
+// Handler stub recording the writes handed over to it.
+type writeRecorder struct {
+	domain.HandlerIface
+	writes []domain.HandlerRequest
+	err    error
+}
+
+func (h *writeRecorder) GetName() string {
+	return "writeRecorder"
+}
+
+func (h *writeRecorder) Write(n domain.IOnodeIface, req *domain.HandlerRequest) (int, error) {
+
+	if h.err != nil {
+		return 0, h.err
+	}
+
+	w := *req
+	w.Data = append([]byte(nil), req.Data...)
+	h.writes = append(h.writes, w)
+
+	return len(req.Data), nil
+}
+
+// Returns a write-back handle of an emulated node served by the given handler.
+func newTestFileHandle(hdl domain.HandlerIface, flags fuse.OpenFlags) *fileHandle {
+
+	cntr := &mocks.ContainerIface{}
+	cntr.On("ID").Return("c1")
+	cntr.On("WriteLimiter").Return((*domain.RateLimiter)(nil))
+	cntr.On("ValidateUserNs", uint32(testWriterPid)).Return(nil)
+	cntr.On("ValidateUserNs", mock.Anything).Return(errors.New("not a container process"))
+
+	ios := &mocks.IOServiceIface{}
+	ios.On("NewIOnode", mock.Anything, mock.Anything, mock.Anything).Return(
+		struct{ domain.IOnodeIface }{})
+
+	hds := &mocks.HandlerServiceIface{}
+	hds.On("LookupHandler", mock.Anything).Return(hdl, true)
+	hds.On("RecordHandlerStats", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	srv := &fuseServer{container: cntr, service: &FuseServerService{ios: ios, hds: hds}}
+
+	req := &domain.HandlerRequest{Name: "somaxconn", Path: "/proc/sys/net/core/somaxconn"}
+	f := NewFile(req, &fuse.Attr{Mode: 0644}, srv)
+
+	return &fileHandle{file: f, flags: flags, mode: domain.WriteModeBack}
+}
+
+func TestContentSnapshot(t *testing.T) {
+
+	var s contentSnapshot
+
+	if _, ok := s.read(0, 16); ok {
+		t.Fatalf("read() served an empty snapshot")
+	}
+
+	// Complete snapshot.
+	s.set([]byte("0123456789"), true)
+
+	tests := []struct {
+		offset int64
+		size   int
+		want   string
+	}{
+		{0, 4, "0123"},
+		{4, 4, "4567"},
+		{8, 4, "89"},
+		{10, 4, ""},
+		{20, 4, ""},
+	}
+
+	for _, tt := range tests {
+		data, ok := s.read(tt.offset, tt.size)
+		if !ok || string(data) != tt.want {
+			t.Errorf("read(%d, %d) = %q, %v; want %q", tt.offset, tt.size, data, ok, tt.want)
+		}
+	}
+
+	// Incomplete snapshot: ranges extending beyond it aren't served.
+	s.set([]byte("0123456789"), false)
+
+	if data, ok := s.read(4, 4); !ok || string(data) != "4567" {
+		t.Errorf("read(4, 4) = %q, %v; want %q", data, ok, "4567")
+	}
+	if _, ok := s.read(8, 4); ok {
+		t.Errorf("read(8, 4) served beyond an incomplete snapshot")
+	}
+
+	s.reset()
+	if _, ok := s.read(0, 4); ok {
+		t.Errorf("read() served a reset snapshot")
+	}
+}
+
+func TestSpliceData(t *testing.T) {
+
+	tests := []struct {
+		buf    string
+		offset int64
+		data   string
+		want   string
+	}{
+		{"", 0, "100", "100"},
+		{"10", 2, "0", "100"},
+		{"100", 1, "2", "120"},
+		{"1", 0, "200", "200"},
+		{"1", 2, "0", "1\x000"},
+	}
+
+	for _, tt := range tests {
+		got := spliceData([]byte(tt.buf), tt.offset, []byte(tt.data))
+		if string(got) != tt.want {
+			t.Errorf("spliceData(%q, %d, %q) = %q; want %q",
+				tt.buf, tt.offset, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestFileHandleWrite(t *testing.T) {
+
+	hdl := &writeRecorder{}
+	h := newTestFileHandle(hdl, 0)
+	ctx := context.Background()
+
+	// Writes at offset zero are committed right away, and subsequent ones are
+	// buffered till flushed.
+	writes := []struct {
+		offset int64
+		data   string
+	}{
+		{0, "10"},
+		{2, "0\n"},
+	}
+
+	for _, w := range writes {
+		var resp fuse.WriteResponse
+		req := &fuse.WriteRequest{
+			Header: fuse.Header{Pid: testWriterPid},
+			Offset: w.offset,
+			Data:   []byte(w.data),
+		}
+		if err := h.Write(ctx, req, &resp); err != nil || resp.Size != len(w.data) {
+			t.Fatalf("Write(%d, %q) = %d, %v; want %d", w.offset, w.data,
+				resp.Size, err, len(w.data))
+		}
+	}
+
+	if len(hdl.writes) != 1 || string(hdl.writes[0].Data) != "10" {
+		t.Errorf("committed writes = %v; want %q", hdl.writes, "10")
+	}
+	if string(h.wbuf) != "100\n" || !h.wdirty {
+		t.Errorf("buffered value = %q (dirty: %v); want %q", h.wbuf, h.wdirty, "100\n")
+	}
+}
+
+func TestFileHandleWriteInvalid(t *testing.T) {
+
+	hdl := &writeRecorder{err: IOerror{Code: syscall.EINVAL}}
+	h := newTestFileHandle(hdl, 0)
+	ctx := context.Background()
+
+	// Invalid values written at once are reported by the write() itself.
+	var resp fuse.WriteResponse
+	req := &fuse.WriteRequest{
+		Header: fuse.Header{Pid: testWriterPid},
+		Data:   []byte("x\n"),
+	}
+	err := h.Write(ctx, req, &resp)
+	if ioErr, ok := err.(IOerror); !ok || ioErr.Code != syscall.EINVAL {
+		t.Errorf("Write() of an invalid value: err = %v; want EINVAL", err)
+	}
+
+	// Nothing is left to be committed upon close().
+	if err := h.Flush(ctx, &fuse.FlushRequest{}); err != nil || h.wdirty {
+		t.Errorf("Flush() = %v (dirty: %v); want nothing pending", err, h.wdirty)
+	}
+}
+
+func TestFileHandleFlush(t *testing.T) {
+
+	hdl := &writeRecorder{}
+	h := newTestFileHandle(hdl, fuse.OpenAppend)
+	ctx := context.Background()
+
+	var resp fuse.WriteResponse
+	req := &fuse.WriteRequest{
+		Header: fuse.Header{Pid: testWriterPid},
+		Data:   []byte("100\n"),
+	}
+	if err := h.Write(ctx, req, &resp); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+
+	// The flushing process (pid 0, as in release requests) is not the one the
+	// value is committed for.
+	if err := h.Flush(ctx, &fuse.FlushRequest{}); err != nil {
+		t.Fatalf("Flush() unexpected error: %v", err)
+	}
+
+	if len(hdl.writes) != 1 {
+		t.Fatalf("%d writes committed; want 1", len(hdl.writes))
+	}
+	if w := hdl.writes[0]; w.Pid != testWriterPid || string(w.Data) != "100\n" {
+		t.Errorf("committed write = %q (pid %d); want %q (pid %d)", w.Data, w.Pid,
+			"100\n", testWriterPid)
+	}
+
+	// Nothing is pending past the flush.
+	if err := h.flush(ctx); err != nil || len(hdl.writes) != 1 {
+		t.Errorf("flush() = %v, %d writes committed; want none pending", err, len(hdl.writes))
+	}
+}
+
+func TestFileHandleWriteMaxSize(t *testing.T) {
+
+	h := &fileHandle{wbuf: []byte("100")}
+
+	// Values can't grow beyond fileWriteMaxSize.
+	var resp fuse.WriteResponse
+	req := &fuse.WriteRequest{Offset: 1 << 40, Data: []byte("1")}
+	err := h.Write(context.Background(), req, &resp)
+	if ioErr, ok := err.(IOerror); !ok || ioErr.Code != syscall.EFBIG {
+		t.Errorf("Write() beyond the maximum value size: err = %v; want EFBIG", err)
+	}
+	if len(h.wbuf) != 3 {
+		t.Errorf("buffered value grown to %d bytes", len(h.wbuf))
+	}
+}
+
+func TestReserveHandle(t *testing.T) {
+
+	defer domain.SetMaxCntrHandles(domain.MaxCntrHandles())
+	domain.SetMaxCntrHandles(8)
+
+	cntr := &mocks.ContainerIface{}
+	cntr.On("ID").Return("c1")
+
+	s := &fuseServer{container: cntr}
+
+	// Concurrent reservations never go beyond the limit.
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.reserveHandle() {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != 8 || s.handles != 8 {
+		t.Fatalf("reserved %d handles (%d accounted); want 8", reserved, s.handles)
+	}
+
+	// Released slots can be reserved again.
+	s.releaseHandle()
+
+	if !s.reserveHandle() {
+		t.Errorf("reserveHandle() failed after releaseHandle()")
+	}
+	if s.reserveHandle() {
+		t.Errorf("reserveHandle() succeeded beyond the limit")
+	}
+
+	// No limit is enforced if none is set.
+	domain.SetMaxCntrHandles(0)
+
+	if !s.reserveHandle() {
+		t.Errorf("reserveHandle() failed with no limit set")
+	}
+}
+
+// Handler stub writing back the emulated nodes, which are passed through by
+// the policy applying to the container being served.
+type passedThroughHandler struct {
+	domain.HandlerIface
+}
+
+func (h *passedThroughHandler) GetResource(n domain.IOnodeIface) (*domain.EmuResource, bool) {
+	return &domain.EmuResource{}, true
+}
+
+func (h *passedThroughHandler) GetWriteMode(n domain.IOnodeIface) domain.WriteMode {
+	return domain.WriteModeBack
+}
+
+func (h *passedThroughHandler) GetPolicy(
+	n domain.IOnodeIface,
+	cntr domain.ContainerIface) domain.ResourcePolicy {
+
+	if cntr == nil {
+		return domain.ResourcePolicyExpose
+	}
+
+	return domain.ResourcePolicyPassthrough
+}
+
+func TestFileWriteModePassthrough(t *testing.T) {
+
+	f := newTestFileHandle(&passedThroughHandler{}, fuse.OpenWriteOnly).file
+
+	if got := f.writeMode(); got != domain.WriteModeThrough {
+		t.Errorf("writeMode() = %v, want %v", got, domain.WriteModeThrough)
+	}
+	if f.emulated() {
+		t.Errorf("emulated() = true for a passed through file")
+	}
+
+	// Without a container, the handler's own write mode applies.
+	f.server.container = nil
+
+	if got := f.writeMode(); got != domain.WriteModeBack {
+		t.Errorf("writeMode() = %v, want %v", got, domain.WriteModeBack)
+	}
+	if !f.emulated() {
+		t.Errorf("emulated() = false for an emulated file")
+	}
+}
@@ -0,0 +1,206 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Inode numbers of the emulated nodes are picked within this range, which is
+// well beyond the inode numbers of the host's procfs / sysfs nodes (these ones
+// being utilized by the nodes passed through).
+const (
+	inodeBase uint64 = 1 << 62
+	inodeMask uint64 = inodeBase - 1
+)
+
+// Directory holding the inode numbers assigned to the emulated nodes of every
+// container ("" to disable persistence).
+var inodeStoreDir string
+
+// SetInodeStoreDir sets the directory where the inode numbers assigned to the
+// emulated nodes are persisted, so that these are preserved across sysbox-fs
+// restarts. This setting is expected to be defined during sysbox-fs
+// initialization.
+func SetInodeStoreDir(dir string) error {
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+
+	inodeStoreDir = dir
+
+	return nil
+}
+
+//
+// Per fuse-server (i.e., per container) store of the inode numbers of the
+// emulated nodes (i.e., those lacking an inode of their own in the host).
+//
+// Inode numbers are derived from the container's id and the node's path, so
+// that these remain stable across sysbox-fs restarts (e.g., for the sake of
+// tar, rsync, or inode-keyed caches within the container). As collisions are
+// resolved by picking the next free inode number, which depends on the order
+// in which nodes are looked up, the assigned numbers are also persisted (one
+// "<inode> <path>" line per node) and reloaded upon fuse-server creation.
+//
+type inodeStore struct {
+	sync.Mutex
+	id     string            // container id
+	inodes map[string]uint64 // inode numbers indexed by path
+	used   map[uint64]bool
+	file   *os.File // persisted inode numbers (nil if not persisted)
+}
+
+func newInodeStore(id string) *inodeStore {
+
+	s := &inodeStore{
+		id:     id,
+		inodes: make(map[string]uint64),
+		used:   make(map[uint64]bool),
+	}
+
+	if inodeStoreDir == "" {
+		return s
+	}
+
+	if err := s.load(); err != nil {
+		logrus.Warnf("Unable to load the inode numbers of container %s: %v", id, err)
+	}
+
+	file, err := os.OpenFile(s.path(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		logrus.Warnf("Unable to persist the inode numbers of container %s: %v", id, err)
+		return s
+	}
+	s.file = file
+
+	return s
+}
+
+func (s *inodeStore) path() string {
+	return filepath.Join(inodeStoreDir, s.id)
+}
+
+// Loads the persisted inode numbers. Malformed lines (e.g., a partially written
+// last line) are skipped.
+func (s *inodeStore) load() error {
+
+	file, err := os.Open(s.path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		ino, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil || ino&^inodeMask != inodeBase {
+			continue
+		}
+
+		s.inodes[fields[1]] = ino
+		s.used[ino] = true
+	}
+
+	return scanner.Err()
+}
+
+// Returns the inode number of the given node, assigning a new one if required.
+func (s *inodeStore) inode(path string) uint64 {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if ino, ok := s.inodes[path]; ok {
+		return ino
+	}
+
+	ino := s.derive(path)
+	for s.used[ino] {
+		ino = (ino+1)&inodeMask | inodeBase
+	}
+
+	s.inodes[path] = ino
+	s.used[ino] = true
+
+	if s.file != nil {
+		if _, err := fmt.Fprintf(s.file, "%d %s\n", ino, path); err != nil {
+			logrus.Warnf("Unable to persist the inode number of %s (container %s): %v",
+				path, s.id, err)
+		}
+	}
+
+	return ino
+}
+
+// Derives the inode number of the given node from the container id and the
+// node's path.
+func (s *inodeStore) derive(path string) uint64 {
+
+	h := fnv.New64a()
+	h.Write([]byte(s.id + "\x00" + path))
+
+	return h.Sum64()&inodeMask | inodeBase
+}
+
+// Closes the store, leaving the persisted inode numbers in place (e.g., upon
+// sysbox-fs shutdown).
+func (s *inodeStore) close() {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// Closes the store and discards the persisted inode numbers (i.e., upon
+// container unregistration).
+func (s *inodeStore) remove() {
+
+	s.close()
+
+	if inodeStoreDir == "" {
+		return
+	}
+
+	if err := os.Remove(s.path()); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("Unable to remove the inode numbers of container %s: %v", s.id, err)
+	}
+}
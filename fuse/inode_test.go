@@ -0,0 +1,77 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestInodeStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "inodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := SetInodeStoreDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetInodeStoreDir("")
+
+	s := newInodeStore("cntr1")
+
+	ino := s.inode("/proc/uptime")
+	if ino&^inodeMask != inodeBase {
+		t.Errorf("inode() = %#x, out of the emulated inodes range", ino)
+	}
+	if got := s.inode("/proc/uptime"); got != ino {
+		t.Errorf("inode() = %#x on second lookup, want %#x", got, ino)
+	}
+
+	// Inode numbers are derived from the container id & the node's path.
+	other := newInodeStore("cntr2")
+	if other.inode("/proc/uptime") == ino {
+		t.Errorf("inode() matches across containers")
+	}
+	other.remove()
+
+	// Collisions are resolved by picking the next free inode.
+	s.used[s.derive("/proc/swaps")] = true
+	colliding := s.inode("/proc/swaps")
+	if colliding == s.derive("/proc/swaps") {
+		t.Errorf("inode() = %#x, colliding with a used inode", colliding)
+	}
+
+	// Assigned inodes are preserved across restarts.
+	s.close()
+	s = newInodeStore("cntr1")
+	if got := s.inode("/proc/uptime"); got != ino {
+		t.Errorf("inode() = %#x after reload, want %#x", got, ino)
+	}
+	if got := s.inode("/proc/swaps"); got != colliding {
+		t.Errorf("inode() = %#x after reload, want %#x", got, colliding)
+	}
+
+	// And discarded upon removal.
+	s.remove()
+	if _, err := os.Stat(s.path()); !os.IsNotExist(err) {
+		t.Errorf("inodes file not removed: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Nodes that can be mmap()ed (read-only), along with their descendants. As
+// these can be modified at runtime (i.e., config reload), they are protected
+// by a lock.
+var mmapCfg struct {
+	sync.RWMutex
+	paths []string
+}
+
+// SetMmapPaths updates the nodes that can be mmap()ed. Only opens received
+// after this call are affected.
+func SetMmapPaths(paths []string) {
+
+	mmapCfg.Lock()
+	defer mmapCfg.Unlock()
+
+	mmapCfg.paths = nil
+	for _, p := range paths {
+		mmapCfg.paths = append(mmapCfg.paths, filepath.Clean(p))
+	}
+}
+
+// Reports whether the given node can be mmap()ed.
+func mmapEnabled(path string) bool {
+
+	mmapCfg.RLock()
+	defer mmapCfg.RUnlock()
+
+	for _, p := range mmapCfg.paths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import "testing"
+
+func TestMmapEnabled(t *testing.T) {
+
+	SetMmapPaths([]string{"/proc/cpuinfo", "/sys/devices/system/cpu/"})
+	defer SetMmapPaths(nil)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/proc/cpuinfo", true},
+		{"/proc/cpuinfo2", false},
+		{"/proc/meminfo", false},
+		{"/sys/devices/system/cpu", true},
+		{"/sys/devices/system/cpu/online", true},
+		{"/sys/devices/system/cpufreq", false},
+	}
+
+	for _, tt := range tests {
+		if got := mmapEnabled(tt.path); got != tt.want {
+			t.Errorf("mmapEnabled(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	SetMmapPaths(nil)
+	if mmapEnabled("/proc/cpuinfo") {
+		t.Errorf("mmapEnabled() true with no mmap paths")
+	}
+}
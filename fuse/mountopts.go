@@ -0,0 +1,187 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// Mount point of the fuse control file-system (fusectl).
+const fuseCtlDir = "/sys/fs/fuse/connections"
+
+// Fuse configuration file, consulted by fusermount for unprivileged mounts.
+const fuseConfFile = "/etc/fuse.conf"
+
+// Tunables of the fuse connections (0 for the kernel's defaults). As these can
+// be modified at runtime (i.e., config reload), they are protected by a lock.
+var mountOptsCfg struct {
+	sync.RWMutex
+	maxBackground       uint32
+	congestionThreshold uint32
+}
+
+// SetMountOptions updates the tunables of the fuse connections. Only
+// fuse-servers created after this call are affected.
+//
+// * maxBackground: max number of pending background requests (e.g., readahead,
+//   async reads) per fuse connection; requests beyond it are queued.
+//
+// * congestionThreshold: number of pending background requests beyond which
+//   the kernel considers the fuse connection congested.
+func SetMountOptions(maxBackground, congestionThreshold int) error {
+
+	if maxBackground < 0 || maxBackground > 0xffff {
+		return fmt.Errorf("invalid fuse max-background value %d", maxBackground)
+	}
+	if congestionThreshold < 0 || congestionThreshold > 0xffff {
+		return fmt.Errorf("invalid fuse congestion-threshold value %d",
+			congestionThreshold)
+	}
+
+	mountOptsCfg.Lock()
+	defer mountOptsCfg.Unlock()
+
+	mountOptsCfg.maxBackground = uint32(maxBackground)
+	mountOptsCfg.congestionThreshold = uint32(congestionThreshold)
+
+	return nil
+}
+
+// Returns the fuse connection attributes (fusectl files) to be set, along with
+// their values.
+func connAttrs() map[string]uint32 {
+
+	mountOptsCfg.RLock()
+	defer mountOptsCfg.RUnlock()
+
+	attrs := make(map[string]uint32)
+
+	if mountOptsCfg.maxBackground > 0 {
+		attrs["max_background"] = mountOptsCfg.maxBackground
+	}
+	if mountOptsCfg.congestionThreshold > 0 {
+		attrs["congestion_threshold"] = mountOptsCfg.congestionThreshold
+	}
+
+	return attrs
+}
+
+// Applies the background-request limits to the fuse-server's connection. These
+// are not mount options, but attributes of the fuse connection exposed through
+// fusectl, under a directory named after the connection's id (i.e., the minor
+// device number of the fuse mount). Notice that the mountpoint must not be
+// accessed before the fuse-server's main-loop is launched, as it would hang.
+func (s *fuseServer) setConnAttrs() {
+
+	attrs := connAttrs()
+	if len(attrs) == 0 {
+		return
+	}
+
+	// Fusectl is only reachable from the initial user-ns.
+	if domain.Rootless() {
+		logrus.Warnf("Fuse connection attributes of %s left untouched (rootless mode)",
+			s.mountPoint)
+		return
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(s.mountPoint, &st); err != nil {
+		logrus.Warnf("Unable to set fuse connection attributes for %s: %v",
+			s.mountPoint, err)
+		return
+	}
+
+	dir := filepath.Join(fuseCtlDir, strconv.FormatUint(uint64(unix.Minor(st.Dev)), 10))
+
+	// The congestion threshold is capped by max-background, so the latter goes
+	// first.
+	for _, name := range []string{"max_background", "congestion_threshold"} {
+		val, ok := attrs[name]
+		if !ok {
+			continue
+		}
+		err := ioutil.WriteFile(filepath.Join(dir, name),
+			[]byte(strconv.FormatUint(uint64(val), 10)), 0644)
+		if err != nil {
+			logrus.Warnf("Unable to set fuse connection attribute %s for %s: %v",
+				name, s.mountPoint, err)
+		}
+	}
+}
+
+// CheckRootlessMount verifies that fuse mounts can be carried out without host
+// privileges: these are performed through the (setuid) fusermount helper, which
+// only honors the "allow_other" option, required for the sys containers' users
+// to access the mounts, if permitted by the fuse configuration file.
+func CheckRootlessMount() error {
+
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		return fmt.Errorf("fusermount helper not found: %v", err)
+	}
+
+	// Root (even if within a user-ns) is not subject to this restriction.
+	if os.Geteuid() == 0 {
+		return nil
+	}
+
+	ok, err := fuseConfAllowOther(fuseConfFile)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("'user_allow_other' must be enabled in %s", fuseConfFile)
+	}
+
+	return nil
+}
+
+// Reports whether the given fuse configuration file enables "user_allow_other".
+func fuseConfAllowOther(path string) (bool, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "user_allow_other" {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,95 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSetMountOptions(t *testing.T) {
+
+	defer SetMountOptions(0, 0)
+
+	if err := SetMountOptions(64, 48); err != nil {
+		t.Fatalf("SetMountOptions() unexpected error: %v", err)
+	}
+
+	want := map[string]uint32{"max_background": 64, "congestion_threshold": 48}
+	if got := connAttrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("connAttrs() = %v, want %v", got, want)
+	}
+
+	// Only non-default values are applied.
+	if err := SetMountOptions(0, 32); err != nil {
+		t.Fatalf("SetMountOptions() unexpected error: %v", err)
+	}
+
+	want = map[string]uint32{"congestion_threshold": 32}
+	if got := connAttrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("connAttrs() = %v, want %v", got, want)
+	}
+
+	// Invalid values leave the current settings untouched.
+	for _, opts := range [][2]int{{-1, 0}, {1 << 16, 0}, {0, -1}} {
+		if err := SetMountOptions(opts[0], opts[1]); err == nil {
+			t.Errorf("SetMountOptions(%v) expected error", opts)
+		}
+	}
+
+	if got := connAttrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("connAttrs() = %v, want %v", got, want)
+	}
+}
+
+func TestFuseConfAllowOther(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "fuseconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		name string
+		conf string
+		want bool
+	}{
+		{"enabled", "# mount_max = 1000\nuser_allow_other\n", true},
+		{"commented", "#user_allow_other\n", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(path, []byte(tt.conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := fuseConfAllowOther(path)
+		if err != nil || got != tt.want {
+			t.Errorf("fuseConfAllowOther(%s) = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	// A missing file doesn't enable it.
+	if got, err := fuseConfAllowOther(filepath.Join(dir, "missing")); err != nil || got {
+		t.Errorf("fuseConfAllowOther(missing) = %v, %v; want false", got, err)
+	}
+}
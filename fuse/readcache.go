@@ -0,0 +1,161 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Nodes whose reads are cached when the read-cache is enabled and no paths are
+// explicitly configured: frequently read and slowly changing resources.
+var DefaultReadCachePaths = []string{
+	"/proc/sys/kernel",
+	"/sys/devices/system/cpu",
+}
+
+// Read-cache settings. As these can be modified at runtime (i.e., config
+// reload), they are protected by a lock. Every update bumps the settings'
+// generation, which invalidates all the cached contents.
+var readCacheCfg struct {
+	sync.RWMutex
+	ttl   time.Duration // 0 == read-cache disabled
+	paths []string      // cached nodes (and their descendants)
+	gen   uint64
+}
+
+// SetReadCache updates the read-cache settings: contents of the nodes under the
+// given paths are cached for the given ttl. A nil (or zero) ttl disables the
+// read-cache; nil paths stand for DefaultReadCachePaths.
+func SetReadCache(ttl *time.Duration, paths []string) {
+
+	readCacheCfg.Lock()
+	defer readCacheCfg.Unlock()
+
+	readCacheCfg.ttl = 0
+	if ttl != nil {
+		readCacheCfg.ttl = *ttl
+	}
+
+	readCacheCfg.paths = DefaultReadCachePaths
+	if paths != nil {
+		readCacheCfg.paths = paths
+	}
+
+	readCacheCfg.gen++
+}
+
+// Returns the ttl and generation of the read-cache settings applicable to the
+// given node. A zero ttl indicates that the node must not be cached.
+func readCachePolicy(path string) (time.Duration, uint64) {
+
+	readCacheCfg.RLock()
+	defer readCacheCfg.RUnlock()
+
+	if readCacheCfg.ttl <= 0 {
+		return 0, 0
+	}
+
+	for _, p := range readCacheCfg.paths {
+		p = filepath.Clean(p)
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return readCacheCfg.ttl, readCacheCfg.gen
+		}
+	}
+
+	return 0, 0
+}
+
+type readCacheEntry struct {
+	data    []byte
+	expires time.Time
+	gen     uint64
+}
+
+//
+// Per fuse-server (i.e., per container) cache of the contents of the nodes
+// served by the handlers, which prevents identical reads of frequently read
+// nodes from being repeatedly dispatched to the handlers (and from there,
+// most likely, to nsenter processes). Contents are cached for a limited time
+// (ttl), and are invalidated upon any write into the fuse-server, as well as
+// upon read-cache settings update.
+//
+type readCache struct {
+	sync.Mutex
+	entries map[string]*readCacheEntry
+}
+
+// Copies the cached contents of the given node, starting at the given offset,
+// into buf. Returns false if the node's contents are not cached.
+func (c *readCache) read(path string, offset int64, buf []byte) (int, bool) {
+
+	_, gen := readCachePolicy(path)
+	if gen == 0 {
+		return 0, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[path]
+	if !ok {
+		return 0, false
+	}
+	if e.gen != gen || time.Now().After(e.expires) {
+		delete(c.entries, path)
+		return 0, false
+	}
+
+	if offset >= int64(len(e.data)) {
+		return 0, true
+	}
+
+	return copy(buf, e.data[offset:]), true
+}
+
+// Caches the contents of the given node, if allowed by the read-cache settings.
+func (c *readCache) store(path string, data []byte) {
+
+	ttl, gen := readCachePolicy(path)
+	if ttl == 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*readCacheEntry)
+	}
+
+	c.entries[path] = &readCacheEntry{
+		data:    append([]byte(nil), data...),
+		expires: time.Now().Add(ttl),
+		gen:     gen,
+	}
+}
+
+// Invalidates all the cached contents.
+func (c *readCache) invalidate() {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries = nil
+}
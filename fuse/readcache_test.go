@@ -0,0 +1,65 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadCache(t *testing.T) {
+
+	ttl := 50 * time.Millisecond
+	SetReadCache(&ttl, []string{"/proc/sys/kernel"})
+	defer SetReadCache(nil, nil)
+
+	var c readCache
+	buf := make([]byte, 16)
+
+	c.store("/proc/sys/kernel/pid_max", []byte("4194304\n"))
+	c.store("/proc/uptime", []byte("1.0 1.0\n"))
+
+	if n, ok := c.read("/proc/sys/kernel/pid_max", 0, buf); !ok || string(buf[:n]) != "4194304\n" {
+		t.Errorf("read() = %q, %v; want cached contents", buf[:n], ok)
+	}
+	if n, ok := c.read("/proc/sys/kernel/pid_max", 8, buf); !ok || n != 0 {
+		t.Errorf("read() at EOF = %d, %v; want 0, true", n, ok)
+	}
+	if _, ok := c.read("/proc/uptime", 0, buf); ok {
+		t.Errorf("read() served a non-cacheable node")
+	}
+
+	// Explicit invalidation.
+	c.invalidate()
+	if _, ok := c.read("/proc/sys/kernel/pid_max", 0, buf); ok {
+		t.Errorf("read() served an invalidated node")
+	}
+
+	// Settings update.
+	c.store("/proc/sys/kernel/pid_max", []byte("4194304\n"))
+	SetReadCache(&ttl, []string{"/proc/sys/kernel"})
+	if _, ok := c.read("/proc/sys/kernel/pid_max", 0, buf); ok {
+		t.Errorf("read() served a node cached under previous settings")
+	}
+
+	// Expiration.
+	c.store("/proc/sys/kernel/pid_max", []byte("4194304\n"))
+	time.Sleep(2 * ttl)
+	if _, ok := c.read("/proc/sys/kernel/pid_max", 0, buf); ok {
+		t.Errorf("read() served an expired node")
+	}
+}
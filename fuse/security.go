@@ -0,0 +1,80 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"strings"
+	"syscall"
+
+	"github.com/nestybox/sysbox-libs/formatter"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// Returns the errno carried by the given handler error (0 if none).
+func handlerErrno(err error) syscall.Errno {
+
+	switch e := err.(type) {
+	case IOerror:
+		return e.Code
+	case *IOerror:
+		return e.Code
+	case syscall.Errno:
+		return e
+	}
+
+	return 0
+}
+
+// Reports the security events (see domain.SecurityEvent) triggered by the
+// outcome of a handler operation: denied writes (i.e., write-opens and writes)
+// to sysctls, and permission failures.
+func (s *fuseServer) securityCheck(
+	op domain.HandlerOp,
+	req *domain.HandlerRequest,
+	path string,
+	write bool,
+	err error) {
+
+	errno := handlerErrno(err)
+	if errno != syscall.EACCES && errno != syscall.EPERM && errno != syscall.EROFS {
+		return
+	}
+
+	ev := domain.SecurityEvent{
+		Container: s.container.ID(),
+		Pid:       req.Pid,
+		Path:      path,
+		Syscall:   string(op),
+		Errno:     unix.ErrnoName(errno),
+	}
+
+	if write && strings.HasPrefix(path, "/proc/sys/") {
+		logrus.Warnf("Denied write to sysctl %s: cntr %s, pid %d (%s)",
+			path, formatter.ContainerID{ev.Container}, req.Pid, ev.Errno)
+
+		ev.Type = domain.SecurityEventDeniedSysctlWrite
+		domain.EmitSecurityEvent(ev)
+	}
+
+	// Read-only file-systems are not a matter of permissions.
+	if errno != syscall.EROFS {
+		domain.RecordPermissionFailure(ev)
+	}
+}
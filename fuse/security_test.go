@@ -0,0 +1,75 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/mocks"
+)
+
+func TestSecurityCheck(t *testing.T) {
+
+	cntr := &mocks.ContainerIface{}
+	cntr.On("ID").Return("c1")
+
+	s := &fuseServer{container: cntr}
+	req := &domain.HandlerRequest{Pid: 1001}
+
+	events, cancel := domain.SubscribeSecurityEvents()
+	defer cancel()
+
+	tests := []struct {
+		op    domain.HandlerOp
+		path  string
+		write bool
+		err   error
+		want  bool
+	}{
+		{domain.HandlerOpOpen, "/proc/sys/kernel/panic", true, IOerror{Code: syscall.EACCES}, true},
+		{domain.HandlerOpWrite, "/proc/sys/net/core/somaxconn", true, IOerror{Code: syscall.EROFS}, true},
+		{domain.HandlerOpOpen, "/proc/sys/kernel/panic", false, IOerror{Code: syscall.EACCES}, false},
+		{domain.HandlerOpWrite, "/proc/sys/kernel/panic", true, IOerror{Code: syscall.EINVAL}, false},
+		{domain.HandlerOpWrite, "/proc/uptime", true, IOerror{Code: syscall.EACCES}, false},
+		{domain.HandlerOpWrite, "/proc/sys/kernel/panic", true, errors.New("failure"), false},
+	}
+
+	for _, tt := range tests {
+		s.securityCheck(tt.op, req, tt.path, tt.write, tt.err)
+
+		select {
+		case ev := <-events:
+			if !tt.want {
+				t.Errorf("securityCheck(%s, %s, %v) emitted unexpected event %+v",
+					tt.op, tt.path, tt.err, ev)
+				continue
+			}
+			if ev.Type != domain.SecurityEventDeniedSysctlWrite ||
+				ev.Container != "c1" || ev.Pid != 1001 || ev.Path != tt.path {
+				t.Errorf("securityCheck(%s, %s, %v) emitted event %+v",
+					tt.op, tt.path, tt.err, ev)
+			}
+		default:
+			if tt.want {
+				t.Errorf("securityCheck(%s, %s, %v) emitted no event", tt.op, tt.path, tt.err)
+			}
+		}
+	}
+}
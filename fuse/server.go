@@ -20,16 +20,38 @@ import (
 	"errors"
 	"os"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 
 	_ "bazil.org/fuse/fs/fstestutil"
+	"github.com/nestybox/sysbox-libs/formatter"
 	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
 )
 
+// Max time a FUSE request is held back while sysbox-fs is under resource
+// pressure, and interval at which the pressure is re-checked meanwhile.
+const (
+	pressureMaxDelay     = 2 * time.Second
+	pressurePollInterval = 10 * time.Millisecond
+)
+
+// Error returned to the FUSE operations received while the fuse-server is being
+// drained (i.e., during sysbox-fs shutdown).
+var errDraining = fuse.Errno(syscall.ENOTCONN)
+
+// Time to wait for a fuse-server's main-loop to exit once unmounted.
+const fuseServerExitTimeout = 5 * time.Second
+
+// Max number of times a container's fuse-server is recreated after its fuse
+// connection is aborted (see recoverFuseServer()).
+const fuseServerMaxRecoveries = 5
+
 // FuseServer class in charge of running/hosting sysbox-fs' FUSE server features.
 type fuseServer struct {
 	sync.RWMutex                       // nodeDB protection
@@ -39,10 +61,21 @@ type fuseServer struct {
 	containerUid uint32                // container UID for caching purposes
 	containerGid uint32                // container GID for caching purposes
 	server       *fs.Server            // bazil-fuse server instance
+	conn         *fuse.Conn            // bazil-fuse connection to the kernel
 	nodeDB       map[string]*fs.Node   // map to store all fs nodes, e.g. "/proc/uptime" -> File
 	root         *Dir                  // root node of fuse fs -- "/" by default
 	initDone     chan bool             // sync-up channel to alert about fuse-server's init-completion
 	cntrReg      bool                  // flag to track the container's registration state
+	stats        fuseServerStats       // fuse operation counters
+	drain        fuseServerDrain       // in-flight operations tracking
+	readCache    readCache             // cached contents of the emulated nodes
+	inodes       *inodeStore           // inode numbers of the emulated nodes
+	dentryWrites dentryWriteTracker    // writes accounting for dentry cache-timeouts
+	runDone      chan struct{}         // closed upon fuse-server's main-loop exit
+	destroyed    int32                 // unmount requested through Destroy() (atomic)
+	recoveries   int                   // times the fuse-server has been recreated
+	engineWarmed int64                 // time of the last engine pre-warming (unix-nano)
+	handles      int64                 // open file handles (see reserveHandle())
 	service      *FuseServerService    // backpointer to parent service
 }
 
@@ -94,6 +127,14 @@ func (s *fuseServer) Create() error {
 		}
 	}
 
+	s.init(pathInfo)
+
+	return nil
+}
+
+// Builds the fuse-server's root node and initializes its pending members.
+func (s *fuseServer) init(pathInfo os.FileInfo) {
+
 	// Creating a first node corresponding to the root (dir) element in
 	// sysbox-fs.
 	var attr fuse.Attr
@@ -114,11 +155,11 @@ func (s *fuseServer) Create() error {
 	// Initialize pending members.
 	s.nodeDB = make(map[string]*fs.Node)
 	s.initDone = make(chan bool)
-
-	return nil
+	s.runDone = make(chan struct{})
 }
 
 func (s *fuseServer) Run() error {
+
 	//
 	// Creating a FUSE mount at the requested mountpoint.
 	//
@@ -137,17 +178,15 @@ func (s *fuseServer) Run() error {
 	)
 	if err != nil {
 		logrus.Error(err)
+		close(s.runDone)
 		return err
 	}
+	s.conn = c
 
-	// Deferred routine to enforce a clean exit should an unrecoverable error is
-	// ever returned from fuse-lib.
-	defer func() {
+	if p := c.Protocol(); !p.HasInvalidate() {
 		s.Unmount()
 		c.Close()
-	}()
-
-	if p := c.Protocol(); !p.HasInvalidate() {
+		close(s.runDone)
 		logrus.Panic("Kernel FUSE support is too old to have invalidations: version ", p)
 		return err
 	}
@@ -155,32 +194,75 @@ func (s *fuseServer) Run() error {
 	// Creating a FUSE server to drive kernel interactions.
 	s.server = fs.New(c, nil)
 	if s.server == nil {
+		s.Unmount()
+		c.Close()
+		close(s.runDone)
 		logrus.Panic("FUSE file-system could not be created")
 		return errors.New("FUSE file-system could not be created")
 	}
 
+	// Background-request limits are set once the main-loop is up.
+	go s.setConnAttrs()
+
 	// At this point we are done with fuse-server initialization, so let's
 	// caller know about it.
 	s.initDone <- true
 
-	// Launch fuse-server's main-loop to handle incoming requests.
+	return s.serve()
+}
+
+// Fuse-server's main-loop. Handles incoming requests till the fuse-server is
+// unmounted.
+func (s *fuseServer) serve() error {
+
+	defer close(s.runDone)
+
+	// Deferred routine to enforce a clean exit should an unrecoverable error is
+	// ever returned from fuse-lib.
+	defer func() {
+		s.Unmount()
+		s.conn.Close()
+	}()
+
 	if err := s.server.Serve(s); err != nil {
 		logrus.Panic(err)
 		return err
 	}
 
 	// Return if any error is reported by mount logic.
-	<-c.Ready
-	if err := c.MountError; err != nil {
+	<-s.conn.Ready
+	if err := s.conn.MountError; err != nil {
 		logrus.Panic(err)
 		return err
 	}
 
+	if s.recoverable() {
+		go s.service.recoverFuseServer(s)
+	}
+
 	return nil
 }
 
+// Reports whether the fuse-server is to be recreated upon its main-loop's exit.
+// The main-loop exits without sysbox-fs' intervention if the fuse connection is
+// aborted, as opposed to an unmount requested through Destroy().
+func (s *fuseServer) recoverable() bool {
+	return atomic.LoadInt32(&s.destroyed) == 0 && s.service != nil
+}
+
+// Assigns an inode number to the given node if it lacks one (i.e., emulated
+// nodes).
+func (s *fuseServer) assignInode(path string, attr *fuse.Attr) {
+
+	if attr.Inode == 0 && s.inodes != nil {
+		attr.Inode = s.inodes.inode(path)
+	}
+}
+
 func (s *fuseServer) Destroy() error {
 
+	atomic.StoreInt32(&s.destroyed, 1)
+
 	// Unmount sysboxfs from mountpoint.
 	err := fuse.Unmount(s.mountPoint)
 	if err != nil {
@@ -188,6 +270,14 @@ func (s *fuseServer) Destroy() error {
 		return err
 	}
 
+	// Wait for the fuse-server's main-loop to wind down.
+	select {
+	case <-s.runDone:
+	case <-time.After(fuseServerExitTimeout):
+		logrus.Warnf("FUSE server for %s did not exit within %v",
+			s.mountPoint, fuseServerExitTimeout)
+	}
+
 	// Unset pointers for GC purposes.
 	s.container = nil
 	s.server = nil
@@ -208,6 +298,20 @@ func (s *fuseServer) Root() (fs.Node, error) {
 
 // Ensure that fuse-server initialization is completed before moving on
 // with sys container's pre-registration sequence.
+// Creates the fuse-server and launches its main-loop, waiting for its fuse
+// mount to be ready.
+func (s *fuseServer) start() error {
+
+	if err := s.Create(); err != nil {
+		return err
+	}
+
+	go s.Run()
+	s.InitWait()
+
+	return nil
+}
+
 func (s *fuseServer) InitWait() {
 	<-s.initDone
 }
@@ -244,10 +348,165 @@ func (s *fuseServer) ContainerGID() uint32 {
 	return s.containerGid
 }
 
+// Returns the uid & gid of the emulated files' owner. By default, this is the
+// container's root user, as per the user-ns mapping kept by the container-state
+// service. If this mapping is not available yet (i.e., container registration
+// in progress), the root user in the requester's (pid) user-ns is picked.
+func (s *fuseServer) filesOwner(pid, uid, gid uint32) (uint32, uint32, error) {
+
+	// The host's root user is not mapped within the container, so it shows up
+	// as the overflow user (i.e., "nobody").
+	if atomic.LoadInt32(&filesOwnerNobody) == 1 {
+		return 0, 0, nil
+	}
+
+	if cntrUid, cntrGid := s.ContainerUID(), s.ContainerGID(); cntrUid != 0 {
+		return cntrUid, cntrGid, nil
+	}
+
+	if pid == 0 {
+		return 0, 0, nil
+	}
+
+	prs := s.service.hds.ProcessService()
+	process := prs.ProcessCreate(pid, uid, gid)
+
+	return process.UsernsRootUidGid()
+}
+
+// Reports whether the read-cache can be utilized to serve the given node to the
+// given requester, that is, if the node's contents are cacheable, and the
+// requester shares the namespaces of the container's init process.
+func (s *fuseServer) readCacheable(path string, pid, uid, gid uint32) bool {
+
+	if ttl, _ := readCachePolicy(path); ttl == 0 {
+		return false
+	}
+
+	if s.container == nil || !s.cntrReg {
+		return false
+	}
+
+	prs := s.service.hds.ProcessService()
+	process := prs.ProcessCreate(pid, uid, gid)
+
+	return domain.ProcessNsMatch(process, s.container.InitProc())
+}
+
 func (s *fuseServer) SetCntrRegComplete() {
 	s.cntrReg = true
 }
 
 func (s *fuseServer) IsCntrRegCompleted() bool {
 	return s.cntrReg
+}
+
+func (s *fuseServer) Stats() *domain.FuseServerStats {
+	return s.stats.snapshot()
+}
+
+// Registers the beginning of a FUSE operation. Returns false if the fuse-server
+// is being drained, in which case the operation must be rejected.
+func (s *fuseServer) opBegin(op fuseOp) bool {
+
+	s.throttle()
+
+	if !s.drain.begin() {
+		return false
+	}
+	s.stats.incOp(op)
+
+	return true
+}
+
+// Registers the completion of a FUSE operation.
+func (s *fuseServer) opEnd() {
+	s.drain.end()
+}
+
+// Applies back-pressure on the FUSE requests received while sysbox-fs is under
+// resource pressure: requests targeting a fuse-server with operations already
+// in-flight are held back until the pressure is relieved, these operations
+// complete, or pressureMaxDelay expires. This way, the containers generating
+// the bulk of the load see their emulation slowed down, while idle ones are
+// barely affected.
+func (s *fuseServer) throttle() {
+
+	if !domain.ResourcePressure() {
+		return
+	}
+
+	start := time.Now()
+	for domain.ResourcePressure() && s.drain.busy() {
+		if time.Since(start) >= pressureMaxDelay {
+			break
+		}
+		time.Sleep(pressurePollInterval)
+	}
+
+	if delay := time.Since(start); delay >= pressurePollInterval {
+		logrus.Debugf("FUSE request on %s held back %v due to resource pressure",
+			s.mountPoint, delay)
+	}
+}
+
+// Stops accepting new FUSE operations and waits for the in-flight ones to be
+// completed, or for the given timeout to expire.
+func (s *fuseServer) Drain(timeout time.Duration) error {
+	return s.drain.drain(timeout)
+}
+
+// Reserves a file handle slot for the container, as per the handle limit of
+// each container (see domain.MaxCntrHandles()). This way, a container leaking
+// open files gets EMFILE once beyond its limit, instead of piling up sysbox-fs
+// resources (i.e., handles, content snapshots) at the expense of the rest of
+// the containers. Reserved slots are returned through releaseHandle().
+func (s *fuseServer) reserveHandle() bool {
+
+	max := int64(domain.MaxCntrHandles())
+
+	for {
+		curr := atomic.LoadInt64(&s.handles)
+
+		if max != 0 && curr >= max {
+			logrus.Debugf("Container %s reached its open handles limit (%d)",
+				formatter.ContainerID{s.container.ID()}, max)
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&s.handles, curr, curr+1) {
+			return true
+		}
+	}
+}
+
+// Returns a file handle slot reserved through reserveHandle().
+func (s *fuseServer) releaseHandle() {
+	atomic.AddInt64(&s.handles, -1)
+}
+
+// Accounts for the execution of a handler operation: updates the handler's
+// statistics and reports the operation if deemed slow.
+func (s *fuseServer) handlerOpDone(
+	h domain.HandlerIface,
+	op domain.HandlerOp,
+	req *domain.HandlerRequest,
+	path string,
+	start time.Time,
+	err error) {
+
+	latency := time.Since(start)
+
+	s.service.hds.RecordHandlerStats(h.GetName(), op, latency, err)
+
+	// Open requests are checked by the caller, which is aware of the open mode.
+	if op != domain.HandlerOpOpen {
+		s.securityCheck(op, req, path, op == domain.HandlerOpWrite, err)
+	}
+
+	if domain.IsSlowOp(latency) {
+		logrus.Warnf("Slow %s() operation: cntr %s, path %s, handler %s, pid %d, req-id %#x, duration %v (err: %v)",
+			op, formatter.ContainerID{s.container.ID()}, path, h.GetName(),
+			req.Pid, req.ID, latency, err)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,121 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/mocks"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandlerOpDone(t *testing.T) {
+
+	defer domain.SetSlowOpThreshold(domain.SlowOpThreshold())
+
+	cntr := &mocks.ContainerIface{}
+	cntr.On("ID").Return("c1")
+
+	hds := &mocks.HandlerServiceIface{}
+	hds.On("RecordHandlerStats", "writeRecorder", domain.HandlerOpRead,
+		mock.Anything, nil).Return()
+
+	srv := &fuseServer{container: cntr, service: &FuseServerService{hds: hds}}
+	req := &domain.HandlerRequest{Pid: testWriterPid}
+	path := "/proc/sys/kernel/panic"
+
+	hook := logrustest.NewGlobal()
+	defer hook.Reset()
+
+	// Fast operations are only accounted for.
+	domain.SetSlowOpThreshold(time.Hour)
+	srv.handlerOpDone(&writeRecorder{}, domain.HandlerOpRead, req, path, time.Now(), nil)
+
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("fast operation logged: %v", hook.LastEntry().Message)
+	}
+
+	// Slow ones are reported as well.
+	domain.SetSlowOpThreshold(time.Millisecond)
+	srv.handlerOpDone(&writeRecorder{}, domain.HandlerOpRead, req, path,
+		time.Now().Add(-time.Second), nil)
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.WarnLevel ||
+		!strings.Contains(entry.Message, "Slow Read() operation") ||
+		!strings.Contains(entry.Message, path) {
+		t.Errorf("slow operation not reported: %v", entry)
+	}
+
+	hds.AssertNumberOfCalls(t, "RecordHandlerStats", 2)
+}
+
+func TestFuseServerThrottle(t *testing.T) {
+
+	defer domain.SetResourcePressure(false)
+
+	// Returns the time the fuse-server's requests are held back for.
+	heldBack := func(s *fuseServer) time.Duration {
+		start := time.Now()
+		s.throttle()
+		return time.Since(start)
+	}
+
+	s := &fuseServer{mountPoint: "/var/lib/sysboxfs/c1"}
+
+	// No resource pressure.
+	s.drain.begin()
+	if d := heldBack(s); d >= pressurePollInterval {
+		t.Errorf("request held back %v without resource pressure", d)
+	}
+	s.drain.end()
+
+	domain.SetResourcePressure(true)
+
+	// Idle fuse-servers aren't throttled.
+	if d := heldBack(s); d >= pressurePollInterval {
+		t.Errorf("request held back %v on an idle fuse-server", d)
+	}
+
+	// Busy ones are, till their in-flight operations complete ...
+	s.drain.begin()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.drain.end()
+	}()
+
+	if d := heldBack(s); d < 50*time.Millisecond || d >= pressureMaxDelay {
+		t.Errorf("request held back %v, want ~50ms", d)
+	}
+
+	// ... or the resource pressure is relieved.
+	s.drain.begin()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		domain.SetResourcePressure(false)
+	}()
+
+	if d := heldBack(s); d < 50*time.Millisecond || d >= pressureMaxDelay {
+		t.Errorf("request held back %v, want ~50ms", d)
+	}
+	s.drain.end()
+}
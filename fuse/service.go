@@ -18,9 +18,11 @@ package fuse
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	_ "bazil.org/fuse/fs/fstestutil"
 
@@ -36,13 +38,15 @@ type FuseServerService struct {
 	css          domain.ContainerStateServiceIface // containerState service pointer
 	ios          domain.IOServiceIface             // i/o service pointer
 	hds          domain.HandlerServiceIface        // handler service pointer
+	startServer  func(*fuseServer) error           // fuse-server launcher (overridden by unit-tests)
 }
 
 // FuseServerService constructor.
 func NewFuseServerService() *FuseServerService {
 
 	newServerService := &FuseServerService{
-		serversMap: make(map[string]*fuseServer),
+		serversMap:  make(map[string]*fuseServer),
+		startServer: (*fuseServer).start,
 	}
 
 	return newServerService
@@ -69,8 +73,10 @@ func (fss *FuseServerService) Setup(
 // FuseServerService destructor.
 func (fss *FuseServerService) DestroyFuseService() {
 
+	// Inode numbers are preserved for the containers to be served by the next
+	// sysbox-fs instance.
 	for k, _ := range fss.serversMap {
-		fss.DestroyFuseServer(k)
+		fss.destroyFuseServer(k, true)
 	}
 
 	if err := os.RemoveAll(fss.mountPoint); err != nil {
@@ -78,6 +84,47 @@ func (fss *FuseServerService) DestroyFuseService() {
 	}
 }
 
+// Stops all the fuse-servers from accepting new FUSE operations, and waits for
+// their in-flight ones to complete. Fuse-servers are drained concurrently, so
+// the given timeout applies to the whole fuse-service.
+func (fss *FuseServerService) DrainFuseService(timeout time.Duration) error {
+
+	fss.RLock()
+	servers := make(map[string]*fuseServer, len(fss.serversMap))
+	for cntrId, srv := range fss.serversMap {
+		servers[cntrId] = srv
+	}
+	fss.RUnlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		pending []string
+	)
+
+	for cntrId, srv := range servers {
+		wg.Add(1)
+		go func(cntrId string, srv *fuseServer) {
+			defer wg.Done()
+			if err := srv.Drain(timeout); err != nil {
+				logrus.Warnf("FuseServer for container id %s not drained: %v",
+					cntrId, err)
+				mu.Lock()
+				pending = append(pending, cntrId)
+				mu.Unlock()
+			}
+		}(cntrId, srv)
+	}
+
+	wg.Wait()
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%d fuse-servers with in-flight operations", len(pending))
+	}
+
+	return nil
+}
+
 // Creates new fuse-server.
 //
 // serveCntr is the container on which the fuse server will listen.
@@ -114,6 +161,7 @@ func (fss *FuseServerService) CreateFuseServer(serveCntr, stateCntr domain.Conta
 		stateCntr,
 		fss,
 	)
+	srv.(*fuseServer).inodes = newInodeStore(cntrId)
 
 	// Create new fuse-server.
 	if err := srv.Create(); err != nil {
@@ -139,8 +187,90 @@ func (fss *FuseServerService) CreateFuseServer(serveCntr, stateCntr domain.Conta
 	return nil
 }
 
+// Recreates the fuse-server of a container after its fuse connection has been
+// aborted (e.g., through /sys/fs/fuse/connections/<id>/abort, or upon a failure
+// of the kernel's fuse module), and replaces the container's mounts of the dead
+// fuse file-system with the ones of the new fuse-server. Otherwise, accesses to
+// the emulated resources would fail (ENOTCONN) till the container is restarted.
+func (fss *FuseServerService) recoverFuseServer(old *fuseServer) {
+
+	// Wait for the old fuse-server to be unmounted.
+	<-old.runDone
+
+	var cntrId string
+
+	fss.RLock()
+	for id, srv := range fss.serversMap {
+		if srv == old {
+			cntrId = id
+			break
+		}
+	}
+	fss.RUnlock()
+
+	if cntrId == "" {
+		return
+	}
+
+	if old.recoveries >= fuseServerMaxRecoveries {
+		logrus.Errorf("FuseServer for container id %s not recovered: fuse connection aborted %d times",
+			cntrId, old.recoveries+1)
+		return
+	}
+
+	logrus.Warnf("FUSE connection for container id %s aborted; recreating its fuse server",
+		cntrId)
+
+	// Inode numbers are carried over, so that the container keeps seeing the
+	// same ones.
+	srv := NewFuseServer(old.path, old.mountPoint, old.container, fss).(*fuseServer)
+	srv.inodes = old.inodes
+	srv.cntrReg = old.cntrReg
+	srv.recoveries = old.recoveries + 1
+
+	if err := fss.startServer(srv); err != nil {
+		logrus.Errorf("FuseServer for container id %s could not be recreated: %v",
+			cntrId, err)
+		return
+	}
+
+	// Bail out if the container was unregistered in the meantime.
+	fss.Lock()
+	if fss.serversMap[cntrId] != old {
+		fss.Unlock()
+		srv.Destroy()
+		return
+	}
+	fss.serversMap[cntrId] = srv
+	fss.Unlock()
+
+	if fss.css == nil {
+		return
+	}
+
+	cntr := fss.css.ContainerLookupById(cntrId)
+	if cntr == nil {
+		logrus.Errorf("Sysbox-fs mounts of container id %s not recovered: container not found",
+			cntrId)
+		return
+	}
+
+	mts := fss.css.MountService()
+	if err := mts.RemountSysboxfs(cntr, srv.mountPoint); err != nil {
+		logrus.Errorf("Sysbox-fs mounts of container id %s could not be recovered: %v",
+			cntrId, err)
+		return
+	}
+
+	logrus.Infof("Recovered fuse server for container %s", cntrId)
+}
+
 // Destroy a fuse-server.
 func (fss *FuseServerService) DestroyFuseServer(cntrId string) error {
+	return fss.destroyFuseServer(cntrId, false)
+}
+
+func (fss *FuseServerService) destroyFuseServer(cntrId string, keepInodes bool) error {
 
 	// Ensure fuse-server to eliminate is present.
 	fss.RLock()
@@ -160,6 +290,14 @@ func (fss *FuseServerService) DestroyFuseServer(cntrId string) error {
 		return nil
 	}
 
+	if srv.inodes != nil {
+		if keepInodes {
+			srv.inodes.close()
+		} else {
+			srv.inodes.remove()
+		}
+	}
+
 	// Remove mountpoint dir from host file-system.
 	cntrMountpoint := filepath.Join(fss.mountPoint, cntrId)
 	if err := os.Remove(cntrMountpoint); err != nil {
@@ -197,3 +335,32 @@ func (fss *FuseServerService) FuseServerCntrRegComplete(cntr domain.ContainerIfa
 
 	return nil
 }
+
+// Returns the fuse operation counters of the fuse-server associated to the
+// given container.
+func (fss *FuseServerService) FuseServerStats(cntrId string) (*domain.FuseServerStats, error) {
+
+	fss.RLock()
+	srv, ok := fss.serversMap[cntrId]
+	fss.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("FuseServer not present for container id %s", cntrId)
+	}
+
+	return srv.Stats(), nil
+}
+
+// Returns the fuse operation counters of all the existing fuse-servers,
+// indexed by container id.
+func (fss *FuseServerService) FuseServersStats() map[string]*domain.FuseServerStats {
+
+	fss.RLock()
+	defer fss.RUnlock()
+
+	res := make(map[string]*domain.FuseServerStats, len(fss.serversMap))
+	for cntrId, srv := range fss.serversMap {
+		res[cntrId] = srv.Stats()
+	}
+
+	return res
+}
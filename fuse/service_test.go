@@ -0,0 +1,94 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/mocks"
+)
+
+func TestRecoverFuseServer(t *testing.T) {
+
+	cntr := &mocks.ContainerIface{}
+	cntr.On("ID").Return("c1")
+
+	mts := &mocks.MountServiceIface{}
+	mts.On("RemountSysboxfs", cntr, "/var/lib/sysboxfs/c1").Return(nil)
+
+	css := &mocks.ContainerStateServiceIface{}
+	css.On("ContainerLookupById", "c1").Return(cntr)
+	css.On("MountService").Return(mts)
+
+	var started []*fuseServer
+
+	fss := NewFuseServerService()
+	fss.css = css
+	fss.startServer = func(srv *fuseServer) error {
+		started = append(started, srv)
+		return nil
+	}
+
+	old := NewFuseServer("/", "/var/lib/sysboxfs/c1", cntr, fss).(*fuseServer)
+	old.inodes = newInodeStore("c1")
+	old.runDone = make(chan struct{})
+	fss.serversMap["c1"] = old
+
+	ino := old.inodes.inode("/proc/uptime")
+
+	// Unmounts requested through Destroy() are not recovered.
+	atomic.StoreInt32(&old.destroyed, 1)
+	if old.recoverable() {
+		t.Errorf("recoverable() = true for a destroyed fuse-server")
+	}
+	atomic.StoreInt32(&old.destroyed, 0)
+
+	// Unexpected exit of the main-loop (i.e., aborted fuse connection).
+	if !old.recoverable() {
+		t.Fatalf("recoverable() = false for an aborted fuse-server")
+	}
+	close(old.runDone)
+	fss.recoverFuseServer(old)
+
+	srv := fss.serversMap["c1"]
+	if len(started) != 1 || srv != started[0] {
+		t.Fatalf("fuse-server not recreated (%d started)", len(started))
+	}
+	if srv.recoveries != 1 || srv.mountPoint != old.mountPoint {
+		t.Errorf("recreated fuse-server: recoveries = %d, mountpoint = %s",
+			srv.recoveries, srv.mountPoint)
+	}
+
+	// Inode numbers are kept.
+	if srv.inodes != old.inodes || srv.inodes.inode("/proc/uptime") != ino {
+		t.Errorf("inode numbers not carried over to the recreated fuse-server")
+	}
+
+	// The container's sysbox-fs mounts are replaced.
+	mts.AssertCalled(t, "RemountSysboxfs", cntr, "/var/lib/sysboxfs/c1")
+
+	// Fuse-servers aborted too many times are left alone.
+	srv.recoveries = fuseServerMaxRecoveries
+	srv.runDone = make(chan struct{})
+	close(srv.runDone)
+	fss.recoverFuseServer(srv)
+
+	if len(started) != 1 || fss.serversMap["c1"] != srv {
+		t.Errorf("fuse-server recreated beyond %d recoveries", fuseServerMaxRecoveries)
+	}
+}
@@ -0,0 +1,104 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"os"
+	"testing"
+
+	"bazil.org/fuse"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	cap "github.com/nestybox/sysbox-libs/capability"
+)
+
+// Process stub with the credentials of a sys container's process, whose
+// user-ns maps host ids [100000, 165536).
+type setattrProcess struct {
+	domain.ProcessIface
+	uid, gid uint32
+	caps     []cap.Cap
+}
+
+func (p *setattrProcess) Uid() uint32    { return p.uid }
+func (p *setattrProcess) Gid() uint32    { return p.gid }
+func (p *setattrProcess) SGid() []uint32 { return []uint32{100010} }
+
+func (p *setattrProcess) UidFromHost(uid uint32) (uint32, bool) {
+	return uid - 100000, uid >= 100000 && uid < 165536
+}
+
+func (p *setattrProcess) GidFromHost(gid uint32) (uint32, bool) {
+	return gid - 100000, gid >= 100000 && gid < 165536
+}
+
+func (p *setattrProcess) IsCapabilitySet(which cap.CapType, what cap.Cap) bool {
+	for _, c := range p.caps {
+		if c == what {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSetattrPermitted(t *testing.T) {
+
+	root := &setattrProcess{uid: 100000, gid: 100000,
+		caps: []cap.Cap{cap.CAP_CHOWN, cap.CAP_FOWNER}}
+	user := &setattrProcess{uid: 101000, gid: 101000}
+
+	// Node owned by the container's root user.
+	cntrRoot := &fuse.Attr{Mode: 0644, Uid: 100000, Gid: 100000}
+
+	// Node owned by the host's root user (i.e., unmapped).
+	hostRoot := &fuse.Attr{Mode: 0644, Uid: 0, Gid: 0}
+
+	tests := []struct {
+		name    string
+		process domain.ProcessIface
+		cur     *fuse.Attr
+		attr    domain.NodeAttr
+		want    bool
+	}{
+		{"owner chmod", root, cntrRoot, domain.NodeAttr{Mode: 0664, Uid: 100000, Gid: 100000}, true},
+		{"owner chgrp", root, cntrRoot, domain.NodeAttr{Mode: 0644, Uid: 100000, Gid: 100010}, true},
+		{"root chown", root, cntrRoot, domain.NodeAttr{Mode: 0644, Uid: 101000, Gid: 101000}, true},
+		{"chown to unmapped", root, cntrRoot, domain.NodeAttr{Mode: 0644, Uid: 0, Gid: 100000}, false},
+		{"unmapped owner chmod", root, hostRoot, domain.NodeAttr{Mode: 0664, Uid: 0, Gid: 0}, false},
+		{"unmapped owner chown", root, hostRoot, domain.NodeAttr{Mode: 0644, Uid: 100000, Gid: 0}, false},
+		{"non-owner chmod", user, cntrRoot, domain.NodeAttr{Mode: 0666, Uid: 100000, Gid: 100000}, false},
+		{"non-owner chown", user, cntrRoot, domain.NodeAttr{Mode: 0644, Uid: 101000, Gid: 100000}, false},
+		{"no-op", user, cntrRoot, domain.NodeAttr{Mode: 0644, Uid: 100000, Gid: 100000}, true},
+	}
+
+	for _, tt := range tests {
+		if got := setattrPermitted(tt.process, tt.cur, tt.attr); got != tt.want {
+			t.Errorf("%s: setattrPermitted() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyNodeAttr(t *testing.T) {
+
+	a := fuse.Attr{Mode: os.ModeDir | 0555, Uid: 100000, Gid: 100000}
+	applyNodeAttr(&a, domain.NodeAttr{Mode: 0775, Uid: 101000, Gid: 101000})
+
+	if a.Mode != os.ModeDir|0775 || a.Uid != 101000 || a.Gid != 101000 {
+		t.Errorf("applyNodeAttr() = %v %d:%d, want %v 101000:101000",
+			a.Mode, a.Uid, a.Gid, os.ModeDir|0775)
+	}
+}
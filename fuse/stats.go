@@ -0,0 +1,89 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"sync/atomic"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// FUSE operations being accounted for in each fuse-server.
+type fuseOp int
+
+const (
+	fuseOpLookup fuseOp = iota
+	fuseOpAttr
+	fuseOpOpen
+	fuseOpCreate
+	fuseOpRead
+	fuseOpWrite
+	fuseOpReadDirAll
+	fuseOpSetattr
+	fuseOpMkdir
+	fuseOpAccess
+	fuseOpFsync
+	fuseOpMax
+)
+
+var fuseOpNames = [fuseOpMax]string{
+	fuseOpLookup:     "Lookup",
+	fuseOpAttr:       "Attr",
+	fuseOpOpen:       "Open",
+	fuseOpCreate:     "Create",
+	fuseOpRead:       "Read",
+	fuseOpWrite:      "Write",
+	fuseOpReadDirAll: "ReadDirAll",
+	fuseOpSetattr:    "Setattr",
+	fuseOpMkdir:      "Mkdir",
+	fuseOpAccess:     "Access",
+	fuseOpFsync:      "Fsync",
+}
+
+//
+// Per fuse-server operation counters. As there's a fuse-server per sys
+// container, these counters allow us to identify the containers that are
+// hammering sysbox-fs' emulated resources. Counters are updated atomically to
+// keep contention in the FUSE hot-path to a minimum.
+//
+type fuseServerStats struct {
+	ops    [fuseOpMax]uint64
+	errors [fuseOpMax]uint64
+}
+
+func (s *fuseServerStats) incOp(op fuseOp) {
+	atomic.AddUint64(&s.ops[op], 1)
+}
+
+func (s *fuseServerStats) incError(op fuseOp) {
+	atomic.AddUint64(&s.errors[op], 1)
+}
+
+func (s *fuseServerStats) snapshot() *domain.FuseServerStats {
+
+	res := &domain.FuseServerStats{
+		Ops:    make(map[string]uint64, fuseOpMax),
+		Errors: make(map[string]uint64, fuseOpMax),
+	}
+
+	for op := fuseOp(0); op < fuseOpMax; op++ {
+		res.Ops[fuseOpNames[op]] = atomic.LoadUint64(&s.ops[op])
+		res.Errors[fuseOpNames[op]] = atomic.LoadUint64(&s.errors[op])
+	}
+
+	return res
+}
@@ -0,0 +1,68 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fuse
+
+import (
+	"testing"
+)
+
+func TestFuseServerStats(t *testing.T) {
+
+	fss := NewFuseServerService()
+
+	s1 := &fuseServer{}
+	s1.stats.incOp(fuseOpRead)
+	s1.stats.incOp(fuseOpRead)
+	s1.stats.incOp(fuseOpWrite)
+	s1.stats.incError(fuseOpWrite)
+
+	s2 := &fuseServer{}
+	s2.stats.incOp(fuseOpLookup)
+
+	fss.serversMap["c1"] = s1
+	fss.serversMap["c2"] = s2
+
+	stats, err := fss.FuseServerStats("c1")
+	if err != nil {
+		t.Fatalf("FuseServerStats(c1) failed: %v", err)
+	}
+
+	// All operations are reported, including the ones not served yet.
+	if len(stats.Ops) != int(fuseOpMax) || len(stats.Errors) != int(fuseOpMax) {
+		t.Errorf("FuseServerStats(c1) = %+v, want all %d operations", stats, fuseOpMax)
+	}
+	if stats.Ops["Read"] != 2 || stats.Ops["Write"] != 1 || stats.Errors["Write"] != 1 ||
+		stats.Ops["Lookup"] != 0 || stats.Errors["Read"] != 0 {
+		t.Errorf("FuseServerStats(c1) = %+v", stats)
+	}
+
+	if _, err := fss.FuseServerStats("c3"); err == nil {
+		t.Errorf("FuseServerStats() of an unknown container succeeded")
+	}
+
+	all := fss.FuseServersStats()
+	if len(all) != 2 || all["c1"].Ops["Read"] != 2 || all["c2"].Ops["Lookup"] != 1 {
+		t.Errorf("FuseServersStats() = %+v", all)
+	}
+
+	// Snapshots aren't altered by later updates.
+	s1.stats.incOp(fuseOpRead)
+
+	if stats.Ops["Read"] != 2 {
+		t.Errorf("snapshot altered by a later update: %+v", stats)
+	}
+}
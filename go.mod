@@ -28,6 +28,7 @@ require (
 	google.golang.org/grpc v1.34.1
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/hlandau/service.v1 v1.0.7
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 replace github.com/nestybox/sysbox-ipc => ../sysbox-ipc
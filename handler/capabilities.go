@@ -0,0 +1,310 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+	cap "github.com/nestybox/sysbox-libs/capability"
+)
+
+//
+// capsHandler decorates handlers to enforce the capabilities declared by their
+// emulated resources (see domain.EmuResource), so that handlers don't need to
+// replicate these checks. Writes of the emulated sysctls are also subject to
+// the requester holding the capabilities demanded by the kernel for them (see
+// sysctlWriteCaps), which emulation would otherwise bypass.
+//
+type capsHandler struct {
+	domain.HandlerIface
+}
+
+// Returns the emulated resource matching the given node, if any.
+func (h *capsHandler) resource(n domain.IOnodeIface) (*domain.EmuResource, bool) {
+
+	hr, ok := h.HandlerIface.(domain.HandlerResourceIface)
+	if !ok {
+		return nil, false
+	}
+
+	return hr.GetResource(n)
+}
+
+func (h *capsHandler) passThrough() domain.HandlerIface {
+	return h.HandlerIface.GetService().GetPassThroughHandler()
+}
+
+func (h *capsHandler) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	resource, ok := h.resource(n)
+	if !ok {
+		return h.HandlerIface.Lookup(n, req)
+	}
+
+	if resource.Namespaced {
+		return h.passThrough().Lookup(n, req)
+	}
+
+	info, err := h.HandlerIface.Lookup(n, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resource.ReadOnly {
+		return readOnlyFileInfo{info}, nil
+	}
+
+	return info, nil
+}
+
+func (h *capsHandler) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	resource, ok := h.resource(n)
+	if !ok {
+		return h.HandlerIface.Open(n, req)
+	}
+
+	if resource.Namespaced {
+		return h.passThrough().Open(n, req)
+	}
+
+	if resource.ReadOnly {
+		flags := n.OpenFlags()
+		if flags&syscall.O_WRONLY == syscall.O_WRONLY ||
+			flags&syscall.O_RDWR == syscall.O_RDWR {
+			return fuse.IOerror{Code: syscall.EACCES}
+		}
+	}
+
+	return h.HandlerIface.Open(n, req)
+}
+
+func (h *capsHandler) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	resource, ok := h.resource(n)
+	if !ok {
+		return h.HandlerIface.Read(n, req)
+	}
+
+	if resource.Namespaced {
+		return h.passThrough().Read(n, req)
+	}
+
+	if resource.Static && req.Container != nil {
+		return h.readStatic(n, req)
+	}
+
+	return h.HandlerIface.Read(n, req)
+}
+
+// Serves static resources out of the container's data, which is populated by
+// the first read of the resource.
+func (h *capsHandler) readStatic(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	cntr := req.Container
+	path := n.Path()
+
+	// As stored values are never empty, nothing is read at offset 0 only if
+	// the resource hasn't been read yet.
+	probe := make([]byte, 1)
+	if sz, _ := cntr.Data(path, 0, &probe); sz > 0 {
+		sz, err := cntr.Data(path, req.Offset, &req.Data)
+		if err != nil && err != io.EOF {
+			return 0, fuse.IOerror{Code: syscall.EINVAL}
+		}
+		return sz, nil
+	}
+
+	sz, err := h.HandlerIface.Read(n, req)
+	if err != nil {
+		return 0, err
+	}
+
+	// Partial reads (i.e., at non-zero offsets) are not stored.
+	if req.Offset == 0 && sz > 0 {
+		cntr.Lock()
+		err = cntr.SetData(path, 0, req.Data[:sz])
+		cntr.Unlock()
+		if err != nil {
+			return 0, fuse.IOerror{Code: syscall.EINVAL}
+		}
+	}
+
+	return sz, nil
+}
+
+func (h *capsHandler) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	resource, ok := h.resource(n)
+	if !ok {
+		return h.HandlerIface.Write(n, req)
+	}
+
+	if resource.Namespaced {
+		return h.passThrough().Write(n, req)
+	}
+
+	if !h.writeCapable(n, req) {
+		return 0, fuse.IOerror{Code: syscall.EPERM}
+	}
+
+	data, err := checkValue(req.Data, resource)
+	if err != nil {
+		return 0, err
+	}
+
+	if resource.Range == nil {
+		return h.HandlerIface.Write(n, req)
+	}
+
+	// Writes of clamped values are reported as complete.
+	size := len(req.Data)
+	req.Data = data
+
+	if _, err := h.HandlerIface.Write(n, req); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// Reports whether the requester holds the capability required by the kernel to
+// write the given resource (if any). Capabilities are the ones of the requester
+// within its user-ns (i.e., the container's one).
+func (h *capsHandler) writeCapable(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) bool {
+
+	c, ok := sysctlWriteCap(n.Path())
+	if !ok || req.Container == nil {
+		return true
+	}
+
+	prs := h.HandlerIface.GetService().ProcessService()
+	process := prs.ProcessCreate(req.Pid, req.Uid, req.Gid)
+
+	return process.IsCapabilitySet(cap.EFFECTIVE, c)
+}
+
+func (h *capsHandler) GetResource(n domain.IOnodeIface) (*domain.EmuResource, bool) {
+	return h.resource(n)
+}
+
+func (h *capsHandler) GetWriteMode(n domain.IOnodeIface) domain.WriteMode {
+
+	if resource, ok := h.resource(n); ok && resource.Namespaced {
+		return domain.WriteModeThrough
+	}
+
+	return handlerWriteMode(h.HandlerIface, n)
+}
+
+// Validates the given value to be written into the given resource, returning
+// the value to write (i.e., clamped if required).
+func checkValue(data []byte, resource *domain.EmuResource) ([]byte, error) {
+
+	if resource.ReadOnly {
+		return nil, fuse.IOerror{Code: syscall.EPERM}
+	}
+
+	if resource.Schema != nil {
+		if err := checkSchema(data, resource.Schema); err != nil {
+			return nil, err
+		}
+	}
+
+	if resource.Range == nil {
+		return data, nil
+	}
+
+	return checkRange(data, resource.Range)
+}
+
+// Validates the given numeric value against the given range, returning the
+// value to write (i.e., clamped if required).
+func checkRange(data []byte, r *domain.EmuResourceRange) ([]byte, error) {
+
+	val, err := strconv.ParseInt(string(bytes.TrimSpace(data)), 10, 64)
+	if err != nil {
+		return nil, fuse.IOerror{Code: syscall.EINVAL}
+	}
+
+	if val >= r.Min && val <= r.Max {
+		return data, nil
+	}
+
+	if !r.Clamp {
+		return nil, fuse.IOerror{Code: syscall.EINVAL}
+	}
+
+	if val < r.Min {
+		val = r.Min
+	} else {
+		val = r.Max
+	}
+
+	return []byte(strconv.FormatInt(val, 10) + "\n"), nil
+}
+
+// Validates the given value against the given schema.
+func checkSchema(data []byte, s domain.ValueSchema) error {
+
+	if err := s.Validate(string(bytes.TrimSpace(data))); err != nil {
+		return fuse.IOerror{Code: syscall.EINVAL}
+	}
+
+	return nil
+}
+
+// Capabilities required to write the sysctls under the given paths, as per the
+// kernel's semantics.
+var sysctlWriteCaps = []struct {
+	path string
+	cap  cap.Cap
+}{
+	{"/proc/sys/net", cap.CAP_NET_ADMIN},
+	{"/proc/sys/kernel", cap.CAP_SYS_ADMIN},
+}
+
+// Returns the capability required to write the given resource, if any.
+func sysctlWriteCap(path string) (cap.Cap, bool) {
+
+	for _, c := range sysctlWriteCaps {
+		if strings.HasPrefix(path, c.path+"/") {
+			return c.cap, true
+		}
+	}
+
+	return 0, false
+}
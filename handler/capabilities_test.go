@@ -0,0 +1,85 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+func TestCheckRange(t *testing.T) {
+
+	reject := &domain.EmuResourceRange{Min: 0, Max: 10}
+	clamp := &domain.EmuResourceRange{Min: 0, Max: 10, Clamp: true}
+
+	tests := []struct {
+		data    string
+		r       *domain.EmuResourceRange
+		want    string
+		wantErr bool
+	}{
+		{"5\n", reject, "5\n", false},
+		{"0", reject, "0", false},
+		{"10\n", reject, "10\n", false},
+		{"11\n", reject, "", true},
+		{"-1\n", reject, "", true},
+		{"abc\n", reject, "", true},
+		{"5\n", clamp, "5\n", false},
+		{"11\n", clamp, "10\n", false},
+		{"-1\n", clamp, "0\n", false},
+		{"abc\n", clamp, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := checkRange([]byte(tt.data), tt.r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkRange(%q, %+v) error = %v, wantErr %v",
+				tt.data, *tt.r, err, tt.wantErr)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("checkRange(%q, %+v) = %q, want %q",
+				tt.data, *tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+
+	tests := []struct {
+		data    string
+		schema  domain.ValueSchema
+		wantErr bool
+	}{
+		{"2\n", domain.IntSchema{Min: 0, Max: 3}, false},
+		{" 3 \n", domain.IntSchema{Min: 0, Max: 3}, false},
+		{"4\n", domain.IntSchema{Min: 0, Max: 3}, true},
+		{"0\t2147483647\n", domain.IntRangeSchema{Min: 0, Max: 2147483647}, false},
+		{"-1 10\n", domain.IntRangeSchema{Min: 0, Max: 2147483647}, true},
+		{"reno\n", domain.EnumSchema{Values: []string{"cubic", "reno"}}, false},
+		{"bbr\n", domain.EnumSchema{Values: []string{"cubic", "reno"}}, true},
+	}
+
+	for _, tt := range tests {
+		err := checkSchema([]byte(tt.data), tt.schema)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkSchema(%q, %+v) error = %v, wantErr %v",
+				tt.data, tt.schema, err, tt.wantErr)
+		}
+	}
+}
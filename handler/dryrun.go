@@ -0,0 +1,113 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-libs/formatter"
+)
+
+//
+// dryRunHandler decorates handlers when sysbox-fs operates in dry-run mode. In
+// this mode no emulation takes place: every operation is served by the
+// passthrough handler (i.e., straight from the container's procfs / sysfs
+// kernel files), and the handler that would have emulated it is logged. This
+// helps users to determine if a container malfunction is caused by sysbox-fs
+// emulation.
+//
+// Every (handler, resource, operation) tuple is logged only once to prevent
+// flooding the logs with repetitive entries.
+//
+type dryRunHandler struct {
+	domain.HandlerIface
+	passThrough domain.HandlerIface
+	logged      *sync.Map
+}
+
+func (h *dryRunHandler) log(
+	op domain.HandlerOp,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) {
+
+	key := h.GetName() + ":" + n.Path() + ":" + string(op)
+	if _, loaded := h.logged.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	var cntrID string
+	if req.Container != nil {
+		cntrID = req.Container.ID()
+	}
+
+	logrus.Infof("Dry-run: %s() on %s would be emulated by handler %s (container %s); passing it through",
+		op, n.Path(), h.GetName(), formatter.ContainerID{cntrID})
+}
+
+func (h *dryRunHandler) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	h.log(domain.HandlerOpLookup, n, req)
+
+	return h.passThrough.Lookup(n, req)
+}
+
+func (h *dryRunHandler) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	h.log(domain.HandlerOpOpen, n, req)
+
+	return h.passThrough.Open(n, req)
+}
+
+func (h *dryRunHandler) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	h.log(domain.HandlerOpRead, n, req)
+
+	return h.passThrough.Read(n, req)
+}
+
+func (h *dryRunHandler) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	h.log(domain.HandlerOpWrite, n, req)
+
+	return h.passThrough.Write(n, req)
+}
+
+func (h *dryRunHandler) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	h.log(domain.HandlerOpReadDirAll, n, req)
+
+	return h.passThrough.ReadDirAll(n, req)
+}
+
+// Nodes are passed through, so they are written through as well.
+func (h *dryRunHandler) GetWriteMode(n domain.IOnodeIface) domain.WriteMode {
+	return domain.WriteModeThrough
+}
@@ -22,14 +22,14 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
 	"github.com/nestybox/sysbox-fs/handler/implementations"
-
-	iradix "github.com/hashicorp/go-immutable-radix"
 )
 
 // Slice of sysbox-fs' default handlers and the respective paths where they
@@ -39,33 +39,63 @@ import (
 var DefaultHandlers = []domain.HandlerIface{
 	implementations.PassThrough_Handler,                    // *
 	implementations.Root_Handler,                           // /
+	implementations.DevKmsg_Handler,                        // /dev/kmsg
 	implementations.ProcUptime_Handler,                     // /proc/uptime
+	implementations.ProcCgroups_Handler,                    // /proc/cgroups
+	implementations.ProcCpuinfo_Handler,                    // /proc/cpuinfo
+	implementations.ProcCrypto_Handler,                     // /proc/crypto
+	implementations.ProcDevices_Handler,                    // /proc/devices
+	implementations.ProcKallsyms_Handler,                   // /proc/kallsyms
+	implementations.ProcKeys_Handler,                       // /proc/keys
+	implementations.ProcKeyUsers_Handler,                   // /proc/key-users
+	implementations.ProcKmsg_Handler,                       // /proc/kmsg
+	implementations.ProcModules_Handler,                    // /proc/modules
+	implementations.ProcNet_Handler,                        // /proc/net
+	implementations.ProcSchedstat_Handler,                  // /proc/schedstat
+	implementations.ProcSoftirqs_Handler,                   // /proc/softirqs
+	implementations.ProcStat_Handler,                       // /proc/stat
 	implementations.ProcSwaps_Handler,                      // /proc/swaps
 	implementations.ProcSys_Handler,                        // /proc/sys
+	implementations.ProcSysCrypto_Handler,                  // /proc/sys/crypto
 	implementations.ProcSysFs_Handler,                      // /proc/sys/fs
 	implementations.ProcSysKernel_Handler,                  // /proc/sys/kernel
+	implementations.ProcSysKernelKeys_Handler,              // /proc/sys/kernel/keys
 	implementations.ProcSysKernelYama_Handler,              // /proc/sys/kernel/yama
+	implementations.ProcSysNetBridge_Handler,               // /proc/sys/net/bridge
 	implementations.ProcSysNetCore_Handler,                 // /proc/sys/net/core
 	implementations.ProcSysNetIpv4_Handler,                 // /proc/sys/net/ipv4
 	implementations.ProcSysNetIpv4Vs_Handler,               // /proc/sys/net/ipv4/vs
 	implementations.ProcSysNetIpv4Neigh_Handler,            // /proc/sys/net/ipv4/neigh
 	implementations.ProcSysNetNetfilter_Handler,            // /proc/sys/net/netfilter
 	implementations.ProcSysNetUnix_Handler,                 // /proc/sys/net/unix
+	implementations.ProcSysUser_Handler,                    // /proc/sys/user
 	implementations.ProcSysVm_Handler,                      // /proc/sys/vm
+	implementations.ProcSysVmNrHugepages_Handler,           // /proc/sys/vm/nr_hugepages
+	implementations.ProcSysvipc_Handler,                    // /proc/sysvipc
+	implementations.ProcTimerList_Handler,                  // /proc/timer_list
 	implementations.SysKernel_Handler,                      // /sys/kernel
+	implementations.SysKernelDebug_Handler,                 // /sys/kernel/debug
+	implementations.SysKernelMmHugepages_Handler,           // /sys/kernel/mm/hugepages
+	implementations.SysKernelSecurity_Handler,              // /sys/kernel/security
+	implementations.SysClassNet_Handler,                    // /sys/class/net
+	implementations.SysClassTty_Handler,                    // /sys/class/tty
+	implementations.SysDevicesSystemCpu_Handler,            // /sys/devices/system/cpu
 	implementations.SysDevicesVirtual_Handler,              // /sys/devices/virtual
 	implementations.SysDevicesVirtualDmi_Handler,           // /sys/devices/virtual/dmi
 	implementations.SysDevicesVirtualDmiId_Handler,         // /sys/devices/virtual/dmi/id
+	implementations.SysFirmware_Handler,                    // /sys/firmware
+	implementations.SysFsCgroup_Handler,                    // /sys/fs/cgroup
 	implementations.SysModuleNfconntrackParameters_Handler, // /sys/module/nf_conntrack/parameters
+	implementations.SysPower_Handler,                       // /sys/power
 }
 
 type handlerService struct {
 	sync.RWMutex
 
-	// Radix-tree indexed by node FS path. Tree serves as an ordered DB where to
-	// keep track of the association between the FS nodes being emulated, and
-	// their matching handler object.
-	handlerTree *iradix.Tree
+	// Tree indexed by node FS path components. Tree keeps track of the
+	// association between the FS nodes being emulated, and their matching
+	// handler object (see handlerTree.go).
+	handlerTree *handlerTree
 
 	// Pointer to the service providing container-state storage functionality.
 	css domain.ContainerStateServiceIface
@@ -91,17 +121,36 @@ type handlerService struct {
 	// Handler i/o errors should be obviated if this flag is enabled (testing
 	// purposes).
 	ignoreErrors bool
+
+	// Per-handler operation statistics.
+	stats *handlerStatsDB
+
+	// Resource policies.
+	policies *policyDB
+
+	// In dry-run mode no emulation is performed: all operations are passed
+	// through to the kernel, and the handlers that would have served them are
+	// logged.
+	dryRun       bool
+	dryRunLogged sync.Map
+
+	// Resources requiring host root already reported in rootless mode.
+	rootlessLogged sync.Map
 }
 
 // HandlerService constructor.
 func NewHandlerService() domain.HandlerServiceIface {
 
-	return &handlerService{}
+	return &handlerService{
+		stats:    newHandlerStatsDB(),
+		policies: newPolicyDB(nil, nil),
+	}
 }
 
 func (hs *handlerService) Setup(
 	hdlrs []domain.HandlerIface,
 	ignoreErrors bool,
+	dryRun bool,
 	css domain.ContainerStateServiceIface,
 	nss domain.NSenterServiceIface,
 	prs domain.ProcessServiceIface,
@@ -112,11 +161,9 @@ func (hs *handlerService) Setup(
 	hs.prs = prs
 	hs.ios = ios
 	hs.ignoreErrors = ignoreErrors
+	hs.dryRun = dryRun
 
-	hs.handlerTree = iradix.New()
-	if hs.handlerTree == nil {
-		logrus.Fatalf("Unable to allocate handler radix-tree")
-	}
+	hs.handlerTree = newHandlerTree()
 
 	// Register all handlers declared and their associated resources.
 	for _, h := range hdlrs {
@@ -146,7 +193,7 @@ func (hs *handlerService) RegisterHandler(h domain.HandlerIface) error {
 	name := h.GetName()
 	path := h.GetPath()
 
-	if _, ok := hs.handlerTree.Get([]byte(path)); ok {
+	if !hs.handlerTree.insert(path, h) {
 		hs.Unlock()
 		logrus.Errorf("Handler %v already registered", name)
 		return errors.New("Handler already registered")
@@ -154,13 +201,14 @@ func (hs *handlerService) RegisterHandler(h domain.HandlerIface) error {
 
 	h.SetService(hs)
 
-	tree, _, ok := hs.handlerTree.Insert([]byte(path), h)
-	if ok {
-		hs.Unlock()
-		logrus.Errorf("Handler %v already registered", name)
-		return errors.New("Handler already registered")
+	if hi, ok := h.(domain.HandlerInitIface); ok {
+		if err := hi.Init(); err != nil {
+			hs.handlerTree.remove(path)
+			hs.Unlock()
+			logrus.Errorf("Handler %v initialization failed: %v", name, err)
+			return fmt.Errorf("Handler initialization failed: %v", err)
+		}
 	}
-	hs.handlerTree = tree
 	hs.Unlock()
 
 	return nil
@@ -172,15 +220,17 @@ func (hs *handlerService) UnregisterHandler(h domain.HandlerIface) error {
 	name := h.GetName()
 	path := h.GetPath()
 
-	if _, ok := hs.handlerTree.Get([]byte(path)); !ok {
+	if !hs.handlerTree.remove(path) {
 		hs.Unlock()
 		logrus.Errorf("Handler %v not previously registered", name)
 		return errors.New("Handler not previously registered")
 	}
-
-	hs.handlerTree, _, _ = hs.handlerTree.Delete([]byte(path))
 	hs.Unlock()
 
+	if hf, ok := h.(domain.HandlerFiniIface); ok {
+		hf.Fini()
+	}
+
 	return nil
 }
 
@@ -190,43 +240,101 @@ func (hs *handlerService) LookupHandler(
 	hs.RLock()
 	defer hs.RUnlock()
 
-	var h domain.HandlerIface
-
-	// Iterate the handler's radix-tree looking for the handler that better
-	// match the fs node being searched.
-	//
-	// Notice that this approach could potentially lead to overlapping scenarios
-	// if we were to have handlers such as "/proc/update" and "/proc/update_1",
-	// but there's no such a case today. If we ever need to address this point,
-	// we would simply extend this handler-lookup logic by placing it in a "for"
-	// loop and by comparing the "base" components of the overlapping elements.
-	_, node, ok := hs.handlerTree.Root().LongestPrefix([]byte(i.Path()))
+	// Search the handler-tree for the handler that better matches the fs node
+	// being searched. Only full path components are matched, so handlers such
+	// as "/proc/update" don't apply to "/proc/update_1".
+	if hs.dryRun {
+		h, ok := hs.handlerTree.lookup(i.Path(), nil)
+		if !ok {
+			return nil, false
+		}
+		return hs.withDryRun(h), true
+	}
+
+	// Disabled handlers are skipped, so the closest (enabled) ancestor handler
+	// serves the nodes of the disabled ones.
+	h, ok := hs.handlerTree.lookup(i.Path(), func(h domain.HandlerIface) bool {
+		return h.GetEnabled()
+	})
 	if !ok {
 		return nil, false
 	}
 
-	h = node.(domain.HandlerIface)
+	return hs.withPolicies(hs.withCapabilities(hs.withRootless(h))), true
+}
+
+// Decorates the given handler to enforce the capabilities of its emulated
+// resources.
+func (hs *handlerService) withCapabilities(h domain.HandlerIface) domain.HandlerIface {
+
+	if _, ok := h.(domain.HandlerResourceIface); !ok {
+		return h
+	}
+
+	return &capsHandler{HandlerIface: h}
+}
+
+// Decorates the given handler to enforce the resource policies defined for
+// the daemon and for the container being served. Notice that the latter are
+// only known at request time.
+func (hs *handlerService) withPolicies(h domain.HandlerIface) domain.HandlerIface {
+	return &policyHandler{HandlerIface: h, policies: hs.policies}
+}
+
+// Decorates the given handler to reject the accesses requiring host root in
+// rootless mode. Only the handlers serving such resources are decorated.
+func (hs *handlerService) withRootless(h domain.HandlerIface) domain.HandlerIface {
+
+	if !domain.Rootless() || !hostRootHandler(h.GetPath()) {
+		return h
+	}
+
+	return &rootlessHandler{HandlerIface: h, logged: &hs.rootlessLogged}
+}
+
+// Returns the write mode of the given node, as defined by the given handler.
+func handlerWriteMode(h domain.HandlerIface, n domain.IOnodeIface) domain.WriteMode {
+
+	if hw, ok := h.(domain.HandlerWriteModeIface); ok {
+		return hw.GetWriteMode(n)
+	}
+
+	return domain.WriteModeBack
+}
+
+// Decorates the given handler to pass all operations through to the kernel
+// (dry-run mode).
+func (hs *handlerService) withDryRun(h domain.HandlerIface) domain.HandlerIface {
 
-	return h, true
+	if h == hs.passThroughHandler {
+		return h
+	}
+
+	return &dryRunHandler{
+		HandlerIface: h,
+		passThrough:  hs.passThroughHandler,
+		logged:       &hs.dryRunLogged,
+	}
+}
+
+// Lookups a handler by path. Caller must hold the handler-service lock.
+func (hs *handlerService) findHandler(s string) (domain.HandlerIface, bool) {
+
+	return hs.handlerTree.get(s)
 }
 
 func (hs *handlerService) FindHandler(s string) (domain.HandlerIface, bool) {
 	hs.RLock()
 	defer hs.RUnlock()
 
-	h, ok := hs.handlerTree.Get([]byte(s))
-	if !ok {
-		return nil, false
-	}
-
-	return h.(domain.HandlerIface), true
+	return hs.findHandler(s)
 }
 
 func (hs *handlerService) EnableHandler(path string) error {
 	hs.Lock()
 	defer hs.Unlock()
 
-	h, ok := hs.FindHandler(path)
+	h, ok := hs.findHandler(path)
 	if !ok {
 		return fmt.Errorf("handler %s not found in handlerDB", path)
 	}
@@ -240,7 +348,7 @@ func (hs *handlerService) DisableHandler(path string) error {
 	hs.Lock()
 	defer hs.Unlock()
 
-	h, ok := hs.FindHandler(path)
+	h, ok := hs.findHandler(path)
 	if !ok {
 		return fmt.Errorf("handler %s not found in handlerDB", path)
 	}
@@ -262,9 +370,8 @@ func (hs *handlerService) HandlersResourcesList() []string {
 
 	// Iterate through the handlerDB to extract the list of resources being
 	// emulated.
-	hs.handlerTree.Root().Walk(func(key []byte, val interface{}) bool {
+	hs.handlerTree.walk(func(path string, h domain.HandlerIface) bool {
 
-		h := val.(domain.HandlerIface)
 		if !h.GetEnabled() {
 			return true
 		}
@@ -306,6 +413,71 @@ func (hs *handlerService) IgnoreErrors() bool {
 	return hs.ignoreErrors
 }
 
+func (hs *handlerService) DryRun() bool {
+	return hs.dryRun
+}
+
+func (hs *handlerService) SetResourcePolicies(
+	policies map[string]domain.ResourcePolicy,
+	labeled []domain.LabeledResourcePolicies) {
+
+	hs.Lock()
+	defer hs.Unlock()
+
+	hs.policies = newPolicyDB(policies, labeled)
+}
+
+func (hs *handlerService) GetResourcePolicy(path string) domain.ResourcePolicy {
+	hs.RLock()
+	defer hs.RUnlock()
+
+	return hs.policies.lookup(path)
+}
+
+// CheckResourceValue validates a value to be stored into the given emulated
+// resource as writes of the resource are validated (see capsHandler), returning
+// the value to store (i.e., clamped if required).
+func (hs *handlerService) CheckResourceValue(
+	path string,
+	data []byte) ([]byte, error) {
+
+	hs.RLock()
+	h, ok := hs.handlerTree.lookup(path, func(h domain.HandlerIface) bool {
+		return h.GetEnabled()
+	})
+	hs.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no handler found for %s", path)
+	}
+
+	hr, ok := h.(domain.HandlerResourceIface)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an emulated resource", path)
+	}
+
+	n := hs.ios.NewIOnode(filepath.Base(path), path, 0)
+
+	resource, ok := hr.GetResource(n)
+	if !ok || resource.Namespaced {
+		return nil, fmt.Errorf("%s is not an emulated resource", path)
+	}
+
+	return checkValue(data, resource)
+}
+
+func (hs *handlerService) RecordHandlerStats(
+	name string,
+	op domain.HandlerOp,
+	latency time.Duration,
+	err error) {
+
+	hs.stats.record(name, op, latency, err)
+}
+
+func (hs *handlerService) HandlersStats() map[string]map[domain.HandlerOp]*domain.HandlerOpStats {
+	return hs.stats.snapshot()
+}
+
 //
 // Auxiliary methods
 //
@@ -0,0 +1,232 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Handler tree: trie indexed by the components of the handlers' paths, where
+// each node holds the handler (if any) registered for that path. A handler
+// applies to its path as well as to all of its descendants, so the handler of a
+// given FS node is the one registered at the longest matching path prefix,
+// which is found by descending the tree (i.e., O(path length) in the absence of
+// wildcards).
+//
+// Handler paths can hold wildcard ("*") components, matching any single path
+// component (e.g., "/proc/sys/net/ipv4/conf/*"). Exact components take
+// precedence over wildcards during lookups, though the wildcard sibling of an
+// exact component is still looked into when it yields a longer match (e.g.,
+// "/proc/sys/net/*/conf" for "/proc/sys/net/ipv4/conf/eth0", even if there's a
+// "/proc/sys/net/ipv4/conf/all" handler).
+//
+// Handlers with non-absolute (symbolic) paths, such as the pass-through one,
+// are kept aside, as they don't apply to any particular FS location.
+//
+
+const handlerTreeWildcard = "*"
+
+type handlerTreeNode struct {
+	handler  domain.HandlerIface
+	children map[string]*handlerTreeNode
+}
+
+type handlerTree struct {
+	root     *handlerTreeNode
+	symbolic map[string]domain.HandlerIface
+}
+
+func newHandlerTree() *handlerTree {
+	return &handlerTree{
+		root:     &handlerTreeNode{},
+		symbolic: make(map[string]domain.HandlerIface),
+	}
+}
+
+// Splits the given absolute path into its components.
+func pathComponents(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// Returns the node matching the given path exactly, creating the missing ones
+// if requested.
+func (t *handlerTree) node(path string, create bool) *handlerTreeNode {
+
+	n := t.root
+
+	for _, c := range pathComponents(path) {
+		child, ok := n.children[c]
+		if !ok {
+			if !create {
+				return nil
+			}
+			if n.children == nil {
+				n.children = make(map[string]*handlerTreeNode)
+			}
+			child = &handlerTreeNode{}
+			n.children[c] = child
+		}
+		n = child
+	}
+
+	return n
+}
+
+// Registers a handler at the given path. Returns false if a handler is already
+// registered there.
+func (t *handlerTree) insert(path string, h domain.HandlerIface) bool {
+
+	if !strings.HasPrefix(path, "/") {
+		if _, ok := t.symbolic[path]; ok {
+			return false
+		}
+		t.symbolic[path] = h
+		return true
+	}
+
+	n := t.node(path, true)
+	if n.handler != nil {
+		return false
+	}
+	n.handler = h
+
+	return true
+}
+
+// Unregisters the handler at the given path. Returns false if there's none.
+// Notice that emptied nodes are left in place, as handlers are rarely (if ever)
+// unregistered.
+func (t *handlerTree) remove(path string) bool {
+
+	if !strings.HasPrefix(path, "/") {
+		if _, ok := t.symbolic[path]; !ok {
+			return false
+		}
+		delete(t.symbolic, path)
+		return true
+	}
+
+	n := t.node(path, false)
+	if n == nil || n.handler == nil {
+		return false
+	}
+	n.handler = nil
+
+	return true
+}
+
+// Returns the handler registered at the given path.
+func (t *handlerTree) get(path string) (domain.HandlerIface, bool) {
+
+	if !strings.HasPrefix(path, "/") {
+		h, ok := t.symbolic[path]
+		return h, ok
+	}
+
+	n := t.node(path, false)
+	if n == nil || n.handler == nil {
+		return nil, false
+	}
+
+	return n.handler, true
+}
+
+// Returns the handler registered at the longest prefix of the given path that
+// satisfies the 'accept' condition (if any).
+func (t *handlerTree) lookup(
+	path string,
+	accept func(domain.HandlerIface) bool) (domain.HandlerIface, bool) {
+
+	match, _ := t.root.lookup(pathComponents(path), accept)
+
+	return match, match != nil
+}
+
+// Returns the handler registered at the longest prefix of the given path
+// components (relative to this node) that satisfies the 'accept' condition,
+// along with the number of components matched (-1 if no handler is found).
+// Exact matches prevail over wildcard ones of the same length.
+func (n *handlerTreeNode) lookup(
+	comps []string,
+	accept func(domain.HandlerIface) bool) (domain.HandlerIface, int) {
+
+	var (
+		match domain.HandlerIface
+		depth = -1
+	)
+
+	if n.handler != nil && (accept == nil || accept(n.handler)) {
+		match, depth = n.handler, 0
+	}
+
+	if len(comps) == 0 {
+		return match, depth
+	}
+
+	for _, c := range []string{comps[0], handlerTreeWildcard} {
+		child, ok := n.children[c]
+		if !ok {
+			continue
+		}
+		if h, d := child.lookup(comps[1:], accept); h != nil && d+1 > depth {
+			match, depth = h, d+1
+		}
+	}
+
+	return match, depth
+}
+
+// Invokes the given function for every registered handler, in lexical order of
+// their paths, till the function returns true.
+func (t *handlerTree) walk(fn func(path string, h domain.HandlerIface) bool) {
+
+	var paths []string
+	handlers := make(map[string]domain.HandlerIface)
+
+	for path, h := range t.symbolic {
+		paths = append(paths, path)
+		handlers[path] = h
+	}
+
+	var collect func(path string, n *handlerTreeNode)
+	collect = func(path string, n *handlerTreeNode) {
+		if n.handler != nil {
+			key := path
+			if key == "" {
+				key = "/"
+			}
+			paths = append(paths, key)
+			handlers[key] = n.handler
+		}
+		for c, child := range n.children {
+			collect(path+"/"+c, child)
+		}
+	}
+	collect("", t.root)
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if fn(path, handlers[path]) {
+			return
+		}
+	}
+}
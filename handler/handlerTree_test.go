@@ -0,0 +1,177 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+type testHandler struct {
+	domain.HandlerIface
+	path    string
+	enabled bool
+}
+
+func (h *testHandler) GetEnabled() bool {
+	return h.enabled
+}
+
+func TestHandlerTree(t *testing.T) {
+
+	tree := newHandlerTree()
+
+	handlers := map[string]*testHandler{}
+	for _, path := range []string{
+		"*",
+		"/",
+		"/proc/sys",
+		"/proc/sys/net/ipv4",
+		"/proc/sys/net/ipv4/conf/*",
+		"/proc/sys/net/ipv4/conf/all",
+		"/proc/update",
+		"/sys/kernel",
+	} {
+		h := &testHandler{path: path, enabled: true}
+		handlers[path] = h
+		if !tree.insert(path, h) {
+			t.Fatalf("insert(%s) failed", path)
+		}
+	}
+	handlers["/sys/kernel"].enabled = false
+
+	if tree.insert("/proc/sys", &testHandler{}) {
+		t.Errorf("insert() of duplicated handler succeeded")
+	}
+
+	enabled := func(h domain.HandlerIface) bool { return h.GetEnabled() }
+
+	lookupTests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/proc", "/"},
+		{"/proc/sys", "/proc/sys"},
+		{"/proc/sys/", "/proc/sys"},
+		{"/proc/sysrq-trigger", "/"},
+		{"/proc/sys/kernel/panic", "/proc/sys"},
+		{"/proc/sys/net/ipv4/tcp_keepalive_time", "/proc/sys/net/ipv4"},
+		{"/proc/sys/net/ipv4/conf/eth0/forwarding", "/proc/sys/net/ipv4/conf/*"},
+		{"/proc/sys/net/ipv4/conf/all/forwarding", "/proc/sys/net/ipv4/conf/all"},
+		{"/proc/update", "/proc/update"},
+		{"/proc/update_1", "/"},
+		{"/sys/kernel/mm", "/"},
+	}
+
+	for _, tt := range lookupTests {
+		h, ok := tree.lookup(tt.path, enabled)
+		if !ok {
+			t.Errorf("lookup(%s) found no handler", tt.path)
+			continue
+		}
+		if got := h.(*testHandler).path; got != tt.want {
+			t.Errorf("lookup(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+
+	// Disabled handlers are only skipped upon request.
+	if h, _ := tree.lookup("/sys/kernel/mm", nil); h != handlers["/sys/kernel"] {
+		t.Errorf("lookup() skipped disabled handler")
+	}
+
+	if h, ok := tree.get("*"); !ok || h != handlers["*"] {
+		t.Errorf("get(*) failed")
+	}
+	if _, ok := tree.get("/proc/sys/net"); ok {
+		t.Errorf("get() returned handler for intermediate node")
+	}
+
+	var paths []string
+	tree.walk(func(path string, h domain.HandlerIface) bool {
+		paths = append(paths, path)
+		return false
+	})
+	want := []string{
+		"*",
+		"/",
+		"/proc/sys",
+		"/proc/sys/net/ipv4",
+		"/proc/sys/net/ipv4/conf/*",
+		"/proc/sys/net/ipv4/conf/all",
+		"/proc/update",
+		"/sys/kernel",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("walk() = %v, want %v", paths, want)
+	}
+
+	if !tree.remove("/proc/sys/net/ipv4") || tree.remove("/proc/sys/net/ipv4") {
+		t.Errorf("remove() failed")
+	}
+	if h, _ := tree.lookup("/proc/sys/net/ipv4/ip_forward", enabled); h != handlers["/proc/sys"] {
+		t.Errorf("lookup() returned removed handler")
+	}
+}
+
+func TestHandlerTreeWildcardBacktrack(t *testing.T) {
+
+	tree := newHandlerTree()
+
+	handlers := map[string]*testHandler{}
+	for _, path := range []string{
+		"/proc/sys",
+		"/proc/sys/net/*/conf",
+		"/proc/sys/net/ipv4/conf/all",
+		"/proc/sys/net/ipv6",
+	} {
+		h := &testHandler{path: path, enabled: true}
+		handlers[path] = h
+		if !tree.insert(path, h) {
+			t.Fatalf("insert(%s) failed", path)
+		}
+	}
+	handlers["/proc/sys/net/ipv6"].enabled = false
+
+	enabled := func(h domain.HandlerIface) bool { return h.GetEnabled() }
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		// Exact "ipv4" child matches, but its subtree misses.
+		{"/proc/sys/net/ipv4/conf/eth0", "/proc/sys/net/*/conf"},
+		{"/proc/sys/net/ipv4/conf/all/forwarding", "/proc/sys/net/ipv4/conf/all"},
+		{"/proc/sys/net/ipv4/tcp_syncookies", "/proc/sys"},
+		// Exact "ipv6" child's handler is disabled.
+		{"/proc/sys/net/ipv6/conf/eth0", "/proc/sys/net/*/conf"},
+		{"/proc/sys/net/ipv6/route", "/proc/sys"},
+	}
+
+	for _, tt := range tests {
+		h, ok := tree.lookup(tt.path, enabled)
+		if !ok {
+			t.Errorf("lookup(%s) found no handler", tt.path)
+			continue
+		}
+		if got := h.(*testHandler).path; got != tt.want {
+			t.Errorf("lookup(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package handlertest provides utilities for handlers' unit-testing.
+//
+// The Harness bundles all the services that handlers rely on, backed by
+// in-memory file-systems and a scriptable nsenter stub (see NSenter), so that
+// handlers can be exercised without root privileges, real namespaces, or
+// per-call mocking instructions:
+//
+//	h := handlertest.New(t, implementations.ProcSysVm_Handler)
+//	c := h.Container("c1", 1001)
+//	h.WriteHostFile("/proc/sys/vm/overcommit_memory", "0\n")
+//
+//	data, err := h.Read(implementations.ProcSysVm_Handler, c, 1001,
+//		"/proc/sys/vm/overcommit_memory")
+package handlertest
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/handler"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+	"github.com/nestybox/sysbox-fs/mount"
+	"github.com/nestybox/sysbox-fs/process"
+	"github.com/nestybox/sysbox-fs/state"
+	"github.com/nestybox/sysbox-fs/sysio"
+)
+
+// Namespace inode of the host's (i.e., sysbox-fs') namespaces. Containers'
+// namespaces are numbered after it.
+const hostNsInode domain.Inode = 100000
+
+type Harness struct {
+	t testing.TB
+
+	// File-system as seen by sysbox-fs (i.e., the host).
+	Host domain.IOServiceIface
+
+	// File-system as seen within the containers' namespaces, which is served
+	// by the nsenter stub.
+	Cntr domain.IOServiceIface
+
+	NSenter    *NSenter
+	Processes  domain.ProcessServiceIface
+	Containers domain.ContainerStateServiceIface
+	Handlers   domain.HandlerServiceIface
+
+	nsInodes map[domain.ContainerIface]domain.Inode
+}
+
+// New returns a harness serving the given handlers (along with the pass-through
+// one).
+func New(t testing.TB, handlers ...domain.HandlerIface) *Harness {
+
+	h := &Harness{
+		t:          t,
+		Host:       sysio.NewIOService(domain.IOMemFileService),
+		Cntr:       sysio.NewIOService(domain.IOMemFileService),
+		Processes:  newProcessService(process.NewProcessService()),
+		Containers: state.NewContainerStateService(),
+		Handlers:   handler.NewHandlerService(),
+		nsInodes:   make(map[domain.ContainerIface]domain.Inode),
+	}
+	h.NSenter = NewNSenter(h.Cntr)
+
+	mts := mount.NewMountService()
+
+	h.Processes.Setup(h.Host)
+	h.Containers.Setup(nil, h.Processes, h.Host, mts, h.Handlers)
+	mts.Setup(h.Containers, h.Handlers, h.Processes, h.NSenter)
+
+	// The handler service looks up sysbox-fs' own namespaces during setup.
+	self := h.Processes.ProcessCreate(uint32(os.Getpid()), 0, 0)
+	if err := self.CreateNsInodes(hostNsInode); err != nil {
+		t.Fatalf("unable to create sysbox-fs namespaces: %v", err)
+	}
+
+	h.Handlers.Setup(
+		append([]domain.HandlerIface{implementations.PassThrough_Handler}, handlers...),
+		false,
+		false,
+		h.Containers,
+		h.NSenter,
+		h.Processes,
+		h.Host)
+
+	return h
+}
+
+// Container creates a sys container with the given id and init process.
+func (h *Harness) Container(id string, pid uint32) domain.ContainerIface {
+	return h.AnnotatedContainer(id, pid, nil)
+}
+
+// AnnotatedContainer creates a sys container with the given id, init process
+// and annotations.
+func (h *Harness) AnnotatedContainer(
+	id string,
+	pid uint32,
+	annotations map[string]string) domain.ContainerIface {
+
+	c := h.Containers.ContainerCreate(
+		id,
+		pid,
+		time.Time{},
+		231072,
+		65535,
+		231072,
+		65535,
+		nil,
+		nil,
+		annotations,
+		nil)
+
+	_ = c.SetInitProc(pid, c.UID(), c.GID())
+
+	inode := hostNsInode + domain.Inode(len(h.nsInodes)+1)
+	if err := c.InitProc().CreateNsInodes(inode); err != nil {
+		h.t.Fatalf("unable to create container namespaces: %v", err)
+	}
+	h.nsInodes[c] = inode
+
+	// Containers aren't registered within the harness, so the sysctl values
+	// defined through annotations are seeded here, as they would be during
+	// registration (i.e., once validated through the sysctl's resource).
+	_, sysctls, _ := domain.ParseAnnotations(annotations)
+	for path, val := range sysctls {
+		data, err := h.Handlers.CheckResourceValue(path, []byte(val+"\n"))
+		if err != nil {
+			continue
+		}
+		if err := c.SetData(path, 0, data); err != nil {
+			h.t.Fatalf("unable to seed %s: %v", path, err)
+		}
+	}
+
+	return c
+}
+
+// Process creates a process within the namespaces of the given container, or
+// within its own namespaces if 'inner' is set (e.g., inner container).
+func (h *Harness) Process(pid uint32, c domain.ContainerIface, inner bool) {
+
+	inode, ok := h.nsInodes[c]
+	if !ok {
+		h.t.Fatalf("unknown container %s", c.ID())
+	}
+	if inner {
+		inode += 1000
+	}
+
+	p := h.Processes.ProcessCreate(pid, 0, 0)
+	if err := p.CreateNsInodes(inode); err != nil {
+		h.t.Fatalf("unable to create process namespaces: %v", err)
+	}
+}
+
+func writeFile(t testing.TB, ios domain.IOServiceIface, path, data string) {
+	if err := ios.NewIOnode(filepath.Base(path), path, 0).WriteFile([]byte(data)); err != nil {
+		t.Fatalf("unable to write %s: %v", path, err)
+	}
+}
+
+// WriteHostFile sets the contents of the given file on the host.
+func (h *Harness) WriteHostFile(path, data string) {
+	writeFile(h.t, h.Host, path, data)
+}
+
+// WriteCntrFile sets the contents of the given file as seen within the
+// containers' namespaces.
+func (h *Harness) WriteCntrFile(path, data string) {
+	writeFile(h.t, h.Cntr, path, data)
+}
+
+// HostFile returns the contents of the given file on the host.
+func (h *Harness) HostFile(path string) string {
+	data, err := h.Host.NewIOnode(filepath.Base(path), path, 0).ReadFile()
+	if err != nil {
+		h.t.Fatalf("unable to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+// Node returns the IO node of the given path.
+func (h *Harness) Node(path string) domain.IOnodeIface {
+	return h.Host.NewIOnode(filepath.Base(path), path, 0)
+}
+
+// Handler returns the handler serving the given path, as resolved by the
+// handler service (i.e., enforcing resource policies and capabilities).
+func (h *Harness) Handler(path string) domain.HandlerIface {
+	hdlr, ok := h.Handlers.LookupHandler(h.Node(path))
+	if !ok {
+		h.t.Fatalf("no handler found for %s", path)
+	}
+	return hdlr
+}
+
+// Request returns a handler request issued by the given process of the given
+// container.
+func (h *Harness) Request(c domain.ContainerIface, pid uint32) *domain.HandlerRequest {
+	return &domain.HandlerRequest{
+		Pid:       pid,
+		Container: c,
+	}
+}
+
+// Lookup looks up the given path through the given handler.
+func (h *Harness) Lookup(
+	hdlr domain.HandlerIface,
+	c domain.ContainerIface,
+	pid uint32,
+	path string) (os.FileInfo, error) {
+
+	return hdlr.Lookup(h.Node(path), h.Request(c, pid))
+}
+
+// Read reads the whole contents of the given path through the given handler.
+func (h *Harness) Read(
+	hdlr domain.HandlerIface,
+	c domain.ContainerIface,
+	pid uint32,
+	path string) (string, error) {
+
+	req := h.Request(c, pid)
+	req.Data = make([]byte, 4096)
+
+	// As in the fuse-server, EOF errors are reported as empty reads.
+	n, err := hdlr.Read(h.Node(path), req)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return string(req.Data[:n]), nil
+}
+
+// Write writes the given data into the given path through the given handler.
+func (h *Harness) Write(
+	hdlr domain.HandlerIface,
+	c domain.ContainerIface,
+	pid uint32,
+	path string,
+	data string) (int, error) {
+
+	req := h.Request(c, pid)
+	req.Data = []byte(data)
+
+	return hdlr.Write(h.Node(path), req)
+}
+
+// ReadDirAll lists the given path through the given handler, returning the
+// names of its entries.
+func (h *Harness) ReadDirAll(
+	hdlr domain.HandlerIface,
+	c domain.ContainerIface,
+	pid uint32,
+	path string) ([]string, error) {
+
+	entries, err := hdlr.ReadDirAll(h.Node(path), h.Request(c, pid))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names, nil
+}
@@ -0,0 +1,262 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handlertest
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+// Responder produces the response to an nsenter request issued on behalf of
+// the given process.
+type Responder func(pid uint32, req *domain.NSenterMessage) *domain.NSenterMessage
+
+//
+// NSenter is a scriptable stand-in for sysbox-fs' nsenter service. Instead of
+// entering the namespaces of the requester, the file-system requests (lookup,
+// open, read, write, readdir) are served out of an in-memory file-system that
+// represents the container's view (see Harness.WriteCntrFile()). Responses can
+// be overridden per message type through On().
+//
+type NSenter struct {
+	sync.Mutex
+	fs         domain.IOServiceIface
+	responders map[domain.NSenterMsgType]Responder
+	requests   []*domain.NSenterMessage
+}
+
+// NewNSenter returns an nsenter stub serving file-system requests out of the
+// given IO service.
+func NewNSenter(fs domain.IOServiceIface) *NSenter {
+	return &NSenter{
+		fs:         fs,
+		responders: make(map[domain.NSenterMsgType]Responder),
+	}
+}
+
+// On overrides the responses to the requests of the given type.
+func (n *NSenter) On(t domain.NSenterMsgType, r Responder) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.responders[t] = r
+}
+
+// Requests returns the requests received so far.
+func (n *NSenter) Requests() []*domain.NSenterMessage {
+	n.Lock()
+	defer n.Unlock()
+
+	return append([]*domain.NSenterMessage(nil), n.requests...)
+}
+
+// Reset drops the recorded requests.
+func (n *NSenter) Reset() {
+	n.Lock()
+	defer n.Unlock()
+
+	n.requests = nil
+}
+
+// ErrorResponse returns an nsenter error response carrying the given errno.
+func ErrorResponse(errno syscall.Errno) *domain.NSenterMessage {
+	return &domain.NSenterMessage{
+		Type:    domain.ErrorResponse,
+		Payload: fuse.IOerror{Code: errno},
+	}
+}
+
+type event struct {
+	pid uint32
+	req *domain.NSenterMessage
+	res *domain.NSenterMessage
+}
+
+func (e *event) SendRequest() error                      { return nil }
+func (e *event) TerminateRequest() error                 { return nil }
+func (e *event) ReceiveResponse() *domain.NSenterMessage { return e.res }
+func (e *event) SetRequestMsg(m *domain.NSenterMessage)  { e.req = m }
+func (e *event) GetRequestMsg() *domain.NSenterMessage   { return e.req }
+func (e *event) SetResponseMsg(m *domain.NSenterMessage) { e.res = m }
+func (e *event) GetResponseMsg() *domain.NSenterMessage  { return e.res }
+func (e *event) GetProcessID() uint32                    { return e.pid }
+
+func (n *NSenter) NewEvent(
+	pid uint32,
+	ns *[]domain.NStype,
+	req *domain.NSenterMessage,
+	res *domain.NSenterMessage,
+	async bool) domain.NSenterEventIface {
+
+	return &event{pid: pid, req: req, res: res}
+}
+
+func (n *NSenter) Setup(prs domain.ProcessServiceIface, mts domain.MountServiceIface) {
+}
+
+func (n *NSenter) SendRequestEvent(e domain.NSenterEventIface) error {
+
+	req := e.GetRequestMsg()
+
+	n.Lock()
+	n.requests = append(n.requests, req)
+	responder, ok := n.responders[req.Type]
+	n.Unlock()
+
+	if ok {
+		e.SetResponseMsg(responder(e.GetProcessID(), req))
+	} else {
+		e.SetResponseMsg(n.serve(req))
+	}
+
+	return nil
+}
+
+func (n *NSenter) ReceiveResponseEvent(e domain.NSenterEventIface) *domain.NSenterMessage {
+	return e.GetResponseMsg()
+}
+
+func (n *NSenter) TerminateRequestEvent(e domain.NSenterEventIface) error {
+	return nil
+}
+
+func (n *NSenter) GetEventProcessID(e domain.NSenterEventIface) uint32 {
+	return e.GetProcessID()
+}
+
+func (n *NSenter) TerminateAllRequests() int {
+	return 0
+}
+
+// Returns the errno matching the given error.
+func errnoOf(err error) syscall.Errno {
+
+	if os.IsNotExist(err) {
+		return syscall.ENOENT
+	}
+	if os.IsPermission(err) {
+		return syscall.EACCES
+	}
+	if pe, ok := err.(*os.PathError); ok {
+		if errno, ok := pe.Err.(syscall.Errno); ok {
+			return errno
+		}
+	}
+
+	return syscall.EIO
+}
+
+func fileInfo(info os.FileInfo) domain.FileInfo {
+	return domain.FileInfo{
+		Fname:    info.Name(),
+		Fsize:    info.Size(),
+		Fmode:    info.Mode(),
+		FmodTime: info.ModTime(),
+		FisDir:   info.IsDir(),
+	}
+}
+
+// Serves the given request out of the container's in-memory file-system.
+func (n *NSenter) serve(req *domain.NSenterMessage) *domain.NSenterMessage {
+
+	node := func(path string) domain.IOnodeIface {
+		return n.fs.NewIOnode(filepath.Base(path), path, 0)
+	}
+
+	switch p := req.Payload.(type) {
+
+	case *domain.LookupPayload:
+		info, err := node(p.Entry).Stat()
+		if err != nil {
+			return ErrorResponse(errnoOf(err))
+		}
+		return &domain.NSenterMessage{
+			Type:    domain.LookupResponse,
+			Payload: fileInfo(info),
+		}
+
+	case *domain.LookupBatchPayload:
+		infos := make(map[string]domain.FileInfo)
+		for _, entry := range p.Entries {
+			if info, err := node(entry).Stat(); err == nil {
+				infos[entry] = fileInfo(info)
+			}
+		}
+		return &domain.NSenterMessage{
+			Type:    domain.LookupBatchResponse,
+			Payload: infos,
+		}
+
+	case *domain.OpenFilePayload:
+		if _, err := node(p.File).Stat(); err != nil {
+			return ErrorResponse(errnoOf(err))
+		}
+		return &domain.NSenterMessage{Type: domain.OpenFileResponse}
+
+	case *domain.ReadFilePayload:
+		f := node(p.File)
+		if err := f.Open(); err != nil {
+			return ErrorResponse(errnoOf(err))
+		}
+		defer f.Close()
+
+		data := make([]byte, p.Len)
+		sz, err := f.ReadAt(data, p.Offset)
+		if err != nil && err != io.EOF {
+			return ErrorResponse(errnoOf(err))
+		}
+		return &domain.NSenterMessage{
+			Type:    domain.ReadFileResponse,
+			Payload: data[:sz],
+		}
+
+	case *domain.WriteFilePayload:
+		f := node(p.File)
+		f.SetOpenFlags(os.O_WRONLY)
+		if err := f.Open(); err != nil {
+			return ErrorResponse(errnoOf(err))
+		}
+		defer f.Close()
+
+		if _, err := f.WriteAt(p.Data, p.Offset); err != nil {
+			return ErrorResponse(errnoOf(err))
+		}
+		return &domain.NSenterMessage{Type: domain.WriteFileResponse}
+
+	case *domain.ReadDirPayload:
+		entries, err := node(p.Dir).ReadDirAll()
+		if err != nil {
+			return ErrorResponse(errnoOf(err))
+		}
+		infos := []domain.FileInfo{}
+		for _, e := range entries {
+			infos = append(infos, fileInfo(e))
+		}
+		return &domain.NSenterMessage{
+			Type:    domain.ReadDirResponse,
+			Payload: infos,
+		}
+	}
+
+	return ErrorResponse(syscall.ENOSYS)
+}
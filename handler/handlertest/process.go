@@ -0,0 +1,86 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handlertest
+
+import (
+	"sync"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	cap "github.com/nestybox/sysbox-libs/capability"
+)
+
+// Process service whose processes hold the capabilities set through
+// Harness.SetCaps (all of them by default, as the root user of a sys container
+// would), rather than the ones reported by the host's procfs.
+type processService struct {
+	domain.ProcessServiceIface
+	mu   sync.Mutex
+	caps map[uint32][]cap.Cap
+}
+
+func newProcessService(prs domain.ProcessServiceIface) *processService {
+	return &processService{
+		ProcessServiceIface: prs,
+		caps:                make(map[uint32][]cap.Cap),
+	}
+}
+
+func (ps *processService) ProcessCreate(pid, uid, gid uint32) domain.ProcessIface {
+	return &stubProcess{
+		ProcessIface: ps.ProcessServiceIface.ProcessCreate(pid, uid, gid),
+		ps:           ps,
+	}
+}
+
+func (ps *processService) capsOf(pid uint32) ([]cap.Cap, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	caps, ok := ps.caps[pid]
+	return caps, ok
+}
+
+type stubProcess struct {
+	domain.ProcessIface
+	ps *processService
+}
+
+func (p *stubProcess) IsCapabilitySet(which cap.CapType, what cap.Cap) bool {
+
+	caps, ok := p.ps.capsOf(p.Pid())
+	if !ok {
+		return true
+	}
+
+	for _, c := range caps {
+		if c == what {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetCaps sets the (effective) capabilities held by the given process.
+func (h *Harness) SetCaps(pid uint32, caps ...cap.Cap) {
+	ps := h.Processes.(*processService)
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.caps[pid] = caps
+}
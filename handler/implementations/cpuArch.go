@@ -0,0 +1,264 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Architecture-specific formatting of the cpu emulation files.
+//
+// The layout of /proc/cpuinfo differs across architectures, and so do the
+// entries native tools expect to find in it (e.g., "flags" / "cpu MHz" on
+// x86_64, "BogoMIPS" / "Features" on aarch64, "clock" on ppc64le, or the
+// machine-wide header listing each processor on s390x). Hence, the handlers
+// restricting it to a sys container's cpus (and the ones synthesizing cpu data
+// out of it) rely on the formatter of the host's architecture, which is
+// obtained out of /proc/sys/kernel/arch (or out of the architecture sysbox-fs
+// is built for, on kernels lacking it).
+//
+// Note that /proc/stat shares its layout across all architectures (see
+// ProcStat handler).
+//
+
+type cpuArch interface {
+	// Filters the contents of /proc/cpuinfo, keeping the given cpus' entries.
+	filterCpuinfo(data []byte, cpus map[int]bool) []byte
+
+	// Returns the frequency (in kHz) of the given cpu as per /proc/cpuinfo, or
+	// false if the architecture (or the host) doesn't report it.
+	cpuinfoFreq(data []byte, cpu int) (uint64, bool)
+}
+
+// Formatters indexed by machine name (as per uname).
+var cpuArchs = map[string]cpuArch{
+	"x86_64":  cpuinfoBlocksArch{freqKey: "cpu MHz"},
+	"aarch64": cpuinfoBlocksArch{},
+	"ppc64le": cpuinfoBlocksArch{freqKey: "clock"},
+	"s390x":   s390xArch{},
+}
+
+// Machine names matching the go architectures.
+var goArchMachines = map[string]string{
+	"amd64":   "x86_64",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// hostCpuArch returns the cpu formatter of the host's architecture, defaulting
+// to the x86_64 one for architectures without a dedicated formatter.
+func hostCpuArch(h domain.HandlerIface) cpuArch {
+
+	machine := goArchMachines[runtime.GOARCH]
+	if data, err := readHostFile(h, "/proc/sys/kernel/arch"); err == nil {
+		machine = strings.TrimSpace(string(data))
+	}
+
+	if arch, ok := cpuArchs[machine]; ok {
+		return arch
+	}
+
+	return cpuArchs["x86_64"]
+}
+
+//
+// cpuinfo made of one block (i.e., paragraph) per cpu, starting with a
+// "processor : <N>" entry, possibly followed by machine-wide blocks (e.g.,
+// "timebase", "platform" and "model" on ppc64le). Covers x86_64, aarch64 and
+// ppc64le.
+//
+type cpuinfoBlocksArch struct {
+	freqKey string // entry holding the cpu frequency in MHz (if any)
+}
+
+func (a cpuinfoBlocksArch) filterCpuinfo(data []byte, cpus map[int]bool) []byte {
+
+	var blocks []string
+
+	for _, block := range cpuinfoBlocks(data) {
+		if cpu, ok := cpuinfoBlockCpu(block, "processor"); ok && !cpus[cpu] {
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+
+	return joinCpuinfoBlocks(blocks, data)
+}
+
+func (a cpuinfoBlocksArch) cpuinfoFreq(data []byte, cpu int) (uint64, bool) {
+
+	if a.freqKey == "" {
+		return 0, false
+	}
+
+	for _, block := range cpuinfoBlocks(data) {
+		if c, ok := cpuinfoBlockCpu(block, "processor"); ok && c == cpu {
+			return cpuinfoBlockFreq(block, a.freqKey)
+		}
+	}
+
+	return 0, false
+}
+
+//
+// s390x cpuinfo: a machine-wide header block (listing the number of processors
+// and a "processor <N>: ..." line per cpu), followed by one block per cpu
+// starting with a "cpu number : <N>" entry.
+//
+type s390xArch struct{}
+
+func (a s390xArch) filterCpuinfo(data []byte, cpus map[int]bool) []byte {
+
+	var blocks []string
+
+	for _, block := range cpuinfoBlocks(data) {
+		if cpu, ok := cpuinfoBlockCpu(block, "cpu number"); ok {
+			if cpus[cpu] {
+				blocks = append(blocks, block)
+			}
+			continue
+		}
+
+		var (
+			lines []string
+			count int
+			total = -1 // index of the "# processors" line
+		)
+
+		for _, line := range strings.Split(block, "\n") {
+			key := strings.TrimSpace(strings.SplitN(line, ":", 2)[0])
+
+			if key == "# processors" {
+				total = len(lines)
+			} else if strings.HasPrefix(key, "processor ") {
+				cpu, err := strconv.Atoi(strings.TrimPrefix(key, "processor "))
+				if err == nil && !cpus[cpu] {
+					continue
+				}
+				count++
+			}
+			lines = append(lines, line)
+		}
+
+		if total >= 0 {
+			lines[total] = fmt.Sprintf("# processors    : %d", count)
+		}
+
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+
+	return joinCpuinfoBlocks(blocks, data)
+}
+
+func (a s390xArch) cpuinfoFreq(data []byte, cpu int) (uint64, bool) {
+
+	for _, block := range cpuinfoBlocks(data) {
+		if c, ok := cpuinfoBlockCpu(block, "cpu number"); ok && c == cpu {
+			return cpuinfoBlockFreq(block, "cpu MHz dynamic")
+		}
+	}
+
+	return 0, false
+}
+
+// Splits the contents of /proc/cpuinfo into its (non-empty) blocks.
+func cpuinfoBlocks(data []byte) []string {
+
+	var blocks []string
+
+	for _, b := range strings.Split(string(data), "\n\n") {
+		if b = strings.Trim(b, "\n"); b != "" {
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks
+}
+
+// Joins the given cpuinfo blocks, terminating the result as the original
+// contents are (i.e., with or without a trailing empty line).
+func joinCpuinfoBlocks(blocks []string, data []byte) []byte {
+
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(strings.Join(blocks, "\n\n"))
+	if bytes.HasSuffix(data, []byte("\n\n")) {
+		buf.WriteString("\n\n")
+	} else {
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes()
+}
+
+// Returns the value of the given entry of a cpuinfo block.
+func cpuinfoBlockValue(block, key string) (string, bool) {
+
+	for _, line := range strings.Split(block, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == key {
+			return strings.TrimSpace(fields[1]), true
+		}
+	}
+
+	return "", false
+}
+
+// Returns the cpu a cpuinfo block belongs to, as per the given entry.
+func cpuinfoBlockCpu(block, key string) (int, bool) {
+
+	val, ok := cpuinfoBlockValue(block, key)
+	if !ok {
+		return 0, false
+	}
+
+	cpu, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
+	}
+
+	return cpu, true
+}
+
+// Returns the frequency (in kHz) held by the given entry of a cpuinfo block,
+// expressed in MHz (e.g., "2400.000" or "2166.000000MHz").
+func cpuinfoBlockFreq(block, key string) (uint64, bool) {
+
+	val, ok := cpuinfoBlockValue(block, key)
+	if !ok {
+		return 0, false
+	}
+
+	mhz, err := strconv.ParseFloat(strings.TrimSuffix(val, "MHz"), 64)
+	if err != nil || mhz <= 0 {
+		return 0, false
+	}
+
+	return uint64(mhz * 1000), true
+}
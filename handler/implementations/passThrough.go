@@ -62,6 +62,11 @@ func (h *PassThrough) Lookup(
 	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
 		req.ID, h.Name, n.Name())
 
+	// Entries of recently listed directories are looked up in batches.
+	if info, ok := h.lookupBatched(n, req); ok {
+		return info, nil
+	}
+
 	// Create nsenterEvent to initiate interaction with container namespaces.
 	nss := h.Service.NSenterService()
 	event := nss.NewEvent(
@@ -176,42 +181,53 @@ func (h *PassThrough) Read(
 
 	if domain.ProcessNsMatch(process, cntr.InitProc()) {
 
-		cntr.Lock()
-
 		// Check the data cache
 		sz, err = cntr.Data(path, req.Offset, &req.Data)
 		if err != nil && err != io.EOF {
-			cntr.Unlock()
 			return 0, fuse.IOerror{Code: syscall.EINVAL}
 		}
 
 		if req.Offset == 0 && sz == 0 && err == io.EOF {
 
-			// Resource is not cached, read it from the filesystem.
+			// Resource is not cached, read it from the filesystem. Notice that
+			// the container lock is not held meanwhile, so that reads of other
+			// resources within this container don't serialize behind this one.
+			reqLen := len(req.Data)
+
 			sz, err = h.fetchFile(process, n, req.Offset, &req.Data)
 			if err != nil {
-				cntr.Unlock()
 				return 0, fuse.IOerror{Code: syscall.EINVAL}
 			}
 
 			if sz == 0 {
-				cntr.Unlock()
 				return 0, nil
 			}
 
 			if !req.NoCache {
+				cntr.Lock()
+
+				// If the resource has been cached in the meantime (i.e., by a
+				// concurrent write), the cached value prevails over the one just
+				// read.
+				cached := make([]byte, reqLen)
+				if csz, _ := cntr.Data(path, req.Offset, &cached); csz > 0 {
+					cntr.Unlock()
+					req.Data = cached
+					return csz, nil
+				}
+
 				err = cntr.SetData(path, req.Offset, req.Data)
 				if err != nil {
 					cntr.Unlock()
 					return 0, fuse.IOerror{Code: syscall.EINVAL}
 				}
+
+				cntr.Unlock()
 			}
 		}
 
-		cntr.Unlock()
-
 	} else {
-		sz, err = h.fetchFile(process, n, req.Offset, &req.Data)
+		sz, err = h.fetchFileCached(process, n, req.Offset, &req.Data)
 		if err != nil {
 			return 0, fuse.IOerror{Code: syscall.EINVAL}
 		}
@@ -244,6 +260,11 @@ func (h *PassThrough) Write(
 		return 0, err
 	}
 
+	// Drop the value cached for the writer's netns (if any).
+	if key, ok := netSysctlCacheKey(process, path); ok {
+		netSysctls.invalidate(key)
+	}
+
 	// If the write comes from a process inside the sys container's namespaces,
 	// (not in inner containers or unshared namespaces) then cache the data.
 	// See explanation in Read() method above.
@@ -307,6 +328,9 @@ func (h *PassThrough) ReadDirAll(
 		osFileEntries = append(osFileEntries, v)
 	}
 
+	// The listed entries are likely to be looked up next.
+	lookupBatches.storeListing(req.Pid, n.Path(), osFileEntries)
+
 	return osFileEntries, nil
 }
 
@@ -458,12 +482,12 @@ func (h *PassThrough) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -471,7 +495,7 @@ func (h *PassThrough) GetResourcesList() []string {
 	return resources
 }
 
-func (h *PassThrough) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *PassThrough) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
@@ -0,0 +1,167 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Cache of the network sysctls (i.e., /proc/sys/net) fetched by the
+// pass-through handler on behalf of processes outside of the sys container's
+// namespaces (e.g., inner containers), which are not served by the container's
+// data cache (see PassThrough.Read()).
+//
+// Values are keyed by the network namespace of the requester, and retained for
+// a short period of time, so that processes polling the same sysctls (e.g.,
+// metrics scrapers) don't trigger an nsenter cycle (fork + setns) per read.
+// Writes invalidate the value of the written sysctl in the writer's netns.
+//
+
+// Time during which the fetched network sysctls are cached.
+const netSysctlCacheTTL = 2 * time.Second
+
+type netSysctlKey struct {
+	netns domain.Inode
+	path  string
+}
+
+type netSysctlEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+type netSysctlCache struct {
+	sync.Mutex
+	entries   map[netSysctlKey]*netSysctlEntry
+	lastSweep time.Time
+}
+
+var netSysctls = &netSysctlCache{
+	entries: make(map[netSysctlKey]*netSysctlEntry),
+}
+
+// Returns the cache key of the given resource as seen by the given process.
+// Returns false if the resource is not cacheable.
+func netSysctlCacheKey(process domain.ProcessIface, path string) (netSysctlKey, bool) {
+
+	if !strings.HasPrefix(path, "/proc/sys/net/") {
+		return netSysctlKey{}, false
+	}
+
+	netns, err := process.NetNsInode()
+	if err != nil || netns == 0 {
+		return netSysctlKey{}, false
+	}
+
+	return netSysctlKey{netns: netns, path: path}, true
+}
+
+// Copies the cached value, starting at the given offset, into data. Returns
+// false if the value is not cached.
+func (c *netSysctlCache) read(key netSysctlKey, offset int64, data *[]byte) (int, bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return 0, false
+	}
+
+	if offset >= int64(len(e.data)) {
+		*data = (*data)[:0]
+		return 0, true
+	}
+
+	n := copy(*data, e.data[offset:])
+	*data = (*data)[:n]
+
+	return n, true
+}
+
+func (c *netSysctlCache) store(key netSysctlKey, data []byte) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+
+	// Expired entries are swept periodically, as the namespaces they refer to
+	// may be long gone.
+	if now.Sub(c.lastSweep) > netSysctlCacheTTL {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.entries[key] = &netSysctlEntry{
+		data:    append([]byte(nil), data...),
+		expires: now.Add(netSysctlCacheTTL),
+	}
+}
+
+func (c *netSysctlCache) invalidate(key netSysctlKey) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.entries, key)
+}
+
+// Fetches the given resource within the namespaces of the given process,
+// serving network sysctls out of the netSysctls cache when possible.
+func (h *PassThrough) fetchFileCached(
+	process domain.ProcessIface,
+	n domain.IOnodeIface,
+	offset int64,
+	data *[]byte) (int, error) {
+
+	key, cacheable := netSysctlCacheKey(process, n.Path())
+	if !cacheable {
+		return h.fetchFile(process, n, offset, data)
+	}
+
+	if sz, ok := netSysctls.read(key, offset, data); ok {
+		return sz, nil
+	}
+
+	reqLen := len(*data)
+
+	sz, err := h.fetchFile(process, n, offset, data)
+	if err != nil {
+		return 0, err
+	}
+
+	// Cache the value only if it has been fully read.
+	if offset == 0 && sz < reqLen {
+		netSysctls.store(key, (*data)[:sz])
+	}
+
+	return sz, nil
+}
@@ -0,0 +1,231 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Batched lookups of the entries of the directories listed by the pass-through
+// handler. Directory listings are usually followed by a lookup of each of the
+// listed entries (e.g., "ls -l", "sysctl -a"), each of which would otherwise
+// take an nsenter cycle (fork + setns). Instead, the first lookup of an entry of
+// a recently listed directory fetches the attributes of all the listed entries
+// in a single nsenter request, which are then kept for a short period of time
+// to serve the subsequent lookups.
+//
+// As the attributes of the entries depend on the namespaces of the requester,
+// both listings and attributes are keyed by the requester's pid.
+//
+
+// Time during which directory listings and the attributes of their entries
+// are retained.
+const lookupBatchTTL = time.Second
+
+// Max number of entries looked up per nsenter request.
+const lookupBatchMax = 512
+
+type lookupBatchKey struct {
+	pid  uint32
+	path string
+}
+
+type lookupBatchListing struct {
+	entries []string
+	expires time.Time
+}
+
+type lookupBatchAttr struct {
+	info    domain.FileInfo
+	expires time.Time
+}
+
+type lookupBatchCache struct {
+	sync.Mutex
+	listings  map[lookupBatchKey]*lookupBatchListing
+	attrs     map[lookupBatchKey]*lookupBatchAttr
+	lastSweep time.Time
+}
+
+var lookupBatches = &lookupBatchCache{
+	listings: make(map[lookupBatchKey]*lookupBatchListing),
+	attrs:    make(map[lookupBatchKey]*lookupBatchAttr),
+}
+
+// Drops the expired listings and attributes. Caller must hold the cache lock.
+func (c *lookupBatchCache) sweep(now time.Time) {
+
+	if now.Sub(c.lastSweep) <= lookupBatchTTL {
+		return
+	}
+
+	for k, l := range c.listings {
+		if now.After(l.expires) {
+			delete(c.listings, k)
+		}
+	}
+	for k, a := range c.attrs {
+		if now.After(a.expires) {
+			delete(c.attrs, k)
+		}
+	}
+	c.lastSweep = now
+}
+
+// Records the listing of the given directory by the given process.
+func (c *lookupBatchCache) storeListing(pid uint32, dir string, entries []os.FileInfo) {
+
+	if len(entries) == 0 || len(entries) > lookupBatchMax {
+		return
+	}
+
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.sweep(now)
+
+	c.listings[lookupBatchKey{pid, dir}] = &lookupBatchListing{
+		entries: paths,
+		expires: now.Add(lookupBatchTTL),
+	}
+}
+
+// Returns the attributes of the given entry, if known.
+func (c *lookupBatchCache) attr(pid uint32, path string) (domain.FileInfo, bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	key := lookupBatchKey{pid, path}
+
+	a, ok := c.attrs[key]
+	if !ok {
+		return domain.FileInfo{}, false
+	}
+	if time.Now().After(a.expires) {
+		delete(c.attrs, key)
+		return domain.FileInfo{}, false
+	}
+
+	return a.info, true
+}
+
+// Returns the entries of the recently listed directory holding the given
+// entry, if any. The listing is consumed, so that its entries are only batched
+// once.
+func (c *lookupBatchCache) takeListing(pid uint32, path string) []string {
+
+	c.Lock()
+	defer c.Unlock()
+
+	key := lookupBatchKey{pid, filepath.Dir(path)}
+
+	l, ok := c.listings[key]
+	if !ok {
+		return nil
+	}
+	delete(c.listings, key)
+
+	if time.Now().After(l.expires) {
+		return nil
+	}
+
+	return l.entries
+}
+
+func (c *lookupBatchCache) storeAttrs(pid uint32, infos map[string]domain.FileInfo) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.sweep(now)
+
+	for path, info := range infos {
+		c.attrs[lookupBatchKey{pid, path}] = &lookupBatchAttr{
+			info:    info,
+			expires: now.Add(lookupBatchTTL),
+		}
+	}
+}
+
+// Serves the lookup of the given node out of the batched lookups, if possible.
+func (h *PassThrough) lookupBatched(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, bool) {
+
+	path := n.Path()
+
+	if info, ok := lookupBatches.attr(req.Pid, path); ok {
+		return info, true
+	}
+
+	entries := lookupBatches.takeListing(req.Pid, path)
+	if entries == nil {
+		return nil, false
+	}
+
+	nss := h.Service.NSenterService()
+	event := nss.NewEvent(
+		req.Pid,
+		&domain.AllNSsButMount,
+		&domain.NSenterMessage{
+			Type: domain.LookupBatchRequest,
+			Payload: &domain.LookupBatchPayload{
+				Entries: entries,
+			},
+		},
+		nil,
+		false,
+	)
+
+	if err := nss.SendRequestEvent(event); err != nil {
+		logrus.Debugf("Batched lookup of %s entries failed: %v", filepath.Dir(path), err)
+		return nil, false
+	}
+
+	responseMsg := nss.ReceiveResponseEvent(event)
+	if responseMsg.Type != domain.LookupBatchResponse {
+		return nil, false
+	}
+
+	infos := responseMsg.Payload.(map[string]domain.FileInfo)
+	lookupBatches.storeAttrs(req.Pid, infos)
+
+	// Entries missing in the response are looked up individually, so that the
+	// proper error is returned.
+	info, ok := infos[path]
+	if !ok {
+		return nil, false
+	}
+
+	return info, true
+}
@@ -0,0 +1,88 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+)
+
+func TestPassThroughLookupBatched(t *testing.T) {
+
+	h := handlertest.New(t)
+
+	const dir = "/var/lib/batched"
+
+	h.WriteCntrFile(dir+"/a", "a\n")
+	h.WriteCntrFile(dir+"/b", "b\n")
+	h.WriteCntrFile(dir+"/c", "c\n")
+
+	c := h.Container("c1", 3001)
+	hdlr := h.Handlers.GetPassThroughHandler()
+
+	// Returns the types of the nsenter requests issued so far.
+	requests := func() []domain.NSenterMsgType {
+		var types []domain.NSenterMsgType
+		for _, r := range h.NSenter.Requests() {
+			types = append(types, r.Type)
+		}
+		h.NSenter.Reset()
+		return types
+	}
+
+	// Lookups of entries of non-listed directories are served individually.
+	if info, err := h.Lookup(hdlr, c, 3001, dir+"/a"); err != nil || info.Name() != "a" {
+		t.Fatalf("Lookup(a) = %v, %v", info, err)
+	}
+	if got := requests(); len(got) != 1 || got[0] != domain.LookupRequest {
+		t.Errorf("Lookup(a) requests = %v, want a single lookup", got)
+	}
+
+	if _, err := h.ReadDirAll(hdlr, c, 3001, dir); err != nil {
+		t.Fatalf("ReadDirAll() failed: %v", err)
+	}
+	requests()
+
+	// The first lookup following the listing fetches all the listed entries,
+	// which serve the subsequent lookups.
+	for _, name := range []string{"b", "a", "c"} {
+		if info, err := h.Lookup(hdlr, c, 3001, dir+"/"+name); err != nil || info.Name() != name {
+			t.Errorf("Lookup(%s) = %v, %v", name, info, err)
+		}
+	}
+	if got := requests(); len(got) != 1 || got[0] != domain.LookupBatchRequest {
+		t.Errorf("lookup requests = %v, want a single batched lookup", got)
+	}
+
+	// Entries not part of the listing (or looked up by other processes) are
+	// looked up individually.
+	h.WriteCntrFile(dir+"/d", "d\n")
+
+	if _, err := h.Lookup(hdlr, c, 3001, dir+"/d"); err != nil {
+		t.Errorf("Lookup(d) failed: %v", err)
+	}
+	h.Process(3002, c, false)
+	if _, err := h.Lookup(hdlr, c, 3002, dir+"/a"); err != nil {
+		t.Errorf("Lookup(a) by another process failed: %v", err)
+	}
+	if got := requests(); len(got) != 2 || got[0] != domain.LookupRequest ||
+		got[1] != domain.LookupRequest {
+		t.Errorf("lookup requests = %v, want two individual lookups", got)
+	}
+}
@@ -60,7 +60,7 @@ func TestMain(m *testing.M) {
 	mts = mount.NewMountService()
 
 	prs.Setup(ios)
-	css.Setup(nil, prs, ios, mts)
+	css.Setup(nil, prs, ios, mts, hds)
 	mts.Setup(css, hds, prs, nss)
 
 	// HandlerService's common mocking instructions.
@@ -105,6 +105,7 @@ func TestPassThrough_Lookup(t *testing.T) {
 				65535,
 				nil,
 				nil,
+				nil,
 				nil),
 		},
 	}
@@ -281,6 +282,7 @@ func TestPassThrough_Open(t *testing.T) {
 				65535,
 				nil,
 				nil,
+				nil,
 				nil),
 		},
 	}
@@ -454,6 +456,7 @@ func TestPassThrough_Read(t *testing.T) {
 				65535,
 				nil,
 				nil,
+				nil,
 				css),
 		},
 	}
@@ -589,6 +592,7 @@ func TestPassThrough_Write(t *testing.T) {
 				65535,
 				nil,
 				nil,
+				nil,
 				css),
 		},
 	}
@@ -775,6 +779,7 @@ func TestPassThrough_ReadDirAll(t *testing.T) {
 				65535,
 				nil,
 				nil,
+				nil,
 				css),
 		},
 	}
@@ -0,0 +1,260 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/cgroups handler
+//
+// Documentation: /proc/cgroups lists the cgroup controllers compiled into the
+// kernel, along with the ID of the (v1) hierarchy each controller is attached
+// to, the number of cgroups in that hierarchy, and whether the controller is
+// enabled.
+//
+// As the kernel doesn't virtualize this file, inner container runtimes probing
+// it within sys containers would find controllers they can't manage, as well
+// as the number of cgroups of the whole host. This handler restricts the
+// output to the controllers delegated to the sys container, and accounts only
+// for the cgroups within the sys container's cgroup:
+//
+//   - cgroup v1: controllers attached to the hierarchies the sys container's
+//     init process is part of, along with these hierarchies' IDs.
+//   - cgroup v2: controllers enabled in the sys container's cgroup (i.e.,
+//     listed in its cgroup.controllers file). Hierarchy IDs are always 0.
+//
+type ProcCgroups struct {
+	domain.HandlerBase
+}
+
+var ProcCgroups_Handler = &ProcCgroups{
+	domain.HandlerBase{
+		Name:    "ProcCgroups",
+		Path:    "/proc/cgroups",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+// Mountpoint of the host's cgroup file-system(s).
+const cgroupRoot = "/sys/fs/cgroup"
+
+// Entry of /proc/cgroups.
+type cgroupSubsys struct {
+	name      string
+	hierarchy int
+	cgroups   int
+	enabled   int
+}
+
+func (h *ProcCgroups) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	// Content is generated in a single read.
+	if req.Offset > 0 {
+		return 0, io.EOF
+	}
+
+	data, err := h.readCgroups(n, req.Container)
+	if err != nil {
+		logrus.Errorf("Unable to generate %s for container %s: %v",
+			n.Path(), req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	req.Data = data
+
+	return len(req.Data), nil
+}
+
+func (h *ProcCgroups) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Generates the contents of /proc/cgroups for the given container.
+func (h *ProcCgroups) readCgroups(
+	n domain.IOnodeIface,
+	cntr domain.ContainerIface) ([]byte, error) {
+
+	ios := h.Service.IOService()
+
+	readFile := func(path string) ([]byte, error) {
+		return ios.NewIOnode(filepath.Base(path), path, 0).ReadFile()
+	}
+
+	// Host's controllers.
+	data, err := readFile(n.Path())
+	if err != nil {
+		return nil, err
+	}
+	subsystems := parseProcCgroups(data)
+
+	// Cgroups of the container's init process.
+	prs := h.Service.ProcessService()
+	cgroups, err := prs.ProcessCreate(cntr.InitPid(), 0, 0).Cgroups()
+	if err != nil {
+		return nil, err
+	}
+
+	// Number of cgroups (i.e., dirs) at and below the given one.
+	var countCgroups func(dir string) int
+	countCgroups = func(dir string) int {
+		count := 1
+		entries, err := ios.NewIOnode(filepath.Base(dir), dir, 0).ReadDirAll()
+		if err != nil {
+			return count
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				count += countCgroups(filepath.Join(dir, e.Name()))
+			}
+		}
+		return count
+	}
+
+	var res []cgroupSubsys
+
+	if domain.CgroupV2Only(cgroups) {
+
+		// cgroup v2-only host (unified hierarchy).
+		dir := filepath.Join(cgroupRoot, cgroups[0].Path)
+
+		data, err := readFile(filepath.Join(dir, "cgroup.controllers"))
+		if err != nil {
+			return nil, err
+		}
+
+		delegated := make(map[string]bool)
+		for _, c := range strings.Fields(string(data)) {
+			delegated[c] = true
+		}
+
+		count := countCgroups(dir)
+
+		for _, s := range subsystems {
+			if !delegated[s.name] {
+				continue
+			}
+			s.hierarchy = 0
+			s.cgroups = count
+			res = append(res, s)
+		}
+
+	} else {
+
+		// cgroup v1 (or hybrid host, where controllers are bound to the v1
+		// hierarchies).
+		for _, s := range subsystems {
+			for _, m := range cgroups {
+				if !containsController(m.Controllers, s.name) {
+					continue
+				}
+				s.hierarchy = m.Hierarchy
+				s.cgroups = countCgroups(filepath.Join(cgroupRoot, m.Controllers, m.Path))
+				res = append(res, s)
+				break
+			}
+		}
+	}
+
+	return formatProcCgroups(res), nil
+}
+
+// Parses the contents of /proc/cgroups.
+func parseProcCgroups(data []byte) []cgroupSubsys {
+
+	var res []cgroupSubsys
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+
+		var vals [3]int
+		var err error
+		for i := range vals {
+			if vals[i], err = strconv.Atoi(fields[i+1]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+
+		res = append(res, cgroupSubsys{
+			name:      fields[0],
+			hierarchy: vals[0],
+			cgroups:   vals[1],
+			enabled:   vals[2],
+		})
+	}
+
+	return res
+}
+
+func containsController(ctrls, name string) bool {
+	for _, c := range strings.Split(ctrls, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func formatProcCgroups(subsystems []cgroupSubsys) []byte {
+
+	var b bytes.Buffer
+
+	b.WriteString("#subsys_name\thierarchy\tnum_cgroups\tenabled\n")
+	for _, s := range subsystems {
+		fmt.Fprintf(&b, "%s\t%d\t%d\t%d\n", s.name, s.hierarchy, s.cgroups, s.enabled)
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,84 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcCgroups(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcCgroups_Handler)
+	hdlr := h.Handler("/proc/cgroups")
+
+	// cgroup v2: only the controllers enabled in the container's cgroup are
+	// listed.
+	h.WriteHostFile("/proc/cgroups",
+		"#subsys_name\thierarchy\tnum_cgroups\tenabled\n"+
+			"cpuset\t0\t50\t1\n"+
+			"cpu\t0\t50\t1\n"+
+			"memory\t0\t50\t1\n"+
+			"pids\t0\t50\t1\n")
+
+	c1 := h.Container("c1", 1001)
+	h.WriteHostFile("/proc/1001/cgroup", "0::/sysbox/c1\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/cgroup.controllers", "cpu memory\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/init.scope/cgroup.procs", "1\n")
+
+	want := "#subsys_name\thierarchy\tnum_cgroups\tenabled\n" +
+		"cpu\t0\t2\t1\n" +
+		"memory\t0\t2\t1\n"
+
+	if data, err := h.Read(hdlr, c1, 1001, "/proc/cgroups"); err != nil || data != want {
+		t.Errorf("v2: Read() = %q, %v; want %q", data, err, want)
+	}
+
+	// cgroup v1: only the controllers of the hierarchies the container is part
+	// of are listed, along with their hierarchy IDs.
+	h.WriteHostFile("/proc/cgroups",
+		"#subsys_name\thierarchy\tnum_cgroups\tenabled\n"+
+			"cpu\t5\t80\t1\n"+
+			"cpuacct\t5\t80\t1\n"+
+			"memory\t4\t80\t1\n"+
+			"hugetlb\t3\t1\t1\n")
+
+	c2 := h.Container("c2", 2001)
+	h.WriteHostFile("/proc/2001/cgroup",
+		"5:cpu,cpuacct:/sysbox/c2\n"+
+			"4:memory:/sysbox/c2\n"+
+			"1:name=systemd:/sysbox/c2\n")
+	h.WriteHostFile("/sys/fs/cgroup/cpu,cpuacct/sysbox/c2/tasks", "1\n")
+	h.WriteHostFile("/sys/fs/cgroup/memory/sysbox/c2/tasks", "1\n")
+	h.WriteHostFile("/sys/fs/cgroup/memory/sysbox/c2/inner/tasks", "2\n")
+
+	want = "#subsys_name\thierarchy\tnum_cgroups\tenabled\n" +
+		"cpu\t5\t1\t1\n" +
+		"cpuacct\t5\t1\t1\n" +
+		"memory\t4\t2\t1\n"
+
+	if data, err := h.Read(hdlr, c2, 2001, "/proc/cgroups"); err != nil || data != want {
+		t.Errorf("v1: Read() = %q, %v; want %q", data, err, want)
+	}
+
+	// Writes are rejected.
+	if _, err := h.Write(hdlr, c1, 1001, "/proc/cgroups", "x"); err == nil {
+		t.Errorf("Write() unexpectedly succeeded")
+	}
+}
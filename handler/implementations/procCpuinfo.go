@@ -0,0 +1,89 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/cpuinfo handler
+//
+// Documentation: /proc/cpuinfo describes each of the system's CPUs, in an
+// architecture-specific layout.
+//
+// This handler restricts the per-CPU entries to the CPUs in the sys container's
+// cpuset, consistently with /sys/devices/system/cpu, so that tools sizing
+// themselves out of this file (e.g., nproc fallbacks, build systems, the JVM)
+// find as many CPUs as the sys container can run on. Entries are formatted as
+// per the host's architecture (see cpuArch).
+//
+type ProcCpuinfo struct {
+	domain.HandlerBase
+}
+
+var ProcCpuinfo_Handler = &ProcCpuinfo{
+	domain.HandlerBase{
+		Name:    "ProcCpuinfo",
+		Path:    "/proc/cpuinfo",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+func (h *ProcCpuinfo) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	cpus, err := cntrCpus(h, req.Container)
+	if err != nil {
+		logrus.Errorf("Unable to obtain the cpus of container %s: %v",
+			req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(hostCpuArch(h).filterCpuinfo(data, cpus), req)
+}
+
+func (h *ProcCpuinfo) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
@@ -0,0 +1,89 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcCpuinfo(t *testing.T) {
+
+	var tests = []struct {
+		arch    string
+		cpuinfo string
+		want    string
+	}{
+		{
+			"x86_64",
+			"processor\t: 0\nvendor_id\t: GenuineIntel\ncpu MHz\t\t: 2400.000\nflags\t\t: fpu vme\n\n" +
+				"processor\t: 1\nvendor_id\t: GenuineIntel\ncpu MHz\t\t: 2400.000\nflags\t\t: fpu vme\n\n" +
+				"processor\t: 2\nvendor_id\t: GenuineIntel\ncpu MHz\t\t: 2400.000\nflags\t\t: fpu vme\n\n",
+			"processor\t: 0\nvendor_id\t: GenuineIntel\ncpu MHz\t\t: 2400.000\nflags\t\t: fpu vme\n\n" +
+				"processor\t: 2\nvendor_id\t: GenuineIntel\ncpu MHz\t\t: 2400.000\nflags\t\t: fpu vme\n\n",
+		},
+		{
+			"aarch64",
+			"processor\t: 0\nBogoMIPS\t: 50.00\nFeatures\t: fp asimd evtstrm\nCPU implementer\t: 0x41\n\n" +
+				"processor\t: 1\nBogoMIPS\t: 50.00\nFeatures\t: fp asimd evtstrm\nCPU implementer\t: 0x41\n\n" +
+				"processor\t: 2\nBogoMIPS\t: 50.00\nFeatures\t: fp asimd evtstrm\nCPU implementer\t: 0x41\n\n",
+			"processor\t: 0\nBogoMIPS\t: 50.00\nFeatures\t: fp asimd evtstrm\nCPU implementer\t: 0x41\n\n" +
+				"processor\t: 2\nBogoMIPS\t: 50.00\nFeatures\t: fp asimd evtstrm\nCPU implementer\t: 0x41\n\n",
+		},
+		{
+			"ppc64le",
+			"processor\t: 0\ncpu\t\t: POWER9, altivec supported\nclock\t\t: 2166.000000MHz\n\n" +
+				"processor\t: 1\ncpu\t\t: POWER9, altivec supported\nclock\t\t: 2166.000000MHz\n\n" +
+				"processor\t: 2\ncpu\t\t: POWER9, altivec supported\nclock\t\t: 2166.000000MHz\n\n" +
+				"timebase\t: 512000000\nplatform\t: PowerNV\n",
+			"processor\t: 0\ncpu\t\t: POWER9, altivec supported\nclock\t\t: 2166.000000MHz\n\n" +
+				"processor\t: 2\ncpu\t\t: POWER9, altivec supported\nclock\t\t: 2166.000000MHz\n\n" +
+				"timebase\t: 512000000\nplatform\t: PowerNV\n",
+		},
+		{
+			"s390x",
+			"vendor_id       : IBM/S390\n# processors    : 3\nbogomips per cpu: 3241.00\n" +
+				"processor 0: version = FF,  identification = 0133E8,  machine = 3906\n" +
+				"processor 1: version = FF,  identification = 0133E8,  machine = 3906\n" +
+				"processor 2: version = FF,  identification = 0133E8,  machine = 3906\n\n" +
+				"cpu number      : 0\ncpu MHz dynamic : 5208\n\n" +
+				"cpu number      : 1\ncpu MHz dynamic : 5208\n\n" +
+				"cpu number      : 2\ncpu MHz dynamic : 5208\n\n",
+			"vendor_id       : IBM/S390\n# processors    : 2\nbogomips per cpu: 3241.00\n" +
+				"processor 0: version = FF,  identification = 0133E8,  machine = 3906\n" +
+				"processor 2: version = FF,  identification = 0133E8,  machine = 3906\n\n" +
+				"cpu number      : 0\ncpu MHz dynamic : 5208\n\n" +
+				"cpu number      : 2\ncpu MHz dynamic : 5208\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		h := handlertest.New(t, implementations.ProcCpuinfo_Handler)
+		hdlr := h.Handler("/proc/cpuinfo")
+		c := h.Container("c1", 1001)
+
+		h.WriteHostFile("/proc/1001/status", "Name:\tinit\nCpus_allowed_list:\t0,2\n")
+		h.WriteHostFile("/proc/sys/kernel/arch", tt.arch+"\n")
+		h.WriteHostFile("/proc/cpuinfo", tt.cpuinfo)
+
+		if data, err := h.Read(hdlr, c, 1001, "/proc/cpuinfo"); err != nil || data != tt.want {
+			t.Errorf("%s: Read() = %q, %v; want %q", tt.arch, data, err, tt.want)
+		}
+	}
+}
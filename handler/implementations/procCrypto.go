@@ -0,0 +1,171 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/crypto handler
+//
+// Documentation: /proc/crypto lists the crypto algorithms registered in the
+// kernel, one block of "<attribute> : <value>" lines per algorithm.
+//
+// The host's listing is exposed as is, unless the sys container runs in FIPS
+// mode (see /proc/sys/crypto/fips_enabled) while the host doesn't, in which
+// case the algorithms not permitted in FIPS mode (i.e., flagged with "fips :
+// no") are left out.
+//
+type ProcCrypto struct {
+	domain.HandlerBase
+}
+
+var ProcCrypto_Handler = &ProcCrypto{
+	domain.HandlerBase{
+		Name:    "ProcCrypto",
+		Path:    "/proc/crypto",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+const fipsEnabledPath = "/proc/sys/crypto/fips_enabled"
+
+func (h *ProcCrypto) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	if h.cntrFipsEnabled(req.Container) && !h.hostFipsEnabled() {
+		data = filterFipsAlgorithms(data)
+	}
+
+	return readFromData(data, req)
+}
+
+func (h *ProcCrypto) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Returns true if the given container runs in FIPS mode, as per its emulated
+// fips_enabled sysctl (if defined).
+func (h *ProcCrypto) cntrFipsEnabled(cntr domain.ContainerIface) bool {
+
+	data := make([]byte, 32)
+	sz, _ := cntr.Data(fipsEnabledPath, 0, &data)
+	if sz == 0 {
+		return h.hostFipsEnabled()
+	}
+
+	return strings.TrimSpace(string(data[:sz])) == "1"
+}
+
+// Returns true if the host runs in FIPS mode.
+func (h *ProcCrypto) hostFipsEnabled() bool {
+
+	n := h.Service.IOService().NewIOnode(
+		filepath.Base(fipsEnabledPath), fipsEnabledPath, 0)
+
+	data, err := n.ReadFile()
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(data)) == "1"
+}
+
+// Filters the contents of /proc/crypto, leaving out the algorithms that are
+// not permitted in FIPS mode.
+func filterFipsAlgorithms(data []byte) []byte {
+
+	var buf bytes.Buffer
+
+	// Blocks are separated by empty lines.
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Split(scanCryptoBlocks)
+
+	for scanner.Scan() {
+		block := scanner.Text()
+		if block == "" {
+			continue
+		}
+
+		fipsAllowed := true
+		for _, line := range strings.Split(block, "\n") {
+			kv := strings.SplitN(line, ":", 2)
+			if len(kv) == 2 &&
+				strings.TrimSpace(kv[0]) == "fips" &&
+				strings.TrimSpace(kv[1]) == "no" {
+				fipsAllowed = false
+				break
+			}
+		}
+
+		if fipsAllowed {
+			buf.WriteString(block + "\n\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// bufio.SplitFunc splitting /proc/crypto into per-algorithm blocks.
+func scanCryptoBlocks(data []byte, atEOF bool) (int, []byte, error) {
+
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		return i + 2, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), bytes.TrimRight(data, "\n"), nil
+	}
+
+	return 0, nil, nil
+}
@@ -0,0 +1,82 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcCrypto(t *testing.T) {
+
+	h := handlertest.New(t,
+		implementations.ProcCrypto_Handler,
+		implementations.ProcSysCrypto_Handler)
+
+	crypto := h.Handler("/proc/crypto")
+	fips := h.Handler("/proc/sys/crypto/fips_enabled")
+
+	h.WriteHostFile("/proc/sys/crypto/fips_enabled", "0\n")
+	h.WriteHostFile("/proc/crypto",
+		"name         : sha256\n"+
+			"driver       : sha256-generic\n"+
+			"selftest     : passed\n"+
+			"\n"+
+			"name         : md4\n"+
+			"driver       : md4-generic\n"+
+			"fips         : no\n"+
+			"selftest     : passed\n"+
+			"\n")
+
+	// Non-FIPS container: host's listing.
+	c1 := h.Container("c1", 1001)
+
+	want := h.HostFile("/proc/crypto")
+	if data, err := h.Read(crypto, c1, 1001, "/proc/crypto"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+
+	if data, err := h.Read(fips, c1, 1001, "/proc/sys/crypto/fips_enabled"); err != nil || data != "0\n" {
+		t.Errorf("fips_enabled: Read() = %q, %v; want \"0\\n\"", data, err)
+	}
+
+	// FIPS mode is read-only within containers.
+	if _, err := h.Write(fips, c1, 1001, "/proc/sys/crypto/fips_enabled", "1"); err == nil {
+		t.Errorf("fips_enabled: Write() unexpectedly succeeded")
+	}
+
+	// FIPS-spoofing container (i.e., as set through the sysctl annotation):
+	// algorithms not permitted in FIPS mode are left out.
+	c2 := h.Container("c2", 2001)
+	if err := c2.SetData("/proc/sys/crypto/fips_enabled", 0, []byte("1\n")); err != nil {
+		t.Fatalf("SetData() failed: %v", err)
+	}
+
+	if data, err := h.Read(fips, c2, 2001, "/proc/sys/crypto/fips_enabled"); err != nil || data != "1\n" {
+		t.Errorf("fips_enabled: Read() = %q, %v; want \"1\\n\"", data, err)
+	}
+
+	want = "name         : sha256\n" +
+		"driver       : sha256-generic\n" +
+		"selftest     : passed\n" +
+		"\n"
+	if data, err := h.Read(crypto, c2, 2001, "/proc/crypto"); err != nil || data != want {
+		t.Errorf("fips: Read() = %q, %v; want %q", data, err, want)
+	}
+}
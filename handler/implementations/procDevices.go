@@ -0,0 +1,203 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/devices handler
+//
+// Documentation: /proc/devices lists the character and block device classes
+// (i.e., major numbers) registered in the kernel.
+//
+// As the kernel doesn't virtualize this file, sys containers would see all the
+// device classes of the host, despite only a small (sanitized) subset of the
+// host's devices being exposed in their /dev. This handler trims the output to
+// the device classes for which a device node exists within the sys container's
+// /dev hierarchy.
+//
+type ProcDevices struct {
+	domain.HandlerBase
+}
+
+var ProcDevices_Handler = &ProcDevices{
+	domain.HandlerBase{
+		Name:    "ProcDevices",
+		Path:    "/proc/devices",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+// Section headers of /proc/devices.
+const (
+	charDevicesHeader  = "Character devices:"
+	blockDevicesHeader = "Block devices:"
+)
+
+func (h *ProcDevices) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	// Content is generated in a single read.
+	if req.Offset > 0 {
+		return 0, io.EOF
+	}
+
+	data, err := h.readDevices(n, req.Container)
+	if err != nil {
+		logrus.Errorf("Unable to generate %s for container %s: %v",
+			n.Path(), req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	req.Data = data
+
+	return len(req.Data), nil
+}
+
+func (h *ProcDevices) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Generates the contents of /proc/devices for the given container.
+func (h *ProcDevices) readDevices(
+	n domain.IOnodeIface,
+	cntr domain.ContainerIface) ([]byte, error) {
+
+	ios := h.Service.IOService()
+
+	data, err := ios.NewIOnode(n.Name(), n.Path(), 0).ReadFile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Device classes exposed within the container, as seen through the
+	// container's init process root.
+	devDir := fmt.Sprintf("/proc/%d/root/dev", cntr.InitPid())
+	charMajors := make(map[uint32]bool)
+	blockMajors := make(map[uint32]bool)
+
+	var walk func(dir string)
+	walk = func(dir string) {
+		entries, err := ios.NewIOnode(filepath.Base(dir), dir, 0).ReadDirAll()
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			mode := e.Mode()
+
+			if mode.IsDir() {
+				walk(filepath.Join(dir, e.Name()))
+				continue
+			}
+			if mode&os.ModeDevice == 0 {
+				continue
+			}
+
+			st, ok := e.Sys().(*syscall.Stat_t)
+			if !ok || st == nil {
+				continue
+			}
+			major := unix.Major(uint64(st.Rdev))
+
+			if mode&os.ModeCharDevice != 0 {
+				charMajors[major] = true
+			} else {
+				blockMajors[major] = true
+			}
+		}
+	}
+	walk(devDir)
+
+	return filterProcDevices(data, charMajors, blockMajors), nil
+}
+
+// Filters the contents of /proc/devices, keeping only the entries whose major
+// number is present in the given char / block sets. Section headers are
+// always preserved.
+func filterProcDevices(
+	data []byte,
+	charMajors, blockMajors map[uint32]bool) []byte {
+
+	var (
+		buf     bytes.Buffer
+		majors  map[uint32]bool
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+	)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch line {
+		case charDevicesHeader:
+			majors = charMajors
+			buf.WriteString(line + "\n")
+			continue
+		case blockDevicesHeader:
+			majors = blockMajors
+			buf.WriteString(line + "\n")
+			continue
+		case "":
+			buf.WriteString("\n")
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || majors == nil {
+			continue
+		}
+
+		major, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil || !majors[uint32(major)] {
+			continue
+		}
+
+		buf.WriteString(line + "\n")
+	}
+
+	return buf.Bytes()
+}
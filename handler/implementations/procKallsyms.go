@@ -0,0 +1,121 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/kallsyms handler
+//
+// Documentation: /proc/kallsyms lists the kernel's symbols ("<address> <type>
+// <name> [module]"), which reveals the layout of the host's kernel (i.e., KASLR
+// offset) to anyone with access to the symbols' addresses.
+//
+// This handler exposes the host's symbols with all their addresses zeroed, as
+// the kernel itself does for unprivileged readers, so that tools that merely
+// check for the presence of a given symbol keep working within sys containers.
+//
+type ProcKallsyms struct {
+	domain.HandlerBase
+}
+
+var ProcKallsyms_Handler = &ProcKallsyms{
+	domain.HandlerBase{
+		Name:    "ProcKallsyms",
+		Path:    "/proc/kallsyms",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+// As addresses are replaced in place, the file is served in chunks straight
+// out of the host's one. Chunks are read along with the bytes preceding them
+// (up to this size), which is enough to tell whether a chunk starts within an
+// address field (at most 16 hex digits long).
+const kallsymsLookback = 32
+
+func (h *ProcKallsyms) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	lookback := req.Offset
+	if lookback > kallsymsLookback {
+		lookback = kallsymsLookback
+	}
+
+	data := make([]byte, int64(len(req.Data))+lookback)
+
+	sz, err := readHostFs(h, n, req.Offset-lookback, &data)
+	if err != nil && err != io.EOF {
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	if int64(sz) <= lookback {
+		return 0, io.EOF
+	}
+
+	zeroKallsymsAddrs(data[:sz], req.Offset == lookback)
+
+	req.Data = data[lookback:sz]
+
+	return len(req.Data), nil
+}
+
+func (h *ProcKallsyms) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Zeroes the addresses (i.e., leading field of each line) within the given
+// chunk of /proc/kallsyms. Argument 'lineStart' indicates whether the chunk
+// starts at the beginning of a line.
+func zeroKallsymsAddrs(data []byte, lineStart bool) {
+
+	inAddr := lineStart
+
+	for i, c := range data {
+		switch {
+		case c == '\n':
+			inAddr = true
+		case c == ' ':
+			inAddr = false
+		case inAddr:
+			data[i] = '0'
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcKallsyms(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcKallsyms_Handler)
+	hdlr := h.Handler("/proc/kallsyms")
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/kallsyms",
+		"ffffffffa1000000 T startup_64\n"+
+			"ffffffffa1000030 T secondary_startup_64\n"+
+			"ffffffffc0a1b2c0 t ovl_fill_super\t[overlay]\n")
+
+	want := "0000000000000000 T startup_64\n" +
+		"0000000000000000 T secondary_startup_64\n" +
+		"0000000000000000 t ovl_fill_super\t[overlay]\n"
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/kallsyms"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+
+	// Chunked reads, starting in the middle of address fields and symbol
+	// names, must add up to the same contents.
+	for _, chunk := range []int{1, 5, 17, 40} {
+		var got string
+
+		for off := 0; ; off += chunk {
+			req := h.Request(c, 1001)
+			req.Offset = int64(off)
+			req.Data = make([]byte, chunk)
+
+			n, err := hdlr.Read(h.Node("/proc/kallsyms"), req)
+			if n == 0 || err != nil {
+				break
+			}
+			got += string(req.Data[:n])
+		}
+
+		if got != want {
+			t.Errorf("chunk %d: Read() = %q; want %q", chunk, got, want)
+		}
+	}
+
+	// Writes are rejected.
+	if _, err := h.Write(hdlr, c, 1001, "/proc/kallsyms", "x"); err == nil {
+		t.Errorf("Write() unexpectedly succeeded")
+	}
+}
@@ -0,0 +1,109 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/key-users handler
+//
+// Documentation: /proc/key-users lists, for each user with keys, the number of
+// keys it owns and its keys quotas ("<uid>: <usage> <nkeys>/<nikeys>
+// <qnkeys>/<maxkeys> <qnbytes>/<maxbytes>").
+//
+// As with /proc/keys, the listing is restricted to the users of the sys
+// container's user-namespace, displayed with their uids as seen within the sys
+// container.
+//
+type ProcKeyUsers struct {
+	domain.HandlerBase
+}
+
+var ProcKeyUsers_Handler = &ProcKeyUsers{
+	domain.HandlerBase{
+		Name:    "ProcKeyUsers",
+		Path:    "/proc/key-users",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+func (h *ProcKeyUsers) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(filterProcKeyUsers(data, req.Container), req)
+}
+
+func (h *ProcKeyUsers) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Filters the host's /proc/key-users contents, keeping the given container's
+// users.
+func filterProcKeyUsers(data []byte, cntr domain.ContainerIface) []byte {
+
+	var buf bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		uid, ok := cntrUid(strings.TrimSpace(fields[0]), cntr)
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "%5d:%s\n", uid, fields[1])
+	}
+
+	return buf.Bytes()
+}
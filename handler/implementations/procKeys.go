@@ -0,0 +1,146 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/keys handler
+//
+// Documentation: /proc/keys lists the keys (i.e., kernel keyring entries)
+// viewable by the reader, along with their owner's uid & gid ("<id> <flags>
+// <usage> <timeout> <perm> <uid> <gid> <type> <description>").
+//
+// This handler restricts the listing to the keys owned by the users of the sys
+// container's user-namespace, and presents their uid & gid as seen within the
+// sys container. Keys of other users (e.g., the host's ones) are left out, and
+// gids not mapped into the sys container are displayed as the overflow gid.
+//
+type ProcKeys struct {
+	domain.HandlerBase
+}
+
+var ProcKeys_Handler = &ProcKeys{
+	domain.HandlerBase{
+		Name:    "ProcKeys",
+		Path:    "/proc/keys",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+// Id displayed for the uids / gids not mapped into the user-namespace.
+const overflowID = 65534
+
+// Leading fields, uid, gid, and trailing fields of /proc/keys entries.
+var procKeysRegexp = regexp.MustCompile(`^(\S+ \S+\s+\S+\s+\S+ \S+)\s+(\d+)\s+(\d+) (.*)$`)
+
+func (h *ProcKeys) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(filterProcKeys(data, req.Container), req)
+}
+
+func (h *ProcKeys) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Filters the host's /proc/keys contents, keeping the keys owned by the given
+// container's users.
+func filterProcKeys(data []byte, cntr domain.ContainerIface) []byte {
+
+	var buf bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		m := procKeysRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+
+		uid, ok := cntrUid(m[2], cntr)
+		if !ok {
+			continue
+		}
+		gid, ok := cntrGid(m[3], cntr)
+		if !ok {
+			gid = overflowID
+		}
+
+		fmt.Fprintf(&buf, "%s %5d %5d %s\n", m[1], uid, gid, m[4])
+	}
+
+	return buf.Bytes()
+}
+
+// Translates the given host uid into the given container's user-namespace;
+// returns false if the uid is not mapped into it.
+func cntrUid(s string, cntr domain.ContainerIface) (uint32, bool) {
+	return cntrID(s, cntr.UID(), cntr.UidSize())
+}
+
+// Same as above, for gids.
+func cntrGid(s string, cntr domain.ContainerIface) (uint32, bool) {
+	return cntrID(s, cntr.GID(), cntr.GidSize())
+}
+
+func cntrID(s string, first, size uint32) (uint32, bool) {
+
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	if uint32(id) < first || uint32(id)-first >= size {
+		return 0, false
+	}
+
+	return uint32(id) - first, true
+}
@@ -0,0 +1,63 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcKeys(t *testing.T) {
+
+	h := handlertest.New(t,
+		implementations.ProcKeys_Handler,
+		implementations.ProcKeyUsers_Handler)
+
+	keys := h.Handler("/proc/keys")
+	keyUsers := h.Handler("/proc/key-users")
+
+	// Container's uids & gids: [231072, 231072+65535).
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/keys",
+		"0a8c2d1e I--Q---     1 perm 3f030000     0     0 keyring   _ses: 1\n"+
+			"1b2e3f40 I--Q---     2 perm 3f030000 231072 231072 keyring   _ses: 1\n"+
+			"2c3d4e5f I--Q---     1 perm 1f3f0000 232072   100 user      my key: 12\n"+
+			"3d4e5f60 I--Q---     1 perm 3f010000  1000  1000 keyring   _uid.1000: empty\n")
+
+	want := "1b2e3f40 I--Q---     2 perm 3f030000     0     0 keyring   _ses: 1\n" +
+		"2c3d4e5f I--Q---     1 perm 1f3f0000  1000 65534 user      my key: 12\n"
+
+	if data, err := h.Read(keys, c, 1001, "/proc/keys"); err != nil || data != want {
+		t.Errorf("keys: Read() = %q, %v; want %q", data, err, want)
+	}
+
+	h.WriteHostFile("/proc/key-users",
+		"    0:    10 9/9 6/1000000 123/25000000\n"+
+			"231072:     2 2/2 2/200 31/20000\n"+
+			"232072:     1 1/1 1/200 12/20000\n"+
+			" 1000:     3 3/3 3/200 40/20000\n")
+
+	want = "    0:     2 2/2 2/200 31/20000\n" +
+		" 1000:     1 1/1 1/200 12/20000\n"
+
+	if data, err := h.Read(keyUsers, c, 1001, "/proc/key-users"); err != nil || data != want {
+		t.Errorf("key-users: Read() = %q, %v; want %q", data, err, want)
+	}
+}
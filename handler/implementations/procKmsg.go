@@ -0,0 +1,358 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/kmsg and /dev/kmsg handlers
+//
+// Documentation: both files expose the kernel's message buffer (i.e., what
+// dmesg displays): /proc/kmsg in syslog format ("<prio>[timestamp] msg"), and
+// /dev/kmsg as a sequence of records ("prio,seq,usec,flags;msg"). Messages can
+// also be logged by writing them into /dev/kmsg.
+//
+// As access to the kernel's buffer is not permitted within sys containers,
+// tools such as systemd-journald and dmesg fail with EPERM. These handlers
+// provide each sys container with its own message buffer, fed by the source
+// defined during sysbox-fs initialization:
+//
+//   - empty: no kernel messages.
+//   - synthetic: messages describing the sys container's lifecycle.
+//   - host: the host's kernel messages logged since the sys container's
+//     creation.
+//
+// Messages written into /dev/kmsg within the sys container are added to its
+// buffer regardless of the source. Timestamps are relative to the sys
+// container's creation, consistently with the emulated /proc/uptime.
+//
+type ProcKmsg struct {
+	domain.HandlerBase
+	devFormat bool // /dev/kmsg record format
+}
+
+var ProcKmsg_Handler = &ProcKmsg{
+	HandlerBase: domain.HandlerBase{
+		Name:    "ProcKmsg",
+		Path:    "/proc/kmsg",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0400)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+var DevKmsg_Handler = &ProcKmsg{
+	HandlerBase: domain.HandlerBase{
+		Name:    "DevKmsg",
+		Path:    "/dev/kmsg",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+			},
+		},
+	},
+	devFormat: true,
+}
+
+// Sources of the sys containers' kernel messages.
+const (
+	KmsgSourceEmpty     = "empty"
+	KmsgSourceSynthetic = "synthetic"
+	KmsgSourceHost      = "host"
+)
+
+var kmsgSource int32
+
+var kmsgSources = []string{
+	KmsgSourceEmpty,
+	KmsgSourceSynthetic,
+	KmsgSourceHost,
+}
+
+// SetKmsgSource sets the source of the sys containers' kernel messages.
+func SetKmsgSource(source string) error {
+
+	if source == "" {
+		source = KmsgSourceEmpty
+	}
+
+	for i, s := range kmsgSources {
+		if s == source {
+			atomic.StoreInt32(&kmsgSource, int32(i))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("kmsg source '%v' not recognized", source)
+}
+
+func getKmsgSource() string {
+	return kmsgSources[atomic.LoadInt32(&kmsgSource)]
+}
+
+// Container's data-store entry holding the messages written into /dev/kmsg
+// (one "prio,usec;msg" line per message), and its max size.
+const (
+	kmsgDataKey   = "/dev/kmsg"
+	kmsgDataLimit = 64 * 1024
+)
+
+// Default priority of the messages written with no "<prio>" prefix (i.e.,
+// LOG_USER facility, LOG_WARNING level).
+const kmsgDefaultPrio = 1<<3 | 4
+
+type kmsgRecord struct {
+	prio int
+	ts   time.Duration
+	msg  string
+}
+
+func (h *ProcKmsg) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	return readFromData(h.formatRecords(h.records(req.Container)), req)
+}
+
+func (h *ProcKmsg) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if !h.devFormat {
+		return 0, fuse.IOerror{Code: syscall.EPERM}
+	}
+
+	cntr := req.Container
+	rec := parseKmsgWrite(string(req.Data))
+	rec.ts = time.Since(cntr.Ctime())
+
+	line := fmt.Sprintf("%d,%d;%s\n", rec.prio, rec.ts/time.Microsecond, rec.msg)
+
+	cntr.Lock()
+	defer cntr.Unlock()
+
+	curr := make([]byte, kmsgDataLimit)
+	sz, err := cntr.Data(kmsgDataKey, 0, &curr)
+	if err != nil && err != io.EOF {
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	// Oldest messages are dropped when the buffer is full.
+	data := append(append([]byte{}, curr[:sz]...), line...)
+	for len(data) > kmsgDataLimit {
+		i := bytes.IndexByte(data, '\n')
+		data = data[i+1:]
+	}
+
+	if err := cntr.SetData(kmsgDataKey, 0, data); err != nil {
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return len(req.Data), nil
+}
+
+func (h *ProcKmsg) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Collects the messages of the given container, sorted by timestamp.
+func (h *ProcKmsg) records(cntr domain.ContainerIface) []kmsgRecord {
+
+	var records []kmsgRecord
+
+	switch getKmsgSource() {
+	case KmsgSourceSynthetic:
+		records = append(records, kmsgRecord{
+			prio: 6,
+			msg:  fmt.Sprintf("sysbox-fs: sys container %s started", cntr.ID()),
+		})
+
+	case KmsgSourceHost:
+		hostRecords, err := hostKmsgRecords(time.Since(cntr.Ctime()))
+		if err != nil {
+			logrus.Warnf("Unable to read the host's kernel messages: %v", err)
+		}
+		records = append(records, hostRecords...)
+	}
+
+	cntr.Lock()
+	data := make([]byte, kmsgDataLimit)
+	sz, _ := cntr.Data(kmsgDataKey, 0, &data)
+	data = append([]byte{}, data[:sz]...)
+	cntr.Unlock()
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var rec kmsgRecord
+		var usec int64
+
+		fields := strings.SplitN(scanner.Text(), ";", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if _, err := fmt.Sscanf(fields[0], "%d,%d", &rec.prio, &usec); err != nil {
+			continue
+		}
+		rec.ts = time.Duration(usec) * time.Microsecond
+		rec.msg = fields[1]
+
+		records = append(records, rec)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ts < records[j].ts
+	})
+
+	return records
+}
+
+// Formats the given messages as per the handler's file format.
+func (h *ProcKmsg) formatRecords(records []kmsgRecord) []byte {
+
+	var buf bytes.Buffer
+
+	for seq, rec := range records {
+		usec := int64(rec.ts / time.Microsecond)
+
+		if h.devFormat {
+			fmt.Fprintf(&buf, "%d,%d,%d,-;%s\n", rec.prio, seq, usec, rec.msg)
+		} else {
+			fmt.Fprintf(&buf, "<%d>[%5d.%06d] %s\n",
+				rec.prio, usec/1000000, usec%1000000, rec.msg)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// Parses a message written into /dev/kmsg, optionally prefixed by its priority
+// (e.g., "<6>msg").
+func parseKmsgWrite(data string) kmsgRecord {
+
+	rec := kmsgRecord{prio: kmsgDefaultPrio}
+	data = strings.TrimRight(data, "\n")
+
+	if strings.HasPrefix(data, "<") {
+		if i := strings.IndexByte(data, '>'); i > 0 {
+			if prio, err := strconv.Atoi(data[1:i]); err == nil && prio >= 0 {
+				rec.prio = prio
+				data = data[i+1:]
+			}
+		}
+	}
+
+	rec.msg = data
+
+	return rec
+}
+
+// Host's kernel message in syslog format (e.g., "<6>[   12.345678] msg").
+var kmsgLineRegexp = regexp.MustCompile(`^<(\d+)>\[\s*(\d+)\.(\d+)\] (.*)$`)
+
+// Returns the host's kernel messages logged within the given (most recent)
+// period of time, with timestamps relative to the beginning of such period.
+func hostKmsgRecords(period time.Duration) ([]kmsgRecord, error) {
+
+	size, err := unix.Klogctl(unix.SYSLOG_ACTION_SIZE_BUFFER, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	n, err := unix.Klogctl(unix.SYSLOG_ACTION_READ_ALL, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var now unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &now); err != nil {
+		return nil, err
+	}
+
+	start := time.Duration(now.Nano()) - period
+
+	return filterKmsgRecords(buf[:n], start), nil
+}
+
+// Parses the given kernel messages (syslog format), keeping those logged after
+// the given (since boot) time, with timestamps rebased to that time.
+func filterKmsgRecords(data []byte, start time.Duration) []kmsgRecord {
+
+	var records []kmsgRecord
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		m := kmsgLineRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+
+		prio, _ := strconv.Atoi(m[1])
+		sec, _ := strconv.ParseInt(m[2], 10, 64)
+		usec, _ := strconv.ParseInt(m[3], 10, 64)
+
+		ts := time.Duration(sec)*time.Second + time.Duration(usec)*time.Microsecond
+		if ts < start {
+			continue
+		}
+
+		records = append(records, kmsgRecord{
+			prio: prio,
+			ts:   ts - start,
+			msg:  m[4],
+		})
+	}
+
+	return records
+}
@@ -0,0 +1,88 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcKmsg(t *testing.T) {
+
+	h := handlertest.New(t,
+		implementations.ProcKmsg_Handler,
+		implementations.DevKmsg_Handler)
+
+	procKmsg := h.Handler("/proc/kmsg")
+	devKmsg := h.Handler("/dev/kmsg")
+
+	if err := implementations.SetKmsgSource("bogus"); err == nil {
+		t.Errorf("SetKmsgSource() unexpectedly accepted an invalid source")
+	}
+
+	// Empty source: no messages.
+	c1 := h.Container("c1", 1001)
+
+	if data, err := h.Read(procKmsg, c1, 1001, "/proc/kmsg"); err != nil || data != "" {
+		t.Errorf("empty: Read() = %q, %v; want \"\"", data, err)
+	}
+
+	// Synthetic source: container lifecycle messages.
+	if err := implementations.SetKmsgSource(implementations.KmsgSourceSynthetic); err != nil {
+		t.Fatalf("SetKmsgSource() failed: %v", err)
+	}
+	defer implementations.SetKmsgSource(implementations.KmsgSourceEmpty)
+
+	want := "<6>[    0.000000] sysbox-fs: sys container c1 started\n"
+	if data, err := h.Read(procKmsg, c1, 1001, "/proc/kmsg"); err != nil || data != want {
+		t.Errorf("synthetic: Read() = %q, %v; want %q", data, err, want)
+	}
+
+	// Messages written into /dev/kmsg are added to the container's buffer.
+	if _, err := h.Write(devKmsg, c1, 1001, "/dev/kmsg", "<30>systemd[1]: hello\n"); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	data, err := h.Read(devKmsg, c1, 1001, "/dev/kmsg")
+	if err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	if len(lines) != 2 ||
+		lines[0] != "6,0,0,-;sysbox-fs: sys container c1 started" ||
+		!strings.HasPrefix(lines[1], "30,1,") ||
+		!strings.HasSuffix(lines[1], ",-;systemd[1]: hello") {
+		t.Errorf("Read() = %q; unexpected records", data)
+	}
+
+	// Buffers are not shared across containers.
+	c2 := h.Container("c2", 2001)
+
+	want = "6,0,0,-;sysbox-fs: sys container c2 started\n"
+	if data, err := h.Read(devKmsg, c2, 2001, "/dev/kmsg"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+
+	// /proc/kmsg is not writable.
+	if _, err := h.Write(procKmsg, c1, 1001, "/proc/kmsg", "x"); err == nil {
+		t.Errorf("Write() unexpectedly succeeded")
+	}
+}
@@ -0,0 +1,110 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/modules handler
+//
+// Documentation: /proc/modules lists the kernel modules currently loaded
+// ("<name> <size> <refcount> <deps> <state> <address> [taints]").
+//
+// This handler exposes the host's modules with their load addresses zeroed
+// (as they reveal the layout of the host's kernel), and leaves out the modules
+// being loaded or unloaded. Module names are preserved, as tools within sys
+// containers (e.g., Docker) check for the presence of specific modules (e.g.,
+// overlay, br_netfilter).
+//
+type ProcModules struct {
+	domain.HandlerBase
+}
+
+var ProcModules_Handler = &ProcModules{
+	domain.HandlerBase{
+		Name:    "ProcModules",
+		Path:    "/proc/modules",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+// Address displayed by the kernel for modules whose address is not to be
+// revealed.
+const hiddenModuleAddr = "0x0000000000000000"
+
+func (h *ProcModules) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(sanitizeProcModules(data), req)
+}
+
+func (h *ProcModules) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Sanitizes the contents of /proc/modules: only live modules are kept, and
+// their addresses are zeroed.
+func sanitizeProcModules(data []byte) []byte {
+
+	var buf bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[4] != "Live" {
+			continue
+		}
+
+		fields[5] = hiddenModuleAddr
+
+		buf.WriteString(strings.Join(fields, " ") + "\n")
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,47 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcModules(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcModules_Handler)
+	hdlr := h.Handler("/proc/modules")
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/modules",
+		"overlay 118784 4 - Live 0xffffffffc0a1b000\n"+
+			"br_netfilter 28672 0 - Live 0xffffffffc0a14000\n"+
+			"nf_nat 45056 1 xt_MASQUERADE, Live 0xffffffffc09f0000\n"+
+			"dummy 16384 0 - Unloading 0xffffffffc09e0000\n"+
+			"vboxdrv 479232 2 vboxnetadp,vboxnetflt, Live 0xffffffffc0900000 (OE)\n")
+
+	want := "overlay 118784 4 - Live 0x0000000000000000\n" +
+		"br_netfilter 28672 0 - Live 0x0000000000000000\n" +
+		"nf_nat 45056 1 xt_MASQUERADE, Live 0x0000000000000000\n" +
+		"vboxdrv 479232 2 vboxnetadp,vboxnetflt, Live 0x0000000000000000 (OE)\n"
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/modules"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+}
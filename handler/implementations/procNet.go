@@ -0,0 +1,265 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/net handler
+//
+// Emulated resources:
+//
+// * /proc/net/dev
+// * /proc/net/tcp
+// * /proc/net/tcp6
+// * /proc/net/udp
+// * /proc/net/udp6
+// * /proc/net/unix
+//
+// Sys containers sharing the host's network namespace (e.g., docker's
+// '--net=host') would otherwise find the socket tables and traffic counters of
+// the whole host in these files. For these containers, the socket tables are
+// restricted to the sockets opened by the container's processes (i.e., the
+// ones in the container's cgroup, inner containers included), while the
+// interfaces' counters, which can't be attributed to any container, are
+// reported as zero.
+//
+// Sys containers with their own network namespace are served the files of
+// their namespace as usual.
+//
+// Note that /proc/net is a symlink to the per-process /proc/self/net, hence it
+// isn't part of the generic procfs bind-mounts (mount.ProcfsMounts); these
+// resources are exposed within host-netns containers by bind-mounting them over
+// the container init's /proc/<pid>/net entries.
+//
+type ProcNet struct {
+	domain.HandlerBase
+}
+
+var ProcNet_Handler = &ProcNet{
+	domain.HandlerBase{
+		Name:    "ProcNet",
+		Path:    "/proc/net",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			"dev":  procNetResource(filterProcNetDev),
+			"tcp":  procNetResource(filterProcNetSockets(9)),
+			"tcp6": procNetResource(filterProcNetSockets(9)),
+			"udp":  procNetResource(filterProcNetSockets(9)),
+			"udp6": procNetResource(filterProcNetSockets(9)),
+			"unix": procNetResource(filterProcNetSockets(6)),
+		},
+	},
+}
+
+// Filter of a /proc/net file, given the inodes of the container's sockets.
+type procNetFilter func(data []byte, inodes map[string]bool) []byte
+
+func procNetResource(filter procNetFilter) *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:     domain.FileEmuResource,
+		Mode:     os.FileMode(uint32(0444)),
+		Enabled:  true,
+		ReadOnly: true,
+		Read: func(
+			h domain.HandlerIface,
+			n domain.IOnodeIface,
+			req *domain.HandlerRequest) (int, error) {
+
+			return readProcNet(h, n, req, filter)
+		},
+	}
+}
+
+func readProcNet(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest,
+	filter procNetFilter) (int, error) {
+
+	if !cntrInHostNetns(h, req.Container) {
+		return h.GetService().GetPassThroughHandler().Read(n, req)
+	}
+
+	// sysbox-fs lives in the host's network namespace too.
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	inodes, err := cntrSocketInodes(h, req.Container)
+	if err != nil {
+		logrus.Errorf("Unable to obtain the sockets of container %s: %v",
+			req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(filter(data, inodes), req)
+}
+
+// Returns true if the given container shares the network namespace of the
+// host (i.e., sysbox-fs' one).
+func cntrInHostNetns(h domain.HandlerIface, cntr domain.ContainerIface) bool {
+
+	prs := h.GetService().ProcessService()
+
+	hostNetns, err := prs.ProcessCreate(uint32(os.Getpid()), 0, 0).NetNsInode()
+	if err != nil {
+		return false
+	}
+
+	cntrNetns, err := cntr.InitProc().NetNsInode()
+	if err != nil {
+		return false
+	}
+
+	return hostNetns == cntrNetns
+}
+
+// Returns the inodes of the sockets opened by the processes of the given
+// container, as per the fds of the processes within the container's cgroup
+// (and its descendants).
+func cntrSocketInodes(
+	h domain.HandlerIface,
+	cntr domain.ContainerIface) (map[string]bool, error) {
+
+	cg, err := cntrCgroupPath(h, cntr, "pids")
+	if err != nil {
+		return nil, err
+	}
+
+	ios := h.GetService().IOService()
+	inodes := make(map[string]bool)
+
+	var walk func(dir string)
+	walk = func(dir string) {
+		if data, err := readHostFile(h, filepath.Join(dir, "cgroup.procs")); err == nil {
+			for _, pid := range strings.Fields(string(data)) {
+				procSocketInodes(ios, pid, inodes)
+			}
+		}
+
+		entries, err := ios.NewIOnode(filepath.Base(dir), dir, 0).ReadDirAll()
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				walk(filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+
+	walk(cg.dir())
+
+	return inodes, nil
+}
+
+// Collects the inodes of the sockets opened by the given process. Processes
+// gone in the meantime are skipped.
+func procSocketInodes(ios domain.IOServiceIface, pid string, inodes map[string]bool) {
+
+	dir := fmt.Sprintf("/proc/%s/fd", pid)
+
+	entries, err := ios.NewIOnode("fd", dir, 0).ReadDirAll()
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+
+		target, err := ios.NewIOnode(e.Name(), path, 0).ReadLink()
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(target, "socket:[") && strings.HasSuffix(target, "]") {
+			inodes[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")] = true
+		}
+	}
+}
+
+// Returns a filter of a socket table (e.g., /proc/net/tcp), keeping its header
+// along with the sockets whose inode (at the given column) is among the given
+// ones.
+func filterProcNetSockets(inodeCol int) procNetFilter {
+
+	return func(data []byte, inodes map[string]bool) []byte {
+
+		var buf bytes.Buffer
+
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+		for i, line := range lines {
+			fields := strings.Fields(line)
+			if i > 0 && (len(fields) <= inodeCol || !inodes[fields[inodeCol]]) {
+				continue
+			}
+			buf.WriteString(line)
+			buf.WriteString("\n")
+		}
+
+		return buf.Bytes()
+	}
+}
+
+// Filters the contents of /proc/net/dev, keeping its header and interfaces
+// while zeroing the interfaces' counters. The output is formatted as per the
+// kernel's one.
+func filterProcNetDev(data []byte, inodes map[string]bool) []byte {
+
+	var buf bytes.Buffer
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	for i, line := range lines {
+		if i < 2 {
+			buf.WriteString(line)
+			buf.WriteString("\n")
+			continue
+		}
+
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		counters := make([]interface{}, 16)
+		for j := range counters {
+			counters[j] = 0
+		}
+
+		fmt.Fprintf(&buf, "%6s:", strings.TrimSpace(fields[0]))
+		fmt.Fprintf(&buf, " %7d %7d %4d %4d %4d %5d %10d %9d %8d %7d %4d %4d %4d %5d %7d %10d\n",
+			counters...)
+	}
+
+	return buf.Bytes()
+}
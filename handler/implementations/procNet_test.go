@@ -0,0 +1,108 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+const procNetTcp = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+	"   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1111 1 0000000000000000 100 0 0 10 0\n" +
+	"   1: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2222 1 0000000000000000 100 0 0 10 0\n" +
+	"   2: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 3333 1 0000000000000000 100 0 0 10 0\n"
+
+const procNetUnix = "Num       RefCount Protocol Flags    Type St Inode Path\n" +
+	"0000000000000000: 00000002 00000000 00010000 0001 01 4444 /run/systemd/notify\n" +
+	"0000000000000000: 00000002 00000000 00010000 0001 01 5555 /run/app.sock\n"
+
+const procNetDev = "Inter-|   Receive                                                |  Transmit\n" +
+	" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+	"    lo:  123456     789    0    0    0     0          0         0   123456     789    0    0    0     0       0          0\n" +
+	"  eth0: 9876543   12345    1    2    0     0          0        10  1234567    2345    0    0    0     0       0          0\n"
+
+func TestProcNetHostNetns(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcNet_Handler)
+	c := h.Container("c1", 1001)
+
+	// The container shares sysbox-fs' (i.e., the host's) network namespace.
+	h.WriteHostFile("/proc/1001/ns/net", "100000")
+
+	h.WriteHostFile("/proc/1001/cgroup", "0::/sysbox/c1/init.scope\n")
+	h.WriteCntrFile("/proc/1001/cgroup", "0::/init.scope\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/cgroup.procs", "")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/init.scope/cgroup.procs", "1001\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/app/cgroup.procs", "5000\n")
+
+	h.WriteHostFile("/proc/1001/fd/0", "/dev/null")
+	h.WriteHostFile("/proc/1001/fd/3", "socket:[4444]")
+	h.WriteHostFile("/proc/5000/fd/4", "socket:[2222]")
+	h.WriteHostFile("/proc/5000/fd/5", "socket:[5555]")
+	h.WriteHostFile("/proc/6000/fd/3", "socket:[1111]")
+
+	h.WriteHostFile("/proc/net/tcp", procNetTcp)
+	h.WriteHostFile("/proc/net/unix", procNetUnix)
+	h.WriteHostFile("/proc/net/dev", procNetDev)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{
+			"/proc/net/tcp",
+			"  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+				"   1: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2222 1 0000000000000000 100 0 0 10 0\n",
+		},
+		{
+			"/proc/net/unix",
+			procNetUnix,
+		},
+		{
+			"/proc/net/dev",
+			"Inter-|   Receive                                                |  Transmit\n" +
+				" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+				"    lo:       0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0\n" +
+				"  eth0:       0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0\n",
+		},
+	}
+
+	hdlr := h.Handler("/proc/net/tcp")
+
+	for _, tt := range tests {
+		if data, err := h.Read(hdlr, c, 1001, tt.path); err != nil || data != tt.want {
+			t.Errorf("Read(%s) = %q, %v; want %q", tt.path, data, err, tt.want)
+		}
+	}
+}
+
+func TestProcNetPrivateNetns(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcNet_Handler)
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/net/tcp", procNetTcp)
+	h.WriteCntrFile("/proc/net/tcp", procNetTcp)
+
+	hdlr := h.Handler("/proc/net/tcp")
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/net/tcp"); err != nil || data != procNetTcp {
+		t.Errorf("Read() = %q, %v; want %q", data, err, procNetTcp)
+	}
+}
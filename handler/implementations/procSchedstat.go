@@ -0,0 +1,116 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/schedstat handler
+//
+// Documentation: /proc/schedstat provides per-CPU scheduler statistics ("cpuN"
+// lines, each followed by the "domainN" lines of the CPU's scheduling domains).
+//
+// This handler restricts the statistics to the CPUs in the sys container's
+// cpuset. The file can be hidden altogether through the "hidden" resource
+// policy.
+//
+type ProcSchedstat struct {
+	domain.HandlerBase
+}
+
+var ProcSchedstat_Handler = &ProcSchedstat{
+	domain.HandlerBase{
+		Name:    "ProcSchedstat",
+		Path:    "/proc/schedstat",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+func (h *ProcSchedstat) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	cpus, err := cntrCpus(h, req.Container)
+	if err != nil {
+		logrus.Errorf("Unable to obtain the cpus of container %s: %v",
+			req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(filterProcSchedstat(data, cpus), req)
+}
+
+func (h *ProcSchedstat) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Filters the contents of /proc/schedstat, keeping the given cpus' stats.
+func filterProcSchedstat(data []byte, cpus map[int]bool) []byte {
+
+	var buf bytes.Buffer
+	keep := true
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Domain lines go along with the preceding cpu line.
+		if strings.HasPrefix(line, "cpu") {
+			fields := strings.Fields(line)
+			cpu, err := strconv.Atoi(strings.TrimPrefix(fields[0], "cpu"))
+			keep = err == nil && cpus[cpu]
+		}
+
+		if keep {
+			buf.WriteString(line + "\n")
+		}
+	}
+
+	return buf.Bytes()
+}
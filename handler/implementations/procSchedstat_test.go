@@ -0,0 +1,55 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcSchedstat(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcSchedstat_Handler)
+	hdlr := h.Handler("/proc/schedstat")
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/1001/status", "Name:\tinit\nCpus_allowed_list:\t1,3\n")
+	h.WriteHostFile("/proc/schedstat",
+		"version 15\n"+
+			"timestamp 4295337416\n"+
+			"cpu0 0 0 0 0 0 0 100 200 10\n"+
+			"domain0 03 1 0 0\n"+
+			"cpu1 0 0 0 0 0 0 101 201 11\n"+
+			"domain0 03 2 0 0\n"+
+			"cpu2 0 0 0 0 0 0 102 202 12\n"+
+			"domain0 0c 3 0 0\n"+
+			"cpu3 0 0 0 0 0 0 103 203 13\n"+
+			"domain0 0c 4 0 0\n")
+
+	want := "version 15\n" +
+		"timestamp 4295337416\n" +
+		"cpu1 0 0 0 0 0 0 101 201 11\n" +
+		"domain0 03 2 0 0\n" +
+		"cpu3 0 0 0 0 0 0 103 203 13\n" +
+		"domain0 0c 4 0 0\n"
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/schedstat"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+}
@@ -0,0 +1,138 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/softirqs handler
+//
+// Documentation: /proc/softirqs displays the number of softirqs of each type
+// (rows) served by each CPU (columns).
+//
+// This handler restricts the columns to the CPUs in the sys container's
+// cpuset, so that per-CPU monitoring tools within the sys container find as
+// many columns as CPUs are advertised to them.
+//
+type ProcSoftirqs struct {
+	domain.HandlerBase
+}
+
+var ProcSoftirqs_Handler = &ProcSoftirqs{
+	domain.HandlerBase{
+		Name:    "ProcSoftirqs",
+		Path:    "/proc/softirqs",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+func (h *ProcSoftirqs) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	cpus, err := cntrCpus(h, req.Container)
+	if err != nil {
+		logrus.Errorf("Unable to obtain the cpus of container %s: %v",
+			req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(filterProcSoftirqs(data, cpus), req)
+}
+
+func (h *ProcSoftirqs) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Filters the contents of /proc/softirqs, keeping the given cpus' columns. The
+// output is formatted as per the kernel's one.
+func filterProcSoftirqs(data []byte, cpus map[int]bool) []byte {
+
+	var (
+		buf  bytes.Buffer
+		cols []bool // columns to keep
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	// Header: "CPU<n>" columns.
+	if !scanner.Scan() {
+		return nil
+	}
+
+	buf.WriteString(strings.Repeat(" ", 20))
+	for _, f := range strings.Fields(scanner.Text()) {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(f, "CPU"))
+		keep := err == nil && cpus[cpu]
+		if keep {
+			fmt.Fprintf(&buf, "CPU%-8d", cpu)
+		}
+		cols = append(cols, keep)
+	}
+	buf.WriteString("\n")
+
+	// Rows: "<softirq>: <count per cpu>".
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "%12s:", strings.TrimSuffix(fields[0], ":"))
+		for i, f := range fields[1:] {
+			if i < len(cols) && cols[i] {
+				fmt.Fprintf(&buf, " %10s", f)
+			}
+		}
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,47 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcSoftirqs(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcSoftirqs_Handler)
+	hdlr := h.Handler("/proc/softirqs")
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/1001/status", "Name:\tinit\nCpus_allowed_list:\t0,2\n")
+	h.WriteHostFile("/proc/softirqs",
+		"                    CPU0       CPU1       CPU2       CPU3       \n"+
+			"          HI:          1          2          3          4\n"+
+			"       TIMER:     100230     200231     300232     400233\n"+
+			"      NET_RX:         10         20         30         40\n")
+
+	want := "                    CPU0       CPU2       \n" +
+		"          HI:          1          3\n" +
+		"       TIMER:     100230     300232\n" +
+		"      NET_RX:         10         30\n"
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/softirqs"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+}
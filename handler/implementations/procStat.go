@@ -0,0 +1,146 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/stat handler
+//
+// Documentation: /proc/stat displays kernel / system statistics, starting with
+// the time spent by the CPUs in each mode: the aggregate one ("cpu" line),
+// followed by the one of each CPU ("cpu<N>" lines).
+//
+// This handler restricts the per-CPU lines to the CPUs in the sys container's
+// cpuset, and recomputes the aggregate line out of these, so that tools
+// computing CPU usage (e.g., top, mpstat) are consistent with the CPUs
+// advertised to them. The layout of this file is common to all architectures.
+// The remaining lines are left untouched.
+//
+type ProcStat struct {
+	domain.HandlerBase
+}
+
+var ProcStat_Handler = &ProcStat{
+	domain.HandlerBase{
+		Name:    "ProcStat",
+		Path:    "/proc/stat",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+func (h *ProcStat) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	cpus, err := cntrCpus(h, req.Container)
+	if err != nil {
+		logrus.Errorf("Unable to obtain the cpus of container %s: %v",
+			req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(filterProcStat(data, cpus), req)
+}
+
+func (h *ProcStat) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Filters the contents of /proc/stat, keeping the given cpus' lines and
+// recomputing the aggregate "cpu" line out of them. The output is formatted as
+// per the kernel's one.
+func filterProcStat(data []byte, cpus map[int]bool) []byte {
+
+	var (
+		buf   bytes.Buffer
+		total []uint64 // aggregate times
+		rest  []string // lines following the cpu ones
+		lines []string // kept cpu<N> lines
+	)
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			rest = append(rest, line)
+			continue
+		}
+		if fields[0] == "cpu" {
+			continue
+		}
+
+		cpu, err := strconv.Atoi(strings.TrimPrefix(fields[0], "cpu"))
+		if err != nil || !cpus[cpu] {
+			continue
+		}
+
+		for i, f := range fields[1:] {
+			val, _ := strconv.ParseUint(f, 10, 64)
+			if i >= len(total) {
+				total = append(total, 0)
+			}
+			total[i] += val
+		}
+		lines = append(lines, line)
+	}
+
+	buf.WriteString("cpu ")
+	for _, val := range total {
+		fmt.Fprintf(&buf, " %d", val)
+	}
+	buf.WriteString("\n")
+
+	for _, line := range append(lines, rest...) {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,53 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcStat(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcStat_Handler)
+	hdlr := h.Handler("/proc/stat")
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/1001/status", "Name:\tinit\nCpus_allowed_list:\t1,3\n")
+	h.WriteHostFile("/proc/stat",
+		"cpu  100 0 40 1000 4 0 2 0 0 0\n"+
+			"cpu0 25 0 10 250 1 0 0 0 0 0\n"+
+			"cpu1 25 0 10 250 1 0 1 0 0 0\n"+
+			"cpu2 25 0 10 250 1 0 0 0 0 0\n"+
+			"cpu3 25 0 10 250 1 0 1 0 0 0\n"+
+			"intr 12345 0 9\n"+
+			"ctxt 67890\n"+
+			"btime 1600000000\n")
+
+	want := "cpu  50 0 20 500 2 0 2 0 0 0\n" +
+		"cpu1 25 0 10 250 1 0 1 0 0 0\n" +
+		"cpu3 25 0 10 250 1 0 1 0 0 0\n" +
+		"intr 12345 0 9\n" +
+		"ctxt 67890\n" +
+		"btime 1600000000\n"
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/stat"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+}
@@ -141,12 +141,12 @@ func (h *ProcSwaps) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -154,7 +154,7 @@ func (h *ProcSwaps) GetResourcesList() []string {
 	return resources
 }
 
-func (h *ProcSwaps) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcSwaps) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
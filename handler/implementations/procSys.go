@@ -152,12 +152,12 @@ func (h *ProcSys) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -165,7 +165,7 @@ func (h *ProcSys) GetResourcesList() []string {
 	return resources
 }
 
-func (h *ProcSys) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcSys) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
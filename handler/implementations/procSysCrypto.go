@@ -0,0 +1,52 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+)
+
+//
+// /proc/sys/crypto handler
+//
+// Emulated resources:
+//
+// * /proc/sys/crypto/fips_enabled
+//
+// Documentation: Indicates whether the kernel runs in FIPS mode (i.e., only
+// FIPS-approved crypto algorithms are permitted).
+//
+// The value is initialized from the host's one, and is read-only within the
+// sys container, as on the host. For compliance testing purposes, FIPS mode can
+// be spoofed on a per-container basis through the sysctl annotation (i.e.,
+// "io.sysbox.fs.sysctl.crypto.fips_enabled=1"), which also restricts the
+// algorithms listed in the container's /proc/crypto accordingly.
+//
+var ProcSysCrypto_Handler = NewSysctlHandler(
+	"ProcSysCrypto",
+	"/proc/sys/crypto",
+	[]SysctlSpec{
+		{
+			Name:    "fips_enabled",
+			Type:    SysctlInt,
+			Min:     0,
+			Max:     1,
+			Default: "0",
+			Mode:    os.FileMode(uint32(0444)),
+		},
+	},
+)
@@ -18,14 +18,8 @@ package implementations
 
 import (
 	"os"
-	"path/filepath"
-	"sync"
-	"syscall"
-
-	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
-	"github.com/nestybox/sysbox-fs/fuse"
 )
 
 //
@@ -41,6 +35,8 @@ import (
 //
 // * /proc/sys/fs/protected_symlinks
 //
+// All these resources are served by HandlerBase's default operations.
+//
 
 const (
 	minProtectedSymlinksVal = 0
@@ -66,184 +62,38 @@ var ProcSysFs_Handler = &ProcSysFs{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Read:    readCntrData,
+				Write:   writeCntrDataMax,
 			},
 			"nr_open": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Read:    readCntrData,
+				Write:   writeCntrDataMax,
 			},
 			"protected_hardlinks": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0600)),
 				Enabled: true,
+				Range: &domain.EmuResourceRange{
+					Min: minProtectedHardlinksVal,
+					Max: maxProtectedHardlinksVal,
+				},
+				Read:  readCntrData,
+				Write: writeCntrDataLocal,
 			},
 			"protected_symlinks": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0600)),
 				Enabled: true,
+				Range: &domain.EmuResourceRange{
+					Min: minProtectedSymlinksVal,
+					Max: maxProtectedSymlinksVal,
+				},
+				Read:  readCntrData,
+				Write: writeCntrDataLocal,
 			},
 		},
 	},
 }
-
-func (h *ProcSysFs) Lookup(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (os.FileInfo, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	// If looked-up element hasn't been found by now, let's look into the actual
-	// sys container rootfs.
-	return h.Service.GetPassThroughHandler().Lookup(n, req)
-}
-
-func (h *ProcSysFs) Open(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) error {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	switch resource {
-	case "file-max":
-		return nil
-
-	case "nr_open":
-		return nil
-
-	case "protected_hardlinks":
-		return nil
-
-	case "protected_symlinks":
-		return nil
-	}
-
-	return h.Service.GetPassThroughHandler().Open(n, req)
-}
-
-func (h *ProcSysFs) Read(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (int, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	switch resource {
-	case "file-max":
-		return readCntrData(h, n, req)
-
-	case "nr_open":
-		return readCntrData(h, n, req)
-
-	case "protected_hardlinks":
-		return readCntrData(h, n, req)
-
-	case "protected_symlinks":
-		return readCntrData(h, n, req)
-	}
-
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Read(n, req)
-}
-
-func (h *ProcSysFs) Write(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (int, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	switch resource {
-	case "file-max":
-		return writeCntrData(h, n, req, writeMaxIntToFs)
-
-	case "nr_open":
-		return writeCntrData(h, n, req, writeMaxIntToFs)
-
-	case "protected_hardlinks":
-		if !checkIntRange(req.Data, minProtectedHardlinksVal, maxProtectedHardlinksVal) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
-		return writeCntrData(h, n, req, nil)
-
-	case "protected_symlinks":
-		if !checkIntRange(req.Data, minProtectedSymlinksVal, maxProtectedSymlinksVal) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
-		return writeCntrData(h, n, req, nil)
-	}
-
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Write(n, req)
-}
-
-func (h *ProcSysFs) ReadDirAll(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) ([]os.FileInfo, error) {
-
-	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, n.Name())
-
-	// Return all entries as seen within container's namespaces.
-	return h.Service.GetPassThroughHandler().ReadDirAll(n, req)
-}
-
-func (h *ProcSysFs) GetName() string {
-	return h.Name
-}
-
-func (h *ProcSysFs) GetPath() string {
-	return h.Path
-}
-
-func (h *ProcSysFs) GetService() domain.HandlerServiceIface {
-	return h.Service
-}
-
-func (h *ProcSysFs) GetEnabled() bool {
-	return h.Enabled
-}
-
-func (h *ProcSysFs) SetEnabled(b bool) {
-	h.Enabled = b
-}
-
-func (h *ProcSysFs) GetResourcesList() []string {
-
-	var resources []string
-
-	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
-		if !resource.Enabled {
-			resource.Mutex.Unlock()
-			continue
-		}
-		resource.Mutex.Unlock()
-
-		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
-	}
-
-	return resources
-}
-
-func (h *ProcSysFs) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
-	resource, ok := h.EmuResourceMap[n.Name()]
-	if !ok {
-		return nil
-	}
-
-	return &resource.Mutex
-}
-
-func (h *ProcSysFs) SetService(hs domain.HandlerServiceIface) {
-	h.Service = hs
-}
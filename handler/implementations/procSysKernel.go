@@ -17,16 +17,15 @@
 package implementations
 
 import (
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
-	"github.com/nestybox/sysbox-fs/fuse"
 )
 
 //
@@ -188,6 +187,24 @@ import (
 // pid_max.  On 64-bit systems, pid_max can be set to any value up to 2^22
 // (PID_MAX_LIMIT, approximately 4 million).
 //
+//
+// * /proc/sys/kernel/hung_task_panic
+// * /proc/sys/kernel/hung_task_timeout_secs
+// * /proc/sys/kernel/hung_task_check_count
+// * /proc/sys/kernel/hung_task_check_interval_secs
+// * /proc/sys/kernel/hung_task_warnings
+//
+// Documentation: These files configure the kernel's hung-task detector, which
+// reports (and optionally panics upon) tasks remaining in uninterruptible state
+// for longer than 'hung_task_timeout_secs'. These files are only present if the
+// kernel is built with CONFIG_DETECT_HUNG_TASK.
+//
+// As with 'panic' and 'panic_on_oops', these are system-wide attributes that
+// are commonly configured by systemd units and kdump tooling, so writes are
+// accepted but only made superficially (at sys-container level). IOW, the host
+// FS values will be left untouched. Kernel defaults are served if the host
+// lacks these files.
+//
 
 const (
 	minSysrqVal = 0
@@ -201,6 +218,15 @@ const (
 
 	minPidMaxVal = 1
 	maxPidMaxVal = 4194304
+
+	minHungTaskPanicVal = 0
+	maxHungTaskPanicVal = 1
+
+	minHungTaskCheckCountVal = 0
+	maxHungTaskCheckCountVal = 4194304
+
+	minHungTaskWarningsVal = -1
+	maxHungTaskWarningsVal = math.MaxInt32
 )
 
 type ProcSysKernel struct {
@@ -227,16 +253,19 @@ var ProcSysKernel_Handler = &ProcSysKernel{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: minRestrictVal, Max: maxRestrictVal},
 			},
 			"ngroups_max": {
-				Kind:    domain.FileEmuResource,
-				Mode:    os.FileMode(uint32(0444)),
-				Enabled: true,
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
 			},
 			"cap_last_cap": {
-				Kind:    domain.FileEmuResource,
-				Mode:    os.FileMode(uint32(0444)),
-				Enabled: true,
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
 			},
 			"panic": {
 				Kind:    domain.FileEmuResource,
@@ -257,11 +286,62 @@ var ProcSysKernel_Handler = &ProcSysKernel{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: minSysrqVal, Max: maxSysrqVal},
+			},
+			"hung_task_panic": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range: &domain.EmuResourceRange{
+					Min: minHungTaskPanicVal,
+					Max: maxHungTaskPanicVal,
+				},
+				Read:  readCntrDataOrDefault("0"),
+				Write: writeCntrDataLocal,
+			},
+			"hung_task_timeout_secs": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt64},
+				Read:    readCntrDataOrDefault("120"),
+				Write:   writeCntrDataLocal,
+			},
+			"hung_task_check_count": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range: &domain.EmuResourceRange{
+					Min: minHungTaskCheckCountVal,
+					Max: maxHungTaskCheckCountVal,
+				},
+				Read:  readCntrDataOrDefault("4194304"),
+				Write: writeCntrDataLocal,
+			},
+			"hung_task_check_interval_secs": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt64},
+				Read:    readCntrDataOrDefault("0"),
+				Write:   writeCntrDataLocal,
+			},
+			"hung_task_warnings": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range: &domain.EmuResourceRange{
+					Min: minHungTaskWarningsVal,
+					Max: maxHungTaskWarningsVal,
+				},
+				Read:  readCntrDataOrDefault("10"),
+				Write: writeCntrDataLocal,
 			},
 			"pid_max": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: minPidMaxVal, Max: maxPidMaxVal},
 			},
 		},
 	},
@@ -302,24 +382,14 @@ func (h *ProcSysKernel) Open(
 	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
 		req.ID, h.Name, resource)
 
-	flags := n.OpenFlags()
-
 	switch resource {
 	case "cap_last_cap":
-		if flags&syscall.O_WRONLY == syscall.O_WRONLY ||
-			flags&syscall.O_RDWR == syscall.O_RDWR {
-			return fuse.IOerror{Code: syscall.EACCES}
-		}
 		return nil
 
 	case "pid_max":
 		return nil
 
 	case "ngroups_max":
-		if flags&syscall.O_WRONLY == syscall.O_WRONLY ||
-			flags&syscall.O_RDWR == syscall.O_RDWR {
-			return fuse.IOerror{Code: syscall.EACCES}
-		}
 		return nil
 
 	case "domainname":
@@ -344,8 +414,9 @@ func (h *ProcSysKernel) Open(
 		return nil
 	}
 
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Open(n, req)
+	// Refer to the default handler operation if no node match is found above
+	// (i.e., resources served by their hooks, and passed-through ones).
+	return h.HandlerBase.Open(n, req)
 }
 
 func (h *ProcSysKernel) Read(
@@ -389,8 +460,9 @@ func (h *ProcSysKernel) Read(
 		return readCntrData(h, n, req)
 	}
 
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Read(n, req)
+	// Refer to the default handler operation if no node match is found above
+	// (i.e., resources served by their hooks, and passed-through ones).
+	return h.HandlerBase.Read(n, req)
 }
 
 func (h *ProcSysKernel) Write(
@@ -403,16 +475,7 @@ func (h *ProcSysKernel) Write(
 		req.ID, h.Name, resource)
 
 	switch resource {
-	case "cap_last_cap":
-		return 0, nil
-
-	case "ngroups_max":
-		return 0, nil
-
 	case "pid_max":
-		if !checkIntRange(req.Data, minPidMaxVal, maxPidMaxVal) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
 		return writeCntrData(h, n, req, nil)
 
 	case "panic":
@@ -428,15 +491,9 @@ func (h *ProcSysKernel) Write(
 		return writeCntrData(h, n, req, nil)
 
 	case "kptr_restrict":
-		if !checkIntRange(req.Data, minRestrictVal, maxRestrictVal) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
 		return writeCntrData(h, n, req, nil)
 
 	case "sysrq":
-		if !checkIntRange(req.Data, minSysrqVal, maxSysrqVal) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
 		return writeCntrData(h, n, req, nil)
 
 	case "domainname":
@@ -446,8 +503,9 @@ func (h *ProcSysKernel) Write(
 		return writeCntrData(h, n, req, nil)
 	}
 
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Write(n, req)
+	// Refer to the default handler operation if no node match is found above
+	// (i.e., resources served by their hooks, and passed-through ones).
+	return h.HandlerBase.Write(n, req)
 }
 
 func (h *ProcSysKernel) ReadDirAll(
@@ -457,8 +515,9 @@ func (h *ProcSysKernel) ReadDirAll(
 	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
 		req.ID, h.Name, n.Name())
 
-	// Return all entries as seen within container's namespaces.
-	return h.Service.GetPassThroughHandler().ReadDirAll(n, req)
+	// Return all entries as seen within container's namespaces, along with the
+	// emulated ones that may be missing on the host (e.g., hung_task knobs).
+	return h.HandlerBase.ReadDirAll(n, req)
 }
 
 func (h *ProcSysKernel) GetName() string {
@@ -486,12 +545,12 @@ func (h *ProcSysKernel) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -499,7 +558,7 @@ func (h *ProcSysKernel) GetResourcesList() []string {
 	return resources
 }
 
-func (h *ProcSysKernel) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcSysKernel) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
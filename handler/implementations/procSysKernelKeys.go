@@ -0,0 +1,80 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"math"
+)
+
+//
+// /proc/sys/kernel/keys handler
+//
+// Emulated resources:
+//
+// * /proc/sys/kernel/keys/maxkeys
+// * /proc/sys/kernel/keys/maxbytes
+//
+// Documentation: The maximum number of keys, and the maximum number of bytes of
+// data, that a non-root user can hold (i.e., key quotas).
+//
+// * /proc/sys/kernel/keys/root_maxkeys
+// * /proc/sys/kernel/keys/root_maxbytes
+//
+// Documentation: Same as above, but for the root user (uid 0 in the initial
+// user namespace).
+//
+// Key quotas are system-wide attributes that can only be modified from within
+// the initial user namespace, so writes from within sys containers (e.g., inner
+// kubelets and systemd-logind) fail with EPERM. These are thereby emulated
+// within each sys container: values are initialized from the host's ones (or
+// from the kernel defaults if missing), and changes are only made superficially
+// (at sys-container level). IOW, the host FS values will be left untouched.
+//
+var ProcSysKernelKeys_Handler = NewSysctlHandler(
+	"ProcSysKernelKeys",
+	"/proc/sys/kernel/keys",
+	[]SysctlSpec{
+		{
+			Name:    "maxkeys",
+			Type:    SysctlInt,
+			Min:     0,
+			Max:     math.MaxInt32,
+			Default: "200",
+		},
+		{
+			Name:    "maxbytes",
+			Type:    SysctlInt,
+			Min:     0,
+			Max:     math.MaxInt32,
+			Default: "20000",
+		},
+		{
+			Name:    "root_maxkeys",
+			Type:    SysctlInt,
+			Min:     0,
+			Max:     math.MaxInt32,
+			Default: "1000000",
+		},
+		{
+			Name:    "root_maxbytes",
+			Type:    SysctlInt,
+			Min:     0,
+			Max:     math.MaxInt32,
+			Default: "25000000",
+		},
+	},
+)
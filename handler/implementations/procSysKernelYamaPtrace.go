@@ -20,13 +20,11 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
-	"github.com/nestybox/sysbox-fs/fuse"
 )
 
 //
@@ -110,6 +108,7 @@ var ProcSysKernelYama_Handler = &ProcSysKernelYama{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Schema:  domain.IntSchema{Min: minScopeVal, Max: maxScopeVal},
 			},
 		},
 	},
@@ -177,9 +176,6 @@ func (h *ProcSysKernelYama) Write(
 
 	switch resource {
 	case "ptrace_scope":
-		if !checkIntRange(req.Data, minScopeVal, maxScopeVal) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
 		return writeCntrData(h, n, req, nil)
 	}
 
@@ -223,12 +219,12 @@ func (h *ProcSysKernelYama) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -236,7 +232,7 @@ func (h *ProcSysKernelYama) GetResourcesList() []string {
 	return resources
 }
 
-func (h *ProcSysKernelYama) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcSysKernelYama) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
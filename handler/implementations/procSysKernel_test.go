@@ -0,0 +1,166 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/fuse"
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+	cap "github.com/nestybox/sysbox-libs/capability"
+)
+
+func TestProcSysKernelHungTask(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcSysKernel_Handler)
+	c1 := h.Container("c1", 1001)
+	c2 := h.Container("c2", 2001)
+	hdlr := h.Handler("/proc/sys/kernel/hung_task_timeout_secs")
+
+	// Knobs missing on the host are served out of the kernel defaults.
+	const timeout = "/proc/sys/kernel/hung_task_timeout_secs"
+
+	if data, err := h.Read(hdlr, c1, 1001, timeout); err != nil || data != "120\n" {
+		t.Fatalf("Read() = %q, %v; want %q", data, err, "120\n")
+	}
+
+	// Writes are container-local.
+	if _, err := h.Write(hdlr, c1, 1001, timeout, "30\n"); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	if data, _ := h.Read(hdlr, c1, 1001, timeout); data != "30\n" {
+		t.Errorf("c1: Read() = %q; want %q", data, "30\n")
+	}
+	if data, _ := h.Read(hdlr, c2, 2001, timeout); data != "120\n" {
+		t.Errorf("c2: Read() = %q; want %q", data, "120\n")
+	}
+
+	// Knobs present on the host are initialized out of the host's value, which
+	// is left untouched by writes.
+	const panicKnob = "/proc/sys/kernel/hung_task_panic"
+
+	h.WriteHostFile(panicKnob, "1\n")
+
+	if data, err := h.Read(hdlr, c1, 1001, panicKnob); err != nil || data != "1\n" {
+		t.Fatalf("Read() = %q, %v; want %q", data, err, "1\n")
+	}
+	if _, err := h.Write(hdlr, c1, 1001, panicKnob, "0\n"); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	if data := h.HostFile(panicKnob); data != "1\n" {
+		t.Errorf("host value = %q; want %q", data, "1\n")
+	}
+
+	_, err := h.Write(hdlr, c1, 1001, panicKnob, "2\n")
+	if ioErr, ok := err.(fuse.IOerror); !ok || ioErr.Code != syscall.EINVAL {
+		t.Errorf("Write() error = %v; want EINVAL", err)
+	}
+}
+
+func TestProcSysKernelReadOnlyRemount(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcSysKernel_Handler)
+	c1 := h.Container("c1", 1001)
+	c2 := h.Container("c2", 2001)
+
+	const timeout = "/proc/sys/kernel/hung_task_timeout_secs"
+	hdlr := h.Handler(timeout)
+
+	// Writes fail with EROFS once the container's /proc is remounted read-only,
+	// while reads (and other containers) are unaffected.
+	c1.SetReadOnlyPath("/proc", true)
+
+	_, err := h.Write(hdlr, c1, 1001, timeout, "30\n")
+	if ioErr, ok := err.(fuse.IOerror); !ok || ioErr.Code != syscall.EROFS {
+		t.Errorf("Write() error = %v; want EROFS", err)
+	}
+	if data, err := h.Read(hdlr, c1, 1001, timeout); err != nil || data != "120\n" {
+		t.Errorf("Read() = %q, %v; want %q", data, err, "120\n")
+	}
+	if _, err := h.Write(hdlr, c2, 2001, timeout, "30\n"); err != nil {
+		t.Errorf("c2: Write() unexpected error: %v", err)
+	}
+
+	// Submounts can be remounted read-write on their own.
+	c1.SetReadOnlyPath("/proc/sys", false)
+
+	if _, err := h.Write(hdlr, c1, 1001, timeout, "30\n"); err != nil {
+		t.Errorf("Write() unexpected error: %v", err)
+	}
+}
+
+func TestProcSysKernelWriteCaps(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcSysKernel_Handler)
+	c := h.Container("c1", 1001)
+	hdlr := h.Handler("/proc/sys/kernel/hung_task_timeout_secs")
+
+	const timeout = "/proc/sys/kernel/hung_task_timeout_secs"
+
+	// Kernel sysctls can't be written without CAP_SYS_ADMIN.
+	h.SetCaps(1001, cap.CAP_NET_ADMIN)
+
+	_, err := h.Write(hdlr, c, 1001, timeout, "30\n")
+	if ioErr, ok := err.(fuse.IOerror); !ok || ioErr.Code != syscall.EPERM {
+		t.Errorf("Write() error = %v; want EPERM", err)
+	}
+	if data, _ := h.Read(hdlr, c, 1001, timeout); data != "120\n" {
+		t.Errorf("Read() = %q; want %q", data, "120\n")
+	}
+
+	h.SetCaps(1001, cap.CAP_SYS_ADMIN)
+
+	if _, err := h.Write(hdlr, c, 1001, timeout, "30\n"); err != nil {
+		t.Errorf("Write() unexpected error: %v", err)
+	}
+}
+
+func TestProcSysKernelAnnotationValues(t *testing.T) {
+
+	h := handlertest.New(t,
+		implementations.ProcSysKernel_Handler,
+		implementations.ProcSysKernelYama_Handler)
+
+	// Values set through annotations are validated as writes of the sysctls
+	// are.
+	tests := []struct {
+		path    string
+		data    string
+		wantErr bool
+	}{
+		{"/proc/sys/kernel/yama/ptrace_scope", "2\n", false},
+		{"/proc/sys/kernel/yama/ptrace_scope", "99\n", true},
+		{"/proc/sys/kernel/hung_task_panic", "1\n", false},
+		{"/proc/sys/kernel/hung_task_panic", "2\n", true},
+		{"/proc/sys/kernel/no_such_sysctl", "1\n", true},
+	}
+
+	for _, tt := range tests {
+		data, err := h.Handlers.CheckResourceValue(tt.path, []byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckResourceValue(%s, %q) error = %v, wantErr %v",
+				tt.path, tt.data, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && string(data) != tt.data {
+			t.Errorf("CheckResourceValue(%s, %q) = %q; want %q",
+				tt.path, tt.data, data, tt.data)
+		}
+	}
+}
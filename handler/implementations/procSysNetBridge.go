@@ -0,0 +1,120 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// /proc/sys/net/bridge handler
+//
+// Emulated resources:
+//
+// * /proc/sys/net/bridge/bridge-nf-call-arptables
+// * /proc/sys/net/bridge/bridge-nf-call-ip6tables
+// * /proc/sys/net/bridge/bridge-nf-call-iptables
+// * /proc/sys/net/bridge/bridge-nf-filter-pppoe-tagged
+// * /proc/sys/net/bridge/bridge-nf-filter-vlan-tagged
+// * /proc/sys/net/bridge/bridge-nf-pass-vlan-input-dev
+//
+// Documentation: These files control whether bridged traffic is subjected to
+// the arptables / ip6tables / iptables rules (i.e., br_netfilter). Tools such
+// as kubeadm (preflight checks) demand bridge-nf-call-iptables to be set to 1.
+//
+// These files are only present if the br_netfilter module is loaded, and are
+// only namespaced (per network namespace) since kernel 5.3. Hence, accesses are
+// passed through to the sys container's network namespace whenever possible,
+// and are emulated within the sys container otherwise (i.e., writes succeed but
+// have no effect beyond the sys container). Notice that the /proc/sys/net/bridge
+// directory itself is emulated too, as it's missing if br_netfilter is not
+// loaded.
+//
+type ProcSysNetBridge struct {
+	domain.HandlerBase
+}
+
+var ProcSysNetBridge_Handler = &ProcSysNetBridge{
+	domain.HandlerBase{
+		Name:    "ProcSysNetBridge",
+		Path:    "/proc/sys/net/bridge",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0555)),
+				Enabled: true,
+			},
+			"bridge-nf-call-arptables":      bridgeNfResource(),
+			"bridge-nf-call-ip6tables":      bridgeNfResource(),
+			"bridge-nf-call-iptables":       bridgeNfResource(),
+			"bridge-nf-filter-pppoe-tagged": bridgeNfResource(),
+			"bridge-nf-filter-vlan-tagged":  bridgeNfResource(),
+			"bridge-nf-pass-vlan-input-dev": bridgeNfResource(),
+		},
+	},
+}
+
+// Returns a br_netfilter boolean resource. As the kernel does, non-zero values
+// are taken as 1.
+func bridgeNfResource() *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:    domain.FileEmuResource,
+		Mode:    os.FileMode(uint32(0644)),
+		Enabled: true,
+		Range:   &domain.EmuResourceRange{Min: 0, Max: 1, Clamp: true},
+		Read:    readBridgeNf,
+		Write:   writeBridgeNf,
+	}
+}
+
+func readBridgeNf(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	sz, err := h.GetService().GetPassThroughHandler().Read(n, req)
+	if err == nil {
+		return sz, nil
+	}
+
+	logrus.Debugf("Unable to read %s within container's netns (%v): emulating it",
+		n.Path(), err)
+
+	// br_netfilter's knobs default to 1 once the module is loaded.
+	return readCntrDefault(n, req, "1")
+}
+
+func writeBridgeNf(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	sz, err := h.GetService().GetPassThroughHandler().Write(n, req)
+	if err == nil {
+		return sz, nil
+	}
+
+	logrus.Debugf("Unable to write %s within container's netns (%v): emulating it",
+		n.Path(), err)
+
+	return writeCntrDataLocal(h, n, req)
+}
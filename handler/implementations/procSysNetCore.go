@@ -17,14 +17,10 @@
 package implementations
 
 import (
+	"math"
 	"os"
-	"path/filepath"
 	"strings"
-	"sync"
 	"syscall"
-	"time"
-
-	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
 	"github.com/nestybox/sysbox-fs/fuse"
@@ -67,6 +63,39 @@ import (
 // Somaxconn refers to the maximum number of clients that the server can accept
 // to process data, that is, to complete the connection limit. Defaults to 128.
 //
+// Even though this attribute is namespaced by the kernel (per network
+// namespace), its value is emulated within each sys container, so that the
+// values set through the container's sysctl annotations are honored. Changes
+// are only made at sys-container level, and the host FS value is left
+// untouched.
+//
+// * /proc/sys/net/core/rmem_max
+// * /proc/sys/net/core/wmem_max
+//
+// Description: The maximum receive / send socket buffer size in bytes.
+//
+// * /proc/sys/net/core/netdev_max_backlog
+//
+// Description: Maximum number of packets, queued on the INPUT side, when the
+// interface receives packets faster than kernel can process them.
+//
+// These are system-wide limits (only exposed within the initial network
+// namespace), so their values are emulated within each sys container. Values
+// greater than the host's ones are also pushed down to the host FS, so that
+// the limits configured within the container are honored.
+//
+// * /proc/sys/net/core/rmem_default
+// * /proc/sys/net/core/wmem_default
+//
+// Description: The default receive / send socket buffer size in bytes.
+//
+// As these are system-wide defaults that apply to all the sockets in the
+// system, changes will be only made superficially (at sys-container level).
+// IOW, the host FS values will be left untouched.
+//
+// All the resources but default_qdisc are served by HandlerBase's default
+// operations.
+//
 type ProcSysNetCore struct {
 	domain.HandlerBase
 }
@@ -81,176 +110,63 @@ var ProcSysNetCore_Handler = &ProcSysNetCore{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Read:    readCntrData,
+				Write:   writeDefaultQdisc,
 			},
 			"somaxconn": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt32},
+				Read:    readCntrData,
+				Write:   writeCntrDataLocal,
+			},
+			"rmem_max": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt32},
+				Read:    readCntrData,
+				Write:   writeCntrDataMax,
+			},
+			"wmem_max": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt32},
+				Read:    readCntrData,
+				Write:   writeCntrDataMax,
+			},
+			"netdev_max_backlog": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt32},
+				Read:    readCntrData,
+				Write:   writeCntrDataMax,
+			},
+			"rmem_default": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt32},
+				Read:    readCntrData,
+				Write:   writeCntrDataLocal,
+			},
+			"wmem_default": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Enabled: true,
+				Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt32},
+				Read:    readCntrData,
+				Write:   writeCntrDataLocal,
 			},
 		},
 	},
 }
 
-func (h *ProcSysNetCore) Lookup(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (os.FileInfo, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	// Return an artificial fileInfo if looked-up element matches any of the
-	// emulated nodes.
-	if v, ok := h.EmuResourceMap[resource]; ok {
-		info := &domain.FileInfo{
-			Fname:    resource,
-			Fmode:    v.Mode,
-			FmodTime: time.Now(),
-		}
-
-		return info, nil
-	}
-
-	// If looked-up element hasn't been found by now, let's look into the actual
-	// sys container rootfs.
-	return h.Service.GetPassThroughHandler().Lookup(n, req)
-}
-
-func (h *ProcSysNetCore) Open(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) error {
-
-	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, n.Name())
-
-	return nil
-}
-
-func (h *ProcSysNetCore) Read(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (int, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	switch resource {
-	case "default_qdisc":
-		return readCntrData(h, n, req)
-
-	case "somaxconn":
-		return readCntrData(h, n, req)
-	}
-
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Read(n, req)
-}
-
-func (h *ProcSysNetCore) Write(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (int, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	switch resource {
-	case "default_qdisc":
-		return h.writeDefaultQdisc(n, req)
-
-	case "somaxconn":
-		return writeCntrData(h, n, req, writeMaxIntToFs)
-	}
-
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Write(n, req)
-}
-
-func (h *ProcSysNetCore) ReadDirAll(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) ([]os.FileInfo, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	var fileEntries []os.FileInfo
-
-	// Iterate through map of emulated components.
-	for k, _ := range h.EmuResourceMap {
-		info := &domain.FileInfo{
-			Fname:    k,
-			FmodTime: time.Now(),
-		}
-
-		fileEntries = append(fileEntries, info)
-	}
-
-	// Obtain the usual entries seen within container's namespaces and add them
-	// to the emulated ones.
-	usualEntries, err := h.Service.GetPassThroughHandler().ReadDirAll(n, req)
-	if err == nil {
-		fileEntries = append(fileEntries, usualEntries...)
-	}
-
-	return fileEntries, nil
-}
-
-func (h *ProcSysNetCore) GetName() string {
-	return h.Name
-}
-
-func (h *ProcSysNetCore) GetPath() string {
-	return h.Path
-}
-
-func (h *ProcSysNetCore) GetService() domain.HandlerServiceIface {
-	return h.Service
-}
-
-func (h *ProcSysNetCore) GetEnabled() bool {
-	return h.Enabled
-}
-
-func (h *ProcSysNetCore) SetEnabled(b bool) {
-	h.Enabled = b
-}
-
-func (h *ProcSysNetCore) GetResourcesList() []string {
-
-	var resources []string
-
-	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
-		if !resource.Enabled {
-			resource.Mutex.Unlock()
-			continue
-		}
-		resource.Mutex.Unlock()
-
-		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
-	}
-
-	return resources
-}
-func (h *ProcSysNetCore) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
-	resource, ok := h.EmuResourceMap[n.Name()]
-	if !ok {
-		return nil
-	}
-
-	return &resource.Mutex
-}
-
-func (h *ProcSysNetCore) SetService(hs domain.HandlerServiceIface) {
-	h.Service = hs
-}
-
-func (h *ProcSysNetCore) writeDefaultQdisc(
+func writeDefaultQdisc(
+	h domain.HandlerIface,
 	n domain.IOnodeIface,
 	req *domain.HandlerRequest) (int, error) {
 
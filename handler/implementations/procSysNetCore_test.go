@@ -0,0 +1,105 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcSysNetCoreSomaxconn(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcSysNetCore_Handler)
+
+	const somaxconn = "/proc/sys/net/core/somaxconn"
+
+	h.WriteHostFile(somaxconn, "4096\n")
+
+	c1 := h.AnnotatedContainer("c1", 1001, map[string]string{
+		"io.sysbox.fs.sysctl.net.core.somaxconn": "65535",
+	})
+	c2 := h.Container("c2", 2001)
+	hdlr := h.Handler(somaxconn)
+
+	// Values set through annotations are served back.
+	if data, err := h.Read(hdlr, c1, 1001, somaxconn); err != nil || data != "65535\n" {
+		t.Fatalf("c1: Read() = %q, %v; want %q", data, err, "65535\n")
+	}
+	if data, err := h.Read(hdlr, c2, 2001, somaxconn); err != nil || data != "4096\n" {
+		t.Fatalf("c2: Read() = %q, %v; want %q", data, err, "4096\n")
+	}
+
+	// Writes are container-local.
+	if _, err := h.Write(hdlr, c2, 2001, somaxconn, "1024\n"); err != nil {
+		t.Fatalf("c2: Write() unexpected error: %v", err)
+	}
+	if data, _ := h.Read(hdlr, c2, 2001, somaxconn); data != "1024\n" {
+		t.Errorf("c2: Read() = %q; want %q", data, "1024\n")
+	}
+	if data, _ := h.Read(hdlr, c1, 1001, somaxconn); data != "65535\n" {
+		t.Errorf("c1: Read() = %q; want %q", data, "65535\n")
+	}
+	if data := h.HostFile(somaxconn); data != "4096\n" {
+		t.Errorf("host value = %q; want %q", data, "4096\n")
+	}
+}
+
+func TestProcSysNetCoreReadDirAll(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcSysNetCore_Handler)
+
+	const dir = "/proc/sys/net/core"
+
+	c := h.Container("c1", 1001)
+	hdlr := h.Handler(dir)
+
+	// Container's namespace lacking the directory: only the emulated entries
+	// are listed.
+	names, err := h.ReadDirAll(hdlr, c, 1001, dir)
+	if err != nil {
+		t.Fatalf("ReadDirAll() unexpected error: %v", err)
+	}
+	count := func(names []string, name string) (n int) {
+		for _, s := range names {
+			if s == name {
+				n++
+			}
+		}
+		return n
+	}
+	if count(names, "somaxconn") != 1 {
+		t.Errorf("ReadDirAll() = %v; want somaxconn listed once", names)
+	}
+	emulated := len(names)
+
+	// Entries seen within the container's namespaces are merged with the
+	// emulated ones, which shadow them.
+	h.WriteCntrFile(dir+"/somaxconn", "4096\n")
+	h.WriteCntrFile(dir+"/netdev_budget", "300\n")
+
+	names, err = h.ReadDirAll(hdlr, c, 1001, dir)
+	if err != nil {
+		t.Fatalf("ReadDirAll() unexpected error: %v", err)
+	}
+	if count(names, "somaxconn") != 1 || count(names, "netdev_budget") != 1 ||
+		len(names) != emulated+1 {
+		t.Errorf("ReadDirAll() = %v; want the %d emulated entries plus netdev_budget",
+			names, emulated)
+	}
+}
@@ -55,6 +55,7 @@ var ProcSysNetIpv4_Handler = &ProcSysNetIpv4{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Schema:  domain.IntRangeSchema{Min: 0, Max: math.MaxInt32},
 			},
 		},
 	},
@@ -147,19 +148,19 @@ func (h *ProcSysNetIpv4) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
 
 	return resources
 }
-func (h *ProcSysNetIpv4) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcSysNetIpv4) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
@@ -198,13 +199,7 @@ func (h *ProcSysNetIpv4) writePingGroupRange(
 		return 0, fuse.IOerror{Code: syscall.EINVAL}
 	}
 
-	// Sanity-check input values.
-	if intMinGid < 0 {
-		return 0, fuse.IOerror{Code: syscall.EINVAL}
-	}
-	if intMaxGid > math.MaxInt32 {
-		return 0, fuse.IOerror{Code: syscall.EINVAL}
-	}
+	// Input values are already sanity-checked as per the resource's schema.
 
 	// Parse the container process' gid_map to extract the gid_size within the
 	// user-ns.
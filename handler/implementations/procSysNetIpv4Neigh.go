@@ -23,13 +23,11 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
-	"github.com/nestybox/sysbox-fs/fuse"
 )
 
 //
@@ -62,16 +60,19 @@ var ProcSysNetIpv4Neigh_Handler = &ProcSysNetIpv4Neigh{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Schema:  domain.IntSchema{Min: 0, Max: math.MaxInt32},
 			},
 			"default/gc_thresh2": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Schema:  domain.IntSchema{Min: 0, Max: math.MaxInt32},
 			},
 			"default/gc_thresh3": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Schema:  domain.IntSchema{Min: 0, Max: math.MaxInt32},
 			},
 		},
 	},
@@ -198,10 +199,6 @@ func (h *ProcSysNetIpv4Neigh) Write(
 			&domain.EmuResource{Kind: domain.FileEmuResource, Mode: os.FileMode(uint32(0644))}
 	}
 
-	if !checkIntRange(req.Data, 0, math.MaxInt32) {
-		return 0, fuse.IOerror{Code: syscall.EINVAL}
-	}
-
 	return writeCntrData(h, n, req, nil)
 }
 
@@ -212,6 +209,10 @@ func (h *ProcSysNetIpv4Neigh) ReadDirAll(
 	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
 		req.ID, h.Name, n.Name())
 
+	// Obtain the usual entries seen within container's namespaces. These are
+	// fetched in the background while the emulated ones are collected.
+	usualEntries := readDirAllAsync(h, n, req)
+
 	var (
 		info        *domain.FileInfo
 		fileEntries []os.FileInfo
@@ -246,14 +247,9 @@ func (h *ProcSysNetIpv4Neigh) ReadDirAll(
 		}
 	}
 
-	// Obtain the usual entries seen within container's namespaces and add them
-	// to the emulated ones.
-	usualEntries, err := h.Service.GetPassThroughHandler().ReadDirAll(n, req)
-	if err == nil {
-		fileEntries = append(fileEntries, usualEntries...)
-	}
-
-	return fileEntries, nil
+	// Add the usual entries seen within container's namespaces to the emulated
+	// ones.
+	return mergeDirEntries(fileEntries, usualEntries()), nil
 }
 
 func (h *ProcSysNetIpv4Neigh) GetName() string {
@@ -281,12 +277,12 @@ func (h *ProcSysNetIpv4Neigh) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -294,7 +290,7 @@ func (h *ProcSysNetIpv4Neigh) GetResourcesList() []string {
 	return resources
 }
 
-func (h *ProcSysNetIpv4Neigh) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcSysNetIpv4Neigh) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 
 	// Obtain the relative path to the element being acted on.
 	relPath, err := filepath.Rel(h.Path, n.Path())
@@ -21,13 +21,11 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
-	"github.com/nestybox/sysbox-fs/fuse"
 )
 
 //
@@ -75,16 +73,19 @@ var ProcSysNetIpv4Vs_Handler = &ProcSysNetIpv4Vs{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Schema:  domain.IntSchema{Min: minConnReuseMode, Max: maxConnReuseMode},
 			},
 			"expire_nodest_conn": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Schema:  domain.IntSchema{Min: math.MinInt32, Max: math.MaxInt32},
 			},
 			"expire_quiescent_template": {
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Schema:  domain.IntSchema{Min: math.MinInt32, Max: math.MaxInt32},
 			},
 		},
 	},
@@ -163,22 +164,9 @@ func (h *ProcSysNetIpv4Vs) Write(
 	case "conntrack":
 		return writeCntrData(h, n, req, writeMaxIntToFs)
 
-	case "conn_reuse_mode":
-		if !checkIntRange(req.Data, minConnReuseMode, maxConnReuseMode) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
-		return writeCntrData(h, n, req, nil)
-
-	case "expire_nodest_conn":
-		if !checkIntRange(req.Data, math.MinInt32, math.MaxInt32) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
-		return writeCntrData(h, n, req, nil)
-
-	case "expire_quiescent_template":
-		if !checkIntRange(req.Data, math.MinInt32, math.MaxInt32) {
-			return 0, fuse.IOerror{Code: syscall.EINVAL}
-		}
+	case "conn_reuse_mode",
+		"expire_nodest_conn",
+		"expire_quiescent_template":
 		return writeCntrData(h, n, req, nil)
 	}
 
@@ -195,6 +183,10 @@ func (h *ProcSysNetIpv4Vs) ReadDirAll(
 	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
 		req.ID, h.Name, resource)
 
+	// Obtain the usual entries seen within container's namespaces. These are
+	// fetched in the background while the emulated ones are collected.
+	usualEntries := readDirAllAsync(h, n, req)
+
 	var fileEntries []os.FileInfo
 
 	// Iterate through map of virtual components.
@@ -207,14 +199,9 @@ func (h *ProcSysNetIpv4Vs) ReadDirAll(
 		fileEntries = append(fileEntries, info)
 	}
 
-	// Obtain the usual entries seen within container's namespaces and add them
-	// to the emulated ones.
-	usualEntries, err := h.Service.GetPassThroughHandler().ReadDirAll(n, req)
-	if err == nil {
-		fileEntries = append(fileEntries, usualEntries...)
-	}
-
-	return fileEntries, nil
+	// Add the usual entries seen within container's namespaces to the emulated
+	// ones.
+	return mergeDirEntries(fileEntries, usualEntries()), nil
 }
 
 func (h *ProcSysNetIpv4Vs) GetName() string {
@@ -242,19 +229,19 @@ func (h *ProcSysNetIpv4Vs) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
 
 	return resources
 }
-func (h *ProcSysNetIpv4Vs) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcSysNetIpv4Vs) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
@@ -205,6 +205,10 @@ func (h *ProcSysNetNetfilter) ReadDirAll(
 	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
 		req.ID, h.Name, resource)
 
+	// Obtain the usual entries seen within container's namespaces. These are
+	// fetched in the background while the emulated ones are collected.
+	usualEntries := readDirAllAsync(h, n, req)
+
 	var fileEntries []os.FileInfo
 
 	// Obtain relative path to the element being read.
@@ -227,14 +231,9 @@ func (h *ProcSysNetNetfilter) ReadDirAll(
 		}
 	}
 
-	// Obtain the usual entries seen within container's namespaces and add them
-	// to the emulated ones.
-	usualEntries, err := h.Service.GetPassThroughHandler().ReadDirAll(n, req)
-	if err == nil {
-		fileEntries = append(fileEntries, usualEntries...)
-	}
-
-	return fileEntries, nil
+	// Add the usual entries seen within container's namespaces to the emulated
+	// ones.
+	return mergeDirEntries(fileEntries, usualEntries()), nil
 }
 
 func (h *ProcSysNetNetfilter) GetName() string {
@@ -262,19 +261,19 @@ func (h *ProcSysNetNetfilter) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
 
 	return resources
 }
-func (h *ProcSysNetNetfilter) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcSysNetNetfilter) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
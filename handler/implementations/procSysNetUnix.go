@@ -18,11 +18,6 @@ package implementations
 
 import (
 	"os"
-	"path/filepath"
-	"sync"
-	"time"
-
-	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
 )
@@ -34,6 +29,8 @@ import (
 //
 // * /proc/sys/net/unix/max_dgram_qlen
 //
+// All these resources are served by HandlerBase's default operations.
+//
 type ProcSysNetUnix struct {
 	domain.HandlerBase
 }
@@ -48,177 +45,9 @@ var ProcSysNetUnix_Handler = &ProcSysNetUnix{
 				Kind:    domain.FileEmuResource,
 				Mode:    os.FileMode(uint32(0644)),
 				Enabled: true,
+				Read:    readCntrData,
+				Write:   writeCntrDataMax,
 			},
 		},
 	},
 }
-
-func (h *ProcSysNetUnix) Lookup(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (os.FileInfo, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	// Return an artificial fileInfo if looked-up element matches any of the
-	// emulated nodes.
-	if v, ok := h.EmuResourceMap[resource]; ok {
-		info := &domain.FileInfo{
-			Fname:    resource,
-			Fmode:    v.Mode,
-			FmodTime: time.Now(),
-		}
-
-		return info, nil
-	}
-
-	// If looked-up element hasn't been found by now, let's look into the actual
-	// sys container rootfs.
-	return h.Service.GetPassThroughHandler().Lookup(n, req)
-}
-
-func (h *ProcSysNetUnix) Open(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) error {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	switch resource {
-	case "max_dgram_qlen":
-		return nil
-	}
-
-	return h.Service.GetPassThroughHandler().Open(n, req)
-}
-
-func (h *ProcSysNetUnix) Read(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (int, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	switch resource {
-	case "max_dgram_qlen":
-		return readCntrData(h, n, req)
-	}
-
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Read(n, req)
-}
-
-func (h *ProcSysNetUnix) Write(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) (int, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	switch resource {
-	case "max_dgram_qlen":
-		return writeCntrData(h, n, req, writeMaxIntToFs)
-	}
-
-	// Refer to generic handler if no node match is found above.
-	return h.Service.GetPassThroughHandler().Write(n, req)
-}
-
-func (h *ProcSysNetUnix) ReadDirAll(
-	n domain.IOnodeIface,
-	req *domain.HandlerRequest) ([]os.FileInfo, error) {
-
-	var resource = n.Name()
-
-	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
-		req.ID, h.Name, resource)
-
-	var fileEntries []os.FileInfo
-
-	// Obtain relative path to the element being read.
-	relpath, err := filepath.Rel(h.Path, n.Path())
-	if err != nil {
-		return nil, err
-	}
-
-	// Iterate through map of emulated components.
-	for k, _ := range h.EmuResourceMap {
-
-		if relpath == filepath.Dir(k) {
-			info := &domain.FileInfo{
-				Fname:    k,
-				Fmode:    os.FileMode(uint32(0644)),
-				FmodTime: time.Now(),
-			}
-
-			fileEntries = append(fileEntries, info)
-		}
-	}
-
-	// Obtain the usual entries seen within container's namespaces and add them
-	// to the emulated ones.
-	usualEntries, err := h.Service.GetPassThroughHandler().ReadDirAll(n, req)
-	if err == nil {
-		fileEntries = append(fileEntries, usualEntries...)
-	}
-
-	return fileEntries, nil
-}
-
-func (h *ProcSysNetUnix) GetName() string {
-	return h.Name
-}
-
-func (h *ProcSysNetUnix) GetPath() string {
-	return h.Path
-}
-
-func (h *ProcSysNetUnix) GetService() domain.HandlerServiceIface {
-	return h.Service
-}
-
-func (h *ProcSysNetUnix) GetEnabled() bool {
-	return h.Enabled
-}
-
-func (h *ProcSysNetUnix) SetEnabled(b bool) {
-	h.Enabled = b
-}
-
-func (h *ProcSysNetUnix) GetResourcesList() []string {
-
-	var resources []string
-
-	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
-		if !resource.Enabled {
-			resource.Mutex.Unlock()
-			continue
-		}
-		resource.Mutex.Unlock()
-
-		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
-	}
-
-	return resources
-}
-func (h *ProcSysNetUnix) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
-	resource, ok := h.EmuResourceMap[n.Name()]
-	if !ok {
-		return nil
-	}
-
-	return &resource.Mutex
-}
-
-func (h *ProcSysNetUnix) SetService(hs domain.HandlerServiceIface) {
-	h.Service = hs
-}
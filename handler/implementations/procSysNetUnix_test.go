@@ -0,0 +1,63 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcSysNetUnix(t *testing.T) {
+
+	const path = "/proc/sys/net/unix/max_dgram_qlen"
+
+	h := handlertest.New(t, implementations.ProcSysNetUnix_Handler)
+	c := h.Container("c1", 1001)
+	hdlr := h.Handler(path)
+
+	h.WriteHostFile(path, "512\n")
+
+	info, err := h.Lookup(hdlr, c, 1001, path)
+	if err != nil || info.Name() != "max_dgram_qlen" || info.Mode() != 0644 {
+		t.Fatalf("Lookup() = %v, %v; want emulated max_dgram_qlen", info, err)
+	}
+
+	if data, err := h.Read(hdlr, c, 1001, path); err != nil || data != "512\n" {
+		t.Fatalf("Read() = %q, %v; want %q", data, err, "512\n")
+	}
+
+	// Values above the host's one are pushed down to it; lower ones are kept
+	// within the container.
+	for _, tt := range []struct {
+		write, cntr, host string
+	}{
+		{"1024\n", "1024\n", "1024\n"},
+		{"100\n", "100\n", "1024\n"},
+	} {
+		if _, err := h.Write(hdlr, c, 1001, path, tt.write); err != nil {
+			t.Fatalf("Write(%q) unexpected error: %v", tt.write, err)
+		}
+		if data, _ := h.Read(hdlr, c, 1001, path); data != tt.cntr {
+			t.Errorf("after Write(%q): Read() = %q; want %q", tt.write, data, tt.cntr)
+		}
+		if data := h.HostFile(path); data != tt.host {
+			t.Errorf("after Write(%q): host value = %q; want %q", tt.write, data, tt.host)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/sys/user handler
+//
+// Emulated resources:
+//
+// * /proc/sys/user/max_cgroup_namespaces
+// * /proc/sys/user/max_ipc_namespaces
+// * /proc/sys/user/max_mnt_namespaces
+// * /proc/sys/user/max_net_namespaces
+// * /proc/sys/user/max_pid_namespaces
+// * /proc/sys/user/max_time_namespaces
+// * /proc/sys/user/max_user_namespaces
+// * /proc/sys/user/max_uts_namespaces
+//
+// Documentation: The maximum number of namespaces of each type that any user
+// in the current user namespace may create. Limits are enforced along the
+// whole user-namespace hierarchy, so the limits defined within a sys container
+// can't exceed the host's ones.
+//
+// Inner container runtimes tune these limits on startup. In order to let them
+// do so without affecting the host (nor other sys containers), these limits
+// are emulated within each sys container: they're initialized to a share of
+// the host's limits (see domain.UserNsLimitsShare()), and can be set to any
+// value within the host's limits, which are left untouched.
+//
+type ProcSysUser struct {
+	domain.HandlerBase
+}
+
+var ProcSysUser_Handler = &ProcSysUser{
+	domain.HandlerBase{
+		Name:    "ProcSysUser",
+		Path:    "/proc/sys/user",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			"max_cgroup_namespaces": userNsLimitResource(),
+			"max_ipc_namespaces":    userNsLimitResource(),
+			"max_mnt_namespaces":    userNsLimitResource(),
+			"max_net_namespaces":    userNsLimitResource(),
+			"max_pid_namespaces":    userNsLimitResource(),
+			"max_time_namespaces":   userNsLimitResource(),
+			"max_user_namespaces":   userNsLimitResource(),
+			"max_uts_namespaces":    userNsLimitResource(),
+		},
+	},
+}
+
+func userNsLimitResource() *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:    domain.FileEmuResource,
+		Mode:    os.FileMode(uint32(0644)),
+		Enabled: true,
+		Range:   &domain.EmuResourceRange{Min: 0, Max: math.MaxInt32},
+		Read:    readUserNsLimit,
+		Write:   writeUserNsLimit,
+	}
+}
+
+// Returns the host's value of the given user-namespace limit.
+func hostUserNsLimit(h domain.HandlerIface, n domain.IOnodeIface) (int64, error) {
+
+	data := make([]byte, 32)
+
+	sz, err := readFs(h, n, 0, &data)
+	if err != nil && sz == 0 {
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	limit, err := strconv.ParseInt(strings.TrimSpace(string(data[:sz])), 10, 64)
+	if err != nil {
+		return 0, fuse.IOerror{Code: syscall.EINVAL}
+	}
+
+	return limit, nil
+}
+
+func readUserNsLimit(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	limit, err := hostUserNsLimit(h, n)
+	if err != nil {
+		return 0, err
+	}
+
+	// Sys containers are granted a share of the host's limit, unless a value
+	// has been set within the sys container already.
+	limit = limit * int64(domain.UserNsLimitsShare()) / 100
+
+	return readCntrDefault(n, req, strconv.FormatInt(limit, 10))
+}
+
+func writeUserNsLimit(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	limit, err := hostUserNsLimit(h, n)
+	if err != nil {
+		return 0, err
+	}
+
+	val, err := strconv.ParseInt(strings.TrimSpace(string(req.Data)), 10, 64)
+	if err != nil || val > limit {
+		return 0, fuse.IOerror{Code: syscall.EINVAL}
+	}
+
+	return writeCntrDataLocal(h, n, req)
+}
@@ -0,0 +1,69 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcSysUser(t *testing.T) {
+
+	const path = "/proc/sys/user/max_user_namespaces"
+
+	domain.SetUserNsLimitsShare(50)
+	defer domain.SetUserNsLimitsShare(100)
+
+	h := handlertest.New(t, implementations.ProcSysUser_Handler)
+	c1 := h.Container("c1", 1001)
+	c2 := h.Container("c2", 2001)
+	hdlr := h.Handler(path)
+
+	h.WriteHostFile(path, "1000\n")
+
+	// Sys containers are granted a share of the host's limit.
+	if data, err := h.Read(hdlr, c1, 1001, path); err != nil || data != "500\n" {
+		t.Fatalf("Read() = %q, %v; want %q", data, err, "500\n")
+	}
+
+	// Limits can be raised up to the host's one, without affecting the host
+	// nor other sys containers.
+	if _, err := h.Write(hdlr, c1, 1001, path, "800\n"); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	if data, _ := h.Read(hdlr, c1, 1001, path); data != "800\n" {
+		t.Errorf("c1: Read() = %q; want %q", data, "800\n")
+	}
+	if data, _ := h.Read(hdlr, c2, 2001, path); data != "500\n" {
+		t.Errorf("c2: Read() = %q; want %q", data, "500\n")
+	}
+	if data := h.HostFile(path); data != "1000\n" {
+		t.Errorf("host value = %q; want %q", data, "1000\n")
+	}
+
+	for _, val := range []string{"1001\n", "-1\n", "abc\n"} {
+		_, err := h.Write(hdlr, c1, 1001, path, val)
+		if ioErr, ok := err.(fuse.IOerror); !ok || ioErr.Code != syscall.EINVAL {
+			t.Errorf("Write(%q) error = %v; want EINVAL", val, err)
+		}
+	}
+}
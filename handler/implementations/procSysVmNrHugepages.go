@@ -0,0 +1,137 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/sys/vm/nr_hugepages handler
+//
+// Documentation: This file holds the number of hugepages of the default size
+// reserved in the system (i.e., the hugepages pool).
+//
+// Within a sys container, the pool is bounded by the container's hugetlb
+// cgroup limits. Hence, this file shares the emulated count of the
+// /sys/kernel/mm/hugepages/hugepages-<default-size>kB/nr_hugepages file (see
+// SysKernelMmHugepages handler): the container's hugetlb allowance by default,
+// adjustable through writes within that allowance. The host's pool is left
+// untouched.
+//
+// Systems lacking hugepages support are served through the passthrough
+// handler.
+//
+type ProcSysVmNrHugepages struct {
+	domain.HandlerBase
+}
+
+var ProcSysVmNrHugepages_Handler = &ProcSysVmNrHugepages{
+	domain.HandlerBase{
+		Name:    "ProcSysVmNrHugepages",
+		Path:    "/proc/sys/vm/nr_hugepages",
+		Enabled: true,
+	},
+}
+
+func (h *ProcSysVmNrHugepages) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, err := defaultHugepageSize(h); err != nil {
+		return h.Service.GetPassThroughHandler().Lookup(n, req)
+	}
+
+	return &domain.FileInfo{
+		Fname:    n.Name(),
+		Fmode:    os.FileMode(uint32(0644)),
+		FmodTime: time.Now(),
+	}, nil
+}
+
+func (h *ProcSysVmNrHugepages) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, err := defaultHugepageSize(h); err != nil {
+		return h.Service.GetPassThroughHandler().Open(n, req)
+	}
+
+	return nil
+}
+
+func (h *ProcSysVmNrHugepages) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	size, err := defaultHugepageSize(h)
+	if err != nil {
+		return h.Service.GetPassThroughHandler().Read(n, req)
+	}
+
+	nr, err := cntrNrHugepages(h, req.Container, size)
+	if err != nil {
+		logrus.Errorf("Unable to obtain %s for container %s: %v",
+			n.Path(), req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData([]byte(strconv.FormatUint(nr, 10)+"\n"), req)
+}
+
+func (h *ProcSysVmNrHugepages) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	size, err := defaultHugepageSize(h)
+	if err != nil {
+		return h.Service.GetPassThroughHandler().Write(n, req)
+	}
+
+	if err := setCntrNrHugepages(h, req.Container, size, req.Data); err != nil {
+		return 0, err
+	}
+
+	return len(req.Data), nil
+}
+
+func (h *ProcSysVmNrHugepages) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
@@ -0,0 +1,245 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/sysvipc handler
+//
+// Emulated resources:
+//
+// * /proc/sysvipc/shm
+// * /proc/sysvipc/sem
+// * /proc/sysvipc/msg
+//
+// Documentation: These files list the System V IPC objects (shared memory
+// segments, semaphore sets and message queues) of the reader's IPC namespace,
+// along with their owner / creator uids & gids, and the pids of the processes
+// that last operated on them.
+//
+// Objects are enumerated within the IPC namespace of the process accessing
+// these files (through nsenter), and their uids & gids are translated through
+// the sys container's user-namespace mapping (unmapped ones being displayed as
+// the overflow id). Pids are translated into the process' pid namespace, with
+// those of processes outside of it displayed as 0.
+//
+type ProcSysvipc struct {
+	domain.HandlerBase
+}
+
+var ProcSysvipc_Handler = &ProcSysvipc{
+	domain.HandlerBase{
+		Name:    "ProcSysvipc",
+		Path:    "/proc/sysvipc",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			"shm": sysvipcResource(),
+			"sem": sysvipcResource(),
+			"msg": sysvipcResource(),
+		},
+	},
+}
+
+func sysvipcResource() *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:     domain.FileEmuResource,
+		Mode:     os.FileMode(uint32(0444)),
+		Enabled:  true,
+		ReadOnly: true,
+		Read:     readSysvipc,
+	}
+}
+
+// Indexes of the uid, gid and pid columns of each file.
+type sysvipcColumns struct {
+	uids, gids, pids []int
+}
+
+var sysvipcFileColumns = map[string]sysvipcColumns{
+	// key shmid perms size cpid lpid nattch uid gid cuid cgid ...
+	"shm": {uids: []int{7, 9}, gids: []int{8, 10}, pids: []int{4, 5}},
+	// key semid perms nsems uid gid cuid cgid ...
+	"sem": {uids: []int{4, 6}, gids: []int{5, 7}},
+	// key msqid perms cbytes qnum lspid lrpid uid gid cuid cgid ...
+	"msg": {uids: []int{7, 9}, gids: []int{8, 10}, pids: []int{5, 6}},
+}
+
+func readSysvipc(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	data, err := fetchSysvipc(h, n, req)
+	if err != nil {
+		logrus.Errorf("Unable to read %s for container %s: %v",
+			n.Path(), req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	cols := sysvipcFileColumns[n.Name()]
+	xlate := &sysvipcTranslator{h: h, cntr: req.Container}
+	xlate.pidLevel = len(procNsPids(h, req.Pid)) - 1
+
+	var buf bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	// Header.
+	if scanner.Scan() {
+		buf.WriteString(scanner.Text() + "\n")
+	}
+
+	for scanner.Scan() {
+		repl := make(map[int]string)
+
+		fields := strings.Fields(scanner.Text())
+		for _, i := range cols.uids {
+			if i < len(fields) {
+				repl[i] = xlate.uid(fields[i])
+			}
+		}
+		for _, i := range cols.gids {
+			if i < len(fields) {
+				repl[i] = xlate.gid(fields[i])
+			}
+		}
+		for _, i := range cols.pids {
+			if i < len(fields) {
+				repl[i] = xlate.pid(fields[i])
+			}
+		}
+
+		buf.WriteString(replaceColumns(scanner.Text(), repl) + "\n")
+	}
+
+	return readFromData(buf.Bytes(), req)
+}
+
+// Reads the given file within the IPC namespace of the process accessing it.
+// Other namespaces are left alone, so that uids & pids are obtained as seen
+// from the host.
+func fetchSysvipc(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]byte, error) {
+
+	nss := h.GetService().NSenterService()
+
+	event := nss.NewEvent(
+		req.Pid,
+		&[]domain.NStype{string(domain.NStypeIpc)},
+		&domain.NSenterMessage{
+			Type: domain.ReadFileRequest,
+			Payload: &domain.ReadFilePayload{
+				File:   n.Path(),
+				Offset: 0,
+				Len:    1 << 20,
+			},
+		},
+		nil,
+		false,
+	)
+
+	if err := nss.SendRequestEvent(event); err != nil {
+		return nil, err
+	}
+
+	responseMsg := nss.ReceiveResponseEvent(event)
+	if responseMsg.Type == domain.ErrorResponse {
+		return nil, responseMsg.Payload.(error)
+	}
+
+	return responseMsg.Payload.([]byte), nil
+}
+
+// Translates host ids into the ones seen within a sys container.
+type sysvipcTranslator struct {
+	h        domain.HandlerIface
+	cntr     domain.ContainerIface
+	pidLevel int // pid-namespace level of the process accessing the file
+}
+
+func (x *sysvipcTranslator) uid(s string) string {
+	if id, ok := cntrUid(s, x.cntr); ok {
+		return strconv.FormatUint(uint64(id), 10)
+	}
+	return strconv.Itoa(overflowID)
+}
+
+func (x *sysvipcTranslator) gid(s string) string {
+	if id, ok := cntrGid(s, x.cntr); ok {
+		return strconv.FormatUint(uint64(id), 10)
+	}
+	return strconv.Itoa(overflowID)
+}
+
+func (x *sysvipcTranslator) pid(s string) string {
+
+	pid, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || pid == 0 || x.pidLevel < 0 {
+		return "0"
+	}
+
+	nsPids := procNsPids(x.h, uint32(pid))
+	if len(nsPids) <= x.pidLevel {
+		return "0"
+	}
+
+	return nsPids[x.pidLevel]
+}
+
+// Columns (i.e., fields along with their leading spaces) of /proc/sysvipc
+// entries.
+var sysvipcColumnRegexp = regexp.MustCompile(`\s*\S+`)
+
+// Replaces the given columns of the given line, keeping the columns' widths
+// (i.e., values are right-aligned) as long as the new values fit in them.
+func replaceColumns(line string, repl map[int]string) string {
+
+	var b strings.Builder
+
+	for i, col := range sysvipcColumnRegexp.FindAllString(line, -1) {
+		val, ok := repl[i]
+		if !ok {
+			b.WriteString(col)
+			continue
+		}
+
+		width := len(col)
+		if i > 0 && len(val)+1 > width {
+			width = len(val) + 1
+		}
+		b.WriteString(fmt.Sprintf("%*s", width, val))
+	}
+
+	return b.String()
+}
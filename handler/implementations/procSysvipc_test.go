@@ -0,0 +1,57 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcSysvipc(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcSysvipc_Handler)
+	hdlr := h.Handler("/proc/sysvipc/shm")
+
+	// Container's uids & gids: [231072, 231072+65535).
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/1001/status", "Name:\tinit\nNSpid:\t1001\t1\n")
+	h.WriteHostFile("/proc/5000/status", "Name:\tpostgres\nNSpid:\t5000\t42\n")
+	h.WriteHostFile("/proc/6000/status", "Name:\tdaemon\nNSpid:\t6000\n")
+
+	// Entries are fetched through nsenter, which the harness serves out of the
+	// containers' file-system.
+	h.WriteCntrFile("/proc/sysvipc/shm",
+		"       key      shmid perms                  size  cpid  lpid nattch   uid   gid  cuid  cgid\n"+
+			"  5432001      32768   600                 56    5000  6000      1 232072 232072 231072 231072\n"+
+			"        0      32769  1600               4096    6000  5000      0     0     0     0     0\n")
+
+	want := "       key      shmid perms                  size  cpid  lpid nattch   uid   gid  cuid  cgid\n" +
+		"  5432001      32768   600                 56      42     0      1   1000   1000      0      0\n" +
+		"        0      32769  1600               4096       0    42      0 65534 65534 65534 65534\n"
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/sysvipc/shm"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+
+	// Entries are read-only.
+	if _, err := h.Write(hdlr, c, 1001, "/proc/sysvipc/shm", "x"); err == nil {
+		t.Errorf("Write() unexpectedly succeeded")
+	}
+}
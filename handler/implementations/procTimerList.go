@@ -0,0 +1,140 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /proc/timer_list handler
+//
+// Documentation: /proc/timer_list dumps the state of the kernel's timers: the
+// per-CPU clock bases along with their active timers ("cpu: N" sections), and
+// the tick devices, both per-CPU ("Per CPU device: N") and broadcast ones.
+//
+// This handler restricts the per-CPU sections to the CPUs in the sys
+// container's cpuset. The file can be hidden altogether through the "hidden"
+// resource policy.
+//
+type ProcTimerList struct {
+	domain.HandlerBase
+}
+
+var ProcTimerList_Handler = &ProcTimerList{
+	domain.HandlerBase{
+		Name:    "ProcTimerList",
+		Path:    "/proc/timer_list",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+func (h *ProcTimerList) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	data, err := n.ReadFile()
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %v", n.Path(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	cpus, err := cntrCpus(h, req.Container)
+	if err != nil {
+		logrus.Errorf("Unable to obtain the cpus of container %s: %v",
+			req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData(filterProcTimerList(data, cpus), req)
+}
+
+func (h *ProcTimerList) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	return nil, nil
+}
+
+// Filters the contents of /proc/timer_list, keeping the given cpus' sections
+// (as well as the cpu-independent ones).
+func filterProcTimerList(data []byte, cpus map[int]bool) []byte {
+
+	var (
+		buf     bytes.Buffer
+		keep    = true
+		tickDev string
+	)
+
+	isCpu := func(s string) bool {
+		cpu, err := strconv.Atoi(strings.TrimSpace(s))
+		return err == nil && cpus[cpu]
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		// Tick device sections are identified by their second line.
+		case strings.HasPrefix(line, "Tick Device:"):
+			tickDev = line
+			continue
+
+		case tickDev != "":
+			if strings.HasPrefix(line, "Per CPU device:") {
+				keep = isCpu(strings.TrimPrefix(line, "Per CPU device:"))
+			} else {
+				keep = true
+			}
+			if keep {
+				buf.WriteString(tickDev + "\n")
+			}
+			tickDev = ""
+
+		case strings.HasPrefix(line, "cpu: "):
+			keep = isCpu(strings.TrimPrefix(line, "cpu: "))
+		}
+
+		if keep {
+			buf.WriteString(line + "\n")
+		}
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,77 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestProcTimerList(t *testing.T) {
+
+	h := handlertest.New(t, implementations.ProcTimerList_Handler)
+	hdlr := h.Handler("/proc/timer_list")
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/1001/status", "Name:\tinit\nCpus_allowed_list:\t1\n")
+	h.WriteHostFile("/proc/timer_list",
+		"Timer List Version: v0.9\n"+
+			"now at 123456789 nsecs\n"+
+			"\n"+
+			"cpu: 0\n"+
+			" clock 0:\n"+
+			"  #0: <0000000000000000>, tick_sched_timer, S:01\n"+
+			"\n"+
+			"cpu: 1\n"+
+			" clock 0:\n"+
+			"  #0: <0000000000000000>, hrtimer_wakeup, S:01\n"+
+			"\n"+
+			"Tick Device: mode:     1\n"+
+			"Broadcast device\n"+
+			"Clock Event Device: hpet\n"+
+			"\n"+
+			"Tick Device: mode:     1\n"+
+			"Per CPU device: 0\n"+
+			"Clock Event Device: lapic-deadline\n"+
+			"\n"+
+			"Tick Device: mode:     1\n"+
+			"Per CPU device: 1\n"+
+			"Clock Event Device: lapic-deadline\n"+
+			"\n")
+
+	want := "Timer List Version: v0.9\n" +
+		"now at 123456789 nsecs\n" +
+		"\n" +
+		"cpu: 1\n" +
+		" clock 0:\n" +
+		"  #0: <0000000000000000>, hrtimer_wakeup, S:01\n" +
+		"\n" +
+		"Tick Device: mode:     1\n" +
+		"Broadcast device\n" +
+		"Clock Event Device: hpet\n" +
+		"\n" +
+		"Tick Device: mode:     1\n" +
+		"Per CPU device: 1\n" +
+		"Clock Event Device: lapic-deadline\n" +
+		"\n"
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/timer_list"); err != nil || data != want {
+		t.Errorf("Read() = %q, %v; want %q", data, err, want)
+	}
+}
@@ -140,12 +140,12 @@ func (h *ProcUptime) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -153,7 +153,7 @@ func (h *ProcUptime) GetResourcesList() []string {
 	return resources
 }
 
-func (h *ProcUptime) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *ProcUptime) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
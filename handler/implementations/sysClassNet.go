@@ -0,0 +1,84 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// /sys/class/net handler
+//
+// Unlike most sysfs nodes, the ones under /sys/class/net (i.e., the network
+// interfaces and their attributes and statistics) are per network namespace.
+// However, these ones reflect the network namespace of the sysfs instance
+// rather than the one of the process accessing them, so a sysfs instance
+// mounted outside of the sys container's network namespace exposes the
+// host's interfaces.
+//
+// This handler serves /sys/class/net out of the network namespace of the
+// process accessing it, through the pass-through handler (nsenter mounts a
+// sysfs instance for the entered network namespace to be reflected; see
+// mountNetnsSysfs()). Contents are never cached, as most of them (e.g.,
+// statistics, operstate) are constantly changing.
+//
+type SysClassNet struct {
+	domain.HandlerBase
+}
+
+var SysClassNet_Handler = &SysClassNet{
+	domain.HandlerBase{
+		Name:    "SysClassNet",
+		Path:    "/sys/class/net",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+				Enabled: true,
+			},
+		},
+	},
+}
+
+func (h *SysClassNet) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	req.NoCache = true
+
+	return h.HandlerBase.Read(n, req)
+}
+
+func (h *SysClassNet) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	req.NoCache = true
+
+	return h.HandlerBase.Write(n, req)
+}
@@ -0,0 +1,56 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysClassNet(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysClassNet_Handler)
+	hdlr := h.Handler("/sys/class/net")
+
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/sys/class/net/enp0s3/statistics/rx_bytes", "123456789\n")
+	h.WriteCntrFile("/sys/class/net/eth0/statistics/rx_bytes", "1024\n")
+
+	// Interfaces are the ones of the container's network namespace.
+	names, err := h.ReadDirAll(hdlr, c, 1001, "/sys/class/net")
+	if err != nil || len(names) != 1 || names[0] != "eth0" {
+		t.Errorf("unexpected interfaces: %v (%v)", names, err)
+	}
+
+	path := "/sys/class/net/eth0/statistics/rx_bytes"
+
+	data, err := h.Read(hdlr, c, 1001, path)
+	if err != nil || data != "1024\n" {
+		t.Errorf("rx_bytes = (%q, %v)", data, err)
+	}
+
+	// Statistics are not cached.
+	h.WriteCntrFile(path, "2048\n")
+
+	data, err = h.Read(hdlr, c, 1001, path)
+	if err != nil || data != "2048\n" {
+		t.Errorf("rx_bytes = (%q, %v), want updated value", data, err)
+	}
+}
@@ -0,0 +1,267 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /sys/class/tty handler
+//
+// Emulated resources:
+//
+// * /sys/class/tty
+// * /sys/class/tty/console
+// * /sys/class/tty/console/{dev,uevent,active}
+//
+// The host's tty devices (e.g., virtual consoles, serial ports) are registered
+// in the tty class regardless of the sys container accessing it, which leads
+// inner init systems to act upon them (e.g., systemd spawning gettys on the
+// serial consoles listed in /sys/class/tty/console/active).
+//
+// Hence, only the tty devices a sys container can make use of are exposed: the
+// pseudo-terminal multiplexer ("ptmx") and the controlling terminal ("tty"),
+// which are served out of the host's sysfs. Notice that the pseudo-terminals
+// of the container's devpts instance aren't registered in sysfs, so there's
+// nothing to expose for them. The "console" entry is replaced by a synthetic
+// one matching the container's console (i.e., /dev/console), with no active
+// consoles.
+//
+type SysClassTty struct {
+	domain.HandlerBase
+}
+
+var SysClassTty_Handler = &SysClassTty{
+	domain.HandlerBase{
+		Name:    "SysClassTty",
+		Path:    "/sys/class/tty",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+				Enabled: true,
+			},
+			"console": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+				Enabled: true,
+			},
+			"console/dev":    sysClassTtyFileResource(),
+			"console/uevent": sysClassTtyFileResource(),
+			"console/active": sysClassTtyFileResource(),
+		},
+	},
+}
+
+func sysClassTtyFileResource() *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:     domain.FileEmuResource,
+		Mode:     os.FileMode(uint32(0444)),
+		Size:     4096,
+		Enabled:  true,
+		ReadOnly: true,
+	}
+}
+
+// Contents of the synthetic console's attributes (/dev/console is char device
+// 5:1).
+var sysClassTtyConsole = map[string]string{
+	"console/dev":    "5:1\n",
+	"console/uevent": "MAJOR=5\nMINOR=1\nDEVNAME=console\n",
+	"console/active": "\n",
+}
+
+// Host tty devices exposed within sys containers.
+var sysClassTtyHostDevices = map[string]bool{
+	"ptmx": true,
+	"tty":  true,
+}
+
+func (h *SysClassTty) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	resource, host, ok := h.resource(n)
+	if !ok {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	// As the rest of the host's sysfs nodes, tty devices show up as
+	// "nobody:nogroup" within the sys container.
+	req.SkipIdRemap = true
+
+	if host {
+		return n.Stat()
+	}
+
+	return &domain.FileInfo{
+		Fname:    n.Name(),
+		Fsize:    resource.Size,
+		Fmode:    resource.Mode,
+		FmodTime: time.Now(),
+		FisDir:   resource.Kind == domain.DirEmuResource,
+	}, nil
+}
+
+func (h *SysClassTty) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	_, host, ok := h.resource(n)
+	if !ok {
+		return fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	if host {
+		if err := n.Open(); err != nil {
+			return err
+		}
+		n.Close()
+	}
+
+	return nil
+}
+
+func (h *SysClassTty) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	resource, host, ok := h.resource(n)
+	if !ok {
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	if host {
+		return readHostFs(h, n, req.Offset, &req.Data)
+	}
+
+	if resource.Kind == domain.DirEmuResource {
+		return 0, fuse.IOerror{Code: syscall.EISDIR}
+	}
+
+	relpath, _ := filepath.Rel(h.Path, n.Path())
+
+	return readFromData([]byte(sysClassTtyConsole[relpath]), req)
+}
+
+func (h *SysClassTty) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, _, ok := h.resource(n); !ok {
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	return 0, fuse.IOerror{Code: syscall.EACCES}
+}
+
+func (h *SysClassTty) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	_, host, ok := h.resource(n)
+	if !ok {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	if host {
+		return n.ReadDirAll()
+	}
+
+	relpath, err := filepath.Rel(h.Path, n.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	var fileEntries []os.FileInfo
+
+	for k, v := range h.EmuResourceMap {
+		if k == "." || filepath.Dir(k) != relpath {
+			continue
+		}
+
+		fileEntries = append(fileEntries, &domain.FileInfo{
+			Fname:    filepath.Base(k),
+			Fsize:    v.Size,
+			Fmode:    v.Mode,
+			FmodTime: time.Now(),
+			FisDir:   v.Kind == domain.DirEmuResource,
+		})
+	}
+
+	// Exposed host devices.
+	if relpath == "." {
+		for name := range sysClassTtyHostDevices {
+			path := filepath.Join(h.Path, name)
+			info, err := h.Service.IOService().NewIOnode(name, path, 0).Stat()
+			if err != nil {
+				continue
+			}
+			fileEntries = append(fileEntries, info)
+		}
+	}
+
+	return fileEntries, nil
+}
+
+// Returns the emulated resource matching the given node, or whether the node
+// is one of the exposed host devices (or a descendant of them). Returns false
+// if the node is hidden.
+func (h *SysClassTty) resource(
+	n domain.IOnodeIface) (*domain.EmuResource, bool, bool) {
+
+	relpath, err := filepath.Rel(h.Path, n.Path())
+	if err != nil {
+		return nil, false, false
+	}
+
+	if resource, ok := h.EmuResourceMap[relpath]; ok {
+		return resource, false, true
+	}
+
+	if sysClassTtyHostDevices[strings.SplitN(relpath, "/", 2)[0]] {
+		return nil, true, true
+	}
+
+	return nil, false, false
+}
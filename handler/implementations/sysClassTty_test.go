@@ -0,0 +1,79 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysClassTty(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysClassTty_Handler)
+	hdlr := h.Handler("/sys/class/tty")
+
+	h.WriteHostFile("/sys/class/tty/console/active", "tty0 ttyS0\n")
+	h.WriteHostFile("/sys/class/tty/ptmx/dev", "5:2\n")
+	h.WriteHostFile("/sys/class/tty/tty/dev", "5:0\n")
+	h.WriteHostFile("/sys/class/tty/tty0/dev", "4:0\n")
+	h.WriteHostFile("/sys/class/tty/ttyS0/dev", "4:64\n")
+
+	c := h.Container("c1", 1001)
+
+	// Host virtual consoles and serial ports are hidden.
+	names, err := h.ReadDirAll(hdlr, c, 1001, "/sys/class/tty")
+	if err != nil {
+		t.Fatalf("readdir failed: %v", err)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "console,ptmx,tty" {
+		t.Errorf("unexpected entries: %v", got)
+	}
+	for _, name := range []string{"tty0", "ttyS0"} {
+		if _, err := h.Lookup(hdlr, c, 1001, "/sys/class/tty/"+name); err == nil {
+			t.Errorf("%s unexpectedly exposed", name)
+		}
+	}
+
+	// The console is a synthetic one, with no active consoles.
+	data, err := h.Read(hdlr, c, 1001, "/sys/class/tty/console/active")
+	if err != nil || data != "\n" {
+		t.Errorf("console/active = (%q, %v)", data, err)
+	}
+	data, err = h.Read(hdlr, c, 1001, "/sys/class/tty/console/dev")
+	if err != nil || data != "5:1\n" {
+		t.Errorf("console/dev = (%q, %v)", data, err)
+	}
+
+	// Pseudo-terminal devices are served out of the host (short reads being
+	// flagged with io.EOF).
+	req := h.Request(c, 1001)
+	req.Data = make([]byte, 4096)
+
+	sz, err := hdlr.Read(h.Node("/sys/class/tty/ptmx/dev"), req)
+	if err != nil && err != io.EOF {
+		t.Fatalf("read of ptmx/dev failed: %v", err)
+	}
+	if got := string(req.Data[:sz]); got != "5:2\n" {
+		t.Errorf("ptmx/dev = %q", got)
+	}
+}
@@ -0,0 +1,346 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /sys/devices/system/cpu handler
+//
+// Emulated resources (per cpu):
+//
+// * /sys/devices/system/cpu/cpu<N>/cpufreq
+// * /sys/devices/system/cpu/cpu<N>/cpufreq/scaling_cur_freq
+// * /sys/devices/system/cpu/cpu<N>/cpufreq/scaling_max_freq
+// * /sys/devices/system/cpu/cpu<N>/topology/core_id
+//
+// Performance tools and runtimes (e.g., the JVM) size themselves out of the
+// cpu nodes found in this directory. To keep them consistent with the cpus a
+// sys container is allowed to run on (i.e., its cpuset), the "cpu<N>"
+// directories of the remaining cpus are hidden.
+//
+// The cpufreq and topology files above are served out of the host's ones when
+// present, and synthesized otherwise (e.g., in virtual machines lacking a
+// cpufreq driver): frequencies out of the per-cpu entries of /proc/cpuinfo (as
+// per the host's architecture, see cpuArch), and core ids out of the position
+// of each cpu within the container's cpuset.
+//
+// The rest of the nodes are served out of the host's sysfs, and show up as
+// 'nobody:nogroup' within the sys container. Writes into them are not allowed.
+//
+type SysDevicesSystemCpu struct {
+	domain.HandlerBase
+}
+
+var SysDevicesSystemCpu_Handler = &SysDevicesSystemCpu{
+	domain.HandlerBase{
+		Name:    "SysDevicesSystemCpu",
+		Path:    "/sys/devices/system/cpu",
+		Enabled: true,
+	},
+}
+
+// Emulated resources of each cpu<N> directory, indexed by their path relative
+// to it.
+var sysCpuResources = map[string]*domain.EmuResource{
+	"cpufreq": {
+		Kind:    domain.DirEmuResource,
+		Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+		Enabled: true,
+	},
+	"cpufreq/scaling_cur_freq": sysCpuFileResource(),
+	"cpufreq/scaling_max_freq": sysCpuFileResource(),
+	"topology/core_id":         sysCpuFileResource(),
+}
+
+func sysCpuFileResource() *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:     domain.FileEmuResource,
+		Mode:     os.FileMode(uint32(0444)),
+		Size:     4096,
+		Enabled:  true,
+		ReadOnly: true,
+	}
+}
+
+func (h *SysDevicesSystemCpu) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	cpu, relpath, isCpu := h.cpuNode(n.Path())
+	if isCpu {
+		if !h.cpuVisible(cpu, req.Container) {
+			return nil, fuse.IOerror{Code: syscall.ENOENT}
+		}
+
+		if resource, ok := sysCpuResources[relpath]; ok {
+			return &domain.FileInfo{
+				Fname:    n.Name(),
+				Fsize:    resource.Size,
+				Fmode:    resource.Mode,
+				FmodTime: time.Now(),
+				FisDir:   resource.Kind == domain.DirEmuResource,
+			}, nil
+		}
+	}
+
+	// As the rest of the host's sysfs nodes, the non-emulated ones show up as
+	// "nobody:nogroup" within the sys container.
+	req.SkipIdRemap = true
+
+	return n.Stat()
+}
+
+func (h *SysDevicesSystemCpu) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	cpu, relpath, isCpu := h.cpuNode(n.Path())
+	if isCpu {
+		if !h.cpuVisible(cpu, req.Container) {
+			return fuse.IOerror{Code: syscall.ENOENT}
+		}
+		if _, ok := sysCpuResources[relpath]; ok {
+			return nil
+		}
+	}
+
+	if err := n.Open(); err != nil {
+		return err
+	}
+	n.Close()
+
+	return nil
+}
+
+func (h *SysDevicesSystemCpu) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	cpu, relpath, isCpu := h.cpuNode(n.Path())
+	if isCpu {
+		if !h.cpuVisible(cpu, req.Container) {
+			return 0, fuse.IOerror{Code: syscall.ENOENT}
+		}
+
+		if resource, ok := sysCpuResources[relpath]; ok {
+			if resource.Kind == domain.DirEmuResource {
+				return 0, fuse.IOerror{Code: syscall.EISDIR}
+			}
+
+			val, err := h.cpuValue(cpu, relpath, n, req.Container)
+			if err != nil {
+				logrus.Errorf("Unable to obtain %s for container %s: %v",
+					n.Path(), req.Container.ID(), err)
+				return 0, fuse.IOerror{Code: syscall.EIO}
+			}
+
+			return readFromData([]byte(val+"\n"), req)
+		}
+	}
+
+	return readHostFs(h, n, req.Offset, &req.Data)
+}
+
+func (h *SysDevicesSystemCpu) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	// Host cpu settings (e.g., cpu hotplug, frequency governors) are not to be
+	// modified from within sys containers.
+	if cpu, _, isCpu := h.cpuNode(n.Path()); isCpu && !h.cpuVisible(cpu, req.Container) {
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	return 0, fuse.IOerror{Code: syscall.EACCES}
+}
+
+func (h *SysDevicesSystemCpu) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	cpu, relpath, isCpu := h.cpuNode(n.Path())
+	if !isCpu {
+		entries, err := n.ReadDirAll()
+		if err != nil || n.Path() != h.Path {
+			return entries, err
+		}
+
+		// Only the cpus of the container's cpuset are listed.
+		var res []os.FileInfo
+		for _, info := range entries {
+			path := filepath.Join(n.Path(), info.Name())
+			if c, _, ok := h.cpuNode(path); ok && !h.cpuVisible(c, req.Container) {
+				continue
+			}
+			res = append(res, info)
+		}
+
+		return res, nil
+	}
+
+	if !h.cpuVisible(cpu, req.Container) {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	// The emulated cpufreq directory may not be present in the host.
+	entries, err := n.ReadDirAll()
+	if err != nil && sysCpuResources[relpath] == nil {
+		return nil, err
+	}
+
+	var emulated []os.FileInfo
+	for k, v := range sysCpuResources {
+		if filepath.Dir(k) != relpath {
+			continue
+		}
+
+		emulated = append(emulated, &domain.FileInfo{
+			Fname:    filepath.Base(k),
+			Fsize:    v.Size,
+			Fmode:    v.Mode,
+			FmodTime: time.Now(),
+			FisDir:   v.Kind == domain.DirEmuResource,
+		})
+	}
+
+	return mergeDirEntries(emulated, entries), nil
+}
+
+// Parses the given path into the cpu it belongs to (if any), along with its
+// path relative to the cpu's directory (e.g., "." for the directory itself).
+func (h *SysDevicesSystemCpu) cpuNode(path string) (int, string, bool) {
+
+	relpath, err := filepath.Rel(h.Path, path)
+	if err != nil || relpath == "." {
+		return 0, "", false
+	}
+
+	parts := strings.SplitN(relpath, "/", 2)
+	if !strings.HasPrefix(parts[0], "cpu") {
+		return 0, "", false
+	}
+
+	cpu, err := strconv.Atoi(strings.TrimPrefix(parts[0], "cpu"))
+	if err != nil || cpu < 0 {
+		return 0, "", false
+	}
+
+	if len(parts) == 1 {
+		return cpu, ".", true
+	}
+
+	return cpu, parts[1], true
+}
+
+// Returns true if the given cpu is part of the given container's cpuset.
+func (h *SysDevicesSystemCpu) cpuVisible(cpu int, cntr domain.ContainerIface) bool {
+
+	if cntr == nil {
+		return true
+	}
+
+	cpus, err := cntrCpus(h, cntr)
+	if err != nil {
+		// Can't tell; leave the cpu alone.
+		return true
+	}
+
+	return cpus[cpu]
+}
+
+// Returns the value of the given emulated resource of the given cpu, as sourced
+// from the host or synthesized otherwise.
+func (h *SysDevicesSystemCpu) cpuValue(
+	cpu int,
+	relpath string,
+	n domain.IOnodeIface,
+	cntr domain.ContainerIface) (string, error) {
+
+	if data, err := n.ReadFile(); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	switch relpath {
+	case "cpufreq/scaling_cur_freq", "cpufreq/scaling_max_freq":
+		return h.cpuinfoFreq(cpu)
+
+	case "topology/core_id":
+		cpus, err := cntrCpus(h, cntr)
+		if err != nil {
+			return "", err
+		}
+
+		var ids []int
+		for c := range cpus {
+			ids = append(ids, c)
+		}
+		sort.Ints(ids)
+
+		return strconv.Itoa(sort.SearchInts(ids, cpu)), nil
+	}
+
+	return "", fmt.Errorf("unexpected resource %s", relpath)
+}
+
+// Returns the frequency (in kHz) of the given cpu as per the host's
+// /proc/cpuinfo.
+func (h *SysDevicesSystemCpu) cpuinfoFreq(cpu int) (string, error) {
+
+	path := "/proc/cpuinfo"
+	n := h.Service.IOService().NewIOnode(filepath.Base(path), path, 0)
+
+	data, err := n.ReadFile()
+	if err != nil {
+		return "", err
+	}
+
+	if khz, ok := hostCpuArch(h).cpuinfoFreq(data, cpu); ok {
+		return strconv.FormatUint(khz, 10), nil
+	}
+
+	return "", fmt.Errorf("no frequency found for cpu %d in %s", cpu, path)
+}
@@ -0,0 +1,99 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysDevicesSystemCpu(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysDevicesSystemCpu_Handler)
+	hdlr := h.Handler("/sys/devices/system/cpu")
+
+	h.WriteHostFile("/proc/1001/status", "Name:\tinit\nCpus_allowed_list:\t1,3\n")
+	h.WriteHostFile("/proc/sys/kernel/arch", "x86_64\n")
+	h.WriteHostFile("/proc/cpuinfo",
+		"processor\t: 1\ncpu MHz\t\t: 2400.000\n\nprocessor\t: 3\ncpu MHz\t\t: 1800.000\n")
+
+	h.WriteHostFile("/sys/devices/system/cpu/online", "0-3\n")
+	h.WriteHostFile("/sys/devices/system/cpu/cpuidle/current_driver", "none\n")
+	for _, cpu := range []string{"cpu0", "cpu1", "cpu2", "cpu3"} {
+		h.WriteHostFile("/sys/devices/system/cpu/"+cpu+"/online", "1\n")
+	}
+	h.WriteHostFile("/sys/devices/system/cpu/cpu1/topology/core_id", "5\n")
+	h.WriteHostFile("/sys/devices/system/cpu/cpu1/cpufreq/scaling_cur_freq", "2100000\n")
+
+	c := h.Container("c1", 1001)
+
+	// Only the cpus of the container's cpuset are exposed.
+	names, err := h.ReadDirAll(hdlr, c, 1001, "/sys/devices/system/cpu")
+	if err != nil {
+		t.Fatalf("readdir failed: %v", err)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "cpu1,cpu3,cpuidle,online" {
+		t.Errorf("unexpected entries: %v", got)
+	}
+	if _, err := h.Lookup(hdlr, c, 1001, "/sys/devices/system/cpu/cpu0"); err == nil {
+		t.Errorf("cpu0 unexpectedly exposed")
+	}
+
+	// Values are sourced from the host when present, and synthesized otherwise.
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"cpu1/cpufreq/scaling_cur_freq", "2100000\n"},
+		{"cpu1/cpufreq/scaling_max_freq", "2400000\n"},
+		{"cpu1/topology/core_id", "5\n"},
+		{"cpu3/cpufreq/scaling_cur_freq", "1800000\n"},
+		{"cpu3/topology/core_id", "1\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := h.Read(hdlr, c, 1001, "/sys/devices/system/cpu/"+tt.path)
+		if err != nil {
+			t.Fatalf("read of %s failed: %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	names, err = h.ReadDirAll(hdlr, c, 1001, "/sys/devices/system/cpu/cpu3/cpufreq")
+	if err != nil {
+		t.Fatalf("readdir of cpu3/cpufreq failed: %v", err)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "scaling_cur_freq,scaling_max_freq" {
+		t.Errorf("unexpected cpu3/cpufreq entries: %v", got)
+	}
+
+	// Host cpu settings can't be modified.
+	if _, err := h.Write(hdlr, c, 1001, "/sys/devices/system/cpu/cpu1/online", "0"); err == nil {
+		t.Errorf("write of cpu1/online unexpectedly succeeded")
+	}
+	if got := h.HostFile("/sys/devices/system/cpu/cpu1/online"); got != "1\n" {
+		t.Errorf("host cpu1/online = %q", got)
+	}
+}
@@ -206,12 +206,12 @@ func (h *SysDevicesVirtual) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -219,7 +219,7 @@ func (h *SysDevicesVirtual) GetResourcesList() []string {
 	return resources
 }
 
-func (h *SysDevicesVirtual) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *SysDevicesVirtual) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
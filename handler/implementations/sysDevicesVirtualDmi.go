@@ -226,12 +226,12 @@ func (h *SysDevicesVirtualDmi) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		// Resource name must be adjusted to account for the presence of the "dmi"
 		// directory (i.e., ".") as one of the emulated resources.
@@ -245,7 +245,7 @@ func (h *SysDevicesVirtualDmi) GetResourcesList() []string {
 	return resources
 }
 
-func (h *SysDevicesVirtualDmi) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *SysDevicesVirtualDmi) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 
 	// Resource name must be adjusted to account for the possibility of caller asking
 	// for the "dmi" directory itself (i.e., "." resource).
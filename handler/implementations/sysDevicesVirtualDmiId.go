@@ -17,9 +17,11 @@
 package implementations
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -78,6 +80,23 @@ import (
 //
 // 00000000-0000-0000-0000-<sys-cntr-id-03> // no 'product_uuid' found
 //
+// * /sys/devices/virtual/dmi/id/{product,board,chassis}_serial
+// * /sys/devices/virtual/dmi/id/{board,chassis}_asset_tag
+// * /sys/devices/virtual/dmi/id/{sys,board,chassis}_vendor
+//
+// Along the same lines, some applications fingerprint their host out of
+// several DMI fields. These ones are rendered per container out of templates,
+// where "{id}" stands for the (short) container ID and "{host}" for the host's
+// value of the field. By default, serial numbers are unique per container,
+// whereas asset tags and vendors match the host's ones:
+//
+// product_serial: {id}
+// sys_vendor:     {host}
+//
+// Templates can be set daemon-wide (see SetDmiTemplates()) and per container,
+// through the "io.sysbox.fs.dmi.<field>" annotations (e.g.,
+// "io.sysbox.fs.dmi.product_serial=SYSBOX-{id}").
+//
 
 // UUID constants as per rfc/4122
 const (
@@ -88,6 +107,69 @@ const (
 	nodeFieldLen = 12
 )
 
+// Emulated DMI fields along with their default templates.
+var dmiDefaultTemplates = map[string]string{
+	"product_serial":    "{id}",
+	"board_serial":      "{id}",
+	"chassis_serial":    "{id}",
+	"board_asset_tag":   "{host}",
+	"chassis_asset_tag": "{host}",
+	"sys_vendor":        "{host}",
+	"board_vendor":      "{host}",
+	"chassis_vendor":    "{host}",
+}
+
+var (
+	dmiTemplatesMu sync.RWMutex
+	dmiTemplates   = dmiDefaultTemplates
+)
+
+// SetDmiTemplates sets the daemon-wide templates of the emulated DMI fields
+// (indexed by field name). Fields not present keep their default templates.
+func SetDmiTemplates(templates map[string]string) error {
+
+	merged := make(map[string]string, len(dmiDefaultTemplates))
+	for field, tmpl := range dmiDefaultTemplates {
+		merged[field] = tmpl
+	}
+
+	for field, tmpl := range templates {
+		if _, ok := dmiDefaultTemplates[field]; !ok {
+			return fmt.Errorf("DMI field '%v' not supported", field)
+		}
+		merged[field] = tmpl
+	}
+
+	dmiTemplatesMu.Lock()
+	dmiTemplates = merged
+	dmiTemplatesMu.Unlock()
+
+	return nil
+}
+
+// Returns the template of the given DMI field for the given container.
+func dmiTemplate(field string, cntr domain.ContainerIface) string {
+
+	if tmpl, ok := cntr.Annotations()[domain.DmiAnnotationPrefix+field]; ok {
+		return tmpl
+	}
+
+	dmiTemplatesMu.RLock()
+	defer dmiTemplatesMu.RUnlock()
+
+	return dmiTemplates[field]
+}
+
+func dmiFieldResource(mode os.FileMode) *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:     domain.FileEmuResource,
+		Mode:     mode,
+		Size:     4096,
+		Enabled:  true,
+		ReadOnly: true,
+	}
+}
+
 type SysDevicesVirtualDmiId struct {
 	domain.HandlerBase
 }
@@ -104,11 +186,20 @@ var SysDevicesVirtualDmiId_Handler = &SysDevicesVirtualDmiId{
 				Enabled: true,
 			},
 			"product_uuid": {
-				Kind:    domain.FileEmuResource,
-				Mode:    os.FileMode(uint32(0400)),
-				Size:    4096,
-				Enabled: true,
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0400)),
+				Size:     4096,
+				Enabled:  true,
+				ReadOnly: true,
 			},
+			"product_serial":    dmiFieldResource(os.FileMode(uint32(0400))),
+			"board_serial":      dmiFieldResource(os.FileMode(uint32(0400))),
+			"chassis_serial":    dmiFieldResource(os.FileMode(uint32(0400))),
+			"board_asset_tag":   dmiFieldResource(os.FileMode(uint32(0444))),
+			"chassis_asset_tag": dmiFieldResource(os.FileMode(uint32(0444))),
+			"sys_vendor":        dmiFieldResource(os.FileMode(uint32(0444))),
+			"board_vendor":      dmiFieldResource(os.FileMode(uint32(0444))),
+			"chassis_vendor":    dmiFieldResource(os.FileMode(uint32(0444))),
 		},
 	},
 }
@@ -171,18 +262,16 @@ func (h *SysDevicesVirtualDmiId) Open(
 
 	var resource = relpath
 
-	flags := n.OpenFlags()
-
 	switch resource {
 
 	case ".":
 		return nil
 
 	case "product_uuid":
-		if flags&syscall.O_WRONLY == syscall.O_WRONLY ||
-			flags&syscall.O_RDWR == syscall.O_RDWR {
-			return fuse.IOerror{Code: syscall.EACCES}
-		}
+		return nil
+	}
+
+	if _, ok := dmiDefaultTemplates[resource]; ok {
 		return nil
 	}
 
@@ -208,6 +297,10 @@ func (h *SysDevicesVirtualDmiId) Read(
 		return h.readProductUuid(n, req)
 	}
 
+	if _, ok := dmiDefaultTemplates[resource]; ok {
+		return h.readDmiField(n, req)
+	}
+
 	return readHostFs(h, n, req.Offset, &req.Data)
 }
 
@@ -300,12 +393,12 @@ func (h *SysDevicesVirtualDmiId) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		// Resource name must be adjusted to account for the presence of the "id"
 		// directory (i.e., ".") as one of the emulated resources.
@@ -319,7 +412,7 @@ func (h *SysDevicesVirtualDmiId) GetResourcesList() []string {
 	return resources
 }
 
-func (h *SysDevicesVirtualDmiId) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *SysDevicesVirtualDmiId) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 
 	// Resource name must be adjusted to account for the possibility of caller asking
 	// for the "id" directory itself (i.e., "." resource).
@@ -372,6 +465,28 @@ func (h *SysDevicesVirtualDmiId) readProductUuid(
 	return len(req.Data), nil
 }
 
+// Renders the given DMI field out of its template for the requesting container.
+func (h *SysDevicesVirtualDmiId) readDmiField(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	tmpl := dmiTemplate(n.Name(), req.Container)
+
+	var hostVal string
+	if strings.Contains(tmpl, "{host}") {
+		if data, err := n.ReadFile(); err == nil {
+			hostVal = strings.TrimSpace(string(data))
+		}
+	}
+
+	val := strings.NewReplacer(
+		"{id}", formatter.ContainerID{req.Container.ID()}.String(),
+		"{host}", hostVal,
+	).Replace(tmpl)
+
+	return readFromData([]byte(val+"\n"), req)
+}
+
 // Method is public exclusively for unit-testing purposes.
 func (h *SysDevicesVirtualDmiId) CreateCntrUuid(cntr domain.ContainerIface) string {
 
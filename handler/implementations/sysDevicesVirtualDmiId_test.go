@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
 	"github.com/nestybox/sysbox-fs/handler/implementations"
 )
 
@@ -52,6 +53,7 @@ func TestSysDevicesVirtualDmiId_CreateCntrUuid(t *testing.T) {
 			nil,
 			nil,
 			nil,
+			nil,
 		),
 	}
 
@@ -67,6 +69,7 @@ func TestSysDevicesVirtualDmiId_CreateCntrUuid(t *testing.T) {
 			nil,
 			nil,
 			nil,
+			nil,
 		),
 	}
 
@@ -133,3 +136,63 @@ func TestSysDevicesVirtualDmiId_CreateCntrUuid(t *testing.T) {
 		})
 	}
 }
+
+func TestSysDevicesVirtualDmiId_Templates(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysDevicesVirtualDmiId_Handler)
+	hdlr := h.Handler("/sys/devices/virtual/dmi/id")
+
+	h.WriteHostFile("/sys/devices/virtual/dmi/id/product_serial", "HOST-SERIAL-1234\n")
+	h.WriteHostFile("/sys/devices/virtual/dmi/id/sys_vendor", "ACME Corp.\n")
+	h.WriteHostFile("/sys/devices/virtual/dmi/id/board_vendor", "ACME Corp.\n")
+
+	if err := implementations.SetDmiTemplates(map[string]string{
+		"board_vendor": "{host} (virtual)",
+	}); err != nil {
+		t.Fatalf("SetDmiTemplates() failed: %v", err)
+	}
+	defer implementations.SetDmiTemplates(nil)
+
+	if err := implementations.SetDmiTemplates(map[string]string{
+		"bios_vendor": "{host}",
+	}); err == nil {
+		t.Errorf("SetDmiTemplates() accepted an unsupported field")
+	}
+
+	c1 := h.Container("0123456789abcdef", 1001)
+
+	c2 := h.Containers.ContainerCreate(
+		"fedcba9876543210",
+		2001,
+		time.Time{},
+		231072,
+		65535,
+		231072,
+		65535,
+		nil,
+		nil,
+		map[string]string{"io.sysbox.fs.dmi.product_serial": "SYSBOX-{id}"},
+		nil)
+
+	tests := []struct {
+		cntr  domain.ContainerIface
+		pid   uint32
+		field string
+		want  string
+	}{
+		{c1, 1001, "product_serial", "0123456789ab\n"},
+		{c1, 1001, "sys_vendor", "ACME Corp.\n"},
+		{c1, 1001, "board_vendor", "ACME Corp. (virtual)\n"},
+		{c2, 2001, "product_serial", "SYSBOX-fedcba987654\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := h.Read(hdlr, tt.cntr, tt.pid, "/sys/devices/virtual/dmi/id/"+tt.field)
+		if err != nil {
+			t.Fatalf("read of %s failed: %v", tt.field, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s of %s = %q, want %q", tt.field, tt.cntr.ID(), got, tt.want)
+		}
+	}
+}
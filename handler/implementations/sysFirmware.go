@@ -0,0 +1,196 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /sys/firmware handler
+//
+// Emulated resources:
+//
+// * /sys/firmware
+// * /sys/firmware/acpi
+// * /sys/firmware/acpi/tables
+// * /sys/firmware/dmi
+// * /sys/firmware/dmi/entries
+// * /sys/firmware/dmi/tables
+// * /sys/firmware/efi
+// * /sys/firmware/efi/efivars
+//
+// The firmware's data exposed by the host (e.g., ACPI tables, raw DMI entries,
+// EFI variables) must not be accessible from within sys containers, as it
+// uniquely identifies the host and may hold sensitive information. Hence, the
+// /sys/firmware tree is presented as a skeleton of empty directories.
+//
+// As some applications rely on the existence of these directories to find out
+// the platform's features (e.g., the presence of /sys/firmware/efi to tell EFI
+// systems apart), only the ones present in the host are exposed.
+//
+type SysFirmware struct {
+	domain.HandlerBase
+}
+
+var SysFirmware_Handler = &SysFirmware{
+	domain.HandlerBase{
+		Name:    "SysFirmware",
+		Path:    "/sys/firmware",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".":           sysFirmwareDirResource(),
+			"acpi":        sysFirmwareDirResource(),
+			"acpi/tables": sysFirmwareDirResource(),
+			"dmi":         sysFirmwareDirResource(),
+			"dmi/entries": sysFirmwareDirResource(),
+			"dmi/tables":  sysFirmwareDirResource(),
+			"efi":         sysFirmwareDirResource(),
+			"efi/efivars": sysFirmwareDirResource(),
+		},
+	},
+}
+
+func sysFirmwareDirResource() *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:    domain.DirEmuResource,
+		Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+		Enabled: true,
+	}
+}
+
+func (h *SysFirmware) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	resource, ok := h.hostResource(n.Path())
+	if !ok {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	// As the rest of the host's sysfs nodes, the emulated ones show up as
+	// "nobody:nogroup" within the sys container.
+	req.SkipIdRemap = true
+
+	return &domain.FileInfo{
+		Fname:    n.Name(),
+		Fmode:    resource.Mode,
+		FmodTime: time.Now(),
+		FisDir:   true,
+	}, nil
+}
+
+func (h *SysFirmware) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, ok := h.hostResource(n.Path()); !ok {
+		return fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	return nil
+}
+
+func (h *SysFirmware) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	return 0, fuse.IOerror{Code: syscall.EISDIR}
+}
+
+func (h *SysFirmware) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	return 0, fuse.IOerror{Code: syscall.EISDIR}
+}
+
+func (h *SysFirmware) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, ok := h.hostResource(n.Path()); !ok {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	var fileEntries []os.FileInfo
+
+	for k, v := range h.EmuResourceMap {
+		path := filepath.Join(h.Path, k)
+		if k == "." || filepath.Dir(path) != n.Path() {
+			continue
+		}
+
+		if _, ok := h.hostResource(path); !ok {
+			continue
+		}
+
+		fileEntries = append(fileEntries, &domain.FileInfo{
+			Fname:    filepath.Base(k),
+			Fmode:    v.Mode,
+			FmodTime: time.Now(),
+			FisDir:   true,
+		})
+	}
+
+	return fileEntries, nil
+}
+
+// Returns the emulated resource matching the given path, provided that it's
+// present in the host.
+func (h *SysFirmware) hostResource(path string) (*domain.EmuResource, bool) {
+
+	relpath, err := filepath.Rel(h.Path, path)
+	if err != nil {
+		return nil, false
+	}
+
+	resource, ok := h.EmuResourceMap[relpath]
+	if !ok {
+		return nil, false
+	}
+
+	n := h.Service.IOService().NewIOnode(filepath.Base(path), path, 0)
+	if info, err := n.Stat(); err != nil || !info.IsDir() {
+		return nil, false
+	}
+
+	return resource, true
+}
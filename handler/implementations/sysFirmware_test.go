@@ -0,0 +1,67 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysFirmware(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysFirmware_Handler)
+	hdlr := h.Handler("/sys/firmware")
+
+	c := h.Container("c1", 1001)
+
+	// Non-EFI host.
+	h.WriteHostFile("/sys/firmware/acpi/tables/DSDT", "DSDT")
+	h.WriteHostFile("/sys/firmware/dmi/tables/DMI", "DMI")
+	h.WriteHostFile("/sys/firmware/memmap/0/type", "System RAM\n")
+
+	names, err := h.ReadDirAll(hdlr, c, 1001, "/sys/firmware")
+	if err != nil {
+		t.Fatalf("readdir failed: %v", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "acpi" || names[1] != "dmi" {
+		t.Errorf("unexpected entries: %v", names)
+	}
+
+	names, err = h.ReadDirAll(hdlr, c, 1001, "/sys/firmware/acpi/tables")
+	if err != nil || len(names) != 0 {
+		t.Errorf("acpi tables exposed: %v (%v)", names, err)
+	}
+
+	for _, path := range []string{
+		"/sys/firmware/acpi/tables/DSDT",
+		"/sys/firmware/efi",
+		"/sys/firmware/memmap",
+	} {
+		if _, err := h.Lookup(hdlr, c, 1001, path); err == nil {
+			t.Errorf("%s unexpectedly exposed", path)
+		}
+	}
+
+	info, err := h.Lookup(hdlr, c, 1001, "/sys/firmware/dmi/tables")
+	if err != nil || !info.IsDir() {
+		t.Errorf("dmi tables lookup returned (%v, %v)", info, err)
+	}
+}
@@ -0,0 +1,330 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /sys/fs/cgroup handler
+//
+// Exposes the cgroup v2 hierarchy of a sys container rooted at the container's
+// own cgroup (i.e., the root of its cgroup namespace), regardless of the cgroup
+// file-system mounted at /sys/fs/cgroup within the sys container (if any).
+//
+// Nodes are served out of the host's cgroup2 file-system, at the container's
+// cgroup path, be the host a cgroup v2-only one or a hybrid one (where the
+// unified hierarchy is mounted at /sys/fs/cgroup/unified). Consistently with
+// cgroup delegation, the nodes owned by the sys container (i.e., the
+// container's cgroup directory, its cgroup.procs,
+// cgroup.threads and cgroup.subtree_control files, as well as its descendant
+// cgroups) are exposed as such, whereas the remaining ones (e.g., the resource
+// limits imposed on the container's cgroup) are displayed as 'nobody:nogroup'
+// and can't be written. The cgroup.controllers file of the container's cgroup
+// is thereby the one reflecting the controllers delegated to it.
+//
+// The pids listed in the cgroup.procs and cgroup.threads files are translated
+// into the pid namespace of the process accessing them, with the processes
+// outside of it being omitted. Likewise, the pids written into these files are
+// interpreted within the pid namespace of the writer.
+//
+// The container's cgroup path is obtained out of the cgroup membership of the
+// container's init process, as seen from the host and from within the
+// container's cgroup namespace, and is cached for the container's lifetime.
+//
+// Note that the creation and removal of child cgroups isn't served through this
+// handler.
+//
+type SysFsCgroup struct {
+	domain.HandlerBase
+}
+
+var SysFsCgroup_Handler = &SysFsCgroup{
+	domain.HandlerBase{
+		Name:    "SysFsCgroup",
+		Path:    "/sys/fs/cgroup",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+				Enabled: true,
+			},
+		},
+	},
+}
+
+func (h *SysFsCgroup) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	hn, err := h.hostNode(n, req)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := hn.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fi := &domain.FileInfo{
+		Fname:    n.Name(),
+		Fsize:    info.Size(),
+		Fmode:    info.Mode(),
+		FmodTime: info.ModTime(),
+		FisDir:   info.IsDir(),
+	}
+
+	// Nodes delegated to the sys container keep their (host) ownership, which
+	// the kernel displays as the container user owning them; the remaining ones
+	// show up as 'nobody:nogroup'.
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && st != nil {
+		req.SkipIdRemap = true
+		if cgroupNodeDelegated(h, info, req) {
+			fi.Fsys = st
+		}
+	}
+
+	return fi, nil
+}
+
+func (h *SysFsCgroup) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	hn, err := h.hostNode(n, req)
+	if err != nil {
+		return err
+	}
+
+	flags := n.OpenFlags()
+
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		info, err := hn.Stat()
+		if err != nil {
+			return err
+		}
+		if !cgroupNodeDelegated(h, info, req) {
+			return fuse.IOerror{Code: syscall.EACCES}
+		}
+	}
+
+	hn.SetOpenFlags(flags &^ (syscall.O_CREAT | syscall.O_TRUNC))
+	if err := hn.Open(); err != nil {
+		return err
+	}
+	hn.Close()
+
+	return nil
+}
+
+func (h *SysFsCgroup) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	hn, err := h.hostNode(n, req)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := hn.ReadFile()
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.Name() {
+	case "cgroup.procs", "cgroup.threads":
+		data = h.filterCgroupPids(data, req)
+	}
+
+	return readFromData(data, req)
+}
+
+func (h *SysFsCgroup) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	hn, err := h.hostNode(n, req)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := hn.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !cgroupNodeDelegated(h, info, req) {
+		return 0, fuse.IOerror{Code: syscall.EACCES}
+	}
+
+	switch n.Name() {
+	case "cgroup.procs", "cgroup.threads":
+		return h.writeCgroupPids(hn, req)
+	}
+
+	return writeHostFs(h, hn, req.Offset, req.Data)
+}
+
+func (h *SysFsCgroup) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	hn, err := h.hostNode(n, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return hn.ReadDirAll()
+}
+
+// Returns the node of the host's cgroup file-system matching the given one
+// within the sys container's cgroup hierarchy.
+func (h *SysFsCgroup) hostNode(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (domain.IOnodeIface, error) {
+
+	cg, err := cntrCgroupPath(h, req.Container, "")
+	if err != nil {
+		logrus.Errorf("Unable to find the cgroup of container %s: %v",
+			req.Container.ID(), err)
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	relpath, err := filepath.Rel(h.Path, n.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(cg.dir(), relpath)
+
+	return h.Service.IOService().NewIOnode(n.Name(), path, 0), nil
+}
+
+// Translates the (host) pids listed in a cgroup.procs / cgroup.threads file
+// into the pid namespace of the requesting process, omitting the ones outside
+// of it.
+func (h *SysFsCgroup) filterCgroupPids(
+	data []byte,
+	req *domain.HandlerRequest) []byte {
+
+	var buf bytes.Buffer
+
+	level := len(procNsPids(h, req.Pid)) - 1
+	if level < 0 {
+		return nil
+	}
+
+	for _, s := range strings.Fields(string(data)) {
+		pid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			continue
+		}
+
+		nsPids := procNsPids(h, uint32(pid))
+		if len(nsPids) <= level {
+			continue
+		}
+
+		buf.WriteString(nsPids[level] + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+// Writes the given pids into a cgroup.procs / cgroup.threads file from within
+// the pid namespace of the requesting process, for the pids to be interpreted
+// as seen by it.
+func (h *SysFsCgroup) writeCgroupPids(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	nss := h.Service.NSenterService()
+
+	event := nss.NewEvent(
+		req.Pid,
+		&[]domain.NStype{string(domain.NStypePid)},
+		&domain.NSenterMessage{
+			Type: domain.WriteFileRequest,
+			Payload: &domain.WriteFilePayload{
+				File:   n.Path(),
+				Offset: req.Offset,
+				Data:   req.Data,
+			},
+		},
+		nil,
+		false,
+	)
+
+	if err := nss.SendRequestEvent(event); err != nil {
+		return 0, err
+	}
+
+	responseMsg := nss.ReceiveResponseEvent(event)
+	if responseMsg.Type == domain.ErrorResponse {
+		return 0, responseMsg.Payload.(error)
+	}
+
+	return len(req.Data), nil
+}
+
+// Returns true if the given cgroup node is delegated to the sys container (i.e.,
+// it's owned by a user mapped into the user-ns of the process accessing it).
+// Nodes whose ownership can't be determined are considered as such.
+func cgroupNodeDelegated(
+	h domain.HandlerIface,
+	info os.FileInfo,
+	req *domain.HandlerRequest) bool {
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return true
+	}
+
+	prs := h.GetService().ProcessService()
+	process := prs.ProcessCreate(req.Pid, 0, 0)
+
+	_, ok = process.UidFromHost(st.Uid)
+
+	return ok
+}
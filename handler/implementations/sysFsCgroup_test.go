@@ -0,0 +1,125 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysFsCgroup(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysFsCgroup_Handler)
+	hdlr := h.Handler("/sys/fs/cgroup")
+
+	c := h.Container("c1", 1001)
+
+	// The container's init process has moved into a child cgroup of the
+	// container's one.
+	h.WriteHostFile("/proc/1001/cgroup", "0::/sysbox/c1/init.scope\n")
+	h.WriteCntrFile("/proc/1001/cgroup", "0::/init.scope\n")
+
+	h.WriteHostFile("/proc/1001/status", "Name:\tinit\nNSpid:\t1001\t1\n")
+	h.WriteHostFile("/proc/5000/status", "Name:\tnginx\nNSpid:\t5000\t42\n")
+	h.WriteHostFile("/proc/6000/status", "Name:\tdaemon\nNSpid:\t6000\n")
+
+	h.WriteHostFile("/sys/fs/cgroup/cgroup.controllers", "cpuset cpu io memory pids\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/cgroup.controllers", "cpu memory pids\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/cgroup.procs", "5000\n6000\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/init.scope/cgroup.procs", "1001\n")
+
+	for path, want := range map[string]string{
+		"/sys/fs/cgroup/cgroup.controllers":      "cpu memory pids\n",
+		"/sys/fs/cgroup/cgroup.procs":            "42\n",
+		"/sys/fs/cgroup/init.scope/cgroup.procs": "1\n",
+	} {
+		data, err := h.Read(hdlr, c, 1001, path)
+		if err != nil {
+			t.Fatalf("read of %s failed: %v", path, err)
+		}
+		if data != want {
+			t.Errorf("%s = %q, want %q", path, data, want)
+		}
+	}
+
+	names, err := h.ReadDirAll(hdlr, c, 1001, "/sys/fs/cgroup")
+	if err != nil {
+		t.Fatalf("readdir failed: %v", err)
+	}
+	sort.Strings(names)
+	if len(names) != 3 ||
+		names[0] != "cgroup.controllers" ||
+		names[1] != "cgroup.procs" ||
+		names[2] != "init.scope" {
+		t.Errorf("unexpected entries: %v", names)
+	}
+
+	// Pids written into cgroup.procs are interpreted within the writer's pid
+	// namespace.
+	h.NSenter.On(domain.WriteFileRequest,
+		func(pid uint32, req *domain.NSenterMessage) *domain.NSenterMessage {
+			return &domain.NSenterMessage{Type: domain.WriteFileResponse}
+		})
+	h.NSenter.Reset()
+
+	if _, err := h.Write(hdlr, c, 1001, "/sys/fs/cgroup/cgroup.procs", "42\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	reqs := h.NSenter.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d nsenter requests, want 1", len(reqs))
+	}
+	p, ok := reqs[0].Payload.(*domain.WriteFilePayload)
+	if !ok || p.File != "/sys/fs/cgroup/sysbox/c1/cgroup.procs" {
+		t.Errorf("unexpected nsenter request: %+v", reqs[0])
+	}
+}
+
+func TestSysFsCgroupHybrid(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysFsCgroup_Handler)
+	hdlr := h.Handler("/sys/fs/cgroup")
+
+	c := h.Container("c2", 2001)
+
+	// Hybrid host: the unified hierarchy is mounted at /sys/fs/cgroup/unified.
+	h.WriteHostFile("/proc/2001/cgroup",
+		"4:memory:/sysbox/c2\n1:name=systemd:/sysbox/c2\n0::/sysbox/c2\n")
+	h.WriteCntrFile("/proc/2001/cgroup",
+		"4:memory:/\n1:name=systemd:/\n0::/\n")
+
+	h.WriteHostFile("/sys/fs/cgroup/unified/sysbox/c2/cgroup.controllers", "\n")
+	h.WriteHostFile("/sys/fs/cgroup/memory/sysbox/c2/memory.limit_in_bytes", "1073741824\n")
+
+	data, err := h.Read(hdlr, c, 2001, "/sys/fs/cgroup/cgroup.controllers")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if data != "\n" {
+		t.Errorf("cgroup.controllers = %q, want %q", data, "\n")
+	}
+
+	// cgroup v1 files aren't exposed.
+	if _, err := h.Read(hdlr, c, 2001, "/sys/fs/cgroup/memory.limit_in_bytes"); err == nil {
+		t.Errorf("read of a cgroup v1 file unexpectedly succeeded")
+	}
+}
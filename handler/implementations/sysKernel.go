@@ -42,7 +42,7 @@ import (
 // Emulated resources:
 //
 // * /sys/kernel/config
-// * /sys/kernel/debug
+// * /sys/kernel/debug (served by the SysKernelDebug handler)
 // * /sys/kernel/tracing
 //
 // Finally, notice that unlike the procSys handler, we don't rely on the
@@ -128,8 +128,6 @@ func (h *SysKernel) Open(
 	switch resource {
 	case "config":
 		return nil
-	case "debug":
-		return nil
 	case "tracing":
 		return nil
 	}
@@ -154,8 +152,6 @@ func (h *SysKernel) Read(
 	switch resource {
 	case "config":
 		return 0, nil
-	case "debug":
-		return 0, nil
 	case "tracing":
 		return 0, nil
 	}
@@ -249,12 +245,12 @@ func (h *SysKernel) GetResourcesList() []string {
 	var resources []string
 
 	for resourceKey, resource := range h.EmuResourceMap {
-		resource.Mutex.Lock()
+		resource.Mutex.RLock()
 		if !resource.Enabled {
-			resource.Mutex.Unlock()
+			resource.Mutex.RUnlock()
 			continue
 		}
-		resource.Mutex.Unlock()
+		resource.Mutex.RUnlock()
 
 		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
 	}
@@ -262,7 +258,7 @@ func (h *SysKernel) GetResourcesList() []string {
 	return resources
 }
 
-func (h *SysKernel) GetResourceMutex(n domain.IOnodeIface) *sync.Mutex {
+func (h *SysKernel) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
 	resource, ok := h.EmuResourceMap[n.Name()]
 	if !ok {
 		return nil
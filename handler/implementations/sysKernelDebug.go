@@ -0,0 +1,209 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /sys/kernel/debug handler
+//
+// Debugfs is exposed within sys containers as an empty directory, unless some
+// of its nodes are explicitly allow-listed for a given container, in which case
+// these ones (and their descendants) are served out of the host's debugfs. This
+// allows, for example, tracing-based tooling (e.g., eBPF tools relying on the
+// tracing interface) to run within a sys container without exposing the rest of
+// the host's debugfs.
+//
+// Nodes are allow-listed per container through the resource policy annotations
+// (see domain.ParseAnnotations), by explicitly setting the "enabled" or
+// "read-only" policies on them:
+//
+// * io.sysbox.fs.sysfs.kernel.debug.tracing=enabled
+//
+// Notice that setting these policies on /sys/kernel/debug itself exposes the
+// whole host's debugfs.
+//
+type SysKernelDebug struct {
+	domain.HandlerBase
+}
+
+var SysKernelDebug_Handler = &SysKernelDebug{
+	domain.HandlerBase{
+		Name:    "SysKernelDebug",
+		Path:    "/sys/kernel/debug",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0700)),
+				Enabled: true,
+			},
+		},
+	},
+}
+
+func (h *SysKernelDebug) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if n.Path() == h.Path {
+		resource := h.EmuResourceMap["."]
+
+		return &domain.FileInfo{
+			Fname:    n.Name(),
+			Fmode:    resource.Mode,
+			FmodTime: time.Now(),
+			FisDir:   true,
+		}, nil
+	}
+
+	if !h.allowed(n.Path(), req.Container) {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	return n.Stat()
+}
+
+func (h *SysKernelDebug) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if n.Path() == h.Path {
+		return nil
+	}
+
+	if !h.allowed(n.Path(), req.Container) {
+		return fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	if err := n.Open(); err != nil {
+		return err
+	}
+	n.Close()
+
+	return nil
+}
+
+func (h *SysKernelDebug) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if n.Path() == h.Path {
+		return 0, nil
+	}
+
+	if !h.allowed(n.Path(), req.Container) {
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	return readHostFs(h, n, req.Offset, &req.Data)
+}
+
+func (h *SysKernelDebug) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if n.Path() == h.Path {
+		return 0, fuse.IOerror{Code: syscall.EISDIR}
+	}
+
+	if !h.allowed(n.Path(), req.Container) {
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	return writeHostFs(h, n, req.Offset, req.Data)
+}
+
+func (h *SysKernelDebug) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if n.Path() != h.Path && !h.allowed(n.Path(), req.Container) {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	entries, err := n.ReadDirAll()
+	if err != nil {
+		// Debugfs may not be mounted in the host.
+		if n.Path() == h.Path {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Only the allow-listed entries of debugfs' root are listed.
+	var res []os.FileInfo
+	for _, info := range entries {
+		if h.allowed(filepath.Join(n.Path(), info.Name()), req.Container) {
+			res = append(res, info)
+		}
+	}
+
+	return res, nil
+}
+
+// Returns true if the given debugfs node has been allow-listed for the given
+// sys container, i.e., if the container's annotations explicitly expose the
+// node or any of its debugfs ancestors.
+func (h *SysKernelDebug) allowed(path string, cntr domain.ContainerIface) bool {
+
+	if cntr == nil {
+		return false
+	}
+
+	policies, _, _ := domain.ParseAnnotations(cntr.Annotations())
+	if len(policies) == 0 {
+		return false
+	}
+
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if policy, ok := policies[dir]; ok {
+			return policy == domain.ResourcePolicyExpose ||
+				policy == domain.ResourcePolicyReadOnly
+		}
+		if dir == h.Path || dir == "/" {
+			break
+		}
+	}
+
+	return false
+}
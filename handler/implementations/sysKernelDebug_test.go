@@ -0,0 +1,81 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysKernelDebug(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysKernelDebug_Handler)
+	hdlr := h.Handler("/sys/kernel/debug")
+
+	h.WriteHostFile("/sys/kernel/debug/tracing/trace", "# tracer: nop\n")
+	h.WriteHostFile("/sys/kernel/debug/dri/0/name", "i915\n")
+
+	c1 := h.Container("c1", 1001)
+
+	c2 := h.Containers.ContainerCreate(
+		"c2",
+		2001,
+		time.Time{},
+		231072,
+		65535,
+		231072,
+		65535,
+		nil,
+		nil,
+		map[string]string{"io.sysbox.fs.sysfs.kernel.debug.tracing": "enabled"},
+		nil)
+
+	// Debugfs is empty by default.
+	names, err := h.ReadDirAll(hdlr, c1, 1001, "/sys/kernel/debug")
+	if err != nil || len(names) != 0 {
+		t.Errorf("c1: unexpected entries: %v (%v)", names, err)
+	}
+	if _, err := h.Lookup(hdlr, c1, 1001, "/sys/kernel/debug/tracing"); err == nil {
+		t.Errorf("c1: tracing dir unexpectedly exposed")
+	}
+
+	// Only the allow-listed nodes are exposed.
+	names, err = h.ReadDirAll(hdlr, c2, 2001, "/sys/kernel/debug")
+	if err != nil || len(names) != 1 || names[0] != "tracing" {
+		t.Errorf("c2: unexpected entries: %v (%v)", names, err)
+	}
+	if _, err := h.Lookup(hdlr, c2, 2001, "/sys/kernel/debug/dri"); err == nil {
+		t.Errorf("c2: dri dir unexpectedly exposed")
+	}
+
+	// Host debugfs nodes are read in place (short reads being flagged with
+	// io.EOF), as some of them (e.g., trace_pipe) are streams.
+	req := h.Request(c2, 2001)
+	req.Data = make([]byte, 4096)
+
+	sz, err := hdlr.Read(h.Node("/sys/kernel/debug/tracing/trace"), req)
+	if err != nil && err != io.EOF {
+		t.Fatalf("c2: read failed: %v", err)
+	}
+	if got := string(req.Data[:sz]); got != "# tracer: nop\n" {
+		t.Errorf("c2: trace = %q", got)
+	}
+}
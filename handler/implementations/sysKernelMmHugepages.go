@@ -0,0 +1,415 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /sys/kernel/mm/hugepages handler
+//
+// Emulated resources (per hugepage size):
+//
+// * /sys/kernel/mm/hugepages/hugepages-<size>kB/nr_hugepages
+// * /sys/kernel/mm/hugepages/hugepages-<size>kB/free_hugepages
+//
+// Hugepage consumers (e.g., DPDK, databases) size their pools out of the
+// number of hugepages reserved in the system, which within a sys container is
+// bounded by the container's hugetlb cgroup limits rather than by the host's
+// reservations. Hence, the hugepages count of each size is presented as the
+// container's hugetlb allowance (i.e., the lowest hugetlb.<size>.max limit
+// along the container's cgroup path, or hugetlb.<size>.limit_in_bytes one on
+// cgroup v1 hosts), or as the host's count if no limit is set. The number of
+// free hugepages is reported accordingly, as per the container's hugetlb
+// usage.
+//
+// Writes into nr_hugepages adjust the emulated count (bounded by the
+// container's allowance), leaving the host's reservations untouched. The
+// emulated count is shared with /proc/sys/vm/nr_hugepages for the default
+// hugepage size (see ProcSysVmNrHugepages handler).
+//
+// The rest of the nodes are served out of the host's sysfs, and show up as
+// 'nobody:nogroup' within the sys container.
+//
+
+const hugepagesPath = "/sys/kernel/mm/hugepages"
+
+type SysKernelMmHugepages struct {
+	domain.HandlerBase
+}
+
+var SysKernelMmHugepages_Handler = &SysKernelMmHugepages{
+	domain.HandlerBase{
+		Name:    "SysKernelMmHugepages",
+		Path:    hugepagesPath,
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			"nr_hugepages": {
+				Kind:    domain.FileEmuResource,
+				Mode:    os.FileMode(uint32(0644)),
+				Size:    4096,
+				Enabled: true,
+			},
+			"free_hugepages": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Size:     4096,
+				Enabled:  true,
+				ReadOnly: true,
+			},
+		},
+	},
+}
+
+func (h *SysKernelMmHugepages) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if resource, _, ok := h.emuResource(n); ok {
+		return &domain.FileInfo{
+			Fname:    n.Name(),
+			Fsize:    resource.Size,
+			Fmode:    resource.Mode,
+			FmodTime: time.Now(),
+		}, nil
+	}
+
+	// As the rest of the host's sysfs nodes, the non-emulated ones show up as
+	// "nobody:nogroup" within the sys container.
+	req.SkipIdRemap = true
+
+	return n.Stat()
+}
+
+func (h *SysKernelMmHugepages) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, _, ok := h.emuResource(n); ok {
+		return nil
+	}
+
+	if err := n.Open(); err != nil {
+		return err
+	}
+	n.Close()
+
+	return nil
+}
+
+func (h *SysKernelMmHugepages) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	_, size, ok := h.emuResource(n)
+	if !ok {
+		return readHostFs(h, n, req.Offset, &req.Data)
+	}
+
+	var (
+		val uint64
+		err error
+	)
+
+	switch n.Name() {
+	case "nr_hugepages":
+		val, err = cntrNrHugepages(h, req.Container, size)
+	case "free_hugepages":
+		val, err = cntrFreeHugepages(h, req.Container, size)
+	}
+
+	if err != nil {
+		logrus.Errorf("Unable to obtain %s for container %s: %v",
+			n.Path(), req.Container.ID(), err)
+		return 0, fuse.IOerror{Code: syscall.EIO}
+	}
+
+	return readFromData([]byte(strconv.FormatUint(val, 10)+"\n"), req)
+}
+
+func (h *SysKernelMmHugepages) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, size, ok := h.emuResource(n); ok && n.Name() == "nr_hugepages" {
+		if err := setCntrNrHugepages(h, req.Container, size, req.Data); err != nil {
+			return 0, err
+		}
+		return len(req.Data), nil
+	}
+
+	// The host's hugepages settings are not to be modified from within sys
+	// containers.
+	return 0, fuse.IOerror{Code: syscall.EACCES}
+}
+
+func (h *SysKernelMmHugepages) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	return n.ReadDirAll()
+}
+
+// Returns the emulated resource matching the given node, along with the
+// hugepage size (in kB) it refers to.
+func (h *SysKernelMmHugepages) emuResource(
+	n domain.IOnodeIface) (*domain.EmuResource, uint64, bool) {
+
+	dir := filepath.Dir(n.Path())
+	if filepath.Dir(dir) != h.Path {
+		return nil, 0, false
+	}
+
+	resource, ok := h.EmuResourceMap[n.Name()]
+	if !ok {
+		return nil, 0, false
+	}
+
+	var size uint64
+	if _, err := fmt.Sscanf(filepath.Base(dir), "hugepages-%dkB", &size); err != nil {
+		return nil, 0, false
+	}
+
+	return resource, size, true
+}
+
+// Returns the path of the nr_hugepages file of the given hugepage size (in kB),
+// which is also the key of the container data holding the emulated count.
+func nrHugepagesPath(size uint64) string {
+	return fmt.Sprintf("%s/hugepages-%dkB/nr_hugepages", hugepagesPath, size)
+}
+
+// Returns the default hugepage size (in kB), as per the host's /proc/meminfo.
+func defaultHugepageSize(h domain.HandlerIface) (uint64, error) {
+
+	data, err := readHostFile(h, "/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "Hugepagesize:" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("no hugepage size found in /proc/meminfo")
+}
+
+// Returns the name the hugetlb controller gives to the given hugepage size (in
+// kB) within its interface files (e.g., "2MB" in hugetlb.2MB.max).
+func hugetlbSizeName(size uint64) string {
+
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%dGB", size>>20)
+	case size >= 1<<10:
+		return fmt.Sprintf("%dMB", size>>10)
+	}
+
+	return fmt.Sprintf("%dKB", size)
+}
+
+// Limit reported by the cgroup v1 hugetlb controller when no limit is set
+// (i.e., the page-aligned LONG_MAX); cgroup v2 reports "max" instead.
+const hugetlbV1Unlimited = 1 << 62
+
+// Returns the name of the hugetlb controller's interface file holding the limit
+// ("max") or the usage ("current") of the hugepages of the given size (in kB),
+// as per the cgroup version of the given hierarchy.
+func hugetlbFile(cg cntrCgroup, size uint64, kind string) string {
+
+	if cg.v1 {
+		switch kind {
+		case "max":
+			kind = "limit_in_bytes"
+		case "current":
+			kind = "usage_in_bytes"
+		}
+	}
+
+	return fmt.Sprintf("hugetlb.%s.%s", hugetlbSizeName(size), kind)
+}
+
+// Returns the number of hugepages of the given size (in kB) the given sys
+// container is allowed to use as per its hugetlb cgroup limits, or false if
+// no limit applies.
+func hugetlbAllowance(
+	h domain.HandlerIface,
+	cntr domain.ContainerIface,
+	size uint64) (uint64, bool) {
+
+	cg, err := cntrCgroupPath(h, cntr, "hugetlb")
+	if err != nil {
+		logrus.Debugf("Unable to find the cgroup of container %s: %v",
+			cntr.ID(), err)
+		return 0, false
+	}
+
+	file := hugetlbFile(cg, size, "max")
+
+	var (
+		allowance uint64
+		limited   bool
+	)
+
+	// The container's limit may be tighter at any of its ancestor cgroups.
+	for dir := cg.path; ; dir = filepath.Dir(dir) {
+		val, err := readHostUint(h, filepath.Join(cg.root, dir, file))
+		if err == nil && val < hugetlbV1Unlimited {
+			pages := val / (size * 1024)
+			if !limited || pages < allowance {
+				allowance = pages
+				limited = true
+			}
+		}
+
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+
+	return allowance, limited
+}
+
+// Returns the number of hugepages of the given size (in kB) presented to the
+// given sys container.
+func cntrNrHugepages(
+	h domain.HandlerIface,
+	cntr domain.ContainerIface,
+	size uint64) (uint64, error) {
+
+	path := nrHugepagesPath(size)
+	allowance, limited := hugetlbAllowance(h, cntr, size)
+
+	var nr uint64
+
+	data := make([]byte, 4096)
+	if sz, _ := cntr.Data(path, 0, &data); sz > 0 {
+		val, err := strconv.ParseUint(strings.TrimSpace(string(data[:sz])), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		nr = val
+
+	} else if limited {
+		nr = allowance
+
+	} else {
+		val, err := readHostUint(h, path)
+		if err != nil {
+			return 0, err
+		}
+		nr = val
+	}
+
+	// The allowance may have shrunk since the count was set.
+	if limited && nr > allowance {
+		nr = allowance
+	}
+
+	return nr, nil
+}
+
+// Returns the number of free hugepages of the given size (in kB) presented to
+// the given sys container, i.e., the ones of its count not in use by it (and
+// available in the host).
+func cntrFreeHugepages(
+	h domain.HandlerIface,
+	cntr domain.ContainerIface,
+	size uint64) (uint64, error) {
+
+	nr, err := cntrNrHugepages(h, cntr, size)
+	if err != nil {
+		return 0, err
+	}
+
+	var used uint64
+	if cg, err := cntrCgroupPath(h, cntr, "hugetlb"); err == nil {
+		file := hugetlbFile(cg, size, "current")
+		if val, err := readHostUint(h, filepath.Join(cg.dir(), file)); err == nil {
+			used = val / (size * 1024)
+		}
+	}
+
+	free := uint64(0)
+	if nr > used {
+		free = nr - used
+	}
+
+	path := fmt.Sprintf("%s/hugepages-%dkB/free_hugepages", hugepagesPath, size)
+	if hostFree, err := readHostUint(h, path); err == nil && hostFree < free {
+		free = hostFree
+	}
+
+	return free, nil
+}
+
+// Sets the number of hugepages of the given size (in kB) presented to the given
+// sys container, bounded by the container's allowance.
+func setCntrNrHugepages(
+	h domain.HandlerIface,
+	cntr domain.ContainerIface,
+	size uint64,
+	data []byte) error {
+
+	nr, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return fuse.IOerror{Code: syscall.EINVAL}
+	}
+
+	if allowance, limited := hugetlbAllowance(h, cntr, size); limited && nr > allowance {
+		nr = allowance
+	}
+
+	cntr.Lock()
+	defer cntr.Unlock()
+
+	if err := cntr.SetData(nrHugepagesPath(size), 0, []byte(strconv.FormatUint(nr, 10))); err != nil {
+		return fuse.IOerror{Code: syscall.EINVAL}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysKernelMmHugepages(t *testing.T) {
+
+	h := handlertest.New(t,
+		implementations.ProcSysVmNrHugepages_Handler,
+		implementations.SysKernelMmHugepages_Handler)
+
+	sysHdlr := h.Handler("/sys/kernel/mm/hugepages")
+	procHdlr := h.Handler("/proc/sys/vm/nr_hugepages")
+
+	const (
+		nr2M   = "/sys/kernel/mm/hugepages/hugepages-2048kB/nr_hugepages"
+		free2M = "/sys/kernel/mm/hugepages/hugepages-2048kB/free_hugepages"
+		nr1G   = "/sys/kernel/mm/hugepages/hugepages-1048576kB/nr_hugepages"
+		nrProc = "/proc/sys/vm/nr_hugepages"
+	)
+
+	h.WriteHostFile("/proc/meminfo", "MemTotal:       16384000 kB\nHugepagesize:       2048 kB\n")
+	h.WriteHostFile(nr2M, "1024\n")
+	h.WriteHostFile(free2M, "1000\n")
+	h.WriteHostFile(nr1G, "4\n")
+
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/proc/1001/cgroup", "0::/sysbox/c1\n")
+	h.WriteCntrFile("/proc/1001/cgroup", "0::/\n")
+
+	// 512 2MB-hugepages allowed, 100 of them in use. No limit on 1GB ones.
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/hugetlb.2MB.max", "max\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/hugetlb.2MB.max", "1073741824\n")
+	h.WriteHostFile("/sys/fs/cgroup/sysbox/c1/hugetlb.2MB.current", "209715200\n")
+
+	check := func(hdlr domain.HandlerIface, path, want string) {
+		t.Helper()
+
+		got, err := h.Read(hdlr, c, 1001, path)
+		if err != nil {
+			t.Fatalf("read of %s failed: %v", path, err)
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+
+	check(sysHdlr, nr2M, "512\n")
+	check(sysHdlr, free2M, "412\n")
+	check(sysHdlr, nr1G, "4\n")
+	check(procHdlr, nrProc, "512\n")
+
+	// Writes adjust the count shared by both views, within the allowance.
+	if _, err := h.Write(procHdlr, c, 1001, nrProc, "128\n"); err != nil {
+		t.Fatalf("write of %s failed: %v", nrProc, err)
+	}
+	check(sysHdlr, nr2M, "128\n")
+	check(sysHdlr, free2M, "28\n")
+
+	if _, err := h.Write(sysHdlr, c, 1001, nr2M, "4096\n"); err != nil {
+		t.Fatalf("write of %s failed: %v", nr2M, err)
+	}
+	check(procHdlr, nrProc, "512\n")
+
+	if _, err := h.Write(sysHdlr, c, 1001, nr2M, "lots\n"); err == nil {
+		t.Errorf("invalid write of %s unexpectedly succeeded", nr2M)
+	}
+	if _, err := h.Write(sysHdlr, c, 1001, free2M, "0\n"); err == nil {
+		t.Errorf("write of %s unexpectedly succeeded", free2M)
+	}
+
+	// The host's hugepages pool is left untouched.
+	if got := h.HostFile(nr2M); got != "1024\n" {
+		t.Errorf("host %s = %q", nr2M, got)
+	}
+}
+
+func TestSysKernelMmHugepagesCgroupV1(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysKernelMmHugepages_Handler)
+	hdlr := h.Handler("/sys/kernel/mm/hugepages")
+
+	const (
+		nr2M   = "/sys/kernel/mm/hugepages/hugepages-2048kB/nr_hugepages"
+		free2M = "/sys/kernel/mm/hugepages/hugepages-2048kB/free_hugepages"
+	)
+
+	h.WriteHostFile("/proc/meminfo", "MemTotal:       16384000 kB\nHugepagesize:       2048 kB\n")
+	h.WriteHostFile(nr2M, "1024\n")
+	h.WriteHostFile(free2M, "1000\n")
+
+	c := h.Container("c2", 2001)
+
+	h.WriteHostFile("/proc/2001/cgroup", "7:hugetlb:/sysbox/c2\n0::/sysbox/c2\n")
+	h.WriteCntrFile("/proc/2001/cgroup", "7:hugetlb:/\n0::/\n")
+
+	// 256 2MB-hugepages allowed, 6 of them in use; no limit at the root.
+	h.WriteHostFile("/sys/fs/cgroup/hugetlb/hugetlb.2MB.limit_in_bytes", "9223372036854771712\n")
+	h.WriteHostFile("/sys/fs/cgroup/hugetlb/sysbox/c2/hugetlb.2MB.limit_in_bytes", "536870912\n")
+	h.WriteHostFile("/sys/fs/cgroup/hugetlb/sysbox/c2/hugetlb.2MB.usage_in_bytes", "12582912\n")
+
+	for path, want := range map[string]string{
+		nr2M:   "256\n",
+		free2M: "250\n",
+	} {
+		got, err := h.Read(hdlr, c, 2001, path)
+		if err != nil {
+			t.Fatalf("read of %s failed: %v", path, err)
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// /sys/kernel/security handler
+//
+// Emulated resources:
+//
+// * /sys/kernel/security
+// * /sys/kernel/security/lsm
+// * /sys/kernel/security/apparmor
+// * /sys/kernel/security/ima
+//
+// Securityfs exposes the configuration of the host's Linux Security Modules
+// (LSMs), which doesn't necessarily apply to the processes of a sys container
+// (e.g., an AppArmor-enabled host running an unconfined sys container). Inner
+// security agents relying on it would then wrongly conclude that they are
+// subject to (or in charge of) the host's LSM policies.
+//
+// Hence, securityfs is presented as a virtual tree made of:
+//
+// * An "lsm" file listing the LSMs actually enforced for the sys container:
+//   the host's ones, except for the "major" LSMs (e.g., apparmor, selinux),
+//   which are only listed if the container's init process is confined by them.
+//
+// * Empty "apparmor" and "ima" directories, exposed only if AppArmor is
+//   enforced for the sys container and IMA is present in the host,
+//   respectively.
+//
+// The rest of the host's securityfs nodes are hidden.
+//
+type SysKernelSecurity struct {
+	domain.HandlerBase
+}
+
+var SysKernelSecurity_Handler = &SysKernelSecurity{
+	domain.HandlerBase{
+		Name:    "SysKernelSecurity",
+		Path:    "/sys/kernel/security",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			".": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+				Enabled: true,
+			},
+			"lsm": {
+				Kind:     domain.FileEmuResource,
+				Mode:     os.FileMode(uint32(0444)),
+				Size:     4096,
+				Enabled:  true,
+				ReadOnly: true,
+			},
+			"apparmor": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+				Enabled: true,
+			},
+			"ima": {
+				Kind:    domain.DirEmuResource,
+				Mode:    os.ModeDir | os.FileMode(uint32(0755)),
+				Enabled: true,
+			},
+		},
+	},
+}
+
+// LSMs whose enforcement depends on the security context of each process, as
+// opposed to the ones that apply system-wide (e.g., capability, yama).
+var majorLsms = map[string]bool{
+	"apparmor": true,
+	"selinux":  true,
+	"smack":    true,
+	"tomoyo":   true,
+}
+
+func (h *SysKernelSecurity) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	resource, ok := h.cntrResource(n.Path(), req.Container)
+	if !ok {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	return &domain.FileInfo{
+		Fname:    n.Name(),
+		Fsize:    resource.Size,
+		Fmode:    resource.Mode,
+		FmodTime: time.Now(),
+		FisDir:   resource.Kind == domain.DirEmuResource,
+	}, nil
+}
+
+func (h *SysKernelSecurity) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, ok := h.cntrResource(n.Path(), req.Container); !ok {
+		return fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	return nil
+}
+
+func (h *SysKernelSecurity) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	resource, ok := h.cntrResource(n.Path(), req.Container)
+	if !ok {
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+	}
+	if resource.Kind == domain.DirEmuResource {
+		return 0, fuse.IOerror{Code: syscall.EISDIR}
+	}
+
+	lsms := h.cntrLsms(req.Container)
+
+	return readFromData([]byte(strings.Join(lsms, ",")), req)
+}
+
+func (h *SysKernelSecurity) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	resource, ok := h.cntrResource(n.Path(), req.Container)
+	if !ok {
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+	}
+	if resource.Kind == domain.DirEmuResource {
+		return 0, fuse.IOerror{Code: syscall.EISDIR}
+	}
+
+	return 0, fuse.IOerror{Code: syscall.EACCES}
+}
+
+func (h *SysKernelSecurity) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, ok := h.cntrResource(n.Path(), req.Container); !ok {
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+	}
+
+	// The emulated directories beneath the root are empty.
+	if n.Path() != h.Path {
+		return nil, nil
+	}
+
+	var fileEntries []os.FileInfo
+
+	for k, v := range h.EmuResourceMap {
+		if k == "." {
+			continue
+		}
+
+		if _, ok := h.cntrResource(filepath.Join(h.Path, k), req.Container); !ok {
+			continue
+		}
+
+		fileEntries = append(fileEntries, &domain.FileInfo{
+			Fname:    k,
+			Fsize:    v.Size,
+			Fmode:    v.Mode,
+			FmodTime: time.Now(),
+			FisDir:   v.Kind == domain.DirEmuResource,
+		})
+	}
+
+	return fileEntries, nil
+}
+
+// Returns the emulated resource matching the given path, provided that it's
+// exposed to the given sys container.
+func (h *SysKernelSecurity) cntrResource(
+	path string,
+	cntr domain.ContainerIface) (*domain.EmuResource, bool) {
+
+	relpath, err := filepath.Rel(h.Path, path)
+	if err != nil {
+		return nil, false
+	}
+
+	resource, ok := h.EmuResourceMap[relpath]
+	if !ok {
+		return nil, false
+	}
+
+	switch relpath {
+	case "apparmor":
+		for _, lsm := range h.cntrLsms(cntr) {
+			if lsm == "apparmor" {
+				return resource, true
+			}
+		}
+		return nil, false
+
+	case "ima":
+		n := h.Service.IOService().NewIOnode(filepath.Base(path), path, 0)
+		if info, err := n.Stat(); err != nil || !info.IsDir() {
+			return nil, false
+		}
+	}
+
+	return resource, true
+}
+
+// Returns the LSMs enforced for the given sys container, in the order listed
+// by the host.
+func (h *SysKernelSecurity) cntrLsms(cntr domain.ContainerIface) []string {
+
+	ios := h.Service.IOService()
+
+	path := filepath.Join(h.Path, "lsm")
+	data, err := ios.NewIOnode(filepath.Base(path), path, 0).ReadFile()
+	if err != nil {
+		// Securityfs may not be mounted in the host.
+		return []string{"capability"}
+	}
+
+	// The security context of the container's init process tells whether it's
+	// confined by a major LSM (e.g., "docker-default (enforce)" vs
+	// "unconfined").
+	var confined bool
+	if cntr != nil {
+		path = fmt.Sprintf("/proc/%d/attr/current", cntr.InitPid())
+		label, err := ios.NewIOnode(filepath.Base(path), path, 0).ReadFile()
+		if err == nil {
+			l := strings.TrimSpace(strings.TrimRight(string(label), "\x00"))
+			confined = l != "" && l != "unconfined"
+		}
+	}
+
+	var lsms []string
+	for _, lsm := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		if lsm == "" || (majorLsms[lsm] && !confined) {
+			continue
+		}
+		lsms = append(lsms, lsm)
+	}
+
+	return lsms
+}
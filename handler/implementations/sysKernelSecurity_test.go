@@ -0,0 +1,89 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysKernelSecurity(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysKernelSecurity_Handler)
+	hdlr := h.Handler("/sys/kernel/security")
+
+	h.WriteHostFile("/sys/kernel/security/lsm", "lockdown,capability,yama,apparmor")
+	h.WriteHostFile("/sys/kernel/security/ima/policy", "")
+	h.WriteHostFile("/sys/kernel/security/tpm0/binary_bios_measurements", "")
+	h.WriteHostFile("/proc/1001/attr/current", "unconfined\n")
+	h.WriteHostFile("/proc/2001/attr/current", "docker-default (enforce)\n")
+
+	c1 := h.Container("c1", 1001)
+	c2 := h.Container("c2", 2001)
+
+	// Unlike c2, c1 isn't confined by AppArmor.
+	tests := []struct {
+		name    string
+		cntr    domain.ContainerIface
+		pid     uint32
+		lsm     string
+		entries []string
+	}{
+		{"c1", c1, 1001, "lockdown,capability,yama", []string{"ima", "lsm"}},
+		{"c2", c2, 2001, "lockdown,capability,yama,apparmor", []string{"apparmor", "ima", "lsm"}},
+	}
+
+	for _, tt := range tests {
+		got, err := h.Read(hdlr, tt.cntr, tt.pid, "/sys/kernel/security/lsm")
+		if err != nil {
+			t.Fatalf("%s: read of lsm failed: %v", tt.name, err)
+		}
+		if got != tt.lsm {
+			t.Errorf("%s: lsm = %q, want %q", tt.name, got, tt.lsm)
+		}
+
+		names, err := h.ReadDirAll(hdlr, tt.cntr, tt.pid, "/sys/kernel/security")
+		if err != nil {
+			t.Fatalf("%s: readdir failed: %v", tt.name, err)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(tt.entries, ",") {
+			t.Errorf("%s: entries = %v, want %v", tt.name, names, tt.entries)
+		}
+	}
+
+	// The host's securityfs nodes are hidden.
+	if _, err := h.Lookup(hdlr, c1, 1001, "/sys/kernel/security/tpm0"); err == nil {
+		t.Errorf("tpm0 dir unexpectedly exposed")
+	}
+	if _, err := h.Lookup(hdlr, c1, 1001, "/sys/kernel/security/apparmor"); err == nil {
+		t.Errorf("c1: apparmor dir unexpectedly exposed")
+	}
+	names, err := h.ReadDirAll(hdlr, c1, 1001, "/sys/kernel/security/ima")
+	if err != nil || len(names) != 0 {
+		t.Errorf("c1: unexpected ima entries: %v (%v)", names, err)
+	}
+
+	if _, err := h.Write(hdlr, c2, 2001, "/sys/kernel/security/lsm", "selinux"); err == nil {
+		t.Errorf("write of lsm unexpectedly succeeded")
+	}
+}
@@ -0,0 +1,116 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// /sys/power handler
+//
+// Emulated resources:
+//
+// * /sys/power/state
+// * /sys/power/disk
+// * /sys/power/mem_sleep
+// * /sys/power/pm_async
+// * /sys/power/pm_freeze_timeout
+// * /sys/power/image_size
+// * /sys/power/reserved_size
+// * /sys/power/resume
+// * /sys/power/sync_on_suspend
+// * /sys/power/wakeup_count
+// * /sys/power/autosleep
+// * /sys/power/wake_lock
+// * /sys/power/wake_unlock
+//
+// These files control the system-wide power management (i.e., suspend /
+// hibernation) as well as the wakeup sources of the host, so they must not be
+// alterable from within sys containers. Yet, as power-management daemons
+// (e.g., systemd-logind, upower) usually probe and write them during
+// initialization, failing these operations is not an option either.
+//
+// Hence, these files are presented as no-ops: reads return the host's values
+// (or nothing for those absent in the host), whereas writes are accepted but
+// discarded. Notice that the ACPI wakeup controls under /proc/acpi are already
+// masked within sys containers.
+//
+type SysPower struct {
+	domain.HandlerBase
+}
+
+var SysPower_Handler = &SysPower{
+	domain.HandlerBase{
+		Name:    "SysPower",
+		Path:    "/sys/power",
+		Enabled: true,
+		EmuResourceMap: map[string]*domain.EmuResource{
+			"state":             sysPowerResource(),
+			"disk":              sysPowerResource(),
+			"mem_sleep":         sysPowerResource(),
+			"pm_async":          sysPowerResource(),
+			"pm_freeze_timeout": sysPowerResource(),
+			"image_size":        sysPowerResource(),
+			"reserved_size":     sysPowerResource(),
+			"resume":            sysPowerResource(),
+			"sync_on_suspend":   sysPowerResource(),
+			"wakeup_count":      sysPowerResource(),
+			"autosleep":         sysPowerResource(),
+			"wake_lock":         sysPowerResource(),
+			"wake_unlock":       sysPowerResource(),
+		},
+	},
+}
+
+func sysPowerResource() *domain.EmuResource {
+	return &domain.EmuResource{
+		Kind:    domain.FileEmuResource,
+		Mode:    os.FileMode(uint32(0644)),
+		Enabled: true,
+		Read:    readSysPower,
+		Write:   writeSysPower,
+	}
+}
+
+func readSysPower(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	sz, err := readFs(h, n, req.Offset, &req.Data)
+	if err != nil && os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	return sz, err
+}
+
+func writeSysPower(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Ignoring write of %q into %s for container %s",
+		req.Data, n.Path(), req.Container.ID())
+
+	return len(req.Data), nil
+}
@@ -0,0 +1,53 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysPower(t *testing.T) {
+
+	h := handlertest.New(t, implementations.SysPower_Handler)
+	hdlr := h.Handler("/sys/power")
+
+	c := h.Container("c1", 1001)
+
+	h.WriteHostFile("/sys/power/state", "freeze mem disk\n")
+
+	// Writes are accepted but don't reach the host.
+	n, err := h.Write(hdlr, c, 1001, "/sys/power/state", "mem\n")
+	if err != nil || n != 4 {
+		t.Fatalf("write returned (%d, %v)", n, err)
+	}
+	if got := h.HostFile("/sys/power/state"); got != "freeze mem disk\n" {
+		t.Errorf("host state altered: %q", got)
+	}
+
+	if _, err := h.Write(hdlr, c, 1001, "/sys/power/wakeup_count", "12\n"); err != nil {
+		t.Errorf("wakeup_count write failed: %v", err)
+	}
+
+	// Files absent in the host read as empty.
+	data, err := h.Read(hdlr, c, 1001, "/sys/power/autosleep")
+	if err != nil || data != "" {
+		t.Errorf("autosleep = (%q, %v)", data, err)
+	}
+}
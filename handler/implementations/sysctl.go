@@ -0,0 +1,334 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Generic sysctl handler.
+//
+// Most of the /proc/sys handlers boil down to serving a few sysctls with the
+// same logic: values are read from the host on first access, cached within the
+// container, and writes are validated and then recorded within the container
+// (optionally pushed down to the host if they exceed the host's value). This
+// handler implements that logic once, so that new sysctl emulations can be
+// defined as data (see SysctlSpec) rather than as full-blown handlers.
+//
+// Entries not declared in the handler's specs are passed through.
+//
+
+// SysctlType is the type of a sysctl's value.
+type SysctlType int
+
+const (
+	SysctlInt SysctlType = iota
+	SysctlString
+)
+
+// SysctlWrite defines how writes of a sysctl are propagated to the host.
+type SysctlWrite int
+
+const (
+	SysctlWriteLocal SysctlWrite = iota // container-local; host left untouched
+	SysctlWriteMax                      // pushed to host if greater than host's value
+	SysctlWriteMin                      // pushed to host if lower than host's value
+)
+
+// SysctlSpec declares a sysctl emulated by a SysctlHandler.
+type SysctlSpec struct {
+	// Name of the sysctl node, relative to the handler's path.
+	Name string
+
+	// Type of the sysctl's value.
+	Type SysctlType
+
+	// Range of accepted values (inclusive) for integer sysctls. Ignored if
+	// Min >= Max.
+	Min, Max int
+
+	// Schema of the accepted values, for values other than plain integers
+	// (e.g., enums, int pairs).
+	Schema domain.ValueSchema
+
+	// Initial value of the sysctl for sys containers, to be utilized when the
+	// sysctl is not present on the host (e.g., kernel module not loaded).
+	Default string
+
+	// Namespaced sysctls are already namespaced by the kernel, so these are
+	// passed through to the container's namespaces.
+	Namespaced bool
+
+	// Write propagation policy.
+	Write SysctlWrite
+
+	// Node's permissions (0644 if unset).
+	Mode os.FileMode
+}
+
+type SysctlHandler struct {
+	domain.HandlerBase
+	Specs map[string]*SysctlSpec
+}
+
+// NewSysctlHandler returns a handler emulating the given sysctls under path.
+func NewSysctlHandler(name, path string, specs []SysctlSpec) *SysctlHandler {
+
+	h := &SysctlHandler{
+		HandlerBase: domain.HandlerBase{
+			Name:           name,
+			Path:           path,
+			Enabled:        true,
+			EmuResourceMap: make(map[string]*domain.EmuResource),
+		},
+		Specs: make(map[string]*SysctlSpec),
+	}
+
+	for i := range specs {
+		spec := specs[i]
+		if spec.Mode == 0 {
+			spec.Mode = os.FileMode(uint32(0644))
+		}
+
+		// Writes' validation is left to the handler service, which enforces
+		// the capabilities of the emulated resources.
+		resource := &domain.EmuResource{
+			Kind:       domain.FileEmuResource,
+			Mode:       spec.Mode,
+			Enabled:    true,
+			ReadOnly:   spec.Mode&0222 == 0,
+			Schema:     spec.Schema,
+			Namespaced: spec.Namespaced,
+		}
+		if spec.Type == SysctlInt {
+			resource.Range = &domain.EmuResourceRange{
+				Min: math.MinInt64,
+				Max: math.MaxInt64,
+			}
+			if spec.Min < spec.Max {
+				resource.Range.Min = int64(spec.Min)
+				resource.Range.Max = int64(spec.Max)
+			}
+		}
+
+		h.Specs[spec.Name] = &spec
+		h.EmuResourceMap[spec.Name] = resource
+	}
+
+	return h
+}
+
+// Returns the spec of the emulated (i.e., non-namespaced) sysctl matching the
+// given node, if any.
+func (h *SysctlHandler) spec(n domain.IOnodeIface) (*SysctlSpec, bool) {
+
+	if filepath.Dir(n.Path()) != h.Path {
+		return nil, false
+	}
+
+	spec, ok := h.Specs[n.Name()]
+	if !ok || spec.Namespaced {
+		return nil, false
+	}
+
+	return spec, true
+}
+
+func (h *SysctlHandler) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	logrus.Debugf("Executing Lookup() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	// Return an artificial fileInfo if looked-up element matches any of the
+	// emulated nodes.
+	if spec, ok := h.spec(n); ok {
+		info := &domain.FileInfo{
+			Fname:    spec.Name,
+			Fmode:    spec.Mode,
+			FmodTime: time.Now(),
+		}
+
+		return info, nil
+	}
+
+	return h.Service.GetPassThroughHandler().Lookup(n, req)
+}
+
+func (h *SysctlHandler) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	logrus.Debugf("Executing Open() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	if _, ok := h.spec(n); ok {
+		return nil
+	}
+
+	return h.Service.GetPassThroughHandler().Open(n, req)
+}
+
+func (h *SysctlHandler) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Read() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	spec, ok := h.spec(n)
+	if !ok {
+		return h.Service.GetPassThroughHandler().Read(n, req)
+	}
+
+	// Sysctls missing on the host are served out of their default value.
+	if spec.Default != "" {
+		if _, err := n.Stat(); os.IsNotExist(err) {
+			return readCntrDefault(n, req, spec.Default)
+		}
+	}
+
+	return readCntrData(h, n, req)
+}
+
+func (h *SysctlHandler) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	logrus.Debugf("Executing Write() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	spec, ok := h.spec(n)
+	if !ok {
+		return h.Service.GetPassThroughHandler().Write(n, req)
+	}
+
+	var pushToFs func(currData, newData []byte) (bool, error)
+
+	switch spec.Write {
+	case SysctlWriteMax:
+		pushToFs = writeMaxIntToFs
+	case SysctlWriteMin:
+		pushToFs = writeMinIntToFs
+	}
+
+	// Sysctls missing on the host can't be pushed down to it.
+	if pushToFs != nil && spec.Default != "" {
+		if _, err := n.Stat(); os.IsNotExist(err) {
+			pushToFs = nil
+		}
+	}
+
+	return writeCntrData(h, n, req, pushToFs)
+}
+
+func (h *SysctlHandler) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	logrus.Debugf("Executing ReadDirAll() for req-id: %#x, handler: %s, resource: %s",
+		req.ID, h.Name, n.Name())
+
+	// Obtain the usual entries seen within container's namespaces. These are
+	// fetched in the background while the emulated ones are collected.
+	usualEntries := readDirAllAsync(h, n, req)
+
+	var fileEntries []os.FileInfo
+
+	// Sysctls missing on the host (i.e., with a default value) are listed
+	// along with the usual entries.
+	if n.Path() == h.Path {
+		for _, spec := range h.Specs {
+			if spec.Namespaced || spec.Default == "" {
+				continue
+			}
+
+			info := &domain.FileInfo{
+				Fname:    spec.Name,
+				Fmode:    spec.Mode,
+				FmodTime: time.Now(),
+			}
+
+			fileEntries = append(fileEntries, info)
+		}
+	}
+
+	// Add the usual entries seen within container's namespaces to the emulated
+	// ones.
+	return mergeDirEntries(fileEntries, usualEntries()), nil
+}
+
+func (h *SysctlHandler) GetName() string {
+	return h.Name
+}
+
+func (h *SysctlHandler) GetPath() string {
+	return h.Path
+}
+
+func (h *SysctlHandler) GetService() domain.HandlerServiceIface {
+	return h.Service
+}
+
+func (h *SysctlHandler) GetEnabled() bool {
+	return h.Enabled
+}
+
+func (h *SysctlHandler) SetEnabled(b bool) {
+	h.Enabled = b
+}
+
+func (h *SysctlHandler) GetResourcesList() []string {
+
+	var resources []string
+
+	for resourceKey, resource := range h.EmuResourceMap {
+		resource.Mutex.RLock()
+		if !resource.Enabled {
+			resource.Mutex.RUnlock()
+			continue
+		}
+		resource.Mutex.RUnlock()
+
+		resources = append(resources, filepath.Join(h.GetPath(), resourceKey))
+	}
+
+	return resources
+}
+
+func (h *SysctlHandler) GetResourceMutex(n domain.IOnodeIface) *sync.RWMutex {
+	resource, ok := h.EmuResourceMap[n.Name()]
+	if !ok {
+		return nil
+	}
+
+	return &resource.Mutex
+}
+
+func (h *SysctlHandler) SetService(hs domain.HandlerServiceIface) {
+	h.Service = hs
+}
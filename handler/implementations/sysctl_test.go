@@ -0,0 +1,82 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package implementations_test
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/fuse"
+	"github.com/nestybox/sysbox-fs/handler/handlertest"
+	"github.com/nestybox/sysbox-fs/handler/implementations"
+)
+
+func TestSysctlHandler(t *testing.T) {
+
+	sysctl := implementations.NewSysctlHandler(
+		"ProcSysTest",
+		"/proc/sys/test",
+		[]implementations.SysctlSpec{
+			{
+				Name:  "knob",
+				Type:  implementations.SysctlInt,
+				Min:   0,
+				Max:   10,
+				Write: implementations.SysctlWriteMax,
+			},
+			{
+				Name:    "missing",
+				Type:    implementations.SysctlInt,
+				Default: "7",
+			},
+		},
+	)
+
+	h := handlertest.New(t, sysctl)
+	c := h.Container("c1", 1001)
+
+	// Writes' validation is enforced by the handler service.
+	hdlr := h.Handler("/proc/sys/test/knob")
+
+	h.WriteHostFile("/proc/sys/test/knob", "3\n")
+
+	if data, err := h.Read(hdlr, c, 1001, "/proc/sys/test/knob"); err != nil || data != "3\n" {
+		t.Fatalf("Read() = %q, %v; want %q", data, err, "3\n")
+	}
+
+	// Values above the host's one are pushed down to it.
+	if _, err := h.Write(hdlr, c, 1001, "/proc/sys/test/knob", "5\n"); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	if data, _ := h.Read(hdlr, c, 1001, "/proc/sys/test/knob"); data != "5\n" {
+		t.Errorf("Read() = %q; want %q", data, "5\n")
+	}
+	if data := h.HostFile("/proc/sys/test/knob"); data != "5\n" {
+		t.Errorf("host value = %q; want %q", data, "5\n")
+	}
+
+	// Out of range values are rejected.
+	_, err := h.Write(hdlr, c, 1001, "/proc/sys/test/knob", "11\n")
+	if ioErr, ok := err.(fuse.IOerror); !ok || ioErr.Code != syscall.EINVAL {
+		t.Errorf("Write() error = %v; want EINVAL", err)
+	}
+
+	// Sysctls missing on the host are served out of their default value.
+	if data, err := h.Read(hdlr, c, 1001, "/proc/sys/test/missing"); err != nil || data != "7\n" {
+		t.Errorf("Read() = %q, %v; want %q", data, err, "7\n")
+	}
+}
@@ -18,9 +18,11 @@ package implementations
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -39,11 +41,12 @@ func readCntrData(
 	cntr := req.Container
 	path := n.Path()
 
-	cntr.Lock()
-	defer cntr.Unlock()
-
 	// Check if this resource is cached for this container. If it isn't, fetch
 	// its data from the host FS and cache it within the container struct.
+	//
+	// Notice that the container lock is not held while accessing the host FS,
+	// so that reads of other resources within this container don't serialize
+	// behind this one.
 
 	sz, err := cntr.Data(path, req.Offset, &req.Data)
 	if err != nil && err != io.EOF {
@@ -61,6 +64,17 @@ func readCntrData(
 			return 0, nil
 		}
 
+		cntr.Lock()
+		defer cntr.Unlock()
+
+		// If the resource has been cached in the meantime (i.e., by a concurrent
+		// write), the cached value prevails over the one just read.
+		cached := make([]byte, len(req.Data))
+		if csz, _ := cntr.Data(path, req.Offset, &cached); csz > 0 {
+			req.Data = cached
+			return csz, nil
+		}
+
 		err = cntr.SetData(path, req.Offset, req.Data[0:sz])
 		if err != nil {
 			return 0, fuse.IOerror{Code: syscall.EINVAL}
@@ -80,8 +94,19 @@ func writeCntrData(
 	path := n.Path()
 	ignoreFsErrors := h.GetService().IgnoreErrors()
 
-	cntr.Lock()
-	defer cntr.Unlock()
+	// Writers of the same resource are serialized through the per-resource
+	// lock, which is held until the container's data is updated, so that this
+	// one matches the last value pushed to the host FS. See writeFs() for
+	// details.
+	resourceMutex := h.GetResourceMutex(n)
+
+	if resourceMutex == nil {
+		logrus.Errorf("Unexpected error: no mutex found for emulated resource %s",
+			n.Path())
+		return 0, errors.New("no mutex found for emulated resource")
+	}
+	resourceMutex.Lock()
+	defer resourceMutex.Unlock()
 
 	sz, err := writeFs(h, n, req.Offset, req.Data, pushToFs)
 
@@ -95,6 +120,9 @@ func writeCntrData(
 		return 0, err
 	}
 
+	cntr.Lock()
+	defer cntr.Unlock()
+
 	err = cntr.SetData(path, req.Offset, req.Data)
 	if err != nil {
 		return 0, fuse.IOerror{Code: syscall.EINVAL}
@@ -103,6 +131,79 @@ func writeCntrData(
 	return sz, nil
 }
 
+// Serves the given resource out of the container's data, initialized with the
+// given default value. Meant for resources that may be missing on the host
+// (e.g., kernel module not loaded, or kernel config option not set).
+func readCntrDefault(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest,
+	def string) (int, error) {
+
+	cntr := req.Container
+	path := n.Path()
+
+	cntr.Lock()
+	defer cntr.Unlock()
+
+	// As values are newline terminated, nothing is read at offset 0 only if the
+	// value is not set yet.
+	sz, _ := cntr.Data(path, req.Offset, &req.Data)
+	if sz == 0 && req.Offset == 0 {
+		if err := cntr.SetData(path, 0, []byte(def+"\n")); err != nil {
+			return 0, fuse.IOerror{Code: syscall.EINVAL}
+		}
+		sz, _ = cntr.Data(path, req.Offset, &req.Data)
+	}
+
+	return sz, nil
+}
+
+// Returns a read hook (see domain.EmuResourceHook) serving the resource as
+// readCntrData() does, or out of the given default value if the resource is
+// missing on the host.
+func readCntrDataOrDefault(def string) domain.EmuResourceHook {
+
+	return func(
+		h domain.HandlerIface,
+		n domain.IOnodeIface,
+		req *domain.HandlerRequest) (int, error) {
+
+		if _, err := n.Stat(); os.IsNotExist(err) {
+			return readCntrDefault(n, req, def)
+		}
+
+		return readCntrData(h, n, req)
+	}
+}
+
+// Write hooks of emulated resources (see domain.EmuResourceHook). Written values
+// are recorded within the container, and only pushed to the host FS if they're
+// greater (writeCntrDataMax) or lower (writeCntrDataMin) than the host's one.
+
+func writeCntrDataLocal(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	return writeCntrData(h, n, req, nil)
+}
+
+func writeCntrDataMax(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	return writeCntrData(h, n, req, writeMaxIntToFs)
+}
+
+func writeCntrDataMin(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	return writeCntrData(h, n, req, writeMinIntToFs)
+}
+
 // readFs reads data from the given IO node.
 func readFs(
 	h domain.HandlerIface,
@@ -111,7 +212,8 @@ func readFs(
 	data *[]byte) (int, error) {
 
 	// We need the per-resource lock since we are about to access the resource
-	// on the host FS. See writeFs() for a full explanation.
+	// on the host FS. See writeFs() for a full explanation. The lock is held in
+	// shared mode, so concurrent reads of the resource don't serialize.
 	resourceMutex := h.GetResourceMutex(n)
 
 	if resourceMutex == nil {
@@ -119,8 +221,8 @@ func readFs(
 			n.Path())
 		return 0, errors.New("no mutex found for emulated resource")
 	}
-	resourceMutex.Lock()
-	defer resourceMutex.Unlock()
+	resourceMutex.RLock()
+	defer resourceMutex.RUnlock()
 
 	// Read from the host FS to extract the existing value.
 	if err := n.Open(); err != nil {
@@ -166,10 +268,27 @@ func readHostFs(
 	return sz, err
 }
 
+// readFromData serves the given read request out of the given (emulated) file
+// contents, honoring the request's offset and size.
+func readFromData(data []byte, req *domain.HandlerRequest) (int, error) {
+
+	if req.Offset >= int64(len(data)) {
+		return 0, io.EOF
+	}
+
+	data = data[req.Offset:]
+	if len(data) > len(req.Data) {
+		data = data[:len(req.Data)]
+	}
+	req.Data = data
+
+	return len(req.Data), nil
+}
+
 // writeFs writes the given data to the given IO node. argument 'wrCondition'
 // is a function that the caller can pass to determine if the write should
 // actually happen given the IO node's current and new data. If set to nil
-// the write is skipped.
+// the write is skipped. The caller must hold the node's per-resource lock.
 func writeFs(
 	h domain.HandlerIface,
 	n domain.IOnodeIface,
@@ -181,9 +300,9 @@ func writeFs(
 		return len(data), nil
 	}
 
-	// We need the per-resource lock since we are about to access the resource
-	// on the host FS and multiple sys containers could be accessing that same
-	// resource concurrently.
+	// We need the per-resource lock (acquired by the caller in exclusive mode)
+	// since we are about to access the resource on the host FS and multiple sys
+	// containers could be accessing that same resource concurrently.
 	//
 	// But that's not sufficient. Some users may deploy sysbox inside a
 	// privileged container, and thus can have multiple sysbox instances running
@@ -207,16 +326,6 @@ func writeFs(
 	// agents that write to the same sysctl. That's because there is no guarantee
 	// that the other host agent will read-after-write and retry as sysbox does.
 
-	resourceMutex := h.GetResourceMutex(n)
-
-	if resourceMutex == nil {
-		logrus.Errorf("Unexpected error: no mutex found for emulated resource %s",
-			n.Path())
-		return 0, errors.New("no mutex found for emulated resource")
-	}
-	resourceMutex.Lock()
-	defer resourceMutex.Unlock()
-
 	n.SetOpenFlags(int(os.O_RDWR))
 	if err := n.Open(); err != nil {
 		return 0, err
@@ -225,7 +334,9 @@ func writeFs(
 
 	retries := 5
 	retryDelay := 100 // microsecs
-	currData := make([]byte, 65536, 65536)
+	buf := domain.GetBuffer(65536)
+	defer domain.PutBuffer(buf)
+	currData := *buf
 
 	for i := 0; i < retries; i++ {
 
@@ -332,22 +443,6 @@ func writeMinIntToFs(curr, new []byte) (bool, error) {
 	return newInt < currInt, nil
 }
 
-// checkIntRange interprets the given data as an integer and checks if it's
-// within the given range (inclusive).
-func checkIntRange(data []byte, min, max int) bool {
-	str := strings.TrimSpace(string(data))
-	val, err := strconv.Atoi(str)
-	if err != nil {
-		return false
-	}
-
-	if val < min || val > max {
-		return false
-	}
-
-	return true
-}
-
 func padRight(str, pad string, length int) string {
 	for {
 		str += pad
@@ -365,3 +460,258 @@ func padLeft(str, pad string, length int) string {
 		}
 	}
 }
+
+// readDirAllAsync fetches the usual entries of the given directory, as seen
+// within the container's namespaces, through the pass-through handler. As this
+// involves an nsenter round-trip, entries are fetched in the background, so
+// that handlers can meanwhile collect their emulated entries. The returned
+// function waits for the fetched entries (nil upon error).
+func readDirAllAsync(
+	h domain.HandlerIface,
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) func() []os.FileInfo {
+
+	ch := make(chan []os.FileInfo, 1)
+
+	go func() {
+		entries, err := h.GetService().GetPassThroughHandler().ReadDirAll(n, req)
+		if err != nil {
+			entries = nil
+		}
+		ch <- entries
+	}()
+
+	return func() []os.FileInfo {
+		return <-ch
+	}
+}
+
+// mergeDirEntries adds the usual entries of a directory to its emulated ones,
+// skipping the usual entries shadowed by emulated ones.
+func mergeDirEntries(emulated, usual []os.FileInfo) []os.FileInfo {
+
+	if len(emulated) == 0 {
+		return usual
+	}
+	if len(usual) == 0 {
+		return emulated
+	}
+
+	return domain.FileInfoSliceUniquify(append(emulated, usual...))
+}
+
+// cntrCpus returns the CPUs the given container is allowed to run on, as per
+// its init process' affinity (i.e., the container's cpuset).
+func cntrCpus(
+	h domain.HandlerIface,
+	cntr domain.ContainerIface) (map[int]bool, error) {
+
+	path := fmt.Sprintf("/proc/%d/status", cntr.InitPid())
+	n := h.GetService().IOService().NewIOnode(filepath.Base(path), path, 0)
+
+	data, err := n.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "Cpus_allowed_list:") {
+			return parseCpuList(strings.TrimPrefix(line, "Cpus_allowed_list:"))
+		}
+	}
+
+	return nil, fmt.Errorf("no cpus found in %s", path)
+}
+
+// procNsPids returns the pids of the given (host) process within each of the
+// pid namespaces it's part of (outermost first), as per its NSpid status entry.
+func procNsPids(h domain.HandlerIface, pid uint32) []string {
+
+	path := fmt.Sprintf("/proc/%d/status", pid)
+	n := h.GetService().IOService().NewIOnode(filepath.Base(path), path, 0)
+
+	data, err := n.ReadFile()
+	if err != nil {
+		return nil
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "NSpid:") {
+			return strings.Fields(strings.TrimPrefix(line, "NSpid:"))
+		}
+	}
+
+	return nil
+}
+
+// Host's cgroup mountpoint, which also prefixes the keys of the container data
+// holding the container's cgroups.
+const cgroupfsPath = domain.CgroupMountpoint
+
+// Cgroup of a sys container within one of the host's cgroup hierarchies.
+type cntrCgroup struct {
+	root string // host mountpoint of the hierarchy
+	path string // container's cgroup, relative to the hierarchy's root
+	v1   bool   // cgroup v1 hierarchy
+}
+
+// Returns the host path of the container's cgroup.
+func (cg cntrCgroup) dir() string {
+	return filepath.Join(cg.root, cg.path)
+}
+
+// cntrCgroupPath returns the cgroup of the given sys container within the host
+// hierarchy the given controller is attached to (or within the unified one,
+// for an empty controller), as obtained out of the cgroup membership of its
+// init process (seen from the host and from within the container's cgroup
+// namespace). The cgroup backend (v1, hybrid or v2-only) is thereby picked per
+// container. The result is cached within the container.
+func cntrCgroupPath(
+	h domain.HandlerIface,
+	cntr domain.ContainerIface,
+	controller string) (cntrCgroup, error) {
+
+	key := fmt.Sprintf("%s:%s", cgroupfsPath, controller)
+
+	data := make([]byte, 4096)
+	if sz, _ := cntr.Data(key, 0, &data); sz > 0 {
+		fields := strings.SplitN(string(data[:sz]), "\n", 2)
+		if len(fields) == 2 {
+			return cntrCgroup{
+				root: fields[0],
+				path: fields[1],
+				v1: fields[0] != domain.CgroupMountpoint &&
+					fields[0] != domain.CgroupUnifiedMountpoint,
+			}, nil
+		}
+	}
+
+	path := fmt.Sprintf("/proc/%d/cgroup", cntr.InitPid())
+
+	// Init process' cgroups as seen from the host.
+	prs := h.GetService().ProcessService()
+	cgroups, err := prs.ProcessCreate(cntr.InitPid(), 0, 0).Cgroups()
+	if err != nil {
+		return cntrCgroup{}, err
+	}
+
+	// Init process' cgroups as seen within the container's cgroup namespace.
+	cntrData, err := fetchCntrCgroup(h, cntr, path)
+	if err != nil {
+		return cntrCgroup{}, err
+	}
+
+	hostM, root, ok := domain.LookupCgroup(cgroups, controller)
+	if !ok {
+		return cntrCgroup{}, fmt.Errorf("no cgroup found for controller %q in %s",
+			controller, path)
+	}
+	cntrM, _, ok := domain.LookupCgroup(domain.ParseCgroupMemberships(cntrData), controller)
+	if !ok || cntrM.Hierarchy != hostM.Hierarchy {
+		return cntrCgroup{}, fmt.Errorf("no cgroup found for controller %q in %s (within container)",
+			controller, path)
+	}
+
+	// The container's cgroup is the one the init process' cgroup is relative
+	// to within the container's cgroup namespace.
+	hostCg, cntrCg := hostM.Path, cntrM.Path
+	if cntrCg != "/" {
+		if !strings.HasSuffix(hostCg, cntrCg) {
+			return cntrCgroup{}, fmt.Errorf("unexpected cgroup %s (%s within container)",
+				hostCg, cntrCg)
+		}
+		hostCg = strings.TrimSuffix(hostCg, cntrCg)
+	}
+	if hostCg == "" {
+		hostCg = "/"
+	}
+
+	if err := cntr.SetData(key, 0, []byte(root+"\n"+hostCg)); err != nil {
+		return cntrCgroup{}, err
+	}
+
+	return cntrCgroup{root: root, path: hostCg, v1: !hostM.Unified()}, nil
+}
+
+// Reads the given file within the cgroup namespace of the given sys container.
+func fetchCntrCgroup(
+	h domain.HandlerIface,
+	cntr domain.ContainerIface,
+	path string) ([]byte, error) {
+
+	nss := h.GetService().NSenterService()
+
+	event := nss.NewEvent(
+		cntr.InitPid(),
+		&[]domain.NStype{string(domain.NStypeCgroup)},
+		&domain.NSenterMessage{
+			Type: domain.ReadFileRequest,
+			Payload: &domain.ReadFilePayload{
+				File:   path,
+				Offset: 0,
+				Len:    4096,
+			},
+		},
+		nil,
+		false,
+	)
+
+	if err := nss.SendRequestEvent(event); err != nil {
+		return nil, err
+	}
+
+	responseMsg := nss.ReceiveResponseEvent(event)
+	if responseMsg.Type == domain.ErrorResponse {
+		return nil, responseMsg.Payload.(error)
+	}
+
+	return responseMsg.Payload.([]byte), nil
+}
+
+// readHostFile returns the contents of the given host file.
+func readHostFile(h domain.HandlerIface, path string) ([]byte, error) {
+	n := h.GetService().IOService().NewIOnode(filepath.Base(path), path, 0)
+	return n.ReadFile()
+}
+
+// readHostUint returns the unsigned integer held by the given host file.
+func readHostUint(h domain.HandlerIface, path string) (uint64, error) {
+
+	data, err := readHostFile(h, path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// parseCpuList parses a cpu list (e.g., "0-2,4").
+func parseCpuList(s string) (map[int]bool, error) {
+
+	cpus := make(map[int]bool)
+
+	for _, r := range strings.Split(strings.TrimSpace(s), ",") {
+		if r == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(r, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %q", s)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil || last < first {
+				return nil, fmt.Errorf("invalid cpu list %q", s)
+			}
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			cpus[cpu] = true
+		}
+	}
+
+	return cpus, nil
+}
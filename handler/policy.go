@@ -0,0 +1,344 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+//
+// Resource policies DB. Policies are indexed by resource path, and apply to
+// the resource itself as well as to all of its descendants (i.e., the most
+// specific policy wins).
+//
+// Label-scoped policies only apply to the containers carrying their labels,
+// and take precedence over the rest. If several label-scoped sets match a
+// container, the first one defining a policy for the resource wins.
+//
+type policyDB struct {
+	tree    *iradix.Tree
+	labeled []labeledPolicyDB
+}
+
+type labeledPolicyDB struct {
+	policies *domain.LabeledResourcePolicies
+	db       *policyDB
+}
+
+func newPolicyDB(
+	policies map[string]domain.ResourcePolicy,
+	labeled []domain.LabeledResourcePolicies) *policyDB {
+
+	tree := iradix.New()
+
+	for path, policy := range policies {
+		tree, _, _ = tree.Insert([]byte(filepath.Clean(path)), policy)
+	}
+
+	db := &policyDB{tree: tree}
+
+	for i := range labeled {
+		db.labeled = append(db.labeled, labeledPolicyDB{
+			policies: &labeled[i],
+			db:       newPolicyDB(labeled[i].Policies, nil),
+		})
+	}
+
+	return db
+}
+
+// Returns the policy applying to the given path.
+func (db *policyDB) lookup(path string) domain.ResourcePolicy {
+
+	policy, _ := db.find(path)
+
+	return policy
+}
+
+// Returns the policy applying to the given path for a container carrying the
+// given labels.
+func (db *policyDB) lookupLabeled(
+	path string,
+	labels map[string]string) domain.ResourcePolicy {
+
+	for _, l := range db.labeled {
+		if !l.policies.Matches(labels) {
+			continue
+		}
+		if policy, ok := l.db.find(path); ok {
+			return policy
+		}
+	}
+
+	return db.lookup(path)
+}
+
+// Returns the policy applying to the given path, if any.
+func (db *policyDB) find(path string) (domain.ResourcePolicy, bool) {
+
+	var (
+		policy = domain.ResourcePolicyExpose
+		found  bool
+	)
+
+	// Walk all the policy paths that are a prefix of the given one, making
+	// sure that only full path components are matched.
+	db.tree.Root().WalkPath([]byte(path), func(k []byte, v interface{}) bool {
+		key := string(k)
+		if key == path || key == "/" || strings.HasPrefix(path, key+"/") {
+			policy = v.(domain.ResourcePolicy)
+			found = true
+		}
+		return false
+	})
+
+	return policy, found
+}
+
+//
+// policyHandler decorates handlers to enforce the resource policies defined by
+// the user, either daemon-wide (config file), per container label (config
+// file) or per-container (annotations), with the latter taking precedence.
+//
+type policyHandler struct {
+	domain.HandlerIface
+	policies *policyDB
+}
+
+// Returns the policy applying to the given path for the container being served.
+func (h *policyHandler) policy(
+	path string,
+	req *domain.HandlerRequest) domain.ResourcePolicy {
+
+	return h.containerPolicy(path, req.Container)
+}
+
+// Returns the policy applying to the given path within the given container (if
+// any).
+func (h *policyHandler) containerPolicy(
+	path string,
+	cntr domain.ContainerIface) domain.ResourcePolicy {
+
+	if cntr != nil {
+		if policy, ok := cntr.ResourcePolicy(path); ok {
+			return policy
+		}
+		if len(h.policies.labeled) > 0 {
+			return h.policies.lookupLabeled(path, cntr.Metadata().Labels)
+		}
+	}
+
+	return h.policies.lookup(path)
+}
+
+// Returns true if the given path has been remounted read-only within the
+// container being served.
+func (h *policyHandler) readOnly(path string, req *domain.HandlerRequest) bool {
+	return req.Container != nil && req.Container.IsReadOnlyPath(path)
+}
+
+func (h *policyHandler) passThrough() domain.HandlerIface {
+	return h.HandlerIface.GetService().GetPassThroughHandler()
+}
+
+func (h *policyHandler) Lookup(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (os.FileInfo, error) {
+
+	switch h.policy(n.Path(), req) {
+
+	case domain.ResourcePolicyHide:
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+
+	case domain.ResourcePolicyPassthrough:
+		return h.passThrough().Lookup(n, req)
+
+	case domain.ResourcePolicyReadOnly:
+		info, err := h.HandlerIface.Lookup(n, req)
+		if err != nil {
+			return nil, err
+		}
+		return readOnlyFileInfo{info}, nil
+	}
+
+	return h.HandlerIface.Lookup(n, req)
+}
+
+func (h *policyHandler) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	switch h.policy(n.Path(), req) {
+
+	case domain.ResourcePolicyHide:
+		return fuse.IOerror{Code: syscall.ENOENT}
+
+	case domain.ResourcePolicyPassthrough:
+		return h.passThrough().Open(n, req)
+
+	case domain.ResourcePolicyReadOnly:
+		flags := n.OpenFlags()
+		if flags&syscall.O_WRONLY == syscall.O_WRONLY ||
+			flags&syscall.O_RDWR == syscall.O_RDWR {
+			return fuse.IOerror{Code: syscall.EACCES}
+		}
+	}
+
+	if h.readOnly(n.Path(), req) {
+		flags := n.OpenFlags()
+		if flags&syscall.O_WRONLY == syscall.O_WRONLY ||
+			flags&syscall.O_RDWR == syscall.O_RDWR {
+			return fuse.IOerror{Code: syscall.EROFS}
+		}
+	}
+
+	return h.HandlerIface.Open(n, req)
+}
+
+func (h *policyHandler) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	switch h.policy(n.Path(), req) {
+
+	case domain.ResourcePolicyHide:
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+
+	case domain.ResourcePolicyPassthrough:
+		return h.passThrough().Read(n, req)
+	}
+
+	return h.HandlerIface.Read(n, req)
+}
+
+func (h *policyHandler) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	switch h.policy(n.Path(), req) {
+
+	case domain.ResourcePolicyHide:
+		return 0, fuse.IOerror{Code: syscall.ENOENT}
+
+	case domain.ResourcePolicyPassthrough:
+		return h.passThrough().Write(n, req)
+
+	case domain.ResourcePolicyReadOnly:
+		return 0, fuse.IOerror{Code: syscall.EACCES}
+	}
+
+	if h.readOnly(n.Path(), req) {
+		return 0, fuse.IOerror{Code: syscall.EROFS}
+	}
+
+	return h.HandlerIface.Write(n, req)
+}
+
+func (h *policyHandler) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	var handler = h.HandlerIface
+
+	switch h.policy(n.Path(), req) {
+
+	case domain.ResourcePolicyHide:
+		return nil, fuse.IOerror{Code: syscall.ENOENT}
+
+	case domain.ResourcePolicyPassthrough:
+		handler = h.passThrough()
+	}
+
+	files, err := handler.ReadDirAll(n, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter out the hidden entries.
+	var res []os.FileInfo
+	for _, info := range files {
+		if h.policy(filepath.Join(n.Path(), info.Name()), req) ==
+			domain.ResourcePolicyHide {
+			continue
+		}
+		res = append(res, info)
+	}
+
+	return res, nil
+}
+
+func (h *policyHandler) GetResource(n domain.IOnodeIface) (*domain.EmuResource, bool) {
+
+	if h.policies.lookup(n.Path()) == domain.ResourcePolicyPassthrough {
+		return nil, false
+	}
+
+	hr, ok := h.HandlerIface.(domain.HandlerResourceIface)
+	if !ok {
+		return nil, false
+	}
+
+	return hr.GetResource(n)
+}
+
+func (h *policyHandler) GetWriteMode(n domain.IOnodeIface) domain.WriteMode {
+
+	// Notice that only the daemon-wide policies are considered, as the
+	// container is unknown here (see GetPolicy()).
+	if h.policies.lookup(n.Path()) == domain.ResourcePolicyPassthrough {
+		return domain.WriteModeThrough
+	}
+
+	return handlerWriteMode(h.HandlerIface, n)
+}
+
+func (h *policyHandler) GetPolicy(
+	n domain.IOnodeIface,
+	cntr domain.ContainerIface) domain.ResourcePolicy {
+
+	return h.containerPolicy(n.Path(), cntr)
+}
+
+// readOnlyFileInfo strips the write permissions of the wrapped file info.
+type readOnlyFileInfo struct {
+	os.FileInfo
+}
+
+func (i readOnlyFileInfo) Mode() os.FileMode {
+	return i.FileInfo.Mode() &^ 0222
+}
+
+func (i readOnlyFileInfo) Sys() interface{} {
+
+	stat, ok := i.FileInfo.Sys().(*syscall.Stat_t)
+	if !ok || stat == nil {
+		return i.FileInfo.Sys()
+	}
+
+	statCopy := *stat
+	statCopy.Mode &^= 0222
+
+	return &statCopy
+}
@@ -0,0 +1,224 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/mocks"
+)
+
+func TestPolicyDB(t *testing.T) {
+
+	db := newPolicyDB(map[string]domain.ResourcePolicy{
+		"/sys/kernel/debug":                       domain.ResourcePolicyHide,
+		"/proc/sys/net":                           domain.ResourcePolicyReadOnly,
+		"/proc/sys/net/ipv4/ip_unprivileged_port": domain.ResourcePolicyPassthrough,
+		"/proc/sys/net/core/somaxconn":            domain.ResourcePolicyExpose,
+	}, nil)
+
+	lookupTests := []struct {
+		path string
+		want domain.ResourcePolicy
+	}{
+		{"/sys/kernel/debug", domain.ResourcePolicyHide},
+		{"/sys/kernel/debug/tracing", domain.ResourcePolicyHide},
+		{"/sys/kernel/debugfs", domain.ResourcePolicyExpose},
+		{"/sys/kernel", domain.ResourcePolicyExpose},
+		{"/proc/sys/net/ipv4/tcp_keepalive_time", domain.ResourcePolicyReadOnly},
+		{"/proc/sys/net/ipv4/ip_unprivileged_port", domain.ResourcePolicyPassthrough},
+		{"/proc/sys/net/core/somaxconn", domain.ResourcePolicyExpose},
+		{"/proc/sys/kernel/panic", domain.ResourcePolicyExpose},
+	}
+
+	for _, tt := range lookupTests {
+		if got := db.lookup(tt.path); got != tt.want {
+			t.Errorf("lookup(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyDBLabeled(t *testing.T) {
+
+	db := newPolicyDB(
+		map[string]domain.ResourcePolicy{
+			"/proc/kallsyms": domain.ResourcePolicyHide,
+			"/proc/sys/net":  domain.ResourcePolicyReadOnly,
+		},
+		[]domain.LabeledResourcePolicies{
+			{
+				Labels: map[string]string{"tier": "untrusted"},
+				Policies: map[string]domain.ResourcePolicy{
+					"/proc/sys": domain.ResourcePolicyReadOnly,
+				},
+			},
+			{
+				Labels: map[string]string{"tier": "untrusted", "app": "db"},
+				Policies: map[string]domain.ResourcePolicy{
+					"/proc/sys/vm": domain.ResourcePolicyPassthrough,
+				},
+			},
+			{
+				Labels: map[string]string{"app": "router"},
+				Policies: map[string]domain.ResourcePolicy{
+					"/proc/sys/net": domain.ResourcePolicyExpose,
+				},
+			},
+		})
+
+	untrusted := map[string]string{"tier": "untrusted", "app": "db"}
+	router := map[string]string{"app": "router"}
+
+	tests := []struct {
+		path   string
+		labels map[string]string
+		want   domain.ResourcePolicy
+	}{
+		// Label-scoped policies only apply to the matching containers.
+		{"/proc/sys/kernel/panic", nil, domain.ResourcePolicyExpose},
+		{"/proc/sys/kernel/panic", untrusted, domain.ResourcePolicyReadOnly},
+		{"/proc/sys/kernel/panic", router, domain.ResourcePolicyExpose},
+
+		// The first matching set defining a policy for the resource wins.
+		{"/proc/sys/vm/swappiness", untrusted, domain.ResourcePolicyReadOnly},
+
+		// Label-scoped policies take precedence over the daemon-wide ones,
+		// which apply otherwise.
+		{"/proc/sys/net/core/somaxconn", nil, domain.ResourcePolicyReadOnly},
+		{"/proc/sys/net/core/somaxconn", router, domain.ResourcePolicyExpose},
+		{"/proc/kallsyms", untrusted, domain.ResourcePolicyHide},
+	}
+
+	for _, tt := range tests {
+		if got := db.lookupLabeled(tt.path, tt.labels); got != tt.want {
+			t.Errorf("lookupLabeled(%s, %v) = %v, want %v", tt.path, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyHandlerLabeled(t *testing.T) {
+
+	const path = "/proc/sys/kernel/panic"
+
+	h := &policyHandler{
+		policies: newPolicyDB(nil, []domain.LabeledResourcePolicies{
+			{
+				Labels: map[string]string{"tier": "untrusted"},
+				Policies: map[string]domain.ResourcePolicy{
+					"/proc/sys": domain.ResourcePolicyReadOnly,
+				},
+			},
+		}),
+	}
+
+	// Containers are matched as per the labels in their metadata at request
+	// time.
+	cntr := &mocks.ContainerIface{}
+	cntr.On("ResourcePolicy", path).Return(domain.ResourcePolicyExpose, false)
+	cntr.On("Metadata").Return(domain.ContainerMetadata{}).Once()
+	cntr.On("Metadata").Return(domain.ContainerMetadata{
+		Labels: map[string]string{"tier": "untrusted"},
+	})
+
+	req := &domain.HandlerRequest{Container: cntr}
+
+	if got := h.policy(path, req); got != domain.ResourcePolicyExpose {
+		t.Errorf("policy(%s) = %v, want %v", path, got, domain.ResourcePolicyExpose)
+	}
+	if got := h.policy(path, req); got != domain.ResourcePolicyReadOnly {
+		t.Errorf("policy(%s) = %v, want %v", path, got, domain.ResourcePolicyReadOnly)
+	}
+
+	// Per-container (annotation) policies take precedence.
+	cntr = &mocks.ContainerIface{}
+	cntr.On("ResourcePolicy", path).Return(domain.ResourcePolicyHide, true)
+
+	req = &domain.HandlerRequest{Container: cntr}
+
+	if got := h.policy(path, req); got != domain.ResourcePolicyHide {
+		t.Errorf("policy(%s) = %v, want %v", path, got, domain.ResourcePolicyHide)
+	}
+}
+
+// Node stub identified by its path.
+type policyTestNode struct {
+	domain.IOnodeIface
+	path string
+}
+
+func (n *policyTestNode) Path() string {
+	return n.path
+}
+
+// Handler stub writing its nodes back.
+type writeBackHandler struct {
+	domain.HandlerIface
+}
+
+func (h *writeBackHandler) GetWriteMode(n domain.IOnodeIface) domain.WriteMode {
+	return domain.WriteModeBack
+}
+
+func TestPolicyHandlerLabeledPassthrough(t *testing.T) {
+
+	const path = "/proc/sys/net/core/somaxconn"
+
+	h := &policyHandler{
+		HandlerIface: &writeBackHandler{},
+		policies: newPolicyDB(nil, []domain.LabeledResourcePolicies{
+			{
+				Labels: map[string]string{"tier": "legacy"},
+				Policies: map[string]domain.ResourcePolicy{
+					"/proc/sys/net": domain.ResourcePolicyPassthrough,
+				},
+			},
+		}),
+	}
+
+	n := &policyTestNode{path: path}
+
+	matching := &mocks.ContainerIface{}
+	matching.On("ResourcePolicy", path).Return(domain.ResourcePolicyExpose, false)
+	matching.On("Metadata").Return(domain.ContainerMetadata{
+		Labels: map[string]string{"tier": "legacy"},
+	})
+
+	other := &mocks.ContainerIface{}
+	other.On("ResourcePolicy", path).Return(domain.ResourcePolicyExpose, false)
+	other.On("Metadata").Return(domain.ContainerMetadata{})
+
+	tests := []struct {
+		cntr domain.ContainerIface
+		want domain.ResourcePolicy
+	}{
+		{matching, domain.ResourcePolicyPassthrough},
+		{other, domain.ResourcePolicyExpose},
+		{nil, domain.ResourcePolicyExpose},
+	}
+
+	for _, tt := range tests {
+		if got := h.GetPolicy(n, tt.cntr); got != tt.want {
+			t.Errorf("GetPolicy(%s, %v) = %v, want %v", path, tt.cntr, got, tt.want)
+		}
+	}
+
+	// The container agnostic write mode only honors daemon-wide policies.
+	if got := h.GetWriteMode(n); got != domain.WriteModeBack {
+		t.Errorf("GetWriteMode(%s) = %v, want %v", path, got, domain.WriteModeBack)
+	}
+}
@@ -0,0 +1,93 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Registry of out-of-tree handlers. Allows site-specific handlers (e.g., one
+// virtualizing a vendor sysfs path) to be served by sysbox-fs without modifying
+// this package: these handlers register themselves from the init() function of
+// their package, which is then linked into sysbox-fs through a blank import.
+//
+//   func init() {
+//       handler.Register(&VendorFoo{...})
+//   }
+//
+// Registered handlers are served along with the default ones, and take the
+// place of the default handler registered at their same path (if any). Refer
+// to domain.HandlerIface for the contract that handlers must honor.
+//
+
+var (
+	registryMu sync.Mutex
+	registry   []domain.HandlerIface
+)
+
+// Register makes the given handler available to sysbox-fs. Handlers must be
+// registered before sysbox-fs' handler service is set up (i.e., during package
+// initialization). Register panics if the handler is nil or if a handler is
+// already registered at its path.
+func Register(h domain.HandlerIface) {
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if h == nil {
+		panic("handler: Register handler is nil")
+	}
+
+	for _, r := range registry {
+		if r.GetPath() == h.GetPath() {
+			panic("handler: Register called twice for path " + h.GetPath())
+		}
+	}
+
+	registry = append(registry, h)
+}
+
+// Handlers returns the handlers to be served by sysbox-fs: the default ones
+// along with the registered ones.
+func Handlers() []domain.HandlerIface {
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registered := make(map[string]domain.HandlerIface, len(registry))
+	for _, h := range registry {
+		registered[h.GetPath()] = h
+	}
+
+	handlers := make([]domain.HandlerIface, 0, len(DefaultHandlers)+len(registry))
+
+	for _, h := range DefaultHandlers {
+		if r, ok := registered[h.GetPath()]; ok {
+			logrus.Infof("Handler %s overridden by registered handler %s",
+				h.GetName(), r.GetName())
+			continue
+		}
+		handlers = append(handlers, h)
+	}
+
+	return append(handlers, registry...)
+}
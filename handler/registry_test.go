@@ -0,0 +1,133 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// Handler stub recording the invocation of its init / fini hooks.
+type hookHandler struct {
+	domain.HandlerIface
+	path    string
+	initErr error
+	inits   int
+	finis   int
+}
+
+func (h *hookHandler) GetName() string                          { return "hookHandler" }
+func (h *hookHandler) GetPath() string                          { return h.path }
+func (h *hookHandler) SetService(hs domain.HandlerServiceIface) {}
+
+func (h *hookHandler) Init() error {
+	h.inits++
+	return h.initErr
+}
+
+func (h *hookHandler) Fini() {
+	h.finis++
+}
+
+// Returns true if the given function panics.
+func panics(fn func()) (res bool) {
+	defer func() { res = recover() != nil }()
+	fn()
+	return false
+}
+
+func TestRegistry(t *testing.T) {
+
+	defer func(saved []domain.HandlerIface) { registry = saved }(registry)
+	registry = nil
+
+	var overridden domain.HandlerIface
+	for _, h := range DefaultHandlers {
+		if h.GetPath() != "" && h.GetPath()[0] == '/' {
+			overridden = h
+			break
+		}
+	}
+
+	vendor := &hookHandler{path: "/sys/devices/vendor"}
+	override := &hookHandler{path: overridden.GetPath()}
+
+	Register(vendor)
+	Register(override)
+
+	if !panics(func() { Register(&hookHandler{path: vendor.path}) }) {
+		t.Errorf("Register() of a duplicated path didn't panic")
+	}
+	if !panics(func() { Register(nil) }) {
+		t.Errorf("Register() of a nil handler didn't panic")
+	}
+
+	handlers := Handlers()
+
+	if len(handlers) != len(DefaultHandlers)+1 {
+		t.Errorf("Handlers() returned %d handlers, want %d",
+			len(handlers), len(DefaultHandlers)+1)
+	}
+
+	var foundVendor, foundOverride bool
+	for _, h := range handlers {
+		switch h {
+		case vendor:
+			foundVendor = true
+		case override:
+			foundOverride = true
+		case overridden:
+			t.Errorf("Handlers() kept the overridden handler %s", h.GetName())
+		}
+	}
+	if !foundVendor || !foundOverride {
+		t.Errorf("Handlers() lacks the registered handlers")
+	}
+}
+
+func TestRegisterHandlerHooks(t *testing.T) {
+
+	hs := &handlerService{
+		handlerTree: newHandlerTree(),
+		stats:       newHandlerStatsDB(),
+		policies:    newPolicyDB(nil, nil),
+	}
+
+	h := &hookHandler{path: "/sys/devices/vendor"}
+
+	if err := hs.RegisterHandler(h); err != nil || h.inits != 1 {
+		t.Fatalf("RegisterHandler() = %v, inits %d", err, h.inits)
+	}
+	if err := hs.UnregisterHandler(h); err != nil || h.finis != 1 {
+		t.Fatalf("UnregisterHandler() = %v, finis %d", err, h.finis)
+	}
+
+	// Handlers failing to initialize are not registered.
+	h = &hookHandler{path: "/sys/devices/vendor", initErr: errors.New("no device")}
+
+	if err := hs.RegisterHandler(h); err == nil {
+		t.Fatalf("RegisterHandler() succeeded despite the init failure")
+	}
+	if _, ok := hs.FindHandler(h.path); ok {
+		t.Errorf("handler registered despite its init failure")
+	}
+	if err := hs.UnregisterHandler(h); err == nil || h.finis != 0 {
+		t.Errorf("UnregisterHandler() = %v, finis %d; want failure", err, h.finis)
+	}
+}
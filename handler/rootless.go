@@ -0,0 +1,163 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+//
+// rootlessHandler decorates handlers when sysbox-fs operates in rootless mode
+// (see domain.Rootless()), so that the accesses to the resources that require
+// host root privileges are rejected with a clear error (EPERM) upfront, rather
+// than failing in obscure ways (or half-way through) when reaching out to the
+// host. Lookups are still served, so the resources remain visible.
+//
+// Every resource is logged only once to prevent flooding the logs with
+// repetitive entries.
+//
+type rootlessHandler struct {
+	domain.HandlerIface
+	logged *sync.Map
+}
+
+// Resources requiring host root privileges.
+var hostRootResources = []struct {
+	path        string
+	writeOnly   bool // only writes require host root
+	descendants bool // only the resource's descendants require host root
+}{
+	// Host's debugfs nodes (the debugfs directory itself is emulated).
+	{"/sys/kernel/debug", false, true},
+	// Module parameter shared by the whole host.
+	{"/sys/module/nf_conntrack/parameters/hashsize", true, false},
+}
+
+// Reports whether the given access to the given resource requires host root
+// privileges.
+func hostRootAccess(path string, write bool) bool {
+
+	for _, r := range hostRootResources {
+		if r.writeOnly && !write {
+			continue
+		}
+		if strings.HasPrefix(path, r.path+"/") || (path == r.path && !r.descendants) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reports whether any of the resources served by the handler at the given path
+// requires host root privileges.
+func hostRootHandler(path string) bool {
+
+	for _, r := range hostRootResources {
+		if r.path == path ||
+			strings.HasPrefix(r.path, path+"/") ||
+			strings.HasPrefix(path, r.path+"/") ||
+			path == "/" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *rootlessHandler) reject(n domain.IOnodeIface) error {
+
+	if _, loaded := h.logged.LoadOrStore(n.Path(), struct{}{}); !loaded {
+		logrus.Warnf("Access to %s requires host root privileges, unavailable in rootless mode",
+			n.Path())
+	}
+
+	return fuse.IOerror{
+		Code:    syscall.EPERM,
+		Message: "requires host root privileges (rootless mode)",
+	}
+}
+
+func (h *rootlessHandler) Open(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) error {
+
+	flags := n.OpenFlags()
+	write := flags&syscall.O_WRONLY == syscall.O_WRONLY ||
+		flags&syscall.O_RDWR == syscall.O_RDWR
+
+	if hostRootAccess(n.Path(), write) {
+		return h.reject(n)
+	}
+
+	return h.HandlerIface.Open(n, req)
+}
+
+func (h *rootlessHandler) Read(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	if hostRootAccess(n.Path(), false) {
+		return 0, h.reject(n)
+	}
+
+	return h.HandlerIface.Read(n, req)
+}
+
+func (h *rootlessHandler) Write(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) (int, error) {
+
+	if hostRootAccess(n.Path(), true) {
+		return 0, h.reject(n)
+	}
+
+	return h.HandlerIface.Write(n, req)
+}
+
+func (h *rootlessHandler) ReadDirAll(
+	n domain.IOnodeIface,
+	req *domain.HandlerRequest) ([]os.FileInfo, error) {
+
+	if hostRootAccess(n.Path(), false) {
+		return nil, h.reject(n)
+	}
+
+	return h.HandlerIface.ReadDirAll(n, req)
+}
+
+func (h *rootlessHandler) GetResource(n domain.IOnodeIface) (*domain.EmuResource, bool) {
+
+	hr, ok := h.HandlerIface.(domain.HandlerResourceIface)
+	if !ok {
+		return nil, false
+	}
+
+	return hr.GetResource(n)
+}
+
+func (h *rootlessHandler) GetWriteMode(n domain.IOnodeIface) domain.WriteMode {
+	return handlerWriteMode(h.HandlerIface, n)
+}
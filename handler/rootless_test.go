@@ -0,0 +1,61 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import "testing"
+
+func TestHostRootAccess(t *testing.T) {
+
+	tests := []struct {
+		path  string
+		write bool
+		want  bool
+	}{
+		{"/sys/kernel/debug", false, false},
+		{"/sys/kernel/debug/tracing", false, true},
+		{"/sys/kernel/debug/tracing/trace_pipe", true, true},
+		{"/sys/kernel/debugfs", false, false},
+		{"/sys/module/nf_conntrack/parameters/hashsize", false, false},
+		{"/sys/module/nf_conntrack/parameters/hashsize", true, true},
+		{"/proc/sys/kernel/panic", true, false},
+	}
+
+	for _, tt := range tests {
+		if got := hostRootAccess(tt.path, tt.write); got != tt.want {
+			t.Errorf("hostRootAccess(%s, %v) = %v, want %v",
+				tt.path, tt.write, got, tt.want)
+		}
+	}
+
+	handlerTests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/sys/kernel", true},
+		{"/sys/kernel/debug", true},
+		{"/sys/module/nf_conntrack/parameters", true},
+		{"/sys/kernel/security", false},
+		{"/proc/sys/kernel", false},
+	}
+
+	for _, tt := range handlerTests {
+		if got := hostRootHandler(tt.path); got != tt.want {
+			t.Errorf("hostRootHandler(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Per-handler statistics DB. Keeps track of the number of operations served by
+// each handler, as well as their latency distribution, to help us identify the
+// emulated nodes that are either hot or slow.
+//
+type handlerStatsDB struct {
+	sync.Mutex
+	db map[string]map[domain.HandlerOp]*domain.HandlerOpStats
+}
+
+func newHandlerStatsDB() *handlerStatsDB {
+	return &handlerStatsDB{
+		db: make(map[string]map[domain.HandlerOp]*domain.HandlerOpStats),
+	}
+}
+
+func (s *handlerStatsDB) record(
+	name string,
+	op domain.HandlerOp,
+	latency time.Duration,
+	err error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	ops, ok := s.db[name]
+	if !ok {
+		ops = make(map[domain.HandlerOp]*domain.HandlerOpStats)
+		s.db[name] = ops
+	}
+
+	stats, ok := ops[op]
+	if !ok {
+		stats = &domain.HandlerOpStats{
+			Histogram: make([]uint64, len(domain.HandlerLatencyBuckets)+1),
+		}
+		ops[op] = stats
+	}
+
+	stats.Count++
+	if err != nil && err != io.EOF {
+		stats.Errors++
+	}
+
+	stats.TotalLatency += latency
+	if latency > stats.MaxLatency {
+		stats.MaxLatency = latency
+	}
+
+	var i int
+	for i = 0; i < len(domain.HandlerLatencyBuckets); i++ {
+		if latency <= domain.HandlerLatencyBuckets[i] {
+			break
+		}
+	}
+	stats.Histogram[i]++
+}
+
+// Returns a deep copy of the stats DB to prevent callers from racing with
+// ongoing updates.
+func (s *handlerStatsDB) snapshot() map[string]map[domain.HandlerOp]*domain.HandlerOpStats {
+
+	s.Lock()
+	defer s.Unlock()
+
+	res := make(map[string]map[domain.HandlerOp]*domain.HandlerOpStats, len(s.db))
+
+	for name, ops := range s.db {
+		opsCopy := make(map[domain.HandlerOp]*domain.HandlerOpStats, len(ops))
+		for op, stats := range ops {
+			statsCopy := *stats
+			statsCopy.Histogram = append([]uint64(nil), stats.Histogram...)
+			opsCopy[op] = &statsCopy
+		}
+		res[name] = opsCopy
+	}
+
+	return res
+}
@@ -0,0 +1,80 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package handler
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+func TestHandlerStatsDB(t *testing.T) {
+
+	s := newHandlerStatsDB()
+
+	s.record("procSysKernel", domain.HandlerOpRead, 50*time.Microsecond, nil)
+	s.record("procSysKernel", domain.HandlerOpRead, 700*time.Microsecond, io.EOF)
+	s.record("procSysKernel", domain.HandlerOpRead, time.Hour, errors.New("failed"))
+	s.record("procSysKernel", domain.HandlerOpWrite, time.Millisecond, nil)
+
+	stats := s.snapshot()
+
+	read := stats["procSysKernel"][domain.HandlerOpRead]
+	if read == nil {
+		t.Fatalf("no stats recorded for Read")
+	}
+
+	// EOF isn't accounted as an error.
+	if read.Count != 3 || read.Errors != 1 {
+		t.Errorf("Read count / errors = %d / %d, want 3 / 1", read.Count, read.Errors)
+	}
+	if read.MaxLatency != time.Hour {
+		t.Errorf("Read max latency = %v, want %v", read.MaxLatency, time.Hour)
+	}
+	if want := time.Hour + 750*time.Microsecond; read.TotalLatency != want {
+		t.Errorf("Read total latency = %v, want %v", read.TotalLatency, want)
+	}
+
+	// Latencies fall in the first bucket bounding them (the last one being
+	// the implicit overflow bucket).
+	want := make([]uint64, len(domain.HandlerLatencyBuckets)+1)
+	want[0] = 1
+	want[2] = 1
+	want[len(want)-1] = 1
+	if !reflect.DeepEqual(read.Histogram, want) {
+		t.Errorf("Read histogram = %v, want %v", read.Histogram, want)
+	}
+
+	write := stats["procSysKernel"][domain.HandlerOpWrite]
+	if write == nil || write.Count != 1 || write.Histogram[2] != 1 {
+		t.Errorf("Write stats = %+v", write)
+	}
+
+	// Snapshots aren't altered by later updates.
+	s.record("procSysKernel", domain.HandlerOpRead, 50*time.Microsecond, nil)
+
+	if read.Count != 3 || read.Histogram[0] != 1 {
+		t.Errorf("snapshot altered by a later update: %+v", read)
+	}
+	if got := s.snapshot()["procSysKernel"][domain.HandlerOpRead].Count; got != 4 {
+		t.Errorf("Read count = %d, want 4", got)
+	}
+}
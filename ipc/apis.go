@@ -17,6 +17,8 @@
 package ipc
 
 import (
+	"sync/atomic"
+
 	"github.com/sirupsen/logrus"
 
 	"github.com/nestybox/sysbox-fs/domain"
@@ -26,10 +28,13 @@ import (
 )
 
 type ipcService struct {
-	grpcServer *grpc.Server
-	css        domain.ContainerStateServiceIface
-	prs        domain.ProcessServiceIface
-	ios        domain.IOServiceIface
+	grpcServer  *grpc.Server
+	debugServer *debugServer
+	serving     int32 // grpc server attending requests (see readyz)
+	css         domain.ContainerStateServiceIface
+	prs         domain.ProcessServiceIface
+	ios         domain.IOServiceIface
+	hds         domain.HandlerServiceIface
 }
 
 func NewIpcService() domain.IpcServiceIface {
@@ -40,11 +45,13 @@ func (ips *ipcService) Setup(
 	css domain.ContainerStateServiceIface,
 	prs domain.ProcessServiceIface,
 	ios domain.IOServiceIface,
+	hds domain.HandlerServiceIface,
 	fuseMp string) {
 
 	ips.css = css
 	ips.prs = prs
 	ips.ios = ios
+	ips.hds = hds
 
 	// Instantiate a grpcServer for inter-process communication.
 	ips.grpcServer = grpc.NewServer(
@@ -59,9 +66,22 @@ func (ips *ipcService) Setup(
 	)
 
 	logrus.Infof("Listening on %v", ips.grpcServer.GetAddr())
+
+	ips.debugServer = newDebugServer(ips)
 }
 
 func (ips *ipcService) Init() error {
+
+	// Debug endpoints are not critical for sysbox-fs operation, so proceed
+	// regardless of the outcome.
+	if err := ips.debugServer.Init(); err != nil {
+		logrus.Warnf("Unable to initialize debug server: %v", err)
+	}
+
+	// The grpc server serves requests till it exits.
+	atomic.StoreInt32(&ips.serving, 1)
+	defer atomic.StoreInt32(&ips.serving, 0)
+
 	return ips.grpcServer.Init()
 }
 
@@ -83,6 +103,8 @@ func ContainerRegister(ctx interface{}, data *grpc.ContainerData) error {
 
 	// Create temporary container struct to be passed as reference to containerDB,
 	// where the matching (real) container will be identified and then updated.
+	// Annotations are not passed, as sysbox-ipc's ContainerData doesn't carry
+	// them yet.
 	cntr := ipcService.css.ContainerCreate(
 		data.Id,
 		uint32(data.InitPid),
@@ -93,6 +115,7 @@ func ContainerRegister(ctx interface{}, data *grpc.ContainerData) error {
 		uint32(data.GidSize),
 		data.ProcRoPaths,
 		data.ProcMaskPaths,
+		nil,
 		ipcService.css,
 	)
 
@@ -142,6 +165,7 @@ func ContainerUpdate(ctx interface{}, data *grpc.ContainerData) error {
 		uint32(data.GidSize),
 		nil,
 		nil,
+		nil,
 		ipcService.css,
 	)
 
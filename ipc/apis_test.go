@@ -109,7 +109,7 @@ func Test_ipcService_Setup(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ips := ipc.NewIpcService()
-			ips.Setup(tt.args.css, tt.args.prs, tt.args.ios, tt.args.fuseMp)
+			ips.Setup(tt.args.css, tt.args.prs, tt.args.ios, nil, tt.args.fuseMp)
 		})
 	}
 }
@@ -145,7 +145,7 @@ func TestContainerPreRegister(t *testing.T) {
 	}
 
 	var ctx = ipc.NewIpcService()
-	ctx.Setup(css, nil, nil, "/var/lib/sysboxfs")
+	ctx.Setup(css, nil, nil, nil, "/var/lib/sysboxfs")
 
 	var a1 = args{
 		ctx: ctx,
@@ -220,7 +220,7 @@ func TestContainerRegister(t *testing.T) {
 	var c1 domain.ContainerIface
 
 	var ctx = ipc.NewIpcService()
-	ctx.Setup(css, nil, nil, "/var/lib/sysboxfs")
+	ctx.Setup(css, nil, nil, nil, "/var/lib/sysboxfs")
 
 	var a1 = args{
 		ctx: ctx,
@@ -253,6 +253,7 @@ func TestContainerRegister(t *testing.T) {
 					uint32(a1.data.GidSize),
 					a1.data.ProcRoPaths,
 					a1.data.ProcMaskPaths,
+					map[string]string(nil),
 					css).Return(c1)
 
 				css.On("ContainerRegister", c1).Return(nil)
@@ -278,6 +279,7 @@ func TestContainerRegister(t *testing.T) {
 					uint32(a1.data.GidSize),
 					a1.data.ProcRoPaths,
 					a1.data.ProcMaskPaths,
+					map[string]string(nil),
 					css).Return(c1)
 
 				css.On("ContainerRegister", c1).Return(
@@ -327,10 +329,11 @@ func TestContainerUnregister(t *testing.T) {
 		nil,
 		nil,
 		nil,
+		nil,
 	)
 
 	var ctx = ipc.NewIpcService()
-	ctx.Setup(css, nil, nil, "/var/lib/sysboxfs")
+	ctx.Setup(css, nil, nil, nil, "/var/lib/sysboxfs")
 
 	var a1 = args{
 		ctx: ctx,
@@ -405,7 +408,7 @@ func TestContainerUpdate(t *testing.T) {
 	var c1 domain.ContainerIface
 
 	var ctx = ipc.NewIpcService()
-	ctx.Setup(css, nil, nil, "/var/lib/sysboxfs")
+	ctx.Setup(css, nil, nil, nil, "/var/lib/sysboxfs")
 
 	var a1 = args{
 		ctx: ctx,
@@ -439,6 +442,7 @@ func TestContainerUpdate(t *testing.T) {
 					uint32(a1.data.GidSize),
 					a1.data.ProcRoPaths,
 					a1.data.ProcMaskPaths,
+					map[string]string(nil),
 					css).Return(c1)
 
 				css.On("ContainerUpdate", c1).Return(nil)
@@ -464,6 +468,7 @@ func TestContainerUpdate(t *testing.T) {
 					uint32(a1.data.GidSize),
 					a1.data.ProcRoPaths,
 					a1.data.ProcMaskPaths,
+					map[string]string(nil),
 					css).Return(c1)
 
 				css.On("ContainerUpdate", c1).Return(
@@ -0,0 +1,184 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ipc
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// Unix socket serving sysbox-fs' debug endpoints. Access is restricted to the
+// host's root user.
+const debugSockPath = "/run/sysbox/sysfs-debug.sock"
+
+//
+// Debug server. Exposes sysbox-fs' internal state (e.g., handler statistics)
+// through a set of http endpoints reachable over a unix socket. Example:
+//
+// $ curl --unix-socket /run/sysbox/sysfs-debug.sock http://localhost/handlers/stats
+// $ curl --unix-socket /run/sysbox/sysfs-debug.sock http://localhost/containers/stats?id=<cntr-id>
+// $ curl --unix-socket /run/sysbox/sysfs-debug.sock http://localhost/kernel/features
+// $ curl --unix-socket /run/sysbox/sysfs-debug.sock http://localhost/security/events
+// $ curl --unix-socket /run/sysbox/sysfs-debug.sock http://localhost/healthz
+//
+type debugServer struct {
+	ips      *ipcService
+	mux      *http.ServeMux
+	listener net.Listener
+}
+
+func newDebugServer(ips *ipcService) *debugServer {
+
+	ds := &debugServer{
+		ips: ips,
+		mux: http.NewServeMux(),
+	}
+
+	ds.mux.HandleFunc("/handlers/stats", ds.handlersStats)
+	ds.mux.HandleFunc("/containers/stats", ds.containersStats)
+	ds.mux.HandleFunc("/kernel/features", ds.kernelFeatures)
+	ds.mux.HandleFunc("/security/events", ds.securityEvents)
+	ds.registerHealthEndpoints(ds.mux)
+
+	return ds
+}
+
+func (ds *debugServer) Init() error {
+
+	// Eliminate stale sockets left behind by previous sysbox-fs instances.
+	if err := os.RemoveAll(debugSockPath); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("unix", debugSockPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(debugSockPath, 0600); err != nil {
+		l.Close()
+		return err
+	}
+
+	ds.listener = l
+
+	go func() {
+		if err := http.Serve(l, ds.mux); err != nil {
+			logrus.Warnf("Debug server stopped: %v", err)
+		}
+	}()
+
+	logrus.Infof("Debug server listening on %v", debugSockPath)
+
+	if err := ds.initHealthListener(); err != nil {
+		logrus.Warnf("Unable to serve health endpoints: %v", err)
+	}
+
+	return nil
+}
+
+func (ds *debugServer) handlersStats(w http.ResponseWriter, r *http.Request) {
+
+	if ds.ips.hds == nil {
+		http.Error(w, "handler service not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ds.writeJSON(w, ds.ips.hds.HandlersStats())
+}
+
+// Returns the fuse operation counters of the container matching the "id" query
+// parameter, or those of all the registered containers if no id is provided.
+func (ds *debugServer) containersStats(w http.ResponseWriter, r *http.Request) {
+
+	if ds.ips.css == nil || ds.ips.css.FuseServerService() == nil {
+		http.Error(w, "fuse service not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	fss := ds.ips.css.FuseServerService()
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		ds.writeJSON(w, fss.FuseServersStats())
+		return
+	}
+
+	stats, err := fss.FuseServerStats(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	ds.writeJSON(w, stats)
+}
+
+// Returns the outcome of the probing of the kernel features sysbox-fs relies
+// upon, along with the fallbacks in effect for the missing ones.
+func (ds *debugServer) kernelFeatures(w http.ResponseWriter, r *http.Request) {
+	ds.writeJSON(w, domain.KernelFeatures())
+}
+
+// Streams the security events (see domain.SecurityEvent) emitted from now on,
+// as JSON lines, until the client disconnects.
+func (ds *debugServer) securityEvents(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := domain.SubscribeSecurityEvents()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+
+	for {
+		select {
+		case ev := <-events:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (ds *debugServer) writeJSON(w http.ResponseWriter, v interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		logrus.Warnf("Debug server encoding error: %v", err)
+	}
+}
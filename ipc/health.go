@@ -0,0 +1,231 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ipc
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//
+// Health endpoints, in a form consumable by kubelet's http probes (e.g., for
+// sysbox-fs deployed as a DaemonSet):
+//
+// * /healthz (liveness): reports whether sysbox-fs' subsystems are responsive,
+//   that is, whether their state can be accessed within healthCheckTimeout. A
+//   failure reveals a wedged sysbox-fs (e.g., a lock held indefinitely), which
+//   is to be restarted.
+//
+// * /readyz (readiness): on top of the above, reports whether sysbox-fs is
+//   attending sys container registrations (i.e., initialization is completed
+//   and the grpc server is up).
+//
+// Both endpoints reply 200 if all checks pass and 503 otherwise, along with the
+// outcome of each check (json). They are served over the debug socket and, if
+// a health address is set (see SetHealthAddr()), over tcp, as kubelet probes
+// can't reach unix sockets.
+//
+// $ curl http://127.0.0.1:9099/readyz
+// {
+//   "status": "ok",
+//   "checks": {
+//     "containers": "ok",
+//     "fuse": "ok",
+//     "handlers": "ok",
+//     "ipc": "ok"
+//   }
+// }
+//
+
+// Max time a health check may take before the subsystem is deemed wedged.
+const healthCheckTimeout = 5 * time.Second
+
+// Tcp address the health endpoints are served on (none by default).
+var healthAddr struct {
+	sync.Mutex
+	addr     string
+	listener net.Listener
+}
+
+// SetHealthAddr sets the tcp address ("<host>:<port>") the health endpoints are
+// to be served on. Must be called before the ipc service is initialized.
+func SetHealthAddr(addr string) {
+	healthAddr.Lock()
+	defer healthAddr.Unlock()
+
+	healthAddr.addr = addr
+}
+
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Registers the health endpoints in the given mux.
+func (ds *debugServer) registerHealthEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", ds.healthz)
+	mux.HandleFunc("/readyz", ds.readyz)
+}
+
+// Serves the health endpoints over tcp, if a health address has been set.
+func (ds *debugServer) initHealthListener() error {
+
+	healthAddr.Lock()
+	defer healthAddr.Unlock()
+
+	if healthAddr.addr == "" || healthAddr.listener != nil {
+		return nil
+	}
+
+	l, err := net.Listen("tcp", healthAddr.addr)
+	if err != nil {
+		return err
+	}
+	healthAddr.listener = l
+
+	mux := http.NewServeMux()
+	ds.registerHealthEndpoints(mux)
+
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			logrus.Warnf("Health server stopped: %v", err)
+		}
+	}()
+
+	logrus.Infof("Health endpoints listening on %v", healthAddr.addr)
+
+	return nil
+}
+
+// Liveness checks: the state of each subsystem is accessed through the same
+// paths (and locks) as the regular operations.
+func (ds *debugServer) liveChecks() []healthCheck {
+
+	ips := ds.ips
+
+	return []healthCheck{
+		{"containers", func() error {
+			if ips.css == nil {
+				return fmt.Errorf("container-state service not available")
+			}
+			ips.css.ContainerLookupById("")
+			return nil
+		}},
+		{"fuse", func() error {
+			if ips.css == nil || ips.css.FuseServerService() == nil {
+				return fmt.Errorf("fuse service not available")
+			}
+			ips.css.FuseServerService().FuseServersStats()
+			return nil
+		}},
+		{"handlers", func() error {
+			if ips.hds == nil {
+				return fmt.Errorf("handler service not available")
+			}
+			ips.hds.HandlersStats()
+			return nil
+		}},
+	}
+}
+
+func (ds *debugServer) healthz(w http.ResponseWriter, r *http.Request) {
+	ds.writeHealth(w, ds.liveChecks())
+}
+
+func (ds *debugServer) readyz(w http.ResponseWriter, r *http.Request) {
+
+	checks := append(ds.liveChecks(), healthCheck{"ipc", func() error {
+		if atomic.LoadInt32(&ds.ips.serving) == 0 {
+			return fmt.Errorf("not attending container registrations")
+		}
+		return nil
+	}})
+
+	ds.writeHealth(w, checks)
+}
+
+// Runs the given checks (concurrently) and replies with their outcome.
+func (ds *debugServer) writeHealth(w http.ResponseWriter, checks []healthCheck) {
+
+	status := &healthStatus{
+		Status: "ok",
+		Checks: make(map[string]string, len(checks)),
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c healthCheck) {
+			defer wg.Done()
+			res := "ok"
+			if err := runHealthCheck(c.check); err != nil {
+				res = err.Error()
+			}
+			mu.Lock()
+			status.Checks[c.name] = res
+			mu.Unlock()
+		}(c)
+	}
+
+	wg.Wait()
+
+	for name, res := range status.Checks {
+		if res != "ok" {
+			status.Status = "failed"
+			logrus.Warnf("Health check %s failed: %s", name, res)
+		}
+	}
+
+	if status.Status != "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	ds.writeJSON(w, status)
+}
+
+// Runs the given check, giving up on it after healthCheckTimeout. Notice that
+// a wedged check leaves its goroutine behind, as there's no way to cancel it.
+func runHealthCheck(check func() error) error {
+
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(healthCheckTimeout):
+		return fmt.Errorf("no response within %v", healthCheckTimeout)
+	}
+}
@@ -0,0 +1,85 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ipc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/mocks"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+
+	fss := &mocks.FuseServerServiceIface{}
+	fss.On("FuseServersStats").Return(map[string]*domain.FuseServerStats{})
+
+	css := &mocks.ContainerStateServiceIface{}
+	css.On("ContainerLookupById", "").Return(nil)
+	css.On("FuseServerService").Return(fss)
+
+	hds := &mocks.HandlerServiceIface{}
+	hds.On("HandlersStats").Return(map[string]map[domain.HandlerOp]*domain.HandlerOpStats{})
+
+	ips := &ipcService{css: css, hds: hds}
+	ds := &debugServer{ips: ips}
+
+	// Returns the status code and checks' outcome of the given endpoint.
+	get := func(endpoint func(http.ResponseWriter, *http.Request)) (int, *healthStatus) {
+		rec := httptest.NewRecorder()
+		endpoint(rec, httptest.NewRequest("GET", "/", nil))
+
+		var status healthStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("unable to decode health status %q: %v", rec.Body.String(), err)
+		}
+		return rec.Code, &status
+	}
+
+	// Live, though not ready till the grpc server is up.
+	if code, status := get(ds.healthz); code != http.StatusOK || status.Status != "ok" ||
+		len(status.Checks) != 3 {
+		t.Errorf("healthz = %d, %+v; want all checks ok", code, status)
+	}
+	if code, status := get(ds.readyz); code != http.StatusServiceUnavailable ||
+		status.Status != "failed" || status.Checks["ipc"] == "ok" ||
+		status.Checks["containers"] != "ok" {
+		t.Errorf("readyz = %d, %+v; want the ipc check failed", code, status)
+	}
+
+	atomic.StoreInt32(&ips.serving, 1)
+
+	if code, status := get(ds.readyz); code != http.StatusOK || status.Status != "ok" ||
+		len(status.Checks) != 4 {
+		t.Errorf("readyz = %d, %+v; want all checks ok", code, status)
+	}
+
+	// Unavailable subsystems fail both checks.
+	ips.hds = nil
+
+	if code, status := get(ds.healthz); code != http.StatusServiceUnavailable ||
+		status.Checks["handlers"] == "ok" || status.Checks["fuse"] != "ok" {
+		t.Errorf("healthz = %d, %+v; want the handlers check failed", code, status)
+	}
+	if code, _ := get(ds.readyz); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	domain "github.com/nestybox/sysbox-fs/domain"
 	mock "github.com/stretchr/testify/mock"
 
+	pidfd "github.com/nestybox/sysbox-libs/pidfd"
+
 	time "time"
 )
 
@@ -14,6 +16,22 @@ type ContainerIface struct {
 	mock.Mock
 }
 
+// Annotations provides a mock function with given fields:
+func (_m *ContainerIface) Annotations() map[string]string {
+	ret := _m.Called()
+
+	var r0 map[string]string
+	if rf, ok := ret.Get(0).(func() map[string]string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]string)
+		}
+	}
+
+	return r0
+}
+
 // Ctime provides a mock function with given fields:
 func (_m *ContainerIface) Ctime() time.Time {
 	ret := _m.Called()
@@ -28,22 +46,22 @@ func (_m *ContainerIface) Ctime() time.Time {
 	return r0
 }
 
-// Data provides a mock function with given fields: path, name
-func (_m *ContainerIface) Data(path string, name string) (string, bool) {
-	ret := _m.Called(path, name)
+// Data provides a mock function with given fields: name, offset, data
+func (_m *ContainerIface) Data(name string, offset int64, data *[]byte) (int, error) {
+	ret := _m.Called(name, offset, data)
 
-	var r0 string
-	if rf, ok := ret.Get(0).(func(string, string) string); ok {
-		r0 = rf(path, name)
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, int64, *[]byte) int); ok {
+		r0 = rf(name, offset, data)
 	} else {
-		r0 = ret.Get(0).(string)
+		r0 = ret.Get(0).(int)
 	}
 
-	var r1 bool
-	if rf, ok := ret.Get(1).(func(string, string) bool); ok {
-		r1 = rf(path, name)
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64, *[]byte) error); ok {
+		r1 = rf(name, offset, data)
 	} else {
-		r1 = ret.Get(1).(bool)
+		r1 = ret.Error(1)
 	}
 
 	return r0, r1
@@ -84,6 +102,20 @@ func (_m *ContainerIface) GID() uint32 {
 	return r0
 }
 
+// GidSize provides a mock function with given fields:
+func (_m *ContainerIface) GidSize() uint32 {
+	ret := _m.Called()
+
+	var r0 uint32
+	if rf, ok := ret.Get(0).(func() uint32); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(uint32)
+	}
+
+	return r0
+}
+
 // ID provides a mock function with given fields:
 func (_m *ContainerIface) ID() string {
 	ret := _m.Called()
@@ -112,6 +144,20 @@ func (_m *ContainerIface) InitPid() uint32 {
 	return r0
 }
 
+// InitPidFd provides a mock function with given fields:
+func (_m *ContainerIface) InitPidFd() pidfd.PidFd {
+	ret := _m.Called()
+
+	var r0 pidfd.PidFd
+	if rf, ok := ret.Get(0).(func() pidfd.PidFd); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(pidfd.PidFd)
+	}
+
+	return r0
+}
+
 // InitProc provides a mock function with given fields:
 func (_m *ContainerIface) InitProc() domain.ProcessIface {
 	ret := _m.Called()
@@ -128,6 +174,20 @@ func (_m *ContainerIface) InitProc() domain.ProcessIface {
 	return r0
 }
 
+// InitializeMountInfo provides a mock function with given fields:
+func (_m *ContainerIface) InitializeMountInfo() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // IsImmutableBindMount provides a mock function with given fields: info
 func (_m *ContainerIface) IsImmutableBindMount(info *domain.MountInfo) bool {
 	ret := _m.Called(info)
@@ -291,9 +351,102 @@ func (_m *ContainerIface) ProcRoPaths() []string {
 	return r0
 }
 
-// SetData provides a mock function with given fields: path, name, data
-func (_m *ContainerIface) SetData(path string, name string, data string) {
-	_m.Called(path, name, data)
+// IsMountInfoInitialized provides a mock function with given fields:
+func (_m *ContainerIface) IsMountInfoInitialized() bool {
+	ret := _m.Called()
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// IsReadOnlyPath provides a mock function with given fields: path
+func (_m *ContainerIface) IsReadOnlyPath(path string) bool {
+	ret := _m.Called(path)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// Metadata provides a mock function with given fields:
+func (_m *ContainerIface) Metadata() domain.ContainerMetadata {
+	ret := _m.Called()
+
+	var r0 domain.ContainerMetadata
+	if rf, ok := ret.Get(0).(func() domain.ContainerMetadata); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(domain.ContainerMetadata)
+	}
+
+	return r0
+}
+
+// NodeAttr provides a mock function with given fields: path
+func (_m *ContainerIface) NodeAttr(path string) (domain.NodeAttr, bool) {
+	ret := _m.Called(path)
+
+	var r0 domain.NodeAttr
+	if rf, ok := ret.Get(0).(func(string) domain.NodeAttr); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Get(0).(domain.NodeAttr)
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(path)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
+
+// ResourcePolicy provides a mock function with given fields: path
+func (_m *ContainerIface) ResourcePolicy(path string) (domain.ResourcePolicy, bool) {
+	ret := _m.Called(path)
+
+	var r0 domain.ResourcePolicy
+	if rf, ok := ret.Get(0).(func(string) domain.ResourcePolicy); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Get(0).(domain.ResourcePolicy)
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(path)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
+
+// SetData provides a mock function with given fields: name, offset, data
+func (_m *ContainerIface) SetData(name string, offset int64, data []byte) error {
+	ret := _m.Called(name, offset, data)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int64, []byte) error); ok {
+		r0 = rf(name, offset, data)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
 }
 
 // SetInitProc provides a mock function with given fields: pid, uid, gid
@@ -310,6 +463,21 @@ func (_m *ContainerIface) SetInitProc(pid uint32, uid uint32, gid uint32) error
 	return r0
 }
 
+// SetMetadata provides a mock function with given fields: md
+func (_m *ContainerIface) SetMetadata(md domain.ContainerMetadata) {
+	_m.Called(md)
+}
+
+// SetNodeAttr provides a mock function with given fields: path, attr
+func (_m *ContainerIface) SetNodeAttr(path string, attr domain.NodeAttr) {
+	_m.Called(path, attr)
+}
+
+// SetReadOnlyPath provides a mock function with given fields: path, ro
+func (_m *ContainerIface) SetReadOnlyPath(path string, ro bool) {
+	_m.Called(path, ro)
+}
+
 // UID provides a mock function with given fields:
 func (_m *ContainerIface) UID() uint32 {
 	ret := _m.Called()
@@ -324,7 +492,51 @@ func (_m *ContainerIface) UID() uint32 {
 	return r0
 }
 
+// UidSize provides a mock function with given fields:
+func (_m *ContainerIface) UidSize() uint32 {
+	ret := _m.Called()
+
+	var r0 uint32
+	if rf, ok := ret.Get(0).(func() uint32); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(uint32)
+	}
+
+	return r0
+}
+
 // Unlock provides a mock function with given fields:
 func (_m *ContainerIface) Unlock() {
 	_m.Called()
 }
+
+// WriteLimiter provides a mock function with given fields:
+func (_m *ContainerIface) WriteLimiter() *domain.RateLimiter {
+	ret := _m.Called()
+
+	var r0 *domain.RateLimiter
+	if rf, ok := ret.Get(0).(func() *domain.RateLimiter); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.RateLimiter)
+		}
+	}
+
+	return r0
+}
+
+// ValidateUserNs provides a mock function with given fields: pid
+func (_m *ContainerIface) ValidateUserNs(pid uint32) error {
+	ret := _m.Called(pid)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uint32) error); ok {
+		r0 = rf(pid)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
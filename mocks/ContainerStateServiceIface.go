@@ -14,13 +14,13 @@ type ContainerStateServiceIface struct {
 	mock.Mock
 }
 
-// ContainerCreate provides a mock function with given fields: id, pid, ctime, uidFirst, uidSize, gidFirst, gidSize, procRoPaths, procMaskPaths, service
-func (_m *ContainerStateServiceIface) ContainerCreate(id string, pid uint32, ctime time.Time, uidFirst uint32, uidSize uint32, gidFirst uint32, gidSize uint32, procRoPaths []string, procMaskPaths []string, service domain.ContainerStateServiceIface) domain.ContainerIface {
-	ret := _m.Called(id, pid, ctime, uidFirst, uidSize, gidFirst, gidSize, procRoPaths, procMaskPaths, service)
+// ContainerCreate provides a mock function with given fields: id, pid, ctime, uidFirst, uidSize, gidFirst, gidSize, procRoPaths, procMaskPaths, annotations, service
+func (_m *ContainerStateServiceIface) ContainerCreate(id string, pid uint32, ctime time.Time, uidFirst uint32, uidSize uint32, gidFirst uint32, gidSize uint32, procRoPaths []string, procMaskPaths []string, annotations map[string]string, service domain.ContainerStateServiceIface) domain.ContainerIface {
+	ret := _m.Called(id, pid, ctime, uidFirst, uidSize, gidFirst, gidSize, procRoPaths, procMaskPaths, annotations, service)
 
 	var r0 domain.ContainerIface
-	if rf, ok := ret.Get(0).(func(string, uint32, time.Time, uint32, uint32, uint32, uint32, []string, []string, domain.ContainerStateServiceIface) domain.ContainerIface); ok {
-		r0 = rf(id, pid, ctime, uidFirst, uidSize, gidFirst, gidSize, procRoPaths, procMaskPaths, service)
+	if rf, ok := ret.Get(0).(func(string, uint32, time.Time, uint32, uint32, uint32, uint32, []string, []string, map[string]string, domain.ContainerStateServiceIface) domain.ContainerIface); ok {
+		r0 = rf(id, pid, ctime, uidFirst, uidSize, gidFirst, gidSize, procRoPaths, procMaskPaths, annotations, service)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(domain.ContainerIface)
@@ -164,7 +164,12 @@ func (_m *ContainerStateServiceIface) ProcessService() domain.ProcessServiceIfac
 	return r0
 }
 
-// Setup provides a mock function with given fields: fss, prs, ios, mts
-func (_m *ContainerStateServiceIface) Setup(fss domain.FuseServerServiceIface, prs domain.ProcessServiceIface, ios domain.IOServiceIface, mts domain.MountServiceIface) {
-	_m.Called(fss, prs, ios, mts)
+// Setup provides a mock function with given fields: fss, prs, ios, mts, hds
+func (_m *ContainerStateServiceIface) Setup(fss domain.FuseServerServiceIface, prs domain.ProcessServiceIface, ios domain.IOServiceIface, mts domain.MountServiceIface, hds domain.HandlerServiceIface) {
+	_m.Called(fss, prs, ios, mts, hds)
+}
+
+// WatchRuntimeEvents provides a mock function with given fields: socket, cleanup
+func (_m *ContainerStateServiceIface) WatchRuntimeEvents(socket string, cleanup bool) {
+	_m.Called(socket, cleanup)
 }
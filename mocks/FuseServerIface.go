@@ -2,7 +2,12 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	domain "github.com/nestybox/sysbox-fs/domain"
+	mock "github.com/stretchr/testify/mock"
+
+	time "time"
+)
 
 // FuseServerIface is an autogenerated mock type for the FuseServerIface type
 type FuseServerIface struct {
@@ -37,6 +42,20 @@ func (_m *FuseServerIface) Destroy() error {
 	return r0
 }
 
+// Drain provides a mock function with given fields: timeout
+func (_m *FuseServerIface) Drain(timeout time.Duration) error {
+	ret := _m.Called(timeout)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(time.Duration) error); ok {
+		r0 = rf(timeout)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // InitWait provides a mock function with given fields:
 func (_m *FuseServerIface) InitWait() {
 	_m.Called()
@@ -89,6 +108,22 @@ func (_m *FuseServerIface) SetCntrRegComplete() {
 	_m.Called()
 }
 
+// Stats provides a mock function with given fields:
+func (_m *FuseServerIface) Stats() *domain.FuseServerStats {
+	ret := _m.Called()
+
+	var r0 *domain.FuseServerStats
+	if rf, ok := ret.Get(0).(func() *domain.FuseServerStats); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.FuseServerStats)
+		}
+	}
+
+	return r0
+}
+
 // Unmount provides a mock function with given fields:
 func (_m *FuseServerIface) Unmount() {
 	_m.Called()
@@ -5,6 +5,8 @@ package mocks
 import (
 	domain "github.com/nestybox/sysbox-fs/domain"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // FuseServerServiceIface is an autogenerated mock type for the FuseServerServiceIface type
@@ -45,6 +47,20 @@ func (_m *FuseServerServiceIface) DestroyFuseService() {
 	_m.Called()
 }
 
+// DrainFuseService provides a mock function with given fields: timeout
+func (_m *FuseServerServiceIface) DrainFuseService(timeout time.Duration) error {
+	ret := _m.Called(timeout)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(time.Duration) error); ok {
+		r0 = rf(timeout)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // FuseServerCntrRegComplete provides a mock function with given fields: cntr
 func (_m *FuseServerServiceIface) FuseServerCntrRegComplete(cntr domain.ContainerIface) error {
 	ret := _m.Called(cntr)
@@ -59,6 +75,45 @@ func (_m *FuseServerServiceIface) FuseServerCntrRegComplete(cntr domain.Containe
 	return r0
 }
 
+// FuseServerStats provides a mock function with given fields: cntrId
+func (_m *FuseServerServiceIface) FuseServerStats(cntrId string) (*domain.FuseServerStats, error) {
+	ret := _m.Called(cntrId)
+
+	var r0 *domain.FuseServerStats
+	if rf, ok := ret.Get(0).(func(string) *domain.FuseServerStats); ok {
+		r0 = rf(cntrId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.FuseServerStats)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(cntrId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FuseServersStats provides a mock function with given fields:
+func (_m *FuseServerServiceIface) FuseServersStats() map[string]*domain.FuseServerStats {
+	ret := _m.Called()
+
+	var r0 map[string]*domain.FuseServerStats
+	if rf, ok := ret.Get(0).(func() map[string]*domain.FuseServerStats); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]*domain.FuseServerStats)
+		}
+	}
+
+	return r0
+}
+
 // Setup provides a mock function with given fields: mp, css, ios, hds
 func (_m *FuseServerServiceIface) Setup(mp string, css domain.ContainerStateServiceIface, ios domain.IOServiceIface, hds domain.HandlerServiceIface) error {
 	ret := _m.Called(mp, css, ios, hds)
@@ -60,16 +60,16 @@ func (_m *HandlerIface) GetResourceMap() map[string]domain.EmuResource {
 	return r0
 }
 
-// GetResourceMutex provides a mock function with given fields: s
-func (_m *HandlerIface) GetResourceMutex(s string) *sync.Mutex {
-	ret := _m.Called(s)
+// GetResourceMutex provides a mock function with given fields: node
+func (_m *HandlerIface) GetResourceMutex(node domain.IOnodeIface) *sync.RWMutex {
+	ret := _m.Called(node)
 
-	var r0 *sync.Mutex
-	if rf, ok := ret.Get(0).(func(string) *sync.Mutex); ok {
-		r0 = rf(s)
+	var r0 *sync.RWMutex
+	if rf, ok := ret.Get(0).(func(domain.IOnodeIface) *sync.RWMutex); ok {
+		r0 = rf(node)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*sync.Mutex)
+			r0 = ret.Get(0).(*sync.RWMutex)
 		}
 	}
 
@@ -5,6 +5,8 @@ package mocks
 import (
 	domain "github.com/nestybox/sysbox-fs/domain"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // HandlerServiceIface is an autogenerated mock type for the HandlerServiceIface type
@@ -12,6 +14,29 @@ type HandlerServiceIface struct {
 	mock.Mock
 }
 
+// CheckResourceValue provides a mock function with given fields: path, data
+func (_m *HandlerServiceIface) CheckResourceValue(path string, data []byte) ([]byte, error) {
+	ret := _m.Called(path, data)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(string, []byte) []byte); ok {
+		r0 = rf(path, data)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, []byte) error); ok {
+		r1 = rf(path, data)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DisableHandler provides a mock function with given fields: path
 func (_m *HandlerServiceIface) DisableHandler(path string) error {
 	ret := _m.Called(path)
@@ -26,6 +51,20 @@ func (_m *HandlerServiceIface) DisableHandler(path string) error {
 	return r0
 }
 
+// DryRun provides a mock function with given fields:
+func (_m *HandlerServiceIface) DryRun() bool {
+	ret := _m.Called()
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // EnableHandler provides a mock function with given fields: path
 func (_m *HandlerServiceIface) EnableHandler(path string) error {
 	ret := _m.Called(path)
@@ -121,6 +160,20 @@ func (_m *HandlerServiceIface) GetPassThroughHandler() domain.HandlerIface {
 	return r0
 }
 
+// GetResourcePolicy provides a mock function with given fields: path
+func (_m *HandlerServiceIface) GetResourcePolicy(path string) domain.ResourcePolicy {
+	ret := _m.Called(path)
+
+	var r0 domain.ResourcePolicy
+	if rf, ok := ret.Get(0).(func(string) domain.ResourcePolicy); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Get(0).(domain.ResourcePolicy)
+	}
+
+	return r0
+}
+
 // HandlersResourcesList provides a mock function with given fields:
 func (_m *HandlerServiceIface) HandlersResourcesList() []string {
 	ret := _m.Called()
@@ -137,6 +190,22 @@ func (_m *HandlerServiceIface) HandlersResourcesList() []string {
 	return r0
 }
 
+// HandlersStats provides a mock function with given fields:
+func (_m *HandlerServiceIface) HandlersStats() map[string]map[domain.HandlerOp]*domain.HandlerOpStats {
+	ret := _m.Called()
+
+	var r0 map[string]map[domain.HandlerOp]*domain.HandlerOpStats
+	if rf, ok := ret.Get(0).(func() map[string]map[domain.HandlerOp]*domain.HandlerOpStats); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]map[domain.HandlerOp]*domain.HandlerOpStats)
+		}
+	}
+
+	return r0
+}
+
 // HostUserNsInode provides a mock function with given fields:
 func (_m *HandlerServiceIface) HostUserNsInode() uint64 {
 	ret := _m.Called()
@@ -250,6 +319,11 @@ func (_m *HandlerServiceIface) ProcessService() domain.ProcessServiceIface {
 	return r0
 }
 
+// RecordHandlerStats provides a mock function with given fields: name, op, latency, err
+func (_m *HandlerServiceIface) RecordHandlerStats(name string, op domain.HandlerOp, latency time.Duration, err error) {
+	_m.Called(name, op, latency, err)
+}
+
 // RegisterHandler provides a mock function with given fields: h
 func (_m *HandlerServiceIface) RegisterHandler(h domain.HandlerIface) error {
 	ret := _m.Called(h)
@@ -264,14 +338,19 @@ func (_m *HandlerServiceIface) RegisterHandler(h domain.HandlerIface) error {
 	return r0
 }
 
+// SetResourcePolicies provides a mock function with given fields: policies, labeled
+func (_m *HandlerServiceIface) SetResourcePolicies(policies map[string]domain.ResourcePolicy, labeled []domain.LabeledResourcePolicies) {
+	_m.Called(policies, labeled)
+}
+
 // SetStateService provides a mock function with given fields: css
 func (_m *HandlerServiceIface) SetStateService(css domain.ContainerStateServiceIface) {
 	_m.Called(css)
 }
 
-// Setup provides a mock function with given fields: hdlrs, ignoreErrors, css, nss, prs, ios
-func (_m *HandlerServiceIface) Setup(hdlrs []domain.HandlerIface, ignoreErrors bool, css domain.ContainerStateServiceIface, nss domain.NSenterServiceIface, prs domain.ProcessServiceIface, ios domain.IOServiceIface) {
-	_m.Called(hdlrs, ignoreErrors, css, nss, prs, ios)
+// Setup provides a mock function with given fields: hdlrs, ignoreErrors, dryRun, css, nss, prs, ios
+func (_m *HandlerServiceIface) Setup(hdlrs []domain.HandlerIface, ignoreErrors bool, dryRun bool, css domain.ContainerStateServiceIface, nss domain.NSenterServiceIface, prs domain.ProcessServiceIface, ios domain.IOServiceIface) {
+	_m.Called(hdlrs, ignoreErrors, dryRun, css, nss, prs, ios)
 }
 
 // StateService provides a mock function with given fields:
@@ -254,6 +254,27 @@ func (_m *IOnodeIface) ReadLine() (string, error) {
 	return r0, r1
 }
 
+// ReadLink provides a mock function with given fields:
+func (_m *IOnodeIface) ReadLink() (string, error) {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Remove provides a mock function with given fields:
 func (_m *IOnodeIface) Remove() error {
 	ret := _m.Called()
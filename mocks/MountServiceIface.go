@@ -12,6 +12,20 @@ type MountServiceIface struct {
 	mock.Mock
 }
 
+// BindMounts provides a mock function with given fields: c
+func (_m *MountServiceIface) BindMounts(c domain.ContainerIface) error {
+	ret := _m.Called(c)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(domain.ContainerIface) error); ok {
+		r0 = rf(c)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // MountHelper provides a mock function with given fields:
 func (_m *MountServiceIface) MountHelper() domain.MountHelperIface {
 	ret := _m.Called()
@@ -67,7 +81,45 @@ func (_m *MountServiceIface) NewMountInfoParser(c domain.ContainerIface, process
 	return r0, r1
 }
 
+// TrackMounts provides a mock function with given fields: c
+func (_m *MountServiceIface) TrackMounts(c domain.ContainerIface) error {
+	ret := _m.Called(c)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(domain.ContainerIface) error); ok {
+		r0 = rf(c)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemountSysboxfs provides a mock function with given fields: c, mountpoint
+func (_m *MountServiceIface) RemountSysboxfs(c domain.ContainerIface, mountpoint string) error {
+	ret := _m.Called(c, mountpoint)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(domain.ContainerIface, string) error); ok {
+		r0 = rf(c, mountpoint)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Setup provides a mock function with given fields: css, hds, prs, nss
 func (_m *MountServiceIface) Setup(css domain.ContainerStateServiceIface, hds domain.HandlerServiceIface, prs domain.ProcessServiceIface, nss domain.NSenterServiceIface) {
 	_m.Called(css, hds, prs, nss)
 }
+
+// UnbindMounts provides a mock function with given fields: c
+func (_m *MountServiceIface) UnbindMounts(c domain.ContainerIface) {
+	_m.Called(c)
+}
+
+// UntrackMounts provides a mock function with given fields: c
+func (_m *MountServiceIface) UntrackMounts(c domain.ContainerIface) {
+	_m.Called(c)
+}
@@ -77,6 +77,20 @@ func (_m *NSenterServiceIface) Setup(prs domain.ProcessServiceIface, mts domain.
 	_m.Called(prs, mts)
 }
 
+// TerminateAllRequests provides a mock function with given fields:
+func (_m *NSenterServiceIface) TerminateAllRequests() int {
+	ret := _m.Called()
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
 // TerminateRequestEvent provides a mock function with given fields: e
 func (_m *NSenterServiceIface) TerminateRequestEvent(e domain.NSenterEventIface) error {
 	ret := _m.Called(e)
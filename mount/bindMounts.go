@@ -0,0 +1,167 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+//
+// Bind-mounts of emulated nodes over other paths within a sys container, as
+// requested by sysbox-runc through the container's bind-mounts annotation (see
+// domain.BindMountsAnnotation). This is required by images that relocate or
+// mask procfs / sysfs files.
+//
+// Bind-mounts are set up within the container's namespaces upon registration
+// and removed upon unregistration (if the container is still around by then).
+// Requests are all-or-nothing: if any of the bind-mounts fails, the ones
+// already set up are reverted.
+//
+
+// BindMounts sets up the bind-mounts requested for the given container.
+func (mts *MountService) BindMounts(c domain.ContainerIface) error {
+
+	val, ok := c.Annotations()[domain.BindMountsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	mounts, err := domain.ParseBindMounts(val)
+	if err != nil {
+		return err
+	}
+
+	var payload []*domain.MountSyscallPayload
+
+	for _, m := range mounts {
+		if !isSysboxfsNode(m.Source) {
+			return fmt.Errorf("%s is not served by sysbox-fs", m.Source)
+		}
+
+		payload = append(payload, &domain.MountSyscallPayload{
+			Mount: domain.Mount{
+				Source: m.Source,
+				Target: m.Target,
+				Flags:  unix.MS_BIND,
+			},
+		})
+	}
+
+	if err := mts.sendBindMountsEvent(
+		c, domain.MountSyscallRequest, &payload); err != nil {
+		return err
+	}
+
+	mts.bmLock.Lock()
+	mts.bindMounts[c.ID()] = mounts
+	mts.bmLock.Unlock()
+
+	logrus.Debugf("Bind-mounts set up for container %s: %v", c.ID(), mounts)
+
+	return nil
+}
+
+// UnbindMounts removes the bind-mounts set up for the given container.
+func (mts *MountService) UnbindMounts(c domain.ContainerIface) {
+
+	mts.bmLock.Lock()
+	mounts, ok := mts.bindMounts[c.ID()]
+	delete(mts.bindMounts, c.ID())
+	mts.bmLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// Bind-mounts are removed in the reverse order, as these may be stacked
+	// over each other.
+	var payload []*domain.UmountSyscallPayload
+
+	for i := len(mounts) - 1; i >= 0; i-- {
+		payload = append(payload, &domain.UmountSyscallPayload{
+			Mount: domain.Mount{
+				Target: mounts[i].Target,
+				Flags:  unix.MNT_DETACH,
+			},
+		})
+	}
+
+	// Failures are expected here if the container is already gone, in which
+	// case its bind-mounts are gone too.
+	if err := mts.sendBindMountsEvent(
+		c, domain.UmountSyscallRequest, &payload); err != nil {
+		logrus.Debugf("Unable to remove bind-mounts of container %s: %s",
+			c.ID(), err)
+	}
+}
+
+// Issues the given (u)mount request within the namespaces of the container's
+// init process.
+func (mts *MountService) sendBindMountsEvent(
+	c domain.ContainerIface,
+	msgType domain.NSenterMsgType,
+	payload interface{}) error {
+
+	if mts.nss == nil {
+		return fmt.Errorf("nsenter service not available")
+	}
+
+	event := mts.nss.NewEvent(
+		c.InitPid(),
+		&domain.AllNSs,
+		&domain.NSenterMessage{
+			Type:    msgType,
+			Payload: payload,
+		},
+		nil,
+		false,
+	)
+
+	if err := mts.nss.SendRequestEvent(event); err != nil {
+		return err
+	}
+
+	responseMsg := mts.nss.ReceiveResponseEvent(event)
+	if responseMsg.Type == domain.ErrorResponse {
+		if ioErr, ok := responseMsg.Payload.(fuse.IOerror); ok {
+			return ioErr
+		}
+		return fmt.Errorf("%v", responseMsg.Payload)
+	}
+
+	return nil
+}
+
+// Returns true if the given node (within the container) is served by sysbox-fs.
+func isSysboxfsNode(path string) bool {
+
+	for _, mounts := range [][]string{ProcfsMounts, SysfsMounts} {
+		for _, mp := range mounts {
+			if path == mp || strings.HasPrefix(path, mp+"/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/mocks"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/sys/unix"
+)
+
+func TestBindMounts(t *testing.T) {
+
+	nss := &mocks.NSenterServiceIface{}
+	event := &mocks.NSenterEventIface{}
+
+	var reqs []*domain.NSenterMessage
+
+	nss.On("NewEvent", uint32(1001), &domain.AllNSs, mock.Anything, mock.Anything, false).
+		Run(func(args mock.Arguments) {
+			reqs = append(reqs, args.Get(2).(*domain.NSenterMessage))
+		}).Return(event)
+	nss.On("SendRequestEvent", event).Return(nil)
+	nss.On("ReceiveResponseEvent", event).Return(
+		&domain.NSenterMessage{Type: domain.MountSyscallResponse})
+
+	mts := NewMountService()
+	mts.nss = nss
+
+	newCntr := func(id, val string) *mocks.ContainerIface {
+		c := &mocks.ContainerIface{}
+		c.On("ID").Return(id)
+		c.On("InitPid").Return(uint32(1001))
+		c.On("Annotations").Return(map[string]string{
+			domain.BindMountsAnnotation: val,
+		})
+		return c
+	}
+
+	// Nodes not served by sysbox-fs can't be bind-mounted.
+	c1 := newCntr("c1", "/proc/uptime:/etc/uptime,/etc/passwd:/etc/uptime")
+	if err := mts.BindMounts(c1); err == nil {
+		t.Errorf("unexpected bind-mount of non-emulated node")
+	}
+	if len(reqs) != 0 {
+		t.Fatalf("unexpected nsenter requests: %v", reqs)
+	}
+
+	c2 := newCntr("c2", "/proc/uptime:/etc/uptime,/proc/sys/kernel:/etc/kernel")
+	if err := mts.BindMounts(c2); err != nil {
+		t.Fatalf("BindMounts() failed: %v", err)
+	}
+	if len(reqs) != 1 || reqs[0].Type != domain.MountSyscallRequest {
+		t.Fatalf("unexpected nsenter requests: %v", reqs)
+	}
+
+	wantMounts := []*domain.MountSyscallPayload{
+		{Mount: domain.Mount{Source: "/proc/uptime", Target: "/etc/uptime", Flags: unix.MS_BIND}},
+		{Mount: domain.Mount{Source: "/proc/sys/kernel", Target: "/etc/kernel", Flags: unix.MS_BIND}},
+	}
+	if got := *reqs[0].Payload.(*[]*domain.MountSyscallPayload); !reflect.DeepEqual(got, wantMounts) {
+		t.Errorf("mount payload = %v, want %v", got, wantMounts)
+	}
+
+	// Bind-mounts are removed in the reverse order, and only once.
+	mts.UnbindMounts(c2)
+	mts.UnbindMounts(c2)
+
+	if len(reqs) != 2 || reqs[1].Type != domain.UmountSyscallRequest {
+		t.Fatalf("unexpected nsenter requests: %v", reqs)
+	}
+
+	wantUmounts := []*domain.UmountSyscallPayload{
+		{Mount: domain.Mount{Target: "/etc/kernel", Flags: unix.MNT_DETACH}},
+		{Mount: domain.Mount{Target: "/etc/uptime", Flags: unix.MNT_DETACH}},
+	}
+	if got := *reqs[1].Payload.(*[]*domain.UmountSyscallPayload); !reflect.DeepEqual(got, wantUmounts) {
+		t.Errorf("umount payload = %v, want %v", got, wantUmounts)
+	}
+}
@@ -0,0 +1,492 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+//
+// Mountinfo cache.
+//
+// Mount-heavy workloads (e.g., inner containers being launched) trigger a
+// mountinfo parsing on every intercepted mount / umount syscall, which would
+// otherwise re-read and re-parse the whole mountinfo file of the process'
+// mount namespace every time.
+//
+// Instead, the mountinfo of each mount namespace is read through a file kept
+// open for this purpose, which the kernel flags (POLLPRI) whenever the mount
+// namespace changes. Hence, the mountinfo is only re-read upon changes, and
+// even then only the lines not present in the previous contents are parsed.
+//
+// Moreover, the mount namespaces of the registered sys containers are tracked
+// (see track()): changes in their mount-tables are picked up (epoll) as they
+// occur, so that a live mount-tree is kept for each of them, which also serves
+// the chroot'ed processes within them (i.e., no nsenter round trip is needed
+// to obtain the mount-table as seen from the namespace's root).
+//
+// Untracked namespaces not queried for a while are dropped from the cache,
+// releasing the reference held on them through the open file. Furthermore,
+// the namespaces cached on behalf of each sys container are capped (i.e., so
+// that a workload creating mount namespaces at will can't exhaust sysbox-fs'
+// fds), the least recently queried ones being dropped beyond the cap. The
+// same applies (cache-wide) should sysbox-fs run out of fds.
+//
+
+// Period after which the mountinfo of a mount namespace not queried is dropped.
+const mountInfoCacheTTL = 30 * time.Second
+
+// Max number of mount namespaces cached on behalf of each sys container.
+const mountInfoCacheMaxCntrEntries = 64
+
+// Parsed mountinfo lines, as per the parsing mode (superficial vs deep).
+type mountInfoLines struct {
+	byLine map[string]*domain.MountInfo
+	mounts []*domain.MountInfo // in mountinfo order
+}
+
+type mountInfoCacheEntry struct {
+	file     *os.File           // mountinfo file polled for changes
+	watch    *os.File           // mountinfo file watched through epoll (if tracked)
+	data     []byte             // last mountinfo contents read
+	parsed   [2]*mountInfoLines // data parsed superficially ([0]) and deeply ([1])
+	lastUsed time.Time
+	cntr     string // container the entry was created on behalf of
+}
+
+type mountInfoCache struct {
+	sync.Mutex
+	entries map[domain.Inode]*mountInfoCacheEntry // indexed by mount-ns inode
+	tracked map[string]domain.Inode               // tracked mount-ns, indexed by container id
+	watched map[int32]domain.Inode                // tracked mount-ns, indexed by watch fd
+	epfd    int                                   // epoll instance (-1 if not yet created)
+}
+
+func newMountInfoCache() *mountInfoCache {
+	return &mountInfoCache{
+		entries: make(map[domain.Inode]*mountInfoCacheEntry),
+		tracked: make(map[string]domain.Inode),
+		watched: make(map[int32]domain.Inode),
+		epfd:    -1,
+	}
+}
+
+// mounts returns the parsed mountinfo of the given mount namespace, as seen by
+// the given (un-chroot'ed) process within it (of the given sys container). If
+// trackedOnly is set, only the tracked namespaces are served. The returned
+// entries are shared and must not be modified.
+func (c *mountInfoCache) mounts(
+	cntr string,
+	pid uint32,
+	mntns domain.Inode,
+	fetchOptions bool,
+	trackedOnly bool) ([]*domain.MountInfo, error) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.evict(now)
+
+	e, ok := c.entries[mntns]
+	if !ok && trackedOnly {
+		return nil, fmt.Errorf("mount namespace %d not tracked", mntns)
+	}
+	if !ok {
+		var err error
+		if e, err = c.newEntry(cntr, pid, mntns); err != nil {
+			return nil, err
+		}
+	}
+	if trackedOnly && e.watch == nil {
+		return nil, fmt.Errorf("mount namespace %d not tracked", mntns)
+	}
+	e.lastUsed = now
+
+	// Notice that the tracked namespaces are checked for changes as well, as
+	// these may not have been picked up yet.
+	if err := c.refresh(mntns, e, false); err != nil {
+		return nil, err
+	}
+
+	mode := 0
+	if fetchOptions {
+		mode = 1
+	}
+
+	if e.parsed[mode] == nil {
+		parsed, err := parseMountInfoLines(e.data, fetchOptions, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.parsed[mode] = parsed
+	}
+
+	return e.parsed[mode].mounts, nil
+}
+
+// Creates the cache entry of the given mount namespace, out of the mountinfo
+// of the given process within it (of the given sys container).
+func (c *mountInfoCache) newEntry(
+	cntr string,
+	pid uint32,
+	mntns domain.Inode) (*mountInfoCacheEntry, error) {
+
+	if c.cntrEntries(cntr) >= mountInfoCacheMaxCntrEntries && !c.evictLRU(cntr) {
+		return nil, syscall.EMFILE
+	}
+
+	path := fmt.Sprintf("/proc/%d/mountinfo", pid)
+
+	f, err := os.Open(path)
+	if isFdExhaustion(err) && c.evictLRU("") {
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &mountInfoCacheEntry{file: f, lastUsed: time.Now(), cntr: cntr}
+	c.entries[mntns] = e
+
+	if err := c.refresh(mntns, e, true); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Re-reads (and re-parses) the mountinfo of the given entry if its mount
+// namespace has changed (or if forced to). Notice that changes are checked
+// before re-reading the mountinfo, so that the ones occurring in the meantime
+// are caught by the next check.
+func (c *mountInfoCache) refresh(
+	mntns domain.Inode,
+	e *mountInfoCacheEntry,
+	force bool) error {
+
+	if !force && !mountInfoChanged(e.file) {
+		return nil
+	}
+
+	data, err := readMountInfo(e.file)
+	if err != nil {
+		c.remove(mntns, e)
+		return err
+	}
+
+	if bytes.Equal(data, e.data) {
+		return nil
+	}
+	e.data = data
+
+	for i, prev := range e.parsed {
+		if prev == nil {
+			continue
+		}
+		if e.parsed[i], err = parseMountInfoLines(data, i == 1, prev); err != nil {
+			e.parsed[i] = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes the given entry from the cache.
+func (c *mountInfoCache) remove(mntns domain.Inode, e *mountInfoCacheEntry) {
+
+	c.unwatch(e)
+	e.file.Close()
+	delete(c.entries, mntns)
+
+	for id, ns := range c.tracked {
+		if ns == mntns {
+			delete(c.tracked, id)
+		}
+	}
+}
+
+// Drops the untracked entries not queried within the last mountInfoCacheTTL
+// period.
+func (c *mountInfoCache) evict(now time.Time) {
+
+	for mntns, e := range c.entries {
+		if e.watch == nil && now.Sub(e.lastUsed) > mountInfoCacheTTL {
+			c.remove(mntns, e)
+		}
+	}
+}
+
+// Returns the number of entries cached on behalf of the given container.
+func (c *mountInfoCache) cntrEntries(cntr string) int {
+
+	n := 0
+	for _, e := range c.entries {
+		if e.cntr == cntr {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Drops the least recently queried untracked entry of the given container (or
+// of any container if none is given). Returns false if there's none.
+func (c *mountInfoCache) evictLRU(cntr string) bool {
+
+	var (
+		lruNs domain.Inode
+		lru   *mountInfoCacheEntry
+	)
+
+	for mntns, e := range c.entries {
+		if e.watch != nil || (cntr != "" && e.cntr != cntr) {
+			continue
+		}
+		if lru == nil || e.lastUsed.Before(lru.lastUsed) {
+			lruNs, lru = mntns, e
+		}
+	}
+
+	if lru == nil {
+		return false
+	}
+
+	logrus.Debugf("Evicting cached mountinfo of mount-ns %d (cntr %s)", lruNs, lru.cntr)
+	c.remove(lruNs, lru)
+
+	return true
+}
+
+// Returns true if the given error stems from the exhaustion of the process' (or
+// system's) file table.
+func isFdExhaustion(err error) bool {
+
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+
+	return err == syscall.EMFILE || err == syscall.ENFILE
+}
+
+// Returns true if the mount namespace of the given mountinfo file has changed
+// since the file was opened or last checked.
+func mountInfoChanged(f *os.File) bool {
+
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+
+	n, err := unix.Poll(fds, 0)
+	if err != nil {
+		return true
+	}
+
+	return n > 0 && fds[0].Revents&(unix.POLLPRI|unix.POLLERR) != 0
+}
+
+func readMountInfo(f *os.File) ([]byte, error) {
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(f)
+}
+
+// Parses the given mountinfo contents, reusing the entries of the previously
+// parsed lines (if any) that are still present.
+func parseMountInfoLines(
+	data []byte,
+	fetchOptions bool,
+	prev *mountInfoLines) (*mountInfoLines, error) {
+
+	p := &mountInfoParser{fetchOptions: fetchOptions}
+
+	res := &mountInfoLines{
+		byLine: make(map[string]*domain.MountInfo),
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		var (
+			info *domain.MountInfo
+			ok   bool
+			err  error
+		)
+
+		if prev != nil {
+			info, ok = prev.byLine[line]
+		}
+		if !ok {
+			info, err = p.parseComponents(line)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		res.byLine[line] = info
+		res.mounts = append(res.mounts, info)
+	}
+
+	return res, scanner.Err()
+}
+
+// track keeps track of the mount namespace of the given sys container (i.e.,
+// of its init process), until untracked.
+func (c *mountInfoCache) track(id string, pid uint32, mntns domain.Inode) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.epfd < 0 {
+		epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+		if err != nil {
+			return err
+		}
+		c.epfd = epfd
+
+		go c.watcher(epfd)
+	}
+
+	e, ok := c.entries[mntns]
+	if !ok {
+		var err error
+		if e, err = c.newEntry(id, pid, mntns); err != nil {
+			return err
+		}
+	}
+
+	if e.watch == nil {
+		// The watched file is a distinct one from the polled one, as each of
+		// them is notified of the changes independently.
+		w, err := os.Open(fmt.Sprintf("/proc/%d/mountinfo", pid))
+		if err != nil {
+			return err
+		}
+
+		fd := int32(w.Fd())
+		event := &unix.EpollEvent{Events: unix.EPOLLPRI, Fd: fd}
+		if err := unix.EpollCtl(c.epfd, unix.EPOLL_CTL_ADD, int(fd), event); err != nil {
+			w.Close()
+			return err
+		}
+
+		e.watch = w
+		c.watched[fd] = mntns
+	}
+
+	c.tracked[id] = mntns
+
+	// Have the mount-tree ready for the first mount syscalls to be intercepted.
+	if e.parsed[1] == nil {
+		parsed, err := parseMountInfoLines(e.data, true, nil)
+		if err != nil {
+			return err
+		}
+		e.parsed[1] = parsed
+	}
+
+	return nil
+}
+
+// untrack stops tracking the mount namespace of the given sys container, which
+// is then dropped from the cache as any other untracked namespace.
+func (c *mountInfoCache) untrack(id string) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	mntns, ok := c.tracked[id]
+	if !ok {
+		return
+	}
+	delete(c.tracked, id)
+
+	for _, ns := range c.tracked {
+		if ns == mntns {
+			return
+		}
+	}
+
+	if e, ok := c.entries[mntns]; ok {
+		c.unwatch(e)
+		e.lastUsed = time.Now()
+	}
+}
+
+// Stops watching the given entry's mount namespace (if watched).
+func (c *mountInfoCache) unwatch(e *mountInfoCacheEntry) {
+
+	if e.watch == nil {
+		return
+	}
+
+	fd := int32(e.watch.Fd())
+	unix.EpollCtl(c.epfd, unix.EPOLL_CTL_DEL, int(fd), nil)
+	delete(c.watched, fd)
+
+	e.watch.Close()
+	e.watch = nil
+}
+
+// Refreshes the tracked mount namespaces as their mount-tables change.
+func (c *mountInfoCache) watcher(epfd int) {
+
+	events := make([]unix.EpollEvent, 16)
+
+	for {
+		n, err := unix.EpollWait(epfd, events, -1)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			logrus.Errorf("Mountinfo watcher terminated: %s", err)
+			return
+		}
+
+		c.Lock()
+		for i := 0; i < n; i++ {
+			mntns, ok := c.watched[events[i].Fd]
+			if !ok {
+				continue
+			}
+			e, ok := c.entries[mntns]
+			if !ok {
+				continue
+			}
+			if err := c.refresh(mntns, e, false); err != nil {
+				logrus.Debugf("Unable to refresh mountinfo of mount-ns %d: %s",
+					mntns, err)
+			}
+		}
+		c.Unlock()
+	}
+}
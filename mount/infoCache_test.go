@@ -0,0 +1,179 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+func TestParseMountInfoLines(t *testing.T) {
+
+	prev, err := parseMountInfoLines(mountInfoData, true, nil)
+	if err != nil {
+		t.Fatalf("parseMountInfoLines() failed: %v", err)
+	}
+
+	// An inner container's rootfs gets mounted.
+	line := "1800 1526 0:120 / /var/lib/docker/overlay2/abc/merged rw,relatime - overlay overlay rw"
+	data := append(append([]byte(nil), mountInfoData...), []byte(line+"\n")...)
+
+	parsed, err := parseMountInfoLines(data, true, prev)
+	if err != nil {
+		t.Fatalf("parseMountInfoLines() failed: %v", err)
+	}
+
+	if len(parsed.mounts) != len(prev.mounts)+1 {
+		t.Fatalf("got %d mounts, want %d", len(parsed.mounts), len(prev.mounts)+1)
+	}
+
+	// Previously parsed lines are reused, and only the new one is parsed.
+	for i, info := range prev.mounts {
+		if parsed.mounts[i] != info {
+			t.Errorf("mount %s unexpectedly re-parsed", info.MountPoint)
+		}
+	}
+
+	info := parsed.mounts[len(parsed.mounts)-1]
+	if info.MountID != 1800 || info.FsType != "overlay" || info.Options == nil {
+		t.Errorf("unexpected new mount: %+v", info)
+	}
+}
+
+func TestMountInfoCache(t *testing.T) {
+
+	data, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		t.Skip("mountinfo not available")
+	}
+
+	c := newMountInfoCache()
+
+	m1, err := c.mounts("c1", uint32(os.Getpid()), 1, false, false)
+	if err != nil {
+		t.Fatalf("mounts() failed: %v", err)
+	}
+	if len(m1) == 0 {
+		t.Fatalf("no mounts found")
+	}
+
+	// Unless the mount namespace changes, mounts are served out of the cache.
+	m2, err := c.mounts("c1", uint32(os.Getpid()), 1, false, false)
+	if err != nil {
+		t.Fatalf("mounts() failed: %v", err)
+	}
+	if &m1[0] != &m2[0] {
+		t.Errorf("mountinfo unexpectedly re-parsed")
+	}
+}
+
+func TestMountInfoCacheTracking(t *testing.T) {
+
+	data, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		t.Skip("mountinfo not available")
+	}
+
+	c := newMountInfoCache()
+	pid := uint32(os.Getpid())
+
+	// Untracked namespaces are not served to chroot'ed processes.
+	if _, err := c.mounts("c1", pid, 1, true, true); err == nil {
+		t.Errorf("untracked mount-ns unexpectedly served")
+	}
+
+	if err := c.track("c1", pid, 1); err != nil {
+		t.Fatalf("track() failed: %v", err)
+	}
+	if err := c.track("c2", pid, 1); err != nil {
+		t.Fatalf("track() failed: %v", err)
+	}
+
+	mounts, err := c.mounts("c1", pid, 1, true, true)
+	if err != nil {
+		t.Fatalf("mounts() failed: %v", err)
+	}
+	if len(mounts) == 0 {
+		t.Fatalf("no mounts found")
+	}
+
+	// Tracked namespaces are never evicted.
+	c.evict(time.Now().Add(2 * mountInfoCacheTTL))
+	if _, ok := c.entries[1]; !ok {
+		t.Fatalf("tracked mount-ns unexpectedly evicted")
+	}
+
+	// Namespaces remain tracked as long as any of their containers is.
+	c.untrack("c1")
+	if c.entries[1].watch == nil {
+		t.Fatalf("mount-ns unexpectedly untracked")
+	}
+
+	c.untrack("c2")
+	if c.entries[1].watch != nil || len(c.watched) != 0 {
+		t.Fatalf("mount-ns unexpectedly tracked")
+	}
+
+	c.evict(time.Now().Add(2 * mountInfoCacheTTL))
+	if _, ok := c.entries[1]; ok {
+		t.Errorf("untracked mount-ns not evicted")
+	}
+}
+
+func TestMountInfoCacheCntrCap(t *testing.T) {
+
+	data, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		t.Skip("mountinfo not available")
+	}
+
+	c := newMountInfoCache()
+	pid := uint32(os.Getpid())
+
+	if err := c.track("c1", pid, 1); err != nil {
+		t.Fatalf("track() failed: %v", err)
+	}
+
+	for ns := domain.Inode(2); ns <= mountInfoCacheMaxCntrEntries+1; ns++ {
+		if _, err := c.mounts("c1", pid, ns, false, false); err != nil {
+			t.Fatalf("mounts() failed: %v", err)
+		}
+	}
+	if _, err := c.mounts("c2", pid, 1000, false, false); err != nil {
+		t.Fatalf("mounts() failed: %v", err)
+	}
+
+	// Beyond the cap, the least recently queried (untracked) namespaces of the
+	// container are evicted.
+	if n := c.cntrEntries("c1"); n != mountInfoCacheMaxCntrEntries {
+		t.Errorf("c1 has %d cached entries, want %d", n, mountInfoCacheMaxCntrEntries)
+	}
+	if _, ok := c.entries[1]; !ok {
+		t.Errorf("tracked mount-ns unexpectedly evicted")
+	}
+	if _, ok := c.entries[2]; ok {
+		t.Errorf("least recently used mount-ns not evicted")
+	}
+	if _, ok := c.entries[1000]; !ok {
+		t.Errorf("mount-ns of other container unexpectedly evicted")
+	}
+}
@@ -40,6 +40,11 @@
 // "/proc" is a sysbox-fs managed base mount.
 // "/proc/*" are sysbox-fs managed submounts used to expose, hide, or emulate portions of procfs.
 //
+// Note that only the submounts backed by sysbox-fs' fuse file-system (i.e., "fuse"
+// fstype and "sysboxfs" source) are considered emulated ones; a mount placed by the
+// user over an emulated mountpoint (e.g., a tmpfs over /proc/uptime after unmounting
+// the sysbox-fs one) is not managed by sysbox-fs.
+//
 // Same applies to sysfs mounts.
 
 package mount
@@ -49,6 +54,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -111,18 +117,26 @@ func newMountInfoParser(
 // input parameter for benchmarking purposes.
 func (mi *mountInfoParser) parse() error {
 
-	data, err := mi.extractMountInfo()
-	if err != nil {
-		return err
-	}
+	if mounts, ok := mi.cachedMounts(); ok {
+		for _, m := range mounts {
+			info := *m
+			info.Mip = mi
+			mi.addMount(&info)
+		}
 
-	if err := mi.parseData(data); err != nil {
-		return err
+	} else {
+		data, err := mi.extractMountInfo()
+		if err != nil {
+			return err
+		}
+
+		if err := mi.parseData(data); err != nil {
+			return err
+		}
 	}
 
 	if mi.fetchInodes {
-		err = mi.extractAllInodes()
-		if err != nil {
+		if err := mi.extractAllInodes(); err != nil {
 			return err
 		}
 	}
@@ -130,6 +144,35 @@ func (mi *mountInfoParser) parse() error {
 	return nil
 }
 
+// cachedMounts returns the process' mounts out of the mount service's
+// mountinfo cache (see mountInfoCache), if applicable.
+func (mi *mountInfoParser) cachedMounts() ([]*domain.MountInfo, bool) {
+
+	if mi.service == nil || mi.service.mic == nil {
+		return nil, false
+	}
+
+	mntns, err := mi.process.MountNsInode()
+	if err != nil {
+		return nil, false
+	}
+
+	// The mountinfo of chroot'ed processes is specific to them, so these are
+	// served only out of the tracked mount namespaces, whose mountinfo is the
+	// one obtained through nsenter (i.e., as seen from the namespace's root).
+	trackedOnly := mi.process.Root() != "/"
+
+	mounts, err := mi.service.mic.mounts(
+		mi.cntr.ID(), mi.process.Pid(), mntns, mi.fetchOptions, trackedOnly)
+	if err != nil {
+		logrus.Debugf("Unable to obtain cached mountinfo for pid = %d: %s",
+			mi.process.Pid(), err)
+		return nil, false
+	}
+
+	return mounts, true
+}
+
 // parseData parses the process' mountinfo file and extracts the info for the
 // base mount and it's submounts.
 func (mi *mountInfoParser) parseData(data []byte) error {
@@ -143,23 +186,29 @@ func (mi *mountInfoParser) parseData(data []byte) error {
 			return err
 		}
 
-		mi.mpInfo[parsedMounts.MountPoint] = parsedMounts
-		mi.idInfo[parsedMounts.MountID] = parsedMounts
-
-		// File-system-id map utilized for remount / unmount processing.
-		fsIdSlice, ok := mi.fsIdInfo[parsedMounts.MajorMinorVer]
-		if ok {
-			mi.fsIdInfo[parsedMounts.MajorMinorVer] =
-				append(fsIdSlice, parsedMounts)
-		} else {
-			mi.fsIdInfo[parsedMounts.MajorMinorVer] =
-				[]*domain.MountInfo{parsedMounts}
-		}
+		mi.addMount(parsedMounts)
 	}
 
 	return scanner.Err()
 }
 
+// addMount indexes the given mount within the parser's maps.
+func (mi *mountInfoParser) addMount(parsedMounts *domain.MountInfo) {
+
+	mi.mpInfo[parsedMounts.MountPoint] = parsedMounts
+	mi.idInfo[parsedMounts.MountID] = parsedMounts
+
+	// File-system-id map utilized for remount / unmount processing.
+	fsIdSlice, ok := mi.fsIdInfo[parsedMounts.MajorMinorVer]
+	if ok {
+		mi.fsIdInfo[parsedMounts.MajorMinorVer] =
+			append(fsIdSlice, parsedMounts)
+	} else {
+		mi.fsIdInfo[parsedMounts.MajorMinorVer] =
+			[]*domain.MountInfo{parsedMounts}
+	}
+}
+
 // parseComponents parses a mountinfo file line.
 func (mi *mountInfoParser) parseComponents(data string) (*domain.MountInfo, error) {
 
@@ -482,27 +531,41 @@ func (mi *mountInfoParser) isSysboxfsSubMountOf(info, baseInfo *domain.MountInfo
 
 	relMountpoint := strings.TrimPrefix(info.MountPoint, baseInfo.MountPoint)
 
+	// Emulated submounts are only managed by sysbox-fs as long as they are
+	// backed by sysbox-fs' fuse file-system; exposed (read-only) and masked
+	// ones are bind-mounts of other file-systems.
 	switch baseInfo.FsType {
 	case "proc":
-		if isMountpointUnder(relMountpoint, mi.service.mh.procMounts) ||
-			isMountpointUnder(relMountpoint, mi.cntr.ProcRoPaths()) ||
-			isMountpointUnder(relMountpoint, mi.cntr.ProcMaskPaths()) {
+		mp := filepath.Join("/proc", relMountpoint)
+		if isMountpointUnder(mp, mi.service.mh.procMounts) {
+			return mi.isSysboxfsFuseMount(info)
+		}
+		if isMountpointUnder(mp, mi.cntr.ProcRoPaths()) ||
+			isMountpointUnder(mp, mi.cntr.ProcMaskPaths()) {
 			return true
 		}
 	case "sysfs":
-		if isMountpointUnder(relMountpoint, mi.service.mh.sysMounts) {
-			return true
+		mp := filepath.Join("/sys", relMountpoint)
+		if isMountpointUnder(mp, mi.service.mh.sysMounts) {
+			return mi.isSysboxfsFuseMount(info)
 		}
 	}
 
 	return false
 }
 
-// isMountpointUnder returns true if the given mountpoint is under of one the
-// mountpoints in the given set.
+// isSysboxfsFuseMount checks if the given mountpoint is backed by sysbox-fs'
+// fuse file-system.
+func (mi *mountInfoParser) isSysboxfsFuseMount(info *domain.MountInfo) bool {
+	return info.FsType == "fuse" && info.Source == "sysboxfs"
+}
+
+// isMountpointUnder returns true if the given mountpoint matches, or is under,
+// one of the mountpoints in the given set (e.g., "/sys/module/nf_conntrack/
+// parameters/hashsize" is under "/sys/module/nf_conntrack/parameters").
 func isMountpointUnder(mountpoint string, mpSet []string) bool {
 	for _, mp := range mpSet {
-		if strings.HasSuffix(mp, mountpoint) {
+		if mountpoint == mp || strings.HasPrefix(mountpoint, mp+"/") {
 			return true
 		}
 	}
@@ -536,6 +599,20 @@ func (mi *mountInfoParser) GetInfo(mountpoint string) *domain.MountInfo {
 	return info
 }
 
+// GetMountOf returns the mountinfo of the mount containing the given path
+// (i.e., the one at its closest ancestor mountpoint).
+func (mi *mountInfoParser) GetMountOf(path string) *domain.MountInfo {
+
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if info, found := mi.mpInfo[p]; found {
+			return info
+		}
+		if p == "/" || p == "." {
+			return nil
+		}
+	}
+}
+
 // GetProcessID returns the pid of the process that triggered the creation of
 // a mountInfoParser object.
 func (mi *mountInfoParser) GetProcessID() uint32 {
@@ -614,6 +691,18 @@ func (mi *mountInfoParser) IsSysboxfsSubmount(mountpoint string) bool {
 	return mi.isSysboxfsSubMount(info)
 }
 
+// IsSysboxfsFuseMount checks if the given mountpoint is backed by sysbox-fs'
+// fuse file-system (i.e., it's a sysbox-fs emulated mountpoint).
+func (mi *mountInfoParser) IsSysboxfsFuseMount(mountpoint string) bool {
+
+	info, found := mi.mpInfo[mountpoint]
+	if !found {
+		return false
+	}
+
+	return mi.isSysboxfsFuseMount(info)
+}
+
 // IsSysboxfsRoSubmount checks if the given mountpoint is a sysbox-fs managed
 // submount that is mounted as read-only.
 func (mi *mountInfoParser) IsSysboxfsRoSubmount(mountpoint string) bool {
@@ -629,11 +718,12 @@ func (mi *mountInfoParser) IsSysboxfsRoSubmount(mountpoint string) bool {
 
 	baseInfo := mi.GetParentMount(info)
 
-	// "/some/path/proc/uptime" -> "/uptime"
+	// "/some/path/proc/uptime" -> "/proc/uptime"
 	relMp := strings.TrimPrefix(mountpoint, baseInfo.MountPoint)
+	procMp := filepath.Join("/proc", relMp)
 
 	if baseInfo.FsType == "proc" {
-		if isMountpointUnder(relMp, mi.cntr.ProcRoPaths()) {
+		if isMountpointUnder(procMp, mi.cntr.ProcRoPaths()) {
 			return true
 		}
 	}
@@ -656,11 +746,12 @@ func (mi *mountInfoParser) IsSysboxfsMaskedSubmount(mountpoint string) bool {
 
 	baseInfo := mi.GetParentMount(info)
 
-	// "/some/path/proc/uptime" -> "/uptime"
+	// "/some/path/proc/uptime" -> "/proc/uptime"
 	relMp := strings.TrimPrefix(mountpoint, baseInfo.MountPoint)
+	procMp := filepath.Join("/proc", relMp)
 
 	if baseInfo.FsType == "proc" {
-		if isMountpointUnder(relMp, mi.cntr.ProcMaskPaths()) {
+		if isMountpointUnder(procMp, mi.cntr.ProcMaskPaths()) {
 			return true
 		}
 	}
@@ -718,6 +809,32 @@ func (mi *mountInfoParser) IsRoMount(info *domain.MountInfo) bool {
 	return perMountFlags&unix.MS_RDONLY == unix.MS_RDONLY
 }
 
+// IsIDMappedMount checks if the passed mountinfo entry is an ID-mapped mount
+// (kernel 5.12+), that is, a mount whose files' ownership is translated through
+// the user-ns attached to it.
+func (mi *mountInfoParser) IsIDMappedMount(info *domain.MountInfo) bool {
+
+	if info == nil {
+		return false
+	}
+
+	_, ok := info.Options["idmapped"]
+
+	return ok
+}
+
+// IsShiftfsMount checks if the passed mountinfo entry is a shiftfs mount, which,
+// like ID-mapped mounts, translates the ownership of the underlying files into
+// the mounter's user-ns.
+func (mi *mountInfoParser) IsShiftfsMount(info *domain.MountInfo) bool {
+
+	if info == nil {
+		return false
+	}
+
+	return info.FsType == "shiftfs"
+}
+
 // IsRecursiveBindMount verifies if the passed mountinfo entry is a recursive
 // bind-mount.
 //
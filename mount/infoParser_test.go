@@ -102,3 +102,78 @@ func Benchmark_parseData(b *testing.B) {
 		}
 	}
 }
+
+func TestIsMountpointUnder(t *testing.T) {
+
+	mpSet := []string{
+		"/proc/sys",
+		"/proc/uptime",
+		"/sys/module/nf_conntrack/parameters",
+	}
+
+	tests := []struct {
+		mountpoint string
+		want       bool
+	}{
+		{"/proc/sys", true},
+		{"/proc/uptime", true},
+		{"/sys/module/nf_conntrack/parameters", true},
+		{"/sys/module/nf_conntrack/parameters/hashsize", true},
+		{"/proc/sys/net", true},
+		{"/proc/sysrq-trigger", false},
+		{"/proc/bus", false},
+		{"/uptime", false},
+		{"/proc", false},
+	}
+
+	for _, tt := range tests {
+		if got := isMountpointUnder(tt.mountpoint, mpSet); got != tt.want {
+			t.Errorf("isMountpointUnder(%q) = %v; want %v", tt.mountpoint, got, tt.want)
+		}
+	}
+}
+
+func TestMountInfoParserIDMappedMounts(t *testing.T) {
+
+	mi := &mountInfoParser{
+		fetchOptions: true,
+		mpInfo:       make(map[string]*domain.MountInfo),
+		idInfo:       make(map[int]*domain.MountInfo),
+		fsIdInfo:     make(map[string][]*domain.MountInfo),
+	}
+
+	data := append(mountInfoData,
+		[]byte("1800 1526 8:1 /vol /mnt/vol rw,relatime,idmapped - ext4 /dev/sda1 rw\n")...)
+
+	if err := mi.parseData(data); err != nil {
+		t.Fatalf("parseData() failed: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		mountpoint string
+		idmapped   bool
+		shiftfs    bool
+	}{
+		{"/", "/", false, true},
+		{"/usr/bin/ls", "/", false, true},
+		{"/var/lib/docker/overlay2/l", "/var/lib/docker", false, false},
+		{"/mnt/vol", "/mnt/vol", true, false},
+		{"/mnt/vol/upper", "/mnt/vol", true, false},
+		{"/mnt/volume", "/", false, true},
+	}
+
+	for _, tt := range tests {
+		info := mi.GetMountOf(tt.path)
+		if info == nil || info.MountPoint != tt.mountpoint {
+			t.Errorf("GetMountOf(%q) = %v; want mountpoint %q", tt.path, info, tt.mountpoint)
+			continue
+		}
+		if got := mi.IsIDMappedMount(info); got != tt.idmapped {
+			t.Errorf("IsIDMappedMount(%q) = %v; want %v", tt.path, got, tt.idmapped)
+		}
+		if got := mi.IsShiftfsMount(info); got != tt.shiftfs {
+			t.Errorf("IsShiftfsMount(%q) = %v; want %v", tt.path, got, tt.shiftfs)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// RemountSysboxfs replaces the sysbox-fs mounts of the given container with
+// fresh ones obtained from the fuse-server mounted at 'mountpoint'. This is
+// required once a container's fuse-server is recreated after its connection
+// was aborted, as the container's mounts remain bound to the dead connection
+// (i.e., any access to them fails with ENOTCONN).
+//
+// Each mount is cloned out of the new fuse mount through open_tree(), and moved
+// over the stale one within the namespaces of the container's init process.
+// Notice that only the mounts of the init process' mount namespace are
+// recovered; the ones in nested mount namespaces (e.g., inner containers or
+// chroot jails with their own procfs) remain stale.
+func (mts *MountService) RemountSysboxfs(
+	c domain.ContainerIface,
+	mountpoint string) error {
+
+	initProc := c.InitProc()
+	if initProc == nil {
+		return fmt.Errorf("no init process found for container %s", c.ID())
+	}
+
+	mip, err := newMountInfoParser(c, initProc, true, true, false, mts)
+	if err != nil {
+		return err
+	}
+
+	var mounts []*domain.MountInfo
+	for _, info := range mip.mpInfo {
+		if mip.isSysboxfsFuseMount(info) {
+			mounts = append(mounts, info)
+		}
+	}
+
+	// Parent mounts go first, as replacing them drops their submounts.
+	sort.Slice(mounts, func(i, j int) bool {
+		return len(mounts[i].MountPoint) < len(mounts[j].MountPoint)
+	})
+
+	var payload []*domain.RemountFusePayload
+	defer func() {
+		for _, p := range payload {
+			p.File.Close()
+		}
+	}()
+
+	for _, info := range mounts {
+		src := filepath.Join(mountpoint, info.Root)
+
+		fd, err := openTreeClone(src)
+		if err != nil {
+			return fmt.Errorf("unable to clone mount of %s: %v", src, err)
+		}
+
+		payload = append(payload, &domain.RemountFusePayload{
+			Target: info.MountPoint,
+			Rdonly: mip.IsRoMount(info),
+			File:   os.NewFile(uintptr(fd), src),
+		})
+	}
+
+	if len(payload) == 0 {
+		return nil
+	}
+
+	if err := mts.sendBindMountsEvent(
+		c, domain.RemountFuseRequest, &payload); err != nil {
+		return err
+	}
+
+	logrus.Infof("Remounted %d sysbox-fs mounts in container %s",
+		len(payload), c.ID())
+
+	return nil
+}
+
+// Returns a detached clone of the mount at the given path (i.e., the equivalent
+// of a bind-mount yet to be attached anywhere).
+func openTreeClone(path string) (int, error) {
+
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+
+	dirFd := unix.AT_FDCWD
+
+	fd, _, errno := unix.Syscall(
+		unix.SYS_OPEN_TREE,
+		uintptr(dirFd),
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC))
+	if errno != 0 {
+		return -1, errno
+	}
+
+	return int(fd), nil
+}
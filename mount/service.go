@@ -17,6 +17,9 @@
 package mount
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/nestybox/sysbox-fs/domain"
 )
 
@@ -35,6 +38,20 @@ import (
 //   stall its FSM.
 
 var ProcfsMounts = []string{
+	"/proc/cgroups",
+	"/proc/cpuinfo",
+	"/proc/crypto",
+	"/proc/devices",
+	"/proc/kallsyms",
+	"/proc/keys",
+	"/proc/key-users",
+	"/proc/kmsg",
+	"/proc/modules",
+	"/proc/schedstat",
+	"/proc/softirqs",
+	"/proc/stat",
+	"/proc/sysvipc",
+	"/proc/timer_list",
 	"/proc/uptime",
 	"/proc/swaps",
 	"/proc/sys",
@@ -42,8 +59,14 @@ var ProcfsMounts = []string{
 
 var SysfsMounts = []string{
 	"/sys/kernel",
+	"/sys/class/net",
+	"/sys/class/tty",
+	"/sys/devices/system/cpu",
 	"/sys/devices/virtual",
+	"/sys/firmware",
+	"/sys/fs/cgroup",
 	"/sys/module/nf_conntrack/parameters",
+	"/sys/power",
 }
 
 type MountService struct {
@@ -52,10 +75,17 @@ type MountService struct {
 	hds domain.HandlerServiceIface        // for handler package interactions
 	prs domain.ProcessServiceIface        // for process package interactions
 	nss domain.NSenterServiceIface        // for nsexec package interactions
+	mic *mountInfoCache                   // mountinfo cache shared by parsers
+
+	bmLock     sync.Mutex
+	bindMounts map[string][]domain.Mount // bind-mounts set up per container
 }
 
 func NewMountService() *MountService {
-	return &MountService{}
+	return &MountService{
+		mic:        newMountInfoCache(),
+		bindMounts: make(map[string][]domain.Mount),
+	}
 }
 
 func (mts *MountService) Setup(
@@ -108,3 +138,34 @@ func (mts *MountService) NewMountHelper() domain.MountHelperIface {
 func (mts *MountService) MountHelper() domain.MountHelperIface {
 	return mts.mh
 }
+
+// TrackMounts keeps track of the mount-table of the given sys container's mount
+// namespace, so that mountinfo parsers are served out of a live mount-tree (see
+// mountInfoCache).
+func (mts *MountService) TrackMounts(c domain.ContainerIface) error {
+
+	if mts.mic == nil {
+		return nil
+	}
+
+	initProc := c.InitProc()
+	if initProc == nil {
+		return fmt.Errorf("no init process found for container %s", c.ID())
+	}
+
+	mntns, err := initProc.MountNsInode()
+	if err != nil {
+		return err
+	}
+
+	return mts.mic.track(c.ID(), c.InitPid(), mntns)
+}
+
+func (mts *MountService) UntrackMounts(c domain.ContainerIface) {
+
+	if mts.mic == nil {
+		return
+	}
+
+	mts.mic.untrack(c.ID())
+}
@@ -0,0 +1,182 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Fixed-format encoding of the nsenter messages exchanged in the FUSE hot path
+// (i.e., file reads / writes), which are by far the most frequent ones. These
+// messages carry just a path, an offset, a length and (possibly) some data, so
+// they are laid out in a fixed binary format, sparing the cost of json
+// (de)serialization (e.g., base64 encoding of the data) for every read / write
+// of an emulated resource. The rest of the messages are json encoded.
+//
+// Layout (big-endian):
+//
+//   magic (1) | type (1) | offset (8) | len (4) | path-len (2) | data-len (4) |
+//   path | data
+//
+// The magic byte tells fixed-format messages apart from json ones, which can't
+// start with it.
+//
+
+const fixedMsgMagic byte = 0xfe
+
+const fixedMsgHdrLen = 20
+
+// Upper bound of the path and data carried by a fixed-format message, so that a
+// corrupted header can't trigger arbitrarily large allocations. Larger messages
+// are json encoded.
+const fixedMsgMaxPayload = 16 << 20
+
+var fixedMsgCodes = map[domain.NSenterMsgType]byte{
+	domain.ReadFileRequest:   1,
+	domain.ReadFileResponse:  2,
+	domain.WriteFileRequest:  3,
+	domain.WriteFileResponse: 4,
+}
+
+var fixedMsgTypes = map[byte]domain.NSenterMsgType{
+	1: domain.ReadFileRequest,
+	2: domain.ReadFileResponse,
+	3: domain.WriteFileRequest,
+	4: domain.WriteFileResponse,
+}
+
+// Fields carried by a fixed-format message.
+type fixedMsg struct {
+	path   string
+	offset int64
+	len    int
+	data   []byte
+}
+
+// Extracts the fields of the given message. Returns false if the message can't
+// be fixed-format encoded.
+func fixedMsgFields(m *domain.NSenterMessage) (fixedMsg, bool) {
+
+	switch p := m.Payload.(type) {
+	case *domain.ReadFilePayload:
+		return fixedMsg{path: p.File, offset: p.Offset, len: p.Len}, true
+	case domain.ReadFilePayload:
+		return fixedMsg{path: p.File, offset: p.Offset, len: p.Len}, true
+	case *domain.WriteFilePayload:
+		return fixedMsg{path: p.File, offset: p.Offset, data: p.Data}, true
+	case domain.WriteFilePayload:
+		return fixedMsg{path: p.File, offset: p.Offset, data: p.Data}, true
+	case []byte:
+		return fixedMsg{data: p}, m.Type == domain.ReadFileResponse
+	case nil:
+		return fixedMsg{}, m.Type == domain.WriteFileResponse
+	}
+
+	return fixedMsg{}, false
+}
+
+// Encodes the given message, in fixed format if possible, or json otherwise.
+func encodeMsg(m *domain.NSenterMessage) ([]byte, error) {
+
+	code, ok := fixedMsgCodes[m.Type]
+	if !ok {
+		return json.Marshal(*m)
+	}
+
+	f, ok := fixedMsgFields(m)
+	if !ok || len(f.path) > 0xffff || f.len < 0 || int64(f.len) > 0xffffffff ||
+		len(f.path)+len(f.data) > fixedMsgMaxPayload {
+		return json.Marshal(*m)
+	}
+
+	buf := make([]byte, fixedMsgHdrLen+len(f.path)+len(f.data))
+
+	buf[0] = fixedMsgMagic
+	buf[1] = code
+	binary.BigEndian.PutUint64(buf[2:], uint64(f.offset))
+	binary.BigEndian.PutUint32(buf[10:], uint32(f.len))
+	binary.BigEndian.PutUint16(buf[14:], uint16(len(f.path)))
+	binary.BigEndian.PutUint32(buf[16:], uint32(len(f.data)))
+	copy(buf[fixedMsgHdrLen:], f.path)
+	copy(buf[fixedMsgHdrLen+len(f.path):], f.data)
+
+	return buf, nil
+}
+
+// Decodes a fixed-format message from the given reader. Returns false (and
+// consumes nothing) if the next message is not a fixed-format one, in which
+// case it must be json decoded. Decoded payloads match the ones produced by
+// json decoding (i.e., payload values, not pointers).
+func decodeFixedMsg(r *bufio.Reader) (*domain.NSenterMessage, bool, error) {
+
+	magic, err := r.Peek(1)
+	if err != nil {
+		return nil, false, err
+	}
+	if magic[0] != fixedMsgMagic {
+		return nil, false, nil
+	}
+
+	hdr := make([]byte, fixedMsgHdrLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, true, err
+	}
+
+	msgType, ok := fixedMsgTypes[hdr[1]]
+	if !ok {
+		return nil, true, fmt.Errorf("unknown fixed-format message type %d", hdr[1])
+	}
+
+	offset := int64(binary.BigEndian.Uint64(hdr[2:]))
+	length := int(binary.BigEndian.Uint32(hdr[10:]))
+	pathLen := int(binary.BigEndian.Uint16(hdr[14:]))
+	dataLen := int(binary.BigEndian.Uint32(hdr[16:]))
+
+	if pathLen+dataLen > fixedMsgMaxPayload {
+		return nil, true, fmt.Errorf("oversized fixed-format message payload (%d bytes)",
+			pathLen+dataLen)
+	}
+
+	body := make([]byte, pathLen+dataLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, true, err
+	}
+	path := string(body[:pathLen])
+	data := body[pathLen:]
+
+	m := &domain.NSenterMessage{Type: msgType}
+
+	switch msgType {
+	case domain.ReadFileRequest:
+		m.Payload = domain.ReadFilePayload{File: path, Offset: offset, Len: length}
+	case domain.ReadFileResponse:
+		m.Payload = data
+	case domain.WriteFileRequest:
+		m.Payload = domain.WriteFilePayload{File: path, Offset: offset, Data: data}
+	case domain.WriteFileResponse:
+		m.Payload = ""
+	}
+
+	return m, true, nil
+}
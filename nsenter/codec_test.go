@@ -0,0 +1,215 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+
+	const file = "/proc/sys/net/core/somaxconn"
+
+	tests := []struct {
+		name string
+		msg  *domain.NSenterMessage
+		want interface{} // decoded payload
+	}{
+		{
+			"read-request",
+			&domain.NSenterMessage{
+				Type:    domain.ReadFileRequest,
+				Payload: &domain.ReadFilePayload{File: file, Offset: 8, Len: 4096},
+			},
+			domain.ReadFilePayload{File: file, Offset: 8, Len: 4096},
+		},
+		{
+			"read-request-value",
+			&domain.NSenterMessage{
+				Type:    domain.ReadFileRequest,
+				Payload: domain.ReadFilePayload{File: file, Len: 1 << 20},
+			},
+			domain.ReadFilePayload{File: file, Len: 1 << 20},
+		},
+		{
+			"read-response",
+			&domain.NSenterMessage{
+				Type:    domain.ReadFileResponse,
+				Payload: []byte("4096\n"),
+			},
+			[]byte("4096\n"),
+		},
+		{
+			"write-request",
+			&domain.NSenterMessage{
+				Type:    domain.WriteFileRequest,
+				Payload: &domain.WriteFilePayload{File: file, Offset: 2, Data: []byte("1024\n")},
+			},
+			domain.WriteFilePayload{File: file, Offset: 2, Data: []byte("1024\n")},
+		},
+		{
+			"write-request-value",
+			&domain.NSenterMessage{
+				Type:    domain.WriteFileRequest,
+				Payload: domain.WriteFilePayload{File: file, Data: []byte{}},
+			},
+			domain.WriteFilePayload{File: file, Data: []byte{}},
+		},
+		{
+			"write-response",
+			&domain.NSenterMessage{
+				Type: domain.WriteFileResponse,
+			},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := encodeMsg(tt.msg)
+		if err != nil {
+			t.Errorf("%s: encodeMsg() failed: %v", tt.name, err)
+			continue
+		}
+		if data[0] != fixedMsgMagic {
+			t.Errorf("%s: encodeMsg() didn't produce a fixed-format message", tt.name)
+			continue
+		}
+
+		r := bufio.NewReader(bytes.NewReader(data))
+
+		m, fixed, err := decodeFixedMsg(r)
+		if err != nil || !fixed {
+			t.Errorf("%s: decodeFixedMsg() = %v, %v; want a fixed-format message",
+				tt.name, fixed, err)
+			continue
+		}
+		if m.Type != tt.msg.Type {
+			t.Errorf("%s: decoded type %v, want %v", tt.name, m.Type, tt.msg.Type)
+		}
+		if !reflect.DeepEqual(m.Payload, tt.want) {
+			t.Errorf("%s: decoded payload %#v, want %#v", tt.name, m.Payload, tt.want)
+		}
+		if _, err := r.Peek(1); err != io.EOF {
+			t.Errorf("%s: decodeFixedMsg() didn't consume the whole message", tt.name)
+		}
+	}
+}
+
+func TestCodecJson(t *testing.T) {
+
+	tests := []struct {
+		name string
+		msg  *domain.NSenterMessage
+	}{
+		{
+			"unsupported-type",
+			&domain.NSenterMessage{Type: domain.SleepRequest},
+		},
+		{
+			"oversized-path",
+			&domain.NSenterMessage{
+				Type:    domain.ReadFileRequest,
+				Payload: &domain.ReadFilePayload{File: strings.Repeat("a", 0x10000)},
+			},
+		},
+		{
+			"oversized-data",
+			&domain.NSenterMessage{
+				Type:    domain.ReadFileResponse,
+				Payload: make([]byte, fixedMsgMaxPayload+1),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := encodeMsg(tt.msg)
+		if err != nil {
+			t.Errorf("%s: encodeMsg() failed: %v", tt.name, err)
+			continue
+		}
+		if data[0] != '{' {
+			t.Errorf("%s: encodeMsg() didn't fall back to json", tt.name)
+			continue
+		}
+
+		// Json messages are left for the json decoder.
+		r := bufio.NewReader(bytes.NewReader(data))
+
+		if m, fixed, err := decodeFixedMsg(r); m != nil || fixed || err != nil {
+			t.Errorf("%s: decodeFixedMsg() = %v, %v, %v; want a json message",
+				tt.name, m, fixed, err)
+		}
+		if b, _ := r.Peek(1); len(b) != 1 || b[0] != '{' {
+			t.Errorf("%s: decodeFixedMsg() consumed a json message", tt.name)
+		}
+	}
+}
+
+func TestCodecDecodeErrors(t *testing.T) {
+
+	// Returns a fixed-format header with the given fields.
+	hdr := func(code byte, pathLen uint16, dataLen uint32) []byte {
+		buf := make([]byte, fixedMsgHdrLen)
+		buf[0] = fixedMsgMagic
+		buf[1] = code
+		binary.BigEndian.PutUint16(buf[14:], pathLen)
+		binary.BigEndian.PutUint32(buf[16:], dataLen)
+		return buf
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		fixed bool
+	}{
+		{"empty", nil, false},
+		{"truncated-header", hdr(1, 0, 0)[:fixedMsgHdrLen-1], true},
+		{"unknown-type", hdr(0x7f, 0, 0), true},
+		{"truncated-body", append(hdr(3, 4, 4), "/foo"...), true},
+		{"oversized-payload", hdr(2, 0, fixedMsgMaxPayload+1), true},
+		{"oversized-path-and-data", hdr(3, 0xffff, fixedMsgMaxPayload), true},
+	}
+
+	for _, tt := range tests {
+		r := bufio.NewReader(bytes.NewReader(tt.data))
+
+		m, fixed, err := decodeFixedMsg(r)
+		if m != nil || fixed != tt.fixed || err == nil {
+			t.Errorf("%s: decodeFixedMsg() = %v, %v, %v; want an error",
+				tt.name, m, fixed, err)
+		}
+	}
+
+	// Bad magic: not a fixed-format message, nothing consumed.
+	r := bufio.NewReader(bytes.NewReader([]byte{0xfd, 1, 2, 3}))
+
+	if m, fixed, err := decodeFixedMsg(r); m != nil || fixed || err != nil {
+		t.Errorf("bad-magic: decodeFixedMsg() = %v, %v, %v; want no message",
+			m, fixed, err)
+	}
+	if b, _ := r.Peek(1); len(b) != 1 || b[0] != 0xfd {
+		t.Errorf("bad-magic: decodeFixedMsg() consumed the message")
+	}
+}
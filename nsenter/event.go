@@ -17,6 +17,7 @@
 package nsenter
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -52,6 +53,10 @@ func init() {
 	}
 }
 
+// Max time an nsenter request waits for an nsenter slot to become available,
+// when the max number of concurrent nsenter requests is reached.
+const nsenterWaitTimeout = 5 * time.Second
+
 // Pid struct. Utilized by sysbox-runc's nsexec code.
 type pid struct {
 	Pid           int `json:"pid"`
@@ -96,6 +101,9 @@ type NSenterEvent struct {
 	// Zombie Reaper (for left-over nsenter child processes)
 	reaper *zombieReaper
 
+	// Tracker of live nsenter processes (for shutdown purposes)
+	tracker *nsenterTracker
+
 	// Backpointer to Nsenter service
 	service *nsenterService
 }
@@ -137,6 +145,19 @@ func (e *NSenterEvent) GetProcessID() uint32 {
 //
 func (e *NSenterEvent) processResponse(pipe io.Reader) error {
 
+	r := bufio.NewReader(pipe)
+
+	// File read/write responses are fixed-format encoded (see codec.go).
+	m, fixed, err := decodeFixedMsg(r)
+	if err != nil {
+		logrus.Warnf("Error decoding received nsenterMsg response: %s", err)
+		return fmt.Errorf("Error decoding received nsenterMsg response: %s", err)
+	}
+	if fixed {
+		e.ResMsg = m
+		return nil
+	}
+
 	// Raw message payload to aid in decoding generic messages (see below
 	// explanation).
 	var payload json.RawMessage
@@ -150,7 +171,7 @@ func (e *NSenterEvent) processResponse(pipe io.Reader) error {
 	// obtained type, we are able to decode the payload generated by the
 	// remote-end. This second step is executed as part of a subsequent
 	// unmarshal instruction (see further below).
-	if err := json.NewDecoder(pipe).Decode(&nsenterMsg); err != nil {
+	if err := json.NewDecoder(r).Decode(&nsenterMsg); err != nil {
 		logrus.Warnf("Error decoding received nsenterMsg response: %s", err)
 		return fmt.Errorf("Error decoding received nsenterMsg response: %s", err)
 	}
@@ -176,6 +197,25 @@ func (e *NSenterEvent) processResponse(pipe io.Reader) error {
 		}
 		break
 
+	case domain.LookupBatchResponse:
+		logrus.Debug("Received nsenterEvent lookupBatchResponse message.")
+
+		var p map[string]domain.FileInfo
+
+		if payload != nil {
+			err := json.Unmarshal(payload, &p)
+			if err != nil {
+				logrus.Error(err)
+				return err
+			}
+		}
+
+		e.ResMsg = &domain.NSenterMessage{
+			Type:    nsenterMsg.Type,
+			Payload: p,
+		}
+		break
+
 	case domain.OpenFileResponse:
 		logrus.Debug("Received nsenterEvent OpenResponse message.")
 
@@ -260,6 +300,15 @@ func (e *NSenterEvent) processResponse(pipe io.Reader) error {
 		}
 		break
 
+	case domain.RemountFuseResponse:
+		logrus.Debug("Received nsenterEvent remountFuseResponse message.")
+
+		e.ResMsg = &domain.NSenterMessage{
+			Type:    nsenterMsg.Type,
+			Payload: "",
+		}
+		break
+
 	case domain.MountInfoResponse:
 		logrus.Debug("Received nsenterEvent mountInfoResponse message.")
 
@@ -413,13 +462,36 @@ func (e *NSenterEvent) namespacePaths() []string {
 	// always first.
 
 	for _, nstype := range *(e.Namespace) {
-		path := nstype + ":" + filepath.Join("/proc", strconv.Itoa(int(e.Pid)), "/ns", nstype)
-		paths = append(paths, path)
+		nsPath := filepath.Join("/proc", strconv.Itoa(int(e.Pid)), "/ns", nstype)
+
+		// In rootless mode, the namespaces shared with sysbox-fs (i.e., its
+		// own user-ns) are skipped, as the kernel rejects setns() into the
+		// caller's own user-ns (EINVAL).
+		if domain.Rootless() && sameNamespace(nsPath, filepath.Join("/proc/self/ns", nstype)) {
+			continue
+		}
+
+		paths = append(paths, nstype+":"+nsPath)
 	}
 
 	return paths
 }
 
+// Reports whether the given namespace paths refer to the same namespace.
+func sameNamespace(path1, path2 string) bool {
+
+	var st1, st2 syscall.Stat_t
+
+	if err := syscall.Stat(path1, &st1); err != nil {
+		return false
+	}
+	if err := syscall.Stat(path2, &st2); err != nil {
+		return false
+	}
+
+	return st1.Dev == st2.Dev && st1.Ino == st2.Ino
+}
+
 //
 // Sysbox-fs requests are generated through this method. Handlers seeking to
 // access namespaced resources will call this method to invoke nsexec,
@@ -429,6 +501,46 @@ func (e *NSenterEvent) SendRequest() error {
 
 	logrus.Debug("Executing nsenterEvent's SendRequest() method")
 
+	// No new requests are served during sysbox-fs shutdown.
+	if !e.tracker.accepting() {
+		return errors.New("nsenter service is shutting down")
+	}
+
+	// Cap the number of concurrent nsenter requests (and thereby of nsenter
+	// child processes).
+	if !e.tracker.acquire(nsenterWaitTimeout) {
+		logrus.Warnf("Max number of concurrent nsenter requests (%d) reached",
+			domain.MaxNSenterProcs())
+		return errors.New("too many nsenter requests in-flight")
+	}
+	defer e.tracker.release()
+
+	// Pin the identity of the process whose namespaces are to be entered, so
+	// that we never act on behalf of a recycled pid.
+	var handle domain.ProcessHandleIface
+	if e.service != nil {
+		h, err := e.service.prs.ProcessHandle(e.Pid)
+		if err != nil {
+			logrus.Debugf("Skipping nsenter %s request: pid %d is gone (%v)",
+				e.ReqMsg.Type, e.Pid, err)
+			return fuse.IOerror{Code: syscall.ESRCH, Message: "process is gone"}
+		}
+		defer h.Close()
+		handle = h
+	}
+
+	start := time.Now()
+	defer func() {
+		if latency := time.Since(start); domain.IsSlowOp(latency) {
+			var nsenterPid int
+			if e.Process != nil {
+				nsenterPid = e.Process.Pid
+			}
+			logrus.Warnf("Slow nsenter %s request: pid %d, nsenter pid %d, duration %v",
+				e.ReqMsg.Type, e.Pid, nsenterPid, latency)
+		}
+	}()
+
 	// Alert the zombie reaper that nsenter is about to start. Notice that we
 	// skip reaper's services for async requests as, in those cases, the callee
 	// is expected to sigkill its generated nsenter processes.
@@ -473,9 +585,9 @@ func (e *NSenterEvent) SendRequest() error {
 
 	// Prepare exec.cmd in charge of running: "sysbox-fs nsenter".
 	cmd := &exec.Cmd{
-		Path:        "/proc/self/exe",
+		Path:        nsenterExePath(),
 		Args:        []string{os.Args[0], "nsenter"},
-		ExtraFiles:  []*os.File{childPipe},
+		ExtraFiles:  append([]*os.File{childPipe}, remountFiles(e.ReqMsg)...),
 		Env:         []string{"_LIBCONTAINER_INITPIPE=3", fmt.Sprintf("GOMAXPROCS=%s", os.Getenv("GOMAXPROCS"))},
 		SysProcAttr: &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM},
 		Stdin:       nil,
@@ -490,6 +602,8 @@ func (e *NSenterEvent) SendRequest() error {
 		logrus.Errorf("Error launching sysbox-fs first child process: %s", err)
 		return errors.New("Error launching sysbox-fs first child process")
 	}
+	e.tracker.add(cmd.Process)
+	defer e.tracker.remove(cmd.Process)
 
 	// Send the config to child process.
 	if _, err := io.Copy(e.parentPipe, bytes.NewReader(r.Serialize())); err != nil {
@@ -546,6 +660,12 @@ func (e *NSenterEvent) SendRequest() error {
 	}
 	e.Process = process
 
+	// Async requests are untracked upon termination (see TerminateRequest()).
+	e.tracker.add(process)
+	if !e.Async {
+		defer e.tracker.remove(process)
+	}
+
 	//
 	// Transfer the nsenterEvent details to grand-child for processing.
 	//
@@ -573,7 +693,7 @@ func (e *NSenterEvent) SendRequest() error {
 	}
 
 	// Transfer the rest of the payload
-	data, err := json.Marshal(*(e.ReqMsg))
+	data, err := encodeMsg(e.ReqMsg)
 	if err != nil {
 		logrus.Warnf("Error while encoding nsenter payload (%v).", err)
 		if !e.Async {
@@ -610,6 +730,17 @@ func (e *NSenterEvent) SendRequest() error {
 
 	e.Process.Wait()
 
+	// Discard the response if the process exited (and its pid was possibly
+	// recycled) while the request was in flight.
+	if handle != nil && !handle.Alive() {
+		logrus.Debugf("Discarding nsenter %s response: pid %d is gone",
+			e.ReqMsg.Type, e.Pid)
+		e.ResMsg = &domain.NSenterMessage{
+			Type:    domain.ErrorResponse,
+			Payload: fuse.IOerror{Code: syscall.ESRCH, Message: "process is gone"},
+		}
+	}
+
 	return nil
 }
 
@@ -635,6 +766,8 @@ func (e *NSenterEvent) TerminateRequest() error {
 		logrus.Warnf("Error shutting down sysbox-fs nsenter pipe: %s", err)
 	}
 
+	e.tracker.remove(e.Process)
+
 	// Kill ongoing request.
 	if err := e.Process.Kill(); err != nil {
 		return err
@@ -658,6 +791,14 @@ func (e *NSenterEvent) processLookupRequest() error {
 
 	payload := e.ReqMsg.Payload.(domain.LookupPayload)
 
+	if err := mountNetnsSysfs(payload.Entry); err != nil {
+		e.ResMsg = &domain.NSenterMessage{
+			Type:    domain.ErrorResponse,
+			Payload: &fuse.IOerror{RcvError: err},
+		}
+		return nil
+	}
+
 	// Verify if the resource being looked up is reachable and obtain FileInfo
 	// details.
 	info, err := os.Stat(payload.Entry)
@@ -690,6 +831,50 @@ func (e *NSenterEvent) processLookupRequest() error {
 	return nil
 }
 
+// Same as above, but for multiple entries, which are all looked up within the
+// same process. Entries that can't be reached are left out of the response.
+func (e *NSenterEvent) processLookupBatchRequest() error {
+
+	payload := e.ReqMsg.Payload.(domain.LookupBatchPayload)
+
+	fileInfos := make(map[string]domain.FileInfo, len(payload.Entries))
+
+	// Entries are expected to belong to the same directory.
+	if len(payload.Entries) > 0 {
+		if err := mountNetnsSysfs(payload.Entries[0]); err != nil {
+			e.ResMsg = &domain.NSenterMessage{
+				Type:    domain.ErrorResponse,
+				Payload: &fuse.IOerror{RcvError: err},
+			}
+			return nil
+		}
+	}
+
+	for _, entry := range payload.Entries {
+		info, err := os.Stat(entry)
+		if err != nil {
+			continue
+		}
+
+		fileInfos[entry] = domain.FileInfo{
+			Fname:    info.Name(),
+			Fsize:    info.Size(),
+			Fmode:    info.Mode(),
+			FmodTime: info.ModTime(),
+			FisDir:   info.IsDir(),
+			Fsys:     info.Sys().(*syscall.Stat_t),
+		}
+	}
+
+	// Create a response message.
+	e.ResMsg = &domain.NSenterMessage{
+		Type:    domain.LookupBatchResponse,
+		Payload: fileInfos,
+	}
+
+	return nil
+}
+
 //
 // Once a file has been opened with open(), no permission checking is performed
 // by subsequent system calls that work with the returned file descriptor (such
@@ -699,6 +884,14 @@ func (e *NSenterEvent) processOpenFileRequest() error {
 
 	payload := e.ReqMsg.Payload.(domain.OpenFilePayload)
 
+	if err := mountNetnsSysfs(payload.File); err != nil {
+		e.ResMsg = &domain.NSenterMessage{
+			Type:    domain.ErrorResponse,
+			Payload: &fuse.IOerror{RcvError: err},
+		}
+		return nil
+	}
+
 	// Extract openflags from the incoming payload.
 	openFlags, err := strconv.Atoi(payload.Flags)
 	if err != nil {
@@ -750,6 +943,14 @@ func (e *NSenterEvent) processFileReadRequest() error {
 
 	payload := e.ReqMsg.Payload.(domain.ReadFilePayload)
 
+	if err := mountNetnsSysfs(payload.File); err != nil {
+		e.ResMsg = &domain.NSenterMessage{
+			Type:    domain.ErrorResponse,
+			Payload: &fuse.IOerror{RcvError: err},
+		}
+		return nil
+	}
+
 	fd, err = os.Open(payload.File)
 	if err != nil {
 		e.ResMsg = &domain.NSenterMessage{
@@ -787,6 +988,14 @@ func (e *NSenterEvent) processFileWriteRequest() error {
 
 	payload := e.ReqMsg.Payload.(domain.WriteFilePayload)
 
+	if err := mountNetnsSysfs(payload.File); err != nil {
+		e.ResMsg = &domain.NSenterMessage{
+			Type:    domain.ErrorResponse,
+			Payload: &fuse.IOerror{RcvError: err},
+		}
+		return nil
+	}
+
 	fd, err = os.OpenFile(payload.File, os.O_WRONLY, 0)
 	if err != nil {
 		e.ResMsg = &domain.NSenterMessage{
@@ -818,6 +1027,14 @@ func (e *NSenterEvent) processDirReadRequest() error {
 
 	payload := e.ReqMsg.Payload.(domain.ReadDirPayload)
 
+	if err := mountNetnsSysfs(payload.Dir); err != nil {
+		e.ResMsg = &domain.NSenterMessage{
+			Type:    domain.ErrorResponse,
+			Payload: &fuse.IOerror{RcvError: err},
+		}
+		return nil
+	}
+
 	// Perform readDir operation and return error msg should this one fail.
 	dirContent, err := ioutil.ReadDir(payload.Dir)
 	if err != nil {
@@ -852,6 +1069,49 @@ func (e *NSenterEvent) processDirReadRequest() error {
 	return nil
 }
 
+// Sysfs nodes whose contents are determined by the network namespace that the
+// sysfs instance was mounted from, rather than by the one of the process
+// accessing them.
+var netnsSysfsPaths = []string{
+	"/sys/class/net",
+}
+
+// The sysfs instance within nsenter's mount namespace (i.e., the host's one)
+// reflects the host's network namespace. Hence, prior to accessing the nodes
+// within netnsSysfsPaths, a new sysfs instance is mounted (within a private
+// mount namespace) for the network namespace entered by nsenter to be the one
+// reflected.
+func mountNetnsSysfs(path string) error {
+
+	var match bool
+
+	for _, p := range netnsSysfsPaths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			match = true
+			break
+		}
+	}
+
+	if !match {
+		return nil
+	}
+
+	if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		return fmt.Errorf("unable to unshare mount namespace: %v", err)
+	}
+
+	if err := unix.Mount("", "/", "", unix.MS_SLAVE|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("unable to set mount propagation: %v", err)
+	}
+
+	flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	if err := unix.Mount("sysfs", "/sys", "sysfs", flags, ""); err != nil {
+		return fmt.Errorf("unable to mount sysfs: %v", err)
+	}
+
+	return nil
+}
+
 func (e *NSenterEvent) processMountSyscallRequest() error {
 
 	var (
@@ -864,6 +1124,19 @@ func (e *NSenterEvent) processMountSyscallRequest() error {
 	// Extract payload-header from the first element
 	header := payload[0].Header
 
+	// Label the file-systems mounted (and files created) on behalf of the
+	// container as per its SELinux context.
+	if header.MountLabel != "" {
+		if err := setFileCreateLabel(header.MountLabel); err != nil {
+			e.ResMsg = &domain.NSenterMessage{
+				Type:    domain.ErrorResponse,
+				Payload: &fuse.IOerror{RcvError: err},
+			}
+
+			return nil
+		}
+	}
+
 	// For overlayfs mounts we adjust 'nsexec' process' personality (i.e.
 	// uid/gid and capabilities) to match the one of the original process
 	// performing the syscall. Our goal is mainly to avoid permission issues
@@ -879,9 +1152,11 @@ func (e *NSenterEvent) processMountSyscallRequest() error {
 		if err := this.AdjustPersonality(
 			header.Uid,
 			header.Gid,
+			header.SGid,
 			header.Root,
 			header.Cwd,
-			header.Capabilities); err != nil {
+			header.Capabilities,
+			header.AmbientCaps); err != nil {
 
 			// Send an error-message response.
 			e.ResMsg = &domain.NSenterMessage{
@@ -893,30 +1168,36 @@ func (e *NSenterEvent) processMountSyscallRequest() error {
 		}
 	}
 
-	// Perform mount instructions.
+	// Perform mount instructions, journaling the pre-state of each one so that
+	// the whole payload can be reverted should any of them fail.
+	var journal mountJournal
+
 	for i = 0; i < len(payload); i++ {
+		if err = journal.record(&payload[i]); err != nil {
+			break
+		}
+
+		data := payload[i].Data
+		if isNewMount(payload[i].Flags) {
+			data = domain.FormatMountLabel(data, header.MountLabel)
+		}
+
 		err = unix.Mount(
 			payload[i].Source,
 			payload[i].Target,
 			payload[i].FsType,
 			uintptr(payload[i].Flags),
-			payload[i].Data,
+			data,
 		)
 		if err != nil {
+			journal.discard()
 			break
 		}
 	}
 
 	if err != nil {
-		// Unmount previously executed mount instructions (unless it's a remount).
-		//
-		// TODO: ideally we would revert remounts too, but to do this we need information
-		// that we don't have at this stage.
-		for j := i - 1; j >= 0; j-- {
-			if payload[j].Flags&unix.MS_REMOUNT != unix.MS_REMOUNT {
-				_ = unix.Unmount(payload[j].Target, 0)
-			}
-		}
+		// Revert previously executed mount instructions.
+		_ = journal.revert()
 
 		// Create error response msg.
 		e.ResMsg = &domain.NSenterMessage{
@@ -1046,9 +1327,11 @@ func (e *NSenterEvent) processGetxattrSyscallRequest() error {
 	if err := this.AdjustPersonality(
 		p.Header.Uid,
 		p.Header.Gid,
+		p.Header.SGid,
 		p.Header.Root,
 		p.Header.Cwd,
-		p.Header.Capabilities); err != nil {
+		p.Header.Capabilities,
+		p.Header.AmbientCaps); err != nil {
 
 		// Send an error-message response.
 		e.ResMsg = &domain.NSenterMessage{
@@ -1129,9 +1412,11 @@ func (e *NSenterEvent) processListxattrSyscallRequest() error {
 	if err := this.AdjustPersonality(
 		p.Header.Uid,
 		p.Header.Gid,
+		p.Header.SGid,
 		p.Header.Root,
 		p.Header.Cwd,
-		p.Header.Capabilities); err != nil {
+		p.Header.Capabilities,
+		p.Header.AmbientCaps); err != nil {
 
 		// Send an error-message response.
 		e.ResMsg = &domain.NSenterMessage{
@@ -1296,6 +1581,27 @@ func (e *NSenterEvent) processRequest(pipe *os.File) error {
 		return err
 	}
 
+	r := bufio.NewReader(pipe)
+
+	// File read/write requests are fixed-format encoded (see codec.go).
+	m, fixed, err := decodeFixedMsg(r)
+	if err != nil {
+		logrus.Warnf("Error decoding received nsenterMsg request (%v).", err)
+		return errors.New("Error decoding received event request.")
+	}
+	if fixed {
+		e.ReqMsg = m
+
+		switch m.Type {
+		case domain.ReadFileRequest:
+			return e.processFileReadRequest()
+		case domain.WriteFileRequest:
+			return e.processFileWriteRequest()
+		}
+
+		return errors.New("Unsupported request type received.")
+	}
+
 	// Raw message payload to aid in decoding generic messages (see below
 	// explanation).
 	var payload json.RawMessage
@@ -1309,7 +1615,7 @@ func (e *NSenterEvent) processRequest(pipe *os.File) error {
 	// obtained type, we are able to decode the payload generated by the
 	// remote-end. This second step is executed as part of a subsequent
 	// unmarshal instruction (see further below).
-	if err := json.NewDecoder(pipe).Decode(&nsenterMsg); err != nil {
+	if err := json.NewDecoder(r).Decode(&nsenterMsg); err != nil {
 		logrus.Warnf("Error decoding received nsenterMsg request (%v).", err)
 		return errors.New("Error decoding received event request.")
 	}
@@ -1332,6 +1638,22 @@ func (e *NSenterEvent) processRequest(pipe *os.File) error {
 		}
 		return e.processLookupRequest()
 
+	case domain.LookupBatchRequest:
+		var p domain.LookupBatchPayload
+		if payload != nil {
+			err := json.Unmarshal(payload, &p)
+			if err != nil {
+				logrus.Error(err)
+				return err
+			}
+		}
+
+		e.ReqMsg = &domain.NSenterMessage{
+			Type:    nsenterMsg.Type,
+			Payload: p,
+		}
+		return e.processLookupBatchRequest()
+
 	case domain.OpenFileRequest:
 		var p domain.OpenFilePayload
 		if payload != nil {
@@ -1494,6 +1816,23 @@ func (e *NSenterEvent) processRequest(pipe *os.File) error {
 
 		return e.processUmountSyscallRequest()
 
+	case domain.RemountFuseRequest:
+		var p []domain.RemountFusePayload
+		if payload != nil {
+			err := json.Unmarshal(payload, &p)
+			if err != nil {
+				logrus.Error(err)
+				return err
+			}
+		}
+
+		e.ReqMsg = &domain.NSenterMessage{
+			Type:    nsenterMsg.Type,
+			Payload: p,
+		}
+
+		return e.processRemountFuseRequest()
+
 	case domain.MountInfoRequest:
 		e.ReqMsg = &domain.NSenterMessage{
 			Type: nsenterMsg.Type,
@@ -1596,8 +1935,15 @@ func Init() (err error) {
 
 	var event = NSenterEvent{service: nsenterSvc.(*nsenterService)}
 
-	// Process incoming request.
-	err = event.processRequest(pipe)
+	// Restrict the syscalls available to the request handlers. Requests are
+	// not processed without the filter in place; the failure is reported
+	// back to sysbox-fs instead (logs of this process are discarded).
+	if err = installSeccompFilter(); err != nil {
+		err = fmt.Errorf("Unable to install nsenter seccomp filter: %v", err)
+	} else {
+		// Process incoming request.
+		err = event.processRequest(pipe)
+	}
 	if err != nil {
 		event.ResMsg = &domain.NSenterMessage{
 			Type:    domain.ErrorResponse,
@@ -1606,7 +1952,7 @@ func Init() (err error) {
 	}
 
 	// Encode / push response back to sysbox-main.
-	data, err := json.Marshal(*(event.ResMsg))
+	data, err := encodeMsg(event.ResMsg)
 	if err != nil {
 		return err
 	}
@@ -21,14 +21,16 @@ import (
 )
 
 type nsenterService struct {
-	prs    domain.ProcessServiceIface // for process class interactions (capabilities)
-	mts    domain.MountServiceIface   // for mount class interactions (mountInfoParser)
-	reaper *zombieReaper
+	prs     domain.ProcessServiceIface // for process class interactions (capabilities)
+	mts     domain.MountServiceIface   // for mount class interactions (mountInfoParser)
+	reaper  *zombieReaper
+	tracker *nsenterTracker
 }
 
 func NewNSenterService() domain.NSenterServiceIface {
 	return &nsenterService{
-		reaper: newZombieReaper(),
+		reaper:  newZombieReaper(),
+		tracker: newNSenterTracker(),
 	}
 }
 
@@ -54,6 +56,8 @@ func (s *nsenterService) NewEvent(
 		ResMsg:    res,
 		Async:     async,
 		reaper:    s.reaper,
+		tracker:   s.tracker,
+		service:   s,
 	}
 
 	return event
@@ -103,3 +107,9 @@ func (s *nsenterService) GetResponseEventPayload(
 func (s *nsenterService) GetEventProcessID(e domain.NSenterEventIface) uint32 {
 	return e.GetProcessID()
 }
+
+// Stops serving nsenter requests and kills the nsenter processes still alive
+// (i.e., during sysbox-fs shutdown). Returns the number of processes killed.
+func (s *nsenterService) TerminateAllRequests() int {
+	return s.tracker.terminate()
+}
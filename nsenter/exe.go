@@ -0,0 +1,112 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+//
+// Binary the nsenter child processes are launched from.
+//
+// Rather than re-executing sysbox-fs through /proc/self/exe, nsenter children
+// are launched from a sealed, in-memory copy of the sysbox-fs binary (memfd).
+// This way, the binary executed within the containers' namespaces can't be
+// altered (i.e., replaced on disk mid-flight, or tampered with through a file
+// system shared with a container), and the child needn't access the binary's
+// path at all.
+//
+// The copy is made upon the first nsenter request and kept for sysbox-fs'
+// lifetime. Should memfds (or their sealing) not be supported, the children
+// are launched from /proc/self/exe.
+//
+
+const nsenterSelfExe = "/proc/self/exe"
+
+// Seals applied to the binary's copy: its contents can't be altered, nor can
+// further seals be added / removed.
+const nsenterExeSeals = unix.F_SEAL_SEAL | unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE
+
+var nsenterExe struct {
+	once sync.Once
+	file *os.File // sealed copy of the binary (nil if not available)
+	path string
+}
+
+// Returns the path through which the nsenter child processes are executed.
+func nsenterExePath() string {
+
+	nsenterExe.once.Do(func() {
+		f, err := sealedSelfExe()
+		if err != nil {
+			logrus.Warnf("Unable to create a sealed copy of the sysbox-fs binary (%v); "+
+				"nsenter processes are launched from %s", err, nsenterSelfExe)
+			nsenterExe.path = nsenterSelfExe
+			return
+		}
+
+		// The memfd is close-on-exec, which doesn't prevent the kernel from
+		// exec'ing it through its /proc/self/fd path (as opposed to scripts).
+		nsenterExe.file = f
+		nsenterExe.path = fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+
+		logrus.Infof("nsenter processes are launched from a sealed copy of the sysbox-fs binary")
+	})
+
+	return nsenterExe.path
+}
+
+// Creates a sealed, in-memory copy of the sysbox-fs binary.
+func sealedSelfExe() (*os.File, error) {
+
+	exe, err := os.Open(nsenterSelfExe)
+	if err != nil {
+		return nil, err
+	}
+	defer exe.Close()
+
+	fd, err := unix.MemfdCreate("sysbox-fs", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "sysbox-fs")
+
+	if _, err := io.Copy(f, exe); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, nsenterExeSeals); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Double-check the seals are in place.
+	seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0)
+	if err != nil || seals&nsenterExeSeals != nsenterExeSeals {
+		f.Close()
+		return nil, fmt.Errorf("memfd seals not applied (%#x, %v)", seals, err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,86 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// Env var requesting the re-executed test binary to report the binary it's
+// running from (see TestNsenterExe).
+const exeTestEnv = "SYSBOX_FS_NSENTER_EXE_TEST"
+
+// Verifies that nsenter processes are launched from a sealed, in-memory copy of
+// the test binary.
+func TestNsenterExe(t *testing.T) {
+
+	if os.Getenv(exeTestEnv) != "" {
+		exe, err := os.Readlink(nsenterSelfExe)
+		if err != nil {
+			t.Fatalf("unable to read %s: %v", nsenterSelfExe, err)
+		}
+		fmt.Printf("exe=%s\n", exe)
+		return
+	}
+
+	path := nsenterExePath()
+	if path == nsenterSelfExe {
+		t.Skip("memfd sealing not supported")
+	}
+
+	f := nsenterExe.file
+	if f == nil || path != fmt.Sprintf("/proc/self/fd/%d", f.Fd()) {
+		t.Fatalf("nsenterExePath() = %s, want the path of the memfd", path)
+	}
+
+	seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0)
+	if err != nil {
+		t.Fatalf("F_GET_SEALS failed: %v", err)
+	}
+	if seals&nsenterExeSeals != nsenterExeSeals {
+		t.Errorf("memfd seals = %#x, want %#x", seals, nsenterExeSeals)
+	}
+
+	// The copy can't be altered, nor its seals changed.
+	if _, err := unix.Pwrite(int(f.Fd()), []byte{0}, 0); err != unix.EPERM {
+		t.Errorf("write to the sealed memfd = %v, want %v", err, unix.EPERM)
+	}
+	if err := unix.Ftruncate(int(f.Fd()), 0); err != unix.EPERM {
+		t.Errorf("truncate of the sealed memfd = %v, want %v", err, unix.EPERM)
+	}
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_WRITE); err != unix.EPERM {
+		t.Errorf("addition of memfd seals = %v, want %v", err, unix.EPERM)
+	}
+
+	// Children run from the memfd (rather than from the binary on disk).
+	cmd := exec.Command(path, "-test.run=^TestNsenterExe$")
+	cmd.Env = append(os.Environ(), exeTestEnv+"=1")
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("unable to execute %s: %v\n%s", path, err, out)
+	}
+	if !strings.Contains(string(out), "exe=/memfd:sysbox-fs") {
+		t.Errorf("child not running from the memfd:\n%s", out)
+	}
+}
@@ -0,0 +1,37 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"io/ioutil"
+
+	"golang.org/x/sys/unix"
+)
+
+// Sets the SELinux context of the files subsequently created by the nsenter
+// process (see domain.MountLabel). The attribute is per-thread, which is fine
+// as the nsenter process runs locked to its main thread (see init()).
+func setFileCreateLabel(label string) error {
+	return ioutil.WriteFile("/proc/thread-self/attr/fscreate", []byte(label), 0)
+}
+
+// Reports whether the given mount instruction creates a new file-system
+// instance (as opposed to bind-mounts, remounts, moves and propagation
+// changes, which operate on existing ones).
+func isNewMount(flags uint64) bool {
+	return flags&(unix.MS_BIND|unix.MS_REMOUNT|unix.MS_MOVE|mountPropagationFlags) == 0
+}
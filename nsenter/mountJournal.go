@@ -0,0 +1,359 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Journal of the mount instructions executed as part of a mount-syscall
+// request.
+//
+// Prior to executing each instruction, the state of the mountpoints it's about
+// to alter (i.e., per-mount & superblock flags, propagation type) is recorded,
+// so that, should any of the subsequent instructions fail, the instructions
+// already executed can be reverted (in reverse order) and the whole payload is
+// applied atomically (from the container's point of view).
+//
+// Note that the journal operates within the mount namespace (and root) of the
+// 'nsenter' process, so mountinfo is obtained from its own procfs entry.
+//
+type mountJournal struct {
+	entries []*mountJournalEntry
+}
+
+type mountJournalEntry struct {
+	mount *domain.MountSyscallPayload
+	state []*mountPreState // pre-state of the affected mountpoints
+}
+
+// Pre-state of a mountpoint, as reported by mountinfo.
+type mountPreState struct {
+	mountpoint string
+	mntFlags   uint64 // per-mount flags
+	sbRdonly   bool   // superblock's read-only flag
+	sbOpts     string // superblock options (other than 'ro' / 'rw')
+	shared     bool
+	slave      bool
+	unbindable bool
+}
+
+// Per-mount flags reported in mountinfo.
+var mountJournalFlags = map[string]uint64{
+	"ro":          unix.MS_RDONLY,
+	"nodev":       unix.MS_NODEV,
+	"noexec":      unix.MS_NOEXEC,
+	"nosuid":      unix.MS_NOSUID,
+	"noatime":     unix.MS_NOATIME,
+	"nodiratime":  unix.MS_NODIRATIME,
+	"relatime":    unix.MS_RELATIME,
+	"strictatime": unix.MS_STRICTATIME,
+	"sync":        unix.MS_SYNCHRONOUS,
+}
+
+const mountPropagationFlags = unix.MS_SHARED | unix.MS_PRIVATE |
+	unix.MS_SLAVE | unix.MS_UNBINDABLE
+
+// Records the pre-state of the mountpoints affected by the given mount
+// instruction. Must be called right before the instruction is executed.
+func (j *mountJournal) record(m *domain.MountSyscallPayload) error {
+
+	entry := &mountJournalEntry{mount: m}
+
+	// New mounts (and moves) are reverted based on the instruction alone.
+	if m.Flags&(unix.MS_REMOUNT|mountPropagationFlags) != 0 {
+		target, err := mountJournalPath(m.Target)
+		if err != nil {
+			return err
+		}
+
+		recursive := m.Flags&unix.MS_REMOUNT == 0 && m.Flags&unix.MS_REC != 0
+
+		state, err := mountPreStates(target, recursive)
+		if err != nil {
+			return err
+		}
+		entry.state = state
+	}
+
+	j.entries = append(j.entries, entry)
+
+	return nil
+}
+
+// Discards the last recorded entry (i.e., the one of an instruction that failed
+// and thus has nothing to revert).
+func (j *mountJournal) discard() {
+	if len(j.entries) > 0 {
+		j.entries = j.entries[:len(j.entries)-1]
+	}
+}
+
+// Reverts the recorded instructions in reverse order. Reverting is carried out
+// in full even if some of the steps fail; the first error is returned.
+func (j *mountJournal) revert() error {
+
+	var firstErr error
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if err := j.entries[i].revert(); err != nil {
+			logrus.Warnf("Unable to revert mount instruction %+v: %v",
+				*j.entries[i].mount, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	j.entries = nil
+
+	return firstErr
+}
+
+func (e *mountJournalEntry) revert() error {
+
+	m := e.mount
+
+	switch {
+	case m.Flags&unix.MS_REMOUNT == unix.MS_REMOUNT:
+		return e.revertRemount()
+
+	case m.Flags&mountPropagationFlags != 0:
+		return e.revertPropagation()
+
+	case m.Flags&unix.MS_MOVE == unix.MS_MOVE:
+		return unix.Mount(m.Target, m.Source, "", unix.MS_MOVE, "")
+	}
+
+	// New mount (or bind-mount, possibly recursive).
+	return unix.Unmount(m.Target, unix.MNT_DETACH)
+}
+
+func (e *mountJournalEntry) revertRemount() error {
+
+	s := e.state[0]
+
+	// Bind remounts only alter per-mount flags.
+	if e.mount.Flags&unix.MS_BIND == unix.MS_BIND {
+		return unix.Mount("", s.mountpoint, "",
+			uintptr(unix.MS_REMOUNT|unix.MS_BIND|s.mntFlags), "")
+	}
+
+	flags := unix.MS_REMOUNT | s.mntFlags&^unix.MS_RDONLY
+	if s.sbRdonly {
+		flags |= unix.MS_RDONLY
+	}
+
+	// Superblock remounts may have altered fs-specific options too, so restore
+	// them as long as the file-system accepts them back (some of them, as
+	// displayed by the kernel, can't be passed to a remount).
+	err := unix.Mount("", s.mountpoint, "", uintptr(flags), s.sbOpts)
+	if err == unix.EINVAL && s.sbOpts != "" {
+		err = unix.Mount("", s.mountpoint, "", uintptr(flags), "")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Per-mount flags (e.g., 'ro' on a rw superblock) are restored separately.
+	if s.mntFlags&unix.MS_RDONLY != 0 && !s.sbRdonly {
+		return unix.Mount("", s.mountpoint, "",
+			uintptr(unix.MS_REMOUNT|unix.MS_BIND|s.mntFlags), "")
+	}
+
+	return nil
+}
+
+// Restores the propagation type of the affected mountpoints. Note that a slave
+// mount can only be turned back into a slave of its original master if it's
+// still a member of the master's peer group (i.e., MS_SHARED was applied on
+// it); otherwise it's restored as a private mount.
+func (e *mountJournalEntry) revertPropagation() error {
+
+	var firstErr error
+
+	for _, s := range e.state {
+		var steps []uintptr
+
+		switch {
+		case s.unbindable:
+			steps = []uintptr{unix.MS_UNBINDABLE}
+		case s.slave && s.shared:
+			steps = []uintptr{unix.MS_SLAVE, unix.MS_SHARED}
+		case s.slave:
+			steps = []uintptr{unix.MS_SLAVE}
+		case s.shared:
+			steps = []uintptr{unix.MS_SHARED}
+		default:
+			steps = []uintptr{unix.MS_PRIVATE}
+		}
+
+		for _, flags := range steps {
+			err := unix.Mount("", s.mountpoint, "", flags, "")
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// Returns the absolute & clean form of the given mount target, as displayed
+// in mountinfo.
+func mountJournalPath(target string) (string, error) {
+
+	if !filepath.IsAbs(target) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		target = filepath.Join(cwd, target)
+	}
+
+	return filepath.Clean(target), nil
+}
+
+// Obtains the pre-state of the given mountpoint (i.e., its topmost mount), and,
+// if 'recursive' is set, of all the mountpoints underneath it.
+func mountPreStates(target string, recursive bool) ([]*mountPreState, error) {
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		states []*mountPreState
+		top    *mountPreState
+	)
+
+	prefix := strings.TrimSuffix(target, "/") + "/"
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s, err := parseMountPreState(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+
+		if s.mountpoint == target {
+			top = s
+		} else if recursive && strings.HasPrefix(s.mountpoint, prefix) {
+			states = append(states, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if top == nil {
+		return nil, fmt.Errorf("no mount found at %s", target)
+	}
+
+	return append([]*mountPreState{top}, states...), nil
+}
+
+// Parses a mountinfo line, as described in proc(5):
+//
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+func parseMountPreState(line string) (*mountPreState, error) {
+
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return nil, fmt.Errorf("invalid mountinfo line: %q", line)
+	}
+
+	mountpoint, err := unescapeMountinfo(fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mountPreState{mountpoint: mountpoint}
+
+	for _, opt := range strings.Split(fields[5], ",") {
+		s.mntFlags |= mountJournalFlags[opt]
+	}
+
+	// Optional fields, up to the separator.
+	i := 6
+	for ; i < len(fields) && fields[i] != "-"; i++ {
+		switch {
+		case strings.HasPrefix(fields[i], "shared:"):
+			s.shared = true
+		case strings.HasPrefix(fields[i], "master:"):
+			s.slave = true
+		case fields[i] == "unbindable":
+			s.unbindable = true
+		}
+	}
+	if i+3 >= len(fields) {
+		return nil, fmt.Errorf("invalid mountinfo line: %q", line)
+	}
+
+	var sbOpts []string
+	for _, opt := range strings.Split(fields[i+3], ",") {
+		switch opt {
+		case "ro":
+			s.sbRdonly = true
+		case "rw":
+		default:
+			sbOpts = append(sbOpts, opt)
+		}
+	}
+	s.sbOpts = strings.Join(sbOpts, ",")
+
+	return s, nil
+}
+
+// Mountinfo escapes spaces, tabs, newlines and backslashes in octal form.
+func unescapeMountinfo(s string) (string, error) {
+
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			c, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid mountinfo path: %q", s)
+			}
+			b.WriteByte(byte(c))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,130 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/fuse"
+)
+
+// move_mount() flag to operate on the mount referred to by the 'from' fd.
+const moveMountFEmptyPath = 0x4
+
+// First file-descriptor of the mounts passed along remount requests, right
+// after the nsenter pipe's (see SendRequest()).
+const remountFirstFd = 4
+
+// Collects the mounts to be passed (inherited) along the given request, and
+// records the file-descriptors they will show up as within the nsenter process.
+func remountFiles(m *domain.NSenterMessage) []*os.File {
+
+	payload, ok := m.Payload.(*[]*domain.RemountFusePayload)
+	if !ok {
+		return nil
+	}
+
+	var files []*os.File
+	for _, p := range *payload {
+		p.Fd = remountFirstFd + len(files)
+		files = append(files, p.File)
+	}
+
+	return files
+}
+
+// Replaces the stale sysbox-fs mounts of the container (i.e., bound to an
+// aborted fuse connection) with the ones passed along the request. Mounts are
+// processed in order, parents first: these are detached along with their
+// submounts, whose targets are thereby no longer mountpoints by the time they
+// are processed.
+func (e *NSenterEvent) processRemountFuseRequest() error {
+
+	payload := e.ReqMsg.Payload.([]domain.RemountFusePayload)
+
+	for _, p := range payload {
+		if err := remountFuseNode(&p); err != nil {
+			e.ResMsg = &domain.NSenterMessage{
+				Type:    domain.ErrorResponse,
+				Payload: &fuse.IOerror{RcvError: err},
+			}
+			return nil
+		}
+	}
+
+	e.ResMsg = &domain.NSenterMessage{
+		Type:    domain.RemountFuseResponse,
+		Payload: "",
+	}
+
+	return nil
+}
+
+func remountFuseNode(p *domain.RemountFusePayload) error {
+
+	defer unix.Close(p.Fd)
+
+	err := unix.Unmount(p.Target, unix.MNT_DETACH)
+	if err != nil && err != unix.EINVAL {
+		return err
+	}
+
+	if err := moveMount(p.Fd, p.Target); err != nil {
+		return err
+	}
+
+	if p.Rdonly {
+		return unix.Mount("", p.Target, "",
+			unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, "")
+	}
+
+	return nil
+}
+
+// Attaches the detached mount referred to by the given file-descriptor at the
+// given target.
+func moveMount(fd int, target string) error {
+
+	empty, err := unix.BytePtrFromString("")
+	if err != nil {
+		return err
+	}
+	to, err := unix.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+
+	dirFd := unix.AT_FDCWD
+
+	_, _, errno := unix.Syscall6(
+		unix.SYS_MOVE_MOUNT,
+		uintptr(fd),
+		uintptr(unsafe.Pointer(empty)),
+		uintptr(dirFd),
+		uintptr(unsafe.Pointer(to)),
+		moveMountFEmptyPath,
+		0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	libseccomp "github.com/nestybox/sysbox-libs/libseccomp-golang"
+)
+
+//
+// Seccomp allow-list applied to the nsenter process (i.e., the one executing
+// requests within the container namespaces), so that the damage that could be
+// inflicted through crafted request payloads is constrained to the operations
+// these requests are made of. Syscalls not listed here fail with EPERM.
+//
+// The list covers the Go runtime's needs plus the syscalls issued by the nsenter
+// request handlers (see processRequest) and the helpers they rely on (e.g.,
+// process.AdjustPersonality). Syscalls that none of them issue (e.g., unlinkat,
+// fchmodat, ioctl) are deliberately left out. Syscalls unknown to the running
+// architecture are skipped.
+//
+var nsenterSeccompAllowList = []string{
+	// Go runtime.
+	"brk",
+	"clock_gettime",
+	"clock_nanosleep",
+	"clone",
+	"epoll_create1",
+	"epoll_ctl",
+	"epoll_pwait",
+	"epoll_wait",
+	"eventfd2",
+	"exit",
+	"exit_group",
+	"futex",
+	"getpid",
+	"getppid",
+	"getrandom",
+	"getrlimit",
+	"gettid",
+	"gettimeofday",
+	"madvise",
+	"mmap",
+	"mprotect",
+	"munmap",
+	"nanosleep",
+	"pipe2",
+	"prlimit64",
+	"restart_syscall",
+	"rt_sigaction",
+	"rt_sigprocmask",
+	"rt_sigreturn",
+	"sched_getaffinity",
+	"sched_yield",
+	"set_robust_list",
+	"set_tid_address",
+	"sigaltstack",
+	"tgkill",
+	"uname",
+
+	// File operations.
+	"access",
+	"chdir",
+	"chroot",
+	"close",
+	"faccessat",
+	"faccessat2",
+	"fchdir",
+	"fcntl",
+	"fstat",
+	"fstatfs",
+	"getcwd",
+	"getdents64",
+	"lseek",
+	"lstat",
+	"mkdir",
+	"mkdirat",
+	"newfstatat",
+	"open",
+	"openat",
+	"openat2",
+	"pread64",
+	"pwrite64",
+	"read",
+	"readlink",
+	"readlinkat",
+	"readv",
+	"stat",
+	"statfs",
+	"statx",
+	"write",
+	"writev",
+
+	// Mount operations.
+	"fsconfig",
+	"fsmount",
+	"fsopen",
+	"fspick",
+	"mount",
+	"mount_setattr",
+	"move_mount",
+	"open_tree",
+	"umount2",
+	"unshare",
+
+	// Ownership & xattrs.
+	"chown",
+	"fchown",
+	"fchownat",
+	"fgetxattr",
+	"flistxattr",
+	"fremovexattr",
+	"fsetxattr",
+	"getxattr",
+	"lchown",
+	"lgetxattr",
+	"listxattr",
+	"llistxattr",
+	"lremovexattr",
+	"lsetxattr",
+	"removexattr",
+	"setxattr",
+
+	// Credentials (process personality adjustments).
+	"capget",
+	"capset",
+	"getegid",
+	"geteuid",
+	"getgid",
+	"getgroups",
+	"getresgid",
+	"getresuid",
+	"getuid",
+	"prctl",
+	"setfsgid",
+	"setfsuid",
+	"setgid",
+	"setgroups",
+	"setresgid",
+	"setresuid",
+	"setuid",
+
+	// Communication with sysbox-fs (pipe) and with the container's processes.
+	// Credentials are received through SO_PASSCRED, and Go's recvmsg() wrapper
+	// queries the socket type (SO_TYPE) to receive these.
+	"getsockopt",
+	"pidfd_open",
+	"pidfd_send_signal",
+	"recvmsg",
+	"sendmsg",
+	"setsockopt",
+	"shutdown",
+}
+
+// Installs the nsenter seccomp allow-list on all the threads of the calling
+// process. Meant to be invoked once the container namespaces have been entered
+// and before any request payload is processed.
+func installSeccompFilter() error {
+
+	filter, err := libseccomp.NewFilter(
+		libseccomp.ActErrno.SetReturnCode(int16(unix.EPERM)))
+	if err != nil {
+		return err
+	}
+	defer filter.Release()
+
+	// The nsenter process never execs, so no-new-privs comes at no cost; the
+	// filter must also cover the Go runtime threads already spawned.
+	if err := filter.SetNoNewPrivsBit(true); err != nil {
+		return err
+	}
+	if err := filter.SetTsync(true); err != nil {
+		return err
+	}
+
+	for _, name := range nsenterSeccompAllowList {
+		call, err := libseccomp.GetSyscallFromName(name)
+		if err != nil {
+			logrus.Debugf("nsenter seccomp: skipping syscall %s: %v", name, err)
+			continue
+		}
+		if err := filter.AddRule(call, libseccomp.ActAllow); err != nil {
+			return err
+		}
+	}
+
+	return filter.Load()
+}
@@ -0,0 +1,189 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// Env var through which the test's working dir is passed to the re-executed
+// test binary (see TestProcessRequestSeccomp).
+const seccompTestDirEnv = "SYSBOX_FS_NSENTER_SECCOMP_TEST_DIR"
+
+// Verifies that the nsenter requests can be processed under the nsenter seccomp
+// filter. As the filter can't be removed once installed, requests are processed
+// within a re-executed instance of the test binary.
+func TestProcessRequestSeccomp(t *testing.T) {
+
+	if dir := os.Getenv(seccompTestDirEnv); dir != "" {
+		processRequestsSeccomp(t, dir)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "nsenter-seccomp")
+	if err != nil {
+		t.Fatalf("unable to create test dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("0\n"), 0644); err != nil {
+		t.Fatalf("unable to create test file: %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestProcessRequestSeccomp$", "-test.v")
+	cmd.Env = append(os.Environ(), seccompTestDirEnv+"="+dir)
+
+	out, err := cmd.CombinedOutput()
+	if strings.Contains(string(out), "--- SKIP") {
+		t.Skipf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf("requests failed under the seccomp filter: %v\n%s", err, out)
+	}
+}
+
+// Processes the nsenter requests over the files within the given dir, once the
+// nsenter seccomp filter is installed.
+func processRequestsSeccomp(t *testing.T, dir string) {
+
+	file := filepath.Join(dir, "file")
+
+	requests := []struct {
+		req  *domain.NSenterMessage
+		want domain.NSenterMsgType
+	}{
+		{
+			&domain.NSenterMessage{
+				Type:    domain.LookupRequest,
+				Payload: domain.LookupPayload{Entry: file},
+			},
+			domain.LookupResponse,
+		},
+		{
+			&domain.NSenterMessage{
+				Type:    domain.OpenFileRequest,
+				Payload: domain.OpenFilePayload{File: file, Flags: "0", Mode: "0"},
+			},
+			domain.OpenFileResponse,
+		},
+		{
+			&domain.NSenterMessage{
+				Type:    domain.ReadFileRequest,
+				Payload: domain.ReadFilePayload{File: file, Len: 64},
+			},
+			domain.ReadFileResponse,
+		},
+		{
+			&domain.NSenterMessage{
+				Type:    domain.WriteFileRequest,
+				Payload: domain.WriteFilePayload{File: file, Data: []byte("1\n")},
+			},
+			domain.WriteFileResponse,
+		},
+		{
+			&domain.NSenterMessage{
+				Type:    domain.ReadDirRequest,
+				Payload: domain.ReadDirPayload{Dir: dir},
+			},
+			domain.ReadDirResponse,
+		},
+		{
+			&domain.NSenterMessage{
+				Type:    domain.LookupBatchRequest,
+				Payload: domain.LookupBatchPayload{Entries: []string{dir, file}},
+			},
+			domain.LookupBatchResponse,
+		},
+		{
+			&domain.NSenterMessage{
+				Type:    domain.MountInodeRequest,
+				Payload: domain.MountInodeReqPayload{Mountpoints: []string{dir}},
+			},
+			domain.MountInodeResponse,
+		},
+		{
+			&domain.NSenterMessage{
+				Type: domain.ChownSyscallRequest,
+				Payload: []domain.ChownSyscallPayload{
+					{Target: file, TargetUid: os.Getuid(), TargetGid: os.Getgid()},
+				},
+			},
+			domain.ChownSyscallResponse,
+		},
+		{
+			&domain.NSenterMessage{
+				Type:    domain.SleepRequest,
+				Payload: domain.SleepReqPayload{Ival: "0"},
+			},
+			domain.SleepResponse,
+		},
+	}
+
+	// Requests are queued (along with the requester's credentials) before the
+	// filter is installed, as sysbox-fs does from outside of the nsenter
+	// process.
+	pipes := make([]*os.File, len(requests))
+
+	for i, r := range requests {
+		fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		if err != nil {
+			t.Fatalf("unable to create socket pair: %v", err)
+		}
+		pipes[i] = os.NewFile(uintptr(fds[0]), "pipe")
+
+		cred := &syscall.Ucred{
+			Pid: int32(os.Getpid()),
+			Uid: uint32(os.Getuid()),
+			Gid: uint32(os.Getgid()),
+		}
+		if err := syscall.Sendmsg(fds[1], nil, syscall.UnixCredentials(cred), nil, 0); err != nil {
+			t.Fatalf("unable to send credentials: %v", err)
+		}
+
+		data, err := encodeMsg(r.req)
+		if err != nil {
+			t.Fatalf("unable to encode request: %v", err)
+		}
+		if _, err := syscall.Write(fds[1], data); err != nil {
+			t.Fatalf("unable to send request: %v", err)
+		}
+	}
+
+	if err := installSeccompFilter(); err != nil {
+		t.Skipf("unable to install nsenter seccomp filter: %v", err)
+	}
+
+	for i, r := range requests {
+		e := &NSenterEvent{}
+
+		if err := e.processRequest(pipes[i]); err != nil {
+			t.Errorf("%s: processRequest() failed: %v", r.req.Type, err)
+			continue
+		}
+		if e.ResMsg.Type != r.want {
+			t.Errorf("%s: response = %+v; want %s", r.req.Type, *e.ResMsg, r.want)
+		}
+	}
+}
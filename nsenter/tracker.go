@@ -0,0 +1,149 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Tracks the nsenter processes launched by sysbox-fs, so that the ones still
+// alive can be terminated during sysbox-fs shutdown. Once shutdown starts, no
+// new nsenter requests are accepted.
+//
+// The tracker also caps the number of concurrent nsenter requests (see
+// domain.MaxNSenterProcs()): requests beyond this limit wait for an in-flight
+// one to complete.
+//
+type nsenterTracker struct {
+	sync.Mutex
+	procs    map[int]*os.Process
+	shutdown bool
+	active   int           // number of nsenter requests in-flight
+	released chan struct{} // closed (and renewed) upon every request completion
+}
+
+func newNSenterTracker() *nsenterTracker {
+	return &nsenterTracker{
+		procs:    make(map[int]*os.Process),
+		released: make(chan struct{}),
+	}
+}
+
+func (t *nsenterTracker) accepting() bool {
+	if t == nil {
+		return true
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	return !t.shutdown
+}
+
+// Registers the beginning of an nsenter request, waiting for the number of
+// in-flight requests to drop below the configured limit. Returns false if the
+// limit is still reached after the given timeout.
+func (t *nsenterTracker) acquire(timeout time.Duration) bool {
+	if t == nil {
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	t.Lock()
+	for max := domain.MaxNSenterProcs(); max > 0 && t.active >= max; max = domain.MaxNSenterProcs() {
+		released := t.released
+		t.Unlock()
+
+		select {
+		case <-released:
+		case <-timer.C:
+			return false
+		}
+
+		t.Lock()
+	}
+	t.active++
+	t.Unlock()
+
+	return true
+}
+
+// Registers the completion of an nsenter request.
+func (t *nsenterTracker) release() {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.active--
+	close(t.released)
+	t.released = make(chan struct{})
+}
+
+func (t *nsenterTracker) add(p *os.Process) {
+	if t == nil || p == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.procs[p.Pid] = p
+}
+
+func (t *nsenterTracker) remove(p *os.Process) {
+	if t == nil || p == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.procs, p.Pid)
+}
+
+// Stops accepting new nsenter requests and kills the tracked nsenter processes.
+// Returns the number of processes killed.
+func (t *nsenterTracker) terminate() int {
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.shutdown = true
+
+	var killed int
+	for pid, p := range t.procs {
+		if err := p.Kill(); err != nil {
+			logrus.Debugf("Unable to kill nsenter process %d: %v", pid, err)
+			continue
+		}
+		killed++
+	}
+
+	return killed
+}
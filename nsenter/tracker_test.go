@@ -0,0 +1,67 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+func TestNSenterTrackerLimit(t *testing.T) {
+
+	defer domain.SetMaxNSenterProcs(domain.MaxNSenterProcs())
+
+	// Unlimited requests.
+	domain.SetMaxNSenterProcs(0)
+
+	tr := newNSenterTracker()
+	for i := 0; i < 8; i++ {
+		if !tr.acquire(time.Millisecond) {
+			t.Fatalf("acquire() failed with no limit set")
+		}
+	}
+	for i := 0; i < 8; i++ {
+		tr.release()
+	}
+
+	// Requests beyond the limit wait for an in-flight one to complete.
+	domain.SetMaxNSenterProcs(2)
+
+	if !tr.acquire(time.Millisecond) || !tr.acquire(time.Millisecond) {
+		t.Fatalf("acquire() failed below the limit")
+	}
+	if tr.acquire(10 * time.Millisecond) {
+		t.Fatalf("acquire() succeeded beyond the limit")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		tr.release()
+	}()
+
+	if !tr.acquire(time.Second) {
+		t.Fatalf("acquire() failed after an in-flight request completed")
+	}
+
+	// Requests issued without a tracker aren't limited.
+	var nilTracker *nsenterTracker
+	if !nilTracker.acquire(0) {
+		t.Errorf("acquire() failed without a tracker")
+	}
+}
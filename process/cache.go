@@ -0,0 +1,200 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cap "github.com/nestybox/sysbox-libs/capability"
+)
+
+//
+// Short-lived cache of the credentials (uid, gid, supplementary groups) and
+// capabilities of the processes dealt with by sysbox-fs, so that bursts of
+// operations issued by the same process (e.g., a directory walk) don't parse
+// its /proc/<pid>/status file over and over.
+//
+// Entries are keyed by pid and start-time (to tell apart recycled pids), and
+// expire after credsCacheTTL, which bounds the window during which changes of
+// a process' credentials (e.g., setuid()) may go unnoticed.
+//
+
+const (
+	credsCacheTTL     = time.Second
+	credsCacheMaxSize = 1024
+)
+
+type credsCacheKey struct {
+	pid       uint32
+	startTime uint64
+}
+
+type credsCacheEntry struct {
+	uid     uint32
+	gid     uint32
+	sgid    []uint32
+	cap     cap.Capabilities // never modified; processes get a copy of it
+	expires time.Time
+}
+
+type credsCache struct {
+	sync.Mutex
+	entries map[credsCacheKey]*credsCacheEntry
+}
+
+func newCredsCache() *credsCache {
+	return &credsCache{
+		entries: make(map[credsCacheKey]*credsCacheEntry),
+	}
+}
+
+func (cc *credsCache) get(key credsCacheKey) *credsCacheEntry {
+	cc.Lock()
+	defer cc.Unlock()
+
+	e, ok := cc.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(e.expires) {
+		delete(cc.entries, key)
+		return nil
+	}
+
+	return e
+}
+
+func (cc *credsCache) set(key credsCacheKey, e *credsCacheEntry) {
+	cc.Lock()
+	defer cc.Unlock()
+
+	now := time.Now()
+
+	// Expired entries are swept once the cache grows too large.
+	if len(cc.entries) >= credsCacheMaxSize {
+		for k, v := range cc.entries {
+			if now.After(v.expires) {
+				delete(cc.entries, k)
+			}
+		}
+	}
+
+	e.expires = now.Add(credsCacheTTL)
+	cc.entries[key] = e
+}
+
+// Returns the cache key of the process, or false if the process can't be
+// cached (e.g., it refers to the calling process).
+func (p *process) credsCacheKey() (credsCacheKey, bool) {
+
+	if p.pid == 0 || p.ps == nil || p.ps.cache == nil {
+		return credsCacheKey{}, false
+	}
+
+	startTime, err := procStartTime(p.pid)
+	if err != nil {
+		return credsCacheKey{}, false
+	}
+
+	return credsCacheKey{pid: p.pid, startTime: startTime}, true
+}
+
+// Returns the cached credentials & capabilities of the process (if any).
+func (p *process) cachedCreds() *credsCacheEntry {
+
+	key, ok := p.credsCacheKey()
+	if !ok {
+		return nil
+	}
+
+	return p.ps.cache.get(key)
+}
+
+// Caches the credentials & capabilities of the process.
+func (p *process) cacheCreds() {
+
+	key, ok := p.credsCacheKey()
+	if !ok || p.cap == nil {
+		return
+	}
+
+	c, err := cloneCapability(int(p.pid), p.cap)
+	if err != nil {
+		return
+	}
+
+	p.ps.cache.set(key, &credsCacheEntry{
+		uid:  p.uid,
+		gid:  p.gid,
+		sgid: p.sgid,
+		cap:  c,
+	})
+}
+
+// Returns the start-time of the given process, as per /proc/<pid>/stat.
+func procStartTime(pid uint32) (uint64, error) {
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name may contain spaces and parentheses, so fields are
+	// counted after its closing parenthesis (i.e., starting at the 3rd one).
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// Returns a copy of the given capabilities, bound to the given pid.
+func cloneCapability(pid int, src cap.Capabilities) (cap.Capabilities, error) {
+
+	c, err := cap.NewPid2(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := []cap.CapType{
+		cap.EFFECTIVE, cap.PERMITTED, cap.INHERITABLE, cap.BOUNDING, cap.AMBIENT,
+	}
+
+	c.Clear(cap.CAPS | cap.BOUNDS | cap.AMBS)
+
+	for _, kind := range kinds {
+		for _, v := range cap.List() {
+			if src.Get(kind, v) {
+				c.Set(kind, v)
+			}
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,75 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+// Cgroups returns the process' cgroup memberships, as seen from the host (i.e.,
+// sysbox-fs' cgroup namespace). Named cgroup v1 hierarchies (e.g.,
+// name=systemd) are skipped.
+func (p *process) Cgroups() ([]domain.CgroupMembership, error) {
+
+	path := fmt.Sprintf("/proc/%d/cgroup", p.pid)
+
+	data, err := p.ps.ios.NewIOnode(filepath.Base(path), path, 0).ReadFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.ParseCgroupMemberships(data), nil
+}
+
+// CgroupPath returns the host path of the process' cgroup within the hierarchy
+// the given controller is attached to. Under cgroup v2 (or for an empty
+// controller), the process' cgroup within the unified hierarchy is returned,
+// whose mountpoint depends on whether the host is a cgroup v2-only or a hybrid
+// one. In hybrid setups, cgroup v1 hierarchies take precedence.
+func (p *process) CgroupPath(controller string) (string, error) {
+
+	cgroups, err := p.Cgroups()
+	if err != nil {
+		return "", err
+	}
+
+	m, root, ok := domain.LookupCgroup(cgroups, controller)
+	if !ok {
+		return "", fmt.Errorf("no cgroup found for controller %q of process %d",
+			controller, p.pid)
+	}
+
+	return filepath.Join(root, m.Path), nil
+}
+
+// ReadCgroupFile returns the contents of the given file (e.g., "memory.max")
+// of the process' cgroup within the hierarchy the given controller is
+// attached to (see CgroupPath()).
+func (p *process) ReadCgroupFile(controller, name string) ([]byte, error) {
+
+	dir, err := p.CgroupPath(controller)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, name)
+
+	return p.ps.ios.NewIOnode(name, path, 0).ReadFile()
+}
@@ -0,0 +1,104 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-fs/sysio"
+)
+
+func TestProcessCgroups(t *testing.T) {
+
+	ios := sysio.NewIOService(domain.IOMemFileService)
+
+	ps := NewProcessService()
+	ps.Setup(ios)
+
+	writeFile := func(path, data string) {
+		n := ios.NewIOnode(filepath.Base(path), path, 0)
+		if err := n.WriteFile([]byte(data)); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	// cgroup v1 (hybrid).
+	writeFile("/proc/1001/cgroup",
+		"12:cpu,cpuacct:/sysbox/c1\n"+
+			"5:memory:/sysbox/c1\n"+
+			"1:name=systemd:/sysbox/c1\n"+
+			"0::/sysbox/c1/init\n")
+	writeFile("/sys/fs/cgroup/memory/sysbox/c1/memory.limit_in_bytes", "1073741824\n")
+
+	// cgroup v2.
+	writeFile("/proc/2001/cgroup", "0::/sysbox/c2/init.scope\n")
+	writeFile("/sys/fs/cgroup/sysbox/c2/init.scope/memory.max", "max\n")
+
+	p1 := ps.ProcessCreate(1001, 0, 0)
+	p2 := ps.ProcessCreate(2001, 0, 0)
+
+	cgroups, err := p1.Cgroups()
+	if err != nil {
+		t.Fatalf("Cgroups() failed: %v", err)
+	}
+	want := []domain.CgroupMembership{
+		{Hierarchy: 12, Controllers: "cpu,cpuacct", Path: "/sysbox/c1"},
+		{Hierarchy: 5, Controllers: "memory", Path: "/sysbox/c1"},
+		{Hierarchy: 0, Controllers: "", Path: "/sysbox/c1/init"},
+	}
+	if !reflect.DeepEqual(cgroups, want) {
+		t.Errorf("Cgroups() = %v, want %v", cgroups, want)
+	}
+
+	tests := []struct {
+		p          domain.ProcessIface
+		controller string
+		want       string
+		wantErr    bool
+	}{
+		{p1, "cpuacct", "/sys/fs/cgroup/cpu,cpuacct/sysbox/c1", false},
+		{p1, "memory", "/sys/fs/cgroup/memory/sysbox/c1", false},
+		{p1, "pids", "/sys/fs/cgroup/unified/sysbox/c1/init", false},
+		{p1, "", "/sys/fs/cgroup/unified/sysbox/c1/init", false},
+		{p2, "memory", "/sys/fs/cgroup/sysbox/c2/init.scope", false},
+		{ps.ProcessCreate(3001, 0, 0), "memory", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.p.CgroupPath(tt.controller)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CgroupPath(%q) error = %v, wantErr %v", tt.controller, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CgroupPath(%q) = %q, want %q", tt.controller, got, tt.want)
+		}
+	}
+
+	data, err := p1.ReadCgroupFile("memory", "memory.limit_in_bytes")
+	if err != nil || string(data) != "1073741824\n" {
+		t.Errorf("ReadCgroupFile() = %q, %v", data, err)
+	}
+
+	data, err = p2.ReadCgroupFile("memory", "memory.max")
+	if err != nil || string(data) != "max\n" {
+		t.Errorf("ReadCgroupFile() = %q, %v", data, err)
+	}
+}
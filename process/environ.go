@@ -0,0 +1,136 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+)
+
+//
+// Accessors of the program being run by a process (i.e., its command name,
+// executable and environment), to allow policy decisions to be keyed on the
+// calling program.
+//
+// Notice that these attributes are controlled by the process itself (e.g., the
+// comm can be altered through prctl(PR_SET_NAME)), so they must not be relied
+// upon as a security boundary. Reads are bounded in size, and the process'
+// start-time is verified around them, so that the attributes of a process that
+// recycled the pid are never reported.
+//
+
+// Max amount of data read out of the process' environment.
+const environMaxSize = 128 * 1024
+
+// Comm returns the command name of the process.
+func (p *process) Comm() (string, error) {
+
+	data, err := p.readProcFile("comm", 64)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// Exe returns the path of the executable being run by the process (as seen
+// within the process' mount namespace).
+func (p *process) Exe() (string, error) {
+
+	var exe string
+
+	err := p.withStableIdentity(func() error {
+		var err error
+		exe, err = os.Readlink(fmt.Sprintf("/proc/%d/exe", p.pid))
+		return err
+	})
+
+	return exe, err
+}
+
+// Environ returns the given variables of the process' (initial) environment.
+// Variables not present in the environment are not reported.
+func (p *process) Environ(keys ...string) (map[string]string, error) {
+
+	data, err := p.readProcFile("environ", environMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		kv := strings.SplitN(string(entry), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		for _, key := range keys {
+			if kv[0] == key {
+				env[key] = kv[1]
+				break
+			}
+		}
+	}
+
+	return env, nil
+}
+
+// Reads up to 'max' bytes of the given /proc/<pid> file.
+func (p *process) readProcFile(name string, max int64) ([]byte, error) {
+
+	var data []byte
+
+	err := p.withStableIdentity(func() error {
+		f, err := os.Open(fmt.Sprintf("/proc/%d/%s", p.pid, name))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		data, err = ioutil.ReadAll(io.LimitReader(f, max))
+		return err
+	})
+
+	return data, err
+}
+
+// Runs the given function, and verifies that the process' pid hasn't been
+// recycled in the meantime (i.e., the process' start-time is the same before
+// and after). Returns syscall.ESRCH if the process is gone.
+func (p *process) withStableIdentity(fn func() error) error {
+
+	before, err := procStartTime(p.pid)
+	if err != nil {
+		return syscall.ESRCH
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	after, err := procStartTime(p.pid)
+	if err != nil || after != before {
+		return syscall.ESRCH
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessProgramAccessors(t *testing.T) {
+
+	cmd := exec.Command("sleep", "60")
+	cmd.Env = []string{"FOO=bar", "EMPTY=", "OTHER=baz=qux"}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+
+	p := &process{pid: uint32(cmd.Process.Pid)}
+
+	// Wait for the child to exec.
+	var (
+		comm string
+		err  error
+	)
+	for i := 0; i < 100; i++ {
+		if comm, err = p.Comm(); err == nil && comm == "sleep" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil || comm != "sleep" {
+		t.Errorf("Comm() = %q, %v, want %q", comm, err, "sleep")
+	}
+
+	exe, err := p.Exe()
+	if err != nil || filepath.Base(exe) != "sleep" {
+		t.Errorf("Exe() = %q, %v", exe, err)
+	}
+
+	env, err := p.Environ("FOO", "EMPTY", "OTHER", "MISSING")
+	want := map[string]string{"FOO": "bar", "EMPTY": "", "OTHER": "baz=qux"}
+	if err != nil || !reflect.DeepEqual(env, want) {
+		t.Errorf("Environ() = %v, %v, want %v", env, err, want)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	if _, err := p.Comm(); err != syscall.ESRCH {
+		t.Errorf("Comm() of exited process = %v, want %v", err, syscall.ESRCH)
+	}
+}
@@ -0,0 +1,115 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+//
+// Process handles pin the identity of a process (i.e., its pid along with its
+// start-time), so that sysbox-fs can verify that the process is still alive,
+// and that its pid hasn't been recycled, before (and after) acting on its
+// behalf (e.g., entering its namespaces).
+//
+// Liveness is tracked through a pidfd where supported (kernel 5.3+, see
+// domain.KernelFeaturePidfd), as a pidfd keeps referring to the original
+// process even if its pid is reused. Otherwise, the process' start-time is
+// relied upon.
+//
+type processHandle struct {
+	pid       uint32
+	pidfd     int // -1 if pidfds are not supported
+	startTime uint64
+}
+
+// ProcessHandle returns a handle to the given process. Returns syscall.ESRCH if
+// the process is gone.
+func (ps *processService) ProcessHandle(pid uint32) (domain.ProcessHandleIface, error) {
+
+	startTime, err := procStartTime(pid)
+	if err != nil {
+		return nil, syscall.ESRCH
+	}
+
+	pidfd := -1
+	if domain.KernelFeatureSupported(domain.KernelFeaturePidfd) {
+		pidfd, err = unix.PidfdOpen(int(pid), 0)
+		if err != nil {
+			if err != unix.ENOSYS {
+				if err == unix.ESRCH {
+					return nil, syscall.ESRCH
+				}
+				return nil, err
+			}
+			pidfd = -1
+		}
+	}
+
+	h := &processHandle{
+		pid:       pid,
+		pidfd:     pidfd,
+		startTime: startTime,
+	}
+
+	// The pid may have been recycled right before the pidfd was opened, in
+	// which case the start-time won't match.
+	if !h.Alive() {
+		h.Close()
+		return nil, syscall.ESRCH
+	}
+
+	return h, nil
+}
+
+func (h *processHandle) Pid() uint32 {
+	return h.pid
+}
+
+// Alive returns true if the process is still alive, and its pid hasn't been
+// recycled since the handle was obtained.
+func (h *processHandle) Alive() bool {
+
+	if h.pidfd >= 0 {
+		if err := unix.PidfdSendSignal(h.pidfd, 0, nil, 0); err != nil {
+			return false
+		}
+	}
+
+	startTime, err := procStartTime(h.pid)
+	if err != nil {
+		return false
+	}
+
+	return startTime == h.startTime
+}
+
+func (h *processHandle) Close() error {
+
+	if h.pidfd < 0 {
+		return nil
+	}
+
+	err := unix.Close(h.pidfd)
+	h.pidfd = -1
+
+	return err
+}
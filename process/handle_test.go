@@ -0,0 +1,68 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestProcessHandle(t *testing.T) {
+
+	ps := NewProcessService()
+
+	// Live process.
+	h, err := ps.ProcessHandle(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatalf("ProcessHandle() failed: %v", err)
+	}
+	defer h.Close()
+
+	if !h.Alive() {
+		t.Fatalf("Alive() = false for the running process")
+	}
+
+	// Process exiting after the handle is obtained.
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+
+	ch, err := ps.ProcessHandle(uint32(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("ProcessHandle() failed: %v", err)
+	}
+	defer ch.Close()
+
+	if !ch.Alive() {
+		t.Fatalf("Alive() = false for pid %d", cmd.Process.Pid)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	if ch.Alive() {
+		t.Fatalf("Alive() = true for exited pid %d", cmd.Process.Pid)
+	}
+
+	// Gone process.
+	if _, err := ps.ProcessHandle(uint32(cmd.Process.Pid)); err != syscall.ESRCH {
+		t.Fatalf("ProcessHandle() = %v, want %v", err, syscall.ESRCH)
+	}
+}
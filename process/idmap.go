@@ -0,0 +1,116 @@
+//
+// Copyright 2019-2021 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"github.com/nestybox/sysbox-runc/libcontainer/user"
+)
+
+//
+// User-namespace id translation helpers.
+//
+// Ids are translated between the ones seen within the process' user-ns and the
+// ones seen from the host (i.e., sysbox-fs' user-ns), as per the process'
+// uid_map & gid_map files. The boolean return value reports whether the id is
+// mapped at all; unmapped ids are displayed as the overflow uid / gid within
+// the user-ns (e.g., 65534), and can't be translated back into the host.
+//
+
+// UidToHost translates a uid of the process' user-ns into the host's one.
+func (p *process) UidToHost(uid uint32) (uint32, bool) {
+
+	uidMap, err := p.UidMap()
+	if err != nil {
+		return 0, false
+	}
+
+	return idToParent(uidMap, uid)
+}
+
+// UidFromHost translates a host uid into the process' user-ns.
+func (p *process) UidFromHost(uid uint32) (uint32, bool) {
+
+	uidMap, err := p.UidMap()
+	if err != nil {
+		return 0, false
+	}
+
+	return idFromParent(uidMap, uid)
+}
+
+// GidToHost translates a gid of the process' user-ns into the host's one.
+func (p *process) GidToHost(gid uint32) (uint32, bool) {
+
+	gidMap, err := p.GidMap()
+	if err != nil {
+		return 0, false
+	}
+
+	return idToParent(gidMap, gid)
+}
+
+// GidFromHost translates a host gid into the process' user-ns.
+func (p *process) GidFromHost(gid uint32) (uint32, bool) {
+
+	gidMap, err := p.GidMap()
+	if err != nil {
+		return 0, false
+	}
+
+	return idFromParent(gidMap, gid)
+}
+
+// idsMapped returns true if the given (host) uid & gid are both mapped within
+// the process' user-ns.
+func (p *process) idsMapped(uid, gid uint32) bool {
+
+	if _, ok := p.UidFromHost(uid); !ok {
+		return false
+	}
+
+	_, ok := p.GidFromHost(gid)
+
+	return ok
+}
+
+// Translates an id of the user-ns into the parent user-ns' one, as per the
+// given id-map.
+func idToParent(idMap []user.IDMap, id uint32) (uint32, bool) {
+
+	for _, m := range idMap {
+		first, count := int64(m.ID), int64(m.Count)
+		if int64(id) >= first && int64(id) < first+count {
+			return uint32(int64(m.ParentID) + int64(id) - first), true
+		}
+	}
+
+	return 0, false
+}
+
+// Translates an id of the parent user-ns into the user-ns' one, as per the
+// given id-map.
+func idFromParent(idMap []user.IDMap, id uint32) (uint32, bool) {
+
+	for _, m := range idMap {
+		first, count := int64(m.ParentID), int64(m.Count)
+		if int64(id) >= first && int64(id) < first+count {
+			return uint32(int64(m.ID) + int64(id) - first), true
+		}
+	}
+
+	return 0, false
+}
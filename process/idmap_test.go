@@ -0,0 +1,64 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package process
+
+import (
+	"testing"
+
+	"github.com/nestybox/sysbox-runc/libcontainer/user"
+)
+
+func TestIDMapTranslation(t *testing.T) {
+
+	idMap := []user.IDMap{
+		{ID: 0, ParentID: 165536, Count: 1000},
+		{ID: 1000, ParentID: 100000, Count: 1},
+		{ID: 1001, ParentID: 166537, Count: 64535},
+	}
+
+	tests := []struct {
+		id     uint32
+		parent uint32
+	}{
+		{0, 165536},
+		{999, 166535},
+		{1000, 100000},
+		{1001, 166537},
+		{65535, 231071},
+	}
+
+	for _, tt := range tests {
+		if got, ok := idToParent(idMap, tt.id); !ok || got != tt.parent {
+			t.Errorf("idToParent(%d) = %d, %v, want %d", tt.id, got, ok, tt.parent)
+		}
+		if got, ok := idFromParent(idMap, tt.parent); !ok || got != tt.id {
+			t.Errorf("idFromParent(%d) = %d, %v, want %d", tt.parent, got, ok, tt.id)
+		}
+	}
+
+	// Unmapped ids.
+	for _, id := range []uint32{65536, 4294967295} {
+		if got, ok := idToParent(idMap, id); ok {
+			t.Errorf("idToParent(%d) = %d, want unmapped", id, got)
+		}
+	}
+	for _, id := range []uint32{0, 166536, 231072} {
+		if got, ok := idFromParent(idMap, id); ok {
+			t.Errorf("idFromParent(%d) = %d, want unmapped", id, got)
+		}
+	}
+}
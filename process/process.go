@@ -37,11 +37,14 @@ import (
 )
 
 type processService struct {
-	ios domain.IOServiceIface
+	ios   domain.IOServiceIface
+	cache *credsCache // per-process credentials & capabilities
 }
 
 func NewProcessService() domain.ProcessServiceIface {
-	return &processService{}
+	return &processService{
+		cache: newCredsCache(),
+	}
 }
 
 func (ps *processService) Setup(ios domain.IOServiceIface) {
@@ -174,6 +177,27 @@ func (p *process) SetEffCaps(caps [2]uint32) {
 	p.cap.SetEffCaps(caps)
 }
 
+// GetAmbientCaps returns the process' ambient capabilities, in the same layout
+// as the effective ones returned by GetEffCaps().
+func (p *process) GetAmbientCaps() [2]uint32 {
+
+	var caps [2]uint32
+
+	if p.cap == nil {
+		if err := p.initCapability(); err != nil {
+			return caps
+		}
+	}
+
+	for _, c := range cap.List() {
+		if c < 64 && p.cap.Get(cap.AMBIENT, c) {
+			caps[c>>5] |= 1 << (uint(c) & 31)
+		}
+	}
+
+	return caps
+}
+
 // Simple wrapper method to set capability values.
 func (p *process) setCapability(which cap.CapType, what ...cap.Cap) {
 
@@ -204,6 +228,15 @@ func (p *process) IsCapabilitySet(which cap.CapType, what cap.Cap) bool {
 // them within 'capability' data-struct.
 func (p *process) initCapability() error {
 
+	if e := p.cachedCreds(); e != nil {
+		c, err := cloneCapability(int(p.pid), e.cap)
+		if err != nil {
+			return err
+		}
+		p.cap = c
+		return nil
+	}
+
 	c, err := cap.NewPid2(int(p.pid))
 	if err != nil {
 		return err
@@ -230,9 +263,11 @@ func (p *process) GetFd(fd int32) (string, error) {
 func (p *process) AdjustPersonality(
 	uid uint32,
 	gid uint32,
+	sgid []uint32,
 	root string,
 	cwd string,
-	caps [2]uint32) error {
+	caps [2]uint32,
+	ambientCaps [2]uint32) error {
 
 	if cwd != p.Cwd() {
 		if err := unix.Chdir(cwd); err != nil {
@@ -246,6 +281,18 @@ func (p *process) AdjustPersonality(
 		}
 	}
 
+	// Supplementary groups must be set prior to giving up the CAP_SETGID
+	// capability (i.e., prior to the uid change below).
+	if !sgidEqual(sgid, p.SGid()) {
+		groups := make([]int, len(sgid))
+		for i, g := range sgid {
+			groups[i] = int(g)
+		}
+		if err := unix.Setgroups(groups); err != nil {
+			return err
+		}
+	}
+
 	if gid != p.Gid() {
 		// Execute setresgid() syscall to set this process' effective gid.
 		if err := setxid.Setresgid(-1, int(gid), -1); err != nil {
@@ -274,9 +321,40 @@ func (p *process) AdjustPersonality(
 		}
 	}
 
+	if ambientCaps != p.GetAmbientCaps() {
+		// Raise the ambient capabilities of the original process. These must be
+		// both permitted and inheritable, so they're restricted to the effective
+		// ones applied above.
+		p.cap.Clear(cap.AMBIENT)
+		for _, c := range cap.List() {
+			if c < 64 && ambientCaps[c>>5]&caps[c>>5]&(1<<(uint(c)&31)) != 0 {
+				p.cap.Set(cap.INHERITABLE|cap.AMBIENT, c)
+			}
+		}
+		if err := p.cap.Apply(cap.CAPS | cap.AMBS); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Returns true if the given supplementary group lists are equal.
+func sgidEqual(a, b []uint32) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (p *process) NsInodes() (map[string]domain.Inode, error) {
 
 	// First invocation causes the process ns inodes to be parsed
@@ -375,6 +453,62 @@ func (p *process) UserNsInodeParent() (domain.Inode, error) {
 	return stat.Ino, nil
 }
 
+// Returns the inodes of the ancestors of the process' user namespace, from its
+// parent up to the topmost one visible to sysbox-fs.
+func (p *process) UserNsAncestors() ([]domain.Inode, error) {
+
+	// ioctl to retrieve the parent namespace.
+	const NS_GET_PARENT = 0xb702
+
+	// Max nesting level of user namespaces.
+	const maxUserNsDepth = 32
+
+	usernsPath := filepath.Join(
+		"/proc",
+		strconv.FormatUint(uint64(p.pid), 10),
+		"ns",
+		"user",
+	)
+
+	nsFd, err := unix.Open(usernsPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var ancestors []domain.Inode
+
+	for i := 0; i < maxUserNsDepth; i++ {
+		ret, _, errno := unix.Syscall(
+			unix.SYS_IOCTL,
+			uintptr(nsFd),
+			uintptr(NS_GET_PARENT),
+			0)
+		unix.Close(nsFd)
+
+		// EPERM is returned once the parent lies out of sysbox-fs' reach (i.e.,
+		// topmost namespace reached).
+		if errno == unix.EPERM {
+			return ancestors, nil
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		nsFd = int(ret)
+
+		var stat unix.Stat_t
+		if err := unix.Fstat(nsFd, &stat); err != nil {
+			unix.Close(nsFd)
+			return nil, err
+		}
+
+		ancestors = append(ancestors, stat.Ino)
+	}
+
+	unix.Close(nsFd)
+
+	return ancestors, nil
+}
+
 // Collects the namespace inodes of the given process
 func (p *process) GetNsInodes() (map[string]domain.Inode, error) {
 
@@ -510,6 +644,47 @@ func (p *process) PathAccess(path string, aMode domain.AccessMode, followSymlink
 	return p.pathAccess(path, aMode, followSymlink)
 }
 
+// CheckAccess evaluates whether the process is allowed to access a file with the
+// given ownership & mode, as access(2) would do. The file's uid & gid are those
+// seen from the host (i.e., already mapped through the sys container's user-ns),
+// and the process' capabilities only override the file's permissions if these
+// are mapped within the process' user-ns (as per capabilities(7)).
+//
+// Returns syscall.EACCES if access is denied.
+func (p *process) CheckAccess(uid, gid uint32, mode os.FileMode, aMode domain.AccessMode) error {
+
+	if err := p.init(); err != nil {
+		return err
+	}
+
+	if p.permGranted(uid, gid, mode, aMode, p.idsMapped(uid, gid)) {
+		return nil
+	}
+
+	return syscall.EACCES
+}
+
+// Umask returns the file mode creation mask of the process. Relies on the
+// "Umask" field of /proc/[pid]/status (kernel 4.7+).
+func (p *process) Umask() (os.FileMode, error) {
+
+	if err := p.getStatus([]string{"Umask"}); err != nil {
+		return 0, err
+	}
+
+	val, ok := p.status["Umask"]
+	if !ok {
+		return 0, syscall.ENOTSUP
+	}
+
+	umask, err := strconv.ParseUint(strings.TrimSpace(val), 8, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return os.FileMode(umask) & os.ModePerm, nil
+}
+
 // init() retrieves info about the process to initialize its main attributes.
 func (p *process) init() error {
 
@@ -517,6 +692,24 @@ func (p *process) init() error {
 		return nil
 	}
 
+	// Credentials & capabilities of processes recently initialized are picked
+	// from the cache.
+	if e := p.cachedCreds(); e != nil {
+		if p.cap == nil {
+			c, err := cloneCapability(int(p.pid), e.cap)
+			if err != nil {
+				return err
+			}
+			p.cap = c
+		}
+		p.initPaths()
+		p.uid = e.uid
+		p.gid = e.gid
+		p.sgid = e.sgid
+		p.initialized = true
+		return nil
+	}
+
 	space := regexp.MustCompile(`\s+`)
 
 	fields := []string{"Uid", "Gid", "Groups"}
@@ -564,11 +757,9 @@ func (p *process) init() error {
 		sgid = append(sgid, uint32(val))
 	}
 
-	// process root & cwd
-	root := fmt.Sprintf("/proc/%d/root", p.pid)
-	cwd := fmt.Sprintf("/proc/%d/cwd", p.pid)
-
-	// process capabilities
+	// process capabilities (only cached if loaded here, as these may have been
+	// adjusted otherwise)
+	cacheable := p.cap == nil
 	if p.cap == nil {
 		if err := p.initCapability(); err != nil {
 			return err
@@ -576,20 +767,33 @@ func (p *process) init() error {
 	}
 
 	// store all collected attributes
-	p.root, _ = os.Readlink(root)
-	p.cwd, _ = os.Readlink(cwd)
-	p.procroot = root
-	p.proccwd = cwd
+	p.initPaths()
 	p.uid = uint32(euid)
 	p.gid = uint32(egid)
 	p.sgid = sgid
 
+	if cacheable {
+		p.cacheCreds()
+	}
+
 	// Mark process as fully initialized.
 	p.initialized = true
 
 	return nil
 }
 
+// initPaths collects the process' root & cwd, which are not cached as these
+// are prone to change.
+func (p *process) initPaths() {
+	root := fmt.Sprintf("/proc/%d/root", p.pid)
+	cwd := fmt.Sprintf("/proc/%d/cwd", p.pid)
+
+	p.root, _ = os.Readlink(root)
+	p.cwd, _ = os.Readlink(cwd)
+	p.procroot = root
+	p.proccwd = cwd
+}
+
 // getStatus retrieves process status info obtained from the
 // /proc/[pid]/status file.
 func (p *process) getStatus(fields []string) error {
@@ -640,6 +844,9 @@ func (p *process) getStatus(fields []string) error {
 // "/proc/self/fd/3" symlink points to "/proc/self/cwd", and "/proc/self/cwd"
 // points to "/some/path", this function follows the symlinks and returns
 // "/some/path".
+//
+// Symlinks are read through openat2() (see readProcLink()), so that the
+// resolution can't be redirected by swapping path components mid-operation.
 
 func (p *process) ResolveProcSelf(path string) (string, error) {
 
@@ -654,12 +861,12 @@ func (p *process) ResolveProcSelf(path string) (string, error) {
 			break
 		}
 
-		fi, err := os.Lstat(currPath)
+		target, isLink, err := p.readProcLink(strings.TrimPrefix(currPath, "/proc/self/"))
 		if err != nil {
 			return "", err
 		}
 
-		if fi.Mode()&os.ModeSymlink != os.ModeSymlink {
+		if !isLink {
 			break
 		}
 
@@ -669,18 +876,83 @@ func (p *process) ResolveProcSelf(path string) (string, error) {
 			return "", syscall.ELOOP
 		}
 
-		// path starts with "/proc/self/" and is a symlink, proceed to resolve it
+		currPath = target
+	}
 
-		procPid := fmt.Sprintf("/proc/%d/", p.pid)
-		procPidPath := strings.Replace(currPath, "/proc/self/", procPid, 1)
+	return currPath, nil
+}
 
-		currPath, err = os.Readlink(procPidPath)
-		if err != nil {
-			return "", err
-		}
+// Reads the symlink at the given path relative to the process' procfs
+// directory (i.e., "/proc/<pid>"). Returns false if the path is not a symlink.
+//
+// The path is resolved beneath the procfs directory without following any
+// symlinks along the way (i.e., openat2() with RESOLVE_BENEATH and
+// RESOLVE_NO_SYMLINKS), and the symlink is then read through the obtained file
+// descriptor. On kernels lacking openat2() (< 5.6) the symlink is read by path.
+func (p *process) readProcLink(relPath string) (string, bool, error) {
+
+	procPid := fmt.Sprintf("/proc/%d", p.pid)
+
+	if !domain.KernelFeatureSupported(domain.KernelFeatureOpenat2) {
+		return readProcLinkByPath(filepath.Join(procPid, relPath))
 	}
 
-	return currPath, nil
+	dirFd, err := unix.Open(procPid, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return "", false, err
+	}
+	defer unix.Close(dirFd)
+
+	fd, err := unix.Openat2(dirFd, relPath, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_NOFOLLOW | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS,
+	})
+	if err == unix.ENOSYS {
+		return readProcLinkByPath(filepath.Join(procPid, relPath))
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer unix.Close(fd)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return "", false, err
+	}
+
+	if st.Mode&unix.S_IFMT != unix.S_IFLNK {
+		return "", false, nil
+	}
+
+	// An empty path makes readlinkat() operate on the symlink referred to by
+	// the O_PATH file descriptor.
+	buf := make([]byte, unix.PathMax)
+	n, err := unix.Readlinkat(fd, "", buf)
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(buf[:n]), true, nil
+}
+
+// Same as readProcLink(), for kernels lacking openat2().
+func readProcLinkByPath(path string) (string, bool, error) {
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	if fi.Mode()&os.ModeSymlink != os.ModeSymlink {
+		return "", false, nil
+	}
+
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	return target, true, nil
 }
 
 func (p *process) pathAccess(path string, mode domain.AccessMode, followSymlink bool) error {
@@ -823,20 +1095,32 @@ func (p *process) checkPerm(path string, aMode domain.AccessMode, followSymlink
 		return false, err
 	}
 
-	fperm := fi.Mode().Perm()
-
 	st, ok := fi.Sys().(*syscall.Stat_t)
 	if !ok {
 		return false, fmt.Errorf("failed to convert to syscall.Stat_t")
 	}
-	fuid := st.Uid
-	fgid := st.Gid
+
+	return p.permGranted(st.Uid, st.Gid, fi.Mode(), aMode, true), nil
+}
+
+// permGranted evaluates the access permissions of the process over a file with
+// the given ownership and mode. The DAC capability overrides are only
+// considered if 'capsApply' is set.
+func (p *process) permGranted(
+	fuid uint32,
+	fgid uint32,
+	fmode os.FileMode,
+	aMode domain.AccessMode,
+	capsApply bool) bool {
+
+	fperm := fmode.Perm()
+	isDir := fmode.IsDir()
 
 	mode := uint32(aMode)
 
 	// no access = permission granted
 	if mode == 0 {
-		return true, nil
+		return true
 	}
 
 	// Note: the order of the checks below mimics those done by the Linux kernel.
@@ -845,7 +1129,7 @@ func (p *process) checkPerm(path string, aMode domain.AccessMode, followSymlink
 	if fuid == p.uid {
 		perm := uint32((fperm & 0700) >> 6)
 		if mode&perm == mode {
-			return true, nil
+			return true
 		}
 	}
 
@@ -853,14 +1137,18 @@ func (p *process) checkPerm(path string, aMode domain.AccessMode, followSymlink
 	if fgid == p.gid || uint32SliceContains(p.sgid, fgid) {
 		perm := uint32((fperm & 0070) >> 3)
 		if mode&perm == mode {
-			return true, nil
+			return true
 		}
 	}
 
 	// "other" check
 	perm := uint32(fperm & 0007)
 	if mode&perm == mode {
-		return true, nil
+		return true
+	}
+
+	if !capsApply {
+		return false
 	}
 
 	// capability checks
@@ -873,14 +1161,14 @@ func (p *process) checkPerm(path string, aMode domain.AccessMode, followSymlink
 		// for any type of file, and also has execute permission if the file
 		// is a directory or if execute permission is granted to at least one
 		// of the permission categories for the file.
-		if fi.IsDir() {
-			return true, nil
+		if isDir {
+			return true
 		} else {
 			if aMode&domain.X_OK != domain.X_OK {
-				return true, nil
+				return true
 			} else {
 				if fperm&0111 != 0 {
-					return true, nil
+					return true
 				}
 			}
 		}
@@ -889,16 +1177,16 @@ func (p *process) checkPerm(path string, aMode domain.AccessMode, followSymlink
 	if p.IsCapabilitySet(cap.EFFECTIVE, cap.CAP_DAC_READ_SEARCH) {
 		// Per capabilities(7): CAP_DAC_READ_SEARCH bypasses file read permission
 		// checks and directory read and execute permission checks
-		if fi.IsDir() && (aMode&domain.W_OK != domain.W_OK) {
-			return true, nil
+		if isDir && (aMode&domain.W_OK != domain.W_OK) {
+			return true
 		}
 
-		if !fi.IsDir() && (aMode == domain.R_OK) {
-			return true, nil
+		if !isDir && (aMode == domain.R_OK) {
+			return true
 		}
 	}
 
-	return false, nil
+	return false
 }
 
 //
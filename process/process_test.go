@@ -17,6 +17,7 @@
 package process
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -923,3 +924,149 @@ func TestPathAccessSymlink(t *testing.T) {
 // TODO:
 // * test symlink resolution limit
 // * test long path
+
+func TestResolveProcSelf(t *testing.T) {
+
+	p := &process{pid: uint32(os.Getpid())}
+
+	f, err := ioutil.TempFile("/tmp", "TestResolveProcSelf")
+	if err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get cwd: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{fmt.Sprintf("/proc/self/fd/%d", f.Fd()), f.Name(), false},
+		{"/proc/self/cwd", cwd, false},
+		{"/proc/self/status", "/proc/self/status", false},
+		{"/some/path", "/some/path", false},
+		{"/proc/self/fd/12345678", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := p.ResolveProcSelf(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveProcSelf(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveProcSelf(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestProcessCredsCache(t *testing.T) {
+
+	ps := NewProcessService().(*processService)
+	pid := uint32(os.Getpid())
+
+	p1 := ps.ProcessCreate(pid, 0, 0)
+	if uid := p1.Uid(); uid != uint32(os.Geteuid()) {
+		t.Fatalf("Uid() = %d, want %d", uid, os.Geteuid())
+	}
+	if len(ps.cache.entries) != 1 {
+		t.Fatalf("process credentials not cached: %v", ps.cache.entries)
+	}
+	caps := p1.GetEffCaps()
+
+	// Credentials are picked from the cache.
+	p2 := ps.ProcessCreate(pid, 0, 0)
+	if gid := p2.Gid(); gid != uint32(os.Getegid()) {
+		t.Fatalf("Gid() = %d, want %d", gid, os.Getegid())
+	}
+	if got := p2.GetEffCaps(); got != caps {
+		t.Fatalf("GetEffCaps() = %v, want %v", got, caps)
+	}
+
+	// Capability changes don't leak into the cache.
+	p2.SetEffCaps([2]uint32{caps[0] ^ 1, caps[1]})
+
+	p3 := ps.ProcessCreate(pid, 0, 0)
+	if got := p3.GetEffCaps(); got != caps {
+		t.Fatalf("GetEffCaps() = %v, want %v", got, caps)
+	}
+
+	// Processes are told apart by their start-time.
+	key, ok := p3.(*process).credsCacheKey()
+	if !ok || key.pid != pid || key.startTime == 0 {
+		t.Fatalf("credsCacheKey() = %v, %v", key, ok)
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+
+	p := &process{
+		pid:         uint32(os.Getpid()),
+		uid:         800,
+		gid:         800,
+		sgid:        []uint32{900},
+		initialized: true,
+	}
+
+	// Start off with no capabilities, regardless of the ones of the test.
+	if err := p.initCapability(); err != nil {
+		t.Fatalf("failed to obtain capabilities: %v", err)
+	}
+	p.cap.Clear(cap.CAPS)
+
+	tests := []struct {
+		uid, gid uint32
+		mode     os.FileMode
+		aMode    domain.AccessMode
+		want     error
+	}{
+		{800, 0, 0600, domain.R_OK | domain.W_OK, nil},
+		{800, 0, 0400, domain.W_OK, syscall.EACCES},
+		{0, 900, 0640, domain.R_OK, nil},
+		{0, 900, 0640, domain.W_OK, syscall.EACCES},
+		{0, 0, 0644, domain.R_OK, nil},
+		{0, 0, os.ModeDir | 0755, domain.X_OK, nil},
+		{0, 0, 0644, domain.X_OK, syscall.EACCES},
+		{0, 0, 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		got := p.CheckAccess(tt.uid, tt.gid, tt.mode, tt.aMode)
+		if got != tt.want {
+			t.Errorf("CheckAccess(%d, %d, %v, %v) = %v, want %v",
+				tt.uid, tt.gid, tt.mode, tt.aMode, got, tt.want)
+		}
+	}
+
+	// CAP_DAC_OVERRIDE only applies to files whose owner is mapped within the
+	// process' user-ns (which, for the test process, is always the case).
+	p.setCapability(cap.EFFECTIVE, cap.CAP_DAC_OVERRIDE)
+
+	if err := p.CheckAccess(0, 0, 0600, domain.R_OK|domain.W_OK); err != nil {
+		t.Errorf("CheckAccess() with CAP_DAC_OVERRIDE failed: %v", err)
+	}
+}
+
+func TestProcessUmask(t *testing.T) {
+
+	old := syscall.Umask(0027)
+	defer syscall.Umask(old)
+
+	p := &process{pid: uint32(os.Getpid())}
+
+	umask, err := p.Umask()
+	if err == syscall.ENOTSUP {
+		t.Skip("umask not reported by this kernel")
+	}
+	if err != nil {
+		t.Fatalf("Umask() failed: %v", err)
+	}
+	if umask != 0027 {
+		t.Fatalf("Umask() = %#o, want %#o", umask, 0027)
+	}
+}
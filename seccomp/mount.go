@@ -243,7 +243,7 @@ func (m *mountSyscallInfo) createProcPayload(
 	mh := m.tracer.service.mts.MountHelper()
 
 	// Sysbox-fs "/proc" bind-mounts.
-	procBindMounts := mh.ProcMounts()
+	procBindMounts := m.sysboxfsBindMounts(mip, mh.ProcMounts())
 	for _, v := range procBindMounts {
 		relPath := strings.TrimPrefix(v, "/proc")
 
@@ -260,6 +260,25 @@ func (m *mountSyscallInfo) createProcPayload(
 		payload = append(payload, newelem)
 	}
 
+	// Container-specific bind-mounts of emulated nodes (see
+	// domain.BindMountsAnnotation).
+	procAnnotatedMounts := annotatedBindMounts(m.cntr.Annotations(), "/proc")
+	for _, v := range procAnnotatedMounts {
+		relPath := strings.TrimPrefix(v.Target, "/proc")
+
+		newelem := &domain.MountSyscallPayload{
+			domain.NSenterMsgHeader{},
+			domain.Mount{
+				Source: v.Source,
+				Target: filepath.Join(m.Target, relPath),
+				FsType: "",
+				Flags:  unix.MS_BIND,
+				Data:   "",
+			},
+		}
+		payload = append(payload, newelem)
+	}
+
 	// Container-specific read-only paths.
 	procRoPaths := m.cntr.ProcRoPaths()
 	for _, v := range procRoPaths {
@@ -315,9 +334,24 @@ func (m *mountSyscallInfo) createProcPayload(
 					Source: "",
 					Target: filepath.Join(m.Target, relPath),
 					FsType: "",
-					// TODO: Avoid hard-coding these flags.
-					Flags: unix.MS_RDONLY | unix.MS_BIND | unix.MS_REMOUNT | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC,
-					Data:  "",
+					Flags:  m.roSubmountFlags(mip, v),
+					Data:   "",
+				},
+			}
+			payload = append(payload, newelem)
+		}
+
+		for _, v := range procAnnotatedMounts {
+			relPath := strings.TrimPrefix(v.Target, "/proc")
+
+			newelem := &domain.MountSyscallPayload{
+				domain.NSenterMsgHeader{},
+				domain.Mount{
+					Source: "",
+					Target: filepath.Join(m.Target, relPath),
+					FsType: "",
+					Flags:  m.roSubmountFlags(mip, v.Target),
+					Data:   "",
 				},
 			}
 			payload = append(payload, newelem)
@@ -327,6 +361,78 @@ func (m *mountSyscallInfo) createProcPayload(
 	return &payload
 }
 
+// Returns the sysbox-fs submounts (out of the given ones) to be replicated
+// within a new procfs / sysfs mount. Submounts that are no longer backed by
+// sysbox-fs in the process' mount namespace (e.g., the user unmounted them and
+// placed a different mount on top) are skipped, so that the new mount mirrors
+// the mount table the process currently sees.
+func (m *mountSyscallInfo) sysboxfsBindMounts(
+	mip domain.MountInfoParserIface,
+	mounts []string) []string {
+
+	var res []string
+
+	for _, v := range mounts {
+		// Mountpoints not visible to the process (e.g., chroot'ed processes)
+		// are kept, as there's no evidence of them being replaced.
+		if mip.GetInfo(v) != nil && !mip.IsSysboxfsFuseMount(v) {
+			logrus.Debugf("Skipping non sysbox-fs submount %s", v)
+			continue
+		}
+		res = append(res, v)
+	}
+
+	return res
+}
+
+// Returns the bind-mounts of emulated nodes requested for a container through
+// the given annotations (see domain.BindMountsAnnotation) whose targets lie
+// within the given procfs / sysfs mountpoint, so that these are replicated
+// within new mounts of it too (e.g., procfs mounts of inner containers).
+func annotatedBindMounts(annotations map[string]string, base string) []domain.Mount {
+
+	val, ok := annotations[domain.BindMountsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	// Invalid annotations are rejected upon container registration.
+	mounts, err := domain.ParseBindMounts(val)
+	if err != nil {
+		return nil
+	}
+
+	var res []domain.Mount
+
+	for _, v := range mounts {
+		if strings.HasPrefix(v.Target, base+"/") {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// Returns the flags with which the given sysbox-fs submount replica must be
+// remounted as read-only. The per-mount flags of the original submount are
+// preserved, as the kernel rejects remounts that clear locked flags (e.g.,
+// nosuid, nodev, atime flags) within a user namespace.
+func (m *mountSyscallInfo) roSubmountFlags(
+	mip domain.MountInfoParserIface,
+	mountpoint string) uint64 {
+
+	flags := uint64(unix.MS_RDONLY | unix.MS_BIND | unix.MS_REMOUNT)
+
+	info := mip.GetInfo(mountpoint)
+	if info == nil {
+		return flags | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC
+	}
+
+	mh := m.tracer.service.mts.MountHelper()
+
+	return flags | mh.StringToFlags(info.Options)
+}
+
 // Method handles sysfs mount syscall requests. As part of this function, we
 // also create submounts under sysfs (to expose, hide, or emulate resources).
 func (m *mountSyscallInfo) processSysMount(
@@ -393,7 +499,7 @@ func (m *mountSyscallInfo) createSysPayload(
 	mh := m.tracer.service.mts.MountHelper()
 
 	// Sysbox-fs "/sys" bind-mounts.
-	sysBindMounts := mh.SysMounts()
+	sysBindMounts := m.sysboxfsBindMounts(mip, mh.SysMounts())
 	for _, v := range sysBindMounts {
 		relPath := strings.TrimPrefix(v, "/sys")
 
@@ -410,6 +516,25 @@ func (m *mountSyscallInfo) createSysPayload(
 		payload = append(payload, newelem)
 	}
 
+	// Container-specific bind-mounts of emulated nodes (see
+	// domain.BindMountsAnnotation).
+	sysAnnotatedMounts := annotatedBindMounts(m.cntr.Annotations(), "/sys")
+	for _, v := range sysAnnotatedMounts {
+		relPath := strings.TrimPrefix(v.Target, "/sys")
+
+		newelem := &domain.MountSyscallPayload{
+			domain.NSenterMsgHeader{},
+			domain.Mount{
+				Source: v.Source,
+				Target: filepath.Join(m.Target, relPath),
+				FsType: "",
+				Flags:  unix.MS_BIND,
+				Data:   "",
+			},
+		}
+		payload = append(payload, newelem)
+	}
+
 	// If "/sys" is to be mounted as read-only, we want this requirement to
 	// extend to all of its inner bind-mounts.
 	if m.Flags&unix.MS_RDONLY == unix.MS_RDONLY {
@@ -423,9 +548,24 @@ func (m *mountSyscallInfo) createSysPayload(
 					Source: "",
 					Target: filepath.Join(m.Target, relPath),
 					FsType: "",
-					// TODO: Avoid hard-coding these flags.
-					Flags: unix.MS_RDONLY | unix.MS_BIND | unix.MS_REMOUNT | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC,
-					Data:  "",
+					Flags:  m.roSubmountFlags(mip, v),
+					Data:   "",
+				},
+			}
+			payload = append(payload, newelem)
+		}
+
+		for _, v := range sysAnnotatedMounts {
+			relPath := strings.TrimPrefix(v.Target, "/sys")
+
+			newelem := &domain.MountSyscallPayload{
+				domain.NSenterMsgHeader{},
+				domain.Mount{
+					Source: "",
+					Target: filepath.Join(m.Target, relPath),
+					FsType: "",
+					Flags:  m.roSubmountFlags(mip, v.Target),
+					Data:   "",
 				},
 			}
 			payload = append(payload, newelem)
@@ -448,6 +588,33 @@ func (m *mountSyscallInfo) processOverlayMount(
 	// logic.
 	m.targetUnadjust()
 
+	// Adjust the mount options to the ones supported by the host kernel.
+	data, err := adjustOverlayOpts(m.Data, overlayOptSupported)
+	if err != nil {
+		logrus.Debugf("Rejecting overlayfs mount at %s: %s", m.Target, err)
+		return m.tracer.createErrorResponse(m.reqId, syscall.EINVAL), nil
+	}
+	m.Data = data
+
+	// Overlayfs layers residing on ID-mapped mounts (e.g., the container's
+	// rootfs, when backed by one) are only accepted by recent kernels, which
+	// translate the layers' ownership through the mounts' mapping. Reject such
+	// mounts upfront on earlier kernels, as files would otherwise be exposed with
+	// their on-disk ownership. Shiftfs-backed layers are left alone, as shiftfs
+	// translates the ownership on its own (i.e., overlayfs sees shifted ids).
+	if !overlayIDMappedLayersSupported() {
+		for _, dir := range overlayLayers(m.Data) {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(m.cwd, dir)
+			}
+			if mip.IsIDMappedMount(mip.GetMountOf(dir)) {
+				logrus.Debugf("Rejecting overlayfs mount at %s: layer %s on ID-mapped mount",
+					m.Target, dir)
+				return m.tracer.createErrorResponse(m.reqId, syscall.EINVAL), nil
+			}
+		}
+	}
+
 	// Create instructions payload.
 	payload := m.createOverlayMountPayload(mip)
 	if payload == nil {
@@ -468,7 +635,7 @@ func (m *mountSyscallInfo) processOverlayMount(
 	)
 
 	// Launch nsenter-event.
-	err := nss.SendRequestEvent(event)
+	err = nss.SendRequestEvent(event)
 	if err != nil {
 		return nil, err
 	}
@@ -492,8 +659,8 @@ func (m *mountSyscallInfo) createOverlayMountPayload(
 	var payload []*domain.MountSyscallPayload
 
 	// Create a process struct to represent the process generating the 'mount'
-	// instruction, and extract its capabilities to hand them out to 'nsenter'
-	// logic.
+	// instruction, and extract its supplementary groups and capabilities to
+	// hand them out to 'nsenter' logic.
 	process := m.tracer.service.prs.ProcessCreate(m.pid, 0, 0)
 
 	// Payload instruction for overlayfs mount request.
@@ -504,9 +671,12 @@ func (m *mountSyscallInfo) createOverlayMountPayload(
 		Pid:          m.pid,
 		Uid:          m.uid,
 		Gid:          m.gid,
+		SGid:         process.SGid(),
 		Root:         m.root,
 		Cwd:          m.cwd,
 		Capabilities: process.GetEffCaps(),
+		AmbientCaps:  process.GetAmbientCaps(),
+		MountLabel:   domain.MountLabel(m.cntr),
 	}
 
 	return &payload
@@ -566,6 +736,11 @@ func (m *mountSyscallInfo) createNfsMountPayload(
 	// Payload instruction for re-mount request.
 	payload = append(payload, m.MountSyscallPayload)
 
+	// The nfs file-system is labeled as per the container's context.
+	payload[0].Header = domain.NSenterMsgHeader{
+		MountLabel: domain.MountLabel(m.cntr),
+	}
+
 	return &payload
 }
 
@@ -880,9 +1055,40 @@ func (m *mountSyscallInfo) processRemount(
 		return resp, nil
 	}
 
+	m.setReadOnlyPath()
+
 	return m.tracer.createSuccessResponse(m.reqId), nil
 }
 
+// Records the read-only state resulting from a remount of the container's
+// procfs / sysfs (or of any of its sysbox-fs submounts), so that the fuse
+// server fails subsequent writes on them with EROFS. Remounts of other procfs /
+// sysfs instances (e.g., within chroot jails or inner containers) are left
+// alone, as these are also served by the container's fuse server.
+func (m *mountSyscallInfo) setReadOnlyPath() {
+
+	if m.root != "/" {
+		return
+	}
+
+	if m.Target != "/proc" && m.Target != "/sys" &&
+		!strings.HasPrefix(m.Target, "/proc/") &&
+		!strings.HasPrefix(m.Target, "/sys/") {
+		return
+	}
+
+	processMountNs, err := m.processInfo.MountNsInode()
+	if err != nil {
+		return
+	}
+	initMountNs, err := m.cntr.InitProc().MountNsInode()
+	if err != nil || processMountNs != initMountNs {
+		return
+	}
+
+	m.cntr.SetReadOnlyPath(m.Target, m.Flags&unix.MS_RDONLY == unix.MS_RDONLY)
+}
+
 // Build instructions payload required for remount operations.
 func (m *mountSyscallInfo) createRemountPayload(
 	mip domain.MountInfoParserIface) *[]*domain.MountSyscallPayload {
@@ -0,0 +1,154 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// This file contains the handling of the fd-based mount API syscalls (fsopen,
+// fsconfig, fsmount, move_mount and open_tree), which inner runtimes rely on
+// in newer kernels, and which would otherwise bypass sysbox-fs' mount(2)
+// virtualization.
+//
+// Unlike mount(2), these syscalls produce file descriptors (filesystem contexts
+// and detached mounts) that belong to the process issuing them, so they cannot
+// be executed on the process' behalf through nsenter. Instead, the requests
+// that would require sysbox-fs' intervention (i.e., new mounts of the
+// file-systems handled by processMount(), or clones of sysbox-fs base mounts)
+// are failed with ENOSYS, which makes runtimes fall back to mount(2), where
+// these are virtualized. Any other request is handled by the kernel.
+
+package seccomp
+
+import (
+	"path/filepath"
+	"syscall"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// File-systems whose mounts are virtualized by sysbox-fs (see
+// mountSyscallInfo.process()).
+var mountApiRedirectedFs = map[string]bool{
+	"proc":    true,
+	"sysfs":   true,
+	"overlay": true,
+	"nfs":     true,
+}
+
+func (t *syscallTracer) processFsopen(
+	req *sysRequest,
+	fd int32,
+	cntr domain.ContainerIface) (*sysResponse, error) {
+
+	// Extract the "fsname" syscall attribute.
+	parsedArgs, err := t.memParser.ReadSyscallStringArgs(
+		req.Pid,
+		[]memParserDataElem{{req.Data.Args[0], unix.PathMax, nil}},
+	)
+	if err != nil {
+		return t.createErrorResponse(req.Id, syscall.EPERM), nil
+	}
+	fsName := parsedArgs[0]
+
+	if mountApiRedirectedFs[fsName] {
+		logrus.Debugf("Redirecting fsopen syscall from pid %d to mount(2): fsname = %s",
+			req.Pid, fsName)
+		return t.createErrorResponse(req.Id, syscall.ENOSYS), nil
+	}
+
+	return t.createContinueResponse(req.Id), nil
+}
+
+// Filesystem contexts of the virtualized file-systems are never created (see
+// processFsopen()), so the remaining fd-based syscalls only operate on mounts
+// that don't require sysbox-fs' intervention. As with mount(2) moves, mount
+// attachments are handled by the kernel.
+func (t *syscallTracer) processMountApi(
+	req *sysRequest,
+	fd int32,
+	cntr domain.ContainerIface,
+	syscallName string) (*sysResponse, error) {
+
+	logrus.Debugf("Received %s syscall from pid %d", syscallName, req.Pid)
+
+	return t.createContinueResponse(req.Id), nil
+}
+
+func (t *syscallTracer) processOpenTree(
+	req *sysRequest,
+	fd int32,
+	cntr domain.ContainerIface) (*sysResponse, error) {
+
+	dirFd := int32(req.Data.Args[0])
+	flags := req.Data.Args[2]
+
+	// Handles to existing mounts (i.e., no clones) are of no concern.
+	if flags&unix.OPEN_TREE_CLONE == 0 {
+		return t.createContinueResponse(req.Id), nil
+	}
+
+	// Extract the "filename" syscall attribute.
+	parsedArgs, err := t.memParser.ReadSyscallStringArgs(
+		req.Pid,
+		[]memParserDataElem{{req.Data.Args[1], unix.PathMax, nil}},
+	)
+	if err != nil {
+		return t.createErrorResponse(req.Id, syscall.EPERM), nil
+	}
+	path := parsedArgs[0]
+
+	// Cloning mounts requires cap_sys_admin, so let the kernel fail the
+	// request otherwise.
+	process := t.service.prs.ProcessCreate(req.Pid, 0, 0)
+	if !process.IsSysAdminCapabilitySet() {
+		return t.createContinueResponse(req.Id), nil
+	}
+
+	// Interpret dirFd (if the pathname is not absolute), as per open_tree's
+	// *at() semantics.
+	if !filepath.IsAbs(path) {
+		dirPath := process.Cwd()
+		if dirFd != unix.AT_FDCWD {
+			if dirPath, err = process.GetFd(dirFd); err != nil {
+				return t.createContinueResponse(req.Id), nil
+			}
+		}
+		path = filepath.Join(dirPath, path)
+	}
+
+	path, err = process.ResolveProcSelf(path)
+	if err != nil {
+		return t.createErrorResponse(req.Id, syscall.EACCES), nil
+	}
+
+	if root := process.Root(); root != "/" {
+		path = filepath.Join(root, path)
+	}
+
+	mip, err := t.service.mts.NewMountInfoParser(cntr, process, true, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// The submounts of sysbox-fs base mounts must be carried along with them,
+	// which is only done for mount(2) bind-mounts (see processBindMount()).
+	if mip.IsSysboxfsBaseMount(path) {
+		logrus.Debugf("Redirecting open_tree syscall from pid %d to mount(2): path = %s",
+			req.Pid, path)
+		return t.createErrorResponse(req.Id, syscall.ENOSYS), nil
+	}
+
+	return t.createContinueResponse(req.Id), nil
+}
@@ -0,0 +1,56 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package seccomp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nestybox/sysbox-fs/domain"
+)
+
+func Test_annotatedBindMounts(t *testing.T) {
+
+	annotations := map[string]string{
+		domain.BindMountsAnnotation: "/proc/meminfo:/proc/self/meminfo," +
+			"/proc/uptime:/run/uptime,/sys/kernel:/sys/devices/kernel",
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		base        string
+		want        []domain.Mount
+	}{
+		{"1", annotations, "/proc",
+			[]domain.Mount{{Source: "/proc/meminfo", Target: "/proc/self/meminfo"}}},
+		{"2", annotations, "/sys",
+			[]domain.Mount{{Source: "/sys/kernel", Target: "/sys/devices/kernel"}}},
+		{"3", annotations, "/run/uptime", nil},
+		{"4", nil, "/proc", nil},
+		{"5", map[string]string{domain.BindMountsAnnotation: "meminfo"}, "/proc", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := annotatedBindMounts(tt.annotations, tt.base)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("annotatedBindMounts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
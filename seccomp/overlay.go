@@ -0,0 +1,177 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package seccomp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	libutils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Overlayfs mount options introduced in recent kernels, which inner container
+// engines increasingly rely on.
+type overlayOpt struct {
+	kernel    [2]int   // first kernel release (major, minor) supporting it
+	param     string   // overlay module parameter denoting its support (if any)
+	values    []string // accepted values (none for flag options)
+	droppable bool     // can be omitted if unsupported (i.e., optimization only)
+}
+
+var overlayOpts = map[string]overlayOpt{
+	"index": {
+		kernel: [2]int{4, 13},
+		param:  "index",
+		values: []string{"on", "off"},
+	},
+	"xino": {
+		kernel:    [2]int{4, 17},
+		param:     "xino_auto",
+		values:    []string{"on", "off", "auto"},
+		droppable: true,
+	},
+	"metacopy": {
+		kernel: [2]int{4, 19},
+		param:  "metacopy",
+		values: []string{"on", "off"},
+	},
+	"volatile": {
+		kernel:    [2]int{5, 10},
+		droppable: true,
+	},
+}
+
+const overlayParamsPath = "/sys/module/overlay/parameters"
+
+var (
+	overlayOptsOnce      sync.Once
+	overlayOptsSupported map[string]bool
+)
+
+// Returns true if the given overlayfs option is supported by the host kernel,
+// as per its release or the overlay module parameters (which also account for
+// backports).
+func overlayOptSupported(name string) bool {
+
+	overlayOptsOnce.Do(func() {
+		overlayOptsSupported = make(map[string]bool, len(overlayOpts))
+
+		for name, opt := range overlayOpts {
+			cmp, err := libutils.KernelCurrentVersionCmp(opt.kernel[0], opt.kernel[1])
+			supported := err == nil && cmp >= 0
+
+			if !supported && opt.param != "" {
+				_, err := os.Stat(filepath.Join(overlayParamsPath, opt.param))
+				supported = err == nil
+			}
+
+			overlayOptsSupported[name] = supported
+		}
+	})
+
+	return overlayOptsSupported[name]
+}
+
+var (
+	overlayIDMapOnce      sync.Once
+	overlayIDMapSupported bool
+)
+
+// Returns true if the host kernel's overlayfs accepts layers residing on
+// ID-mapped mounts (i.e., kernel 5.19+).
+func overlayIDMappedLayersSupported() bool {
+
+	overlayIDMapOnce.Do(func() {
+		cmp, err := libutils.KernelCurrentVersionCmp(5, 19)
+		overlayIDMapSupported = err == nil && cmp >= 0
+	})
+
+	return overlayIDMapSupported
+}
+
+// Returns the directories (i.e., lower, upper and work dirs) referenced by the
+// given overlayfs mount options.
+func overlayLayers(data string) []string {
+
+	var dirs []string
+
+	for _, o := range strings.Split(data, ",") {
+		i := strings.Index(o, "=")
+		if i < 0 {
+			continue
+		}
+
+		switch o[:i] {
+		case "lowerdir":
+			dirs = append(dirs, strings.Split(o[i+1:], ":")...)
+		case "upperdir", "workdir":
+			dirs = append(dirs, o[i+1:])
+		}
+	}
+
+	return dirs
+}
+
+// Adjusts the given overlayfs mount options (i.e., mount data) to the ones
+// supported by the host kernel: unsupported options are omitted, unless doing
+// so would alter the semantics of the mount, in which case an error is
+// returned (as well as for options with invalid values). Any other option is
+// passed through.
+func adjustOverlayOpts(data string, supported func(string) bool) (string, error) {
+
+	if data == "" {
+		return data, nil
+	}
+
+	var opts []string
+
+	for _, o := range strings.Split(data, ",") {
+		name, val := o, ""
+		hasVal := false
+		if i := strings.Index(o, "="); i >= 0 {
+			name, val, hasVal = o[:i], o[i+1:], true
+		}
+
+		opt, ok := overlayOpts[name]
+		if !ok {
+			opts = append(opts, o)
+			continue
+		}
+
+		if hasVal != (len(opt.values) > 0) ||
+			(hasVal && !libutils.StringSliceContains(opt.values, val)) {
+			return "", fmt.Errorf("invalid overlayfs option %s", o)
+		}
+
+		if supported(name) {
+			opts = append(opts, o)
+			continue
+		}
+
+		if !opt.droppable && val != "off" {
+			return "", fmt.Errorf("overlayfs option %s not supported by kernel", o)
+		}
+
+		logrus.Debugf("Omitting overlayfs option %s not supported by kernel", o)
+	}
+
+	return strings.Join(opts, ","), nil
+}
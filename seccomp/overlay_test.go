@@ -0,0 +1,94 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package seccomp
+
+import "testing"
+
+func Test_adjustOverlayOpts(t *testing.T) {
+
+	const lower = "lowerdir=/l1:/l2,upperdir=/u,workdir=/w"
+
+	all := func(string) bool { return true }
+	none := func(string) bool { return false }
+
+	tests := []struct {
+		name      string
+		data      string
+		supported func(string) bool
+		want      string
+		wantErr   bool
+	}{
+		// Supported options are passed through.
+		{"1", lower + ",metacopy=on,volatile,index=off,xino=auto", all,
+			lower + ",metacopy=on,volatile,index=off,xino=auto", false},
+
+		// Unsupported optimization-only options are omitted.
+		{"2", lower + ",volatile,xino=on,metacopy=off,index=off", none, lower, false},
+
+		// Unsupported options altering the mount semantics are rejected.
+		{"3", lower + ",metacopy=on", none, "", true},
+		{"4", lower + ",index=on", none, "", true},
+
+		// Invalid values are rejected.
+		{"5", lower + ",metacopy=yes", all, "", true},
+		{"6", lower + ",volatile=on", all, "", true},
+		{"7", lower + ",xino", all, "", true},
+
+		{"8", "", none, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := adjustOverlayOpts(tt.data, tt.supported)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("adjustOverlayOpts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("adjustOverlayOpts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_overlayLayers(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"1", "lowerdir=/l1:/l2,upperdir=/u,workdir=/w,index=off",
+			[]string{"/l1", "/l2", "/u", "/w"}},
+		{"2", "lowerdir=l1,xino=auto", []string{"l1"}},
+		{"3", "volatile", nil},
+		{"4", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := overlayLayers(tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("overlayLayers() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("overlayLayers() = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
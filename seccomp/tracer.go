@@ -23,13 +23,13 @@ import (
 	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/nestybox/sysbox-fs/domain"
 	unixIpc "github.com/nestybox/sysbox-ipc/unix"
 	"github.com/nestybox/sysbox-libs/formatter"
 	libseccomp "github.com/nestybox/sysbox-libs/libseccomp-golang"
 	libpidfd "github.com/nestybox/sysbox-libs/pidfd"
-	libutils "github.com/nestybox/sysbox-libs/utils"
 	"golang.org/x/sys/unix"
 
 	"github.com/sirupsen/logrus"
@@ -65,6 +65,16 @@ var monitoredSyscalls = []string{
 	"flistxattr",
 }
 
+// Syscalls to monitor only if known to the seccomp library (i.e., the fd-based
+// mount API, which is absent in older libseccomp releases).
+var optionalMonitoredSyscalls = []string{
+	"fsopen",
+	"fsconfig",
+	"fsmount",
+	"move_mount",
+	"open_tree",
+}
+
 // Seccomp's syscall-monitoring/trapping service struct. External packages
 // will solely rely on this struct for their syscall-monitoring demands.
 type SyscallMonitorService struct {
@@ -75,6 +85,8 @@ type SyscallMonitorService struct {
 	allowImmutableRemounts bool                              // allow immutable mounts to be remounted
 	allowImmutableUnmounts bool                              // allow immutable mounts to be unmounted
 	closeSeccompOnContExit bool                              // close seccomp fds on container exit, not on process exit
+	denySubmountUnmounts   bool                              // fail unmounts of sysbox-fs managed submounts
+	dryRun                 bool                              // pass trapped syscalls through to the kernel (dry-run mode)
 	tracer                 *syscallTracer                    // pointer to actual syscall-tracer instance
 }
 
@@ -89,7 +101,9 @@ func (scs *SyscallMonitorService) Setup(
 	mts domain.MountServiceIface,
 	allowImmutableRemounts bool,
 	allowImmutableUnmounts bool,
-	seccompFdReleasePolicy string) {
+	seccompFdReleasePolicy string,
+	submountUnmountsPolicy string,
+	dryRun bool) {
 
 	scs.nss = nss
 	scs.css = css
@@ -97,11 +111,23 @@ func (scs *SyscallMonitorService) Setup(
 	scs.mts = mts
 	scs.allowImmutableRemounts = allowImmutableRemounts
 	scs.allowImmutableUnmounts = allowImmutableUnmounts
+	scs.dryRun = dryRun
 
 	if seccompFdReleasePolicy == "cont-exit" {
 		scs.closeSeccompOnContExit = true
 	}
 
+	if submountUnmountsPolicy == "deny" {
+		scs.denySubmountUnmounts = true
+	}
+
+	// Syscall emulation is disabled on kernels lacking seccomp notifications.
+	if !domain.KernelFeatureSupported(domain.KernelFeatureSeccompNotify) {
+		logrus.Warnf("Seccomp notifications not supported by the kernel: %s",
+			domain.KernelFeatureFallbacks[domain.KernelFeatureSeccompNotify])
+		return
+	}
+
 	// Allocate a new syscall-tracer.
 	scs.tracer = newSyscallTracer(scs)
 
@@ -131,6 +157,7 @@ type syscallTracer struct {
 	seccompSessionMu   sync.RWMutex                      // seccomp session table lock
 	seccompUnusedNotif bool                              // seccomp-fd unused notification feature supported by kernel
 	seccompNotifPidTrk *seccompNotifPidTracker           // Ensures seccomp notifs for the same pid are processed sequentially (not in parallel).
+	dryRunLogged       sync.Map                          // syscalls already passed through per container (dry-run mode)
 	service            *SyscallMonitorService            // backpointer to syscall-monitor service
 }
 
@@ -158,27 +185,29 @@ func newSyscallTracer(sms *SyscallMonitorService) *syscallTracer {
 		tracer.syscalls[syscallId] = syscall
 	}
 
+	for _, syscall := range optionalMonitoredSyscalls {
+		syscallId, err := libseccomp.GetSyscallFromName(syscall)
+		if err != nil {
+			logrus.Infof("Seccomp-tracer: syscall %v not monitored (unknown to libseccomp)",
+				syscall)
+			continue
+		}
+		tracer.syscalls[syscallId] = syscall
+	}
+
 	// Elect the memParser to utilize based on the availability of process_vm_readv()
 	// syscall.
-	_, err := unix.ProcessVMReadv(int(1), nil, nil, 0)
-	if err == syscall.ENOSYS {
-		tracer.memParser = &memParserProcfs{}
-		logrus.Info("Procfs memParser elected")
-	} else {
+	if domain.KernelFeatureSupported(domain.KernelFeatureProcessVmReadv) {
 		tracer.memParser = &memParserIOvec{}
 		logrus.Info("IOvec memParser elected")
+	} else {
+		tracer.memParser = &memParserProcfs{}
+		logrus.Info("Procfs memParser elected")
 	}
 
 	// Seccomp-fd's unused notification feature is provided by kernel starting with v5.8.
-	cmp, err := libutils.KernelCurrentVersionCmp(5, 8)
-	if err != nil {
-		logrus.Warnf("Seccomp-tracer initialization error: unable to parse kernel string (%v).",
-			err)
-		return nil
-	}
-	if cmp >= 0 {
-		tracer.seccompUnusedNotif = true
-	}
+	tracer.seccompUnusedNotif =
+		domain.KernelFeatureSupported(domain.KernelFeatureSeccompNotifyUnused)
 
 	tracer.seccompNotifPidTrk = newSeccompNotifPidTracker()
 
@@ -436,7 +465,15 @@ func (t *syscallTracer) process(
 	defer t.seccompNotifPidTrk.Unlock(req.Pid)
 
 	// Process the incoming syscall and obtain response for seccomp-tracee.
+	start := time.Now()
 	resp, err := t.processSyscall(req, fd, cntrID)
+
+	if latency := time.Since(start); domain.IsSlowOp(latency) {
+		logrus.Warnf("Slow syscall %s processing: cntr %s, pid %d, fd %d, req Id %d, duration %v (err: %v)",
+			t.syscalls[req.Data.Syscall], formatter.ContainerID{cntrID}, req.Pid,
+			fd, req.Id, latency, err)
+	}
+
 	if err != nil {
 		return
 	}
@@ -445,6 +482,19 @@ func (t *syscallTracer) process(
 	_ = libseccomp.NotifRespond(libseccomp.ScmpFd(fd), resp)
 }
 
+// Trapped syscalls subject to the container's write rate limit (see
+// domain.RateLimit) and to the validation of the requester's user-ns.
+var rateLimitedSyscalls = map[string]bool{
+	"mount":      true,
+	"umount2":    true,
+	"chown":      true,
+	"fchown":     true,
+	"fchownat":   true,
+	"fsconfig":   true,
+	"fsmount":    true,
+	"move_mount": true,
+}
+
 // Syscall processing entrypoint. Returns the response to be delivered to the
 // process (seccomp-tracee) generating the syscall.
 func (t *syscallTracer) processSyscall(
@@ -468,6 +518,37 @@ func (t *syscallTracer) processSyscall(
 	syscallId := req.Data.Syscall
 	syscallName := t.syscalls[syscallId]
 
+	// Drop stale notifications (i.e., of tracees that are gone) upfront.
+	if err := libseccomp.NotifIdValid(libseccomp.ScmpFd(fd), req.Id); err != nil {
+		logrus.Debugf("Dropping stale seccomp notification on fd %d, pid %d, req Id %d, cntr %s (%s)",
+			fd, req.Pid, req.Id, formatter.ContainerID{cntrID}, err)
+		return nil, fmt.Errorf("stale notification")
+	}
+
+	// In dry-run mode no emulation is performed: trapped syscalls are passed
+	// through to the kernel.
+	if t.service.dryRun {
+		return t.dryRunResponse(req, cntrID, syscallName), nil
+	}
+
+	// Syscalls translating into nsenter work are throttled as per the
+	// container's write rate limit.
+	if rateLimitedSyscalls[syscallName] && !cntr.WriteLimiter().Allow() {
+		logrus.Debugf("Syscall %v on fd %d, pid %d, cntr %s rejected: write rate limit exceeded",
+			syscallName, fd, req.Pid, formatter.ContainerID{cntrID})
+		return t.createErrorResponse(req.Id, syscall.EAGAIN), nil
+	}
+
+	// Likewise, these are only executed on behalf of processes within the
+	// container's user-ns (i.e., not of recycled pids).
+	if rateLimitedSyscalls[syscallName] {
+		if err := cntr.ValidateUserNs(req.Pid); err != nil {
+			logrus.Warnf("Syscall %v on fd %d, pid %d, cntr %s rejected: %v",
+				syscallName, fd, req.Pid, formatter.ContainerID{cntrID}, err)
+			return t.createErrorResponse(req.Id, syscall.EPERM), nil
+		}
+	}
+
 	switch syscallName {
 	case "mount":
 		resp, err = t.processMount(req, fd, cntr)
@@ -517,6 +598,15 @@ func (t *syscallTracer) processSyscall(
 	case "flistxattr":
 		resp, err = t.processFlistxattr(req, fd, cntr)
 
+	case "fsopen":
+		resp, err = t.processFsopen(req, fd, cntr)
+
+	case "fsconfig", "fsmount", "move_mount":
+		resp, err = t.processMountApi(req, fd, cntr, syscallName)
+
+	case "open_tree":
+		resp, err = t.processOpenTree(req, fd, cntr)
+
 	default:
 		logrus.Warnf("Unsupported syscall notification received (%v) on fd %d, pid %d, cntr %s",
 			syscallId, fd, req.Pid, formatter.ContainerID{cntrID})
@@ -529,11 +619,29 @@ func (t *syscallTracer) processSyscall(
 	// error during Open() doesn't qualify, whereas 'nsenter' operational
 	// errors or inexistent "/proc/pid/mem" does.
 	if err != nil {
+		// Tracees exiting mid-way (e.g., nsenter requests failing with ESRCH)
+		// simply have their notifications dropped.
+		if verr := libseccomp.NotifIdValid(libseccomp.ScmpFd(fd), req.Id); verr != nil {
+			logrus.Debugf("Dropping stale seccomp notification on fd %d, pid %d, req Id %d, cntr %s (%v)",
+				fd, req.Pid, req.Id, formatter.ContainerID{cntrID}, err)
+			return nil, fmt.Errorf("stale notification")
+		}
 		logrus.Warnf("Error during syscall %v processing on fd %d, pid %d, req Id %d, cntr %s (%v)",
 			syscallName, fd, req.Pid, req.Id, formatter.ContainerID{cntrID}, err)
 		return t.createErrorResponse(req.Id, syscall.EINVAL), nil
 	}
 
+	// Permission failures are accounted for security alerting purposes.
+	if resp != nil &&
+		(resp.Error == int32(syscall.EPERM) || resp.Error == int32(syscall.EACCES)) {
+		domain.RecordPermissionFailure(domain.SecurityEvent{
+			Container: cntrID,
+			Pid:       req.Pid,
+			Syscall:   syscallName,
+			Errno:     unix.ErrnoName(syscall.Errno(resp.Error)),
+		})
+	}
+
 	// TOCTOU check.
 	if err := libseccomp.NotifIdValid(libseccomp.ScmpFd(fd), req.Id); err != nil {
 		logrus.Debugf("TOCTOU check failed on fd %d pid %d cntr %s: req.Id %d is no longer valid (%s)",
@@ -544,6 +652,23 @@ func (t *syscallTracer) processSyscall(
 	return resp, nil
 }
 
+// Returns the response passing the given syscall through to the kernel in
+// dry-run mode. Every (container, syscall) pair is logged only once to prevent
+// flooding the logs with repetitive entries.
+func (t *syscallTracer) dryRunResponse(
+	req *sysRequest,
+	cntrID string,
+	syscallName string) *sysResponse {
+
+	key := cntrID + ":" + syscallName
+	if _, loaded := t.dryRunLogged.LoadOrStore(key, struct{}{}); !loaded {
+		logrus.Infof("Dry-run: syscall %s (pid %d) would be emulated (container %s); passing it through",
+			syscallName, req.Pid, formatter.ContainerID{cntrID})
+	}
+
+	return t.createContinueResponse(req.Id)
+}
+
 func (t *syscallTracer) processMount(
 	req *sysRequest,
 	fd int32,
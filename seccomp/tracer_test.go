@@ -90,3 +90,30 @@ func Test_syscallTracer_createErrorResponse(t *testing.T) {
 		})
 	}
 }
+
+func Test_syscallTracer_dryRunResponse(t *testing.T) {
+
+	tracer := &syscallTracer{
+		service: &SyscallMonitorService{dryRun: true},
+	}
+
+	// Trapped syscalls are passed through to the kernel, and logged once per
+	// container.
+	want := &sysResponse{
+		Id:    1,
+		Error: 0,
+		Val:   0,
+		Flags: libseccomp.NotifRespFlagContinue,
+	}
+
+	for i := 0; i < 2; i++ {
+		req := &sysRequest{Id: 1, Pid: 1001}
+		if got := tracer.dryRunResponse(req, "c1", "mount"); !reflect.DeepEqual(got, want) {
+			t.Errorf("syscallTracer.dryRunResponse() = %v, want %v", got, want)
+		}
+	}
+
+	if _, ok := tracer.dryRunLogged.Load("c1:mount"); !ok {
+		t.Errorf("syscallTracer.dryRunResponse() did not log the syscall")
+	}
+}
@@ -24,7 +24,9 @@ import (
 
 	"github.com/nestybox/sysbox-fs/domain"
 	"github.com/nestybox/sysbox-fs/fuse"
+	"github.com/nestybox/sysbox-libs/formatter"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 type umountSyscallInfo struct {
@@ -45,7 +47,9 @@ func (u *umountSyscallInfo) process() (*sysResponse, error) {
 	// an error message is that we also ignore bind-to-self mounts on submounts
 	// (see handling of bind-to-self submounts in mount.go); thus, returning an
 	// error message would cause the sequence "mount --bind submount submount
-	// && umount submount" to fail on the second command.
+	// && umount submount" to fail on the second command. Yet, users may opt for
+	// these unmounts to be failed with EBUSY instead (see the
+	// "submount-unmounts" option), so that inner scripts are aware of them.
 	//
 	// Same applies to sysfs mounts.
 
@@ -87,6 +91,7 @@ func (u *umountSyscallInfo) process() (*sysResponse, error) {
 		// the later case we want to allow users to mount (and umount) both /proc
 		// and /sys file-systems.
 		if (u.Target == "/proc" || u.Target == "/sys") && (u.syscallCtx.root == "/") {
+			u.reportManagedUnmount(syscall.EBUSY)
 			resp := u.tracer.createErrorResponse(u.reqId, syscall.EBUSY)
 			return resp, nil
 		}
@@ -125,6 +130,12 @@ func (u *umountSyscallInfo) process() (*sysResponse, error) {
 		return u.tracer.createContinueResponse(u.reqId), nil
 
 	} else if mip.IsSysboxfsSubmount(u.Target) {
+		if u.tracer.service.denySubmountUnmounts {
+			logrus.Debugf("Denying unmount of sysbox-fs managed submount at %s",
+				u.Target)
+			u.reportManagedUnmount(syscall.EBUSY)
+			return u.tracer.createErrorResponse(u.reqId, syscall.EBUSY), nil
+		}
 		logrus.Debugf("Ignoring unmount of sysbox-fs managed submount at %s",
 			u.Target)
 		return u.tracer.createSuccessResponse(u.reqId), nil
@@ -133,6 +144,9 @@ func (u *umountSyscallInfo) process() (*sysResponse, error) {
 	// Verify if the umount op is addressing an immutable resource and prevent
 	// it if that's the case.
 	if ok, resp := u.umountAllowed(mip); ok == false {
+		if resp.Error == int32(syscall.EPERM) {
+			u.reportManagedUnmount(syscall.EPERM)
+		}
 		return resp, nil
 	}
 
@@ -468,6 +482,23 @@ func (u *umountSyscallInfo) targetUnadjust() {
 	u.Target = strings.TrimPrefix(u.Target, u.root)
 }
 
+// Reports an attempt to unmount a mount managed by sysbox (i.e., the container's
+// procfs / sysfs, sysbox-fs submounts, immutable mounts) as a security event.
+func (u *umountSyscallInfo) reportManagedUnmount(errno syscall.Errno) {
+
+	logrus.Warnf("Denied unmount of managed mount %s: cntr %s, pid %d (%s)",
+		u.Target, formatter.ContainerID{u.cntr.ID()}, u.pid, unix.ErrnoName(errno))
+
+	domain.EmitSecurityEvent(domain.SecurityEvent{
+		Type:      domain.SecurityEventManagedUnmount,
+		Container: u.cntr.ID(),
+		Pid:       u.pid,
+		Path:      u.Target,
+		Syscall:   "umount2",
+		Errno:     unix.ErrnoName(errno),
+	})
+}
+
 func (u *umountSyscallInfo) String() string {
 	return fmt.Sprintf("target: %s, flags: %#x, root: %s, cwd: %s",
 		u.Target, u.Flags, u.root, u.cwd)
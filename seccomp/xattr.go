@@ -219,9 +219,11 @@ func (si *getxattrSyscallInfo) processGetxattr() (*sysResponse, error) {
 			Pid:          process.Pid(),
 			Uid:          process.Uid(),
 			Gid:          process.Gid(),
+			SGid:         process.SGid(),
 			Root:         process.Root(),
 			Cwd:          process.Cwd(),
 			Capabilities: process.GetEffCaps(),
+			AmbientCaps:  process.GetAmbientCaps(),
 		},
 		Syscall: si.syscallName,
 		Path:    si.path,
@@ -377,9 +379,11 @@ func (si *listxattrSyscallInfo) processListxattr() (*sysResponse, error) {
 			Pid:          process.Pid(),
 			Uid:          process.Uid(),
 			Gid:          process.Gid(),
+			SGid:         process.SGid(),
 			Root:         process.Root(),
 			Cwd:          process.Cwd(),
 			Capabilities: process.GetEffCaps(),
+			AmbientCaps:  process.GetAmbientCaps(),
 		},
 		Syscall: si.syscallName,
 		Path:    si.path,
@@ -19,12 +19,15 @@ package state
 import (
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/nestybox/sysbox-fs/domain"
 	"github.com/nestybox/sysbox-libs/formatter"
 	libpidfd "github.com/nestybox/sysbox-libs/pidfd"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
 
@@ -45,6 +48,12 @@ type container struct {
 	regCompleted    bool                        // registration completion flag
 	procRoPaths     []string                    // OCI spec read-only proc paths
 	procMaskPaths   []string                    // OCI spec masked proc paths
+	annotations     map[string]string           // OCI spec annotations
+	policies        domain.ResourcePolicies     // resource policies defined through annotations
+	roPaths         map[string]bool             // read-only state of remounted procfs / sysfs paths
+	nodeAttrs       map[string]domain.NodeAttr  // mode & ownership of the emulated nodes altered within the container
+	metadata        domain.ContainerMetadata    // container manager's attributes (name, image)
+	writeLimiter    *domain.RateLimiter         // write rate limiter (nil for no limit)
 	mountInfoParser domain.MountInfoParserIface // Per container mountinfo DB & parser
 	dataStore       map[string][]byte           // Per container data store for FUSE handlers (procfs, sysfs, etc); maps fuse path to data.
 	initProc        domain.ProcessIface         // container's init process
@@ -65,6 +74,7 @@ func newContainer(
 	gidSize uint32,
 	procRoPaths []string,
 	procMaskPaths []string,
+	annotations map[string]string,
 	css *containerStateService,
 ) domain.ContainerIface {
 
@@ -78,9 +88,13 @@ func newContainer(
 		gidSize:       gidSize,
 		procRoPaths:   procRoPaths,
 		procMaskPaths: procMaskPaths,
+		annotations:   annotations,
 		service:       css,
 	}
 
+	cntr.policies, _, _ = domain.ParseAnnotations(annotations)
+	cntr.writeLimiter = newWriteLimiter(annotations)
+
 	return cntr
 }
 
@@ -123,6 +137,13 @@ func (c *container) UID() uint32 {
 	return c.uidFirst
 }
 
+func (c *container) UidSize() uint32 {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	return c.uidSize
+}
+
 func (c *container) GID() uint32 {
 	c.intLock.RLock()
 	defer c.intLock.RUnlock()
@@ -130,6 +151,13 @@ func (c *container) GID() uint32 {
 	return c.gidFirst
 }
 
+func (c *container) GidSize() uint32 {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	return c.gidSize
+}
+
 func (c *container) ProcRoPaths() []string {
 	c.intLock.RLock()
 	defer c.intLock.RUnlock()
@@ -144,6 +172,172 @@ func (c *container) ProcMaskPaths() []string {
 	return c.procMaskPaths
 }
 
+func (c *container) Annotations() map[string]string {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	return c.annotations
+}
+
+// ResourcePolicy returns the policy defined through container annotations for
+// the given resource (if any).
+func (c *container) ResourcePolicy(path string) (domain.ResourcePolicy, bool) {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	return c.policies.Lookup(path)
+}
+
+// IsReadOnlyPath returns true if the given path has been remounted read-only
+// within the container (i.e., the path itself or its closest remounted
+// ancestor).
+func (c *container) IsReadOnlyPath(path string) bool {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	if len(c.roPaths) == 0 {
+		return false
+	}
+
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if ro, ok := c.roPaths[dir]; ok {
+			return ro
+		}
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+
+	return false
+}
+
+// SetReadOnlyPath records the read-only state of the given path upon remounts
+// within the container. The state of its descendants is superseded, as these
+// are remounted along with it.
+func (c *container) SetReadOnlyPath(path string, ro bool) {
+	c.intLock.Lock()
+	defer c.intLock.Unlock()
+
+	if c.roPaths == nil {
+		c.roPaths = make(map[string]bool)
+	}
+
+	for p := range c.roPaths {
+		if strings.HasPrefix(p, path+"/") {
+			delete(c.roPaths, p)
+		}
+	}
+
+	c.roPaths[path] = ro
+}
+
+// NodeAttr returns the mode & ownership of the given emulated node, if altered
+// within the container.
+func (c *container) NodeAttr(path string) (domain.NodeAttr, bool) {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	attr, ok := c.nodeAttrs[path]
+
+	return attr, ok
+}
+
+// SetNodeAttr records the mode & ownership of the given emulated node upon
+// chmod() / chown() within the container, so that these are preserved across
+// lookups of the node.
+func (c *container) SetNodeAttr(path string, attr domain.NodeAttr) {
+	c.intLock.Lock()
+	defer c.intLock.Unlock()
+
+	if c.nodeAttrs == nil {
+		c.nodeAttrs = make(map[string]domain.NodeAttr)
+	}
+
+	c.nodeAttrs[path] = attr
+}
+
+func (c *container) Metadata() domain.ContainerMetadata {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	return c.metadata
+}
+
+// WriteLimiter returns the rate limiter throttling the writes carried out on
+// behalf of the container (nil for no limit).
+func (c *container) WriteLimiter() *domain.RateLimiter {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	return c.writeLimiter
+}
+
+// ValidateUserNs confirms that the given process (i.e., the originator of a
+// request) lives within the container's user namespace or within one of its
+// descendants (e.g., inner containers). Meant to be invoked prior to executing
+// privileged operations on behalf of the process, so that these can't be
+// requested through recycled or forged pids.
+func (c *container) ValidateUserNs(pid uint32) error {
+
+	cntrUserns, err := c.userNsInode()
+	if err != nil {
+		return err
+	}
+
+	p := c.service.ProcessService().ProcessCreate(pid, 0, 0)
+
+	userns, err := p.UserNsInode()
+	if err != nil {
+		return err
+	}
+	if userns == cntrUserns {
+		return nil
+	}
+
+	ancestors, err := p.UserNsAncestors()
+	if err != nil {
+		return err
+	}
+	for _, ns := range ancestors {
+		if ns == cntrUserns {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("pid %d is not within the user namespace of container %s",
+		pid, c.ID())
+}
+
+// Returns the inode of the container's user namespace, as obtained (and cached)
+// from its init process.
+func (c *container) userNsInode() (domain.Inode, error) {
+	c.intLock.Lock()
+	defer c.intLock.Unlock()
+
+	if c.usernsInode == 0 {
+		if c.initProc == nil {
+			return 0, fmt.Errorf("container %s has no init process", c.id)
+		}
+
+		userns, err := c.initProc.UserNsInode()
+		if err != nil {
+			return 0, err
+		}
+		c.usernsInode = userns
+	}
+
+	return c.usernsInode, nil
+}
+
+// SetMetadata sets the container attributes obtained from the container manager
+// (see runtimeWatcher).
+func (c *container) SetMetadata(md domain.ContainerMetadata) {
+	c.intLock.Lock()
+	defer c.intLock.Unlock()
+
+	c.metadata = md
+}
+
 func (c *container) InitProc() domain.ProcessIface {
 	c.intLock.RLock()
 	defer c.intLock.RUnlock()
@@ -262,6 +456,7 @@ func (c *container) update(src *container) error {
 		)
 		c.initPid = src.initPid
 		c.rootInode = c.initProc.RootInode()
+		c.usernsInode = 0
 
 		c.initPidFd, err = libpidfd.Open(int(c.initPid), 0)
 		if err != nil {
@@ -300,9 +495,95 @@ func (c *container) update(src *container) error {
 	c.procMaskPaths = make([]string, len(src.procMaskPaths))
 	copy(c.procMaskPaths, src.procMaskPaths)
 
+	// Annotations are only received during registration, so preserve the
+	// existing ones in subsequent updates.
+	if src.annotations != nil {
+		c.setAnnotations(src.annotations)
+	}
+
 	return nil
 }
 
+// Stores the container annotations and applies the sysbox-fs settings defined
+// through them. Caller must hold the container's internal lock.
+func (c *container) setAnnotations(annotations map[string]string) {
+
+	policies, sysctls, invalid := domain.ParseAnnotations(annotations)
+
+	for _, key := range invalid {
+		logrus.Warnf("Ignoring invalid annotation %s for container %s",
+			key, formatter.ContainerID{c.id})
+	}
+
+	if profiles, ok := annotations[domain.ProfileAnnotation]; ok {
+		logrus.Infof("Container %s uses emulation profile(s): %s",
+			formatter.ContainerID{c.id}, profiles)
+	}
+
+	c.annotations = make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		c.annotations[k] = v
+	}
+	c.policies = policies
+	c.writeLimiter = newWriteLimiter(annotations)
+
+	// Sysctl values are seeded into the container's data store, which is where
+	// the emulated sysctls are served from. Values already present (i.e., set
+	// within the container) are left untouched.
+	if len(sysctls) > 0 && c.dataStore == nil {
+		c.dataStore = make(map[string][]byte)
+	}
+	for path, val := range sysctls {
+		if _, ok := c.dataStore[path]; ok {
+			continue
+		}
+		data, err := c.sysctlValue(path, val)
+		if err != nil {
+			logrus.Warnf("Ignoring invalid annotation %s for container %s: %s",
+				domain.SysctlAnnotationPrefix+sysctlName(path),
+				formatter.ContainerID{c.id}, err)
+			continue
+		}
+		c.dataStore[path] = data
+	}
+}
+
+// Returns the value to be stored for the given sysctl annotation, which is
+// validated as writes of the sysctl within the container are (i.e., the same
+// range and schema apply).
+func (c *container) sysctlValue(path, val string) ([]byte, error) {
+
+	data := []byte(val + "\n")
+
+	if c.service == nil || c.service.hds == nil {
+		return data, nil
+	}
+
+	return c.service.hds.CheckResourceValue(path, data)
+}
+
+// Returns the name of the sysctl served at the given path (e.g.,
+// "kernel.yama.ptrace_scope").
+func sysctlName(path string) string {
+	name := strings.TrimPrefix(path, "/proc/sys/")
+	return strings.Replace(name, "/", ".", -1)
+}
+
+// Returns the write rate limiter of a container, as per the daemon-wide rate
+// limit or the one defined through the container's annotations (if valid).
+func newWriteLimiter(annotations map[string]string) *domain.RateLimiter {
+
+	limit := domain.WriteRateLimit()
+
+	if val, ok := annotations[domain.WriteRateAnnotation]; ok {
+		if l, err := domain.ParseRateLimit(val); err == nil {
+			limit = l
+		}
+	}
+
+	return domain.NewRateLimiter(limit)
+}
+
 func (c *container) InitializeMountInfo() error {
 	c.intLock.Lock()
 	defer c.intLock.Unlock()
@@ -334,8 +615,17 @@ func (c *container) IsMountInfoInitialized() bool {
 // internal (read)lock is acquired prior to invoking this method.
 func (c *container) string() string {
 
-	return fmt.Sprintf("id = %s, initPid = %d, uid:gid = %v:%v",
+	s := fmt.Sprintf("id = %s, initPid = %d, uid:gid = %v:%v",
 		formatter.ContainerID{c.id}, int(c.initPid), c.uidFirst, c.gidFirst)
+
+	if c.metadata.Name != "" {
+		s += fmt.Sprintf(", name = %s", c.metadata.Name)
+	}
+	if c.metadata.Image != "" {
+		s += fmt.Sprintf(", image = %s", c.metadata.Image)
+	}
+
+	return s
 }
 
 func (c *container) SetCtime(t time.Time) {
@@ -51,6 +51,9 @@ type containerStateService struct {
 
 	// Pointer to the service providing mount helper/parser capabilities.
 	mts domain.MountServiceIface
+
+	// Pointer to the service providing the handlers of the emulated resources.
+	hds domain.HandlerServiceIface
 }
 
 func NewContainerStateService() domain.ContainerStateServiceIface {
@@ -67,12 +70,14 @@ func (css *containerStateService) Setup(
 	fss domain.FuseServerServiceIface,
 	prs domain.ProcessServiceIface,
 	ios domain.IOServiceIface,
-	mts domain.MountServiceIface) {
+	mts domain.MountServiceIface,
+	hds domain.HandlerServiceIface) {
 
 	css.fss = fss
 	css.prs = prs
 	css.ios = ios
 	css.mts = mts
+	css.hds = hds
 }
 
 func (css *containerStateService) ContainerCreate(
@@ -85,6 +90,7 @@ func (css *containerStateService) ContainerCreate(
 	gidSize uint32,
 	procRoPaths []string,
 	procMaskPaths []string,
+	annotations map[string]string,
 	service domain.ContainerStateServiceIface,
 ) domain.ContainerIface {
 
@@ -98,6 +104,7 @@ func (css *containerStateService) ContainerCreate(
 		gidSize,
 		procRoPaths,
 		procMaskPaths,
+		annotations,
 		css,
 	)
 }
@@ -237,6 +244,24 @@ func (css *containerStateService) ContainerRegister(c domain.ContainerIface) err
 		return grpcStatus.Errorf(grpcCodes.NotFound, err.Error(), cntr.id)
 	}
 
+	// Keep track of the container's mount-table, which is otherwise obtained
+	// (with a higher cost) upon every mount-related request.
+	if css.mts != nil {
+		if err := css.mts.TrackMounts(currCntr); err != nil {
+			logrus.Warnf("Container registration: unable to track mounts of %s: %s",
+				formatter.ContainerID{cntr.id}, err)
+		}
+	}
+
+	// Set up the bind-mounts of emulated nodes requested by sysbox-runc (if
+	// any).
+	if css.mts != nil {
+		if err := css.mts.BindMounts(currCntr); err != nil {
+			logrus.Warnf("Container registration: unable to set up bind-mounts of %s: %s",
+				formatter.ContainerID{cntr.id}, err)
+		}
+	}
+
 	// Let the associated fuse-server know about the sys-container's registration
 	// being completed.
 	if err := css.fss.FuseServerCntrRegComplete(cntr); err != nil {
@@ -318,6 +343,11 @@ func (css *containerStateService) ContainerUnregister(c domain.ContainerIface) e
 	// then unregistered because the container failed to start for some reason).
 	css.untrackNetns(cntr)
 
+	if css.mts != nil {
+		css.mts.UnbindMounts(cntr)
+		css.mts.UntrackMounts(cntr)
+	}
+
 	// Destroy the fuse server for the container
 	err := css.fss.DestroyFuseServer(cntr.id)
 	if err != nil {
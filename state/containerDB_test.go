@@ -83,6 +83,7 @@ func Test_containerStateService_Setup(t *testing.T) {
 		prs domain.ProcessServiceIface
 		ios domain.IOServiceIface
 		mts domain.MountServiceIface
+		hds domain.HandlerServiceIface
 	}
 
 	a1 := args{
@@ -90,6 +91,7 @@ func Test_containerStateService_Setup(t *testing.T) {
 		prs: prs,
 		ios: ios,
 		mts: mts,
+		hds: hds,
 	}
 
 	tests := []struct {
@@ -114,7 +116,7 @@ func Test_containerStateService_Setup(t *testing.T) {
 				ios:        tt.fields.ios,
 				mts:        tt.fields.mts,
 			}
-			css.Setup(tt.args.fss, tt.args.prs, tt.args.ios, tt.args.mts)
+			css.Setup(tt.args.fss, tt.args.prs, tt.args.ios, tt.args.mts, tt.args.hds)
 		})
 	}
 }
@@ -157,6 +159,7 @@ func Test_containerStateService_ContainerCreate(t *testing.T) {
 		gidSize       uint32
 		procRoPaths   []string
 		procMaskPaths []string
+		annotations   map[string]string
 	}
 
 	// Manually create a container to compare with.
@@ -196,6 +199,7 @@ func Test_containerStateService_ContainerCreate(t *testing.T) {
 			c1.gidSize,
 			nil,
 			nil,
+			nil,
 		}, c1},
 	}
 
@@ -214,6 +218,7 @@ func Test_containerStateService_ContainerCreate(t *testing.T) {
 				tt.args.gidSize,
 				tt.args.procRoPaths,
 				tt.args.procMaskPaths,
+				tt.args.annotations,
 				css); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("containerStateService.ContainerCreate() = %v, want %v",
 					got, tt.want)
@@ -391,6 +396,12 @@ func Test_containerStateService_ContainerRegister(t *testing.T) {
 				c1.service.MountService().(*mocks.MountServiceIface).On(
 					"NewMountInfoParser", c1, c1.initProc, true, true, true).Return(nil, nil)
 
+				c1.service.MountService().(*mocks.MountServiceIface).On(
+					"TrackMounts", c1).Return(nil)
+
+				c1.service.MountService().(*mocks.MountServiceIface).On(
+					"BindMounts", c1).Return(nil)
+
 				css.FuseServerService().(*mocks.FuseServerServiceIface).On(
 					"FuseServerCntrRegComplete", c1).Return(nil)
 			},
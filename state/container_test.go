@@ -17,6 +17,7 @@
 package state
 
 import (
+	"errors"
 	"io"
 	"reflect"
 	"testing"
@@ -25,6 +26,7 @@ import (
 	"github.com/nestybox/sysbox-fs/domain"
 	"github.com/nestybox/sysbox-fs/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func Test_container_ID(t *testing.T) {
@@ -191,6 +193,127 @@ func Test_container_SetData(t *testing.T) {
 	}
 }
 
+func Test_container_SetReadOnlyPath(t *testing.T) {
+
+	c := &container{}
+
+	if c.IsReadOnlyPath("/proc/sys") {
+		t.Errorf("unexpected read-only path in new container")
+	}
+
+	c.SetReadOnlyPath("/proc/sys/net", false)
+	c.SetReadOnlyPath("/proc", true)
+
+	// Remounts supersede the state of the paths underneath.
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/proc", true},
+		{"/proc/sys/net/core/somaxconn", true},
+		{"/proc/uptime", true},
+		{"/sys/kernel", false},
+		{"/procfs", false},
+	}
+	for _, tt := range tests {
+		if got := c.IsReadOnlyPath(tt.path); got != tt.want {
+			t.Errorf("IsReadOnlyPath(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	c.SetReadOnlyPath("/proc/sys", false)
+
+	if c.IsReadOnlyPath("/proc/sys/kernel") || !c.IsReadOnlyPath("/proc/uptime") {
+		t.Errorf("unexpected read-only state after read-write remount of /proc/sys")
+	}
+}
+
+func Test_container_SetNodeAttr(t *testing.T) {
+
+	c := &container{}
+
+	if _, ok := c.NodeAttr("/proc/sys/kernel/pid_max"); ok {
+		t.Errorf("unexpected node attrs in new container")
+	}
+
+	attr := domain.NodeAttr{Mode: 0664, Uid: 100000, Gid: 100010}
+	c.SetNodeAttr("/proc/sys/kernel/pid_max", attr)
+
+	if got, ok := c.NodeAttr("/proc/sys/kernel/pid_max"); !ok || got != attr {
+		t.Errorf("NodeAttr() = %+v, %v; want %+v, true", got, ok, attr)
+	}
+	if _, ok := c.NodeAttr("/proc/sys/kernel"); ok {
+		t.Errorf("unexpected node attrs for parent node")
+	}
+}
+
+func Test_container_setAnnotations(t *testing.T) {
+
+	hds := &mocks.HandlerServiceIface{}
+	hds.On("CheckResourceValue", "/proc/sys/net/core/somaxconn", []byte("65535\n")).
+		Return([]byte("65535\n"), nil)
+	hds.On("CheckResourceValue", "/proc/sys/kernel/yama/ptrace_scope", []byte("99\n")).
+		Return(nil, errors.New("invalid value"))
+
+	c := &container{
+		id:      "1",
+		service: &containerStateService{hds: hds},
+	}
+
+	// Sysctl values failing the validation of their resources are not served.
+	c.setAnnotations(map[string]string{
+		"io.sysbox.fs.sysctl.net.core.somaxconn":       "65535",
+		"io.sysbox.fs.sysctl.kernel.yama.ptrace_scope": "99",
+	})
+
+	assert.Equal(t, []byte("65535\n"), c.dataStore["/proc/sys/net/core/somaxconn"])
+
+	if _, ok := c.dataStore["/proc/sys/kernel/yama/ptrace_scope"]; ok {
+		t.Errorf("invalid sysctl annotation stored in container data")
+	}
+}
+
+func Test_container_setAnnotationsProfile(t *testing.T) {
+
+	hds := &mocks.HandlerServiceIface{}
+	hds.On("CheckResourceValue", mock.Anything, mock.Anything).Return(
+		func(path string, data []byte) []byte { return data }, nil)
+
+	c := &container{
+		id:      "1",
+		service: &containerStateService{hds: hds},
+		dataStore: map[string][]byte{
+			"/proc/sys/kernel/panic_on_oops": []byte("0\n"),
+		},
+	}
+
+	c.setAnnotations(map[string]string{
+		"io.sysbox.fs.profile":             "k8s",
+		"io.sysbox.fs.sysctl.kernel.panic": "5",
+	})
+
+	// Profile policies are applied to the container's resources.
+	if p, ok := c.ResourcePolicy("/proc/sys/net/bridge/bridge-nf-call-iptables"); !ok ||
+		p != domain.ResourcePolicyExpose {
+		t.Errorf("ResourcePolicy() = %v, %v; want %v, true", p, ok, domain.ResourcePolicyExpose)
+	}
+
+	// Profile sysctls are seeded, unless explicitly defined or already set
+	// within the container.
+	assert.Equal(t, []byte("1\n"), c.dataStore["/proc/sys/net/bridge/bridge-nf-call-iptables"])
+	assert.Equal(t, []byte("25000000\n"), c.dataStore["/proc/sys/kernel/keys/root_maxbytes"])
+	assert.Equal(t, []byte("5\n"), c.dataStore["/proc/sys/kernel/panic"])
+	assert.Equal(t, []byte("0\n"), c.dataStore["/proc/sys/kernel/panic_on_oops"])
+
+	// Unknown profiles are ignored.
+	c = &container{id: "2", service: &containerStateService{hds: hds}}
+	c.setAnnotations(map[string]string{"io.sysbox.fs.profile": "openshift"})
+
+	if _, ok := c.ResourcePolicy("/proc/swaps"); ok || len(c.dataStore) != 0 {
+		t.Errorf("unknown profile applied: %v, %v", c.policies, c.dataStore)
+	}
+}
+
 func Test_container_update(t *testing.T) {
 	type fields struct {
 		id            string
@@ -285,3 +408,40 @@ func Test_container_update(t *testing.T) {
 		})
 	}
 }
+
+func Test_container_ValidateUserNs(t *testing.T) {
+
+	css := &containerStateService{
+		prs: prs,
+		ios: ios,
+	}
+
+	c := &container{
+		id:       "c1",
+		initPid:  1021,
+		initProc: prs.ProcessCreate(1021, 0, 0),
+		service:  css,
+	}
+	c.initProc.CreateNsInodes(223344)
+
+	// Process sharing the container's user-ns.
+	if err := prs.ProcessCreate(1022, 0, 0).CreateNsInodes(223344); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ValidateUserNs(1022); err != nil {
+		t.Errorf("ValidateUserNs(1022) = %v, want nil", err)
+	}
+
+	// Process out of the container's user-ns (e.g., recycled pid).
+	if err := prs.ProcessCreate(1023, 0, 0).CreateNsInodes(556677); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ValidateUserNs(1023); err == nil {
+		t.Errorf("ValidateUserNs(1023) = nil, want error")
+	}
+
+	// Unknown process.
+	if err := c.ValidateUserNs(1024); err == nil {
+		t.Errorf("ValidateUserNs(1024) = nil, want error")
+	}
+}
@@ -0,0 +1,307 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package state
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+//
+// Minimal client-side subset of containerd's grpc API, as required by the
+// runtime watcher: event subscription, container lookup and namespace listing.
+// The messages are (de)serialized as per containerd's protobuf definitions,
+// though only the fields of interest are kept (the rest are skipped), which
+// spares pulling containerd's whole dependency tree into sysbox-fs.
+//
+
+// Methods of containerd's grpc services.
+const (
+	containerdSubscribeMethod      = "/containerd.services.events.v1.Events/Subscribe"
+	containerdGetContainerMethod   = "/containerd.services.containers.v1.Containers/Get"
+	containerdListNamespacesMethod = "/containerd.services.namespaces.v1.Namespaces/List"
+)
+
+// Messages sent to / received from containerd.
+type containerdRequest interface {
+	marshal() []byte
+}
+
+type containerdResponse interface {
+	unmarshal(data []byte) error
+}
+
+// events.v1.SubscribeRequest
+type subscribeRequest struct {
+	filters []string // field 1
+}
+
+// events.v1.Envelope
+type eventEnvelope struct {
+	namespace string // field 2
+	topic     string // field 3
+	typeUrl   string // field 4 (google.protobuf.Any), field 1
+	value     []byte // field 4 (google.protobuf.Any), field 2
+}
+
+// events.TaskStart, events.TaskExit, events.TaskDelete and
+// events.ContainerDelete (the latter just carries the container's id).
+type taskEvent struct {
+	containerID string
+	id          string
+}
+
+// containers.v1.GetContainerRequest
+type getContainerRequest struct {
+	id string // field 1
+}
+
+// containers.v1.GetContainerResponse (field 1: containers.v1.Container)
+type getContainerResponse struct {
+	labels map[string]string // field 2
+	image  string            // field 3
+}
+
+// namespaces.v1.ListNamespacesRequest
+type listNamespacesRequest struct{}
+
+// namespaces.v1.ListNamespacesResponse (field 1: repeated namespaces.v1.Namespace)
+type listNamespacesResponse struct {
+	names []string // field 1 of every namespace
+}
+
+func (m *subscribeRequest) marshal() []byte {
+
+	var buf []byte
+	for _, f := range m.filters {
+		buf = appendPbBytes(buf, 1, []byte(f))
+	}
+
+	return buf
+}
+
+func (m *eventEnvelope) unmarshal(data []byte) error {
+
+	return walkPbFields(data, func(num int, val []byte) error {
+		switch num {
+		case 2:
+			m.namespace = string(val)
+		case 3:
+			m.topic = string(val)
+		case 4:
+			return walkPbFields(val, func(num int, val []byte) error {
+				switch num {
+				case 1:
+					m.typeUrl = string(val)
+				case 2:
+					m.value = val
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// Decodes the ids carried by the given task / container event. The container's
+// id is always the first field, while the field of the process' id (if any)
+// differs among events (zero if not of interest).
+func (m *taskEvent) unmarshalEvent(data []byte, idField int) error {
+
+	return walkPbFields(data, func(num int, val []byte) error {
+		switch num {
+		case 1:
+			m.containerID = string(val)
+		case idField:
+			m.id = string(val)
+		}
+		return nil
+	})
+}
+
+func (m *getContainerRequest) marshal() []byte {
+	return appendPbBytes(nil, 1, []byte(m.id))
+}
+
+func (m *getContainerResponse) unmarshal(data []byte) error {
+
+	return walkPbFields(data, func(num int, val []byte) error {
+		if num != 1 {
+			return nil
+		}
+		return walkPbFields(val, func(num int, val []byte) error {
+			switch num {
+			case 2:
+				k, v, err := unmarshalPbMapEntry(val)
+				if err != nil {
+					return err
+				}
+				if m.labels == nil {
+					m.labels = make(map[string]string)
+				}
+				m.labels[k] = v
+			case 3:
+				m.image = string(val)
+			}
+			return nil
+		})
+	})
+}
+
+func (m *listNamespacesRequest) marshal() []byte {
+	return nil
+}
+
+func (m *listNamespacesResponse) unmarshal(data []byte) error {
+
+	return walkPbFields(data, func(num int, val []byte) error {
+		if num != 1 {
+			return nil
+		}
+		return walkPbFields(val, func(num int, val []byte) error {
+			if num == 1 {
+				m.names = append(m.names, string(val))
+			}
+			return nil
+		})
+	})
+}
+
+//
+// grpc codec of the containerd messages. It's named after the protobuf one, as
+// that's the content-subtype expected by containerd.
+//
+type containerdCodec struct{}
+
+func (containerdCodec) Marshal(v interface{}) ([]byte, error) {
+
+	m, ok := v.(containerdRequest)
+	if !ok {
+		return nil, fmt.Errorf("unexpected request type %T", v)
+	}
+
+	return m.marshal(), nil
+}
+
+func (containerdCodec) Unmarshal(data []byte, v interface{}) error {
+
+	m, ok := v.(containerdResponse)
+	if !ok {
+		return fmt.Errorf("unexpected response type %T", v)
+	}
+
+	return m.unmarshal(data)
+}
+
+func (containerdCodec) Name() string {
+	return "proto"
+}
+
+//
+// Protobuf wire-format helpers.
+//
+
+const (
+	pbWireVarint  = 0
+	pbWireFixed64 = 1
+	pbWireBytes   = 2
+	pbWireFixed32 = 5
+)
+
+// Appends a length-delimited field to the given buffer.
+func appendPbBytes(buf []byte, num int, val []byte) []byte {
+
+	var tmp [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(tmp[:], uint64(num)<<3|pbWireBytes)
+	buf = append(buf, tmp[:n]...)
+	n = binary.PutUvarint(tmp[:], uint64(len(val)))
+	buf = append(buf, tmp[:n]...)
+
+	return append(buf, val...)
+}
+
+// Invokes the given function for every length-delimited field of the given
+// message (other fields are skipped, as none is of interest).
+func walkPbFields(data []byte, fn func(num int, val []byte) error) error {
+
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("malformed protobuf field key")
+		}
+		data = data[n:]
+
+		num := int(key >> 3)
+
+		switch key & 0x7 {
+		case pbWireVarint:
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return errors.New("malformed protobuf varint")
+			}
+			data = data[n:]
+
+		case pbWireFixed64:
+			if len(data) < 8 {
+				return errors.New("truncated protobuf field")
+			}
+			data = data[8:]
+
+		case pbWireFixed32:
+			if len(data) < 4 {
+				return errors.New("truncated protobuf field")
+			}
+			data = data[4:]
+
+		case pbWireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || l > uint64(len(data)-n) {
+				return errors.New("truncated protobuf field")
+			}
+			val := data[n : n+int(l)]
+			data = data[n+int(l):]
+
+			if err := fn(num, val); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&0x7)
+		}
+	}
+
+	return nil
+}
+
+// Decodes a map<string, string> entry.
+func unmarshalPbMapEntry(data []byte) (string, string, error) {
+
+	var k, v string
+
+	err := walkPbFields(data, func(num int, val []byte) error {
+		switch num {
+		case 1:
+			k = string(val)
+		case 2:
+			v = string(val)
+		}
+		return nil
+	})
+
+	return k, v, err
+}
@@ -0,0 +1,411 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package state
+
+import (
+	"context"
+	"net"
+	"path"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/nestybox/sysbox-fs/domain"
+	"github.com/nestybox/sysbox-libs/formatter"
+)
+
+//
+// Runtime watcher. Subscribes to the events of the container manager (i.e.,
+// containerd, which also backs the CRI in K8s deployments and docker) in order
+// to cross-check the registrations received from sysbox-runc:
+//
+// * Sys containers whose task is reported as gone (exited / deleted) and that
+//   are not unregistered within runtimeWatcherGrace (e.g., sysbox-runc was
+//   killed in the middle of the container's teardown) are flagged, and, if so
+//   requested, unregistered. Containers whose init process is still alive are
+//   left alone.
+//
+// * The containers' metadata (i.e., name and image) is obtained from the
+//   container manager, so that it's displayed along with the container's id in
+//   the logs.
+//
+// Containers not managed by containerd (e.g., CRI-O, podman) are not affected.
+//
+
+// Grace period granted to sysbox-runc to unregister a container whose task is
+// gone.
+const runtimeWatcherGrace = 30 * time.Second
+
+// Delay between attempts to (re)connect to the container manager.
+const runtimeWatcherRetry = 10 * time.Second
+
+// Max time a request to the container manager may take.
+const runtimeWatcherTimeout = 5 * time.Second
+
+// Header carrying the namespace of containerd requests.
+const containerdNsHeader = "containerd-namespace"
+
+// Events of interest.
+var runtimeWatcherFilters = []string{
+	`topic=="/tasks/start"`,
+	`topic=="/tasks/exit"`,
+	`topic=="/tasks/delete"`,
+	`topic=="/containers/delete"`,
+}
+
+type runtimeWatcher struct {
+	css     *containerStateService
+	socket  string                 // containerd's grpc socket
+	cleanup bool                   // unregister the containers found gone
+	conn    *grpc.ClientConn       // connection to containerd
+	mu      sync.Mutex             // pending protection
+	pending map[string]*time.Timer // containers whose task is gone, indexed by id
+}
+
+// WatchRuntimeEvents launches the runtime watcher on the given containerd
+// socket. If 'cleanup' is set, the sys containers found gone without being
+// unregistered are unregistered; otherwise these are just flagged (logged).
+func (css *containerStateService) WatchRuntimeEvents(socket string, cleanup bool) {
+
+	rw := &runtimeWatcher{
+		css:     css,
+		socket:  socket,
+		cleanup: cleanup,
+		pending: make(map[string]*time.Timer),
+	}
+
+	go rw.run()
+}
+
+// Runtime watcher's main-loop. Reconnects to containerd whenever the event
+// subscription is interrupted (e.g., containerd restart).
+func (rw *runtimeWatcher) run() {
+
+	logrus.Infof("Watching container events on %s", rw.socket)
+
+	for {
+		if err := rw.watch(); err != nil {
+			logrus.Debugf("Container events subscription on %s interrupted: %v",
+				rw.socket, err)
+		}
+		time.Sleep(runtimeWatcherRetry)
+	}
+}
+
+func (rw *runtimeWatcher) watch() error {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := grpc.DialContext(
+		ctx,
+		rw.socket,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rw.mu.Lock()
+	rw.conn = conn
+	rw.mu.Unlock()
+
+	stream, err := conn.NewStream(
+		ctx,
+		&grpc.StreamDesc{ServerStreams: true},
+		containerdSubscribeMethod,
+		grpc.ForceCodec(containerdCodec{}),
+	)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&subscribeRequest{filters: runtimeWatcherFilters}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	// Catch up with the events missed while disconnected.
+	rw.reconcile()
+
+	for {
+		var env eventEnvelope
+		if err := stream.RecvMsg(&env); err != nil {
+			return err
+		}
+		rw.handleEvent(&env)
+	}
+}
+
+func (rw *runtimeWatcher) handleEvent(env *eventEnvelope) {
+
+	if env.typeUrl == "" {
+		return
+	}
+
+	var ev taskEvent
+
+	switch path.Base(env.typeUrl) {
+
+	case "containerd.events.TaskStart":
+		if err := ev.unmarshalEvent(env.value, 0); err != nil {
+			return
+		}
+		if c := rw.lookup(ev.containerID); c != nil {
+			rw.enrich(c, env.namespace)
+		}
+
+	case "containerd.events.TaskExit":
+		if err := ev.unmarshalEvent(env.value, 2); err != nil {
+			return
+		}
+		// Only the exit of the container's init process is of interest.
+		if ev.id == ev.containerID {
+			rw.taskGone(ev.containerID)
+		}
+
+	case "containerd.events.TaskDelete":
+		if err := ev.unmarshalEvent(env.value, 5); err != nil {
+			return
+		}
+		rw.taskGone(ev.containerID)
+
+	case "containerd.events.ContainerDelete":
+		if err := ev.unmarshalEvent(env.value, 0); err != nil {
+			return
+		}
+		rw.taskGone(ev.containerID)
+	}
+}
+
+// Cross-checks the registered containers against containerd: containers unknown
+// to containerd are checked for staleness (once the grace period expires),
+// while the metadata of the rest is refreshed.
+func (rw *runtimeWatcher) reconcile() {
+
+	nss, err := rw.namespaces()
+	if err != nil {
+		logrus.Debugf("Unable to list containerd namespaces: %v", err)
+		return
+	}
+
+	for _, c := range rw.containers() {
+		found := false
+		for _, ns := range nss {
+			if md, ok := rw.metadata(c.id, ns); ok {
+				found = true
+				if !reflect.DeepEqual(c.Metadata(), md) {
+					c.SetMetadata(md)
+				}
+				break
+			}
+		}
+
+		// Containers not managed by containerd are left alone, as long as
+		// their init process is alive.
+		if !found {
+			rw.taskGone(c.id)
+		}
+	}
+}
+
+// Schedules the staleness check of a container whose task is gone.
+func (rw *runtimeWatcher) taskGone(id string) {
+
+	if rw.lookup(id) == nil {
+		return
+	}
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if _, ok := rw.pending[id]; ok {
+		return
+	}
+
+	rw.pending[id] = time.AfterFunc(runtimeWatcherGrace, func() {
+		rw.mu.Lock()
+		delete(rw.pending, id)
+		rw.mu.Unlock()
+
+		rw.check(id)
+	})
+}
+
+// Flags (or unregisters) the given container if it's still registered while
+// its init process is gone.
+func (rw *runtimeWatcher) check(id string) {
+
+	c := rw.lookup(id)
+	if c == nil || c.initAlive() {
+		return
+	}
+
+	if !rw.cleanup {
+		logrus.Warnf("Container %s is gone but remains registered (%s)",
+			formatter.ContainerID{id}, c.string())
+		return
+	}
+
+	logrus.Warnf("Container %s is gone but remains registered; unregistering it",
+		formatter.ContainerID{id})
+
+	if err := rw.css.ContainerUnregister(c); err != nil {
+		logrus.Warnf("Unable to unregister container %s: %v",
+			formatter.ContainerID{id}, err)
+	}
+}
+
+// Obtains the container's metadata from the given containerd namespace.
+func (rw *runtimeWatcher) enrich(c *container, ns string) {
+
+	if md, ok := rw.metadata(c.id, ns); ok {
+		c.SetMetadata(md)
+		logrus.Debugf("Container %s metadata: %+v", formatter.ContainerID{c.id}, md)
+	}
+}
+
+func (rw *runtimeWatcher) metadata(id, ns string) (domain.ContainerMetadata, bool) {
+
+	ctx, cancel := rw.requestContext(ns)
+	defer cancel()
+
+	conn := rw.connection()
+	if conn == nil {
+		return domain.ContainerMetadata{}, false
+	}
+
+	var resp getContainerResponse
+
+	err := conn.Invoke(
+		ctx,
+		containerdGetContainerMethod,
+		&getContainerRequest{id: id},
+		&resp,
+		grpc.ForceCodec(containerdCodec{}),
+	)
+	if err != nil {
+		return domain.ContainerMetadata{}, false
+	}
+
+	return domain.ContainerMetadata{
+		Namespace: ns,
+		Name:      containerName(resp.labels),
+		Image:     resp.image,
+		Labels:    resp.labels,
+	}, true
+}
+
+func (rw *runtimeWatcher) namespaces() ([]string, error) {
+
+	ctx, cancel := rw.requestContext("")
+	defer cancel()
+
+	conn := rw.connection()
+	if conn == nil {
+		return nil, nil
+	}
+
+	var resp listNamespacesResponse
+
+	err := conn.Invoke(
+		ctx,
+		containerdListNamespacesMethod,
+		&listNamespacesRequest{},
+		&resp,
+		grpc.ForceCodec(containerdCodec{}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.names, nil
+}
+
+func (rw *runtimeWatcher) requestContext(ns string) (context.Context, context.CancelFunc) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), runtimeWatcherTimeout)
+	if ns != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, containerdNsHeader, ns)
+	}
+
+	return ctx, cancel
+}
+
+func (rw *runtimeWatcher) connection() *grpc.ClientConn {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	return rw.conn
+}
+
+func (rw *runtimeWatcher) lookup(id string) *container {
+	rw.css.RLock()
+	defer rw.css.RUnlock()
+
+	return rw.css.idTable[id]
+}
+
+func (rw *runtimeWatcher) containers() []*container {
+	rw.css.RLock()
+	defer rw.css.RUnlock()
+
+	cntrs := make([]*container, 0, len(rw.css.idTable))
+	for _, c := range rw.css.idTable {
+		cntrs = append(cntrs, c)
+	}
+
+	return cntrs
+}
+
+// Returns the container's name as per the labels set by the container manager:
+// K8s (CRI) containers are named after their pod, and nerdctl ones after their
+// name. Docker doesn't expose the container's name to containerd.
+func containerName(labels map[string]string) string {
+
+	if cntr, ok := labels["io.kubernetes.container.name"]; ok {
+		return labels["io.kubernetes.pod.namespace"] + "/" +
+			labels["io.kubernetes.pod.name"] + "/" + cntr
+	}
+
+	return labels["nerdctl/name"]
+}
+
+// Reports whether the container's init process is alive. Containers that never
+// completed their registration (i.e., no init process) are deemed gone.
+func (c *container) initAlive() bool {
+	c.intLock.RLock()
+	defer c.intLock.RUnlock()
+
+	if c.initPidFd == 0 {
+		return false
+	}
+
+	return unix.PidfdSendSignal(int(c.initPidFd), 0, nil, 0) != unix.ESRCH
+}
@@ -0,0 +1,154 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package state
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestContainerName(t *testing.T) {
+
+	var tests = []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{"docker", map[string]string{"com.docker.compose.project": "p"}, ""},
+		{"nerdctl", map[string]string{"nerdctl/name": "web"}, "web"},
+		{"k8s", map[string]string{
+			"io.kubernetes.pod.namespace":  "default",
+			"io.kubernetes.pod.name":       "pod-1",
+			"io.kubernetes.container.name": "app",
+		}, "default/pod-1/app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerName(tt.labels); got != tt.want {
+				t.Errorf("containerName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Appends a varint field to the given buffer (i.e., a field to be skipped).
+func appendPbVarint(buf []byte, num int, val uint64) []byte {
+
+	var tmp [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(tmp[:], uint64(num)<<3)
+	buf = append(buf, tmp[:n]...)
+	n = binary.PutUvarint(tmp[:], val)
+
+	return append(buf, tmp[:n]...)
+}
+
+func TestContainerdMessages(t *testing.T) {
+
+	// Subscription request.
+	req := &subscribeRequest{filters: runtimeWatcherFilters}
+
+	var filters []string
+	err := walkPbFields(req.marshal(), func(num int, val []byte) error {
+		if num == 1 {
+			filters = append(filters, string(val))
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(filters, runtimeWatcherFilters) {
+		t.Errorf("subscribeRequest filters = %v, %v; want %v", filters, err,
+			runtimeWatcherFilters)
+	}
+
+	// Event envelope carrying a TaskExit event (pid and exit status skipped).
+	var taskExit []byte
+	taskExit = appendPbBytes(taskExit, 1, []byte("c1"))
+	taskExit = appendPbBytes(taskExit, 2, []byte("c1"))
+	taskExit = appendPbVarint(taskExit, 3, 1234)
+	taskExit = appendPbVarint(taskExit, 4, 137)
+
+	var anyMsg []byte
+	anyMsg = appendPbBytes(anyMsg, 1, []byte("types.containerd.io/containerd.events.TaskExit"))
+	anyMsg = appendPbBytes(anyMsg, 2, taskExit)
+
+	var envelope []byte
+	envelope = appendPbBytes(envelope, 1, []byte{0x08, 0x01}) // timestamp
+	envelope = appendPbBytes(envelope, 2, []byte("k8s.io"))
+	envelope = appendPbBytes(envelope, 3, []byte("/tasks/exit"))
+	envelope = appendPbBytes(envelope, 4, anyMsg)
+
+	var env eventEnvelope
+	if err := (containerdCodec{}).Unmarshal(envelope, &env); err != nil {
+		t.Fatalf("eventEnvelope unmarshal failed: %v", err)
+	}
+	if env.namespace != "k8s.io" || env.topic != "/tasks/exit" ||
+		env.typeUrl != "types.containerd.io/containerd.events.TaskExit" {
+		t.Errorf("eventEnvelope = %+v", env)
+	}
+
+	var ev taskEvent
+	if err := ev.unmarshalEvent(env.value, 2); err != nil ||
+		ev.containerID != "c1" || ev.id != "c1" {
+		t.Errorf("taskEvent = %+v, %v; want c1 / c1", ev, err)
+	}
+
+	// Container lookup.
+	var entry []byte
+	entry = appendPbBytes(entry, 1, []byte("nerdctl/name"))
+	entry = appendPbBytes(entry, 2, []byte("web"))
+
+	var cntr []byte
+	cntr = appendPbBytes(cntr, 1, []byte("c1"))
+	cntr = appendPbBytes(cntr, 2, entry)
+	cntr = appendPbBytes(cntr, 3, []byte("docker.io/library/nginx:latest"))
+
+	var getResp getContainerResponse
+	if err := getResp.unmarshal(appendPbBytes(nil, 1, cntr)); err != nil {
+		t.Fatalf("getContainerResponse unmarshal failed: %v", err)
+	}
+	if getResp.image != "docker.io/library/nginx:latest" ||
+		!reflect.DeepEqual(getResp.labels, map[string]string{"nerdctl/name": "web"}) {
+		t.Errorf("getContainerResponse = %+v", getResp)
+	}
+
+	// Namespace listing.
+	var nsResp []byte
+	for _, ns := range []string{"default", "k8s.io"} {
+		nsResp = appendPbBytes(nsResp, 1, appendPbBytes(nil, 1, []byte(ns)))
+	}
+
+	var listResp listNamespacesResponse
+	if err := listResp.unmarshal(nsResp); err != nil ||
+		!reflect.DeepEqual(listResp.names, []string{"default", "k8s.io"}) {
+		t.Errorf("listNamespacesResponse = %+v, %v", listResp, err)
+	}
+
+	// Malformed messages.
+	for _, data := range [][]byte{
+		{0x0a, 0x05, 'a'}, // truncated field
+		{0x0b},            // unsupported wire type
+		{0x80},            // truncated key
+		{0x08, 0x80},      // truncated varint
+	} {
+		var env eventEnvelope
+		if err := env.unmarshal(data); err == nil {
+			t.Errorf("unmarshal(%x) succeeded", data)
+		}
+	}
+}
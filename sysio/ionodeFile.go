@@ -201,6 +201,23 @@ func (i *IOnodeFile) ReadLine() (string, error) {
 	return res, nil
 }
 
+// Returns the target of the symlink at the node's path. In unit-testing
+// scenarios, the target is extracted from the file content itself, as afero-fs
+// lacks symlink support.
+func (i *IOnodeFile) ReadLink() (string, error) {
+
+	if i.fss.fsType == domain.IOMemFileService {
+		content, err := afero.ReadFile(i.fss.appFs, i.path)
+		if err != nil {
+			return "", err
+		}
+
+		return string(content), nil
+	}
+
+	return os.Readlink(i.path)
+}
+
 func (i *IOnodeFile) WriteAt(p []byte, off int64) (n int, err error) {
 
 	if i.file == nil {